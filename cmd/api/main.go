@@ -2,11 +2,91 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"go-basics/internal/app"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "selftest":
+			// `api selftest` runs a synthetic signup/login/get/delete journey,
+			// checks shutdown leaks nothing, and exits non-zero on failure, for
+			// use as a deployment gate.
+			if err := app.SelfTest(); err != nil {
+				log.Fatalf("selftest failed: %v", err)
+			}
+			return
+
+		case "schema-manifest":
+			// `api schema-manifest > release.json` records what this release
+			// needs from the schema, for linting the next release's migrations.
+			if err := app.WriteSchemaManifest(os.Stdout); err != nil {
+				log.Fatalf("schema-manifest failed: %v", err)
+			}
+			return
+
+		case "migrate-lint":
+			// `api migrate-lint release.json` fails if a new migration would
+			// break the release that manifest came from (blue/green deploys).
+			if len(os.Args) < 3 {
+				log.Fatalf("usage: %s migrate-lint <previous-manifest.json>", os.Args[0])
+			}
+			if err := app.LintMigrations(os.Args[2], os.Stdout); err != nil {
+				log.Fatalf("migrate-lint failed: %v", err)
+			}
+			return
+
+		case "response-manifest":
+			// `api response-manifest > responses.json` records the shape of
+			// this release's v1 responses, for checking the next release.
+			if err := app.WriteResponseManifest(os.Stdout); err != nil {
+				log.Fatalf("response-manifest failed: %v", err)
+			}
+			return
+
+		case "response-lint":
+			// `api response-lint responses.json` fails if a v1 response
+			// field was removed, renamed, or changed type since that release.
+			if len(os.Args) < 3 {
+				log.Fatalf("usage: %s response-lint <previous-manifest.json>", os.Args[0])
+			}
+			if err := app.LintResponses(os.Args[2], os.Stdout); err != nil {
+				log.Fatalf("response-lint failed: %v", err)
+			}
+			return
+
+		case "config-doc":
+			// `api config-doc [markdown|json]` lists every environment variable
+			// with its type, default, and description.
+			format := ""
+			if len(os.Args) > 2 {
+				format = os.Args[2]
+			}
+			if err := app.WriteConfigDoc(os.Stdout, format); err != nil {
+				log.Fatalf("config-doc failed: %v", err)
+			}
+			return
+
+		case "audit-verify":
+			// `api audit-verify mysql` or `api audit-verify file [path...]`
+			// checks the audit trail's hash chain for edits and gaps.
+			if err := app.VerifyAudit(os.Args[2:], os.Stdout); err != nil {
+				log.Fatalf("audit-verify failed: %v", err)
+			}
+			return
+
+		case "config-check":
+			// `api config-check` fails on unparseable values and unknown
+			// variables (typos) before a bad config reaches production.
+			if err := app.CheckConfig(os.Stdout); err != nil {
+				log.Fatalf("config-check failed: %v", err)
+			}
+			return
+		}
+	}
+
 	if err := app.Run(); err != nil {
 		log.Fatalf("application failed to start: %v", err)
 	}
@@ -0,0 +1,220 @@
+// Command dashboard generates the Grafana dashboard for authentication metrics.
+//
+// The dashboard is generated instead of hand-edited so its queries use the
+// same metric names as the code (see internal/metrics/auth.go). Regenerate
+// it after changing a metric:
+//
+//	go generate ./internal/metrics
+//
+// or directly:
+//
+//	go run ./cmd/dashboard -o dashboards/auth.json
+//
+// Import the JSON file in Grafana (Dashboards -> New -> Import).
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-basics/internal/metrics"
+)
+
+// The types below model just the parts of Grafana's dashboard JSON we use.
+
+type dashboard struct {
+	UID           string     `json:"uid"`
+	Title         string     `json:"title"`
+	Tags          []string   `json:"tags"`
+	SchemaVersion int        `json:"schemaVersion"`
+	Refresh       string     `json:"refresh"`
+	Time          timeRange  `json:"time"`
+	Templating    templating `json:"templating"`
+	Panels        []panel    `json:"panels"`
+}
+
+type timeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type templating struct {
+	List []variable `json:"list"`
+}
+
+// variable lets the user pick the Prometheus data source on import.
+type variable struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Type  string `json:"type"`
+	Query string `json:"query"`
+}
+
+type panel struct {
+	ID          int          `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	Type        string       `json:"type"`
+	Datasource  datasource   `json:"datasource"`
+	GridPos     gridPos      `json:"gridPos"`
+	Targets     []target     `json:"targets"`
+	FieldConfig *fieldConfig `json:"fieldConfig,omitempty"`
+}
+
+type datasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type gridPos struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	W int `json:"w"`
+	H int `json:"h"`
+}
+
+// target is one PromQL query. Exemplar=true draws exemplar dots on the
+// graph; clicking one opens the linked trace.
+type target struct {
+	RefID        string     `json:"refId"`
+	Expr         string     `json:"expr"`
+	LegendFormat string     `json:"legendFormat,omitempty"`
+	Exemplar     bool       `json:"exemplar"`
+	Datasource   datasource `json:"datasource"`
+}
+
+type fieldConfig struct {
+	Defaults fieldDefaults `json:"defaults"`
+}
+
+type fieldDefaults struct {
+	Unit string `json:"unit,omitempty"`
+}
+
+// prometheus is the data source chosen through the template variable.
+var prometheus = datasource{Type: "prometheus", UID: "${datasource}"}
+
+// panelSpec is the compact description each dashboard panel is built from.
+type panelSpec struct {
+	title       string
+	description string
+	unit        string
+	queries     []query
+}
+
+type query struct {
+	expr   string
+	legend string
+}
+
+// rate returns a per-second rate query summed by the given labels.
+func rate(metric, by string) string {
+	return fmt.Sprintf("sum by (%s) (rate(%s[$__rate_interval]))", by, metric)
+}
+
+// panels lists the dashboard contents, top to bottom, two per row.
+var panels = []panelSpec{
+	{
+		title:       "Logins by result",
+		description: "Successful vs failed POST /login calls.",
+		unit:        "reqps",
+		queries:     []query{{rate(metrics.LoginAttemptsName, "result"), "{{result}}"}},
+	},
+	{
+		title:       "Login failures by reason",
+		description: "A jump in invalid_credentials often means credential stuffing.",
+		unit:        "reqps",
+		queries: []query{{
+			fmt.Sprintf(`sum by (reason) (rate(%s{result="%s"}[$__rate_interval]))`, metrics.LoginAttemptsName, metrics.ResultFailure),
+			"{{reason}}",
+		}},
+	},
+	{
+		title: "Login success ratio",
+		unit:  "percentunit",
+		queries: []query{{
+			fmt.Sprintf(`sum(rate(%[1]s{result="%[2]s"}[$__rate_interval])) / sum(rate(%[1]s[$__rate_interval]))`,
+				metrics.LoginAttemptsName, metrics.ResultSuccess),
+			"success ratio",
+		}},
+	},
+	{
+		title:       "Token validation failures by cause",
+		description: "bad_signature or unknown_key spikes can mean forged tokens or a key rotation gone wrong.",
+		unit:        "reqps",
+		queries:     []query{{rate(metrics.TokenFailuresName, "cause"), "{{cause}}"}},
+	},
+	{
+		title:   "2FA challenges by result",
+		unit:    "reqps",
+		queries: []query{{rate(metrics.MFAChallengesName, "result"), "{{result}}"}},
+	},
+	{
+		title:   "Sign-ups by result and reason",
+		unit:    "reqps",
+		queries: []query{{rate(metrics.SignupsName, "result, reason"), "{{result}} {{reason}}"}},
+	},
+}
+
+// build turns the panel specs into a Grafana dashboard.
+func build() dashboard {
+	d := dashboard{
+		UID:           "go-basics-auth",
+		Title:         "go-basics / Authentication",
+		Tags:          []string{"go-basics", "auth"},
+		SchemaVersion: 39,
+		Refresh:       "30s",
+		Time:          timeRange{From: "now-6h", To: "now"},
+		Templating: templating{List: []variable{
+			{Name: "datasource", Label: "Data source", Type: "datasource", Query: "prometheus"},
+		}},
+	}
+
+	const width, height = 12, 8
+	for i, spec := range panels {
+		p := panel{
+			ID:          i + 1,
+			Title:       spec.title,
+			Description: spec.description,
+			Type:        "timeseries",
+			Datasource:  prometheus,
+			GridPos:     gridPos{X: (i % 2) * width, Y: (i / 2) * height, W: width, H: height},
+		}
+		if spec.unit != "" {
+			p.FieldConfig = &fieldConfig{Defaults: fieldDefaults{Unit: spec.unit}}
+		}
+		for j, q := range spec.queries {
+			p.Targets = append(p.Targets, target{
+				RefID:        string(rune('A' + j)),
+				Expr:         q.expr,
+				LegendFormat: q.legend,
+				Exemplar:     true,
+				Datasource:   prometheus,
+			})
+		}
+		d.Panels = append(d.Panels, p)
+	}
+	return d
+}
+
+func main() {
+	output := flag.String("o", "", "write the dashboard to this file instead of stdout")
+	flag.Parse()
+
+	data, err := json.MarshalIndent(build(), "", "  ")
+	if err != nil {
+		log.Fatalf("encoding dashboard: %v", err)
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		log.Fatalf("writing dashboard: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+// Command vapidkeys generates a VAPID key pair for web push.
+//
+//	go run ./cmd/vapidkeys
+//
+// Set WEBPUSH_VAPID_PRIVATE_KEY to the private key. The public key is
+// also served at GET /push/vapid-public-key, so it's printed only for
+// reference. Generate a pair once per deployment: browsers subscribed
+// with the old public key stop getting pushes when it changes.
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"go-basics/internal/webpush"
+)
+
+func main() {
+	privateKey, publicKey, err := webpush.GenerateKey()
+	if err != nil {
+		log.Fatalf("generating VAPID key: %v", err)
+	}
+	fmt.Printf("WEBPUSH_VAPID_PRIVATE_KEY=%s\n", privateKey)
+	fmt.Printf("# public key: %s\n", publicKey)
+}
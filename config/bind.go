@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Struct tags understood by bind:
+//
+//	env:"DB_DSN"          the environment variable (fields without it are
+//	                      skipped, nested structs are searched recursively)
+//	default:"10"          used when the variable is unset or empty
+//	required:"true"       unset/empty with no default is an error
+//	secret:"true"         the value is redacted in Settings (logs, diagnostics)
+//	desc:"..."            one-line description for config-doc
+//
+// Supported field types: string, int, int64, float64, bool, []string
+// (comma-separated; items are trimmed, empty items dropped), and the unit
+// types time.Duration ("1h30m", "7d"), Size ("10MB"), and Ratio ("25%").
+//
+// WHY TAGS INSTEAD OF getEnv CALLS?
+// With a getEnv call per field, the variable name, its default, and its
+// documentation lived in three places (the struct, Load, and CLAUDE.md),
+// and a typo'd value was silently replaced by the default. With tags, the
+// field is the single source of truth for binding, docs, and redaction.
+
+// redacted replaces secret values in Settings.
+const redacted = "[REDACTED]"
+
+// bind fills cfg from lookup (os.LookupEnv in production).
+// All problems are reported together, not just the first.
+func bind(cfg *Config, lookup func(string) (string, bool)) error {
+	root := reflect.ValueOf(cfg).Elem()
+
+	var errs []error
+	for _, v := range Variables() {
+		raw, _ := lookup(v.Name)
+		if raw == "" {
+			raw = v.Default
+		}
+		if raw == "" {
+			if v.Required {
+				errs = append(errs, fmt.Errorf("%s is required", v.Name))
+			}
+			continue
+		}
+
+		if err := setValue(root.FieldByIndex(v.index), raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", v.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// setValue parses raw into field according to the field's type.
+func setValue(field reflect.Value, raw string) error {
+	// Units first: they're int64/float64 underneath, but parse differently.
+	// All three parsers live in units.go and name the expected format.
+	switch field.Type() {
+	case durationType:
+		d, err := ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	case sizeType:
+		size, err := ParseSize(raw)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(size))
+		return nil
+	case ratioType:
+		ratio, err := ParseRatio(raw)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(float64(ratio))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		// ParseBool accepts "1", "t", "true", "0", "f", "false" (any case).
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean (true or false)", raw)
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// Setting is one configuration value as loaded, safe to log or display.
+type Setting struct {
+	Name      string `json:"name"`
+	Value     string `json:"value"`      // "[REDACTED]" for non-empty secrets
+	IsDefault bool   `json:"is_default"` // Whether Value equals the default
+}
+
+// Settings lists every configuration value with secrets redacted,
+// for startup logs and the admin config endpoint.
+//
+// Never log the Config struct itself: it holds the JWT secret and
+// database passwords. Settings is the one safe way to show it.
+func (c *Config) Settings() []Setting {
+	root := reflect.ValueOf(c).Elem()
+
+	vars := Variables()
+	settings := make([]Setting, 0, len(vars))
+	for _, v := range vars {
+		field := root.FieldByIndex(v.index)
+
+		def := reflect.New(v.typ).Elem()
+		if v.Default != "" {
+			setValue(def, v.Default)
+		}
+
+		value := formatValue(field)
+		if v.Secret && value != "" {
+			value = redacted
+		}
+		settings = append(settings, Setting{
+			Name:      v.Name,
+			Value:     value,
+			IsDefault: reflect.DeepEqual(field.Interface(), def.Interface()),
+		})
+	}
+	return settings
+}
+
+// String lists the settings that differ from their defaults, redacted.
+// It makes an accidental log.Printf("%v", cfg) safe.
+func (c *Config) String() string {
+	var parts []string
+	for _, s := range c.Settings() {
+		if !s.IsDefault {
+			parts = append(parts, s.Name+"="+s.Value)
+		}
+	}
+	if len(parts) == 0 {
+		return "(all defaults)"
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatValue renders a field the way it would be written in the environment.
+func formatValue(field reflect.Value) string {
+	if field.Type() == durationType {
+		return time.Duration(field.Int()).String()
+	}
+	if field.Kind() == reflect.Slice {
+		return strings.Join(field.Interface().([]string), ",")
+	}
+	return fmt.Sprint(field.Interface())
+}
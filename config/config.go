@@ -5,7 +5,6 @@ package config
 
 import (
 	"os"
-	"strconv"
 	"time"
 )
 
@@ -13,47 +12,361 @@ import (
 // We use a struct to group related settings together,
 // making it easy to pass configuration through the application.
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
+	App         AppConfig
+	Server      ServerConfig
+	HTTP3       HTTP3Config
+	MTLS        MTLSConfig
+	Signing     SigningConfig
+	DPoP        DPoPConfig
+	Database    DatabaseConfig
+	UserCache   UserCacheConfig
+	JWT         JWTConfig
+	Admin       AdminConfig
+	Mail        MailConfig
+	Emails      EmailConfig
+	Reset       PasswordResetConfig
+	EmailChange EmailChangeConfig
+	Invites     InvitationConfig
+	Password    PasswordConfig
+	SLO         SLOConfig
+	MFA         MFAConfig
+	Probe       ProbeConfig
+	Metrics     MetricsConfig
+	Limits      RateLimitConfig
+	Lock        LockConfig
+	Jobs        JobsConfig
+	Notify      NotifyConfig
+	WebPush     WebPushConfig
+	Avatars     AvatarConfig
+	SAML        SAMLConfig
+	Audit       AuditConfig
+	Dormancy    DormancyConfig
+	Anonymize   AnonymizeConfig
+	Import      ImportConfig
+	Export      ExportConfig
+	Campaigns   CampaignConfig
+	Captcha     CaptchaConfig
+	Risk        RiskConfig
+	Webhooks    WebhookConfig
+	Tenants     TenantConfig
+	Redirects   RedirectConfig
+	Secrets     SecretsConfig
+}
+
+// AppConfig holds application-wide settings.
+type AppConfig struct {
+	// Env is the deployment environment: "development", "staging", or "production".
+	// Some diagnostics (like the index advisor) only run outside production.
+	Env string `env:"APP_ENV" default:"development" desc:"Deployment environment: development, staging, or production"`
+}
+
+// IsProduction reports whether the app runs in production.
+func (c AppConfig) IsProduction() bool {
+	return c.Env == "production"
 }
 
 // ServerConfig holds HTTP server settings.
 type ServerConfig struct {
 	// Port is the HTTP port the server listens on.
-	Port string
+	Port string `env:"SERVER_PORT" default:"8080" desc:"HTTP port the server listens on"`
 
 	// ReadTimeout is the maximum duration for reading the entire request.
 	// This prevents slow clients from holding connections open.
-	ReadTimeout time.Duration
+	ReadTimeout time.Duration `env:"SERVER_READ_TIMEOUT" default:"5s" desc:"Maximum time to read a whole request"`
 
 	// WriteTimeout is the maximum duration for writing the response.
 	// This prevents slow clients from holding connections open.
-	WriteTimeout time.Duration
+	// It's also each request context's deadline (see http.Deadline).
+	WriteTimeout time.Duration `env:"SERVER_WRITE_TIMEOUT" default:"10s" desc:"Maximum time to write a response; handlers are cancelled after it too"`
 
 	// IdleTimeout is the maximum time to wait for the next request
 	// when keep-alives are enabled.
-	IdleTimeout time.Duration
+	IdleTimeout time.Duration `env:"SERVER_IDLE_TIMEOUT" default:"60s" desc:"How long idle keep-alive connections stay open"`
+
+	// MaxBodySize caps every request body ("1MB"). Requests over it get 413.
+	// Every JSON body this API accepts is a few hundred bytes; the cap stops
+	// a client from making the server buffer gigabytes.
+	MaxBodySize Size `env:"SERVER_MAX_BODY_SIZE" default:"1MB" desc:"Largest accepted request body"`
+
+	// MaxHeaderSize caps the request line plus headers ("1MB", Go's default).
+	MaxHeaderSize Size `env:"SERVER_MAX_HEADER_SIZE" default:"1MB" desc:"Largest accepted request line and headers"`
+
+	// ShutdownTimeout is how long in-flight requests get to finish after
+	// SIGTERM before the server stops anyway. Keep it (plus
+	// JOBS_DRAIN_TIMEOUT) under the orchestrator's kill grace period.
+	ShutdownTimeout time.Duration `env:"SERVER_SHUTDOWN_TIMEOUT" default:"15s" desc:"How long in-flight requests get to finish at shutdown"`
+
+	// Timing answers requests sending "X-Debug-Timing: 1" with a
+	// Server-Timing header: how long auth, the service, the database,
+	// and encoding took. It shows attackers how long each step takes
+	// too, so leave it off where that matters.
+	Timing bool `env:"SERVER_TIMING" default:"false" desc:"Send a Server-Timing breakdown to requests with X-Debug-Timing: 1"`
+
+	// TLSCertFile and TLSKeyFile make SERVER_PORT serve HTTPS instead of
+	// plain HTTP. Most deployments terminate TLS at a load balancer and
+	// leave them empty; HTTP/3 needs them either way (see HTTP3Config).
+	TLSCertFile string `env:"SERVER_TLS_CERT_FILE" desc:"PEM certificate chain; serves HTTPS on SERVER_PORT (required for HTTP/3)"`
+	TLSKeyFile  string `env:"SERVER_TLS_KEY_FILE" desc:"PEM private key for SERVER_TLS_CERT_FILE"`
+}
+
+// TLS reports whether a certificate is configured.
+func (c ServerConfig) TLS() bool {
+	return c.TLSCertFile != "" || c.TLSKeyFile != ""
+}
+
+// HTTP3Config holds the optional HTTP/3 listener. It's off unless a
+// port is set.
+//
+// HTTP/3 runs over QUIC, on UDP. Clients don't try it unprompted: they
+// connect over TCP first, and the Alt-Svc header on the response tells
+// them where HTTP/3 is. Browsers only believe Alt-Svc over HTTPS, so
+// TCP must reach them through TLS: SERVER_TLS_CERT_FILE, or a load
+// balancer that terminates it and passes UDP through.
+type HTTP3Config struct {
+	Port string `env:"HTTP3_PORT" desc:"UDP port for HTTP/3 (QUIC), e.g. 443 (enables HTTP/3; needs SERVER_TLS_CERT_FILE)"`
+
+	// AdvertisedPort is the port clients reach HTTP/3 on, when a load
+	// balancer or NAT maps it to a different one.
+	AdvertisedPort string `env:"HTTP3_ADVERTISED_PORT" desc:"UDP port advertised to clients in Alt-Svc (empty uses HTTP3_PORT)"`
+
+	// AltSvcMaxAge is how long clients remember that HTTP/3 is there.
+	// Keep it short while trying HTTP/3 out: a client that can't reach
+	// the UDP port falls back to TCP, but only after a timeout.
+	AltSvcMaxAge time.Duration `env:"HTTP3_ALT_SVC_MAX_AGE" default:"24h" desc:"How long clients may remember the Alt-Svc advertisement"`
+}
+
+// Enabled reports whether HTTP/3 is configured.
+func (c HTTP3Config) Enabled() bool {
+	return c.Port != ""
+}
+
+// MTLSConfig holds client certificate (mutual TLS) settings, for other
+// services calling this one.
+//
+// Client certificates are part of the TLS handshake, so this needs
+// SERVER_TLS_CERT_FILE: a load balancer that terminates TLS in front of
+// the server sees the certificate, and this server doesn't.
+type MTLSConfig struct {
+	// ClientAuth is what the handshake asks of clients: "off"; "request",
+	// verifying a certificate when one is sent (browsers send none and
+	// carry on with tokens); or "require", refusing connections without
+	// one, for a listener only services reach.
+	ClientAuth string `env:"MTLS_CLIENT_AUTH" default:"off" desc:"Client certificates: off, request (verified if sent), or require (no connection without one)"`
+
+	// ClientCAFile holds the CAs client certificates must chain to.
+	ClientCAFile string `env:"MTLS_CLIENT_CA_FILE" desc:"PEM bundle of the CAs that issue client certificates"`
+
+	// Services maps certificate identities to the scopes the service may
+	// use. Format: "<rule>=<scope>+<scope>", comma-separated, where a
+	// rule is uri:<SAN>, dns:<SAN>, or cn:<common name>, e.g.
+	// "uri:spiffe://corp/ops=jobs:manage+tunables:manage".
+	Services []string `env:"MTLS_SERVICES" desc:"Services by certificate, as <uri:|dns:|cn:identity>=<scope>+<scope>, comma-separated"`
+
+	// Routes sets how routes authenticate, by pattern. Format:
+	// "<pattern>=<policy>", comma-separated, e.g. "GET /admin/jobs=mtls".
+	// Policies: jwt (the default), mtls, mtls_or_jwt, mtls_and_jwt.
+	Routes []string `env:"MTLS_ROUTES" desc:"Per-route auth as <pattern>=<jwt|mtls|mtls_or_jwt|mtls_and_jwt>, comma-separated"`
+}
+
+// Enabled reports whether the server asks for client certificates.
+func (c MTLSConfig) Enabled() bool {
+	return c.ClientAuth != "" && c.ClientAuth != "off"
+}
+
+// SigningConfig holds the clients that authenticate by signing requests
+// with a shared secret (see auth.RequestVerifier), for integrations that
+// can't hold a client certificate. None are accepted unless a secret is
+// set.
+type SigningConfig struct {
+	// Secrets are "keyID=secret" pairs, like WEBHOOK_SECRETS. A key ID
+	// listed twice accepts either secret, for rotation. Secrets must be
+	// at least 32 bytes.
+	Secrets []string `env:"SIGNING_SECRETS" desc:"Comma-separated keyID=secret pairs for signed requests (empty disables them)" secret:"true"`
+
+	// SecretsFile reads Secrets from a file instead, one pair per line
+	// (or comma-separated), and is reloaded when it changes: add a new
+	// secret next to the old one, move the client over, then drop the
+	// old one, without a restart.
+	SecretsFile string `env:"SIGNING_SECRETS_FILE" desc:"File with the keyID=secret pairs, one per line, replacing SIGNING_SECRETS; reloaded when it changes"`
+
+	// Clients maps key IDs to the scopes their requests get. Format:
+	// "<keyID>=<scope>+<scope>", comma-separated. Kept apart from the
+	// secrets so the scopes show in Settings, unredacted.
+	Clients []string `env:"SIGNING_CLIENTS" desc:"Scopes per signing key, as <keyID>=<scope>+<scope>, comma-separated"`
+
+	// Routes sets which routes take signed requests, by pattern, like
+	// MTLS_ROUTES. Policies: signed, signed_or_jwt.
+	Routes []string `env:"SIGNING_ROUTES" desc:"Per-route auth as <pattern>=<signed|signed_or_jwt>, comma-separated"`
+
+	// MaxSkew is how far a request's signed timestamp may be from now.
+	MaxSkew time.Duration `env:"SIGNING_MAX_SKEW" default:"5m" desc:"How far a signed request's timestamp may be from the server's clock"`
+
+	// RedisAddrs shares the nonce cache across instances. Without it,
+	// each instance only catches replays sent to itself.
+	RedisAddrs    []string `env:"SIGNING_REDIS_ADDR" desc:"Redis host:port (comma-separated for a cluster) for the signed request nonce cache"`
+	RedisPassword string   `env:"SIGNING_REDIS_PASSWORD" desc:"Redis password for the nonce cache" secret:"true"`
+}
+
+// Enabled reports whether any signing key is configured.
+func (c SigningConfig) Enabled() bool {
+	return len(c.Secrets) > 0 || c.SecretsFile != ""
+}
+
+// DPoPConfig holds settings for DPoP-bound tokens (see
+// auth.DPoPVerifier), for clients that prove they hold a key instead
+// of a client certificate. Off, DPoP headers are ignored and every
+// token is a bearer token.
+type DPoPConfig struct {
+	Enabled bool `env:"DPOP_ENABLED" default:"false" desc:"Bind tokens to the key of login and refresh requests' DPoP proofs (RFC 9449)"`
+
+	// MaxAge is how far a proof's iat may be from now, and how long a
+	// server nonce lasts.
+	MaxAge time.Duration `env:"DPOP_MAX_AGE" default:"5m" desc:"How far a DPoP proof's iat may be from the server's clock"`
+
+	// Nonces makes proofs carry a nonce from the DPoP-Nonce header, so
+	// they can't be made ahead of time. Clients retry once on
+	// use_dpop_nonce to get the first.
+	Nonces   bool   `env:"DPOP_NONCES" default:"false" desc:"Require a server nonce in DPoP proofs"`
+	NonceKey string `env:"DPOP_NONCE_KEY" desc:"Key signing DPoP nonces (empty uses JWT_SECRET)" secret:"true"`
+
+	// URL is the API's public address, which clients sign into proofs
+	// (htu). Behind a proxy that terminates TLS or changes the host, the
+	// URL requests arrive at is another one.
+	URL string `env:"DPOP_URL" desc:"Public base URL DPoP proofs are checked against, e.g. https://api.example.com (empty uses the request's)"`
+
+	// RedisAddrs shares the proof replay cache across instances, like
+	// SIGNING_REDIS_ADDR.
+	RedisAddrs    []string `env:"DPOP_REDIS_ADDR" desc:"Redis host:port (comma-separated for a cluster) for the DPoP proof replay cache"`
+	RedisPassword string   `env:"DPOP_REDIS_PASSWORD" desc:"Redis password for the DPoP replay cache" secret:"true"`
+}
+
+// TenantConfig holds settings for tenant policies (see package tenant).
+// The policies themselves are edited through the admin API.
+type TenantConfig struct {
+	// PolicyCacheTTL is how long each instance trusts its copy of the
+	// policies. A change made through one instance reaches the others
+	// within it.
+	PolicyCacheTTL time.Duration `env:"TENANT_POLICY_CACHE_TTL" default:"30s" desc:"How long tenant policies (CORS origins, redirect URIs, webhook URLs) are cached per instance"`
+
+	// MaxConns caps the requests each tenant has in flight at once, and
+	// with them the database connections it holds (see package
+	// bulkhead), so one tenant can't take the whole pool. Keep it well
+	// under DB_MAX_OPEN_CONNS: a cap of half the pool still leaves the
+	// other half to everyone else when one tenant floods it.
+	MaxConns int `env:"TENANT_MAX_CONNS" default:"0" desc:"Requests (and so database connections) one tenant may have in flight at once (0 for no cap)"`
+
+	// MaxConnsOverrides gives listed tenants a cap of their own, larger
+	// for a big customer, or 0 for none (an internal tenant).
+	MaxConnsOverrides []string `env:"TENANT_MAX_CONNS_OVERRIDES" desc:"Comma-separated tenant=n caps replacing TENANT_MAX_CONNS for those tenants (0 for no cap)"`
+
+	// QueueTimeout is how long a request over its tenant's cap waits for
+	// one of the tenant's requests to finish before it's refused.
+	QueueTimeout time.Duration `env:"TENANT_QUEUE_TIMEOUT" default:"500ms" desc:"How long a request over its tenant's cap waits for a slot before a 503"`
+}
+
+// RedirectConfig holds where flows may send a browser back to when a
+// client asks (see package redirect), besides what tenant policies
+// allow.
+type RedirectConfig struct {
+	// AllowedURLs are absolute URLs; a return URL matches one with the
+	// same scheme, host, and port, at or below its path. A leading "*."
+	// in the host matches subdomains.
+	AllowedURLs []string `env:"REDIRECT_ALLOWED_URLS" desc:"Comma-separated URLs return URLs may point at or below, e.g. https://app.example.com"`
+
+	// BaseURL is the app's address, against which return URLs given as a
+	// path ("/settings") resolve. Empty accepts only absolute URLs.
+	BaseURL string `env:"REDIRECT_BASE_URL" desc:"App address return paths resolve against (empty accepts only absolute return URLs)"`
 }
 
 // DatabaseConfig holds database connection settings.
 type DatabaseConfig struct {
 	// DSN is the Data Source Name (connection string) for MySQL.
 	// Format: user:password@tcp(host:port)/dbname?parseTime=true
-	DSN string
+	DSN string `env:"DB_DSN" default:"root:root@tcp(localhost:3306)/db_go_basics?parseTime=true" desc:"MySQL connection string" secret:"true"`
+
+	// UserFile and PasswordFile hold the MySQL credentials, replacing
+	// the ones in every DSN (DB_DSN, DB_SHARD_DSNS, DB_STANDBY_DSN), for
+	// credentials mounted from a Kubernetes Secret or written by the
+	// Vault agent. When they change, the pools log in again with the
+	// new ones (see SECRETS_WATCH_INTERVAL).
+	UserFile     string `env:"DB_USER_FILE" desc:"File with the MySQL user, replacing the DSNs' (needs DB_PASSWORD_FILE)"`
+	PasswordFile string `env:"DB_PASSWORD_FILE" desc:"File with the MySQL password, replacing the DSNs'; reloaded when it changes"`
 
 	// MaxOpenConns is the maximum number of open connections to the database.
 	// Setting this too high can exhaust database resources.
 	// Setting this too low can cause connection contention.
-	MaxOpenConns int
+	MaxOpenConns int `env:"DB_MAX_OPEN_CONNS" default:"10" desc:"Maximum open connections in the pool"`
 
 	// MaxIdleConns is the maximum number of idle connections in the pool.
 	// Should be less than or equal to MaxOpenConns.
-	MaxIdleConns int
+	MaxIdleConns int `env:"DB_MAX_IDLE_CONNS" default:"5" desc:"Maximum idle connections in the pool"`
 
 	// ConnMaxLifetime is the maximum time a connection can be reused.
 	// Helps with load balancing and handling database restarts.
-	ConnMaxLifetime time.Duration
+	ConnMaxLifetime time.Duration `env:"DB_CONN_MAX_LIFETIME" default:"30m" desc:"How long a connection may be reused"`
+
+	// ShardDSNs lists the MySQL databases users are sharded across.
+	// When empty, all users live in the DSN database (no sharding).
+	// When set, the DSN database becomes the shard directory.
+	// NEVER reorder or resize this list on a live system.
+	ShardDSNs []string `env:"DB_SHARD_DSNS" desc:"Comma-separated shard DSNs (enables sharding; DB_DSN becomes the directory)" secret:"true"`
+
+	// AutoMigrate applies pending migrations from migrations/ at startup.
+	// Replicas booting together take turns through a MySQL advisory lock.
+	AutoMigrate bool `env:"DB_AUTO_MIGRATE" default:"false" desc:"Apply pending migrations at startup (one replica at a time)"`
+
+	// MigrateLockTimeout is how long an instance waits for another
+	// instance's migrations to finish before giving up.
+	MigrateLockTimeout time.Duration `env:"DB_MIGRATE_LOCK_TIMEOUT" default:"2m" desc:"How long to wait for another replica's migrations"`
+
+	// StandbyDSN is a MySQL replica of the DSN database to fail over to.
+	// When empty, there is no failover. Shards are never failed over.
+	StandbyDSN string `env:"DB_STANDBY_DSN" desc:"MySQL replica of DB_DSN to fail reads over to (enables failover)" secret:"true"`
+
+	// FailoverWindow is how long the primary must fail health checks
+	// before reads move to the standby (and pass them before they move back).
+	FailoverWindow time.Duration `env:"DB_FAILOVER_WINDOW" default:"30s" desc:"How long the primary must fail (or pass) health checks before switching"`
+
+	// FailoverCheckInterval is how often the primary is health-checked.
+	FailoverCheckInterval time.Duration `env:"DB_FAILOVER_CHECK_INTERVAL" default:"5s" desc:"How often the primary is health-checked"`
+
+	// ExplainSampleRate is the fraction of SELECTs ("10%" or 0.1) the index
+	// advisor runs EXPLAIN on. Ignored in production.
+	ExplainSampleRate Ratio `env:"DB_EXPLAIN_SAMPLE_RATE" default:"10%" desc:"Fraction of SELECTs the index advisor EXPLAINs (non-production only)"`
+
+	// ExplainRowThreshold is the number of examined rows above which a
+	// full table scan is reported.
+	ExplainRowThreshold int64 `env:"DB_EXPLAIN_ROW_THRESHOLD" default:"1000" desc:"Rows examined before a full scan is reported"`
+
+	// SlowQueryThreshold is how long a repository query may take before it
+	// is logged; SlowQuerySampleRate is the fraction of those logged. Both
+	// can be changed at runtime through /admin/tunables.
+	SlowQueryThreshold  time.Duration `env:"DB_SLOW_QUERY_THRESHOLD" default:"200ms" desc:"Log repository queries slower than this (0 disables)"`
+	SlowQuerySampleRate Ratio         `env:"DB_SLOW_QUERY_SAMPLE_RATE" default:"100%" desc:"Fraction of slow queries logged"`
+}
+
+// UserCacheConfig holds the Redis cache of users looked up by email
+// (see package usercache). Entries are dropped when the user is written,
+// through this process or any other, so the TTL is only a backstop.
+type UserCacheConfig struct {
+	// RedisAddrs enables the cache. The entries hold password hashes, so
+	// it must be a Redis nothing else can read.
+	RedisAddrs    []string `env:"USER_CACHE_REDIS_ADDR" desc:"Redis host:port (comma-separated for a cluster) caching users by email (empty disables the cache)"`
+	RedisPassword string   `env:"USER_CACHE_REDIS_PASSWORD" desc:"Redis password for the user cache" secret:"true"`
+
+	// TTL bounds how long an entry lives, should both its invalidations
+	// (the write's own, and the change feed's) be missed.
+	TTL time.Duration `env:"USER_CACHE_TTL" default:"10m" desc:"How long a cached user lives at most"`
+
+	// FeedInterval is how often each instance reads the users written
+	// since its last look (the change feed): how long a write made
+	// outside this service may be served stale.
+	FeedInterval time.Duration `env:"USER_CACHE_FEED_INTERVAL" default:"1s" desc:"How often the change feed is polled for users written elsewhere"`
+
+	// FeedOverlap is how far back each poll reads again, for writes
+	// whose transactions commit after their rows' updated_at. Make it
+	// longer than the longest transaction writing to users.
+	FeedOverlap time.Duration `env:"USER_CACHE_FEED_OVERLAP" default:"5s" desc:"How far back each change feed poll reads again, for late commits"`
 }
 
 // JWTConfig holds JWT (JSON Web Token) authentication settings.
@@ -61,78 +374,629 @@ type JWTConfig struct {
 	// Secret is the key used to sign JWT tokens.
 	// IMPORTANT: In production, use a strong, random secret (at least 32 bytes).
 	// Never commit the actual secret to version control.
-	Secret string
+	Secret string `env:"JWT_SECRET" default:"your-256-bit-secret-key-change-in-production" desc:"HS256 signing secret (at least 32 bytes in production)" secret:"true"`
+
+	// SecretFile reads Secret from a file instead, and signs with the
+	// new secret when the file changes; the old one keeps verifying
+	// until its tokens expire (see auth.JWTManager.RotateKey). Keys that
+	// default to Secret (JWT_BINDING_KEY, DPOP_NONCE_KEY) keep the one
+	// read at startup.
+	SecretFile string `env:"JWT_SECRET_FILE" desc:"File with the HS256 signing secret, replacing JWT_SECRET; reloaded when it changes"`
 
 	// AccessTokenDuration is how long an access token is valid.
 	// Keep this short (15-30 minutes) for security.
 	// Users will need to refresh tokens or re-login after expiration.
-	AccessTokenDuration time.Duration
+	AccessTokenDuration time.Duration `env:"JWT_ACCESS_TOKEN_DURATION" default:"15m" desc:"Access token validity"`
+
+	// ScopeTTLs and AudienceTTLs give tokens other lifetimes by what they
+	// grant, as "name=duration" pairs: "accounts:manage=5m" for admins,
+	// "users:read=1h" for read-only clients. A token gets the shortest
+	// that applies (see auth.Lifetimes), or AccessTokenDuration.
+	ScopeTTLs    []string `env:"JWT_SCOPE_TTLS" desc:"Comma-separated scope=duration access token lifetimes; the shortest that applies wins"`
+	AudienceTTLs []string `env:"JWT_AUDIENCE_TTLS" desc:"Comma-separated aud=duration access token lifetimes; the shortest that applies wins"`
+
+	// RefreshTokenDuration is how long a session survives without being
+	// used. Each refresh extends it, so active devices stay signed in.
+	RefreshTokenDuration time.Duration `env:"JWT_REFRESH_TOKEN_DURATION" default:"30d" desc:"How long an unused session (refresh token) stays valid"`
+
+	// SlidingSessions is whether refreshes extend sessions. Off, a
+	// session ends RefreshTokenDuration after the login, however it's
+	// used.
+	SlidingSessions bool `env:"JWT_SLIDING_SESSIONS" default:"true" desc:"Refreshes extend sessions; off, they end JWT_REFRESH_TOKEN_DURATION after login"`
+
+	// SessionMaxLifetime caps sliding sessions: past it, the user signs
+	// in again however active they've been. 0 means no cap.
+	SessionMaxLifetime time.Duration `env:"JWT_SESSION_MAX_LIFETIME" default:"0s" desc:"Absolute cap on a session's lifetime, however it's refreshed (0 for none)"`
+
+	// Leeway is the clock skew tolerated when checking token expiry and
+	// not-before times, for servers whose clocks drift slightly apart.
+	Leeway time.Duration `env:"JWT_LEEWAY" default:"0s" desc:"Clock skew tolerated on token exp/nbf checks"`
+
+	// VersionCacheTTL is how long a user's token version is cached.
+	// After a password change, other instances may accept the user's
+	// old tokens for up to this long.
+	VersionCacheTTL time.Duration `env:"JWT_VERSION_CACHE_TTL" default:"10s" desc:"How long token versions are cached; revoked tokens may work this long on other instances"`
 
 	// Issuer identifies who created the token.
 	// Useful when you have multiple services issuing tokens.
-	Issuer string
+	// Tokens from any other issuer are rejected.
+	Issuer string `env:"JWT_ISSUER" default:"go-basics" desc:"Token issuer; tokens from other issuers are rejected"`
+
+	// Audience is the "aud" claim stamped on issued tokens: the service(s)
+	// the tokens are meant for. Empty omits the claim.
+	Audience []string `env:"JWT_AUDIENCE" desc:"Comma-separated aud claim stamped on issued tokens"`
+
+	// ExpectedAudiences are the "aud" values accepted when validating.
+	// A token must carry at least one of them. Defaults to Audience;
+	// when both are empty, the audience isn't checked.
+	ExpectedAudiences []string `env:"JWT_EXPECTED_AUDIENCES" desc:"Comma-separated aud values accepted on validation (defaults to JWT_AUDIENCE)"`
+
+	// Algorithm selects the signing algorithm: HS256 (default), RS256, ES256, ...
+	// RS*/ES* use a key pair instead of Secret, so other services can verify
+	// tokens with the public key without being able to issue them.
+	Algorithm string `env:"JWT_ALGORITHM" default:"HS256" desc:"Signing algorithm (HS256, RS256, ES256, ...)"`
+
+	// PrivateKey and PublicKey hold PEM-encoded keys for RS*/ES* algorithms.
+	// The *File variants read the PEM from a file instead and take precedence.
+	// Configure only the public key on services that just verify tokens.
+	PrivateKey     string `env:"JWT_PRIVATE_KEY" desc:"PEM private key for RS*/ES*" secret:"true"`
+	PrivateKeyFile string `env:"JWT_PRIVATE_KEY_FILE" desc:"File containing the PEM private key"`
+	PublicKey      string `env:"JWT_PUBLIC_KEY" desc:"PEM public key for RS*/ES*"`
+	PublicKeyFile  string `env:"JWT_PUBLIC_KEY_FILE" desc:"File containing the PEM public key"`
+
+	// KeysFile points to a JSON file listing several signing keys with IDs
+	// and a rotation schedule. When set, it replaces Secret/Algorithm/*Key.
+	// See internal/app/jwt.go for the file format.
+	KeysFile string `env:"JWT_KEYS_FILE" desc:"JSON key rotation schedule; overrides the single-key settings"`
+
+	// Binding ties access tokens to the client they were issued to:
+	// "ip" (its network), "device" (a device ID header), "cert" (its
+	// client certificate), or "cookie" (a secret HttpOnly cookie). All
+	// but "ip" fall back to the network for clients without one. A token
+	// presented from elsewhere is refused. Empty leaves tokens unbound.
+	Binding string `env:"JWT_BINDING" desc:"Bind access tokens to the client: ip, device, cert, or cookie (empty disables)"`
+
+	// The IP prefix lengths a client is identified by. Shorter ones
+	// tolerate address changes within a network (mobile carriers, IPv6
+	// privacy addresses); 32 and 128 bind to the exact address.
+	BindingIPv4Prefix int `env:"JWT_BINDING_IPV4_PREFIX" default:"24" desc:"IPv4 prefix length tokens are bound to"`
+	BindingIPv6Prefix int `env:"JWT_BINDING_IPV6_PREFIX" default:"64" desc:"IPv6 prefix length tokens are bound to"`
+
+	// BindingHeader carries the device ID in "device" mode.
+	BindingHeader string `env:"JWT_BINDING_DEVICE_HEADER" default:"X-Device-ID" desc:"Header with the client's device ID, for JWT_BINDING=device"`
+
+	// BindingCookie holds the secret in "cookie" mode.
+	BindingCookie string `env:"JWT_BINDING_COOKIE" default:"__Host-token-binding" desc:"Cookie with the client's binding secret, for JWT_BINDING=cookie"`
+
+	// BindingKey keys the fingerprint hash, so a token's fingerprint
+	// can't be reversed into the client's network. Empty uses Secret.
+	BindingKey string `env:"JWT_BINDING_KEY" desc:"Key hashing token binding fingerprints (empty uses JWT_SECRET)" secret:"true"`
+
+	// EncryptionKey encrypts issued access tokens (JWE, AES-256-GCM), so
+	// clients and anyone else holding one can't read the user ID and
+	// email in it. A base64-encoded 32-byte key; empty leaves tokens
+	// readable. OldEncryptionKeys still decrypt tokens issued before a
+	// key rotation.
+	EncryptionKey     string   `env:"JWT_ENCRYPTION_KEY" desc:"Base64 32-byte key encrypting access tokens (empty disables)" secret:"true"`
+	OldEncryptionKeys []string `env:"JWT_ENCRYPTION_OLD_KEYS" desc:"Comma-separated base64 keys that only decrypt, during a rotation" secret:"true"`
+
+	// EncryptionRequired refuses unencrypted tokens. Leave it off until
+	// the tokens issued before JWT_ENCRYPTION_KEY was set have expired.
+	EncryptionRequired bool `env:"JWT_ENCRYPTION_REQUIRED" default:"false" desc:"Refuse access tokens that aren't encrypted"`
+
+	// EncryptedClaims encrypts only these claims (e.g. "email", "roles")
+	// with JWT_ENCRYPTION_KEY, instead of the whole token, so the rest
+	// (exp, scopes, ...) stays readable.
+	EncryptedClaims []string `env:"JWT_ENCRYPTED_CLAIMS" desc:"Comma-separated claims to encrypt instead of the whole token, e.g. email,roles (needs JWT_ENCRYPTION_KEY)"`
 }
 
-// Load reads configuration from environment variables with defaults.
-// This is the preferred pattern because:
-// 1. Environment variables are easy to change in different environments
-// 2. Secrets don't get committed to version control
-// 3. Works well with Docker, Kubernetes, and cloud platforms
-func Load() *Config {
-	return &Config{
-		Server: ServerConfig{
-			// getEnv is a helper that returns a default if the env var is empty
-			Port:         getEnv("SERVER_PORT", "8080"),
-			ReadTimeout:  getDurationEnv("SERVER_READ_TIMEOUT", 5*time.Second),
-			WriteTimeout: getDurationEnv("SERVER_WRITE_TIMEOUT", 10*time.Second),
-			IdleTimeout:  getDurationEnv("SERVER_IDLE_TIMEOUT", 60*time.Second),
-		},
-		Database: DatabaseConfig{
-			DSN:             getEnv("DB_DSN", "root:root@tcp(localhost:3306)/db_go_basics?parseTime=true"),
-			MaxOpenConns:    getIntEnv("DB_MAX_OPEN_CONNS", 10),
-			MaxIdleConns:    getIntEnv("DB_MAX_IDLE_CONNS", 5),
-			ConnMaxLifetime: getDurationEnv("DB_CONN_MAX_LIFETIME", 30*time.Minute),
-		},
-		JWT: JWTConfig{
-			// IMPORTANT: Change this secret in production!
-			// Use: openssl rand -base64 32
-			Secret:              getEnv("JWT_SECRET", "your-256-bit-secret-key-change-in-production"),
-			AccessTokenDuration: getDurationEnv("JWT_ACCESS_TOKEN_DURATION", 15*time.Minute),
-			Issuer:              getEnv("JWT_ISSUER", "go-basics"),
-		},
-	}
+// AdminConfig holds settings for operational admin endpoints.
+type AdminConfig struct {
+	// Token is a static secret that must be sent in the X-Admin-Token header
+	// (in addition to a valid JWT) to use admin endpoints.
+	// Leave it empty to disable admin endpoints entirely.
+	Token string `env:"ADMIN_TOKEN" desc:"Static token required by admin diagnostics (empty disables them)" secret:"true"`
+
+	// ImpersonationTTL is how long a support impersonation token is valid.
+	// Keep it short: the token can do anything the impersonated user can.
+	ImpersonationTTL time.Duration `env:"ADMIN_IMPERSONATION_TTL" default:"15m" desc:"Lifetime of tokens issued by POST /admin/impersonate/{userID}"`
 }
 
-// getEnv returns the value of an environment variable or a default value.
-// This is a common pattern in Go applications.
-func getEnv(key, defaultValue string) string {
-	// os.Getenv returns empty string if the variable is not set
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
+// MailConfig holds outgoing email settings.
+type MailConfig struct {
+	// SMTPAddr is the SMTP server as host:port.
+	// Leave it empty in development: messages are written to the log instead.
+	SMTPAddr string `env:"SMTP_ADDR" desc:"SMTP server host:port (empty logs emails instead)"`
+
+	// SMTPUsername and SMTPPassword authenticate with the server.
+	// Leave the username empty if the server doesn't require authentication.
+	SMTPUsername string `env:"SMTP_USERNAME" desc:"SMTP username"`
+	SMTPPassword string `env:"SMTP_PASSWORD" desc:"SMTP password" secret:"true"`
+
+	// From is the sender address on outgoing email.
+	From string `env:"MAIL_FROM" default:"no-reply@localhost" desc:"Sender address on outgoing email"`
 }
 
-// getIntEnv returns an integer from an environment variable or a default.
-// We use strconv.Atoi to convert string to int.
-func getIntEnv(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
-		// Atoi = "ASCII to Integer"
-		if intValue, err := strconv.Atoi(value); err == nil {
-			return intValue
-		}
-	}
-	return defaultValue
+// EmailConfig holds settings for how account emails are normalized.
+type EmailConfig struct {
+	// FoldGmail stores Gmail addresses without dots or a "+tag" in the
+	// local part, so one inbox is one account (see user.EmailNormalizer).
+	// Turn it on before the first signup: existing Gmail accounts keep
+	// their unfolded address, which folded lookups don't find.
+	FoldGmail bool `env:"EMAIL_FOLD_GMAIL" default:"false" desc:"Fold Gmail dots and +tags, so one inbox is one account"`
 }
 
-// getDurationEnv returns a time.Duration from an environment variable.
-// Duration strings can be like "5s", "10m", "1h30m".
-func getDurationEnv(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
-		// ParseDuration understands "ns", "us", "ms", "s", "m", "h"
-		if duration, err := time.ParseDuration(value); err == nil {
-			return duration
-		}
+// PasswordResetConfig holds settings for the forgot-password flow.
+type PasswordResetConfig struct {
+	// URL is the page that lets the user choose a new password.
+	// The reset token is appended as the "token" query parameter.
+	URL string `env:"PASSWORD_RESET_URL" default:"http://localhost:8080/reset-password" desc:"Reset page link sent by email (token appended as ?token=)"`
+
+	// TokenTTL is how long a reset link stays valid.
+	// Keep it short: anyone who reads the email can use the link.
+	TokenTTL time.Duration `env:"PASSWORD_RESET_TOKEN_TTL" default:"1h" desc:"How long a reset link stays valid"`
+}
+
+// EmailChangeConfig holds settings for confirming a new email address.
+type EmailChangeConfig struct {
+	// URL is the page that confirms the change.
+	// The token is appended as the "token" query parameter.
+	URL string `env:"EMAIL_CHANGE_URL" default:"http://localhost:8080/confirm-email" desc:"Confirmation link sent to the new address (token appended as ?token=)"`
+
+	// TokenTTL is how long a confirmation link stays valid. It can be
+	// longer than a reset link's: it only works for the address it was
+	// sent to, and only after the password was given.
+	TokenTTL time.Duration `env:"EMAIL_CHANGE_TOKEN_TTL" default:"24h" desc:"How long an email change confirmation link stays valid"`
+}
+
+// InvitationConfig holds settings for inviting users to accounts set
+// up for them.
+type InvitationConfig struct {
+	// URL is the page where the invitee chooses a password.
+	// The token is appended as the "token" query parameter.
+	URL string `env:"INVITATION_URL" default:"http://localhost:8080/accept-invitation" desc:"Invitation link sent by email (token appended as ?token=)"`
+
+	// TokenTTL is how long an invitation link stays valid. Invitees may
+	// not read the email for days, so it's longer than a reset link's;
+	// an expired invitation can be resent.
+	TokenTTL time.Duration `env:"INVITATION_TOKEN_TTL" default:"168h" desc:"How long an invitation link stays valid"`
+}
+
+// PasswordConfig holds password hashing settings.
+type PasswordConfig struct {
+	// Algorithm hashes new and changed passwords: "argon2id" or "bcrypt".
+	// Hashes made with the other one still verify, and are upgraded to
+	// this one at the user's next login.
+	Algorithm string `env:"PASSWORD_HASH_ALGORITHM" default:"argon2id" desc:"Hash for new passwords: argon2id or bcrypt (the other still verifies)"`
+
+	// Argon2Memory, Argon2Iterations, and Argon2Parallelism are the
+	// Argon2id cost parameters. The defaults are OWASP's recommended
+	// minimum; raise the memory first if logins can afford it. Raising
+	// any of them upgrades existing hashes at each user's next login.
+	Argon2Memory      Size `env:"PASSWORD_ARGON2_MEMORY" default:"19MB" desc:"Argon2id memory per hash"`
+	Argon2Iterations  int  `env:"PASSWORD_ARGON2_ITERATIONS" default:"2" desc:"Argon2id passes over the memory"`
+	Argon2Parallelism int  `env:"PASSWORD_ARGON2_PARALLELISM" default:"1" desc:"Argon2id threads per hash"`
+
+	// BcryptCost determines how computationally expensive bcrypt hashing is.
+	// Higher = more secure but slower. 10-12 is recommended for production.
+	// Each increment doubles the computation time. Raising it upgrades
+	// existing bcrypt hashes at each user's next login.
+	BcryptCost int `env:"PASSWORD_BCRYPT_COST" default:"12" desc:"bcrypt cost factor (4-31; each step doubles the work)"`
+
+	// Workers caps how many passwords are hashed or verified at once, so a
+	// burst of logins can't take every CPU. 0 means one per CPU.
+	Workers int `env:"PASSWORD_HASH_WORKERS" default:"0" desc:"Concurrent password hashes (0 = number of CPUs)"`
+}
+
+// SLOConfig holds service level objectives for HTTP routes.
+type SLOConfig struct {
+	// DefaultLatency and DefaultAvailability apply to every route
+	// not listed in Routes. Availability is a percentage, e.g. 99.5.
+	DefaultLatency      time.Duration `env:"SLO_DEFAULT_LATENCY" default:"500ms" desc:"Latency objective for routes not in SLO_ROUTES"`
+	DefaultAvailability float64       `env:"SLO_DEFAULT_AVAILABILITY" default:"99.5" desc:"Availability objective (%) for routes not in SLO_ROUTES"`
+
+	// Routes overrides the defaults for specific routes.
+	// Format: "<pattern>=<latency>/<availability %>", comma-separated,
+	// e.g. "POST /login=300ms/99.9,GET /users/{id}=100ms/99.95".
+	Routes []string `env:"SLO_ROUTES" desc:"Per-route overrides as <pattern>=<latency>/<availability>, comma-separated"`
+
+	// Window is the period the error budget covers.
+	Window time.Duration `env:"SLO_WINDOW" default:"30d" desc:"Error budget window"`
+}
+
+// MFAConfig holds two-factor authentication settings.
+type MFAConfig struct {
+	// Issuer is the account label shown in authenticator apps.
+	Issuer string `env:"MFA_ISSUER" default:"go-basics" desc:"Account label shown in authenticator apps"`
+
+	// EncryptionKey is a base64-encoded 32-byte key that encrypts TOTP
+	// secrets at rest. Generate one with: openssl rand -base64 32
+	// Leave it empty to disable two-factor enrollment.
+	// Changing it makes existing secrets unreadable.
+	EncryptionKey string `env:"MFA_ENCRYPTION_KEY" desc:"Base64 32-byte key encrypting TOTP secrets (empty disables 2FA)" secret:"true"`
+}
+
+// SAMLConfig holds enterprise single sign-on settings (SAML 2.0).
+// SSO is off unless the identity provider's metadata is given, by URL
+// or by file.
+type SAMLConfig struct {
+	// The identity provider's metadata: its entity ID, sign-in URL, and
+	// signing certificate. The URL is fetched once at startup; restart
+	// after the IdP rotates its certificate.
+	IDPMetadataURL  string `env:"SAML_IDP_METADATA_URL" desc:"Identity provider metadata URL (enables SAML SSO)"`
+	IDPMetadataFile string `env:"SAML_IDP_METADATA_FILE" desc:"Identity provider metadata file, for IdPs without a metadata URL (enables SAML SSO)"`
+
+	// RootURL is this API's public address. The assertion consumer
+	// service and our metadata live under it, at /sso/saml/acs and
+	// /sso/saml/metadata.
+	RootURL string `env:"SAML_ROOT_URL" default:"http://localhost:8080" desc:"Public base URL of this API, as the identity provider reaches it"`
+
+	// EntityID names this service provider to the IdP. Empty uses the
+	// metadata URL, the usual convention.
+	EntityID string `env:"SAML_ENTITY_ID" desc:"Service provider entity ID (empty uses the metadata URL)"`
+
+	// The certificate and key sign our authentication requests and
+	// decrypt encrypted assertions. A self-signed certificate is fine:
+	// the IdP trusts it because it's in our metadata.
+	CertFile string `env:"SAML_CERT_FILE" desc:"PEM certificate of this service provider"`
+	KeyFile  string `env:"SAML_KEY_FILE" desc:"PEM private key (RSA or ECDSA) of this service provider"`
+
+	// EmailAttribute is the assertion attribute holding the user's email,
+	// which maps them to a local account. Without it, a NameID in email
+	// format is used.
+	EmailAttribute string `env:"SAML_EMAIL_ATTRIBUTE" default:"email" desc:"Assertion attribute with the user's email"`
+
+	// AllowedDomains limits the email domains the IdP may sign users in
+	// for. Empty allows any: the IdP is then trusted for every address,
+	// including your admins'.
+	AllowedDomains []string `env:"SAML_ALLOWED_DOMAINS" desc:"Comma-separated email domains SSO may sign in (empty allows any)"`
+
+	// AutoProvision creates a local account on a first SSO sign-in.
+	// Off, only users who already have an account can sign in by SSO.
+	AutoProvision bool `env:"SAML_AUTO_PROVISION" default:"false" desc:"Create a local account on a user's first SSO sign-in"`
+
+	// RedirectURL is the page the browser is sent to after signing in,
+	// with the tokens in the URL fragment. Empty returns them as JSON.
+	RedirectURL string `env:"SAML_REDIRECT_URL" desc:"Page to send the browser to after SSO, tokens in the fragment (empty returns JSON)"`
+}
+
+// Enabled reports whether SAML SSO is configured.
+func (c SAMLConfig) Enabled() bool {
+	return c.IDPMetadataURL != "" || c.IDPMetadataFile != ""
+}
+
+// ProbeConfig holds settings for the synthetic monitoring endpoint.
+type ProbeConfig struct {
+	// Token must be sent in the X-Probe-Token header to call /probe/e2e.
+	// Leave it empty to disable the endpoint.
+	Token string `env:"PROBE_TOKEN" desc:"Token required by GET /probe/e2e (empty disables it)" secret:"true"`
+
+	// CanaryEmail identifies the dedicated account the probe writes to.
+	// It can never log in; use an address no real user will register.
+	CanaryEmail string `env:"PROBE_CANARY_EMAIL" default:"probe-canary@example.com" desc:"Dedicated account the probe writes to"`
+}
+
+// MetricsConfig holds settings for Prometheus metrics.
+type MetricsConfig struct {
+	// TenantAllowlist lists the tenants (X-Tenant-ID values) that get their
+	// own metric label; all others are reported as "other".
+	TenantAllowlist []string `env:"METRICS_TENANT_ALLOWLIST" desc:"Comma-separated tenants that get their own metric label"`
+
+	// MaxTenants caps distinct tenant labels when TenantAllowlist is empty.
+	// Each tenant multiplies the number of series, so keep it small.
+	MaxTenants int `env:"METRICS_MAX_TENANTS" default:"20" desc:"Cap on distinct tenant labels when no allowlist is set"`
+}
+
+// RateLimitConfig holds limits for the login and forgot-password endpoints.
+// Each key may make Per* requests back to back, then Per* per Window on
+// average. Set a Per* value to 0 to turn that limit off.
+type RateLimitConfig struct {
+	PerIP    int           `env:"RATE_LIMIT_PER_IP" default:"20" desc:"Login/forgot-password requests per window per IP (0 disables)"`
+	PerEmail int           `env:"RATE_LIMIT_PER_EMAIL" default:"5" desc:"Login/forgot-password requests per window per email (0 disables)"`
+	Window   time.Duration `env:"RATE_LIMIT_WINDOW" default:"15m" desc:"Rate limit window"`
+
+	// Algorithm is "sliding-window" (at most N requests in any window) or
+	// "token-bucket" (bursts of N, refilled over the window).
+	Algorithm string `env:"RATE_LIMIT_ALGORITHM" default:"sliding-window" desc:"sliding-window or token-bucket"`
+
+	// RedisAddrs shares the limits across instances through Redis (host:port).
+	// Several addresses are the seed nodes of a Redis Cluster.
+	// Leave it empty for a single instance: limits are kept in memory.
+	RedisAddrs    []string `env:"RATE_LIMIT_REDIS_ADDR" desc:"Redis host:port (comma-separated for a cluster) to share limits across instances"`
+	RedisPassword string   `env:"RATE_LIMIT_REDIS_PASSWORD" desc:"Redis password" secret:"true"`
+}
+
+// LockConfig holds the distributed locks that keep singleton jobs
+// (purges, backups, relays) to one instance at a time.
+type LockConfig struct {
+	// Backend is "mysql" (GET_LOCK on the main database) or "redis".
+	Backend string        `env:"LOCK_BACKEND" default:"mysql" desc:"Job lock backend: mysql or redis"`
+	TTL     time.Duration `env:"LOCK_TTL" default:"30s" desc:"Job lock lease, renewed every third of it while the job runs"`
+
+	// RedisAddrs is required with the redis backend. Several addresses
+	// are the seed nodes of a Redis Cluster.
+	RedisAddrs    []string `env:"LOCK_REDIS_ADDR" desc:"Redis host:port (comma-separated for a cluster) for the redis lock backend"`
+	RedisPassword string   `env:"LOCK_REDIS_PASSWORD" desc:"Redis password for the lock backend" secret:"true"`
+}
+
+// JobsConfig holds the background job queue (emails, for now).
+type JobsConfig struct {
+	Workers   int `env:"JOBS_WORKERS" default:"4" desc:"Background jobs run at once"`
+	QueueSize int `env:"JOBS_QUEUE_SIZE" default:"1000" desc:"Background jobs that can wait for a worker before new ones are refused"`
+
+	// DrainTimeout is how long running jobs get to finish at shutdown.
+	// Jobs still running after it are saved and run again at the next start.
+	DrainTimeout time.Duration `env:"JOBS_DRAIN_TIMEOUT" default:"10s" desc:"How long running jobs get to finish at shutdown"`
+
+	// A failing job is retried after RetryBackoff, then twice as long
+	// after each further failure, until MaxAttempts runs have failed.
+	// Then it's moved to the dead-letter table.
+	MaxAttempts  int           `env:"JOBS_MAX_ATTEMPTS" default:"5" desc:"Runs a failing background job gets before it's dead-lettered"`
+	RetryBackoff time.Duration `env:"JOBS_RETRY_BACKOFF" default:"30s" desc:"Wait before retrying a failed background job; doubles with each attempt"`
+
+	// SchedulerPoll is how often the leader checks for scheduled jobs
+	// that are due. A scheduled job runs up to this late.
+	SchedulerPoll time.Duration `env:"JOBS_SCHEDULER_POLL" default:"5s" desc:"How often due scheduled jobs are queued"`
+}
+
+// NotifyConfig holds account notification settings.
+type NotifyConfig struct {
+	// DefaultFrequency is how often users who never chose get the digest
+	// of their low-priority notifications: "immediate" (no digest),
+	// "hourly", "daily", or "weekly". High-priority notifications are
+	// always sent at once.
+	DefaultFrequency string `env:"NOTIFY_DEFAULT_FREQUENCY" default:"daily" desc:"Digest frequency for users who never chose one: immediate, hourly, daily, or weekly"`
+}
+
+// WebPushConfig holds browser push notification settings (Web Push with
+// VAPID). Push is off unless a VAPID private key is set.
+type WebPushConfig struct {
+	// VAPIDPrivateKey signs every push; browsers subscribe with its
+	// public half. Generate a pair with `go run ./cmd/vapidkeys`.
+	// Changing it invalidates every existing subscription.
+	VAPIDPrivateKey string `env:"WEBPUSH_VAPID_PRIVATE_KEY" desc:"Base64url P-256 VAPID private key (empty disables web push)" secret:"true"`
+
+	// Subject is how push services reach the sender about its traffic.
+	Subject string `env:"WEBPUSH_SUBJECT" default:"mailto:admin@example.com" desc:"mailto: or https: contact sent to push services"`
+
+	// TTL is how long a push service holds a message for a browser that's
+	// offline. An alert older than this is dropped; email still has it.
+	TTL time.Duration `env:"WEBPUSH_TTL" default:"24h" desc:"How long push services keep a message for an offline browser"`
+
+	// AllowedHosts are the push services subscriptions may point at, by
+	// domain (subdomains included). Without a list, a user could register
+	// any URL and make this server POST to it.
+	AllowedHosts []string `env:"WEBPUSH_ALLOWED_HOSTS" default:"fcm.googleapis.com,push.services.mozilla.com,notify.windows.com,push.apple.com" desc:"Comma-separated push service domains subscriptions may use"`
+}
+
+// Enabled reports whether web push is configured.
+func (c WebPushConfig) Enabled() bool {
+	return c.VAPIDPrivateKey != ""
+}
+
+// AvatarConfig holds profile picture settings. Uploads are off unless a
+// storage backend is chosen.
+type AvatarConfig struct {
+	// Storage is where pictures go: "local" (AVATAR_LOCAL_DIR, served by
+	// this server under /avatars/) or "s3" (the AVATAR_S3_* bucket).
+	Storage string `env:"AVATAR_STORAGE" desc:"Where avatars are stored: local or s3 (empty disables uploads)"`
+
+	// MaxUploadSize caps an upload. It replaces SERVER_MAX_BODY_SIZE on
+	// the upload routes: phone photos are often several megabytes.
+	MaxUploadSize Size `env:"AVATAR_MAX_UPLOAD_SIZE" default:"5MB" desc:"Largest accepted avatar upload"`
+
+	// Size is the side of the square avatars are scaled down to.
+	Size int `env:"AVATAR_SIZE" default:"256" desc:"Side, in pixels, of the square avatars are scaled down to"`
+
+	// PublicURL is where clients fetch avatars from: a CDN, or the
+	// bucket. For local storage it defaults to this server's /avatars.
+	PublicURL string `env:"AVATAR_PUBLIC_URL" desc:"Base URL avatars are served from (default: /avatars for local, the bucket URL for s3)"`
+
+	LocalDir string `env:"AVATAR_LOCAL_DIR" default:"./data/avatars" desc:"Directory for AVATAR_STORAGE=local"`
+
+	S3Bucket   string `env:"AVATAR_S3_BUCKET" desc:"Bucket for AVATAR_STORAGE=s3"`
+	S3Region   string `env:"AVATAR_S3_REGION" default:"us-east-1" desc:"Region of AVATAR_S3_BUCKET"`
+	S3Endpoint string `env:"AVATAR_S3_ENDPOINT" desc:"S3-compatible endpoint, e.g. https://minio:9000 (empty uses AWS)"`
+
+	S3AccessKeyID     string `env:"AVATAR_S3_ACCESS_KEY_ID" desc:"Access key ID for AVATAR_S3_BUCKET"`
+	S3SecretAccessKey string `env:"AVATAR_S3_SECRET_ACCESS_KEY" desc:"Secret access key for AVATAR_S3_BUCKET" secret:"true"`
+}
+
+// Enabled reports whether avatar uploads are configured.
+func (c AvatarConfig) Enabled() bool {
+	return c.Storage != ""
+}
+
+// AuditConfig holds where audit events go. Sinks are named: "log" (the
+// server log, one line per event), "stdout" (JSON lines on standard
+// output), "file" (append-only JSON lines, rotated by size), "mysql" (the
+// insert-only audit_events table), and "collector" (batched HTTP POSTs).
+type AuditConfig struct {
+	// Sinks receive every category not listed in Routes.
+	Sinks []string `env:"AUDIT_SINKS" default:"log" desc:"Comma-separated audit sinks: log, stdout, file, mysql, collector"`
+
+	// Routes sends a category to its own sinks instead.
+	// Format: "<category>=<sink>+<sink>", comma-separated,
+	// e.g. "admin=mysql+file,tunables=log".
+	Routes []string `env:"AUDIT_ROUTES" desc:"Per-category sinks as <category>=<sink>+<sink>, comma-separated"`
+
+	// FilePath is the file sink's current file. Rotated files sit next to
+	// it, named with their rotation time, read-only.
+	FilePath    string `env:"AUDIT_FILE_PATH" default:"audit.jsonl" desc:"Audit file for the file sink"`
+	FileMaxSize int64  `env:"AUDIT_FILE_MAX_BYTES" default:"104857600" desc:"Size at which the audit file is rotated (0 never rotates)"`
+
+	// The collector sink POSTs JSON arrays of events to CollectorURL.
+	CollectorURL   string `env:"AUDIT_COLLECTOR_URL" desc:"External collector endpoint for the collector sink"`
+	CollectorToken string `env:"AUDIT_COLLECTOR_TOKEN" desc:"Bearer token for the audit collector" secret:"true"`
+}
+
+// DormancyConfig holds the inactive-account report and its policy.
+type DormancyConfig struct {
+	// After is how long without a login (or a refresh, or registration)
+	// makes an account dormant.
+	After time.Duration `env:"DORMANT_AFTER" default:"180d" desc:"No login for this long makes an account dormant"`
+
+	// Actions are taken against dormant accounts one grace period apart,
+	// always in the order warn, disable, delete. Empty only reports.
+	Actions []string `env:"DORMANT_ACTIONS" desc:"Comma-separated actions for dormant accounts: warn, disable, delete (empty only reports)"`
+
+	// Grace is the time between actions, and from scheduling a deletion
+	// to carrying it out.
+	Grace time.Duration `env:"DORMANT_GRACE" default:"14d" desc:"Time between dormancy actions, and before a scheduled deletion"`
+
+	// ReportInterval is how often the report runs (and takes the actions).
+	ReportInterval time.Duration `env:"DORMANT_REPORT_INTERVAL" default:"24h" desc:"How often the dormant account report runs (0 never; the admin preview still works)"`
+
+	// ReportTo gets each report by email. Without it, reports are only logged.
+	ReportTo []string `env:"DORMANT_REPORT_TO" desc:"Comma-separated addresses that get the dormant account report"`
+}
+
+// AnonymizeConfig holds the right-to-erasure workflow.
+type AnonymizeConfig struct {
+	// Grace is how long a request waits before the account is
+	// anonymized, unless it's canceled, or an admin confirms it sooner.
+	Grace time.Duration `env:"ANONYMIZE_GRACE" default:"7d" desc:"Time from an anonymization request until it's carried out"`
+
+	// Interval is how often due requests are carried out.
+	Interval time.Duration `env:"ANONYMIZE_INTERVAL" default:"1h" desc:"How often due anonymization requests are carried out"`
+}
+
+// ImportConfig holds the admin bulk import (POST /admin/users/import).
+type ImportConfig struct {
+	// MaxBodySize caps an import file. It replaces SERVER_MAX_BODY_SIZE
+	// on the import route: a legacy user table doesn't fit in 1MB.
+	MaxBodySize Size `env:"IMPORT_MAX_BODY_SIZE" default:"10MB" desc:"Largest accepted user import file"`
+
+	// BatchSize is how many rows are written per transaction. A failed
+	// batch rolls back alone; rows in earlier batches stay imported.
+	BatchSize int `env:"IMPORT_BATCH_SIZE" default:"100" desc:"Rows written per transaction during a user import"`
+}
+
+// ExportConfig holds the admin user export (GET /admin/users/export).
+type ExportConfig struct {
+	// BatchSize is how many users are read per query, and sent on to
+	// the client at a time.
+	BatchSize int `env:"EXPORT_BATCH_SIZE" default:"500" desc:"Users read per query during a user export"`
+
+	// Timeout replaces SERVER_WRITE_TIMEOUT on the export route: a big
+	// table takes longer than any other response to send.
+	Timeout time.Duration `env:"EXPORT_TIMEOUT" default:"10m" desc:"How long a user export may take"`
+}
+
+// CampaignConfig holds admin email campaigns (POST /admin/campaigns).
+type CampaignConfig struct {
+	// BatchSize is how many users one batch job goes through. A batch
+	// holds a job worker while it sends, so at SendRate it holds one for
+	// about BatchSize/SendRate windows.
+	BatchSize int `env:"CAMPAIGN_BATCH_SIZE" default:"100" desc:"Users each campaign batch job goes through"`
+
+	// SendRate emails per SendWindow is what the mail provider is sent,
+	// across every campaign: bursts of SendRate, refilled over the window.
+	SendRate   int           `env:"CAMPAIGN_SEND_RATE" default:"10" desc:"Campaign emails sent per CAMPAIGN_SEND_WINDOW (0 for no limit)"`
+	SendWindow time.Duration `env:"CAMPAIGN_SEND_WINDOW" default:"1s" desc:"Window CAMPAIGN_SEND_RATE applies to"`
+}
+
+// CaptchaConfig holds the CAPTCHA check on registration and login.
+// It's off unless a provider is set.
+type CaptchaConfig struct {
+	// Provider issued the widget the client pages show: "hcaptcha",
+	// "recaptcha", or "turnstile". The pages send its token as
+	// captcha_token in the /register and /login bodies.
+	Provider string `env:"CAPTCHA_PROVIDER" desc:"CAPTCHA provider checked on /register and /login: hcaptcha, recaptcha, or turnstile (empty disables)"`
+
+	// Secret is the provider's secret key, the server-side half of the
+	// site key the widget uses.
+	Secret string `env:"CAPTCHA_SECRET" desc:"CAPTCHA provider secret key" secret:"true"`
+
+	// MinScore is the lowest reCAPTCHA v3 score accepted (0.0 is a bot,
+	// 1.0 a person). Other providers don't score.
+	MinScore float64 `env:"CAPTCHA_MIN_SCORE" default:"0.5" desc:"Lowest reCAPTCHA v3 score accepted, 0.0 to 1.0"`
+
+	// Hostnames limits the sites a token may have been solved on. Empty
+	// trusts the provider's own domain check for the site key.
+	Hostnames []string `env:"CAPTCHA_HOSTNAMES" desc:"Comma-separated sites CAPTCHA tokens must be solved on (empty allows any)"`
+}
+
+// Enabled reports whether the CAPTCHA check is configured.
+func (c CaptchaConfig) Enabled() bool {
+	return c.Provider != ""
+}
+
+// RiskConfig holds the login risk score. It's off unless a policy is set.
+type RiskConfig struct {
+	// Policy is the score each action starts at, 0 to 100:
+	// "captcha=30,mfa=60,block=90". Actions left out aren't taken;
+	// captcha needs CAPTCHA_PROVIDER.
+	Policy []string `env:"RISK_POLICY" desc:"Comma-separated action=score pairs for /login: captcha, mfa, block (empty disables risk scoring)"`
+
+	// Weights override the default points per signal:
+	// "new_device=20,geo_anomaly=35,failed_attempt=10,disposable_email=25".
+	Weights []string `env:"RISK_WEIGHTS" desc:"Comma-separated signal=points overrides: new_device, geo_anomaly, failed_attempt, disposable_email"`
+
+	// FailureWindow is how long failed logins for an email count toward
+	// its score after the latest one.
+	FailureWindow time.Duration `env:"RISK_FAILURE_WINDOW" default:"15m" desc:"How long failed logins raise an email's risk score"`
+
+	// CountryHeader names the header a proxy in front of the app puts
+	// the client's country in (Cloudflare's CF-IPCountry). Without it the
+	// geo signal is off. Only set it if the proxy overwrites the header
+	// on every request: clients can send it too.
+	CountryHeader string `env:"RISK_COUNTRY_HEADER" desc:"Header with the client's ISO country code, set by a trusted proxy (empty disables the geo signal)"`
+
+	// DisposableDomains are counted as throwaway mail providers, on top
+	// of the built-in list.
+	DisposableDomains []string `env:"RISK_DISPOSABLE_DOMAINS" desc:"Comma-separated email domains counted as disposable, besides the built-in list"`
+}
+
+// Enabled reports whether logins are scored.
+func (c RiskConfig) Enabled() bool {
+	return len(c.Policy) > 0
+}
+
+// WebhookConfig holds the receivers for inbound webhooks from third
+// parties. None are mounted unless a secret is set.
+type WebhookConfig struct {
+	// Secrets are "receiver=secret" pairs: the receiver's name is its
+	// path (POST /webhooks/{receiver}), the secret the one the sender
+	// signs with. A receiver listed twice accepts either secret, for
+	// rotation.
+	Secrets []string `env:"WEBHOOK_SECRETS" desc:"Comma-separated receiver=secret pairs, one receiver per sender (empty disables webhooks)" secret:"true"`
+
+	// Tolerance is how old (or how far in the future) a delivery's
+	// signed timestamp may be.
+	Tolerance time.Duration `env:"WEBHOOK_TOLERANCE" default:"5m" desc:"How far a webhook's signed timestamp may be from now"`
+
+	// RedisAddrs shares the replay cache across instances. Without it,
+	// each instance only catches replays sent to itself.
+	RedisAddrs    []string `env:"WEBHOOK_REDIS_ADDR" desc:"Redis host:port (comma-separated for a cluster) for the webhook replay cache"`
+	RedisPassword string   `env:"WEBHOOK_REDIS_PASSWORD" desc:"Redis password for the webhook replay cache" secret:"true"`
+}
+
+// SecretsConfig holds the reloading of secrets mounted as files:
+// JWT_SECRET_FILE, JWT_PRIVATE_KEY_FILE and JWT_PUBLIC_KEY_FILE,
+// JWT_KEYS_FILE, DB_USER_FILE and DB_PASSWORD_FILE, and
+// SIGNING_SECRETS_FILE (see package secrets).
+type SecretsConfig struct {
+	// WatchInterval is how often the files are checked for changes.
+	// Kubernetes takes up to a minute or so to update a mounted Secret
+	// anyway; checking more often only shortens the wait after that.
+	WatchInterval time.Duration `env:"SECRETS_WATCH_INTERVAL" default:"30s" desc:"How often secret files are checked for changes (0 reads them only at startup)"`
+}
+
+// Load reads configuration from environment variables with defaults.
+// This is the preferred pattern because:
+// 1. Environment variables are easy to change in different environments
+// 2. Secrets don't get committed to version control
+// 3. Works well with Docker, Kubernetes, and cloud platforms
+//
+// Each field names its variable and default in struct tags (see bind.go).
+// An unset or empty variable takes the default. A value that doesn't
+// parse, or a missing required variable, is an error naming the variable:
+// silently running on a default you didn't choose is worse than not starting.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	if err := bind(cfg, os.LookupEnv); err != nil {
+		return nil, err
 	}
-	return defaultValue
+	return cfg, nil
 }
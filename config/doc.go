@@ -0,0 +1,177 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Variable describes one environment variable read by Load.
+type Variable struct {
+	Name        string `json:"name"`    // e.g. "DB_DSN"
+	Field       string `json:"field"`   // Go path, e.g. "Database.DSN"
+	Type        string `json:"type"`    // string, int, float, bool, duration, size, ratio, or list
+	Default     string `json:"default"` // Empty when there is no default
+	Description string `json:"description"`
+	Required    bool   `json:"required"`
+	Secret      bool   `json:"secret"` // Redacted in Settings
+
+	index []int        // Field index path within Config, for reflect.Value.FieldByIndex
+	typ   reflect.Type // Field type, for parsing
+}
+
+// Variables lists every environment variable, in Config field order.
+//
+// WHY REFLECTION?
+// The list is built from the struct tags on the Config structs (see
+// bind.go), the same tags Load binds from, so adding a field with its
+// tags is all it takes to load and document it. A hand-written table
+// (like the one in CLAUDE.md) drifts; this one can't.
+func Variables() []Variable {
+	var vars []Variable
+	collectVariables(reflect.TypeOf(Config{}), "", nil, &vars)
+	return vars
+}
+
+// collectVariables appends the tagged fields of t, recursing into
+// nested structs. prefix and index locate t within Config.
+func collectVariables(t reflect.Type, prefix string, index []int, vars *[]Variable) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		path := prefix + f.Name
+		fieldIndex := append(append([]int(nil), index...), i)
+
+		name, ok := f.Tag.Lookup("env")
+		if !ok {
+			if f.Type.Kind() == reflect.Struct {
+				collectVariables(f.Type, path+".", fieldIndex, vars)
+			}
+			continue
+		}
+
+		*vars = append(*vars, Variable{
+			Name:        name,
+			Field:       path,
+			Type:        typeName(f.Type),
+			Default:     f.Tag.Get("default"),
+			Description: f.Tag.Get("desc"),
+			Required:    f.Tag.Get("required") == "true",
+			Secret:      f.Tag.Get("secret") == "true",
+			index:       fieldIndex,
+			typ:         f.Type,
+		})
+	}
+}
+
+// Unit types are checked before the kind, since underneath they're
+// plain int64 and float64 values.
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	sizeType     = reflect.TypeOf(Size(0))
+	ratioType    = reflect.TypeOf(Ratio(0))
+)
+
+// typeName is the user-facing name of a config field's type.
+func typeName(t reflect.Type) string {
+	switch t {
+	case durationType:
+		return "duration"
+	case sizeType:
+		return "size"
+	case ratioType:
+		return "ratio"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int64:
+		return "int"
+	case reflect.Float64:
+		return "float"
+	case reflect.Bool:
+		return "bool"
+	case reflect.Slice:
+		return "list"
+	default:
+		return "string"
+	}
+}
+
+// WriteMarkdown renders vars as a Markdown table.
+func WriteMarkdown(w io.Writer, vars []Variable) error {
+	var b strings.Builder
+	b.WriteString("| Variable | Type | Default | Description |\n")
+	b.WriteString("|----------|------|---------|-------------|\n")
+	for _, v := range vars {
+		def := "(empty)"
+		switch {
+		case v.Required && v.Default == "":
+			def = "**required**"
+		case v.Secret && v.Default != "":
+			def = "(development default)"
+		case v.Default != "":
+			def = "`" + v.Default + "`"
+		}
+		desc := strings.ReplaceAll(v.Description, "|", `\|`)
+		if v.Secret {
+			desc += " (secret)"
+		}
+		fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", v.Name, v.Type, def, desc)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Check validates the current environment against Variables and returns
+// one line per problem:
+//   - a required variable that isn't set
+//   - a value that doesn't parse as the variable's type (Load would
+//     silently fall back to the default)
+//   - a variable that looks like ours but isn't (probably a typo, e.g.
+//     JWT_SECRT), judged by sharing a prefix such as "JWT_"
+func Check() []string {
+	return checkEnv(Variables(), os.Environ())
+}
+
+// checkEnv is Check with the variables and environment passed in.
+func checkEnv(vars []Variable, environ []string) []string {
+	known := make(map[string]Variable, len(vars))
+	prefixes := make(map[string]bool)
+	for _, v := range vars {
+		known[v.Name] = v
+		if prefix, _, ok := strings.Cut(v.Name, "_"); ok {
+			prefixes[prefix+"_"] = true
+		}
+	}
+
+	var problems []string
+	set := make(map[string]bool)
+	for _, entry := range environ {
+		name, value, _ := strings.Cut(entry, "=")
+		if value != "" {
+			set[name] = true
+		}
+		v, ok := known[name]
+		if !ok {
+			if prefix, _, found := strings.Cut(name, "_"); found && prefixes[prefix+"_"] {
+				problems = append(problems, fmt.Sprintf("%s: unknown variable (typo?)", name))
+			}
+			continue
+		}
+		if value == "" {
+			continue
+		}
+		if err := setValue(reflect.New(v.typ).Elem(), value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	for _, v := range vars {
+		if v.Required && v.Default == "" && !set[v.Name] {
+			problems = append(problems, fmt.Sprintf("%s is required", v.Name))
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Size is a number of bytes, written in the environment as "512", "64KB",
+// "10MB", or "1GB". Units are powers of 1024 (1KB = 1024 bytes); the
+// KiB/MiB/GiB spellings are accepted too and mean the same.
+//
+// WHY NOT A PLAIN INT?
+// SERVER_MAX_BODY_SIZE=1048576 is hard to read and easy to get wrong by a
+// factor of ten. "1MB" says what it means.
+type Size int64
+
+// Size units, largest first so String picks the biggest exact one.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+}
+
+// ParseSize parses a size like "10MB" (see Size).
+func ParseSize(s string) (Size, error) {
+	upper := strings.ToUpper(strings.TrimSpace(s))
+	upper = strings.Replace(upper, "IB", "B", 1) // KiB -> KB
+
+	multiplier := int64(1)
+	number := strings.TrimSuffix(upper, "B")
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(upper, u.suffix) {
+			multiplier = u.bytes
+			number = strings.TrimSuffix(upper, u.suffix)
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a size (e.g. 512KB, 10MB)", s)
+	}
+	return Size(n * float64(multiplier)), nil
+}
+
+// String formats the size with the largest unit that divides it exactly.
+func (s Size) String() string {
+	for _, u := range sizeUnits {
+		if s != 0 && int64(s)%u.bytes == 0 {
+			return strconv.FormatInt(int64(s)/u.bytes, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(s), 10) + "B"
+}
+
+// Ratio is a fraction between 0 and 1, written as "25%" or "0.25".
+type Ratio float64
+
+// ParseRatio parses a ratio like "25%" or "0.25" (see Ratio).
+func ParseRatio(s string) (Ratio, error) {
+	trimmed := strings.TrimSpace(s)
+	percent := strings.HasSuffix(trimmed, "%")
+
+	f, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(trimmed, "%")), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a ratio (e.g. 25%% or 0.25)", s)
+	}
+	if percent {
+		f /= 100
+	}
+	if f < 0 || f > 1 {
+		return 0, fmt.Errorf("%q is out of range (0%%-100%%)", s)
+	}
+	return Ratio(f), nil
+}
+
+// String formats the ratio as a percentage.
+func (r Ratio) String() string {
+	return strconv.FormatFloat(float64(r)*100, 'f', -1, 64) + "%"
+}
+
+// ParseDuration is time.ParseDuration plus a "d" (24h) unit, so windows
+// and lifetimes can be written as "30d" or "1d12h" instead of "720h".
+// A day is always 24 hours here; there are no calendar or DST rules.
+func ParseDuration(s string) (time.Duration, error) {
+	trimmed := strings.TrimSpace(s)
+
+	var days time.Duration
+	if before, after, found := strings.Cut(trimmed, "d"); found {
+		n, err := strconv.ParseFloat(before, 64)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("%q is not a duration (e.g. 30s, 15m, 1h30m, 7d)", s)
+		}
+		days = time.Duration(n * float64(24*time.Hour))
+		if after == "" {
+			return days, nil
+		}
+		trimmed = after
+	}
+
+	d, err := time.ParseDuration(trimmed)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration (e.g. 30s, 15m, 1h30m, 7d)", s)
+	}
+	return days + d, nil
+}
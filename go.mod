@@ -3,9 +3,26 @@ module go-basics
 go 1.25.5
 
 require (
+	github.com/crewjam/saml v0.5.1
 	github.com/go-sql-driver/mysql v1.9.3
 	github.com/golang-jwt/jwt/v5 v5.3.0
+	github.com/mattermost/xml-roundtrip-validator v0.1.0
+	github.com/quic-go/quic-go v0.59.0
+	github.com/redis/go-redis/v9 v9.22.0
+	github.com/russellhaering/goxmldsig v1.4.0
+	go.uber.org/goleak v1.3.0
 	golang.org/x/crypto v0.46.0
+	golang.org/x/sync v0.20.0
+	golang.org/x/text v0.32.0
 )
 
-require filippo.io/edwards25519 v1.1.0 // indirect
+require (
+	filippo.io/edwards25519 v1.1.0 // indirect
+	github.com/beevik/etree v1.5.0 // indirect
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/jonboulle/clockwork v0.2.2 // indirect
+	github.com/quic-go/qpack v0.6.0 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/net v0.47.0 // indirect
+	golang.org/x/sys v0.39.0 // indirect
+)
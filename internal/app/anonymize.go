@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/audit"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/jobs"
+	"go-basics/internal/txn"
+)
+
+// Anonymization scheduling.
+const (
+	// anonymizeDueJob carries out the anonymization requests whose grace
+	// period has ended.
+	anonymizeDueJob = "accounts.anonymize_due"
+
+	// anonymizeDueKey is the job's schedule; there's only ever one.
+	anonymizeDueKey = "accounts-anonymize-due"
+
+	// anonymizeBatch is how many requests one run carries out at most.
+	// The rest wait for the next run.
+	anonymizeBatch = 100
+)
+
+// anonymizePayload is the payload of an anonymizeDueJob. Like
+// dormancyPayload, it carries the interval it was scheduled with.
+type anonymizePayload struct {
+	Every string `json:"every"`
+}
+
+// newAnonymization builds the anonymization workflow, registers its job
+// on queue, and schedules it every cfg.Interval. Each account anonymized
+// is recorded on auditLog. avatars may be nil.
+func newAnonymization(cfg config.AnonymizeConfig, users user.Repository, repo user.AnonymizationRepository, avatars *user.Avatars, queue *jobs.Queue, scheduler *jobs.Scheduler, auditLog *audit.Logger) (*user.Anonymization, error) {
+	if cfg.Grace < 0 || cfg.Interval <= 0 {
+		return nil, fmt.Errorf("ANONYMIZE_GRACE must not be negative, and ANONYMIZE_INTERVAL must be positive")
+	}
+	var opts []user.AnonymizationOption
+	if avatars != nil {
+		opts = append(opts, user.WithAvatarStore(avatars))
+	}
+	anonymization := user.NewAnonymization(users, repo, cfg.Grace,
+		func(ctx context.Context, message string) {
+			auditLog.Record(ctx, audit.CategoryAccounts, "system", "%s", message)
+		}, opts...)
+
+	queue.Handle(anonymizeDueJob, func(ctx context.Context, payload []byte) error {
+		var p anonymizePayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("decoding anonymization run: %w", err)
+		}
+		if p.Every != cfg.Interval.String() {
+			return scheduleAnonymizeDue(ctx, scheduler, cfg.Interval, true)
+		}
+
+		due, err := anonymization.Due(ctx, anonymizeBatch)
+		if err != nil {
+			return err
+		}
+		// One transaction per account: a failure leaves that request in
+		// place for the next run, and doesn't undo the others.
+		failed := 0
+		for _, req := range due {
+			err := txn.Run(ctx, func(ctx context.Context) error {
+				return anonymization.Anonymize(ctx, req.UserID)
+			})
+			if err != nil {
+				log.Printf("anonymizing user %d: %v", req.UserID, err)
+				failed++
+			}
+		}
+		if len(due) > 0 {
+			log.Printf("anonymization: %d account(s) anonymized, %d failed", len(due)-failed, failed)
+		}
+		return nil
+	})
+
+	if err := scheduleAnonymizeDue(context.Background(), scheduler, cfg.Interval, false); err != nil {
+		return nil, fmt.Errorf("scheduling anonymization runs: %w", err)
+	}
+	return anonymization, nil
+}
+
+// scheduleAnonymizeDue schedules the job every interval, unless it
+// already is (by this or another instance). With replace, the existing
+// schedule is canceled first.
+func scheduleAnonymizeDue(ctx context.Context, scheduler *jobs.Scheduler, interval time.Duration, replace bool) error {
+	if replace {
+		if err := scheduler.Cancel(ctx, anonymizeDueKey); err != nil && !errors.Is(err, jobs.ErrScheduleNotFound) {
+			return err
+		}
+	}
+	_, err := scheduler.After(ctx, anonymizeDueJob, anonymizePayload{Every: interval.String()}, interval,
+		jobs.Unique(anonymizeDueKey), jobs.Every(interval))
+	if errors.Is(err, jobs.ErrDuplicateSchedule) {
+		return nil
+	}
+	return err
+}
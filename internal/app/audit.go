@@ -0,0 +1,88 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/audit"
+	userRepo "go-basics/internal/repository/mysql"
+)
+
+// newAuditLogger builds the audit logger from AUDIT_SINKS and
+// AUDIT_ROUTES. A sink named in several places is opened once. An unknown
+// sink or category fails startup: a typo shouldn't quietly send the
+// audit trail nowhere.
+func newAuditLogger(cfg config.AuditConfig, db *sql.DB) (*audit.Logger, error) {
+	opened := make(map[string]audit.Sink)
+	sinks := func(names []string) ([]audit.Sink, error) {
+		var out []audit.Sink
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			s, ok := opened[name]
+			if !ok {
+				var err error
+				if s, err = openAuditSink(cfg, db, name); err != nil {
+					return nil, err
+				}
+				opened[name] = s
+			}
+			out = append(out, s)
+		}
+		return out, nil
+	}
+	closeOpened := func() {
+		for _, s := range opened {
+			s.Close()
+		}
+	}
+
+	defaults, err := sinks(cfg.Sinks)
+	if err != nil {
+		closeOpened()
+		return nil, err
+	}
+	routes := make(map[audit.Category][]audit.Sink)
+	for _, spec := range cfg.Routes {
+		category, names, ok := strings.Cut(spec, "=")
+		if !ok || names == "" {
+			closeOpened()
+			return nil, fmt.Errorf("AUDIT_ROUTES entry %q must be <category>=<sink>+<sink>", spec)
+		}
+		c := audit.Category(strings.TrimSpace(category))
+		if !slices.Contains(audit.Categories, c) {
+			closeOpened()
+			return nil, fmt.Errorf("AUDIT_ROUTES: unknown category %q (one of %v)", c, audit.Categories)
+		}
+		routed, err := sinks(strings.Split(names, "+"))
+		if err != nil {
+			closeOpened()
+			return nil, err
+		}
+		routes[c] = routed
+	}
+	return audit.NewLogger(defaults, routes), nil
+}
+
+// openAuditSink opens one named sink.
+func openAuditSink(cfg config.AuditConfig, db *sql.DB, name string) (audit.Sink, error) {
+	switch name {
+	case "log":
+		return audit.LogSink{}, nil
+	case "stdout":
+		return &audit.StdoutSink{}, nil
+	case "file":
+		return audit.NewFileSink(cfg.FilePath, cfg.FileMaxSize)
+	case "mysql":
+		return userRepo.NewAuditSink(db), nil
+	case "collector":
+		if cfg.CollectorURL == "" {
+			return nil, fmt.Errorf("the collector audit sink needs AUDIT_COLLECTOR_URL")
+		}
+		return audit.NewCollectorSink(cfg.CollectorURL, cfg.CollectorToken), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q (log, stdout, file, mysql, or collector)", name)
+	}
+}
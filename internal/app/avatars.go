@@ -0,0 +1,49 @@
+package app
+
+import (
+	"fmt"
+	"net/http"
+
+	"go-basics/config"
+	"go-basics/internal/blob"
+)
+
+// localAvatarsPath is where this server serves AVATAR_STORAGE=local.
+const localAvatarsPath = "/avatars"
+
+// newAvatarStore builds the blob store AVATAR_STORAGE names. For local
+// storage it also returns the handler that serves the files, to mount
+// at localAvatarsPath; S3 serves its own.
+func (a *application) newAvatarStore(cfg config.AvatarConfig) (blob.Store, http.Handler, error) {
+	if cfg.Size <= 0 {
+		return nil, nil, fmt.Errorf("AVATAR_SIZE must be positive, got %d", cfg.Size)
+	}
+	switch cfg.Storage {
+	case "local":
+		publicURL := cfg.PublicURL
+		if publicURL == "" {
+			publicURL = localAvatarsPath
+		}
+		store, err := blob.NewLocal(cfg.LocalDir, publicURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		return store, store, nil
+	case "s3":
+		store, err := blob.NewS3(blob.S3Config{
+			Bucket:          cfg.S3Bucket,
+			Region:          cfg.S3Region,
+			Endpoint:        cfg.S3Endpoint,
+			AccessKeyID:     cfg.S3AccessKeyID,
+			SecretAccessKey: cfg.S3SecretAccessKey,
+			PublicURL:       cfg.PublicURL,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("AVATAR_STORAGE=s3: %w", err)
+		}
+		a.closers = append(a.closers, store.Close)
+		return store, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("AVATAR_STORAGE must be local or s3, got %q", cfg.Storage)
+	}
+}
@@ -0,0 +1,51 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/bulkhead"
+	"go-basics/internal/domain/tenant"
+	"go-basics/internal/metrics"
+)
+
+// newBulkhead builds the per-tenant request caps of TENANT_MAX_CONNS and
+// TENANT_MAX_CONNS_OVERRIDES. It returns nil when neither caps anything.
+func newBulkhead(cfg config.TenantConfig, poolSize int, reg *metrics.Registry, labels *metrics.TenantLimiter) (*bulkhead.Bulkhead, error) {
+	limits := make(map[string]int, len(cfg.MaxConnsOverrides))
+	for _, spec := range cfg.MaxConnsOverrides {
+		id, n, ok := strings.Cut(spec, "=")
+		id = strings.TrimSpace(id)
+		limit, err := strconv.Atoi(strings.TrimSpace(n))
+		if !ok || err != nil || limit < 0 {
+			return nil, fmt.Errorf("TENANT_MAX_CONNS_OVERRIDES entry %q must be <tenant>=<n>", spec)
+		}
+		if !tenant.ValidTenantID(id) {
+			return nil, fmt.Errorf("TENANT_MAX_CONNS_OVERRIDES entry %q: invalid tenant ID", spec)
+		}
+		if _, dup := limits[id]; dup {
+			return nil, fmt.Errorf("TENANT_MAX_CONNS_OVERRIDES lists %q twice", id)
+		}
+		limits[id] = limit
+	}
+	if cfg.MaxConns < 0 {
+		return nil, fmt.Errorf("TENANT_MAX_CONNS must not be negative")
+	}
+	capped := cfg.MaxConns > 0
+	for _, limit := range limits {
+		capped = capped || limit > 0
+	}
+	if !capped {
+		return nil, nil
+	}
+
+	// A cap as large as the pool lets a tenant take it all anyway.
+	if cfg.MaxConns >= poolSize {
+		log.Printf("TENANT_MAX_CONNS (%d) isn't below DB_MAX_OPEN_CONNS (%d): one tenant can still hold every connection", cfg.MaxConns, poolSize)
+	}
+	log.Printf("Tenant bulkhead enabled: %d requests in flight per tenant, %d overrides", cfg.MaxConns, len(limits))
+	return bulkhead.New(cfg.MaxConns, limits, cfg.QueueTimeout, reg, labels), nil
+}
@@ -0,0 +1,116 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/domain/campaign"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/jobs"
+	"go-basics/internal/mail"
+	"go-basics/internal/ratelimit"
+	userRepo "go-basics/internal/repository/mysql"
+)
+
+// sendCampaignBatchJob sends one batch of a campaign.
+const sendCampaignBatchJob = "campaign.batch"
+
+// campaignPayload is the payload of a sendCampaignBatchJob.
+type campaignPayload struct {
+	CampaignID uint64 `json:"campaign_id"`
+}
+
+// newCampaigns builds the campaign service, with batches scheduled on
+// scheduler and run by queue. mailer is the real one, not queuedMailer:
+// each delivery records what the provider said.
+func newCampaigns(cfg config.CampaignConfig, db *sql.DB, users user.Repository, roles user.RoleRepository, activity user.ActivityRepository, mailer mail.Mailer, queue *jobs.Queue, scheduler *jobs.Scheduler) (*campaign.Service, error) {
+	if cfg.BatchSize < 1 || cfg.SendRate < 0 || cfg.SendWindow < 0 {
+		return nil, fmt.Errorf("CAMPAIGN_BATCH_SIZE must be at least 1, and CAMPAIGN_SEND_RATE and CAMPAIGN_SEND_WINDOW not negative")
+	}
+	throttle := mailThrottle{
+		store: ratelimit.NewMemoryStore(),
+		limit: ratelimit.Limit{Burst: cfg.SendRate, Period: cfg.SendWindow},
+	}
+	service := campaign.NewService(userRepo.NewCampaignRepository(db), users, roles, activity,
+		mailer, jobCampaignBatches{scheduler: scheduler}, throttle, cfg.BatchSize)
+
+	queue.Handle(sendCampaignBatchJob, func(ctx context.Context, payload []byte) error {
+		var p campaignPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("decoding campaign batch: %w", err)
+		}
+		return service.SendBatch(ctx, p.CampaignID)
+	})
+	return service, nil
+}
+
+// jobCampaignBatches is a campaign.BatchScheduler on the job scheduler.
+// The unique key allows one pending batch per campaign, so its batches
+// run one after another.
+type jobCampaignBatches struct {
+	scheduler *jobs.Scheduler
+}
+
+// campaignBatchKey is the unique key of the campaign's pending batch.
+func campaignBatchKey(campaignID uint64) string {
+	return fmt.Sprintf("campaign-batch:%d", campaignID)
+}
+
+// ScheduleBatch implements campaign.BatchScheduler.
+func (b jobCampaignBatches) ScheduleBatch(ctx context.Context, campaignID uint64) error {
+	_, err := b.scheduler.After(ctx, sendCampaignBatchJob, campaignPayload{CampaignID: campaignID}, 0,
+		jobs.Unique(campaignBatchKey(campaignID)))
+	if errors.Is(err, jobs.ErrDuplicateSchedule) {
+		return nil
+	}
+	return err
+}
+
+// CancelBatch implements campaign.BatchScheduler.
+func (b jobCampaignBatches) CancelBatch(ctx context.Context, campaignID uint64) error {
+	err := b.scheduler.Cancel(ctx, campaignBatchKey(campaignID))
+	if errors.Is(err, jobs.ErrScheduleNotFound) {
+		return nil
+	}
+	return err
+}
+
+// mailThrottle is a campaign.Throttle on a token bucket shared by every
+// campaign, so two campaigns at once don't send twice as fast.
+//
+// WHY NOT IN REDIS LIKE THE LOGIN LIMITS?
+// Batches are handed out by the scheduler, which runs on the leader
+// only, so they're all sent from one instance at a time; this
+// instance's memory is all the bucket needs.
+type mailThrottle struct {
+	store ratelimit.Store
+	limit ratelimit.Limit
+}
+
+// Wait implements campaign.Throttle.
+func (t mailThrottle) Wait(ctx context.Context) error {
+	if !t.limit.Enabled() {
+		return nil
+	}
+	for {
+		d, err := t.store.Take(ctx, "campaign-mail", t.limit)
+		if err != nil {
+			return fmt.Errorf("taking a campaign send token: %w", err)
+		}
+		if d.Allowed {
+			return nil
+		}
+		timer := time.NewTimer(d.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"go-basics/config"
+	userHandler "go-basics/internal/handler/http"
+)
+
+// newCapabilities describes what this deployment offers, for
+// GET /capabilities. mfa and webPush report whether those were set up.
+func newCapabilities(cfg *config.Config, k *knobs, mfa, webPush bool) userHandler.Capabilities {
+	// The routes newRateLimiter's limits guard.
+	limited := []string{"POST /login", "POST /auth/forgot-password"}
+	window := int64(cfg.Limits.Window.Seconds())
+
+	return userHandler.Capabilities{
+		Features: map[string]bool{
+			userHandler.FeatureMFA:          mfa,
+			userHandler.FeaturePasskeys:     false,
+			userHandler.FeatureSCIM:         false,
+			userHandler.FeatureGraphQL:      false,
+			userHandler.FeatureSSO:          cfg.SAML.Enabled(),
+			userHandler.FeatureCaptcha:      cfg.Captcha.Enabled(),
+			userHandler.FeatureWebPush:      webPush,
+			userHandler.FeatureTokenBinding: cfg.JWT.Binding != "",
+			userHandler.FeatureTokenJWE:     cfg.JWT.EncryptionKey != "" && len(cfg.JWT.EncryptedClaims) == 0,
+			userHandler.FeatureClaimsJWE:    cfg.JWT.EncryptionKey != "" && len(cfg.JWT.EncryptedClaims) > 0,
+			userHandler.FeatureHTTP3:        cfg.HTTP3.Enabled(),
+			userHandler.FeatureMTLS:         cfg.MTLS.Enabled(),
+			userHandler.FeatureAvatars:      cfg.Avatars.Enabled(),
+			userHandler.FeatureSignedAuth:   cfg.Signing.Enabled(),
+			userHandler.FeatureRiskScoring:  cfg.Risk.Enabled(),
+			userHandler.FeatureDPoP:         cfg.DPoP.Enabled,
+		},
+		CaptchaProvider: cfg.Captcha.Provider,
+		MaxBodySize:     int64(cfg.Server.MaxBodySize),
+		RateLimits: func() []userHandler.RateLimitInfo {
+			return []userHandler.RateLimitInfo{
+				{Name: "auth-ip", Per: "ip", Routes: limited, Requests: k.rateLimitPerIP.Get(), WindowSeconds: window},
+				{Name: "auth-email", Per: "email", Routes: limited, Requests: k.rateLimitPerEmail.Get(), WindowSeconds: window},
+			}
+		},
+	}
+}
@@ -0,0 +1,25 @@
+package app
+
+import (
+	"fmt"
+
+	"go-basics/config"
+	"go-basics/internal/captcha"
+)
+
+// newCaptcha builds the CAPTCHA check for registration and login, or
+// returns nil when CAPTCHA_PROVIDER is empty.
+func newCaptcha(cfg config.CaptchaConfig) (captcha.Verifier, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	if cfg.MinScore < 0 || cfg.MinScore > 1 {
+		return nil, fmt.Errorf("CAPTCHA_MIN_SCORE must be between 0.0 and 1.0")
+	}
+	verifier, err := captcha.New(cfg.Provider, cfg.Secret,
+		captcha.WithMinScore(cfg.MinScore), captcha.WithHostnames(cfg.Hostnames...))
+	if err != nil {
+		return nil, fmt.Errorf("CAPTCHA_PROVIDER: %w", err)
+	}
+	return verifier, nil
+}
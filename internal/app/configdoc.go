@@ -0,0 +1,39 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"go-basics/config"
+)
+
+// WriteConfigDoc lists every environment variable the application reads,
+// as "markdown" (a table for the docs) or "json" (for tooling).
+func WriteConfigDoc(w io.Writer, format string) error {
+	vars := config.Variables()
+	switch format {
+	case "", "markdown":
+		return config.WriteMarkdown(w, vars)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(vars)
+	default:
+		return fmt.Errorf("unknown format %q (want markdown or json)", format)
+	}
+}
+
+// CheckConfig validates the current environment (see config.Check),
+// writing each problem to w. It fails if there are any.
+func CheckConfig(w io.Writer) error {
+	problems := config.Check()
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d configuration problem(s)", len(problems))
+	}
+	fmt.Fprintln(w, "configuration ok")
+	return nil
+}
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/audit"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/jobs"
+	"go-basics/internal/mail"
+)
+
+// Dormant account report scheduling.
+const (
+	// dormancyReportJob runs the dormancy policy and reports on it.
+	dormancyReportJob = "accounts.dormancy_report"
+
+	// dormancyReportKey is the report's schedule; there's only ever one.
+	dormancyReportKey = "accounts-dormancy-report"
+
+	// dormancyReportListed is how many accounts a report email lists.
+	dormancyReportListed = 100
+)
+
+// dormancyPayload is the payload of a dormancyReportJob. It carries the
+// interval it was scheduled with, so a run can tell the configured one
+// has changed since.
+type dormancyPayload struct {
+	Every string `json:"every"`
+}
+
+// newDormancy builds the dormancy report and policy runner, registers its
+// job on queue, and schedules it every cfg.ReportInterval (or cancels the
+// schedule, with an interval of 0). Each action is recorded on auditLog.
+func newDormancy(cfg config.DormancyConfig, users user.Repository, roles user.RoleRepository, activity user.ActivityRepository, sessions user.SessionRepository, exempt []string, queue *jobs.Queue, scheduler *jobs.Scheduler, auditLog *audit.Logger) (*user.Dormancy, error) {
+	if cfg.After <= 0 || cfg.Grace <= 0 || cfg.ReportInterval < 0 {
+		return nil, fmt.Errorf("DORMANT_AFTER and DORMANT_GRACE must be positive, and DORMANT_REPORT_INTERVAL not negative")
+	}
+	actions, err := user.ParseDormancyActions(cfg.Actions)
+	if err != nil {
+		return nil, fmt.Errorf("DORMANT_ACTIONS: %w", err)
+	}
+	mailer := queuedMailer{queue: queue}
+	dormancy := user.NewDormancy(users, roles, activity, sessions, mailer,
+		user.DormancyPolicy{After: cfg.After, Actions: actions, Grace: cfg.Grace, Exempt: exempt},
+		func(ctx context.Context, message string) {
+			auditLog.Record(ctx, audit.CategoryAccounts, "system", "%s", message)
+		})
+
+	queue.Handle(dormancyReportJob, func(ctx context.Context, payload []byte) error {
+		var p dormancyPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("decoding dormancy report: %w", err)
+		}
+		// Changed (or turned off) since this run was scheduled: swap the
+		// schedule for the configured one, and let that run instead.
+		if p.Every != cfg.ReportInterval.String() {
+			return rescheduleDormancyReport(ctx, scheduler, cfg.ReportInterval)
+		}
+
+		report, err := dormancy.Run(ctx, false, dormancyReportListed)
+		if err != nil {
+			return err
+		}
+		log.Printf("dormancy: %s", dormancySummary(report))
+		if len(cfg.ReportTo) == 0 {
+			return nil
+		}
+		for _, to := range cfg.ReportTo {
+			if err := mailer.Send(ctx, dormancyReportEmail(to, report)); err != nil {
+				return fmt.Errorf("sending dormancy report: %w", err)
+			}
+		}
+		return nil
+	})
+
+	if err := scheduleDormancyReport(context.Background(), scheduler, cfg.ReportInterval); err != nil {
+		return nil, fmt.Errorf("scheduling the dormancy report: %w", err)
+	}
+	return dormancy, nil
+}
+
+// scheduleDormancyReport schedules the report every interval, unless it
+// already is (by this or another instance), or cancels it for 0.
+func scheduleDormancyReport(ctx context.Context, scheduler *jobs.Scheduler, interval time.Duration) error {
+	if interval == 0 {
+		if err := scheduler.Cancel(ctx, dormancyReportKey); err != nil && !errors.Is(err, jobs.ErrScheduleNotFound) {
+			return err
+		}
+		return nil
+	}
+	_, err := scheduler.After(ctx, dormancyReportJob, dormancyPayload{Every: interval.String()}, interval,
+		jobs.Unique(dormancyReportKey), jobs.Every(interval))
+	if errors.Is(err, jobs.ErrDuplicateSchedule) {
+		return nil
+	}
+	return err
+}
+
+// rescheduleDormancyReport replaces the report's schedule with one every
+// interval.
+func rescheduleDormancyReport(ctx context.Context, scheduler *jobs.Scheduler, interval time.Duration) error {
+	if err := scheduler.Cancel(ctx, dormancyReportKey); err != nil && !errors.Is(err, jobs.ErrScheduleNotFound) {
+		return err
+	}
+	return scheduleDormancyReport(ctx, scheduler, interval)
+}
+
+// dormancySummary is the report in one line, e.g.
+// "12 dormant account(s) (no login since 2026-04-21): none 3, warn 9".
+func dormancySummary(report *user.DormancyReport) string {
+	steps := make([]string, 0, len(report.Steps))
+	for step, n := range report.Steps {
+		steps = append(steps, fmt.Sprintf("%s %d", step, n))
+	}
+	sort.Strings(steps)
+	summary := fmt.Sprintf("%d dormant account(s) (no login since %s)", report.Dormant, report.Cutoff.Format(time.DateOnly))
+	if len(steps) > 0 {
+		summary += ": " + strings.Join(steps, ", ")
+	}
+	if report.Failed > 0 {
+		summary += fmt.Sprintf("; %d failed, retried next run", report.Failed)
+	}
+	return summary
+}
+
+// dormancyReportEmail is the report as an email to one recipient.
+func dormancyReportEmail(to string, report *user.DormancyReport) mail.Message {
+	var body strings.Builder
+	fmt.Fprintf(&body, "%s.\n\n", dormancySummary(report))
+	for _, a := range report.Accounts {
+		fmt.Fprintf(&body, "user %d  %s  last login %s  %s", a.UserID, a.Email, a.LastLoginAt.Format(time.DateOnly), a.Step)
+		if a.Error != "" {
+			fmt.Fprintf(&body, "  FAILED: %s", a.Error)
+		}
+		body.WriteString("\n")
+	}
+	if report.Truncated {
+		fmt.Fprintf(&body, "\nOnly the first %d are listed; GET /admin/accounts/dormant?limit= previews more.\n", len(report.Accounts))
+	}
+	return mail.Message{
+		To:      to,
+		Subject: fmt.Sprintf("Dormant accounts: %d", report.Dormant),
+		Body:    body.String(),
+	}
+}
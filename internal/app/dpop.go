@@ -0,0 +1,44 @@
+package app
+
+import (
+	"fmt"
+	"net/url"
+
+	"go-basics/config"
+	"go-basics/internal/auth"
+	"go-basics/internal/webhook"
+)
+
+// newDPoP returns the JWT manager option for DPOP_ENABLED, or none when
+// it's off. Nonces are signed with DPOP_NONCE_KEY, or jwtSecret.
+//
+// Proof IDs go in the same kind of replay cache as signed requests'
+// nonces: in memory, or in Redis with DPOP_REDIS_ADDR.
+func (a *application) newDPoP(cfg config.DPoPConfig, jwtSecret string) ([]auth.Option, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	var opts []auth.DPoPOption
+	if cfg.Nonces {
+		key := cfg.NonceKey
+		if key == "" {
+			key = jwtSecret
+		}
+		opts = append(opts, auth.WithDPoPNonces([]byte(key)))
+	}
+	if cfg.URL != "" {
+		base, err := url.Parse(cfg.URL)
+		if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+			return nil, fmt.Errorf("DPOP_URL %q must be an absolute http(s) URL", cfg.URL)
+		}
+		opts = append(opts, auth.WithDPoPBaseURL(base))
+	}
+
+	var jtis auth.NonceCache = webhook.NewMemoryReplayCache()
+	if len(cfg.RedisAddrs) > 0 {
+		client := a.newRedisClient(cfg.RedisAddrs, cfg.RedisPassword)
+		jtis = webhook.NewRedisReplayCache(client, "nonce:")
+	}
+	return []auth.Option{auth.WithDPoP(auth.NewDPoPVerifier(cfg.MaxAge, jtis, opts...))}, nil
+}
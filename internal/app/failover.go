@@ -0,0 +1,41 @@
+package app
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+
+	"go-basics/config"
+	"go-basics/internal/failover"
+	"go-basics/internal/metrics"
+	"go-basics/internal/secrets"
+)
+
+// openFailoverDB opens the main pool through a failover connector, so new
+// connections go to DB_STANDBY_DSN when the primary stays down (see the
+// failover package). The caller must start the connector's health checks.
+// With creds, both databases are logged in to with them (see openDB).
+func openFailoverDB(cfg config.DatabaseConfig, creds *secrets.DBCredentials, reg *metrics.Registry) (*sql.DB, *failover.Connector, error) {
+	var opts []mysql.Option
+	if creds != nil {
+		opts = append(opts, creds.Option())
+	}
+	connector, err := failover.New(cfg.DSN, cfg.StandbyDSN, cfg.FailoverWindow, reg, opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("configuring failover: %w", err)
+	}
+
+	var pool driver.Connector = connector
+	if creds != nil {
+		pool = creds.Connector(connector)
+	}
+	db, err := configurePool(sql.OpenDB(pool), cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Database failover enabled (window %v)", cfg.FailoverWindow)
+	return db, connector, nil
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"go-basics/config"
+)
+
+// loadServerTLS loads the certificate for HTTPS and HTTP/3, or returns
+// nil if none is configured.
+func loadServerTLS(cfg config.ServerConfig) (*tls.Config, error) {
+	if !cfg.TLS() {
+		return nil, nil
+	}
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, errors.New("SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE must be set together")
+	}
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// http3Listener is HTTP/3 served next to the TCP server: the QUIC server
+// and the UDP socket it will serve on.
+type http3Listener struct {
+	server *http3.Server
+	conn   net.PacketConn
+	port   int // Advertised in Alt-Svc
+}
+
+// listenHTTP3 opens the UDP socket for HTTP/3 (HTTP3_PORT) and prepares
+// a server for handler on it, or returns nil if HTTP/3 is off.
+//
+// The socket is opened here, before anything is served, so a port
+// that's taken fails startup instead of leaving the TCP server up
+// advertising an HTTP/3 endpoint that isn't there.
+func listenHTTP3(cfg *config.Config, tlsConfig *tls.Config, handler http.Handler) (*http3Listener, error) {
+	if !cfg.HTTP3.Enabled() {
+		return nil, nil
+	}
+	if tlsConfig == nil {
+		// QUIC has TLS 1.3 built in; there's no unencrypted HTTP/3.
+		return nil, errors.New("HTTP3_PORT needs SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE")
+	}
+
+	advertised := cfg.HTTP3.AdvertisedPort
+	if advertised == "" {
+		advertised = cfg.HTTP3.Port
+	}
+	port, err := strconv.Atoi(advertised)
+	if err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("HTTP/3 port %q isn't a port number", advertised)
+	}
+
+	conn, err := net.ListenPacket("udp", ":"+cfg.HTTP3.Port)
+	if err != nil {
+		return nil, fmt.Errorf("opening HTTP/3 socket: %w", err)
+	}
+	return &http3Listener{
+		server: &http3.Server{
+			Handler: handler,
+			// ConfigureTLSConfig adds the "h3" protocol, on a copy; TCP
+			// keeps offering h2 and HTTP/1.1 on the original.
+			TLSConfig:      http3.ConfigureTLSConfig(tlsConfig.Clone()),
+			IdleTimeout:    cfg.Server.IdleTimeout,
+			MaxHeaderBytes: int(cfg.Server.MaxHeaderSize),
+		},
+		conn: conn,
+		port: port,
+	}, nil
+}
+
+// Serve serves HTTP/3 until Shutdown.
+func (l *http3Listener) Serve() error {
+	return l.server.Serve(l.conn)
+}
+
+// Shutdown tells clients to go away (GOAWAY) and waits for in-flight
+// requests, until ctx is done, then closes the rest and the socket,
+// which the QUIC server leaves open.
+func (l *http3Listener) Shutdown(ctx context.Context) error {
+	return errors.Join(l.server.Shutdown(ctx), l.conn.Close())
+}
+
+// advertise wraps the TCP server's handler to announce HTTP/3 on every
+// response, e.g.
+//
+//	Alt-Svc: h3=":443"; ma=86400
+//
+// A client that supports HTTP/3 remembers it for maxAge and makes its
+// next requests over QUIC, falling back to TCP if UDP is blocked.
+func (l *http3Listener) advertise(next http.Handler, maxAge time.Duration) http.Handler {
+	altSvc := fmt.Sprintf(`%s=":%d"; ma=%d`, http3.NextProtoH3, l.port, int(maxAge.Seconds()))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"go-basics/config"
+	"go-basics/internal/jobs"
+	"go-basics/internal/mail"
+	"go-basics/internal/metrics"
+	userRepo "go-basics/internal/repository/mysql"
+)
+
+// sendMailJob is the kind of job that sends one email.
+const sendMailJob = "mail.send"
+
+// newJobQueue builds the background job queue and registers its job
+// kinds. Unfinished jobs are saved to the main database at shutdown, and
+// jobs that fail for good are dead-lettered there.
+func newJobQueue(cfg config.JobsConfig, db *sql.DB, mailer mail.Mailer, reg *metrics.Registry) (*jobs.Queue, error) {
+	if cfg.Workers < 1 || cfg.QueueSize < 1 || cfg.MaxAttempts < 1 {
+		return nil, fmt.Errorf("JOBS_WORKERS, JOBS_QUEUE_SIZE, and JOBS_MAX_ATTEMPTS must be at least 1")
+	}
+	queue := jobs.NewQueue(cfg.Workers, cfg.QueueSize, userRepo.NewJobSpool(db), userRepo.NewJobDeadLetters(db), reg,
+		jobs.WithRetries(cfg.MaxAttempts, cfg.RetryBackoff))
+	queue.Handle(sendMailJob, func(ctx context.Context, payload []byte) error {
+		var msg mail.Message
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			return fmt.Errorf("decoding message: %w", err)
+		}
+		return mailer.Send(ctx, msg)
+	})
+	return queue, nil
+}
+
+// newJobScheduler builds the scheduler for delayed and recurring jobs,
+// kept in the main database. Run it as a leader task.
+func newJobScheduler(cfg config.JobsConfig, queue *jobs.Queue, db *sql.DB, reg *metrics.Registry) (*jobs.Scheduler, error) {
+	if cfg.SchedulerPoll <= 0 {
+		return nil, fmt.Errorf("JOBS_SCHEDULER_POLL must be positive")
+	}
+	return jobs.NewScheduler(queue, userRepo.NewJobSchedules(db), cfg.SchedulerPoll, reg), nil
+}
+
+// queuedMailer is a mail.Mailer that hands messages to the job queue, so
+// Send returns once the message is queued rather than once it's sent.
+//
+// A message saved at shutdown sits in job_spool until the next start.
+// For a password reset that includes the link, so the table deserves the
+// same care as the mailbox it's headed for; the link still expires after
+// PASSWORD_RESET_TOKEN_TTL either way.
+type queuedMailer struct {
+	queue *jobs.Queue
+}
+
+// Send implements mail.Mailer.
+func (m queuedMailer) Send(_ context.Context, msg mail.Message) error {
+	return m.queue.Enqueue(sendMailJob, msg)
+}
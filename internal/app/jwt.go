@@ -0,0 +1,274 @@
+package app
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+)
+
+// keySpec is one entry of the JWT_KEYS_FILE rotation schedule.
+//
+// Example file:
+//
+//	[
+//	  {"id": "2026-09", "secret": "...", "expires_at": "2026-10-02T00:15:00Z"},
+//	  {"id": "2026-10", "secret": "...", "active_from": "2026-10-02T00:00:00Z"},
+//	  {"id": "rsa-1", "algorithm": "RS256", "private_key_file": "/secrets/rsa-1.pem"}
+//	]
+//
+// The newest active key signs; every non-expired key validates.
+type keySpec struct {
+	ID             string    `json:"id"`
+	Algorithm      string    `json:"algorithm"` // HS256 (default), RS256, ES256, ...
+	Secret         string    `json:"secret"`    // HS* only
+	PrivateKey     string    `json:"private_key"`
+	PrivateKeyFile string    `json:"private_key_file"`
+	PublicKey      string    `json:"public_key"`
+	PublicKeyFile  string    `json:"public_key_file"`
+	ActiveFrom     time.Time `json:"active_from"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+// jwtManagerOptions translates JWT configuration into JWTManager options.
+// HS256 needs no options (the secret is passed directly); RS*/ES*
+// algorithms load a key pair from PEM strings or files, and JWT_KEYS_FILE
+// loads a whole rotation schedule. Audience and leeway settings apply to
+// all of them.
+func jwtManagerOptions(cfg config.JWTConfig) ([]auth.Option, error) {
+	opts := audienceOptions(cfg)
+	if cfg.Leeway > 0 {
+		opts = append(opts, auth.WithLeeway(cfg.Leeway))
+	}
+	if len(cfg.ScopeTTLs) > 0 || len(cfg.AudienceTTLs) > 0 {
+		lifetimes, err := tokenLifetimes(cfg)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, auth.WithLifetimes(lifetimes))
+	}
+	if cfg.Binding != "" {
+		binder, err := newBinder(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_BINDING: %w", err)
+		}
+		opts = append(opts, auth.WithBinding(binder))
+	}
+	if len(cfg.EncryptedClaims) > 0 && cfg.EncryptionKey == "" {
+		return nil, fmt.Errorf("JWT_ENCRYPTED_CLAIMS needs JWT_ENCRYPTION_KEY")
+	}
+	if cfg.EncryptionKey != "" {
+		encrypter, err := newEncrypter(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_ENCRYPTION_KEY: %w", err)
+		}
+		opts = append(opts, auth.WithEncryption(encrypter))
+	}
+
+	if cfg.KeysFile != "" {
+		keys, err := loadKeysFile(cfg.KeysFile)
+		if err != nil {
+			return nil, err
+		}
+		return append(opts, auth.WithKeys(keys...)), nil
+	}
+
+	if cfg.Algorithm == "" || cfg.Algorithm == "HS256" {
+		return opts, nil
+	}
+
+	key, err := parseKey(cfg.Algorithm, cfg.PrivateKey, cfg.PrivateKeyFile, cfg.PublicKey, cfg.PublicKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	if !key.CanSign() {
+		log.Printf("JWT: no private key configured, tokens can be verified but not issued")
+	}
+	return append(opts, auth.WithKey(key)), nil
+}
+
+// audienceOptions stamps JWT_AUDIENCE on issued tokens and requires
+// JWT_EXPECTED_AUDIENCES (falling back to JWT_AUDIENCE) when validating.
+func audienceOptions(cfg config.JWTConfig) []auth.Option {
+	var opts []auth.Option
+	if len(cfg.Audience) > 0 {
+		opts = append(opts, auth.WithAudience(cfg.Audience...))
+	}
+
+	expected := cfg.ExpectedAudiences
+	if len(expected) == 0 {
+		expected = cfg.Audience
+	}
+	if len(expected) > 0 {
+		opts = append(opts, auth.WithExpectedAudience(expected...))
+	}
+	return opts
+}
+
+// tokenLifetimes parses JWT_SCOPE_TTLS and JWT_AUDIENCE_TTLS.
+func tokenLifetimes(cfg config.JWTConfig) (auth.Lifetimes, error) {
+	scopes, err := auth.ParseLifetimes(cfg.ScopeTTLs)
+	if err != nil {
+		return auth.Lifetimes{}, fmt.Errorf("JWT_SCOPE_TTLS: %w", err)
+	}
+	// A typo would silently give the tokens the default lifetime.
+	for scope := range scopes {
+		if !auth.KnownScope(scope) {
+			return auth.Lifetimes{}, fmt.Errorf("JWT_SCOPE_TTLS: unknown scope %q", scope)
+		}
+	}
+	audiences, err := auth.ParseLifetimes(cfg.AudienceTTLs)
+	if err != nil {
+		return auth.Lifetimes{}, fmt.Errorf("JWT_AUDIENCE_TTLS: %w", err)
+	}
+	return auth.Lifetimes{Scopes: scopes, Audiences: audiences}, nil
+}
+
+// sessionMaxLifetime is the cap on sessions' lifetimes: the refresh
+// token duration when sessions don't slide, JWT_SESSION_MAX_LIFETIME
+// otherwise.
+func sessionMaxLifetime(cfg config.JWTConfig) time.Duration {
+	if !cfg.SlidingSessions {
+		return cfg.RefreshTokenDuration
+	}
+	return cfg.SessionMaxLifetime
+}
+
+// newBinder builds the token Binder for JWT_BINDING.
+func newBinder(cfg config.JWTConfig) (*auth.Binder, error) {
+	key := cfg.BindingKey
+	if key == "" {
+		key = cfg.Secret
+	}
+	return auth.NewBinder(cfg.Binding, []byte(key),
+		auth.WithIPPrefixes(cfg.BindingIPv4Prefix, cfg.BindingIPv6Prefix),
+		auth.WithDeviceHeader(cfg.BindingHeader),
+		auth.WithBindingCookie(cfg.BindingCookie))
+}
+
+// newEncrypter builds the token Encrypter for JWT_ENCRYPTION_KEY, which
+// encrypts, and JWT_ENCRYPTION_OLD_KEYS, which only decrypt.
+func newEncrypter(cfg config.JWTConfig) (*auth.Encrypter, error) {
+	var keys [][]byte
+	for _, encoded := range append([]string{cfg.EncryptionKey}, cfg.OldEncryptionKeys...) {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("decoding key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	var opts []auth.EncrypterOption
+	if cfg.EncryptionRequired {
+		opts = append(opts, auth.RequireEncryption())
+	}
+	if len(cfg.EncryptedClaims) > 0 {
+		opts = append(opts, auth.EncryptClaims(cfg.EncryptedClaims...))
+	}
+	return auth.NewEncrypter(keys, opts...)
+}
+
+// loadKeysFile reads a JSON rotation schedule (see keySpec).
+func loadKeysFile(path string) ([]auth.Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading keys file: %w", err)
+	}
+
+	var specs []keySpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		return nil, fmt.Errorf("parsing keys file: %w", err)
+	}
+	if len(specs) == 0 {
+		return nil, errors.New("keys file contains no keys")
+	}
+
+	keys := make([]auth.Key, 0, len(specs))
+	seen := make(map[string]bool, len(specs))
+	for _, spec := range specs {
+		// Key IDs are how validators pick a key, so they must be unique.
+		if spec.ID == "" {
+			return nil, errors.New("every key in the keys file needs an id")
+		}
+		if seen[spec.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", spec.ID)
+		}
+		seen[spec.ID] = true
+
+		var key auth.Key
+		if spec.Algorithm == "" || spec.Algorithm == "HS256" {
+			if spec.Secret == "" {
+				return nil, fmt.Errorf("key %q: HS256 requires a secret", spec.ID)
+			}
+			key = auth.NewHMACKey(spec.Secret)
+		} else {
+			key, err = parseKey(spec.Algorithm, spec.PrivateKey, spec.PrivateKeyFile, spec.PublicKey, spec.PublicKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("key %q: %w", spec.ID, err)
+			}
+		}
+
+		key.ID = spec.ID
+		key.ActiveFrom = spec.ActiveFrom
+		key.ExpiresAt = spec.ExpiresAt
+		keys = append(keys, key)
+	}
+
+	log.Printf("JWT: loaded %d keys from %s", len(keys), path)
+	return keys, nil
+}
+
+// parseKey loads an asymmetric key from PEM values or files.
+func parseKey(algorithm, privateKey, privateKeyFile, publicKey, publicKeyFile string) (auth.Key, error) {
+	privatePEM, err := readPEM(privateKey, privateKeyFile)
+	if err != nil {
+		return auth.Key{}, fmt.Errorf("reading private key: %w", err)
+	}
+	publicPEM, err := readPEM(publicKey, publicKeyFile)
+	if err != nil {
+		return auth.Key{}, fmt.Errorf("reading public key: %w", err)
+	}
+	return auth.ParseKey(algorithm, privatePEM, publicPEM)
+}
+
+// readPEM returns PEM data from a file if path is set, otherwise from value.
+func readPEM(value, path string) ([]byte, error) {
+	if path != "" {
+		return os.ReadFile(path)
+	}
+	return []byte(value), nil
+}
+
+// logAuthEvent logs authentication events as "event:" lines.
+//
+// A failed login's email isn't logged: it's whatever the client typed,
+// which is sometimes the password, in the wrong field.
+func logAuthEvent(_ context.Context, event auth.Event) {
+	switch e := event.(type) {
+	case auth.LoginSucceeded:
+		log.Printf("event: auth.%s user_id=%d method=%s ip=%s", e.EventName(), e.UserID, e.Method, e.IPAddress)
+	case auth.LoginFailed:
+		log.Printf("event: auth.%s method=%s reason=%s ip=%s", e.EventName(), e.Method, e.Reason, e.IPAddress)
+	case auth.TokenRevoked:
+		log.Printf("event: auth.%s user_id=%d session_id=%d reason=%s", e.EventName(), e.UserID, e.SessionID, e.Reason)
+	}
+}
+
+// auditRecoveryLogins records logins with a two-factor recovery code in
+// the security audit category, with the rest of the account's 2FA
+// changes (see user.MFA).
+func auditRecoveryLogins(auditLog *audit.Logger) auth.EventHookFunc {
+	return func(ctx context.Context, event auth.Event) {
+		if e, ok := event.(auth.LoginSucceeded); ok && e.Method == auth.MethodRecoveryCode {
+			auditLog.Record(ctx, audit.CategorySecurity, fmt.Sprintf("user %d", e.UserID),
+				"signed in with a two-factor recovery code from %s", e.IPAddress)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// shutdownGrace is how long checkShutdown gives goroutines to exit after
+// Close: some stop asynchronously (a connection's reader notices the
+// socket closed), and that's not a leak.
+const shutdownGrace = 2 * time.Second
+
+// goroutineSnapshot is the set of goroutines running at one moment, by ID.
+type goroutineSnapshot map[string]string // ID -> stack
+
+// takeGoroutineSnapshot records every running goroutine.
+//
+// WHY NOT goleak?
+// The tests do use it: the packages that start goroutines (jobs,
+// ratelimit, usercache, the HTTP coalescer) check with
+// goleak.VerifyTestMain. This does the same (compare runtime.Stack
+// before and after), but goleak is built around *testing.T, and the
+// self-test runs in production binaries, against real dependencies.
+func takeGoroutineSnapshot() goroutineSnapshot {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	snap := make(goroutineSnapshot)
+	// Stacks are separated by a blank line, and each starts with
+	// "goroutine 42 [chan receive]:".
+	for _, stack := range bytes.Split(buf, []byte("\n\n")) {
+		header, _, _ := strings.Cut(string(stack), "\n")
+		fields := strings.Fields(header)
+		if len(fields) < 2 || fields[0] != "goroutine" {
+			continue
+		}
+		snap[fields[1]] = string(stack)
+	}
+	return snap
+}
+
+// startedSince returns the stacks of goroutines in s that weren't in
+// before.
+func (s goroutineSnapshot) startedSince(before goroutineSnapshot) []string {
+	var stacks []string
+	for id, stack := range s {
+		if _, ok := before[id]; !ok {
+			stacks = append(stacks, stack)
+		}
+	}
+	return stacks
+}
+
+// checkShutdown closes a and checks that it let go of everything it
+// held. before is the snapshot taken before newApplication; anything
+// started since then must be gone after Close.
+//
+// It checks:
+//   - no database connection is still in use once requests are done: a
+//     *sql.Rows that wasn't closed, or a transaction never committed or
+//     rolled back, holds one until the process exits
+//   - every pool closed its connections
+//   - every goroutine started by the application or its requests
+//     exited: workers, schedulers, sinks, Redis and HTTP clients
+//
+// A subsystem added without a way to stop it fails here, in the
+// self-test, instead of slowly leaking in production.
+func (a *application) checkShutdown(before goroutineSnapshot) error {
+	var problems []error
+	for i, db := range a.pools {
+		if inUse := db.Stats().InUse; inUse > 0 {
+			problems = append(problems, fmt.Errorf("database pool %d: %d connection(s) still in use after every request finished (unclosed rows or transaction?)", i+1, inUse))
+		}
+	}
+
+	if err := a.Close(); err != nil {
+		problems = append(problems, fmt.Errorf("closing: %w", err))
+	}
+	for i, db := range a.pools {
+		if open := db.Stats().OpenConnections; open > 0 {
+			problems = append(problems, fmt.Errorf("database pool %d: %d connection(s) open after Close", i+1, open))
+		}
+	}
+
+	deadline := time.Now().Add(shutdownGrace)
+	leaked := takeGoroutineSnapshot().startedSince(before)
+	for len(leaked) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+		leaked = takeGoroutineSnapshot().startedSince(before)
+	}
+	for _, stack := range leaked {
+		problems = append(problems, fmt.Errorf("goroutine still running after Close:\n%s", stack))
+	}
+	return errors.Join(problems...)
+}
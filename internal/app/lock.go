@@ -0,0 +1,39 @@
+package app
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/lock"
+	"go-basics/internal/metrics"
+)
+
+// newLockManager builds the locks that keep singleton jobs (purges,
+// backups, relays) to one instance at a time.
+//
+// MySQL is the default because every deployment has it; Redis is there
+// for deployments that run it anyway and would rather not hold a database
+// connection per running job.
+func (a *application) newLockManager(cfg config.LockConfig, db *sql.DB, reg *metrics.Registry) (*lock.Manager, error) {
+	var locker lock.Locker
+	switch cfg.Backend {
+	case "mysql":
+		locker = lock.NewMySQLLocker(db)
+	case "redis":
+		if len(cfg.RedisAddrs) == 0 {
+			return nil, fmt.Errorf("LOCK_BACKEND=redis needs LOCK_REDIS_ADDR")
+		}
+		client := a.newRedisClient(cfg.RedisAddrs, cfg.RedisPassword)
+		locker = lock.NewRedisLocker(client, "lock:")
+		log.Printf("Job locks held in Redis at %s", strings.Join(cfg.RedisAddrs, ","))
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q (want mysql or redis)", cfg.Backend)
+	}
+	if cfg.TTL <= 0 {
+		return nil, fmt.Errorf("LOCK_TTL must be positive")
+	}
+	return lock.NewManager(locker, cfg.TTL, reg), nil
+}
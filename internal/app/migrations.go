@@ -0,0 +1,59 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	userRepo "go-basics/internal/repository/mysql"
+	"go-basics/migrations"
+)
+
+// WriteSchemaManifest writes this build's schema manifest as JSON:
+// the newest migration it ships and every column the code uses.
+//
+// Save the output for each release; LintMigrations compares the next
+// release's migrations against it.
+func WriteSchemaManifest(w io.Writer) error {
+	manifest, err := userRepo.CurrentManifest(migrations.FS)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
+
+// LintMigrations checks the migrations newer than the manifest at
+// previousPath for changes that would break that release during a
+// blue/green deploy (see userRepo.LintMigrations). Findings are written
+// to w; the error is non-nil if any of them is an error, not a warning.
+func LintMigrations(previousPath string, w io.Writer) error {
+	data, err := os.ReadFile(previousPath)
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+	var previous userRepo.SchemaManifest
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("parsing manifest %s: %w", previousPath, err)
+	}
+
+	findings, err := userRepo.LintMigrations(migrations.FS, previous)
+	if err != nil {
+		return err
+	}
+
+	errorCount := 0
+	for _, f := range findings {
+		fmt.Fprintln(w, f)
+		if f.Severity == userRepo.LintError {
+			errorCount++
+		}
+	}
+	if errorCount > 0 {
+		return fmt.Errorf("%d incompatible change(s) would break the release at version %d", errorCount, previous.MigrationVersion)
+	}
+	fmt.Fprintf(w, "migrations are compatible with the release at version %d (%d warning(s))\n", previous.MigrationVersion, len(findings))
+	return nil
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/auth"
+)
+
+// newClientCertAuth returns the auth middleware options for MTLS_SERVICES,
+// and adds the MTLS_ROUTES policies to policies. Like SLO_ROUTES, a
+// malformed entry fails startup: a typo mustn't quietly leave a route
+// open to the wrong callers.
+func newClientCertAuth(cfg config.MTLSConfig, policies map[string]auth.Policy) ([]auth.MiddlewareOption, error) {
+	services := make(map[string][]string, len(cfg.Services))
+	for _, spec := range cfg.Services {
+		rule, scopes, err := auth.ParseServiceSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := services[rule]; dup {
+			return nil, fmt.Errorf("MTLS_SERVICES lists %q twice", rule)
+		}
+		services[rule] = scopes
+	}
+	certs, err := auth.NewCertMapper(services)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := []auth.Policy{auth.PolicyJWT}
+	if cfg.Enabled() {
+		allowed = append(allowed, auth.PolicyMTLS, auth.PolicyMTLSOrJWT, auth.PolicyMTLSAndJWT)
+	}
+	if err := parseRoutePolicies("MTLS_ROUTES", cfg.Routes, policies, allowed); err != nil {
+		return nil, err
+	}
+	return []auth.MiddlewareOption{auth.WithClientCerts(certs)}, nil
+}
+
+// parseRoutePolicies adds the "<METHOD /path>=<policy>" entries of the
+// variable env to policies, which other variables' entries may already
+// be in. A policy outside allowed - one of another variable's, or one
+// whose credentials aren't configured - is an error, as is a route given
+// twice.
+func parseRoutePolicies(env string, specs []string, policies map[string]auth.Policy, allowed []auth.Policy) error {
+	for _, spec := range specs {
+		// Patterns have no "=", so the last one splits.
+		i := strings.LastIndex(spec, "=")
+		if i <= 0 || !strings.Contains(spec[:i], " /") {
+			return fmt.Errorf("%s entry %q must be <METHOD /path>=<policy>", env, spec)
+		}
+		pattern := spec[:i]
+		policy, err := auth.ParsePolicy(spec[i+1:])
+		if err != nil {
+			return fmt.Errorf("%s entry %q: %w", env, spec, err)
+		}
+		if !slices.Contains(allowed, policy) {
+			return fmt.Errorf("%s entry %q: policy must be one of %v, with its credentials configured", env, spec, allowed)
+		}
+		if _, dup := policies[pattern]; dup {
+			return fmt.Errorf("%s: %q already has a policy", env, pattern)
+		}
+		policies[pattern] = policy
+	}
+	return nil
+}
+
+// requestClientCerts makes the TLS handshake ask for client certificates
+// (MTLS_CLIENT_AUTH) and verify them against MTLS_CLIENT_CA_FILE.
+// tlsConfig is nil without SERVER_TLS_CERT_FILE.
+func requestClientCerts(cfg config.MTLSConfig, tlsConfig *tls.Config) error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if tlsConfig == nil {
+		return errors.New("MTLS_CLIENT_AUTH needs SERVER_TLS_CERT_FILE and SERVER_TLS_KEY_FILE")
+	}
+
+	switch cfg.ClientAuth {
+	case "request":
+		// Verified if sent; browsers send none and use tokens.
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "require":
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return fmt.Errorf("MTLS_CLIENT_AUTH must be off, request, or require, got %q", cfg.ClientAuth)
+	}
+
+	if cfg.ClientCAFile == "" {
+		// Without it Go would verify against the system roots: any
+		// public CA could then vouch for "cn:billing".
+		return errors.New("MTLS_CLIENT_AUTH needs MTLS_CLIENT_CA_FILE")
+	}
+	bundle, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return fmt.Errorf("reading client CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return fmt.Errorf("no certificates in %s", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	return nil
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/domain/notification"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/jobs"
+	userRepo "go-basics/internal/repository/mysql"
+	"go-basics/internal/webpush"
+)
+
+// Job kinds for notifications.
+const (
+	// sendDigestJob sends one user's notification digest.
+	sendDigestJob = "notification.digest"
+
+	// sendPushJob pushes one notification to one browser.
+	sendPushJob = "notification.push"
+)
+
+// digestPayload is the payload of a sendDigestJob.
+type digestPayload struct {
+	UserID uint64 `json:"user_id"`
+}
+
+// pushPayload is the payload of a sendPushJob. The subscription is
+// referenced, not copied, so its keys stay out of job_spool.
+type pushPayload struct {
+	SubscriptionID uint64 `json:"subscription_id"`
+	UserID         uint64 `json:"user_id"`
+	Kind           string `json:"kind"`
+	Subject        string `json:"subject"`
+	Body           string `json:"body"`
+	High           bool   `json:"high"`
+}
+
+// pushMessage is what a subscribed browser's service worker receives,
+// to show with showNotification(title, {body}).
+type pushMessage struct {
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	Body  string `json:"body"`
+}
+
+// newNotifications builds the notification service, with digests
+// scheduled on scheduler and sent by queue. With web push configured it
+// also returns the sender, whose public key browsers subscribe with;
+// otherwise the sender is nil.
+func newNotifications(cfg config.NotifyConfig, pushCfg config.WebPushConfig, db *sql.DB, users *user.Service, queue *jobs.Queue, scheduler *jobs.Scheduler) (*notification.Service, *webpush.Sender, error) {
+	freq, err := notification.ParseFrequency(cfg.DefaultFrequency)
+	if err != nil {
+		return nil, nil, fmt.Errorf("NOTIFY_DEFAULT_FREQUENCY must be one of %v", notification.Frequencies)
+	}
+
+	var opts []notification.Option
+	var sender *webpush.Sender
+	subscriptions := userRepo.NewPushSubscriptionRepository(db)
+	if pushCfg.Enabled() {
+		sender, err = webpush.NewSender(pushCfg.VAPIDPrivateKey, pushCfg.Subject)
+		if err != nil {
+			return nil, nil, fmt.Errorf("web push: %w", err)
+		}
+		opts = append(opts, notification.WithPush(subscriptions, queuedPusher{queue: queue}, pushCfg.AllowedHosts))
+		queue.Handle(sendPushJob, pushHandler(sender, subscriptions, pushCfg.TTL))
+	}
+
+	emails := func(ctx context.Context, userID uint64) (string, error) {
+		u, err := users.GetByID(ctx, userID)
+		if errors.Is(err, user.ErrNotFound) {
+			return "", nil
+		}
+		if err != nil {
+			return "", err
+		}
+		return u.Email, nil
+	}
+	service := notification.NewService(userRepo.NewNotificationRepository(db), emails,
+		queuedMailer{queue: queue}, jobDigests{scheduler: scheduler}, freq, opts...)
+
+	queue.Handle(sendDigestJob, func(ctx context.Context, payload []byte) error {
+		var p digestPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("decoding digest: %w", err)
+		}
+		return service.SendDigest(ctx, p.UserID)
+	})
+	return service, sender, nil
+}
+
+// jobDigests is a notification.DigestScheduler on the job scheduler.
+// The unique key allows one pending digest per user: while it waits,
+// more notifications join it instead of scheduling their own.
+type jobDigests struct {
+	scheduler *jobs.Scheduler
+}
+
+// ScheduleDigest implements notification.DigestScheduler.
+func (d jobDigests) ScheduleDigest(ctx context.Context, userID uint64, after time.Duration) error {
+	_, err := d.scheduler.After(ctx, sendDigestJob, digestPayload{UserID: userID}, after,
+		jobs.Unique(fmt.Sprintf("notification-digest:user:%d", userID)))
+	if errors.Is(err, jobs.ErrDuplicateSchedule) {
+		return nil
+	}
+	return err
+}
+
+// queuedPusher is a notification.Pusher that hands each push to the job
+// queue, so a slow or failing push service is retried in the background
+// instead of holding up the request that caused the notification.
+type queuedPusher struct {
+	queue *jobs.Queue
+}
+
+// Push implements notification.Pusher.
+func (p queuedPusher) Push(_ context.Context, sub notification.PushSubscription, n notification.Notification) error {
+	return p.queue.Enqueue(sendPushJob, pushPayload{
+		SubscriptionID: sub.ID,
+		UserID:         n.UserID,
+		Kind:           n.Kind,
+		Subject:        n.Subject,
+		Body:           n.Body,
+		High:           n.Priority == notification.PriorityHigh,
+	})
+}
+
+// pushHandler runs sendPushJobs: it encrypts the notification for the
+// subscription and posts it to the browser's push service.
+func pushHandler(sender *webpush.Sender, subscriptions notification.SubscriptionRepository, ttl time.Duration) jobs.HandlerFunc {
+	return func(ctx context.Context, payload []byte) error {
+		var p pushPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return fmt.Errorf("decoding push: %w", err)
+		}
+
+		sub, err := subscriptions.Subscription(ctx, p.SubscriptionID)
+		if errors.Is(err, notification.ErrSubscriptionNotFound) {
+			// Unsubscribed while the push waited.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if sub.UserID != p.UserID {
+			// The browser was re-subscribed by someone else since: this
+			// notification isn't theirs to see.
+			return nil
+		}
+
+		data, err := json.Marshal(pushMessage{Kind: p.Kind, Title: p.Subject, Body: p.Body})
+		if err != nil {
+			return fmt.Errorf("encoding push: %w", err)
+		}
+		msg := webpush.Message{Payload: data, TTL: ttl, Urgency: webpush.UrgencyNormal}
+		if p.High {
+			msg.Urgency = webpush.UrgencyHigh
+		}
+
+		err = sender.Send(ctx, webpush.Subscription{Endpoint: sub.Endpoint, P256dh: sub.P256dh, Auth: sub.Auth}, msg)
+		if errors.Is(err, webpush.ErrGone) {
+			// The browser unsubscribed or was uninstalled; it will never
+			// accept a push again.
+			err = subscriptions.DeleteSubscription(ctx, sub.UserID, sub.ID)
+			if errors.Is(err, notification.ErrSubscriptionNotFound) {
+				return nil
+			}
+			return err
+		}
+		return err
+	}
+}
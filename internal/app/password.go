@@ -0,0 +1,52 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"go-basics/config"
+	"go-basics/internal/domain/user"
+)
+
+// newPasswordHasher builds the configured hasher. The algorithm not
+// chosen stays available for verifying, so switching either way never
+// locks anyone out. Hashing runs on at most cfg.Workers goroutines at a
+// time (see user.NewBoundedHasher).
+func newPasswordHasher(cfg config.PasswordConfig) (user.PasswordHasher, error) {
+	if cfg.Argon2Memory < 8*config.Size(cfg.Argon2Parallelism)*1024 || cfg.Argon2Iterations < 1 || cfg.Argon2Parallelism < 1 || cfg.Argon2Parallelism > 255 {
+		return nil, fmt.Errorf("invalid Argon2id parameters: memory %v, iterations %d, parallelism %d", cfg.Argon2Memory, cfg.Argon2Iterations, cfg.Argon2Parallelism)
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("invalid bcrypt cost %d (want %d-%d)", cfg.BcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	workers := cfg.Workers
+	if workers < 0 {
+		return nil, fmt.Errorf("invalid password hash workers %d", workers)
+	}
+	if workers == 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	argon2id := user.NewArgon2idHasher(user.Argon2idParams{
+		Memory:      uint32(cfg.Argon2Memory / 1024),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+	})
+	bcryptHasher := user.NewBcryptHasher(cfg.BcryptCost)
+
+	var hasher user.PasswordHasher
+	switch cfg.Algorithm {
+	case "argon2id":
+		hasher = user.NewMigratingHasher(argon2id, bcryptHasher)
+	case "bcrypt":
+		hasher = user.NewMigratingHasher(bcryptHasher, argon2id)
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q (want argon2id or bcrypt)", cfg.Algorithm)
+	}
+
+	log.Printf("Password hashing: %s, at most %d at a time", cfg.Algorithm, workers)
+	return user.NewBoundedHasher(hasher, workers), nil
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	userRepo "go-basics/internal/repository/mysql"
+)
+
+// schemaCheck is one database plus the tables it must contain.
+type schemaCheck struct {
+	name   string // used in diff lines, e.g. "main" or "shard 2"
+	db     *sql.DB
+	tables []string
+}
+
+// readiness answers GET /ready.
+//
+// HEALTH vs READINESS:
+//   - /health (liveness): "is the process running?" If not, restart it.
+//   - /ready (readiness): "can it serve traffic?" If not, stop sending
+//     requests to it, but don't restart it - restarting won't fix a
+//     missing migration.
+type readiness struct {
+	db         *sql.DB
+	schemaDiff []string // Schema drift found at startup; empty = OK
+}
+
+// newReadiness validates the schema of every database at startup.
+// Drift is logged and makes /ready fail; the server still starts so
+// operators can inspect the diff through the endpoint.
+func newReadiness(ctx context.Context, db *sql.DB, checks []schemaCheck) (*readiness, error) {
+	r := &readiness{db: db}
+
+	for _, check := range checks {
+		diffs, err := userRepo.ValidateSchema(ctx, check.db, check.tables...)
+		if err != nil {
+			return nil, fmt.Errorf("validating %s schema: %w", check.name, err)
+		}
+		for _, d := range diffs {
+			r.schemaDiff = append(r.schemaDiff, check.name+": "+d)
+		}
+	}
+
+	if len(r.schemaDiff) > 0 {
+		log.Printf("Schema drift detected, /ready will fail:\n  %s", strings.Join(r.schemaDiff, "\n  "))
+	} else {
+		log.Println("Database schema validated")
+	}
+	return r, nil
+}
+
+// ServeHTTP reports 200 when the database is reachable and the schema
+// matches, 503 with the reasons otherwise.
+func (rd *readiness) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var problems []string
+	problems = append(problems, rd.schemaDiff...)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+	defer cancel()
+	if err := rd.db.PingContext(ctx); err != nil {
+		problems = append(problems, "database unreachable: "+err.Error())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "not ready", "problems": problems})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"status": "ready"})
+}
@@ -0,0 +1,45 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	userHandler "go-basics/internal/handler/http"
+)
+
+// WriteResponseManifest writes the shape of this build's v1 responses
+// as JSON.
+//
+// Save the output for each release; LintResponses compares the next
+// release's responses against it.
+func WriteResponseManifest(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(userHandler.CurrentResponseManifest())
+}
+
+// LintResponses checks this build's v1 responses against the manifest at
+// previousPath, and fails if a field clients may parse was removed,
+// renamed, or retyped (see userHandler.LintResponses).
+func LintResponses(previousPath string, w io.Writer) error {
+	data, err := os.ReadFile(previousPath)
+	if err != nil {
+		return fmt.Errorf("reading manifest: %w", err)
+	}
+	var previous userHandler.ResponseManifest
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("parsing manifest %s: %w", previousPath, err)
+	}
+
+	problems := userHandler.LintResponses(previous, userHandler.CurrentResponseManifest())
+	for _, p := range problems {
+		fmt.Fprintln(w, p)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d change(s) would break %s clients", len(problems), previous.Version)
+	}
+	fmt.Fprintf(w, "responses are compatible with the previous %s release\n", previous.Version)
+	return nil
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/risk"
+)
+
+// guessReasons are the LoginFailed reasons that count toward the
+// failed-attempts signal: wrong secrets. A missing CAPTCHA or a
+// malformed body says nothing about who's guessing.
+var guessReasons = map[string]bool{
+	"invalid_credentials":   true,
+	"invalid_mfa_code":      true,
+	"invalid_recovery_code": true,
+}
+
+// countLoginFailures feeds failed logins to failures.
+func countLoginFailures(failures *risk.Failures) auth.EventHookFunc {
+	return func(_ context.Context, event auth.Event) {
+		if e, ok := event.(auth.LoginFailed); ok && guessReasons[e.Reason] {
+			failures.Add(e.Email)
+		}
+	}
+}
+
+// newRiskAssessor builds the login risk assessor, or returns nil when
+// RISK_POLICY is empty. Every decision is recorded on auditLog.
+func newRiskAssessor(cfg config.RiskConfig, captchaEnabled bool, failures *risk.Failures, users user.Repository, emails user.EmailNormalizer, sessions *user.Sessions, countries risk.CountryStore, auditLog *audit.Logger) (*risk.Assessor, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	policy, err := risk.ParsePolicy(cfg.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("RISK_POLICY: %w", err)
+	}
+	// Asking for a CAPTCHA nobody can check would block those logins.
+	if policy.Takes(risk.ActionCaptcha) && !captchaEnabled {
+		return nil, fmt.Errorf("RISK_POLICY: captcha needs CAPTCHA_PROVIDER")
+	}
+	weights, err := risk.ParseWeights(cfg.Weights)
+	if err != nil {
+		return nil, fmt.Errorf("RISK_WEIGHTS: %w", err)
+	}
+
+	opts := []risk.Option{risk.WithScorer(weights), risk.WithDisposableDomains(cfg.DisposableDomains...)}
+	if cfg.CountryHeader != "" {
+		opts = append(opts, risk.WithLocator(risk.HeaderLocator(cfg.CountryHeader)))
+	}
+	history := loginHistory{users: users, emails: emails, sessions: sessions, countries: countries}
+	return risk.New(policy, history, failures, func(ctx context.Context, d risk.Decision) {
+		actor := "unknown account"
+		if d.UserID != 0 {
+			actor = fmt.Sprintf("user %d", d.UserID)
+		}
+		signals := strings.Join(d.Signals.Names(), ", ")
+		if signals == "" {
+			signals = "no signals"
+		}
+		country := d.Attempt.Country
+		if country == "" {
+			country = "unknown country"
+		}
+		auditLog.Record(ctx, audit.CategorySecurity, actor, "login from %s (%s) scored %d (%s): %s",
+			d.Attempt.IPAddress, country, d.Score, signals, d.Action)
+	}, opts...), nil
+}
+
+// loginHistory implements risk.History from the users, their sessions,
+// and the countries they signed in from.
+type loginHistory struct {
+	users     user.Repository
+	emails    user.EmailNormalizer
+	sessions  *user.Sessions
+	countries risk.CountryStore
+}
+
+// Profile implements risk.History.
+func (h loginHistory) Profile(ctx context.Context, email, userAgent string) (risk.Profile, error) {
+	// email is whatever the login named the account by, maybe a username.
+	u, err := user.FindByLogin(ctx, h.users, h.emails, email, user.WithFields(user.FieldID))
+	if err != nil {
+		return risk.Profile{}, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return risk.Profile{}, nil
+	}
+
+	known, err := h.sessions.KnownDevice(ctx, u.ID, userAgent)
+	if err != nil {
+		return risk.Profile{}, err
+	}
+	countries, err := h.countries.Countries(ctx, u.ID)
+	if err != nil {
+		return risk.Profile{}, err
+	}
+	return risk.Profile{UserID: u.ID, KnownDevice: known, Countries: countries}, nil
+}
+
+// RecordCountry implements risk.History.
+func (h loginHistory) RecordCountry(ctx context.Context, userID uint64, country string) error {
+	return h.countries.RecordCountry(ctx, userID, country)
+}
@@ -0,0 +1,172 @@
+package app
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"go-basics/config"
+	"go-basics/internal/auth"
+	"go-basics/internal/secrets"
+)
+
+// readSecretFiles replaces JWT_SECRET and SIGNING_SECRETS with the
+// contents of JWT_SECRET_FILE and SIGNING_SECRETS_FILE, if set, before
+// anything is built from them. Changes after startup are picked up by
+// the watchers registered in watchJWTKeys and newRequestSigning.
+func readSecretFiles(cfg *config.Config) error {
+	if cfg.JWT.SecretFile != "" {
+		secret, err := secrets.ReadFile(cfg.JWT.SecretFile)
+		if err != nil {
+			return fmt.Errorf("JWT_SECRET_FILE: %w", err)
+		}
+		cfg.JWT.Secret = secret
+	}
+	if cfg.Signing.SecretsFile != "" {
+		pairs, err := readSigningSecrets(cfg.Signing.SecretsFile)
+		if err != nil {
+			return err
+		}
+		cfg.Signing.Secrets = pairs
+	}
+	return nil
+}
+
+// readSigningSecrets reads the keyID=secret pairs of
+// SIGNING_SECRETS_FILE, one per line or comma-separated like
+// SIGNING_SECRETS. Blank lines are skipped.
+func readSigningSecrets(path string) ([]string, error) {
+	contents, err := secrets.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("SIGNING_SECRETS_FILE: %w", err)
+	}
+	var pairs []string
+	for _, field := range strings.FieldsFunc(contents, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if pair := strings.TrimSpace(field); pair != "" {
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// newDBCredentials reads DB_USER_FILE and DB_PASSWORD_FILE. It returns
+// nil when they aren't set, and the DSNs' own credentials are used.
+func newDBCredentials(cfg config.DatabaseConfig) (*secrets.DBCredentials, error) {
+	if cfg.PasswordFile == "" {
+		if cfg.UserFile != "" {
+			return nil, fmt.Errorf("DB_USER_FILE needs DB_PASSWORD_FILE")
+		}
+		return nil, nil
+	}
+	creds, err := secrets.NewDBCredentials(cfg.UserFile, cfg.PasswordFile)
+	if err != nil {
+		return nil, fmt.Errorf("DB_PASSWORD_FILE: %w", err)
+	}
+	return creds, nil
+}
+
+// credentialsConnector returns a connector for dsn that logs in with
+// creds instead of the DSN's user and password, and replaces its
+// connections when they change (see secrets.DBCredentials).
+func credentialsConnector(dsn string, creds *secrets.DBCredentials) (driver.Connector, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Apply(creds.Option()); err != nil {
+		return nil, err
+	}
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return creds.Connector(connector), nil
+}
+
+// watchJWTKeys rotates the JWT signing key when its files change:
+// JWT_KEYS_FILE replaces the whole schedule, as at startup, while a
+// change to JWT_SECRET_FILE or the key pair files makes the new key sign
+// and keeps the old one verifying until its tokens expire (see
+// auth.JWTManager.RotateKey).
+func (a *application) watchJWTKeys(cfg *config.Config, jwtManager *auth.JWTManager) error {
+	if cfg.JWT.KeysFile != "" {
+		return a.secrets.Watch("jwt", secrets.ReloaderFunc(func(context.Context) error {
+			keys, err := loadKeysFile(cfg.JWT.KeysFile)
+			if err != nil {
+				return err
+			}
+			jwtManager.SetKeys(keys...)
+			return nil
+		}), cfg.JWT.KeysFile)
+	}
+
+	overlap, err := longestTokenLifetime(cfg)
+	if err != nil {
+		return err
+	}
+	if cfg.JWT.Algorithm == "" || cfg.JWT.Algorithm == "HS256" {
+		if cfg.JWT.SecretFile == "" {
+			return nil
+		}
+		return a.secrets.Watch("jwt", secrets.ReloaderFunc(func(context.Context) error {
+			secret, err := secrets.ReadFile(cfg.JWT.SecretFile)
+			if err != nil {
+				return err
+			}
+			jwtManager.RotateKey(auth.NewHMACKey(secret), overlap)
+			return nil
+		}), cfg.JWT.SecretFile)
+	}
+
+	var files []string
+	for _, file := range []string{cfg.JWT.PrivateKeyFile, cfg.JWT.PublicKeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return a.secrets.Watch("jwt", secrets.ReloaderFunc(func(context.Context) error {
+		key, err := parseKey(cfg.JWT.Algorithm, cfg.JWT.PrivateKey, cfg.JWT.PrivateKeyFile, cfg.JWT.PublicKey, cfg.JWT.PublicKeyFile)
+		if err != nil {
+			return err
+		}
+		jwtManager.RotateKey(key, overlap)
+		return nil
+	}), files...)
+}
+
+// longestTokenLifetime is how long a token signed now may stay valid:
+// the longest of the access token duration, the per-scope and
+// per-audience lifetimes, and impersonation tokens, plus the leeway.
+// A key rotated out keeps verifying for that long.
+func longestTokenLifetime(cfg *config.Config) (time.Duration, error) {
+	lifetimes, err := tokenLifetimes(cfg.JWT)
+	if err != nil {
+		return 0, err
+	}
+	longest := max(cfg.JWT.AccessTokenDuration, cfg.Admin.ImpersonationTTL)
+	for _, d := range lifetimes.Scopes {
+		longest = max(longest, d)
+	}
+	for _, d := range lifetimes.Audiences {
+		longest = max(longest, d)
+	}
+	return longest + cfg.JWT.Leeway, nil
+}
+
+// startSecretWatcher checks the watched secret files every
+// SECRETS_WATCH_INTERVAL until ctx is cancelled.
+func (a *application) startSecretWatcher(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || a.secrets.Len() == 0 {
+		return
+	}
+	log.Printf("Watching %d secrets for rotation (every %v)", a.secrets.Len(), interval)
+	go a.secrets.Run(ctx, interval)
+}
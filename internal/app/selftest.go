@@ -0,0 +1,164 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"go-basics/config"
+)
+
+// SelfTest builds the application exactly like Run does, then drives it
+// through a synthetic user journey without opening a port:
+//
+//	GET /health -> GET /ready -> POST /register -> POST /login
+//	-> GET /users/{id} -> DELETE /users/{id} -> GET /users/{id} (404)
+//
+// and then shuts it down, checking that nothing leaked: no database
+// connection left in use, no pool left open, no goroutine left running
+// (see checkShutdown).
+//
+// It returns an error describing the first step that failed, so
+// `go-basics selftest` can gate a deployment on its exit code.
+//
+// WHERE DOES THE TEST USER LIVE?
+// There is no in-memory repository; the journey runs against the database
+// in DB_DSN. Point it at a sandbox database when you can. Each run registers
+// a unique throwaway address (selftest-<random>@example.com) and deletes it
+// at the end, which soft-deletes the row like any other account deletion.
+func SelfTest() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	// A script can't solve a CAPTCHA; that's the point of one.
+	cfg.Captcha.Provider = ""
+	// Nor should its login, from a device no session has seen, be scored.
+	cfg.Risk.Policy = nil
+
+	before := takeGoroutineSnapshot()
+	a, err := newApplication(cfg)
+	if err != nil {
+		return fmt.Errorf("building application: %w", err)
+	}
+	// Only for the early returns; checkShutdown closes it on success.
+	defer a.Close()
+
+	t := &selfTest{handler: a.handler}
+
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("generating test user: %w", err)
+	}
+	email := "selftest-" + hex.EncodeToString(suffix) + "@example.com"
+	password := hex.EncodeToString(suffix) + "-Selftest1!"
+
+	if _, err := t.do("health", http.MethodGet, "/health", "", nil, http.StatusOK); err != nil {
+		return err
+	}
+	if _, err := t.do("readiness", http.MethodGet, "/ready", "", nil, http.StatusOK); err != nil {
+		return err
+	}
+
+	credentials := map[string]string{"email": email, "password": password}
+	var created struct {
+		ID uint64 `json:"id"`
+	}
+	if err := t.doJSON("signup", http.MethodPost, "/register", "", credentials, http.StatusCreated, &created); err != nil {
+		return err
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := t.doJSON("login", http.MethodPost, "/login", "", credentials, http.StatusOK, &login); err != nil {
+		return err
+	}
+
+	userPath := fmt.Sprintf("/users/%d", created.ID)
+	var fetched struct {
+		Email string `json:"email"`
+	}
+	if err := t.doJSON("get", http.MethodGet, userPath, login.Token, nil, http.StatusOK, &fetched); err != nil {
+		return err
+	}
+	if fetched.Email != email {
+		return fmt.Errorf("selftest get: got email %q, want %q", fetched.Email, email)
+	}
+
+	if _, err := t.do("delete", http.MethodDelete, userPath, login.Token, nil, http.StatusNoContent); err != nil {
+		return err
+	}
+	if _, err := t.do("get after delete", http.MethodGet, userPath, login.Token, nil, http.StatusNotFound); err != nil {
+		return err
+	}
+
+	if err := a.checkShutdown(before); err != nil {
+		return fmt.Errorf("selftest shutdown: %w", err)
+	}
+	log.Printf("selftest: %-16s ok", "shutdown")
+
+	log.Printf("selftest: all checks passed")
+	return nil
+}
+
+// selfTest sends requests straight to the application's handler.
+//
+// WHY httptest IN NON-TEST CODE?
+// httptest.NewRecorder is just an in-memory http.ResponseWriter. Calling the
+// handler directly exercises the full middleware chain (auth, scopes, SLO
+// tracking) without binding a port that might clash with a running server.
+type selfTest struct {
+	handler http.Handler
+}
+
+// do sends one request and checks the status code.
+// body, when non-nil, is encoded as JSON.
+func (t *selfTest) do(step, method, path, token string, body interface{}, wantStatus int) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("selftest %s: encoding request: %w", step, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	start := time.Now()
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+
+	if rec.Code != wantStatus {
+		return nil, fmt.Errorf("selftest %s: %s %s returned %d, want %d: %s",
+			step, method, path, rec.Code, wantStatus, bytes.TrimSpace(rec.Body.Bytes()))
+	}
+	log.Printf("selftest: %-16s ok (%s %s, %v)", step, method, path, time.Since(start).Round(time.Millisecond))
+	return rec.Body.Bytes(), nil
+}
+
+// doJSON is do plus decoding the response body into out.
+func (t *selfTest) doJSON(step, method, path, token string, body interface{}, wantStatus int, out interface{}) error {
+	data, err := t.do(step, method, path, token, body, wantStatus)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("selftest %s: decoding response: %w", step, err)
+	}
+	return nil
+}
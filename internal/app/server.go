@@ -14,21 +14,48 @@
 package app
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
 
 	// Import MySQL driver
 	// The underscore (_) means we import for side effects only.
 	// The driver registers itself with database/sql when imported.
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/redis/go-redis/v9"
 
 	"go-basics/config"
+	"go-basics/internal/audit"
 	"go-basics/internal/auth"
+	"go-basics/internal/cache"
+	"go-basics/internal/domain/tenant"
 	"go-basics/internal/domain/user"
+	"go-basics/internal/encryption"
+	"go-basics/internal/failover"
 	userHandler "go-basics/internal/handler/http"
+	"go-basics/internal/jobs"
+	"go-basics/internal/leader"
+	"go-basics/internal/lock"
+	"go-basics/internal/mail"
+	"go-basics/internal/metrics"
+	"go-basics/internal/redirect"
 	userRepo "go-basics/internal/repository/mysql"
+	"go-basics/internal/risk"
+	"go-basics/internal/secrets"
+	"go-basics/internal/slo"
+	"go-basics/internal/sso"
+	"go-basics/internal/timing"
+	"go-basics/internal/usercache"
+	"go-basics/migrations"
 )
 
 // Run starts the application.
@@ -36,26 +63,284 @@ import (
 //
 // The function:
 // 1. Loads configuration
-// 2. Connects to the database
-// 3. Creates all dependencies
-// 4. Starts the HTTP server
+// 2. Builds the application (database, dependencies, routes)
+// 3. Starts the HTTP server and background work
+// 4. On SIGINT or SIGTERM, shuts down gracefully (see shutdown)
 func Run() error {
 	// Step 1: Load configuration
 	// Configuration is loaded from environment variables with defaults.
-	cfg := config.Load()
-	log.Println("Configuration loaded")
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("loading configuration: %w", err)
+	}
+	// Only non-default settings are listed, with secrets redacted.
+	log.Printf("Configuration loaded: %s", cfg)
 
-	// Step 2: Connect to database
-	db, err := openDB(cfg.Database)
+	// Step 2: Build the dependency graph
+	a, err := newApplication(cfg)
 	if err != nil {
-		return fmt.Errorf("connecting to database: %w", err)
+		return err
 	}
-	// defer ensures db.Close() is called when Run() returns.
-	// This is important for cleaning up database connections.
-	defer db.Close()
+	// defer ensures every database connection is closed when Run() returns.
+	defer func() {
+		if err := a.Close(); err != nil {
+			log.Printf("Shutting down: %v", err)
+		}
+	}()
+
+	// ctx is cancelled on SIGINT (Ctrl+C) or SIGTERM (docker stop,
+	// Kubernetes pod deletion); background loops stop with it.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Burn rates are recomputed in the background for the process lifetime.
+	go a.sloTracker.Run(ctx, time.Minute)
+
+	// The primary database is health-checked for failover (DB_STANDBY_DSN).
+	if a.failover != nil {
+		go a.failover.Run(ctx, cfg.Database.FailoverCheckInterval)
+	}
+
+	// Singleton subsystems run on whichever instance is elected leader.
+	// Cancelling ctx stops them and gives leadership up.
+	go a.leader.Run(ctx, a.leaderTasks...)
+
+	// Secrets mounted as files are reloaded when they're rotated.
+	a.startSecretWatcher(ctx, cfg.Secrets.WatchInterval)
+
+	// Cached users written by anyone else are dropped as the change
+	// feed reports them.
+	if a.userCache != nil {
+		go a.userCache.Follow(ctx, cfg.UserCache.FeedInterval, cfg.UserCache.FeedOverlap, a.userChanges...)
+	}
+
+	// Background workers pick up jobs saved by the last shutdown too.
+	if err := a.jobs.Start(ctx); err != nil {
+		return err
+	}
+
+	// Step 3: Configure and start HTTP server
+	// With a certificate the TCP port serves HTTPS, and HTTP/3 can run
+	// next to it on UDP (HTTP3_PORT). Both ask for client certificates
+	// when MTLS_CLIENT_AUTH says so.
+	var h3 *http3Listener
+	tlsConfig, err := loadServerTLS(cfg.Server)
+	if err == nil {
+		err = requestClientCerts(cfg.MTLS, tlsConfig)
+	}
+	if err == nil {
+		h3, err = listenHTTP3(cfg, tlsConfig, a.handler)
+	}
+	if err != nil {
+		a.shutdownJobs(cfg.Jobs.DrainTimeout)
+		return err
+	}
+	handler := a.handler
+	if h3 != nil {
+		handler = h3.advertise(handler, cfg.HTTP3.AltSvcMaxAge)
+	}
+
+	server := &http.Server{
+		Addr:      ":" + cfg.Server.Port,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+
+		// Timeouts prevent slow clients from holding connections.
+		// These are important for security and resource management.
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
+
+		// Bodies are capped by LimitBody (see newApplication).
+		MaxHeaderBytes: int(cfg.Server.MaxHeaderSize),
+	}
+
+	// ListenAndServe blocks until the server shuts down, so it runs in
+	// its own goroutine while this one waits for a signal.
+	// It returns an error if the server fails to start.
+	serveErr := make(chan error, 2)
+	if tlsConfig != nil {
+		log.Printf("HTTPS server listening on :%s", cfg.Server.Port)
+		// The certificate is already in TLSConfig.
+		go func() { serveErr <- server.ListenAndServeTLS("", "") }()
+	} else {
+		log.Printf("HTTP server listening on :%s", cfg.Server.Port)
+		go func() { serveErr <- server.ListenAndServe() }()
+	}
+	if h3 != nil {
+		log.Printf("HTTP/3 server listening on udp :%s, advertised on port %d", cfg.HTTP3.Port, h3.port)
+		go func() { serveErr <- h3.Serve() }()
+	}
+
+	select {
+	case err := <-serveErr:
+		// One listener failed; take the other down with it, since the
+		// orchestrator will restart the process.
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		server.Shutdown(ctx)
+		if h3 != nil {
+			h3.Shutdown(ctx)
+		}
+		a.shutdownJobs(cfg.Jobs.DrainTimeout)
+		return err
+	case <-ctx.Done():
+	}
+	return a.shutdown(server, h3, cfg)
+}
+
+// shutdown stops the server without dropping work in progress.
+//
+// THE ORDER MATTERS:
+//  1. Stop the HTTP servers (TCP, and HTTP/3 if it's on, side by side):
+//     no new requests, and in-flight ones get up to SERVER_SHUTDOWN_TIMEOUT
+//     to finish. Those requests may still queue jobs (a reset email), so
+//     the queue stays open until they're done.
+//  2. Drain the job queue: no new jobs, running ones get up to
+//     JOBS_DRAIN_TIMEOUT, and the rest are saved for the next start.
+//
+// The deferred Close in Run then closes the database pools, which the
+// queue needed until the end to save its jobs.
+func (a *application) shutdown(server *http.Server, h3 *http3Listener, cfg *config.Config) error {
+	log.Printf("Shutting down: waiting up to %v for in-flight requests", cfg.Server.ShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	h3Err := make(chan error, 1)
+	if h3 != nil {
+		go func() { h3Err <- h3.Shutdown(ctx) }()
+	} else {
+		h3Err <- nil
+	}
+	serverErr := server.Shutdown(ctx)
+	if serverErr != nil {
+		serverErr = fmt.Errorf("shutting down HTTP server: %w", serverErr)
+	}
+	if err := <-h3Err; err != nil {
+		serverErr = errors.Join(serverErr, fmt.Errorf("shutting down HTTP/3 server: %w", err))
+	}
+
+	if err := a.shutdownJobs(cfg.Jobs.DrainTimeout); err != nil {
+		return errors.Join(serverErr, err)
+	}
+	return serverErr
+}
+
+// shutdownJobs drains the job queue and logs what happened to its jobs.
+func (a *application) shutdownJobs(timeout time.Duration) error {
+	log.Printf("Shutting down: waiting up to %v for background jobs", timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	report, err := a.jobs.Shutdown(ctx)
+	log.Printf("Background jobs: %d drained, %d abandoned at the deadline, %d saved for the next start",
+		report.Drained, report.Abandoned, report.Saved)
+	if err != nil {
+		return fmt.Errorf("draining background jobs: %w", err)
+	}
+	return nil
+}
+
+// application is the fully wired dependency graph: everything the server
+// needs except the listening socket.
+//
+// WHY SEPARATE BUILDING FROM SERVING?
+// Run and SelfTest both need the exact same wiring. If SelfTest built its
+// own copy, the two would drift apart and the self-test would happily pass
+// against a graph that production never runs.
+type application struct {
+	handler     http.Handler // Router wrapped in the SLO middleware
+	sloTracker  *slo.Tracker
+	failover    *failover.Connector // nil without DB_STANDBY_DSN
+	secrets     *secrets.Watcher    // Secret files to reload; started by Run
+	userCache   *usercache.Cache    // nil without USER_CACHE_REDIS_ADDR
+	userChanges []user.ChangeFeed   // What userCache follows, one per database with users
+	locks       *lock.Manager       // Runs singleton jobs on one instance at a time
+	leader      *leader.Elector     // Runs leaderTasks on one elected instance
+	leaderTasks []leader.Task       // Background subsystems that must not run twice
+	jobs        *jobs.Queue         // Background jobs; started by Run
+	pools       []*sql.DB           // Every database pool, for checkShutdown
+	closers     []func() error      // Released in reverse order by Close
+}
+
+// Close releases the application's resources (database pools, Redis
+// clients, audit sinks) and returns what failed to close. Calling it
+// again does nothing.
+func (a *application) Close() error {
+	var errs []error
+	for i := len(a.closers) - 1; i >= 0; i-- {
+		errs = append(errs, a.closers[i]())
+	}
+	a.closers = nil
+	return errors.Join(errs...)
+}
+
+// newRedisClient connects to Redis at addrs (one address gives a plain
+// client, several a cluster client), to be closed by Close.
+//
+// Every subsystem that uses Redis gets its client here, so none can be
+// forgotten at shutdown: an unclosed client keeps its connections, and
+// a cluster client its background goroutines.
+func (a *application) newRedisClient(addrs []string, password string) redis.UniversalClient {
+	client := redis.NewUniversalClient(&redis.UniversalOptions{Addrs: addrs, Password: password})
+	a.closers = append(a.closers, client.Close)
+	return client
+}
+
+// newApplication connects to the databases and wires every dependency.
+// On error, anything opened so far is closed again.
+func newApplication(cfg *config.Config) (_ *application, err error) {
+	a := &application{}
+	defer func() {
+		if err != nil {
+			a.Close()
+		}
+	}()
+
+	// Metrics are served on /metrics for Prometheus to scrape.
+	metricsRegistry := metrics.NewRegistry()
+	// Every in-process cache reports its hits and evictions here.
+	cacheMetrics := cache.NewMetrics(metricsRegistry)
+
+	// Secrets mounted as files (JWT_SECRET_FILE, DB_PASSWORD_FILE, ...)
+	// are read now, and registered with the watcher as they're used.
+	if err := readSecretFiles(cfg); err != nil {
+		return nil, err
+	}
+	a.secrets = secrets.NewWatcher(metricsRegistry)
+	dbCredentials, err := newDBCredentials(cfg.Database)
+	if err != nil {
+		return nil, err
+	}
+	if dbCredentials != nil {
+		if err := a.secrets.Watch("database", dbCredentials, dbCredentials.Files()...); err != nil {
+			return nil, err
+		}
+	}
+
+	// Connect to database
+	// With DB_STANDBY_DSN set, the pool can fail over to the standby.
+	var db *sql.DB
+	if cfg.Database.StandbyDSN != "" {
+		db, a.failover, err = openFailoverDB(cfg.Database, dbCredentials, metricsRegistry)
+	} else {
+		db, err = openDB(cfg.Database, dbCredentials)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to database: %w", err)
+	}
+	a.pools = append(a.pools, db)
+	a.closers = append(a.closers, db.Close)
 	log.Println("Database connection established")
 
-	// Step 3: Create dependencies (Dependency Injection)
+	// Apply pending migrations before anything reads the schema.
+	// Replicas starting together take turns (see userRepo.Migrate).
+	if cfg.Database.AutoMigrate {
+		if err := userRepo.Migrate(context.Background(), db, migrations.FS, cfg.Database.MigrateLockTimeout); err != nil {
+			return nil, fmt.Errorf("migrating database: %w", err)
+		}
+	}
+
+	// Create dependencies (Dependency Injection)
 	// We create dependencies in order: lowest level first.
 	//
 	// Dependency graph:
@@ -64,24 +349,396 @@ func Run() error {
 	//   UserHandler (HTTP) <-- used by
 	//   HTTP Server
 
+	// Scheduled jobs take a lock first, so each runs on one instance only.
+	a.locks, err = a.newLockManager(cfg.Lock, db, metricsRegistry)
+	if err != nil {
+		return nil, err
+	}
+	// Leadership is a lock too; followers retry as often as it's renewed.
+	a.leader = leader.New(a.locks, cfg.Lock.TTL/3)
+
+	// The audit trail: admin actions and knob changes, to the sinks in
+	// AUDIT_SINKS and AUDIT_ROUTES. Closed before the database, so the
+	// collector can flush.
+	auditLog, err := newAuditLogger(cfg.Audit, db)
+	if err != nil {
+		return nil, fmt.Errorf("configuring audit sinks: %w", err)
+	}
+	a.closers = append(a.closers, auditLog.Close)
+
+	// Knobs that can be changed at runtime through /admin/tunables
+	knobs := newKnobs(cfg)
+	knobs.registry.SetAudit(func(actor, message string) {
+		auditLog.Record(context.Background(), audit.CategoryTunables, actor, "%s", message)
+	})
+
 	// Repository layer - data access
-	userRepository := userRepo.NewUserRepository(db)
+	// With DB_SHARD_DSNS set, users are spread across several databases
+	// and the main database only keeps the shard directory.
+	// Outside production, sample queries with EXPLAIN and warn about
+	// full table scans before they reach production data sizes.
+	var repoOptions []userRepo.RepositoryOption
+	if !cfg.App.IsProduction() && cfg.Database.ExplainSampleRate > 0 {
+		advisor := userRepo.NewIndexAdvisor(float64(cfg.Database.ExplainSampleRate), cfg.Database.ExplainRowThreshold)
+		repoOptions = append(repoOptions, userRepo.WithIndexAdvisor(advisor))
+		log.Printf("Index advisor enabled (sample rate %s)", cfg.Database.ExplainSampleRate)
+	}
+
+	// Slow queries are logged in every environment; the threshold and
+	// sample rate are knobs, so an incident can turn the log up or down.
+	slowQueries := userRepo.NewSlowQueryLog(knobs.slowQueryThreshold.Get, func() float64 {
+		return float64(knobs.slowQuerySampleRate.Get())
+	})
+	repoOptions = append(repoOptions, userRepo.WithSlowQueryLog(slowQueries))
+
+	// TOTP secrets are encrypted at rest; without a key, 2FA is disabled.
+	var mfaCipher *encryption.Cipher
+	if cfg.MFA.EncryptionKey != "" {
+		mfaCipher, err = encryption.NewCipherFromBase64(cfg.MFA.EncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("configuring MFA_ENCRYPTION_KEY: %w", err)
+		}
+		repoOptions = append(repoOptions, userRepo.WithSecretCipher(mfaCipher))
+	}
+
+	var baseUserRepository user.Repository
+	var schemaChecks []schemaCheck
+	if len(cfg.Database.ShardDSNs) > 0 {
+		shards, err := openShards(cfg.Database, dbCredentials)
+		if err != nil {
+			return nil, err
+		}
+		for _, shard := range shards {
+			a.pools = append(a.pools, shard)
+			a.closers = append(a.closers, shard.Close)
+		}
+		log.Printf("Sharding users across %d databases", len(shards))
+		baseUserRepository = userRepo.NewShardedUserRepository(db, shards, repoOptions...)
+		for _, shard := range shards {
+			a.userChanges = append(a.userChanges, userRepo.NewUserChangeFeed(shard))
+		}
+
+		schemaChecks = append(schemaChecks, schemaCheck{"directory", db, slices.Concat(userRepo.DirectoryTables, userRepo.RoleTables, userRepo.AuthTables, userRepo.JobTables, userRepo.NotificationTables, userRepo.AuditTables, userRepo.TenantTables, userRepo.PreferenceTables, userRepo.PrivacyTables, userRepo.CampaignTables)})
+		for i, shard := range shards {
+			schemaChecks = append(schemaChecks, schemaCheck{fmt.Sprintf("shard %d", i), shard, userRepo.UserTables})
+		}
+	} else {
+		baseUserRepository = userRepo.NewUserRepository(db, repoOptions...)
+		a.userChanges = append(a.userChanges, userRepo.NewUserChangeFeed(db))
+		schemaChecks = append(schemaChecks, schemaCheck{"main", db, slices.Concat(userRepo.UserTables, userRepo.RoleTables, userRepo.AuthTables, userRepo.JobTables, userRepo.NotificationTables, userRepo.AuditTables, userRepo.TenantTables, userRepo.PreferenceTables, userRepo.PrivacyTables, userRepo.CampaignTables)})
+	}
+
+	// Users looked up by email (every login) come from Redis, if
+	// USER_CACHE_REDIS_ADDR is set, and are dropped as soon as they're
+	// written, here or anywhere else.
+	if len(cfg.UserCache.RedisAddrs) > 0 {
+		a.userCache, err = a.newUserCache(cfg.UserCache, baseUserRepository, mfaCipher, metricsRegistry)
+		if err != nil {
+			return nil, err
+		}
+		baseUserRepository = a.userCache
+	}
+
+	// Compare the live schema with what the code expects, so drift shows
+	// up as a clear diff on /ready instead of scan errors at runtime.
+	ready, err := newReadiness(context.Background(), db, schemaChecks)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token versions are cached for JWT validation. The service that
+	// reads them needs the repository below, so the cache is created
+	// with the service; the hooks only run once requests do.
+	var tokenVersions *auth.VersionCache
+
+	// When each account was last used, for the dormant account report.
+	// Like sessions, it's in the main database (the directory when sharded).
+	activity := userRepo.NewActivityRepository(db)
+	// Each user's recent logins, for GET /users/{id}/logins, next to it.
+	loginHistory := userRepo.NewLoginHistoryRepository(db)
+
+	// WithHooks decorates the MySQL repository with lifecycle callbacks.
+	// Register new hooks here so every extension point is visible in one place.
+	userRepository := user.WithHooks(baseUserRepository, user.Hooks{
+		BeforeCreate: []user.BeforeHook{user.NormalizeEmail, user.AssignULID},
+		AfterCreate: []user.AfterHook{
+			// Registration starts an account's clock, in case its owner
+			// never logs in. Hooks don't see the request, so its address
+			// is left unknown.
+			func(ctx context.Context, u *user.User) {
+				if err := activity.Touch(ctx, u.ID, time.Now().UTC(), ""); err != nil {
+					log.Printf("recording activity for user %d: %v", u.ID, err)
+				}
+			},
+		},
+		BeforeUpdate: []user.BeforeHook{user.NormalizeEmail},
+		AfterUpdate: []user.AfterHook{
+			// An update may have revoked the user's tokens; don't let this
+			// instance accept them from its cache.
+			func(ctx context.Context, u *user.User) {
+				tokenVersions.Forget(u.ID)
+			},
+		},
+		AfterDelete: []user.AfterDeleteHook{
+			// Publish a domain event so other parts of the system can react.
+			// For now the "event bus" is the log.
+			func(ctx context.Context, id uint64) {
+				log.Printf("event: user.deleted id=%d", id)
+			},
+			func(ctx context.Context, id uint64) {
+				tokenVersions.Forget(id)
+			},
+			func(ctx context.Context, id uint64) {
+				if err := activity.Delete(ctx, id); err != nil {
+					log.Printf("deleting activity for user %d: %v", id, err)
+				}
+			},
+			func(ctx context.Context, id uint64) {
+				if err := loginHistory.DeleteForUser(ctx, id); err != nil {
+					log.Printf("deleting login history for user %d: %v", id, err)
+				}
+			},
+		},
+	})
+
+	// Roles live in the main database (the directory when sharded)
+	roleRepository := userRepo.NewRoleRepository(db)
 
 	// Service layer - business logic
-	userService := user.NewService(userRepository)
+	passwordHasher, err := newPasswordHasher(cfg.Password)
+	if err != nil {
+		return nil, fmt.Errorf("configuring password hashing: %w", err)
+	}
+	recoveryCodes := userRepo.NewRecoveryCodeRepository(db)
+	// Every flow that stores or looks up an email normalizes it the same way.
+	emails := user.EmailNormalizer{FoldGmail: cfg.Emails.FoldGmail}
+	userService := user.NewService(userRepository, roleRepository, passwordHasher, recoveryCodes, user.WithEmailNormalizer(emails))
+	tokenVersions = auth.NewVersionCache(func(ctx context.Context, id uint64) (uint64, error) {
+		version, err := userService.TokenVersion(ctx, id)
+		if errors.Is(err, user.ErrAccountDeactivated) {
+			// Deactivated accounts get 403s, not 401s (see auth.ErrAccountDeactivated).
+			return 0, auth.ErrAccountDeactivated
+		}
+		return version, err
+	}, cfg.JWT.VersionCacheTTL, cache.WithMetrics(cacheMetrics))
+
+	// Password reset emails go through SMTP when configured.
+	// Without SMTP_ADDR, messages are logged so the flow works in development.
+	var mailer mail.Mailer
+	if cfg.Mail.SMTPAddr != "" {
+		mailer = mail.NewSMTPMailer(cfg.Mail.SMTPAddr, cfg.Mail.SMTPUsername, cfg.Mail.SMTPPassword, cfg.Mail.From)
+	} else {
+		if cfg.App.IsProduction() {
+			log.Printf("WARNING: SMTP_ADDR is not set; password reset emails will only be logged")
+		}
+		mailer = mail.NewLogMailer()
+	}
+	// Emails are sent by background workers, so a slow mail server
+	// doesn't slow down the requests that send them.
+	a.jobs, err = newJobQueue(cfg.Jobs, db, mailer, metricsRegistry)
+	if err != nil {
+		return nil, err
+	}
+	// Delayed and recurring jobs wait in the database until the leader
+	// hands them to the queue.
+	scheduler, err := newJobScheduler(cfg.Jobs, a.jobs, db, metricsRegistry)
+	if err != nil {
+		return nil, err
+	}
+	a.leaderTasks = append(a.leaderTasks, scheduler.Run)
+	// Low-priority notifications are batched into digests, sent by a
+	// scheduled job per user. Subscribed browsers get every one at once.
+	notifications, pushSender, err := newNotifications(cfg.Notify, cfg.WebPush, db, userService, a.jobs, scheduler)
+	if err != nil {
+		return nil, err
+	}
+	if pushSender == nil {
+		log.Printf("Web push disabled (WEBPUSH_VAPID_PRIVATE_KEY not set)")
+	}
+	// Accounts nobody signs in to are reported, and warned, disabled, or
+	// deleted as DORMANT_ACTIONS says. The probe's canary never signs in,
+	// so it's exempt.
+	dormancy, err := newDormancy(cfg.Dormancy, userRepository, roleRepository, activity, userRepo.NewSessionRepository(db),
+		[]string{cfg.Probe.CanaryEmail}, a.jobs, scheduler, auditLog)
+	if err != nil {
+		return nil, err
+	}
+	passwordReset := user.NewPasswordReset(
+		userRepository,
+		userRepo.NewResetTokenRepository(db),
+		userRepo.NewSessionRepository(db),
+		queuedMailer{queue: a.jobs},
+		passwordHasher,
+		cfg.Reset.URL,
+		cfg.Reset.TokenTTL,
+		emails,
+	)
+
+	// Email changes are confirmed from the new inbox, like resets.
+	emailChange := user.NewEmailChange(
+		userRepository,
+		userRepo.NewEmailChangeTokenRepository(db),
+		queuedMailer{queue: a.jobs},
+		passwordHasher,
+		cfg.EmailChange.URL,
+		cfg.EmailChange.TokenTTL,
+		emails,
+	)
+
+	// Invited accounts are created pending, and get their password from
+	// the invitation's link.
+	invitations := user.NewInvitations(
+		userRepository,
+		roleRepository,
+		userRepo.NewInvitationRepository(db),
+		queuedMailer{queue: a.jobs},
+		passwordHasher,
+		cfg.Invites.URL,
+		cfg.Invites.TokenTTL,
+		emails,
+	)
+
+	// Admins can review the flows' emails without running them.
+	emailPreviews := user.NewEmailPreviews(userRepository, passwordReset, emailChange, invitations, queuedMailer{queue: a.jobs})
 
 	// Auth components
+	jwtOptions, err := jwtManagerOptions(cfg.JWT)
+	if err != nil {
+		return nil, fmt.Errorf("configuring JWT: %w", err)
+	}
+	// Without client certificates every token would silently fall back
+	// to IP binding.
+	if cfg.JWT.Binding == auth.BindCert && !cfg.MTLS.Enabled() {
+		return nil, errors.New("JWT_BINDING=cert needs MTLS_CLIENT_AUTH")
+	}
+	// Clients that can't use mTLS may bind their tokens to a key of
+	// their own instead.
+	dpopOptions, err := a.newDPoP(cfg.DPoP, cfg.JWT.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("configuring DPoP: %w", err)
+	}
+	jwtOptions = append(jwtOptions, dpopOptions...)
+	// Tokens issued before a password change are refused.
+	jwtOptions = append(jwtOptions, auth.WithVersionCheck(tokenVersions))
+	// Register auth event hooks (alerting, anomaly detection) here.
+	// For now, like user deletions above, the "event bus" is the log.
+	jwtOptions = append(jwtOptions, auth.WithEventHook(auth.EventHookFunc(logAuthEvent)))
+	jwtOptions = append(jwtOptions, auth.WithEventHook(auditRecoveryLogins(auditLog)))
+	// Failed logins raise the email's risk score, when logins are scored.
+	var loginFailures *risk.Failures
+	if cfg.Risk.Enabled() {
+		loginFailures = risk.NewFailures(cfg.Risk.FailureWindow, cache.WithMetrics(cacheMetrics))
+		jwtOptions = append(jwtOptions, auth.WithEventHook(countLoginFailures(loginFailures)))
+	}
+	// Register claims enrichers here (auth.WithClaimsEnricher): a
+	// deployment's own claims, like an organization or feature flags
+	// from other services, and what handlers read from auth.Principal.
 	jwtManager := auth.NewJWTManager(
 		cfg.JWT.Secret,
 		cfg.JWT.AccessTokenDuration,
 		cfg.JWT.Issuer,
+		jwtOptions...,
 	)
-	authMiddleware := auth.NewMiddleware(jwtManager)
+	// The signing key is rotated when its files change.
+	if err := a.watchJWTKeys(cfg, jwtManager); err != nil {
+		return nil, fmt.Errorf("watching JWT keys: %w", err)
+	}
+
+	authMetrics := metrics.NewAuthMetrics(metricsRegistry)
+	// Tenant label values, bounded by METRICS_TENANT_ALLOWLIST or
+	// METRICS_MAX_TENANTS, for the HTTP and bulkhead metrics alike.
+	tenantLabels := metrics.NewTenantLimiter(metricsRegistry, cfg.Metrics.TenantAllowlist, cfg.Metrics.MaxTenants)
+	httpMetrics := metrics.NewHTTPMetrics(metricsRegistry, tenantLabels)
+
+	// SLO tracking classifies every routed request as good or bad.
+	sloTracker, err := newSLOTracker(metricsRegistry, cfg.SLO)
+	if err != nil {
+		return nil, fmt.Errorf("configuring SLOs: %w", err)
+	}
+	a.sloTracker = sloTracker
+
+	// Internal services may authenticate with client certificates on
+	// the routes MTLS_ROUTES names, and integrations with signed
+	// requests on the routes SIGNING_ROUTES names.
+	routePolicies := make(map[string]auth.Policy)
+	certAuth, err := newClientCertAuth(cfg.MTLS, routePolicies)
+	if err != nil {
+		return nil, fmt.Errorf("configuring client certificates: %w", err)
+	}
+	signedAuth, err := a.newRequestSigning(cfg.Signing, routePolicies)
+	if err != nil {
+		return nil, fmt.Errorf("configuring signed requests: %w", err)
+	}
+	authMiddleware := auth.NewMiddleware(jwtManager, slices.Concat(certAuth, signedAuth, []auth.MiddlewareOption{
+		auth.WithRoutePolicies(routePolicies),
+		auth.WithFailureHook(func(r *http.Request, cause string) {
+			authMetrics.TokenFailures.IncWithExemplar(metrics.TraceID(r), cause)
+		}),
+	})...)
 
 	// Handler layer - HTTP
-	userHTTPHandler := userHandler.NewUserHandler(userService, jwtManager)
+	// Identical concurrent GETs for the same user share one service call.
+	coalescer := userHandler.NewCoalescer(metricsRegistry)
+	// Refresh-token sessions, one per signed-in device. Each login and
+	// refresh is recorded for the dormant account report, and each login
+	// in the user's login history. Refreshes extend them up to the
+	// configured cap, if any.
+	sessions := user.NewSessions(userRepo.NewSessionRepository(db), userRepository, roleRepository, cfg.JWT.RefreshTokenDuration,
+		user.WithActivity(activity), user.WithLoginHistory(loginHistory), user.WithMaxLifetime(sessionMaxLifetime(cfg.JWT)))
+	// Login and forgot-password share one limiter (see newRateLimiter)
+	limit, err := a.newRateLimiter(cfg.Limits, knobs, cacheMetrics)
+	if err != nil {
+		return nil, fmt.Errorf("configuring rate limits: %w", err)
+	}
+	// Registration and login ask for a solved CAPTCHA, if one is configured.
+	captchaVerifier, err := newCaptcha(cfg.Captcha)
+	if err != nil {
+		return nil, err
+	}
+	if captchaVerifier == nil {
+		log.Printf("CAPTCHA disabled (CAPTCHA_PROVIDER not set)")
+	}
+	// Each login is scored, and the score decides what it takes, if
+	// RISK_POLICY is set.
+	riskAssessor, err := newRiskAssessor(cfg.Risk, captchaVerifier != nil, loginFailures, userRepository, emails, sessions,
+		userRepo.NewLoginCountryRepository(db), auditLog)
+	if err != nil {
+		return nil, err
+	}
+	if riskAssessor == nil {
+		log.Printf("Login risk scoring disabled (RISK_POLICY not set)")
+	}
+	userHTTPHandler := userHandler.NewUserHandler(userService, jwtManager, authMetrics, coalescer, sessions, limit, notifications, captchaVerifier, riskAssessor)
+	sessionHTTPHandler := userHandler.NewSessionHandler(sessions, jwtManager)
+	notificationHTTPHandler := userHandler.NewNotificationHandler(notifications, pushSender)
+	preferenceHTTPHandler := userHandler.NewPreferenceHandler(user.NewPreferenceService(userRepository, userRepo.NewPreferenceRepository(db)))
+	var mfa *user.MFA
+	if mfaCipher != nil {
+		mfa = user.NewMFA(userRepository, recoveryCodes, passwordHasher, cfg.MFA.Issuer, func(ctx context.Context, userID uint64, message string) {
+			auditLog.Record(ctx, audit.CategorySecurity, fmt.Sprintf("user %d", userID), "%s", message)
+		})
+	} else {
+		log.Printf("Two-factor authentication disabled (MFA_ENCRYPTION_KEY not set)")
+	}
+	authHTTPHandler := userHandler.NewAuthHandler(passwordReset, emailChange, mfa, limit)
+	// The probe writes only to its dedicated canary account.
+	canary := user.NewCanary(userRepository, roleRepository, cfg.Probe.CanaryEmail)
+	probeHTTPHandler := userHandler.NewProbeHandler(canary, cfg.Probe.Token)
+	adminHTTPHandler := userHandler.NewAdminHandler(userService, userRepo.NewDiagnostics(db), sloTracker, a.failover, cfg.Settings(), cfg.Admin.Token, jwtManager, cfg.Admin.ImpersonationTTL, knobs.registry, a.jobs, scheduler, emailPreviews, auditLog, dormancy)
+
+	// Tenant policies: CORS origins, redirect URIs, and webhook URLs.
+	// Production refuses wildcards and plain http in them.
+	tenants := tenant.NewService(userRepo.NewTenantPolicyRepository(db), cfg.App.IsProduction(), cfg.Tenants.PolicyCacheTTL)
+
+	// Where flows may send a browser back to when a client asks: the
+	// configured URLs, or what the client's tenant allows.
+	returns, err := redirect.NewValidator(cfg.Redirects.AllowedURLs,
+		redirect.WithBase(cfg.Redirects.BaseURL), redirect.WithTenantPolicy(tenants.AllowsRedirect))
+	if err != nil {
+		return nil, fmt.Errorf("configuring REDIRECT_ALLOWED_URLS: %w", err)
+	}
 
-	// Step 4: Set up HTTP routing
+	// Set up HTTP routing
 	mux := http.NewServeMux()
 
 	// Health check endpoint
@@ -92,26 +749,153 @@ func Run() error {
 		w.Write([]byte("ok"))
 	})
 
+	// Readiness endpoint
+	// Fails when the database is unreachable or its schema has drifted.
+	mux.Handle("GET /ready", ready)
+	// Every error code responses can carry, for clients' own messages.
+	mux.HandleFunc("GET /error-codes", userHandler.ErrorCodes)
+
+	// Prometheus scrape endpoint
+	// Serve it on an internal network only; counters reveal traffic patterns.
+	mux.Handle("GET /metrics", metricsRegistry.Handler())
+
 	// Register user routes
 	userHTTPHandler.RegisterRoutes(mux, authMiddleware)
 
-	// Step 5: Configure and start HTTP server
-	server := &http.Server{
-		Addr:    ":" + cfg.Server.Port,
-		Handler: mux,
+	// Register account recovery routes
+	authHTTPHandler.RegisterRoutes(mux, authMiddleware)
 
-		// Timeouts prevent slow clients from holding connections.
-		// These are important for security and resource management.
-		ReadTimeout:  cfg.Server.ReadTimeout,
-		WriteTimeout: cfg.Server.WriteTimeout,
-		IdleTimeout:  cfg.Server.IdleTimeout,
+	// Register refresh and session management routes
+	sessionHTTPHandler.RegisterRoutes(mux, authMiddleware)
+
+	// Register notification settings and push subscription routes
+	notificationHTTPHandler.RegisterRoutes(mux, authMiddleware)
+
+	// Register client preference routes
+	preferenceHTTPHandler.RegisterRoutes(mux, authMiddleware)
+
+	// Register synthetic monitoring probe (PROBE_TOKEN required)
+	probeHTTPHandler.RegisterRoutes(mux)
+
+	// Register admin routes (admin role required; diagnostics also need ADMIN_TOKEN)
+	adminHTTPHandler.RegisterRoutes(mux, authMiddleware)
+
+	// Register tenant policy administration (tenants:manage scope)
+	userHandler.NewTenantHandler(tenants, auditLog).RegisterRoutes(mux, authMiddleware)
+
+	// Register invitations (users:invite scope; accepting is public)
+	userHandler.NewInvitationHandler(invitations, auditLog).RegisterRoutes(mux, authMiddleware)
+
+	// Register email campaigns (campaigns:manage scope). Their batches
+	// are sent by the job system, at most CAMPAIGN_SEND_RATE at a time.
+	campaigns, err := newCampaigns(cfg.Campaigns, db, userRepository, roleRepository, activity, mailer, a.jobs, scheduler)
+	if err != nil {
+		return nil, err
 	}
+	userHandler.NewCampaignHandler(campaigns, auditLog).RegisterRoutes(mux, authMiddleware)
 
-	log.Printf("HTTP server listening on :%s", cfg.Server.Port)
+	// Register bulk user imports (accounts:manage scope and ADMIN_TOKEN).
+	// Import files may be larger than SERVER_MAX_BODY_SIZE.
+	if cfg.Import.BatchSize < 1 {
+		return nil, fmt.Errorf("invalid IMPORT_BATCH_SIZE %d (want at least 1)", cfg.Import.BatchSize)
+	}
+	importHTTPHandler := userHandler.NewImportHandler(userService, auditLog, cfg.Admin.Token, int64(cfg.Import.MaxBodySize), cfg.Import.BatchSize)
+	importHTTPHandler.RegisterRoutes(mux, authMiddleware)
+	bodyLimits := importHTTPHandler.BodyLimits()
 
-	// ListenAndServe blocks until the server shuts down.
-	// It returns an error if the server fails to start.
-	return server.ListenAndServe()
+	// Register user exports (users:list scope and ADMIN_TOKEN). They
+	// stream for longer than SERVER_WRITE_TIMEOUT.
+	if cfg.Export.BatchSize < 1 || cfg.Export.Timeout <= 0 {
+		return nil, fmt.Errorf("invalid EXPORT_BATCH_SIZE %d or EXPORT_TIMEOUT %v (want at least 1, and a positive duration)", cfg.Export.BatchSize, cfg.Export.Timeout)
+	}
+	exportHTTPHandler := userHandler.NewExportHandler(userService, auditLog, cfg.Admin.Token, cfg.Export.BatchSize, cfg.Export.Timeout)
+	exportHTTPHandler.RegisterRoutes(mux, authMiddleware)
+	timeouts := exportHTTPHandler.Timeouts()
+
+	// Register avatar uploads (AVATAR_STORAGE). Their bodies may be
+	// larger than SERVER_MAX_BODY_SIZE too.
+	var avatars *user.Avatars
+	if cfg.Avatars.Enabled() {
+		store, files, err := a.newAvatarStore(cfg.Avatars)
+		if err != nil {
+			return nil, fmt.Errorf("configuring avatars: %w", err)
+		}
+		avatars = user.NewAvatars(userRepository, store, cfg.Avatars.Size)
+		avatarHTTPHandler := userHandler.NewAvatarHandler(avatars, int64(cfg.Avatars.MaxUploadSize))
+		avatarHTTPHandler.RegisterRoutes(mux, authMiddleware)
+		maps.Copy(bodyLimits, avatarHTTPHandler.BodyLimits())
+		if files != nil {
+			mux.Handle("GET "+localAvatarsPath+"/{key...}", files)
+		}
+	}
+
+	// Register right-to-erasure requests. Due ones are carried out every
+	// ANONYMIZE_INTERVAL; accounts:manage admins can confirm them sooner.
+	anonymization, err := newAnonymization(cfg.Anonymize, userRepository, userRepo.NewAnonymizationRepository(db), avatars, a.jobs, scheduler, auditLog)
+	if err != nil {
+		return nil, err
+	}
+	userHandler.NewAnonymizationHandler(anonymization, auditLog).RegisterRoutes(mux, authMiddleware)
+
+	// Register SAML single sign-on routes (SAML_IDP_METADATA_URL or _FILE)
+	if cfg.SAML.Enabled() {
+		samlProvider, err := sso.NewSAML(context.Background(), sso.Options{
+			RootURL:         cfg.SAML.RootURL,
+			EntityID:        cfg.SAML.EntityID,
+			IDPMetadataURL:  cfg.SAML.IDPMetadataURL,
+			IDPMetadataFile: cfg.SAML.IDPMetadataFile,
+			CertFile:        cfg.SAML.CertFile,
+			KeyFile:         cfg.SAML.KeyFile,
+			EmailAttribute:  cfg.SAML.EmailAttribute,
+			AllowedDomains:  cfg.SAML.AllowedDomains,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("configuring SAML SSO: %w", err)
+		}
+		userHandler.NewSSOHandler(samlProvider, userService, jwtManager, sessions, notifications,
+			cfg.SAML.AutoProvision, cfg.SAML.RedirectURL, returns).RegisterRoutes(mux)
+	}
+
+	// Register inbound webhook receivers (WEBHOOK_SECRETS). They're public:
+	// each delivery's signature is its credential.
+	webhooks, err := a.newWebhooks(cfg.Webhooks)
+	if err != nil {
+		return nil, err
+	}
+	if webhooks != nil {
+		mux.Handle("POST /webhooks/{receiver}", webhooks)
+	}
+
+	// Register capability discovery: what this deployment has turned on.
+	userHandler.NewCapabilitiesHandler(newCapabilities(cfg, knobs, mfa != nil, pushSender != nil)).RegisterRoutes(mux)
+
+	// Oversized bodies are refused before any handler reads them.
+	// Maintenance mode (a knob) answers 503 before anything else runs.
+	// Handlers stop working on a request once its response can't be
+	// written anymore (see Deadline). CORS goes outside maintenance, so
+	// a browser app can still read the 503.
+	handler := userHandler.Deadline(userHandler.LimitBody(mux, int64(cfg.Server.MaxBodySize), bodyLimits), cfg.Server.WriteTimeout, mux, timeouts)
+	// Browsers get their token binding cookie (JWT_BINDING=cookie).
+	if binder := jwtManager.Binder(); binder != nil {
+		handler = binder.Middleware(handler)
+	}
+	// Each tenant's requests in flight are capped, so one tenant can't
+	// hold every database connection (TENANT_MAX_CONNS).
+	tenantBulkhead, err := newBulkhead(cfg.Tenants, cfg.Database.MaxOpenConns, metricsRegistry, tenantLabels)
+	if err != nil {
+		return nil, err
+	}
+	if tenantBulkhead != nil {
+		handler = userHandler.TenantBulkhead(handler, tenantBulkhead)
+	}
+	handler = userHandler.Maintenance(handler, knobs.maintenance.Get)
+	handler = userHandler.CORS(handler, tenants.AllowsOrigin)
+	a.handler = httpMetrics.Middleware(sloTracker.Middleware(handler))
+	// Outermost, so the breakdown's total covers the whole chain.
+	if cfg.Server.Timing {
+		a.handler = timing.Middleware(a.handler)
+	}
+	return a, nil
 }
 
 // openDB creates a database connection pool.
@@ -121,14 +905,29 @@ func Run() error {
 // - It's safe for concurrent use from multiple goroutines
 // - You should create ONE *sql.DB per database and reuse it
 // - Don't call db.Close() until the application shuts down
-func openDB(cfg config.DatabaseConfig) (*sql.DB, error) {
+//
+// With creds (DB_USER_FILE, DB_PASSWORD_FILE), connections log in with
+// them instead of the DSN's, and are replaced when they're rotated.
+func openDB(cfg config.DatabaseConfig, creds *secrets.DBCredentials) (*sql.DB, error) {
+	if creds != nil {
+		connector, err := credentialsConnector(cfg.DSN, creds)
+		if err != nil {
+			return nil, fmt.Errorf("opening database: %w", err)
+		}
+		return configurePool(sql.OpenDB(connector), cfg)
+	}
+
 	// sql.Open doesn't actually connect to the database.
 	// It just validates the DSN and prepares the pool.
 	db, err := sql.Open("mysql", cfg.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("opening database: %w", err)
 	}
+	return configurePool(db, cfg)
+}
 
+// configurePool applies the pool settings to db and checks it can connect.
+func configurePool(db *sql.DB, cfg config.DatabaseConfig) (*sql.DB, error) {
 	// Configure the connection pool
 	//
 	// MaxOpenConns: Maximum number of open connections.
@@ -157,3 +956,29 @@ func openDB(cfg config.DatabaseConfig) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// openShards opens one connection pool per shard DSN.
+// Each shard gets the same pool settings and credentials as the main
+// database.
+func openShards(cfg config.DatabaseConfig, creds *secrets.DBCredentials) ([]*sql.DB, error) {
+	shards := make([]*sql.DB, 0, len(cfg.ShardDSNs))
+	for i, dsn := range cfg.ShardDSNs {
+		shardCfg := cfg
+		shardCfg.DSN = dsn
+
+		db, err := openDB(shardCfg, creds)
+		if err != nil {
+			closeAll(shards)
+			return nil, fmt.Errorf("connecting to shard %d: %w", i, err)
+		}
+		shards = append(shards, db)
+	}
+	return shards, nil
+}
+
+// closeAll closes every connection pool in the list.
+func closeAll(dbs []*sql.DB) {
+	for _, db := range dbs {
+		db.Close()
+	}
+}
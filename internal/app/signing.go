@@ -0,0 +1,111 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/auth"
+	"go-basics/internal/secrets"
+	"go-basics/internal/webhook"
+)
+
+// newRequestSigning returns the auth middleware options for
+// SIGNING_SECRETS (or SIGNING_SECRETS_FILE, watched for changes) and
+// SIGNING_CLIENTS, and adds the SIGNING_ROUTES
+// policies to policies. Without secrets it returns none, and a route
+// asking for signed requests fails startup.
+//
+// Nonces go in the same kind of replay cache as webhook deliveries: in
+// memory, or in Redis with SIGNING_REDIS_ADDR.
+func (a *application) newRequestSigning(cfg config.SigningConfig, policies map[string]auth.Policy) ([]auth.MiddlewareOption, error) {
+	allowed := []auth.Policy{}
+	if cfg.Enabled() {
+		allowed = append(allowed, auth.PolicySigned, auth.PolicySignedOrJWT)
+	}
+	if err := parseRoutePolicies("SIGNING_ROUTES", cfg.Routes, policies, allowed); err != nil {
+		return nil, err
+	}
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+
+	keys, err := signingKeys(cfg.Secrets, cfg.Clients)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonces auth.NonceCache = webhook.NewMemoryReplayCache()
+	if len(cfg.RedisAddrs) > 0 {
+		client := a.newRedisClient(cfg.RedisAddrs, cfg.RedisPassword)
+		nonces = webhook.NewRedisReplayCache(client, "nonce:")
+	}
+	verifier, err := auth.NewRequestVerifier(keys, cfg.MaxSkew, nonces)
+	if err != nil {
+		return nil, fmt.Errorf("SIGNING_SECRETS: %w", err)
+	}
+
+	// A rotated SIGNING_SECRETS_FILE is checked like at startup; one
+	// that doesn't pass leaves the old secrets in place.
+	if cfg.SecretsFile != "" {
+		err := a.secrets.Watch("signing", secrets.ReloaderFunc(func(context.Context) error {
+			pairs, err := readSigningSecrets(cfg.SecretsFile)
+			if err != nil {
+				return err
+			}
+			keys, err := signingKeys(pairs, cfg.Clients)
+			if err != nil {
+				return err
+			}
+			return verifier.SetKeys(keys)
+		}), cfg.SecretsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	log.Printf("Signed request keys: %s", strings.Join(ids, ", "))
+	return []auth.MiddlewareOption{auth.WithRequestSigning(verifier)}, nil
+}
+
+// signingKeys builds the verifier's keys from SIGNING_SECRETS pairs and
+// SIGNING_CLIENTS scopes.
+func signingKeys(pairs, clients []string) (map[string]auth.SigningKey, error) {
+	keys := make(map[string]auth.SigningKey)
+	for _, pair := range pairs {
+		id, secret, ok := strings.Cut(pair, "=")
+		id = strings.TrimSpace(id)
+		if !ok || id == "" || secret == "" {
+			// Don't echo the pair: it holds a secret.
+			return nil, fmt.Errorf("SIGNING_SECRETS: entries must be keyID=secret")
+		}
+		key := keys[id]
+		key.Secrets = append(key.Secrets, secret)
+		keys[id] = key
+	}
+	for _, spec := range clients {
+		id, scopes, ok := strings.Cut(spec, "=")
+		id = strings.TrimSpace(id)
+		key, known := keys[id]
+		if !ok || scopes == "" {
+			return nil, fmt.Errorf("SIGNING_CLIENTS entry %q must be <keyID>=<scope>+<scope>", spec)
+		}
+		if !known {
+			return nil, fmt.Errorf("SIGNING_CLIENTS entry %q: no secret for %q in SIGNING_SECRETS", spec, id)
+		}
+		if key.Scopes != nil {
+			return nil, fmt.Errorf("SIGNING_CLIENTS lists %q twice", id)
+		}
+		key.Scopes = strings.Split(scopes, "+")
+		keys[id] = key
+	}
+	return keys, nil
+}
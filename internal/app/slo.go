@@ -0,0 +1,33 @@
+package app
+
+import (
+	"fmt"
+
+	"go-basics/config"
+	"go-basics/internal/metrics"
+	"go-basics/internal/slo"
+)
+
+// newSLOTracker builds the SLO tracker from configuration.
+// A malformed SLO_ROUTES entry fails startup instead of being ignored,
+// so a typo can't silently turn off alerting for a route.
+func newSLOTracker(reg *metrics.Registry, cfg config.SLOConfig) (*slo.Tracker, error) {
+	if cfg.DefaultAvailability <= 0 || cfg.DefaultAvailability >= 100 {
+		return nil, fmt.Errorf("SLO_DEFAULT_AVAILABILITY must be between 0 and 100 (exclusive), got %g", cfg.DefaultAvailability)
+	}
+	defaults := slo.Objective{
+		Latency:      cfg.DefaultLatency,
+		Availability: cfg.DefaultAvailability / 100,
+	}
+
+	objectives := make([]slo.Objective, 0, len(cfg.Routes))
+	for _, spec := range cfg.Routes {
+		o, err := slo.ParseObjective(spec)
+		if err != nil {
+			return nil, err
+		}
+		objectives = append(objectives, o)
+	}
+
+	return slo.NewTracker(reg, defaults, objectives, cfg.Window), nil
+}
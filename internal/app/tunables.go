@@ -0,0 +1,39 @@
+package app
+
+import (
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/tunables"
+)
+
+// knobs are the runtime tunables (see package tunables). The configuration
+// supplies every default; overrides made through /admin/tunables revert
+// to it when they expire.
+type knobs struct {
+	registry *tunables.Registry
+
+	rateLimitPerIP      *tunables.Value[int]
+	rateLimitPerEmail   *tunables.Value[int]
+	slowQueryThreshold  *tunables.Value[time.Duration]
+	slowQuerySampleRate *tunables.Value[config.Ratio]
+	maintenance         *tunables.Value[bool]
+}
+
+// newKnobs creates the knobs and their registry.
+func newKnobs(cfg *config.Config) *knobs {
+	k := &knobs{
+		rateLimitPerIP: tunables.NewInt("ratelimit.auth.per_ip",
+			"Login/forgot-password requests per window per IP (0 disables)", cfg.Limits.PerIP),
+		rateLimitPerEmail: tunables.NewInt("ratelimit.auth.per_email",
+			"Login/forgot-password requests per window per email (0 disables)", cfg.Limits.PerEmail),
+		slowQueryThreshold: tunables.NewDuration("db.slow_query.threshold",
+			"Log repository queries slower than this (0 disables)", cfg.Database.SlowQueryThreshold),
+		slowQuerySampleRate: tunables.NewRatio("db.slow_query.sample_rate",
+			"Fraction of slow queries logged", cfg.Database.SlowQuerySampleRate),
+		maintenance: tunables.NewBool("maintenance",
+			"Answer 503 to everything but health, login, and admin routes", false),
+	}
+	k.registry = tunables.NewRegistry(k.rateLimitPerIP, k.rateLimitPerEmail, k.slowQueryThreshold, k.slowQuerySampleRate, k.maintenance)
+	return k
+}
@@ -0,0 +1,32 @@
+package app
+
+import (
+	"fmt"
+	"log"
+
+	"go-basics/config"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/encryption"
+	"go-basics/internal/metrics"
+	"go-basics/internal/usercache"
+)
+
+// newUserCache caches repo's lookups by email in USER_CACHE_REDIS_ADDR,
+// dropping users as they change (see package usercache). The caller
+// must start following the change feeds (see Run). mfaCipher is nil
+// without MFA_ENCRYPTION_KEY.
+func (a *application) newUserCache(cfg config.UserCacheConfig, repo user.Repository, mfaCipher *encryption.Cipher, reg *metrics.Registry) (*usercache.Cache, error) {
+	if cfg.FeedInterval <= 0 {
+		return nil, fmt.Errorf("USER_CACHE_FEED_INTERVAL must be positive")
+	}
+	if cfg.FeedOverlap < 0 {
+		return nil, fmt.Errorf("USER_CACHE_FEED_OVERLAP must not be negative")
+	}
+	var opts []usercache.Option
+	if mfaCipher != nil {
+		opts = append(opts, usercache.WithSecretCipher(mfaCipher))
+	}
+	client := a.newRedisClient(cfg.RedisAddrs, cfg.RedisPassword)
+	log.Printf("User cache enabled (TTL %v, change feed every %v)", cfg.TTL, cfg.FeedInterval)
+	return usercache.New(repo, client, "usercache:", cfg.TTL, reg, opts...), nil
+}
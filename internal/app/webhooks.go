@@ -0,0 +1,62 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"go-basics/config"
+	"go-basics/internal/webhook"
+)
+
+// newWebhooks builds a receiver for each sender in WEBHOOK_SECRETS, or
+// returns nil when it's empty.
+//
+// Register each receiver's event handlers here, next to its creation:
+//
+//	if r, ok := reg.Receiver("payments"); ok {
+//	    r.Handle("invoice.paid", billing.InvoicePaid)
+//	}
+//
+// Until a handler is registered for a type, its deliveries are verified
+// and acknowledged, but do nothing.
+func (a *application) newWebhooks(cfg config.WebhookConfig) (*webhook.Registry, error) {
+	if len(cfg.Secrets) == 0 {
+		return nil, nil
+	}
+
+	secrets := make(map[string][]string)
+	for _, pair := range cfg.Secrets {
+		name, secret, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || secret == "" {
+			// Don't echo the pair: it holds a secret.
+			return nil, fmt.Errorf("WEBHOOK_SECRETS: entries must be receiver=secret")
+		}
+		secrets[name] = append(secrets[name], secret)
+	}
+
+	opts := []webhook.Option{webhook.WithTolerance(cfg.Tolerance)}
+	if len(cfg.RedisAddrs) > 0 {
+		client := a.newRedisClient(cfg.RedisAddrs, cfg.RedisPassword)
+		opts = append(opts, webhook.WithReplayCache(webhook.NewRedisReplayCache(client, "webhook:")))
+	}
+
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	receivers := make([]*webhook.Receiver, 0, len(names))
+	for _, name := range names {
+		r, err := webhook.New(name, secrets[name], opts...)
+		if err != nil {
+			return nil, fmt.Errorf("WEBHOOK_SECRETS: %w", err)
+		}
+		receivers = append(receivers, r)
+	}
+	log.Printf("Webhook receivers: %s", strings.Join(names, ", "))
+	return webhook.NewRegistry(receivers...), nil
+}
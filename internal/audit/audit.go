@@ -0,0 +1,171 @@
+// Package audit records who did what, to one or more sinks per category
+// of event.
+//
+// WHY SINKS?
+// An audit trail has more than one reader. Operators want it next to the
+// rest of the logs; compliance may want it somewhere nobody can edit,
+// like an append-only file shipped to write-once storage, or a table the
+// application can only insert into; security may want it in their own
+// collector. A Sink is one of those destinations, and a Logger sends each
+// event to every sink configured for its category.
+//
+// WHY NOT FAIL THE REQUEST WHEN A SINK FAILS?
+// By the time an event is recorded, the action already happened; failing
+// the response wouldn't undo it. A failed write is logged instead (with
+// the event, so it isn't lost), and the other sinks still get it.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Category groups events so each group can go to its own sinks.
+type Category string
+
+// Event categories.
+const (
+	// CategoryAdmin is actions through the admin API: role changes,
+	// impersonation, failover, dead-letter handling, diagnostics.
+	CategoryAdmin Category = "admin"
+
+	// CategoryTunables is runtime knob overrides, resets, and expiries.
+	CategoryTunables Category = "tunables"
+
+	// CategoryAccounts is what the dormancy policy does to accounts on its
+	// own: warnings, disabling, and deletion.
+	CategoryAccounts Category = "accounts"
+
+	// CategorySecurity is changes users make to their own sign-in
+	// security: two-factor authentication on, off, or reset, recovery
+	// codes regenerated, and logins with a recovery code.
+	CategorySecurity Category = "security"
+)
+
+// Categories lists every category, for validating configuration.
+var Categories = []Category{CategoryAdmin, CategoryTunables, CategoryAccounts, CategorySecurity}
+
+// Event is one audited action.
+type Event struct {
+	Time     time.Time `json:"time"`
+	Category Category  `json:"category"`
+	Actor    string    `json:"actor"`   // Who, e.g. "user 7 (impersonated by user 1)"
+	Message  string    `json:"message"` // What, e.g. `assigned role "admin" to user 9`
+
+	// Position in a hash chain, filled in by sinks that keep one (file
+	// and mysql); see Chain.
+	Seq      uint64 `json:"seq,omitempty"`
+	PrevHash string `json:"prev_hash,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+}
+
+// Sink is a destination for events. Write must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+	Close() error
+}
+
+// Logger sends events to the sinks for their category.
+type Logger struct {
+	routes   map[Category][]Sink
+	defaults []Sink // For categories without a route
+	all      []Sink // Each sink once, for Close
+}
+
+// NewLogger creates a logger that writes each category's events to its
+// sinks in routes, and any other category's to defaults. Every sink is
+// closed by Close, once, even if it appears in several routes.
+func NewLogger(defaults []Sink, routes map[Category][]Sink) *Logger {
+	l := &Logger{routes: routes, defaults: defaults}
+	seen := make(map[Sink]bool)
+	add := func(sinks []Sink) {
+		for _, s := range sinks {
+			if !seen[s] {
+				seen[s] = true
+				l.all = append(l.all, s)
+			}
+		}
+	}
+	add(defaults)
+	for _, sinks := range routes {
+		add(sinks)
+	}
+	return l
+}
+
+// Record writes an event to every sink for its category. The event
+// outlives the request that caused it, so ctx's cancellation is ignored:
+// a client hanging up mustn't cut the insert short.
+func (l *Logger) Record(ctx context.Context, category Category, actor, format string, args ...interface{}) {
+	ctx = context.WithoutCancel(ctx)
+	e := Event{
+		// Microseconds are all MySQL keeps; the chain hash must be
+		// computable from what was stored.
+		Time:     time.Now().UTC().Truncate(time.Microsecond),
+		Category: category,
+		Actor:    actor,
+		Message:  fmt.Sprintf(format, args...),
+	}
+	sinks, ok := l.routes[category]
+	if !ok {
+		sinks = l.defaults
+	}
+	for _, s := range sinks {
+		if err := s.Write(ctx, e); err != nil {
+			log.Printf("audit: writing to %T failed: %v; event: %s: %s %s", s, err, e.Category, e.Actor, e.Message)
+		}
+	}
+}
+
+// Close flushes and closes every sink.
+func (l *Logger) Close() error {
+	var errs []error
+	for _, s := range l.all {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogSink writes events to the standard logger, one line each, as audit
+// lines were written before there were sinks:
+//
+//	admin: user 7 assigned role "admin" to user 9
+type LogSink struct{}
+
+// Write implements Sink.
+func (LogSink) Write(_ context.Context, e Event) error {
+	log.Printf("%s: %s %s", e.Category, e.Actor, e.Message)
+	return nil
+}
+
+// Close implements Sink.
+func (LogSink) Close() error { return nil }
+
+// StdoutSink writes events to standard output as JSON lines, for a log
+// shipper that collects container output.
+type StdoutSink struct {
+	mu sync.Mutex
+}
+
+// Write implements Sink.
+func (s *StdoutSink) Write(_ context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = os.Stdout.Write(append(line, '\n'))
+	return err
+}
+
+// Close implements Sink.
+func (s *StdoutSink) Close() error { return nil }
@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GenesisHash is the previous hash of the first record in a chain.
+var GenesisHash = strings.Repeat("0", 64)
+
+// Link is the position of a record in a hash chain.
+type Link struct {
+	Seq  uint64
+	Hash string
+}
+
+// Genesis is the link before the first record.
+var Genesis = Link{Seq: 0, Hash: GenesisHash}
+
+// Chain returns e as the record after prev: numbered one higher, holding
+// prev's hash, and hashed itself.
+//
+// HOW THE CHAIN DETECTS TAMPERING:
+// Each record's hash covers its content and the previous record's hash.
+// Editing a record changes its hash, which no longer matches the
+// prev_hash stored in the next one; deleting a record leaves a gap in the
+// sequence numbers; reordering breaks the prev_hash links. Rewriting the
+// whole chain after an edit is possible for someone who can write to the
+// store, so publish the head (see Verifier.Head) somewhere they can't -
+// a ticket, a signed email, another system's log - and compare it later.
+func (e Event) Chain(prev Link) Event {
+	e.Seq = prev.Seq + 1
+	e.PrevHash = prev.Hash
+	e.Hash = e.ComputeHash()
+	return e
+}
+
+// Link returns the record's position in its chain.
+func (e Event) Link() Link {
+	return Link{Seq: e.Seq, Hash: e.Hash}
+}
+
+// ComputeHash returns the SHA-256 of the record's content and PrevHash,
+// hex-encoded. Verifiers recompute it from the stored fields, so the
+// input is fixed: the fields in this order, as JSON, with the time in UTC
+// to the microsecond (what MySQL keeps).
+func (e Event) ComputeHash() string {
+	content, _ := json.Marshal(struct {
+		Seq      uint64   `json:"seq"`
+		PrevHash string   `json:"prev_hash"`
+		Time     string   `json:"time"`
+		Category Category `json:"category"`
+		Actor    string   `json:"actor"`
+		Message  string   `json:"message"`
+	}{e.Seq, e.PrevHash, e.Time.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano), e.Category, e.Actor, e.Message})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verifier checks records of one chain, read in order.
+type Verifier struct {
+	Checked   int      // Chained records checked
+	Unchained int      // Records from before chaining began
+	First     uint64   // Sequence number of the first chained record
+	Problems  []string // Each sign of tampering found
+
+	prev    Link
+	started bool
+}
+
+// Check verifies the next record.
+func (v *Verifier) Check(e Event) {
+	if e.Hash == "" {
+		if v.started {
+			v.problem(e, "has no hash after chaining began (inserted or edited)")
+		} else {
+			v.Unchained++
+		}
+		return
+	}
+	v.Checked++
+
+	switch {
+	case !v.started:
+		v.started = true
+		v.First = e.Seq
+		if e.Seq == 1 && e.PrevHash != GenesisHash {
+			v.problem(e, "is first but doesn't start from the genesis hash")
+		}
+	case e.Seq != v.prev.Seq+1:
+		if e.Seq > v.prev.Seq {
+			v.problem(e, fmt.Sprintf("follows %d: %d record(s) missing", v.prev.Seq, e.Seq-v.prev.Seq-1))
+		} else {
+			v.problem(e, fmt.Sprintf("follows %d: out of order or duplicated", v.prev.Seq))
+		}
+	case e.PrevHash != v.prev.Hash:
+		v.problem(e, "doesn't link to the record before it (that record was changed)")
+	}
+	if e.ComputeHash() != e.Hash {
+		v.problem(e, "doesn't match its hash (its content was changed)")
+	}
+	v.prev = e.Link()
+}
+
+// Head returns the last record checked: publish it to detect a rewritten
+// chain later.
+func (v *Verifier) Head() Link {
+	return v.prev
+}
+
+// problem records a finding about e.
+func (v *Verifier) problem(e Event, what string) {
+	v.Problems = append(v.Problems, fmt.Sprintf("record %d (%s, %s): %s", e.Seq, e.Time.UTC().Format(time.RFC3339), e.Category, what))
+}
@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Collector batching. A batch is sent when it's full or a second after
+// its first event, whichever is first.
+const (
+	collectorBatchSize  = 100
+	collectorBatchDelay = time.Second
+	collectorBuffer     = 10000 // Events waiting to be sent; more are refused
+	collectorTimeout    = 10 * time.Second
+	collectorRetries    = 3
+)
+
+// ErrCollectorFull is returned when events arrive faster than the
+// collector accepts them.
+var ErrCollectorFull = errors.New("audit collector buffer full")
+
+// CollectorSink sends events to an external collector over HTTP, as a
+// JSON array per POST, in the background.
+//
+// WHY IN THE BACKGROUND?
+// A request shouldn't wait on another team's service. Events are
+// buffered and sent in batches; a batch that still fails after a few
+// attempts is logged event by event and dropped. That makes the
+// collector a copy, not the record: pair it with the file or MySQL sink
+// where losing an event isn't acceptable.
+type CollectorSink struct {
+	url    string
+	token  string // Sent as a bearer token, if set
+	client *http.Client
+
+	events chan Event
+	done   chan struct{}
+	once   sync.Once
+}
+
+// NewCollectorSink starts sending events to url.
+func NewCollectorSink(url, token string) *CollectorSink {
+	s := &CollectorSink{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: collectorTimeout},
+		events: make(chan Event, collectorBuffer),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+// Write implements Sink. It only queues the event.
+func (s *CollectorSink) Write(_ context.Context, e Event) error {
+	select {
+	case s.events <- e:
+		return nil
+	default:
+		return ErrCollectorFull
+	}
+}
+
+// Close implements Sink: it sends what's queued, then stops.
+func (s *CollectorSink) Close() error {
+	s.once.Do(func() { close(s.events) })
+	<-s.done
+	// Kept-alive connections each hold two goroutines until the
+	// collector's idle timeout; nothing will reuse them now.
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// run batches queued events until Close.
+func (s *CollectorSink) run() {
+	defer close(s.done)
+	var batch []Event
+	timer := time.NewTimer(collectorBatchDelay)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) > 0 {
+			s.send(batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case e, ok := <-s.events:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(collectorBatchDelay)
+			}
+			batch = append(batch, e)
+			if len(batch) >= collectorBatchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// send posts a batch, retrying with a short backoff.
+func (s *CollectorSink) send(batch []Event) {
+	body, err := json.Marshal(batch)
+	if err == nil {
+		for attempt := 1; attempt <= collectorRetries; attempt++ {
+			if err = s.post(body); err == nil {
+				return
+			}
+			if attempt < collectorRetries {
+				time.Sleep(time.Duration(attempt) * time.Second)
+			}
+		}
+	}
+	log.Printf("audit: sending %d event(s) to the collector failed: %v", len(batch), err)
+	for _, e := range batch {
+		log.Printf("audit: undelivered event: %s: %s %s", e.Category, e.Actor, e.Message)
+	}
+}
+
+// post sends one batch.
+func (s *CollectorSink) post(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileSink appends events to a file as JSON lines, and rotates it once
+// it reaches a size.
+//
+// WRITE-ONCE:
+// The file is only ever opened for appending. A rotated file is renamed
+// with its rotation time and made read-only, so nothing the application
+// does will change it again; ship rotated files to write-once storage
+// (e.g. an object store bucket with a retention lock) from there.
+//
+// Records are hash-chained (see Event.Chain), and the chain runs on
+// across rotations: verify the rotated files and the current one in
+// order with `api audit-verify file`. One process per file: two
+// instances appending to the same file would interleave two chains.
+type FileSink struct {
+	path    string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	prev Link // The last record written
+}
+
+// NewFileSink opens (or creates) path for appending, continuing the hash
+// chain from its last record (or the newest rotated file's). maxSize is
+// the size in bytes at which the file is rotated; 0 never rotates.
+func NewFileSink(path string, maxSize int64) (*FileSink, error) {
+	s := &FileSink{path: path, maxSize: maxSize}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	prev, err := chainHead(path)
+	if err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	s.prev = prev
+	return s, nil
+}
+
+// RotatedFiles returns the rotated files of the audit file at path,
+// oldest first. Their names end in their rotation time, so name order is
+// time order.
+func RotatedFiles(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// Write implements Sink. Each event is one write of one line, so lines
+// from concurrent writers never interleave.
+func (s *FileSink) Write(_ context.Context, e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e = e.Chain(s.prev)
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if s.maxSize > 0 && s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("appending audit event: %w", err)
+	}
+	s.prev = e.Link()
+	return nil
+}
+
+// Close implements Sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// open opens the current file for appending. The caller must hold s.mu
+// (or be the constructor).
+func (s *FileSink) open() error {
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening audit file: %w", err)
+	}
+	s.file, s.size = f, info.Size()
+	return nil
+}
+
+// rotate renames the full file aside, read-only, and starts a new one.
+// The caller must hold s.mu.
+func (s *FileSink) rotate() error {
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("rotating audit file: %w", err)
+	}
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("rotating audit file: %w", err)
+	}
+	// Nanoseconds keep two rotations in the same second apart.
+	rotated := s.path + "." + time.Now().UTC().Format("20060102T150405.000000000Z")
+	if err := os.Rename(s.path, rotated); err != nil {
+		// Keep appending to the old file rather than lose events; the
+		// next write tries again.
+		log.Printf("audit: rotating %s: %v", s.path, err)
+		return s.open()
+	}
+	if err := s.open(); err != nil {
+		return err
+	}
+	if err := os.Chmod(rotated, 0o400); err != nil {
+		// The event still goes to the new file; only the old one's
+		// protection failed.
+		log.Printf("audit: making %s read-only: %v", rotated, err)
+	}
+	return nil
+}
+
+// chainHead returns the last record's link in the audit file at path,
+// or in the newest rotated file if path is empty, or Genesis if there
+// are no records yet.
+func chainHead(path string) (Link, error) {
+	rotated, err := RotatedFiles(path)
+	if err != nil {
+		return Link{}, err
+	}
+	files := append(rotated, path)
+	for i := len(files) - 1; i >= 0; i-- {
+		e, ok, err := lastEvent(files[i])
+		if err != nil {
+			return Link{}, err
+		}
+		if ok {
+			return e.Link(), nil
+		}
+	}
+	return Genesis, nil
+}
+
+// lastEventMaxLine bounds how far back lastEvent looks for a line start.
+const lastEventMaxLine = 64 << 10
+
+// lastEvent reads the last complete record in a file, if there is one.
+func lastEvent(path string) (Event, bool, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Event{}, false, nil
+	}
+	if err != nil {
+		return Event{}, false, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Event{}, false, err
+	}
+
+	size := min(info.Size(), lastEventMaxLine)
+	tail := make([]byte, size)
+	if _, err := f.ReadAt(tail, info.Size()-size); err != nil && !errors.Is(err, io.EOF) {
+		return Event{}, false, err
+	}
+	lines := bytes.Split(bytes.TrimRight(tail, "\n"), []byte("\n"))
+	last := lines[len(lines)-1]
+	if len(bytes.TrimSpace(last)) == 0 {
+		return Event{}, false, nil
+	}
+	var e Event
+	if err := json.Unmarshal(last, &e); err != nil {
+		return Event{}, false, fmt.Errorf("reading the last record of %s: %w", path, err)
+	}
+	return e, true, nil
+}
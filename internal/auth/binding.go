@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"time"
+)
+
+// ErrBindingMismatch is returned by CheckBinding for a token presented
+// from another network or device than the one it was issued to.
+var ErrBindingMismatch = errors.New("token is bound to another client")
+
+// Binding modes, as named in configuration.
+const (
+	// BindIP binds tokens to the client's network: its IP address cut to
+	// a prefix, so a client moving between addresses of the same network
+	// (a NAT pool, an IPv6 privacy address) keeps its token.
+	BindIP = "ip"
+
+	// BindDevice binds tokens to a device ID the client sends in a
+	// header. Clients that don't send one are bound by IP instead, and
+	// such a token keeps working from that network once the client does
+	// send one (e.g. a browser signed in by SSO, then calling the API).
+	BindDevice = "device"
+
+	// BindCert binds tokens to the client certificate the request came
+	// with (MTLS_CLIENT_AUTH), like RFC 8705's certificate-bound tokens.
+	// A thief needs the certificate's private key, which never leaves
+	// the client. Clients without one are bound by IP instead.
+	BindCert = "cert"
+
+	// BindCookie binds tokens to a random secret in an HttpOnly cookie
+	// (see Binder.Middleware). Script can't read the cookie, so a token
+	// stolen from a page's storage by XSS is useless from anywhere else.
+	// For browser apps served from the API's origin; other clients would
+	// have to keep the cookie like a browser.
+	BindCookie = "cookie"
+)
+
+// bindingCookieMaxAge is how long a browser keeps its binding secret.
+// Losing it costs a refresh, so it can be long.
+const bindingCookieMaxAge = 365 * 24 * time.Hour
+
+// Binder computes the fingerprint of the client behind a request, which
+// bound tokens carry in their "bnd" claim.
+//
+// WHY BIND TOKENS?
+// A bearer token works for whoever bears it: one copied out of a log, a
+// browser extension, or a proxy works just as well from the thief's
+// machine, until it expires. A bound token only works from the network
+// (or device) it was issued to, so a stolen one is useless elsewhere.
+// A client that moves on gets a 401 and refreshes, as it would after
+// expiry; the new token is bound to where it is now.
+//
+// The network and the device ID can be spoofed by a determined thief who
+// knows them; a certificate or an HttpOnly cookie is a secret they'd
+// have to steal too, from somewhere a bearer token never goes.
+//
+// WHY A KEYED HASH?
+// JWTs are readable by anyone who has one. A plain hash of an IPv4 /24
+// prefix can be reversed by trying all 16 million of them; an HMAC can't
+// be without the key.
+type Binder struct {
+	mode   string
+	key    []byte
+	header string // Device ID header, for BindDevice
+	cookie string // Secret cookie, for BindCookie
+	ipv4   int    // Prefix lengths the IP is cut to
+	ipv6   int
+}
+
+// BinderOption configures optional Binder behavior.
+type BinderOption func(*Binder)
+
+// WithIPPrefixes sets the prefix lengths client IPs are cut to, for IPv4
+// and IPv6. Longer is stricter: 32 and 128 bind to the exact address.
+func WithIPPrefixes(ipv4, ipv6 int) BinderOption {
+	return func(b *Binder) {
+		b.ipv4, b.ipv6 = ipv4, ipv6
+	}
+}
+
+// WithDeviceHeader sets the header BindDevice reads the device ID from.
+func WithDeviceHeader(header string) BinderOption {
+	return func(b *Binder) {
+		b.header = header
+	}
+}
+
+// WithBindingCookie sets the name of the cookie BindCookie keeps the
+// secret in. A "__Host-" name makes browsers insist it's Secure, set by
+// this host only, and for every path.
+func WithBindingCookie(name string) BinderOption {
+	return func(b *Binder) {
+		b.cookie = name
+	}
+}
+
+// NewBinder creates a Binder for mode (BindIP, BindDevice, BindCert, or
+// BindCookie) that hashes fingerprints with key. Every instance
+// validating the tokens needs the same key. Defaults: a /24 IPv4 and
+// /64 IPv6 prefix, the X-Device-ID header, and the
+// __Host-token-binding cookie.
+func NewBinder(mode string, key []byte, opts ...BinderOption) (*Binder, error) {
+	switch mode {
+	case BindIP, BindDevice, BindCert, BindCookie:
+	default:
+		return nil, fmt.Errorf("unknown token binding mode %q (want %q, %q, %q, or %q)", mode, BindIP, BindDevice, BindCert, BindCookie)
+	}
+	if len(key) == 0 {
+		return nil, errors.New("token binding needs a key")
+	}
+	b := &Binder{mode: mode, key: key, header: "X-Device-ID", cookie: "__Host-token-binding", ipv4: 24, ipv6: 64}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.ipv4 < 0 || b.ipv4 > 32 || b.ipv6 < 0 || b.ipv6 > 128 {
+		return nil, fmt.Errorf("IP prefix lengths must be 0-32 (IPv4) and 0-128 (IPv6), got %d and %d", b.ipv4, b.ipv6)
+	}
+	return b, nil
+}
+
+// Fingerprint returns the fingerprint a token issued for the request is
+// bound to: its certificate's, cookie's, or device ID's, as the mode
+// asks and if it has one, or else its network's.
+//
+// The IP is the TCP peer address; X-Forwarded-For is ignored because any
+// client can set it (see ratelimit.ByIP). Behind a reverse proxy, every
+// client shares the proxy's address, so use another mode or have the
+// proxy overwrite RemoteAddr.
+func (b *Binder) Fingerprint(r *http.Request) string {
+	return b.hash(b.subjects(r)[0])
+}
+
+// matches reports whether the request comes from the client fingerprint
+// was taken from: the same certificate, cookie, or device, or the same
+// network. A token bound to a certificate only matches that
+// certificate, not the network it was issued on: falling back to the
+// network is for clients that had nothing stronger to begin with.
+func (b *Binder) matches(fingerprint string, r *http.Request) bool {
+	for _, subject := range b.subjects(r) {
+		if hmac.Equal([]byte(fingerprint), []byte(b.hash(subject))) {
+			return true
+		}
+	}
+	return false
+}
+
+// subjects returns what identifies the client behind r, strongest
+// first: what the mode binds to, if the request has it, then its
+// network, which every request has.
+func (b *Binder) subjects(r *http.Request) []string {
+	network := "ip:" + b.network(r.RemoteAddr)
+	switch b.mode {
+	case BindDevice:
+		if id := r.Header.Get(b.header); id != "" {
+			return []string{"device:" + id, network}
+		}
+	case BindCert:
+		// Only verified certificates get here: the handshake refuses
+		// others (see MTLS_CLIENT_AUTH).
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			thumbprint := sha256.Sum256(r.TLS.PeerCertificates[0].Raw)
+			return []string{"cert:" + base64.RawURLEncoding.EncodeToString(thumbprint[:]), network}
+		}
+	case BindCookie:
+		if c, err := r.Cookie(b.cookie); err == nil && c.Value != "" {
+			return []string{"cookie:" + c.Value, network}
+		}
+	}
+	return []string{network}
+}
+
+// Middleware gives browsers the secret cookie BindCookie binds tokens
+// to, on their first request without one. That request sees the cookie
+// too, so a token issued by it (a login) is already bound to it. In
+// other modes it's next unchanged.
+//
+// WHY STRICT AND HTTPONLY?
+// HttpOnly keeps the secret from the page's scripts, which is the
+// point: XSS can read a token from storage but not this. SameSite=Strict
+// only costs cross-site requests, which don't carry the token anyway.
+// The cookie authorizes nothing on its own, so forging requests with it
+// (CSRF) gains nothing either.
+func (b *Binder) Middleware(next http.Handler) http.Handler {
+	if b.mode != BindCookie {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, err := r.Cookie(b.cookie); err != nil || c.Value == "" {
+			secret := make([]byte, 32)
+			rand.Read(secret)
+			c := &http.Cookie{
+				Name:     b.cookie,
+				Value:    base64.RawURLEncoding.EncodeToString(secret),
+				Path:     "/",
+				MaxAge:   int(bindingCookieMaxAge / time.Second),
+				Secure:   true,
+				HttpOnly: true,
+				SameSite: http.SameSiteStrictMode,
+			}
+			http.SetCookie(w, c)
+			r = r.Clone(r.Context())
+			r.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hash is the fingerprint of subject. The kind prefix ("ip:",
+// "device:", "cert:", "cookie:") is hashed in, so a device ID can't pass
+// for a network.
+func (b *Binder) hash(subject string) string {
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(subject))
+	// 128 bits is plenty to tell clients apart, and keeps tokens short.
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// network returns the prefix of the address in remoteAddr, e.g.
+// "203.0.113.0/24". An address that doesn't parse is used as is.
+func (b *Binder) network(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	// An IPv4 client on a dual-stack listener shows up as ::ffff:a.b.c.d.
+	addr = addr.Unmap()
+	bits := b.ipv6
+	if addr.Is4() {
+		bits = b.ipv4
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return host
+	}
+	return prefix.String()
+}
+
+// WithBinding makes the manager bind tokens issued with BoundTo, and
+// lets CheckBinding enforce it.
+func WithBinding(binder *Binder) Option {
+	return func(m *JWTManager) {
+		m.binder = binder
+	}
+}
+
+// Binder returns the manager's Binder, or nil without one. Servers wrap
+// their handler in its Middleware.
+func (m *JWTManager) Binder() *Binder {
+	return m.binder
+}
+
+// BoundTo binds the token to the client behind r, if the manager has a
+// Binder (see WithBinding). Without one it does nothing, so handlers can
+// always pass it.
+func BoundTo(r *http.Request) TokenOption {
+	return func(c *Claims) {
+		c.boundTo = r
+	}
+}
+
+// BoundLike gives the token the same binding as claims, for a token
+// issued to the client presenting claims, e.g. after a password change.
+// That includes its DPoP key (see BoundToKey).
+func BoundLike(claims *Claims) TokenOption {
+	return func(c *Claims) {
+		c.Binding = claims.Binding
+		c.Confirmation = claims.Confirmation
+	}
+}
+
+// bind fills in the binding requested by BoundTo.
+func (m *JWTManager) bind(c *Claims) {
+	if c.boundTo != nil && m.binder != nil {
+		c.Binding = m.binder.Fingerprint(c.boundTo)
+	}
+	c.boundTo = nil
+}
+
+// CheckBinding returns ErrBindingMismatch if the token is bound to
+// another client than the one behind r. Without a Binder, or for an
+// unbound token, it returns nil.
+//
+// Unbound tokens are let through so that turning binding on doesn't sign
+// everyone out: the ones issued before expire within a token lifetime.
+func (m *JWTManager) CheckBinding(claims *Claims, r *http.Request) error {
+	if m.binder == nil || claims.Binding == "" {
+		return nil
+	}
+	if !m.binder.matches(claims.Binding, r) {
+		return ErrBindingMismatch
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrReservedClaim is returned when an extra claim would overwrite one
+// the JWTManager sets itself (user_id, exp, ...).
+var ErrReservedClaim = errors.New("claim name is reserved")
+
+// reservedClaims are the JSON names of Claims' own fields, including
+// the registered claims from RFC 7519. Extra claims can't use them.
+var reservedClaims = map[string]bool{
+	"user_id": true, "email": true, "roles": true, "scopes": true, "token_version": true, "act": true, "bnd": true, "cnf": true, "enc": true,
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+}
+
+// WithExtraClaims adds application-specific claims to a single token.
+// Names must not clash with the built-in claims (see ErrReservedClaim).
+//
+// WHY NOT ADD A FIELD TO Claims?
+// Claims is shared by every service that validates our tokens. A tenant
+// ID matters to the billing service, a plan tier to the API gateway; if
+// each became a struct field, every consumer would carry every field.
+// Extra claims let the caller that needs one add it without touching auth.
+func WithExtraClaims(extra map[string]interface{}) TokenOption {
+	return func(c *Claims) {
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{}, len(extra))
+		}
+		for name, value := range extra {
+			c.Extra[name] = value
+		}
+	}
+}
+
+// GenerateTokenWithClaims issues a token carrying extra claims, e.g.
+// {"tenant_id": "acme", "plan": "pro"}. The token has no roles; to issue
+// one with roles as well, use GenerateToken with WithExtraClaims.
+func (m *JWTManager) GenerateTokenWithClaims(userID uint64, email string, extra map[string]interface{}, opts ...TokenOption) (string, error) {
+	return m.GenerateToken(userID, email, nil, append([]TokenOption{WithExtraClaims(extra)}, opts...)...)
+}
+
+// ClaimValue returns the extra claim called name, converted to T.
+// It reports false if the claim is missing or doesn't fit in T.
+//
+// Usage:
+//
+//	tenant, ok := auth.ClaimValue[string](claims, "tenant_id")
+//	limits, ok := auth.ClaimValue[map[string]int](claims, "limits")
+//
+// WHY GO THROUGH JSON?
+// A parsed token holds the raw JSON of each claim, while a freshly
+// issued one holds whatever the caller passed in. Round-tripping through
+// JSON treats both the same, and turns a JSON number into an int,
+// uint64, or float64 - whichever T asks for.
+func ClaimValue[T any](c *Claims, name string) (T, bool) {
+	var value T
+	raw, ok := c.Extra[name]
+	if !ok {
+		return value, false
+	}
+
+	data, ok := raw.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(raw); err != nil {
+			return value, false
+		}
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return value, false
+	}
+	return value, true
+}
+
+// checkExtraClaims rejects extra claims that use a reserved name.
+func checkExtraClaims(extra map[string]interface{}) error {
+	for name := range extra {
+		if reservedClaims[name] {
+			return fmt.Errorf("%w: %q", ErrReservedClaim, name)
+		}
+	}
+	return nil
+}
+
+// claimsFields is Claims without its JSON methods, so MarshalJSON and
+// UnmarshalJSON can encode the struct fields without calling themselves.
+type claimsFields Claims
+
+// MarshalJSON writes the struct fields and the extra claims as one flat
+// JSON object, the way every other JWT library expects to find them.
+func (c Claims) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(claimsFields(c))
+	if err != nil || len(c.Extra) == 0 {
+		return data, err
+	}
+	if err := checkExtraClaims(c.Extra); err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for name, value := range c.Extra {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("encoding claim %q: %w", name, err)
+		}
+		fields[name] = encoded
+	}
+	return json.Marshal(fields)
+}
+
+// UnmarshalJSON fills the struct fields and collects every other claim
+// into Extra as raw JSON (decoded on demand by ClaimValue).
+func (c *Claims) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*claimsFields)(c)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	c.Extra = nil
+	for name, raw := range fields {
+		if reservedClaims[name] {
+			continue
+		}
+		if c.Extra == nil {
+			c.Extra = make(map[string]interface{})
+		}
+		c.Extra[name] = raw
+	}
+	return nil
+}
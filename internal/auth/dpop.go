@@ -0,0 +1,471 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoP headers and the Authorization scheme of DPoP-bound tokens
+// (RFC 9449). A client proves it holds a key by signing a short JWT per
+// request, the proof, with it:
+//
+//	Authorization: DPoP eyJhbGciOiJFUzI1NiIs...
+//	DPoP: eyJ0eXAiOiJkcG9wK2p3dCIs...
+const (
+	DPoPScheme      = "DPoP"
+	DPoPHeader      = "DPoP"
+	DPoPNonceHeader = "DPoP-Nonce"
+)
+
+// Limits on DPoP proofs.
+const (
+	// DefaultDPoPMaxAge is how far a proof's iat may be from our clock,
+	// either way, and how long a server nonce stays good.
+	DefaultDPoPMaxAge = 5 * time.Minute
+
+	// maxDPoPJTI bounds the proof's jti, which becomes a replay cache key.
+	maxDPoPJTI = 128
+
+	// dpopProofType is the typ header every proof has, so no other JWT
+	// signed with the same key can pass for one.
+	dpopProofType = "dpop+jwt"
+)
+
+// dpopAlgorithms are the algorithms proofs may be signed with: the
+// asymmetric ones in common use. A symmetric one would mean sharing the
+// key with us, which defeats proving possession of it.
+var dpopAlgorithms = []string{"ES256", "ES384", "RS256", "PS256", "EdDSA"}
+
+// Sentinel errors, returned by DPoPVerifier.Verify. FailureCause maps
+// each to its cause.
+var (
+	// ErrInvalidDPoPProof is returned when the request has no proof, or
+	// one that doesn't check out: a bad signature or key, another
+	// method or URL, too old, or for another access token.
+	ErrInvalidDPoPProof = errors.New("invalid DPoP proof")
+
+	// ErrDPoPNonce is returned when server nonces are required and the
+	// proof has none, or a stale one. The client retries with the one
+	// in the response's DPoP-Nonce header.
+	ErrDPoPNonce = errors.New("DPoP proof needs a fresh server nonce")
+
+	// ErrReplayedDPoPProof is returned for a proof seen before.
+	ErrReplayedDPoPProof = errors.New("DPoP proof was already used")
+)
+
+// DPoPVerifier checks DPoP proofs, for tokens bound to a key the client
+// holds (see BoundToKey and WithDPoP).
+//
+// WHY DPoP?
+// A bound token (see Binder) is only as strong as what it's bound to.
+// A client certificate is the strongest, but needs mTLS, which browsers
+// and mobile apps behind TLS-terminating proxies rarely get. With DPoP,
+// the client makes its own key pair and signs every request's proof
+// with it; tokens carry the key's thumbprint ("cnf.jkt"). A stolen token
+// is useless without the private key, which never leaves the client,
+// and a stolen proof only works for the one request it was made for.
+//
+// WHY SERVER NONCES?
+// A proof's iat is set by the client, so a proof made ahead of time on
+// a compromised client could be saved for later. With nonces required
+// (see WithDPoPNonces), a proof must carry a nonce we handed out
+// recently, so it can't predate it. Nonces are stateless, an HMAC of
+// when they were issued, so every instance accepts every other's.
+type DPoPVerifier struct {
+	maxAge   time.Duration
+	jtis     NonceCache
+	nonceKey []byte   // Signs server nonces; nil when they aren't required
+	baseURL  *url.URL // Public URL proofs' htu is checked against; nil to use the request's
+	now      func() time.Time
+}
+
+// DPoPOption configures optional DPoPVerifier behavior.
+type DPoPOption func(*DPoPVerifier)
+
+// WithDPoPNonces requires proofs to carry a server nonce, signed with
+// key. Every instance needs the same key.
+func WithDPoPNonces(key []byte) DPoPOption {
+	return func(v *DPoPVerifier) {
+		v.nonceKey = key
+	}
+}
+
+// WithDPoPBaseURL checks proofs' htu against base, the API's public URL
+// (e.g. "https://api.example.com"), instead of the URL the request
+// arrived at. Behind a proxy that terminates TLS or rewrites the host,
+// the two differ, and the client signs the public one.
+func WithDPoPBaseURL(base *url.URL) DPoPOption {
+	return func(v *DPoPVerifier) {
+		v.baseURL = base
+	}
+}
+
+// NewDPoPVerifier creates a verifier accepting proofs issued up to
+// maxAge (DefaultDPoPMaxAge if zero) from now and remembering their jti
+// in jtis.
+func NewDPoPVerifier(maxAge time.Duration, jtis NonceCache, opts ...DPoPOption) *DPoPVerifier {
+	if maxAge <= 0 {
+		maxAge = DefaultDPoPMaxAge
+	}
+	v := &DPoPVerifier{maxAge: maxAge, jtis: jtis, now: time.Now}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v
+}
+
+// dpopClaims are a proof's claims.
+type dpopClaims struct {
+	Method      string `json:"htm"`
+	URL         string `json:"htu"`
+	AccessToken string `json:"ath,omitempty"` // Hash of the access token it's presented with
+	Nonce       string `json:"nonce,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Verify checks r's DPoP proof and claims its jti, and returns the
+// thumbprint of the key that signed it (RFC 7638), which tokens are
+// bound to. accessToken is the token the request presents, which the
+// proof must be for; "" for a token request (login, refresh).
+//
+// Besides the sentinel errors, it fails when the replay cache can't be
+// reached: the proof may be fine, but can't be let through unchecked.
+func (v *DPoPVerifier) Verify(r *http.Request, accessToken string) (string, error) {
+	proofs := r.Header.Values(DPoPHeader)
+	if len(proofs) != 1 {
+		return "", fmt.Errorf("%w: want one %s header, got %d", ErrInvalidDPoPProof, DPoPHeader, len(proofs))
+	}
+
+	var claims dpopClaims
+	var thumbprint string
+	_, err := jwt.ParseWithClaims(proofs[0], &claims, func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != dpopProofType {
+			return nil, fmt.Errorf("typ must be %q", dpopProofType)
+		}
+		jwk, ok := t.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("no jwk header")
+		}
+		key, jkt, err := parseDPoPKey(jwk, t.Method.Alg())
+		thumbprint = jkt
+		return key, err
+	}, jwt.WithValidMethods(dpopAlgorithms))
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidDPoPProof, err)
+	}
+
+	switch {
+	case claims.ID == "" || len(claims.ID) > maxDPoPJTI:
+		return "", fmt.Errorf("%w: missing or overlong jti", ErrInvalidDPoPProof)
+	case claims.Method != r.Method:
+		return "", fmt.Errorf("%w: made for %s, not %s", ErrInvalidDPoPProof, claims.Method, r.Method)
+	case !sameDPoPURL(claims.URL, v.requestURL(r)):
+		return "", fmt.Errorf("%w: made for another URL", ErrInvalidDPoPProof)
+	case claims.IssuedAt == nil:
+		return "", fmt.Errorf("%w: no iat", ErrInvalidDPoPProof)
+	}
+	if age := v.now().Sub(claims.IssuedAt.Time); age > v.maxAge || age < -v.maxAge {
+		return "", fmt.Errorf("%w: issued %v ago", ErrInvalidDPoPProof, age.Round(time.Second))
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		if !hmac.Equal([]byte(claims.AccessToken), []byte(base64.RawURLEncoding.EncodeToString(hash[:]))) {
+			return "", fmt.Errorf("%w: made for another access token", ErrInvalidDPoPProof)
+		}
+	}
+	if v.nonceKey != nil && !v.validNonce(claims.Nonce) {
+		return "", ErrDPoPNonce
+	}
+
+	// Claimed last, like a signed request's nonce, so invalid proofs
+	// can't fill the cache. Keyed by thumbprint too: jti values are
+	// only unique per client.
+	fresh, err := v.jtis.Claim(r.Context(), "dpop:"+thumbprint+":"+claims.ID, 2*v.maxAge)
+	if err != nil {
+		return "", fmt.Errorf("DPoP replay cache: %w", err)
+	}
+	if !fresh {
+		return "", ErrReplayedDPoPProof
+	}
+	return thumbprint, nil
+}
+
+// Nonce returns a fresh server nonce for the DPoP-Nonce header, or ""
+// when nonces aren't required. It's good for maxAge.
+func (v *DPoPVerifier) Nonce() string {
+	if v.nonceKey == nil {
+		return ""
+	}
+	issued := binary.BigEndian.AppendUint64(nil, uint64(v.now().Unix()))
+	return base64.RawURLEncoding.EncodeToString(append(issued, v.nonceMAC(issued)...))
+}
+
+// validNonce reports whether nonce is one Nonce issued, within maxAge.
+func (v *DPoPVerifier) validNonce(nonce string) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(raw) != 8+16 {
+		return false
+	}
+	if !hmac.Equal(raw[8:], v.nonceMAC(raw[:8])) {
+		return false
+	}
+	age := v.now().Sub(time.Unix(int64(binary.BigEndian.Uint64(raw[:8])), 0))
+	return age <= v.maxAge && age >= -v.maxAge
+}
+
+// nonceMAC is the MAC of a nonce's issue time, cut to 128 bits.
+func (v *DPoPVerifier) nonceMAC(issued []byte) []byte {
+	mac := hmac.New(sha256.New, v.nonceKey)
+	mac.Write([]byte("dpop-nonce:"))
+	mac.Write(issued)
+	return mac.Sum(nil)[:16]
+}
+
+// requestURL is the URL r was sent to, as the client saw it: without
+// query or fragment, which htu leaves out.
+func (v *DPoPVerifier) requestURL(r *http.Request) string {
+	if v.baseURL != nil {
+		return strings.TrimSuffix(v.baseURL.String(), "/") + r.URL.EscapedPath()
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + r.URL.EscapedPath()
+}
+
+// sameDPoPURL compares a proof's htu with the request URL the way RFC
+// 9449 asks: without query and fragment, with the scheme and host
+// lowercased and default ports dropped.
+func sameDPoPURL(htu, want string) bool {
+	a, err1 := normalizeDPoPURL(htu)
+	b, err2 := normalizeDPoPURL(want)
+	return err1 == nil && err2 == nil && a == b
+}
+
+func normalizeDPoPURL(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if scheme == "https" {
+		host = strings.TrimSuffix(host, ":443")
+	} else if scheme == "http" {
+		host = strings.TrimSuffix(host, ":80")
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	return scheme + "://" + host + path, nil
+}
+
+// dpopKeyCurves are the curves of the EC algorithms proofs may use.
+var dpopKeyCurves = map[string]struct {
+	name  string
+	curve elliptic.Curve
+}{
+	"ES256": {"P-256", elliptic.P256()},
+	"ES384": {"P-384", elliptic.P384()},
+}
+
+// parseDPoPKey turns a proof's jwk header into the public key that
+// verifies it, for alg, and returns the key's RFC 7638 thumbprint: the
+// SHA-256 of its required members, as JSON in lexicographic order.
+func parseDPoPKey(jwk map[string]interface{}, alg string) (interface{}, string, error) {
+	member := func(name string) string {
+		s, _ := jwk[name].(string)
+		return s
+	}
+	if _, private := jwk["d"]; private {
+		return nil, "", errors.New("jwk must be a public key")
+	}
+
+	var key interface{}
+	var members interface{}
+	switch kty := member("kty"); {
+	case kty == "EC" && dpopKeyCurves[alg].curve != nil:
+		curve := dpopKeyCurves[alg]
+		if member("crv") != curve.name {
+			return nil, "", fmt.Errorf("%s needs a %s key", alg, curve.name)
+		}
+		x, err1 := base64.RawURLEncoding.DecodeString(member("x"))
+		y, err2 := base64.RawURLEncoding.DecodeString(member("y"))
+		size := (curve.curve.Params().BitSize + 7) / 8
+		if err1 != nil || err2 != nil || len(x) != size || len(y) != size {
+			return nil, "", errors.New("malformed EC key")
+		}
+		pub, err := ecdsa.ParseUncompressedPublicKey(curve.curve, append(append([]byte{4}, x...), y...))
+		if err != nil {
+			return nil, "", err
+		}
+		key = pub
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{curve.name, kty, member("x"), member("y")}
+	case kty == "RSA" && (alg == "RS256" || alg == "PS256"):
+		n, err1 := base64.RawURLEncoding.DecodeString(member("n"))
+		e, err2 := base64.RawURLEncoding.DecodeString(member("e"))
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			return nil, "", errors.New("malformed RSA key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if pub.N.BitLen() < 2048 || pub.E < 3 {
+			return nil, "", errors.New("RSA key must have at least 2048 bits")
+		}
+		key = pub
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{member("e"), kty, member("n")}
+	case kty == "OKP" && alg == "EdDSA":
+		x, err := base64.RawURLEncoding.DecodeString(member("x"))
+		if member("crv") != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, "", errors.New("EdDSA needs an Ed25519 key")
+		}
+		key = ed25519.PublicKey(x)
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{"Ed25519", kty, member("x")}
+	default:
+		return nil, "", fmt.Errorf("jwk of type %q can't verify %s", kty, alg)
+	}
+
+	canonical, err := json.Marshal(members)
+	if err != nil {
+		return nil, "", err
+	}
+	thumbprint := sha256.Sum256(canonical)
+	return key, base64.RawURLEncoding.EncodeToString(thumbprint[:]), nil
+}
+
+// SignDPoP adds a DPoP proof for r, signed with key (ES256), to its
+// headers. accessToken is the token r presents, "" for a token request;
+// nonce is the last DPoP-Nonce the server sent, "" before the first.
+//
+// For Go clients of the API, like SignRequest:
+//
+//	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader) // Once per client
+//	req, _ := http.NewRequest("GET", api+"/me", nil)
+//	req.Header.Set("Authorization", "DPoP "+token)
+//	if err := auth.SignDPoP(req, key, token, nonce); err != nil { ... }
+func SignDPoP(r *http.Request, key *ecdsa.PrivateKey, accessToken, nonce string) error {
+	if key.Curve != elliptic.P256() {
+		return errors.New("SignDPoP needs a P-256 key")
+	}
+	point, err := key.PublicKey.Bytes()
+	if err != nil {
+		return err
+	}
+	jti := make([]byte, 16)
+	rand.Read(jti)
+
+	target := *r.URL
+	target.RawQuery, target.Fragment = "", ""
+	claims := dpopClaims{
+		Method: r.Method,
+		URL:    target.String(),
+		Nonce:  nonce,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       base64.RawURLEncoding.EncodeToString(jti),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		claims.AccessToken = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = dpopProofType
+	token.Header["jwk"] = map[string]string{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+		"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+	}
+	proof, err := token.SignedString(key)
+	if err != nil {
+		return err
+	}
+	r.Header.Set(DPoPHeader, proof)
+	return nil
+}
+
+// WithDPoP lets the manager bind tokens to DPoP keys (see BoundToKey
+// and ProofKey), with proofs checked by verifier.
+func WithDPoP(verifier *DPoPVerifier) Option {
+	return func(m *JWTManager) {
+		m.dpop = verifier
+	}
+}
+
+// ProofKey checks the DPoP proof on a token request (login, refresh)
+// and returns the thumbprint of its key, to bind the new tokens to with
+// BoundToKey. It returns "" for a request without a proof, or when DPoP
+// isn't enabled: the client gets a plain bearer token.
+func (m *JWTManager) ProofKey(r *http.Request) (string, error) {
+	if m.dpop == nil || r.Header.Get(DPoPHeader) == "" {
+		return "", nil
+	}
+	return m.dpop.Verify(r, "")
+}
+
+// DPoPNonce returns a fresh DPoP server nonce, or "" when DPoP or its
+// nonces aren't enabled.
+func (m *JWTManager) DPoPNonce() string {
+	if m.dpop == nil {
+		return ""
+	}
+	return m.dpop.Nonce()
+}
+
+// BoundToKey binds the token to the DPoP key with thumbprint (from
+// ProofKey): it's only accepted with a proof signed by that key. With
+// "" it does nothing, so handlers can always pass it.
+func BoundToKey(thumbprint string) TokenOption {
+	return func(c *Claims) {
+		if thumbprint != "" {
+			c.Confirmation = &Confirmation{KeyThumbprint: thumbprint}
+		}
+	}
+}
+
+// Confirmation is a token's "cnf" claim (RFC 7800): the key its bearer
+// must prove they hold.
+type Confirmation struct {
+	KeyThumbprint string `json:"jkt"` // RFC 7638 thumbprint of a DPoP key
+}
+
+// DPoPKey returns the thumbprint of the DPoP key the token is bound
+// to, or "" for a token that isn't.
+func (c *Claims) DPoPKey() string {
+	if c.Confirmation == nil {
+		return ""
+	}
+	return c.Confirmation.KeyThumbprint
+}
@@ -0,0 +1,138 @@
+package auth
+
+import "context"
+
+// ClaimsEnricher customizes tokens for a deployment, without the auth
+// package knowing what's in them.
+//
+// EnrichClaims runs when a token is issued, after the TokenOptions and
+// before signing: it can add roles, or extra claims like an organization
+// or feature flags fetched from other services. The scopes are derived
+// from the roles afterwards, so added roles grant theirs. Extra claims
+// must not use reserved names (see ErrReservedClaim). A token may be
+// reissued from an earlier one's claims (after a password change), so
+// add a role only if it's missing.
+//
+// HydratePrincipal runs when a token is validated, after every check has
+// passed: it can attach what the app wants to know about the caller on
+// each request but not carry in the token (see Principal).
+//
+// WHY BOTH ENDS?
+// What goes in the token is fixed until it expires, public (JWTs are
+// only encoded), and paid for on every request in header bytes. What's
+// looked up at validation is fresh and private, but costs a lookup per
+// request. A deployment picks per fact: a plan tier that changes once a
+// month goes in the token, a feature flag toggled during an incident is
+// looked up.
+//
+// An error from either fails the token: GenerateToken returns it, and
+// ValidateToken treats the token as invalid. Enrichers should be fast
+// and cache what they fetch; they run on every login and every request.
+type ClaimsEnricher interface {
+	EnrichClaims(ctx context.Context, claims *Claims) error
+	HydratePrincipal(ctx context.Context, principal *Principal) error
+}
+
+// ClaimsEnricherFuncs adapts functions to ClaimsEnricher, for enrichers
+// that only need one end. A nil function does nothing.
+type ClaimsEnricherFuncs struct {
+	Enrich  func(ctx context.Context, claims *Claims) error
+	Hydrate func(ctx context.Context, principal *Principal) error
+}
+
+// EnrichClaims implements ClaimsEnricher.
+func (f ClaimsEnricherFuncs) EnrichClaims(ctx context.Context, claims *Claims) error {
+	if f.Enrich == nil {
+		return nil
+	}
+	return f.Enrich(ctx, claims)
+}
+
+// HydratePrincipal implements ClaimsEnricher.
+func (f ClaimsEnricherFuncs) HydratePrincipal(ctx context.Context, principal *Principal) error {
+	if f.Hydrate == nil {
+		return nil
+	}
+	return f.Hydrate(ctx, principal)
+}
+
+// WithClaimsEnricher adds an enricher. Enrichers run in the order they
+// were added, so a later one sees what the earlier ones did.
+func WithClaimsEnricher(enricher ClaimsEnricher) Option {
+	return func(m *JWTManager) {
+		m.enrichers = append(m.enrichers, enricher)
+	}
+}
+
+// Principal is the caller of a request: the validated token's claims,
+// plus attributes ClaimsEnrichers looked up for it. Handlers read it
+// with GetPrincipalFromContext.
+type Principal struct {
+	Claims *Claims
+
+	// Attributes are set by HydratePrincipal, e.g. "org" or
+	// "feature_flags". Read them with PrincipalValue.
+	Attributes map[string]interface{}
+}
+
+// Set stores an attribute, for HydratePrincipal.
+func (p *Principal) Set(name string, value interface{}) {
+	if p.Attributes == nil {
+		p.Attributes = make(map[string]interface{})
+	}
+	p.Attributes[name] = value
+}
+
+// PrincipalValue returns the attribute called name, if it's a T.
+//
+// Usage:
+//
+//	flags, ok := auth.PrincipalValue[[]string](principal, "feature_flags")
+//
+// Unlike ClaimValue, nothing is converted: attributes never went through
+// JSON, so they're exactly what the enricher stored.
+func PrincipalValue[T any](p *Principal, name string) (T, bool) {
+	value, ok := p.Attributes[name].(T)
+	return value, ok
+}
+
+// GetPrincipalFromContext returns the caller of an authenticated
+// request. Without enrichers, or for callers that came without a token
+// (a client certificate, a signed request), it has the claims and no
+// attributes.
+func GetPrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	claims, ok := GetClaimsFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	if claims.principal == nil {
+		return &Principal{Claims: claims}, true
+	}
+	return claims.principal, true
+}
+
+// enrich runs the enrichers on a token about to be issued.
+func (m *JWTManager) enrich(ctx context.Context, claims *Claims) error {
+	for _, enricher := range m.enrichers {
+		if err := enricher.EnrichClaims(ctx, claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hydrate runs the enrichers on a validated token and keeps the result
+// on its claims, for GetPrincipalFromContext.
+func (m *JWTManager) hydrate(ctx context.Context, claims *Claims) error {
+	if len(m.enrichers) == 0 {
+		return nil
+	}
+	principal := &Principal{Claims: claims}
+	for _, enricher := range m.enrichers {
+		if err := enricher.HydratePrincipal(ctx, principal); err != nil {
+			return err
+		}
+	}
+	claims.principal = principal
+	return nil
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Event is something that happened to an account's authentication:
+// a LoginSucceeded, LoginFailed, or TokenRevoked. Hooks tell them apart
+// with a type switch:
+//
+//	switch e := event.(type) {
+//	case auth.LoginFailed:
+//	    alertIfBurst(e.Email, e.IPAddress)
+//	case auth.TokenRevoked:
+//	    audit(e.UserID, e.Reason)
+//	}
+//
+// WHY TYPED EVENTS?
+// Each kind carries different facts: a failed login may have no user ID
+// (the email didn't match an account), a revocation has no IP address
+// when an admin caused it. Separate types make every field mean
+// something, and a new kind doesn't break hooks that ignore it.
+type Event interface {
+	// EventName is a short, fixed name for logs and metric labels.
+	EventName() string
+}
+
+// Login methods, for LoginSucceeded and LoginFailed.
+const (
+	MethodPassword     = "password"      // POST /login
+	MethodRecoveryCode = "recovery_code" // POST /login with a 2FA recovery code
+	MethodSSO          = "sso"           // SAML assertion
+)
+
+// LoginSucceeded is emitted when a user signs in and gets tokens.
+type LoginSucceeded struct {
+	UserID    uint64
+	Email     string
+	Method    string // MethodPassword, MethodRecoveryCode, or MethodSSO
+	IPAddress string
+	UserAgent string
+	At        time.Time
+}
+
+// EventName implements Event.
+func (LoginSucceeded) EventName() string { return "login_succeeded" }
+
+// LoginFailed is emitted when a sign-in is refused. Email is what the
+// client sent, which may not belong to any account, and may be a
+// username rather than an email; Reason is a short,
+// fixed string (e.g. "invalid_credentials", "mfa_required", "captcha").
+//
+// SECURITY: Email is unverified input. Don't put it in a message to the
+// account's owner without checking it exists, or the hook becomes a way
+// to spam any inbox.
+type LoginFailed struct {
+	Email     string
+	Method    string
+	Reason    string
+	IPAddress string
+	UserAgent string
+	At        time.Time
+}
+
+// EventName implements Event.
+func (LoginFailed) EventName() string { return "login_failed" }
+
+// Revocation reasons, for TokenRevoked.
+const (
+	RevokedLogout          = "logout"           // One device signed out
+	RevokedPasswordChanged = "password_changed" // Every device, after a password change
+)
+
+// TokenRevoked is emitted when tokens stop working before they expire:
+// one device signing out, or all of them (after a password change).
+// SessionID is zero when every session was revoked.
+type TokenRevoked struct {
+	UserID    uint64
+	SessionID uint64
+	Reason    string // RevokedLogout or RevokedPasswordChanged
+	At        time.Time
+}
+
+// EventName implements Event.
+func (TokenRevoked) EventName() string { return "token_revoked" }
+
+// EventHook receives authentication events.
+//
+// Hooks run synchronously, in the request that caused the event, so keep
+// them fast: increment a counter, or hand the event to a queue. A slow
+// hook slows down every login.
+type EventHook interface {
+	HandleAuthEvent(ctx context.Context, event Event)
+}
+
+// EventHookFunc adapts a function to EventHook, like http.HandlerFunc.
+type EventHookFunc func(ctx context.Context, event Event)
+
+// HandleAuthEvent implements EventHook.
+func (f EventHookFunc) HandleAuthEvent(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// WithEventHook registers a hook for authentication events. Use it for
+// alerting, audit logging, or anomaly detection without the handlers or
+// the middleware knowing about any of them.
+func WithEventHook(hook EventHook) Option {
+	return func(m *JWTManager) {
+		m.eventHooks = append(m.eventHooks, hook)
+	}
+}
+
+// Emit passes event to every hook, in the order they were registered.
+// Handlers call it where the event happens: the manager issues and
+// checks tokens, but it doesn't see logins or sign-outs.
+//
+// A hook that panics is logged and skipped, so one broken integration
+// can't fail a login that already succeeded.
+func (m *JWTManager) Emit(ctx context.Context, event Event) {
+	for _, hook := range m.eventHooks {
+		runHook(ctx, hook, event)
+	}
+}
+
+// runHook calls one hook, recovering from a panic.
+func runHook(ctx context.Context, hook EventHook, event Event) {
+	defer func() {
+		if p := recover(); p != nil {
+			log.Printf("auth: %T panicked on %s: %v", hook, event.EventName(), p)
+		}
+	}()
+	hook.HandleAuthEvent(ctx, event)
+}
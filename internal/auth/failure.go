@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"errors"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Reasons a request can fail authentication.
+// They're short, fixed strings so they can be used as metric labels.
+const (
+	CauseMissing       = "missing"        // No "Authorization: Bearer" (or "DPoP") header
+	CauseMalformed     = "malformed"      // Not a well-formed JWT
+	CauseUnknownKey    = "unknown_key"    // No configured key matches the kid/alg, or the signing key ID
+	CauseBadSignature  = "bad_signature"  // Signature doesn't verify, or wrong algorithm
+	CauseExpired       = "expired"        // Past its exp claim
+	CauseRevoked       = "revoked"        // Older than the user's token version
+	CauseDeactivated   = "deactivated"    // The user's account is deactivated
+	CauseUnbound       = "unbound"        // Bound to another client (see Binder)
+	CauseUndecryptable = "undecryptable"  // Encryption expected, and this isn't ours (see Encrypter)
+	CauseInvalidClaims = "invalid_claims" // Other claim checks failed (e.g. nbf, iss, aud)
+	CauseInvalid       = "invalid"        // Anything else
+
+	CauseNoCertificate      = "no_certificate"      // The route wants a verified client certificate (see Policy)
+	CauseUnknownCertificate = "unknown_certificate" // Verified, but no CertMapper rule matches it
+
+	CauseUnsigned = "unsigned" // The route wants a signed request (see RequestVerifier)
+	CauseStale    = "stale"    // Signed outside the allowed clock skew
+	CauseReplayed = "replayed" // A signed request's nonce, or a DPoP proof, was seen before
+
+	CauseDPoPInvalid = "dpop_invalid" // A DPoP-bound token without a valid proof, or a proof with a bearer token (see DPoPVerifier)
+	CauseDPoPNonce   = "dpop_nonce"   // The DPoP proof lacks a fresh server nonce
+)
+
+// FailureCause classifies an error returned by ValidateToken,
+// RequestVerifier.Verify, or DPoPVerifier.Verify.
+func FailureCause(err error) string {
+	switch {
+	case errors.Is(err, ErrUnsigned):
+		return CauseUnsigned
+	case errors.Is(err, ErrUnknownSigningKey):
+		return CauseUnknownKey
+	case errors.Is(err, ErrStaleSignature):
+		return CauseStale
+	case errors.Is(err, ErrSignatureMismatch):
+		return CauseBadSignature
+	case errors.Is(err, ErrReplayedRequest), errors.Is(err, ErrReplayedDPoPProof):
+		return CauseReplayed
+	case errors.Is(err, ErrDPoPNonce):
+		return CauseDPoPNonce
+	case errors.Is(err, ErrInvalidDPoPProof):
+		return CauseDPoPInvalid
+	case errors.Is(err, ErrExpiredToken), errors.Is(err, jwt.ErrTokenExpired):
+		return CauseExpired
+	case errors.Is(err, ErrRevokedToken):
+		return CauseRevoked
+	case errors.Is(err, ErrAccountDeactivated):
+		return CauseDeactivated
+	case errors.Is(err, ErrBindingMismatch):
+		return CauseUnbound
+	case errors.Is(err, ErrUndecryptable):
+		return CauseUndecryptable
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return CauseMalformed
+	case errors.Is(err, jwt.ErrTokenUnverifiable):
+		return CauseUnknownKey
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid):
+		return CauseBadSignature
+	case errors.Is(err, jwt.ErrTokenInvalidClaims):
+		return CauseInvalidClaims
+	default:
+		return CauseInvalid
+	}
+}
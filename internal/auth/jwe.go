@@ -0,0 +1,333 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrUndecryptable is returned by ValidateToken for an encrypted token no
+// configured key decrypts (tampered with, or encrypted by someone else),
+// and, with RequireEncryption, for a token that isn't encrypted.
+var ErrUndecryptable = errors.New("token can't be decrypted")
+
+// EncryptionKeySize is the key length NewEncrypter needs: 32 bytes,
+// for AES-256.
+const EncryptionKeySize = 32
+
+// jweHeader is the protected header of an encrypted token.
+//
+//   - alg "dir": the key is used directly; there's no wrapped content
+//     key, so the token's second part is empty.
+//   - enc "A256GCM": AES-256 in GCM mode, which encrypts and
+//     authenticates the signed token (and this header) in one step.
+//   - cty "JWT": what's inside is a signed token; "JSON" for claims
+//     sealed with EncryptClaims.
+//   - kid: which key encrypted it, for rotation (see NewEncrypter).
+type jweHeader struct {
+	Alg string `json:"alg"`
+	Enc string `json:"enc"`
+	Cty string `json:"cty"`
+	Kid string `json:"kid"`
+}
+
+// Encrypter wraps signed tokens in JWE (RFC 7516) and unwraps them.
+//
+// WHY ENCRYPT A SIGNED TOKEN?
+// A JWT's payload is only base64: anyone holding the token (the client,
+// its browser extensions, a proxy logging headers) can read the user ID
+// and email in it. Some deployments must not leak those. Encrypting the
+// signed token (a "nested JWT") hides the claims from everyone without
+// the key, and the signature inside still proves who issued it, so only
+// the token format changes, not how it's checked.
+//
+// Clients can't read the claims anymore, e.g. "exp" to refresh early;
+// they have to go by a 401 instead. EncryptClaims keeps the rest of the
+// token readable and hides only the claims that need hiding.
+type Encrypter struct {
+	current string                 // kid of the key that encrypts
+	aeads   map[string]cipher.AEAD // Every key that decrypts, by kid
+	require bool                   // Refuse tokens that aren't encrypted
+	claims  []string               // With EncryptClaims, the claims sealed instead of the token
+}
+
+// EncrypterOption configures optional Encrypter behavior.
+type EncrypterOption func(*Encrypter)
+
+// RequireEncryption refuses tokens that aren't encrypted. Without it,
+// signed tokens issued before encryption was turned on keep working
+// until they expire, so turning it on signs nobody out; their signature
+// is still checked either way.
+func RequireEncryption() EncrypterOption {
+	return func(e *Encrypter) {
+		e.require = true
+	}
+}
+
+// EncryptClaims encrypts only the named claims, e.g. "email" and
+// "roles", instead of the whole token. They travel as one JWE in the
+// "enc" claim of an ordinary signed token, and ValidateToken puts them
+// back, so handlers see the same Claims either way. With
+// RequireEncryption, a token without "enc" is refused.
+//
+// WHY NOT ALWAYS THE WHOLE TOKEN?
+// A fully encrypted token is opaque to everyone without the key: the
+// client can't read "exp" to refresh early, and a gateway can't route
+// by audience or check scopes. Usually only a few claims are sensitive
+// (the email is personal data, the roles map out who to phish). Sealing
+// just those keeps everything else usable.
+//
+// The registered claims (exp, aud, ...) can't be sealed: the token is
+// checked against them before anything is decrypted.
+func EncryptClaims(names ...string) EncrypterOption {
+	return func(e *Encrypter) {
+		e.claims = append(e.claims, names...)
+	}
+}
+
+// unsealableClaims are the claims EncryptClaims refuses: the registered
+// claims, which the parser checks, and "enc" itself.
+var unsealableClaims = map[string]bool{
+	"iss": true, "sub": true, "aud": true, "exp": true, "nbf": true, "iat": true, "jti": true,
+	"enc": true,
+}
+
+// NewEncrypter creates an Encrypter that encrypts with keys[0] and
+// decrypts with any of keys. Every instance validating the tokens needs
+// the same keys.
+//
+// KEY ROTATION:
+// Put the new key first and keep the old one after it, so tokens it
+// encrypted can still be read. Drop it once they've expired (one access
+// token lifetime).
+func NewEncrypter(keys [][]byte, opts ...EncrypterOption) (*Encrypter, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("token encryption needs a key")
+	}
+	e := &Encrypter{current: encryptionKeyID(keys[0]), aeads: make(map[string]cipher.AEAD, len(keys))}
+	for i, key := range keys {
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %d: %w", i+1, err)
+		}
+		e.aeads[encryptionKeyID(key)] = aead
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	for _, name := range e.claims {
+		if unsealableClaims[name] {
+			return nil, fmt.Errorf("claim %q can't be encrypted", name)
+		}
+	}
+	return e, nil
+}
+
+// WithEncryption makes the manager encrypt the tokens it issues, and
+// decrypt the tokens it validates, with encrypter.
+func WithEncryption(encrypter *Encrypter) Option {
+	return func(m *JWTManager) {
+		m.encrypter = encrypter
+	}
+}
+
+// newAEAD returns AES-256-GCM with key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != EncryptionKeySize {
+		return nil, fmt.Errorf("token encryption key must be %d bytes, got %d", EncryptionKeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptionKeyID names a key without revealing it: the start of its
+// SHA-256 hash. Every instance derives the same ID from the same key.
+func encryptionKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// encrypt wraps a signed token in a JWE.
+func (e *Encrypter) encrypt(signed string) (string, error) {
+	return e.seal([]byte(signed), "JWT")
+}
+
+// seal encrypts plaintext in a JWE compact serialization:
+// header..iv.ciphertext.tag (the encrypted key part is empty for "dir").
+func (e *Encrypter) seal(plaintext []byte, cty string) (string, error) {
+	header, err := json.Marshal(jweHeader{Alg: "dir", Enc: "A256GCM", Cty: cty, Kid: e.current})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+
+	aead := e.aeads[e.current]
+	iv := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("generating IV: %w", err)
+	}
+	// The header is authenticated too (the spec's "additional data"), so
+	// nobody can swap in another kid or algorithm.
+	sealed := aead.Seal(nil, iv, plaintext, []byte(protected))
+	ciphertext, tag := sealed[:len(sealed)-aead.Overhead()], sealed[len(sealed)-aead.Overhead():]
+
+	enc := base64.RawURLEncoding.EncodeToString
+	return strings.Join([]string{protected, "", enc(iv), enc(ciphertext), enc(tag)}, "."), nil
+}
+
+// decrypt returns the signed token inside token. A signed token (three
+// parts, not five) is returned as is, unless encryption is required
+// (with EncryptClaims, openClaims enforces that instead).
+func (e *Encrypter) decrypt(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 && (!e.require || len(e.claims) > 0) {
+		return token, nil
+	}
+	signed, err := e.open(token)
+	if err != nil {
+		return "", err
+	}
+	return string(signed), nil
+}
+
+// open returns the plaintext inside a JWE from seal.
+func (e *Encrypter) open(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("%w: not an encrypted token", ErrUndecryptable)
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrUndecryptable)
+	}
+	var header jweHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrUndecryptable)
+	}
+	// SECURITY: only the one algorithm pair we issue, never what the
+	// token asks for (see the "alg" check in ValidateToken).
+	if header.Alg != "dir" || header.Enc != "A256GCM" || parts[1] != "" {
+		return nil, fmt.Errorf("%w: unsupported alg %q / enc %q", ErrUndecryptable, header.Alg, header.Enc)
+	}
+	aead, ok := e.aeads[header.Kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrUndecryptable, header.Kid)
+	}
+
+	iv, err1 := base64.RawURLEncoding.DecodeString(parts[2])
+	ciphertext, err2 := base64.RawURLEncoding.DecodeString(parts[3])
+	tag, err3 := base64.RawURLEncoding.DecodeString(parts[4])
+	if err1 != nil || err2 != nil || err3 != nil || len(iv) != aead.NonceSize() || len(tag) != aead.Overhead() {
+		return nil, fmt.Errorf("%w: malformed token", ErrUndecryptable)
+	}
+	plaintext, err := aead.Open(nil, iv, append(ciphertext, tag...), []byte(parts[0]))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUndecryptable, err)
+	}
+	return plaintext, nil
+}
+
+// sealsClaims reports whether the Encrypter seals claims (EncryptClaims)
+// rather than whole tokens.
+func (e *Encrypter) sealsClaims() bool {
+	return len(e.claims) > 0
+}
+
+// sealClaims returns the payload to sign for claims: their JSON, with
+// the claims named in EncryptClaims moved into "enc". Claims the token
+// doesn't have are skipped; a token with none of them has no "enc".
+func (e *Encrypter) sealClaims(claims Claims) (jwt.Claims, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	// Raw JSON values, so a uint64 user ID isn't rounded to a float64.
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	hidden := make(map[string]json.RawMessage, len(e.claims))
+	for _, name := range e.claims {
+		if value, ok := fields[name]; ok {
+			hidden[name] = value
+			delete(fields, name)
+		}
+	}
+	payload := make(jwt.MapClaims, len(fields)+1)
+	for name, value := range fields {
+		payload[name] = value
+	}
+	if len(hidden) == 0 {
+		return payload, nil
+	}
+	plaintext, err := json.Marshal(hidden)
+	if err != nil {
+		return nil, err
+	}
+	if payload["enc"], err = e.seal(plaintext, "JSON"); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// openClaims decrypts the claims sealed in claims.Sealed back into
+// claims. A token without sealed claims is left alone, unless
+// encryption is required and the token wasn't wrapped whole either (as
+// tokens were before EncryptClaims was turned on).
+func (e *Encrypter) openClaims(claims *Claims, wrapped bool) error {
+	if claims.Sealed == "" {
+		if e.require && e.sealsClaims() && !wrapped {
+			return fmt.Errorf("%w: claims aren't encrypted", ErrUndecryptable)
+		}
+		return nil
+	}
+	plaintext, err := e.open(claims.Sealed)
+	if err != nil {
+		return err
+	}
+	return unsealClaims(claims, plaintext)
+}
+
+// unsealClaims merges the JSON object hidden into claims, through JSON
+// so that the built-in claims land in their fields and the rest in
+// Extra, as if they'd never been sealed.
+func unsealClaims(claims *Claims, hidden []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(hidden, &fields); err != nil {
+		return fmt.Errorf("%w: malformed sealed claims", ErrUndecryptable)
+	}
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return err
+	}
+	var merged map[string]json.RawMessage
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return err
+	}
+	delete(merged, "enc")
+	for name, value := range fields {
+		merged[name] = value
+	}
+	if data, err = json.Marshal(merged); err != nil {
+		return err
+	}
+	var opened Claims
+	if err := json.Unmarshal(data, &opened); err != nil {
+		return fmt.Errorf("%w: malformed sealed claims", ErrUndecryptable)
+	}
+	*claims = opened
+	return nil
+}
@@ -10,8 +10,12 @@
 package auth
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -42,6 +46,55 @@ type Claims struct {
 	// lookup for every request that needs the user's email.
 	Email string `json:"email"`
 
+	// Roles lists the user's roles at the time the token was issued.
+	// Role changes take effect when the user gets a new token.
+	Roles []string `json:"roles,omitempty"`
+
+	// Scopes lists what the token may do, derived from Roles through the
+	// permission registry (see scopes.go) when the token is issued.
+	Scopes []string `json:"scopes,omitempty"`
+
+	// TokenVersion is the user's token version when the token was issued
+	// (see AtVersion). Raising the user's version revokes the token.
+	TokenVersion uint64 `json:"token_version,omitempty"`
+
+	// Extra holds application-specific claims (e.g. a tenant ID or plan
+	// tier), stored as top-level JSON fields next to the ones above.
+	// Read them with ClaimValue; see claims.go.
+	Extra map[string]interface{} `json:"-"`
+
+	// Actor is set on impersonation tokens: the staff member acting as
+	// this user. Nil on ordinary tokens. See impersonation.go.
+	Actor *Actor `json:"act,omitempty"`
+
+	// Binding is the fingerprint of the client the token was issued to,
+	// on bound tokens (see Binder). Empty on unbound ones.
+	Binding string `json:"bnd,omitempty"`
+
+	// Confirmation names the DPoP key the token is bound to (see
+	// BoundToKey). Nil on tokens that aren't.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	// boundTo is the request BoundTo asked to bind the token to, until
+	// GenerateToken turns it into Binding.
+	boundTo *http.Request
+
+	// Sealed holds the claims an Encrypter with EncryptClaims hid, as
+	// a JWE. ValidateToken decrypts them into the fields above and
+	// clears it, so it's only ever set on the wire.
+	Sealed string `json:"enc,omitempty"`
+
+	// principal is what ClaimsEnrichers attached at validation, for
+	// GetPrincipalFromContext. Nil without enrichers.
+	principal *Principal
+
+	// Service is set when the request came with a client certificate
+	// mapped to a service (see CertMapper): the service's name. It's
+	// never read from or written to a token. With no UserID the service
+	// itself is the caller (PolicyMTLS); with one, it's calling on that
+	// user's behalf with their token (PolicyMTLSAndJWT).
+	Service string `json:"-"`
+
 	// RegisteredClaims contains standard JWT fields like:
 	// - ExpiresAt: When the token expires
 	// - IssuedAt: When the token was created
@@ -55,22 +108,130 @@ type Claims struct {
 // 2. Configuration is explicit, not hidden in global variables
 // 3. You could have multiple JWTManagers with different settings
 type JWTManager struct {
-	secret   []byte        // The secret key used for signing tokens
-	duration time.Duration // How long tokens are valid
-	issuer   string        // Identifies who created the token
+	keys     atomic.Pointer[[]Key] // Keys for signing and verifying tokens (see WithKeys, SetKeys)
+	keysMu   sync.Mutex            // Serializes SetKeys and RotateKey
+	duration time.Duration         // How long tokens are valid, unless lifetimes says otherwise
+	issuer   string                // Identifies who created the token
+
+	audience          []string // Default "aud" for issued tokens (see WithAudience)
+	expectedAudiences []string // "aud" values ValidateToken accepts (see WithExpectedAudience)
+
+	leeway time.Duration // Clock skew tolerated on exp/nbf/iat (see WithLeeway)
+
+	lifetimes Lifetimes // Token lifetimes by scope and audience (see WithLifetimes)
+
+	versions *VersionCache // Token version check; nil to skip (see WithVersionCheck)
+
+	binder *Binder // Binds tokens to clients; nil to skip (see WithBinding)
+
+	encrypter *Encrypter // Encrypts issued tokens; nil to skip (see WithEncryption)
+
+	dpop *DPoPVerifier // Checks DPoP proofs; nil to skip (see WithDPoP)
+
+	eventHooks []EventHook // Told about logins and revocations (see WithEventHook)
+
+	enrichers []ClaimsEnricher // Customize tokens and principals (see WithClaimsEnricher)
+}
+
+// Option configures optional JWTManager behavior.
+// Options are passed as trailing arguments to NewJWTManager.
+type Option func(*JWTManager)
+
+// WithKey replaces the default HS256 secret with another key,
+// e.g. an RS256 or ES256 key pair loaded with ParseKey.
+func WithKey(key Key) Option {
+	return WithKeys(key)
+}
+
+// WithKeys replaces the default HS256 secret with a set of keys.
+//
+// KEY ROTATION:
+// With a single key, changing it logs out every user at once, because
+// every token in circulation was signed with the old key.
+// With several keys:
+//   - New tokens are signed with the newest active key
+//     (the one with the latest ActiveFrom that has already started).
+//   - Tokens are validated with the key named in their "kid" header,
+//     as long as that key hasn't reached its ExpiresAt.
+//
+// A typical rotation: add the new key with ActiveFrom a day ahead and give
+// the old key an ExpiresAt of (new ActiveFrom + longest token lifetime). Nobody is
+// logged out, and the old key can be removed from config after it expires.
+func WithKeys(keys ...Key) Option {
+	return func(m *JWTManager) {
+		m.keys.Store(&keys)
+	}
+}
+
+// WithAudience sets the default "aud" claim stamped on issued tokens.
+// GenerateToken's ForAudience overrides it for a single token.
+func WithAudience(aud ...string) Option {
+	return func(m *JWTManager) {
+		m.audience = aud
+	}
+}
+
+// WithExpectedAudience makes ValidateToken reject tokens whose "aud" claim
+// doesn't contain at least one of the given values.
+//
+// WHY CHECK THE AUDIENCE?
+// When several services trust the same issuer (or share a public key),
+// a token issued for the billing service is also a perfectly signed token
+// for the user service. The audience says who the token is FOR; checking
+// it stops a token leaked from (or minted for) one service from being
+// replayed against another. Tokens without an "aud" claim are rejected
+// too, so don't enable this until every issuer sets one.
+func WithExpectedAudience(aud ...string) Option {
+	return func(m *JWTManager) {
+		m.expectedAudiences = aud
+	}
+}
+
+// WithLeeway tolerates clock skew of up to d when checking the exp, nbf,
+// and iat claims.
+//
+// WHY LEEWAY?
+// Tokens are issued on one server and validated on another. If the
+// validating server's clock runs a few seconds behind, a token issued
+// "now" has an nbf in its future and is rejected; if it runs ahead,
+// tokens expire early. A leeway of a few seconds (rarely more than a
+// minute) absorbs that drift. It also extends every token's lifetime by
+// the same amount, so keep it small.
+func WithLeeway(d time.Duration) Option {
+	return func(m *JWTManager) {
+		m.leeway = d
+	}
 }
 
 // NewJWTManager creates a new JWT manager.
 // Parameters:
-//   - secret: The signing key. Should be at least 32 bytes for HS256.
+//   - secret: The HS256 signing key. Should be at least 32 bytes.
+//     Ignored when WithKey supplies a different key.
 //   - duration: How long tokens should be valid (e.g., 15*time.Minute)
-//   - issuer: A string identifying your application
-func NewJWTManager(secret string, duration time.Duration, issuer string) *JWTManager {
-	return &JWTManager{
-		secret:   []byte(secret), // Convert string to bytes for signing
+//   - issuer: A string identifying your application. ValidateToken
+//     rejects tokens issued by anyone else.
+//   - opts: Optional settings (see Option)
+func NewJWTManager(secret string, duration time.Duration, issuer string, opts ...Option) *JWTManager {
+	m := &JWTManager{
 		duration: duration,
 		issuer:   issuer,
 	}
+	m.keys.Store(&[]Key{NewHMACKey(secret)})
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// TokenOption customizes a single token issued by GenerateToken.
+type TokenOption func(*Claims)
+
+// ForAudience sets the token's "aud" claim, overriding the manager's
+// default audience (see WithAudience).
+func ForAudience(aud ...string) TokenOption {
+	return func(c *Claims) {
+		c.Audience = aud
+	}
 }
 
 // GenerateToken creates a new JWT token for a user.
@@ -79,17 +240,24 @@ func NewJWTManager(secret string, duration time.Duration, issuer string) *JWTMan
 //
 // Returns:
 //   - The signed JWT token string
-//   - An error if signing fails
-func (m *JWTManager) GenerateToken(userID uint64, email string) (string, error) {
+//   - An error if enriching or signing fails
+func (m *JWTManager) GenerateToken(userID uint64, email string, roles []string, opts ...TokenOption) (string, error) {
+	return m.GenerateTokenContext(context.Background(), userID, email, roles, opts...)
+}
+
+// GenerateTokenContext is GenerateToken with a context for the
+// ClaimsEnrichers, which may call other services.
+func (m *JWTManager) GenerateTokenContext(ctx context.Context, userID uint64, email string, roles []string, opts ...TokenOption) (string, error) {
 	// Create the claims (payload data)
 	now := time.Now()
 	claims := Claims{
 		UserID: userID,
 		Email:  email,
+		Roles:  roles,
 		RegisteredClaims: jwt.RegisteredClaims{
 			// ExpiresAt: After this time, the token is invalid.
 			// Short expiration (15-30 min) limits damage if token is stolen.
-			ExpiresAt: jwt.NewNumericDate(now.Add(m.duration)),
+			// Set by expire below, once the scopes are known.
 
 			// IssuedAt: When the token was created.
 			// Useful for debugging and audit logs.
@@ -102,21 +270,68 @@ func (m *JWTManager) GenerateToken(userID uint64, email string) (string, error)
 			// Issuer: Identifies who created the token.
 			// Useful when multiple services issue tokens.
 			Issuer: m.issuer,
+
+			// Audience: Who the token is for (see WithExpectedAudience).
+			// Empty unless configured, which omits the claim entirely.
+			Audience: m.audience,
 		},
 	}
+	for _, opt := range opts {
+		opt(&claims)
+	}
+	if err := m.enrich(ctx, &claims); err != nil {
+		return "", fmt.Errorf("enriching claims: %w", err)
+	}
+	// Derived last, so roles an enricher added grant their scopes.
+	claims.Scopes = ScopesForRoles(claims.Roles)
+	m.expire(&claims)
+	m.bind(&claims)
+	if err := checkExtraClaims(claims.Extra); err != nil {
+		return "", err
+	}
+
+	// Pick the newest key that is allowed to sign right now.
+	// A manager configured with only public keys can't issue tokens.
+	key, ok := m.signingKey(now)
+	if !ok {
+		return "", ErrVerifyOnly
+	}
+
+	// Hide the sensitive claims inside the token, if configured (see
+	// EncryptClaims); the rest stay readable.
+	var payload jwt.Claims = claims
+	if m.encrypter != nil && m.encrypter.sealsClaims() {
+		var err error
+		if payload, err = m.encrypter.sealClaims(claims); err != nil {
+			return "", fmt.Errorf("failed to encrypt claims: %w", err)
+		}
+	}
 
-	// Create the token with our claims
-	// jwt.SigningMethodHS256 uses HMAC-SHA256 for signing.
-	// This is symmetric encryption - same key for signing and verifying.
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Create the token with our claims.
+	// The signing method comes from the key: HS256 (shared secret)
+	// or RS256/ES256 (private key signs, public key verifies).
+	token := jwt.NewWithClaims(key.method, payload)
 
-	// Sign the token with our secret key.
+	// The "kid" (key ID) header tells validators which key to use.
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+
+	// Sign the token with our key.
 	// This creates the third part of the JWT (the signature).
-	tokenString, err := token.SignedString(m.secret)
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to sign token: %w", err)
 	}
 
+	// Hide the claims from everyone but us, if configured (see Encrypter).
+	if m.encrypter != nil && !m.encrypter.sealsClaims() {
+		tokenString, err = m.encrypter.encrypt(tokenString)
+		if err != nil {
+			return "", fmt.Errorf("failed to encrypt token: %w", err)
+		}
+	}
+
 	return tokenString, nil
 }
 
@@ -128,8 +343,26 @@ func (m *JWTManager) GenerateToken(userID uint64, email string) (string, error)
 //
 // Returns:
 //   - The claims if the token is valid
-//   - An error if the token is invalid or expired
+//   - An error if the token is invalid, expired, or revoked
 func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
+	return m.ValidateTokenContext(context.Background(), tokenString)
+}
+
+// ValidateTokenContext is ValidateToken with a context for the token
+// version lookup, which may read the database, and the ClaimsEnrichers.
+func (m *JWTManager) ValidateTokenContext(ctx context.Context, tokenString string) (*Claims, error) {
+	// An encrypted token is unwrapped first; the signed token inside is
+	// checked like any other.
+	wrapped := false
+	if m.encrypter != nil {
+		signed, err := m.encrypter.decrypt(tokenString)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		wrapped = signed != tokenString
+		tokenString = signed
+	}
+
 	// Parse and validate the token
 	token, err := jwt.ParseWithClaims(
 		tokenString,
@@ -140,13 +373,23 @@ func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 
 			// SECURITY: Always check the signing algorithm!
 			// Attackers might try to change "alg" to "none" or "HS256" when
-			// you expect "RS256". This is a common JWT vulnerability.
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+			// you expect "RS256". If we accepted HS256 here, an attacker could
+			// sign a token using our PUBLIC key as the HMAC secret.
+			// verificationKeys only returns keys whose algorithm matches.
+			kid, _ := token.Header["kid"].(string)
+			keys := m.verificationKeys(kid, token.Method.Alg(), time.Now())
+			if len(keys) == 0 {
+				return nil, fmt.Errorf("no valid key for kid %q and alg %v", kid, token.Header["alg"])
+			}
+			if len(keys) == 1 {
+				return keys[0], nil
 			}
 
-			return m.secret, nil
+			// Tokens without a kid may match several keys; the parser
+			// accepts the token if any of them verifies the signature.
+			return jwt.VerificationKeySet{Keys: keys}, nil
 		},
+		m.parserOptions()...,
 	)
 
 	// Handle parsing errors
@@ -155,7 +398,9 @@ func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 		if errors.Is(err, jwt.ErrTokenExpired) {
 			return nil, ErrExpiredToken
 		}
-		return nil, ErrInvalidToken
+		// Keep the parser's error in the chain so FailureCause can tell
+		// a bad signature from a malformed token.
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
 
 	// Extract and return the claims
@@ -164,6 +409,100 @@ func (m *JWTManager) ValidateToken(tokenString string) (*Claims, error) {
 	if !ok || !token.Valid {
 		return nil, ErrInvalidToken
 	}
+	// Sealed claims are opened first: the checks below may need them.
+	switch {
+	case m.encrypter != nil:
+		if err := m.encrypter.openClaims(claims, wrapped); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	case claims.Sealed != "":
+		return nil, fmt.Errorf("%w: %w: no key for the sealed claims", ErrInvalidToken, ErrUndecryptable)
+	}
+
+	// Checked last: only a token that's otherwise valid is worth a lookup.
+	if m.versions != nil {
+		if err := m.versions.Check(ctx, claims.UserID, claims.TokenVersion); err != nil {
+			if errors.Is(err, ErrRevokedToken) || errors.Is(err, ErrAccountDeactivated) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+	if err := m.hydrate(ctx, claims); err != nil {
+		return nil, fmt.Errorf("%w: hydrating principal: %w", ErrInvalidToken, err)
+	}
 
 	return claims, nil
 }
+
+// parserOptions returns the checks ValidateToken enforces on top of the
+// signature and the time-based claims, and how strictly time is judged.
+func (m *JWTManager) parserOptions() []jwt.ParserOption {
+	opts := []jwt.ParserOption{
+		// Belt and braces: the parser rejects other algorithms too.
+		jwt.WithValidMethods(m.algorithms()),
+	}
+
+	if m.leeway > 0 {
+		opts = append(opts, jwt.WithLeeway(m.leeway))
+	}
+
+	// A token signed with a key we trust but issued by a different
+	// service (one sharing a key or key pair) isn't ours to accept.
+	if m.issuer != "" {
+		opts = append(opts, jwt.WithIssuer(m.issuer))
+	}
+
+	// Any one matching audience is enough: a token may be meant for
+	// several services at once.
+	if len(m.expectedAudiences) > 0 {
+		opts = append(opts, jwt.WithAudience(m.expectedAudiences...))
+	}
+	return opts
+}
+
+// signingKey returns the newest key that may sign tokens at time now.
+// When two keys share the same ActiveFrom, the one listed last wins.
+func (m *JWTManager) signingKey(now time.Time) (Key, bool) {
+	var best Key
+	found := false
+	for _, k := range *m.keys.Load() {
+		if !k.activeAt(now) {
+			continue
+		}
+		if !found || !k.ActiveFrom.Before(best.ActiveFrom) {
+			best, found = k, true
+		}
+	}
+	return best, found
+}
+
+// verificationKeys returns the keys that may verify a token with the given
+// kid and alg at time now. Expired keys are never returned.
+// A token without a kid is checked against every key with a matching algorithm.
+func (m *JWTManager) verificationKeys(kid, alg string, now time.Time) []jwt.VerificationKey {
+	var keys []jwt.VerificationKey
+	for _, k := range *m.keys.Load() {
+		if k.Algorithm() != alg || k.expiredAt(now) {
+			continue
+		}
+		if kid != "" && k.ID != kid {
+			continue
+		}
+		keys = append(keys, k.verifyKey)
+	}
+	return keys
+}
+
+// algorithms returns the distinct signing algorithms of all configured keys.
+func (m *JWTManager) algorithms() []string {
+	var algs []string
+	seen := make(map[string]bool)
+	for _, k := range *m.keys.Load() {
+		if alg := k.Algorithm(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
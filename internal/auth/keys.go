@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrVerifyOnly is returned by GenerateToken when the manager only has
+// a public key. Services that verify tokens issued elsewhere are set up this way.
+var ErrVerifyOnly = errors.New("jwt manager has no private key; it can only verify tokens")
+
+// Key is a key (or key pair) used to sign and verify tokens.
+//
+// SYMMETRIC vs ASYMMETRIC SIGNING:
+//   - HS256 (HMAC): one shared secret signs AND verifies.
+//     Every service that verifies tokens can also forge them.
+//   - RS256 (RSA) / ES256 (ECDSA): a private key signs, a public key verifies.
+//     Only the issuer holds the private key; other services get the public
+//     key and can verify tokens without being able to create them.
+type Key struct {
+	// ID is written to the token's "kid" header so validators know
+	// which key signed it. Required when more than one key is configured.
+	ID string
+
+	// ActiveFrom is when this key starts signing new tokens.
+	// Zero means "immediately". Keys are accepted for VALIDATION before
+	// they become active, so every instance already trusts a new key
+	// by the time any instance starts signing with it.
+	ActiveFrom time.Time
+
+	// ExpiresAt is when this key stops being accepted for validation.
+	// Zero means "never". Set it to at least the new key's ActiveFrom plus
+	// the token lifetime, so tokens signed just before the switch stay valid.
+	ExpiresAt time.Time
+
+	method    jwt.SigningMethod
+	signKey   interface{} // []byte, *rsa.PrivateKey or *ecdsa.PrivateKey; nil if verify-only
+	verifyKey interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// NewHMACKey creates an HS256 key from a shared secret.
+func NewHMACKey(secret string) Key {
+	return Key{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// ParseKey creates an asymmetric key from PEM-encoded key material.
+//
+// Supported algorithms: RS256, RS384, RS512, ES256, ES384, ES512.
+// Either PEM block may be empty:
+//   - private only: the public key is derived from it
+//   - public only:  the key can verify but not sign (see ErrVerifyOnly)
+func ParseKey(algorithm string, privatePEM, publicPEM []byte) (Key, error) {
+	if len(privatePEM) == 0 && len(publicPEM) == 0 {
+		return Key{}, fmt.Errorf("%s requires a private or public key", algorithm)
+	}
+
+	method := jwt.GetSigningMethod(algorithm)
+	switch method.(type) {
+	case *jwt.SigningMethodRSA:
+		return parseRSAKey(method, privatePEM, publicPEM)
+	case *jwt.SigningMethodECDSA:
+		return parseECDSAKey(method, privatePEM, publicPEM)
+	default:
+		return Key{}, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+// parseRSAKey loads an RSA key pair for RS256/RS384/RS512.
+func parseRSAKey(method jwt.SigningMethod, privatePEM, publicPEM []byte) (Key, error) {
+	key := Key{method: method}
+
+	if len(privatePEM) > 0 {
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return Key{}, fmt.Errorf("parsing RSA private key: %w", err)
+		}
+		key.signKey = private
+		key.verifyKey = &private.PublicKey
+	}
+
+	if len(publicPEM) > 0 {
+		public, err := jwt.ParseRSAPublicKeyFromPEM(publicPEM)
+		if err != nil {
+			return Key{}, fmt.Errorf("parsing RSA public key: %w", err)
+		}
+		if private, ok := key.signKey.(*rsa.PrivateKey); ok && !private.PublicKey.Equal(public) {
+			return Key{}, errors.New("RSA public key does not match private key")
+		}
+		key.verifyKey = public
+	}
+
+	return key, nil
+}
+
+// parseECDSAKey loads an ECDSA key pair for ES256/ES384/ES512.
+func parseECDSAKey(method jwt.SigningMethod, privatePEM, publicPEM []byte) (Key, error) {
+	key := Key{method: method}
+
+	if len(privatePEM) > 0 {
+		private, err := jwt.ParseECPrivateKeyFromPEM(privatePEM)
+		if err != nil {
+			return Key{}, fmt.Errorf("parsing ECDSA private key: %w", err)
+		}
+		key.signKey = private
+		key.verifyKey = &private.PublicKey
+	}
+
+	if len(publicPEM) > 0 {
+		public, err := jwt.ParseECPublicKeyFromPEM(publicPEM)
+		if err != nil {
+			return Key{}, fmt.Errorf("parsing ECDSA public key: %w", err)
+		}
+		if private, ok := key.signKey.(*ecdsa.PrivateKey); ok && !private.PublicKey.Equal(public) {
+			return Key{}, errors.New("ECDSA public key does not match private key")
+		}
+		key.verifyKey = public
+	}
+
+	return key, nil
+}
+
+// Algorithm returns the JWT "alg" value for this key (e.g. "RS256").
+func (k Key) Algorithm() string {
+	return k.method.Alg()
+}
+
+// CanSign reports whether the key includes private key material.
+func (k Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// activeAt reports whether the key may sign tokens at time t.
+func (k Key) activeAt(t time.Time) bool {
+	return k.CanSign() && !t.Before(k.ActiveFrom) && !k.expiredAt(t)
+}
+
+// expiredAt reports whether the key is retired at time t.
+func (k Key) expiredAt(t time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !t.Before(k.ExpiresAt)
+}
+
+// SetKeys replaces the manager's keys, e.g. with a JWT_KEYS_FILE that
+// changed. Tokens being issued or validated meanwhile use either the
+// old keys or the new ones, never a mix.
+//
+// Keys dropped from the set stop verifying at once, so a schedule
+// keeps a retired key, with its ExpiresAt, until its tokens expire.
+func (m *JWTManager) SetKeys(keys ...Key) {
+	m.keysMu.Lock()
+	defer m.keysMu.Unlock()
+	m.keys.Store(&keys)
+}
+
+// RotateKey makes key the signing key from now on. The keys it replaces
+// keep verifying for overlap, set to the longest token lifetime, so
+// tokens they signed stay valid until they expire; then they're dropped.
+//
+// WHY NOT SWAP THE KEY OUTRIGHT?
+// Every token in circulation was signed with the old key. Dropping it
+// would sign everyone out at once, in the middle of whatever they were
+// doing: the same rotation a keys file schedules, done on the spot for
+// a single key (JWT_SECRET_FILE, JWT_PRIVATE_KEY_FILE) that changed.
+//
+// With several instances, each picks the new key up on its own, a few
+// seconds apart: meanwhile, a token one signs with it is refused by
+// the others. A JWT_KEYS_FILE with the new key's active_from ahead
+// avoids that, as every instance verifies a key before any signs.
+func (m *JWTManager) RotateKey(key Key, overlap time.Duration) {
+	m.keysMu.Lock()
+	defer m.keysMu.Unlock()
+
+	now := time.Now()
+	retire := now.Add(overlap)
+	old := *m.keys.Load()
+	keys := make([]Key, 0, len(old)+1)
+	for _, k := range old {
+		if k.expiredAt(now) {
+			continue
+		}
+		if k.ExpiresAt.IsZero() || k.ExpiresAt.After(retire) {
+			k.ExpiresAt = retire
+		}
+		keys = append(keys, k)
+	}
+	key.ActiveFrom = now
+	keys = append(keys, key)
+	m.keys.Store(&keys)
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Lifetimes sets access token lifetimes by what a token grants, instead
+// of one lifetime for every token (see WithLifetimes).
+//
+// A token gets the shortest lifetime among its scopes and audiences
+// that have one, and the manager's duration when none does. Shortest,
+// because a token with admin scopes is an admin token even though it
+// also reads: with "accounts:manage=5m" and "users:read=1h", an admin's
+// tokens last 5 minutes and a reader's an hour. An ordinary user, who
+// also writes, gets an hour too, unless "users:write" has a lifetime.
+//
+// WHY BY SCOPE?
+// A stolen token is usable until it expires. For a token that can
+// disable accounts, five minutes of refreshing is a small price; for
+// a dashboard that only reads, refreshing every few minutes buys
+// little and costs a round trip each time.
+type Lifetimes struct {
+	Scopes    map[string]time.Duration // Scope -> lifetime
+	Audiences map[string]time.Duration // "aud" value -> lifetime
+}
+
+// ParseLifetimes parses "name=duration" pairs, as in JWT_SCOPE_TTLS and
+// JWT_AUDIENCE_TTLS: "accounts:manage=5m", "users:read=1h".
+func ParseLifetimes(pairs []string) (map[string]time.Duration, error) {
+	lifetimes := make(map[string]time.Duration, len(pairs))
+	for _, pair := range pairs {
+		// Scopes have colons but never "=", so the last "=" splits.
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("lifetime entry %q: must be name=duration", pair)
+		}
+		name := strings.TrimSpace(pair[:i])
+		d, err := time.ParseDuration(strings.TrimSpace(pair[i+1:]))
+		if err != nil || d <= 0 || name == "" {
+			return nil, fmt.Errorf("lifetime entry %q: must be name=duration, with a positive duration", pair)
+		}
+		lifetimes[name] = d
+	}
+	return lifetimes, nil
+}
+
+// lifetime returns the lifetime for claims, or ok=false when none of
+// their scopes and audiences has one.
+func (l Lifetimes) lifetime(claims *Claims) (d time.Duration, ok bool) {
+	pick := func(candidate time.Duration, found bool) {
+		if found && (!ok || candidate < d) {
+			d, ok = candidate, true
+		}
+	}
+	for _, scope := range claims.Scopes {
+		candidate, found := l.Scopes[scope]
+		pick(candidate, found)
+	}
+	for _, aud := range claims.Audience {
+		candidate, found := l.Audiences[aud]
+		pick(candidate, found)
+	}
+	return d, ok
+}
+
+// WithLifetimes gives tokens lifetimes by scope and audience. Tokens
+// given a lifetime with ValidFor (impersonation) keep it.
+func WithLifetimes(l Lifetimes) Option {
+	return func(m *JWTManager) {
+		m.lifetimes = l
+	}
+}
+
+// expire sets the token's expiry, unless a TokenOption already did: by
+// the lifetimes, or the manager's duration.
+func (m *JWTManager) expire(claims *Claims) {
+	if claims.ExpiresAt != nil {
+		return
+	}
+	d, ok := m.lifetimes.lifetime(claims)
+	if !ok {
+		d = m.duration
+	}
+	claims.ExpiresAt = jwt.NewNumericDate(claims.IssuedAt.Add(d))
+}
@@ -2,9 +2,14 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+
+	"go-basics/internal/timing"
 )
 
 // contextKey is a custom type for context keys.
@@ -33,11 +38,81 @@ const ClaimsKey contextKey = "claims"
 //                                    -> 401 response (if token invalid)
 type Middleware struct {
 	jwtManager *JWTManager
+	onFailure  []FailureHook
+	certs      *CertMapper       // Nil unless WithClientCerts
+	signatures *RequestVerifier  // Nil unless WithRequestSigning
+	policies   map[string]Policy // By route pattern; PolicyJWT if missing
+}
+
+// FailureHook is called whenever a request is rejected for a missing or
+// invalid token. cause is one of the FailureCause values.
+// Hooks run synchronously, so keep them fast (e.g. increment a counter).
+type FailureHook func(r *http.Request, cause string)
+
+// MiddlewareOption configures optional Middleware behavior.
+type MiddlewareOption func(*Middleware)
+
+// WithFailureHook registers a hook for rejected requests.
+// Use it for metrics or security logging without the auth package
+// depending on either.
+func WithFailureHook(hook FailureHook) MiddlewareOption {
+	return func(m *Middleware) {
+		m.onFailure = append(m.onFailure, hook)
+	}
+}
+
+// WithClientCerts lets routes authenticate services by client
+// certificate, mapped by certs (see Policy and WithRoutePolicies).
+func WithClientCerts(certs *CertMapper) MiddlewareOption {
+	return func(m *Middleware) {
+		m.certs = certs
+	}
+}
+
+// WithRequestSigning lets routes authenticate clients by request
+// signature, checked by verifier (see Policy and WithRoutePolicies).
+func WithRequestSigning(verifier *RequestVerifier) MiddlewareOption {
+	return func(m *Middleware) {
+		m.signatures = verifier
+	}
+}
+
+// WithRoutePolicies sets how each route authenticates, by its pattern
+// exactly as registered (e.g. "GET /admin/jobs"). Routes not listed
+// take bearer tokens, PolicyJWT.
+//
+// WHY HERE, AND NOT AT EACH ROUTE?
+// Which routes internal services call differs per deployment; one runs
+// an ops dashboard against /admin/jobs, another has none. ServeMux
+// sets r.Pattern before the handler chain runs, so Authenticate can look
+// the route up, and every route already wrapped in it gets the policy
+// from configuration without its registration changing.
+func WithRoutePolicies(policies map[string]Policy) MiddlewareOption {
+	return func(m *Middleware) {
+		m.policies = policies
+	}
 }
 
 // NewMiddleware creates a new authentication middleware.
-func NewMiddleware(jwtManager *JWTManager) *Middleware {
-	return &Middleware{jwtManager: jwtManager}
+func NewMiddleware(jwtManager *JWTManager, opts ...MiddlewareOption) *Middleware {
+	m := &Middleware{jwtManager: jwtManager}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// fail runs the failure hooks and writes a 401 response.
+func (m *Middleware) fail(w http.ResponseWriter, r *http.Request, cause, message string) {
+	m.failWith(w, r, http.StatusUnauthorized, cause, message)
+}
+
+// failWith runs the failure hooks and writes a response with status.
+func (m *Middleware) failWith(w http.ResponseWriter, r *http.Request, status int, cause, message string) {
+	for _, hook := range m.onFailure {
+		hook(r, cause)
+	}
+	http.Error(w, message, status)
 }
 
 // Authenticate is the middleware function that validates JWT tokens.
@@ -49,24 +124,44 @@ func NewMiddleware(jwtManager *JWTManager) *Middleware {
 func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	// Return a new handler that wraps the original
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Step 1: Extract the token from the Authorization header
-		// Expected format: "Bearer <token>"
-		token, err := extractBearerToken(r)
-		if err != nil {
-			// No token provided - return 401 Unauthorized
-			http.Error(w, "missing or invalid authorization header", http.StatusUnauthorized)
-			return
-		}
-
-		// Step 2: Validate the token and extract claims
-		claims, err := m.jwtManager.ValidateToken(token)
-		if err != nil {
-			// Token is invalid or expired
-			if errors.Is(err, ErrExpiredToken) {
-				http.Error(w, "token has expired", http.StatusUnauthorized)
-				return
+		// Steps 1 and 2: authenticate the caller the way the route's
+		// policy says: token, certificate, signature, or a combination
+		var claims *Claims
+		var ok bool
+		switch m.policies[r.Pattern] {
+		case PolicyMTLS:
+			claims, ok = m.authenticateCert(w, r)
+		case PolicyMTLSOrJWT:
+			// A certificate, when sent, decides: a service whose
+			// certificate maps to nothing should hear so, not be asked
+			// for a token it doesn't have.
+			if _, sent := clientCertificate(r); sent {
+				claims, ok = m.authenticateCert(w, r)
+			} else {
+				claims, ok = m.authenticateToken(w, r)
+			}
+		case PolicyMTLSAndJWT:
+			var service *Claims
+			if service, ok = m.authenticateCert(w, r); ok {
+				if claims, ok = m.authenticateToken(w, r); ok {
+					// The user's token decides what may be done; the
+					// service is who's doing it for them.
+					claims.Service = service.Service
+				}
 			}
-			http.Error(w, "invalid token", http.StatusUnauthorized)
+		case PolicySigned:
+			claims, ok = m.authenticateSignature(w, r)
+		case PolicySignedOrJWT:
+			// Like PolicyMTLSOrJWT: the Authorization scheme says which.
+			if isSigned(r) {
+				claims, ok = m.authenticateSignature(w, r)
+			} else {
+				claims, ok = m.authenticateToken(w, r)
+			}
+		default:
+			claims, ok = m.authenticateToken(w, r)
+		}
+		if !ok {
 			return
 		}
 
@@ -80,6 +175,169 @@ func (m *Middleware) Authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateToken validates the request's bearer (or DPoP) token and
+// returns its claims, or writes a 401 (a 403 for a deactivated account)
+// and returns false.
+func (m *Middleware) authenticateToken(w http.ResponseWriter, r *http.Request) (*Claims, bool) {
+	// Extract the token from the Authorization header
+	// Expected format: "Bearer <token>" (or "DPoP <token>")
+	scheme, token, err := extractToken(r)
+	if err != nil {
+		// No token provided - return 401 Unauthorized
+		m.fail(w, r, CauseMissing, "missing or invalid authorization header")
+		return nil, false
+	}
+
+	// Validate the token and extract claims
+	// (timed as "auth" for requests that ask; see package timing)
+	endAuth := timing.Start(r.Context(), timing.Auth)
+	claims, err := m.jwtManager.ValidateTokenContext(r.Context(), token)
+	endAuth()
+	if err != nil {
+		// Token is invalid, expired, or revoked
+		if errors.Is(err, ErrExpiredToken) {
+			m.fail(w, r, CauseExpired, "token has expired")
+			return nil, false
+		}
+		if errors.Is(err, ErrRevokedToken) {
+			m.fail(w, r, CauseRevoked, "token has been revoked")
+			return nil, false
+		}
+		// The token is valid; the account isn't allowed in.
+		if errors.Is(err, ErrAccountDeactivated) {
+			m.failWith(w, r, http.StatusForbidden, CauseDeactivated, "account is deactivated")
+			return nil, false
+		}
+		m.fail(w, r, FailureCause(err), "invalid token")
+		return nil, false
+	}
+	// A bound token must come from the client it was issued to.
+	// The client's way back in is a refresh, like after expiry.
+	if err := m.jwtManager.CheckBinding(claims, r); err != nil {
+		m.fail(w, r, CauseUnbound, "token was issued to another device or network")
+		return nil, false
+	}
+	if !m.checkProof(w, r, scheme, token, claims) {
+		return nil, false
+	}
+	return claims, true
+}
+
+// checkProof checks the DPoP proof a DPoP-bound token must come with,
+// and that a token that isn't bound comes as a bearer token. Or it
+// writes a 401 with a WWW-Authenticate challenge saying what's wrong
+// (a 503 when the replay cache is down), and returns false.
+//
+// WHY REJECT A BOUND TOKEN SENT AS "Bearer"?
+// Accepting it would make the binding optional: a thief would just
+// leave the proof out. RFC 9449 has the scheme say which kind of token
+// it is, so a client can't get that wrong without hearing about it.
+func (m *Middleware) checkProof(w http.ResponseWriter, r *http.Request, scheme, token string, claims *Claims) bool {
+	verifier := m.jwtManager.dpop
+	bound := claims.DPoPKey()
+	switch {
+	case bound == "" && scheme == DPoPScheme:
+		m.failDPoP(w, r, CauseDPoPInvalid, "invalid_token", "token isn't DPoP-bound; send it as a Bearer token")
+		return false
+	case bound == "":
+		return true
+	case scheme != DPoPScheme:
+		m.failDPoP(w, r, CauseDPoPInvalid, "invalid_token", "token is DPoP-bound; send it with the DPoP scheme and a proof")
+		return false
+	case verifier == nil:
+		// DPoP was turned off since the token was issued; there's no
+		// checking the proof, so there's no accepting the token.
+		m.fail(w, r, CauseDPoPInvalid, "DPoP-bound tokens aren't accepted")
+		return false
+	}
+
+	thumbprint, err := verifier.Verify(r, token)
+	switch {
+	case err == nil && thumbprint != bound:
+		m.failDPoP(w, r, CauseUnbound, "invalid_dpop_proof", "DPoP proof is signed with another key than the token is bound to")
+	case err == nil:
+		// A fresh nonce on every response keeps the client's current.
+		if nonce := verifier.Nonce(); nonce != "" {
+			w.Header().Set(DPoPNonceHeader, nonce)
+		}
+		return true
+	case errors.Is(err, ErrDPoPNonce):
+		m.failDPoP(w, r, CauseDPoPNonce, "use_dpop_nonce", "DPoP proof needs the nonce in the DPoP-Nonce header")
+	case errors.Is(err, ErrReplayedDPoPProof):
+		m.failDPoP(w, r, CauseReplayed, "invalid_dpop_proof", "DPoP proof was already used")
+	case errors.Is(err, ErrInvalidDPoPProof):
+		m.failDPoP(w, r, CauseDPoPInvalid, "invalid_dpop_proof", "invalid DPoP proof")
+	default:
+		log.Printf("auth: verifying DPoP proof: %v", err)
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+	}
+	return false
+}
+
+// failDPoP is fail, with the DPoP challenge RFC 9449 asks for: the
+// error code, the algorithms proofs may use, and a nonce to use when
+// nonces are required.
+func (m *Middleware) failDPoP(w http.ResponseWriter, r *http.Request, cause, code, message string) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`%s error="%s", algs="%s"`, DPoPScheme, code, strings.Join(dpopAlgorithms, " ")))
+	if nonce := m.jwtManager.DPoPNonce(); nonce != "" {
+		w.Header().Set(DPoPNonceHeader, nonce)
+	}
+	m.fail(w, r, cause, message)
+}
+
+// authenticateCert maps the request's verified client certificate to a
+// service and returns claims for it: its name and scopes, no user. Or it
+// writes a 401 and returns false.
+//
+// Scope checks (RequireScope) work on these claims like on a token's.
+// Role and ownership checks never pass: a service has no roles and is
+// no user.
+func (m *Middleware) authenticateCert(w http.ResponseWriter, r *http.Request) (*Claims, bool) {
+	cert, ok := clientCertificate(r)
+	if !ok || m.certs == nil {
+		m.fail(w, r, CauseNoCertificate, "client certificate required")
+		return nil, false
+	}
+	name, scopes, ok := m.certs.Service(cert)
+	if !ok {
+		m.fail(w, r, CauseUnknownCertificate, "client certificate is not mapped to a service")
+		return nil, false
+	}
+	return &Claims{Service: name, Scopes: scopes}, true
+}
+
+// authenticateSignature verifies the request's signature and returns
+// claims for the client that signed it: its name and scopes, no user,
+// like authenticateCert's. Or it writes an error and returns false: a
+// 401, or a 413 for a body over the limit, or a 503 when the nonce cache
+// is down (letting requests through unchecked would let replays through).
+func (m *Middleware) authenticateSignature(w http.ResponseWriter, r *http.Request) (*Claims, bool) {
+	if m.signatures == nil {
+		m.fail(w, r, CauseUnsigned, "signed request required")
+		return nil, false
+	}
+	claims, err := m.signatures.Verify(r)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return claims, true
+	case errors.As(err, &tooLarge):
+		http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrUnsigned):
+		m.fail(w, r, CauseUnsigned, "signed request required")
+	case errors.Is(err, ErrUnknownSigningKey), errors.Is(err, ErrSignatureMismatch):
+		m.fail(w, r, FailureCause(err), "invalid request signature")
+	case errors.Is(err, ErrStaleSignature):
+		m.fail(w, r, CauseStale, "request timestamp is too far from the server's clock")
+	case errors.Is(err, ErrReplayedRequest):
+		m.fail(w, r, CauseReplayed, "request was already received")
+	default:
+		log.Printf("auth: verifying signed request: %v", err)
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+	}
+	return nil, false
+}
+
 // AuthenticateFunc is a convenience wrapper for http.HandlerFunc.
 // Use this when your handler is a function, not an http.Handler.
 //
@@ -91,7 +349,9 @@ func (m *Middleware) AuthenticateFunc(next http.HandlerFunc) http.HandlerFunc {
 	return m.Authenticate(next).ServeHTTP
 }
 
-// extractBearerToken extracts the JWT token from the Authorization header.
+// extractToken extracts the JWT token from the Authorization header,
+// and the scheme it came with: "Bearer", or "DPoP" for a DPoP-bound
+// token (see DPoPVerifier).
 //
 // Expected header format: "Authorization: Bearer <token>"
 //
@@ -99,20 +359,27 @@ func (m *Middleware) AuthenticateFunc(next http.HandlerFunc) http.HandlerFunc {
 // "Bearer" is part of the OAuth 2.0 specification. It means
 // "whoever bears (carries) this token is authorized".
 // Other types exist (Basic, Digest) but Bearer is standard for JWT.
-func extractBearerToken(r *http.Request) (string, error) {
+// A DPoP-bound token is the exception: bearing it isn't enough.
+func extractToken(r *http.Request) (scheme, token string, err error) {
 	// Get the Authorization header
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("authorization header is required")
+		return "", "", errors.New("authorization header is required")
 	}
 
 	// Split "Bearer <token>" into parts
 	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		return "", errors.New("authorization header format must be 'Bearer <token>'")
+	if len(parts) != 2 {
+		return "", "", errors.New("authorization header format must be 'Bearer <token>'")
+	}
+	switch {
+	case strings.EqualFold(parts[0], "bearer"):
+		return "Bearer", parts[1], nil
+	case strings.EqualFold(parts[0], DPoPScheme):
+		return DPoPScheme, parts[1], nil
+	default:
+		return "", "", errors.New("authorization header format must be 'Bearer <token>'")
 	}
-
-	return parts[1], nil
 }
 
 // GetClaimsFromContext retrieves JWT claims from the request context.
@@ -125,8 +392,41 @@ func extractBearerToken(r *http.Request) (string, error) {
 //	    // Handle error - should not happen if middleware is applied
 //	}
 //	userID := claims.UserID
+//
+// On an impersonation token, UserID is the impersonated user and
+// claims.Actor is the staff member behind the request (see ImpersonatedBy).
+// Most handlers should ignore the difference; audit logs shouldn't.
 func GetClaimsFromContext(ctx context.Context) (*Claims, bool) {
 	// Type assertion: get the value and convert to *Claims
 	claims, ok := ctx.Value(ClaimsKey).(*Claims)
 	return claims, ok
 }
+
+// RequireToken returns middleware that only lets requests through when the
+// given header carries the expected static token.
+//
+// This is meant for operational endpoints (admin diagnostics, probes) that
+// need an extra, independently-rotated secret on top of normal auth.
+// If expected is empty the endpoint is disabled and answers 404, so an
+// unconfigured deployment doesn't expose it at all.
+func RequireToken(header, expected string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if expected == "" {
+				http.NotFound(w, r)
+				return
+			}
+
+			// SECURITY: subtle.ConstantTimeCompare takes the same time whether
+			// the first or the last byte differs, so attackers can't guess the
+			// token one character at a time by measuring response times.
+			provided := r.Header.Get(header)
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+				http.Error(w, "invalid or missing "+header, http.StatusForbidden)
+				return
+			}
+
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// Policy says how a route authenticates its callers.
+//
+// WHY MORE THAN BEARER TOKENS?
+// Users sign in and get a JWT. Other services - a billing worker, an
+// ops dashboard - have no password to sign in with, and a long-lived
+// token for them ends up in an environment variable and a few logs.
+// A client certificate (mutual TLS) is their identity instead: issued
+// by an internal CA, checked in the TLS handshake, never sent in a
+// header, and revoked by not renewing it.
+//
+// Most routes stay user routes (PolicyJWT, the default). Internal ones
+// can take a certificate instead of, or as well as, a token, and
+// integrations that can't hold a certificate can sign their requests
+// instead (see RequestVerifier).
+type Policy string
+
+// Route policies.
+const (
+	PolicyJWT        Policy = "jwt"          // A bearer token (the default)
+	PolicyMTLS       Policy = "mtls"         // A mapped client certificate
+	PolicyMTLSOrJWT  Policy = "mtls_or_jwt"  // Either; a certificate, if sent, is used
+	PolicyMTLSAndJWT Policy = "mtls_and_jwt" // Both: a service calling for a user
+
+	PolicySigned      Policy = "signed"        // A request signed with a shared secret
+	PolicySignedOrJWT Policy = "signed_or_jwt" // Either; a signature, if sent, is used
+)
+
+// ErrUnknownPolicy is returned by ParsePolicy for an unknown name.
+var ErrUnknownPolicy = errors.New("unknown auth policy")
+
+// ParsePolicy parses a policy name, e.g. "mtls_or_jwt".
+func ParsePolicy(name string) (Policy, error) {
+	switch p := Policy(name); p {
+	case PolicyJWT, PolicyMTLS, PolicyMTLSOrJWT, PolicyMTLSAndJWT, PolicySigned, PolicySignedOrJWT:
+		return p, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownPolicy, name)
+}
+
+// CertMapper maps verified client certificates to services, and each
+// service to the scopes it may use.
+//
+// A certificate is identified by, in order: its URI SANs (a SPIFFE ID
+// such as spiffe://corp/billing), its DNS SANs, then its subject's
+// common name. Rules name which one they match:
+//
+//	uri:spiffe://corp/billing
+//	dns:billing.internal
+//	cn:billing
+//
+// The rule that matches is the service's name (Claims.Service).
+//
+// Only the mapping happens here. Whether the certificate is genuine -
+// signed by the client CA, in date, meant for client auth - was checked
+// by the TLS handshake (see MTLS_CLIENT_CA_FILE); a request whose
+// certificate wasn't verified has none as far as CertMapper is concerned.
+type CertMapper struct {
+	services map[string][]string // Rule -> scopes
+}
+
+// NewCertMapper creates a mapper from services, rule to scopes. Each
+// scope must be one some role grants, so a typo fails here instead of
+// leaving a service mysteriously forbidden.
+func NewCertMapper(services map[string][]string) (*CertMapper, error) {
+	m := &CertMapper{services: make(map[string][]string, len(services))}
+	for rule, scopes := range services {
+		kind, value, ok := strings.Cut(rule, ":")
+		if !ok || value == "" || (kind != "uri" && kind != "dns" && kind != "cn") {
+			return nil, fmt.Errorf("certificate rule %q must be uri:, dns:, or cn: followed by a value", rule)
+		}
+		for _, scope := range scopes {
+			if !knownScope(scope) {
+				return nil, fmt.Errorf("certificate rule %q: unknown scope %q", rule, scope)
+			}
+		}
+		m.services[rule] = slices.Clone(scopes)
+	}
+	return m, nil
+}
+
+// ParseServiceSpec parses one MTLS_SERVICES entry,
+// "<rule>=<scope>+<scope>", e.g. "uri:spiffe://corp/ops=jobs:manage".
+func ParseServiceSpec(spec string) (rule string, scopes []string, err error) {
+	// Scopes have no "=", rules (URIs) might: split at the last one.
+	i := strings.LastIndex(spec, "=")
+	if i <= 0 || i == len(spec)-1 {
+		return "", nil, fmt.Errorf("service %q must be <rule>=<scope>+<scope>", spec)
+	}
+	return spec[:i], strings.Split(spec[i+1:], "+"), nil
+}
+
+// Service returns the name and scopes of the service cert belongs to,
+// or false if no rule matches it.
+func (m *CertMapper) Service(cert *x509.Certificate) (name string, scopes []string, ok bool) {
+	var rules []string
+	for _, uri := range cert.URIs {
+		rules = append(rules, "uri:"+uri.String())
+	}
+	for _, dns := range cert.DNSNames {
+		rules = append(rules, "dns:"+dns)
+	}
+	if cn := cert.Subject.CommonName; cn != "" {
+		rules = append(rules, "cn:"+cn)
+	}
+	for _, rule := range rules {
+		if scopes, ok := m.services[rule]; ok {
+			return rule, scopes, true
+		}
+	}
+	return "", nil, false
+}
+
+// knownScope reports whether some role grants scope.
+func knownScope(scope string) bool {
+	for _, scopes := range rolePermissions {
+		if slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientCertificate returns the request's client certificate, if it
+// sent one and the TLS handshake verified it.
+func clientCertificate(r *http.Request) (*x509.Certificate, bool) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, false
+	}
+	return r.TLS.VerifiedChains[0][0], true
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+)
+
+// Permission scopes.
+//
+// ROLES vs SCOPES:
+// A role says WHO the user is ("admin"). A scope says WHAT a token may do
+// ("users:write"). Handlers check scopes, never roles, so changing what a
+// role is allowed to do means editing rolePermissions below - not hunting
+// through every handler for RequireRole calls.
+//
+// Scope names follow the "resource:action" convention.
+const (
+	ScopeUsersRead      = "users:read"      // Read user profiles
+	ScopeUsersList      = "users:list"      // Enumerate every user
+	ScopeUsersWrite     = "users:write"     // Update and delete user profiles
+	ScopeRolesManage    = "roles:manage"    // Grant and revoke roles
+	ScopeDiagnosticsRun = "diagnostics:run" // Run whitelisted database diagnostics
+
+	ScopeUsersImpersonate = "users:impersonate" // Issue tokens that act as another user
+	ScopeTunablesManage   = "tunables:manage"   // View and adjust runtime tunables
+	ScopeJobsManage       = "jobs:manage"       // Inspect, requeue, and discard failed background jobs
+	ScopeEmailsManage     = "emails:manage"     // Preview and test-send account emails
+	ScopeAccountsManage   = "accounts:manage"   // Review dormant accounts, reactivate disabled ones, (de)activate accounts, confirm anonymizations, import users
+	ScopeTenantsManage    = "tenants:manage"    // Edit tenants' CORS, redirect, and webhook allowlists
+	ScopeUsersInvite      = "users:invite"      // Invite users, and resend or revoke invitations
+	ScopeCampaignsManage  = "campaigns:manage"  // Send email campaigns to segments of the users, and follow their delivery
+)
+
+// rolePermissions is the permission registry: the scopes each role grants.
+// A user with several roles gets the union of their scopes.
+var rolePermissions = map[string][]string{
+	RoleUser: {
+		ScopeUsersRead,
+		ScopeUsersWrite,
+	},
+	RoleAdmin: {
+		ScopeUsersRead,
+		ScopeUsersList,
+		ScopeUsersWrite,
+		ScopeRolesManage,
+		ScopeDiagnosticsRun,
+		ScopeUsersImpersonate,
+		ScopeTunablesManage,
+		ScopeJobsManage,
+		ScopeEmailsManage,
+		ScopeAccountsManage,
+		ScopeTenantsManage,
+		ScopeUsersInvite,
+		ScopeCampaignsManage,
+	},
+}
+
+// KnownScope reports whether some role grants scope.
+func KnownScope(scope string) bool {
+	for _, scopes := range rolePermissions {
+		if slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopesForRoles returns the sorted, de-duplicated scopes granted by roles.
+// Unknown roles grant nothing.
+func ScopesForRoles(roles []string) []string {
+	var scopes []string
+	for _, role := range roles {
+		for _, scope := range rolePermissions[role] {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	sort.Strings(scopes)
+	return scopes
+}
+
+// HasScope reports whether the claims include ALL of the given scopes.
+//
+// Note the difference from HasRole, which accepts ANY of its roles:
+// a handler that needs to read and write needs both scopes.
+func (c *Claims) HasScope(scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(c.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// RequireScope returns middleware that only lets the request through when
+// the token carries every given scope.
+//
+// Like RequireRole, it reads the claims stored by Authenticate and must be
+// applied INSIDE it. Routes declare what they need right where they're
+// registered:
+//
+//	mux.HandleFunc("PUT /users/{id}",
+//	    authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeUsersWrite)(h.update)))
+func RequireScope(scopes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaimsFromContext(r.Context())
+			if !ok {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !claims.HasScope(scopes...) {
+				http.Error(w, "insufficient scope", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package blob stores files the application serves to the public, such
+// as avatars, behind one interface with two backends: a directory on
+// local disk (Local) and an S3 bucket (S3).
+//
+// WHY NOT THE DATABASE?
+// A profile picture is tens of kilobytes, read on every page that shows
+// the user, and never queried. In MySQL each of those reads would hold a
+// connection to stream bytes the database can't do anything useful with.
+// In a blob store they're plain files behind a URL: a CDN caches them,
+// and browsers fetch them without touching the API at all.
+package blob
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// Store saves objects under keys and hands out public URLs for them.
+//
+// Keys are relative paths like "42-9f86d081.jpg". Objects are written
+// once and never changed: a new version gets a new key, so a URL that
+// was ever handed out can be cached forever.
+type Store interface {
+	// Put saves data under key, replacing anything there, and returns
+	// the object's public URL.
+	Put(ctx context.Context, key, contentType string, data []byte) (string, error)
+
+	// Delete removes the object under key. Deleting a missing object
+	// isn't an error.
+	Delete(ctx context.Context, key string) error
+
+	// URL returns the public URL of key, whether or not it exists.
+	URL(key string) string
+}
+
+// ErrInvalidKey is returned for a key that could escape its store
+// (e.g. "../config"), is hidden, or is empty.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// KeyOf returns the key behind url, a URL s handed out, or false if s
+// didn't hand it out (e.g. it's from a store configured before).
+func KeyOf(s Store, url string) (string, bool) {
+	key, ok := strings.CutPrefix(url, s.URL(""))
+	if !ok || checkKey(key) != nil {
+		return "", false
+	}
+	return key, true
+}
+
+// checkKey rejects keys that aren't a plain relative path. Hidden names
+// (".upload-...") are rejected too: they're Local's partial uploads.
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return ErrInvalidKey
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || strings.HasPrefix(part, ".") {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local stores objects as files in a directory. The application serves
+// them itself (Local is an http.Handler), or a web server in front of
+// it serves the directory directly.
+//
+// It suits a single instance, or several sharing a network volume. With
+// several instances and separate disks, an object written by one is
+// missing on the others; use S3.
+type Local struct {
+	dir     string
+	baseURL string // Ends in "/"
+}
+
+// NewLocal stores objects in dir, creating it if needed, and gives them
+// URLs under baseURL, e.g. "https://example.com/avatars" or "/avatars".
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating blob directory: %w", err)
+	}
+	return &Local{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/") + "/"}, nil
+}
+
+// Put implements Store.
+//
+// The file is written under a temporary name and renamed into place, so
+// a reader never sees half of it, and a crash never leaves half of it.
+func (l *Local) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	path := filepath.Join(l.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("creating blob directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("creating blob: %w", err)
+	}
+	defer os.Remove(tmp.Name()) // After the rename, there's nothing to remove
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	// CreateTemp makes the file readable only by us; the web server
+	// serving the directory may run as someone else.
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", fmt.Errorf("writing blob: %w", err)
+	}
+	return l.URL(key), nil
+}
+
+// Delete implements Store.
+func (l *Local) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("deleting blob: %w", err)
+	}
+	return nil
+}
+
+// URL implements Store.
+func (l *Local) URL(key string) string {
+	return l.baseURL + key
+}
+
+// ServeHTTP serves the object named by the {key} path parameter. Mount
+// it at the path of the base URL:
+//
+//	mux.Handle("GET /avatars/{key...}", local)
+//
+// Objects never change (see Store), so they're cacheable for a year.
+// nosniff stops a browser from running a file that claims to be an
+// image as anything else.
+func (l *Local) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	if checkKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(l.dir, filepath.FromSlash(key)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	// Only files: http.ServeFile would list a directory.
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, r, key, info.ModTime(), f)
+}
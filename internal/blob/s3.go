@@ -0,0 +1,228 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// S3Config says where an S3 store keeps its objects and how it signs in.
+type S3Config struct {
+	Bucket string
+	Region string // e.g. "eu-west-1"
+
+	// Endpoint is an S3-compatible service (MinIO, R2, ...), e.g.
+	// "https://minio.internal:9000". Empty means AWS.
+	Endpoint string
+
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PublicURL is where clients fetch objects, e.g. a CDN in front of
+	// the bucket. Empty means the bucket's own URL, which then has to
+	// allow public reads (a bucket policy; object ACLs are often off).
+	PublicURL string
+
+	// Client makes the requests. Nil means one with a 30s timeout.
+	Client *http.Client
+}
+
+// S3 stores objects in an S3 bucket, or any service that speaks its API.
+//
+// WHY NOT THE AWS SDK?
+// Two calls (PUT and DELETE of one object) don't need a dependency the
+// size of the rest of the application. What they do need is Signature
+// Version 4, which is below: a few HMACs over a canonical form of the
+// request.
+type S3 struct {
+	cfg       S3Config
+	objectURL string // Bucket URL, ending in "/"; the key is appended
+	publicURL string // Ending in "/"
+	client    *http.Client
+	now       func() time.Time
+}
+
+// NewS3 creates a store for cfg's bucket.
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Bucket == "" || cfg.Region == "" {
+		return nil, errors.New("S3 needs a bucket and a region")
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, errors.New("S3 needs an access key ID and a secret access key")
+	}
+
+	s := &S3{cfg: cfg, client: cfg.Client, now: time.Now}
+	if s.client == nil {
+		s.client = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.Endpoint == "" {
+		// Virtual-hosted style, what AWS wants for new buckets.
+		s.objectURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", cfg.Bucket, cfg.Region)
+	} else {
+		// Path style, what S3-compatible services can all do.
+		endpoint, err := url.Parse(cfg.Endpoint)
+		if err != nil || endpoint.Host == "" {
+			return nil, fmt.Errorf("S3 endpoint %q isn't a URL", cfg.Endpoint)
+		}
+		s.objectURL = strings.TrimSuffix(cfg.Endpoint, "/") + "/" + cfg.Bucket + "/"
+	}
+	s.publicURL = s.objectURL
+	if cfg.PublicURL != "" {
+		s.publicURL = strings.TrimSuffix(cfg.PublicURL, "/") + "/"
+	}
+	return s, nil
+}
+
+// Put implements Store.
+func (s *S3) Put(ctx context.Context, key, contentType string, data []byte) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	req, err := s.request(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", contentType)
+	// Objects never change (see Store); let every cache keep them.
+	req.Header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	if err := s.do(req); err != nil {
+		return "", fmt.Errorf("uploading %s: %w", key, err)
+	}
+	return s.URL(key), nil
+}
+
+// Delete implements Store. S3 answers a DELETE of a missing object with
+// 204 too.
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := s.request(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+	if err := s.do(req); err != nil {
+		return fmt.Errorf("deleting %s: %w", key, err)
+	}
+	return nil
+}
+
+// URL implements Store.
+func (s *S3) URL(key string) string {
+	return s.publicURL + escapePath(key)
+}
+
+// Close closes idle connections to S3.
+func (s *S3) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// request builds a signed request for the object key.
+func (s *S3) request(ctx context.Context, method, key string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectURL+escapePath(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, body, s.now().UTC())
+	return req, nil
+}
+
+// do sends req and turns a response other than 2xx into an error, with
+// S3's explanation (an XML <Error> document) in it.
+func (s *S3) do(req *http.Request) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body) // So the connection can be reused
+		return nil
+	}
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("S3 answered %s: %s", resp.Status, bytes.TrimSpace(detail))
+}
+
+// sign adds AWS Signature Version 4 headers to req, whose body is body.
+//
+// HOW SIGV4 WORKS:
+// The request is reduced to a canonical form - method, path, query,
+// the signed headers, and the body's SHA-256 - so that client and
+// server, each building it on their own, get the same bytes. That is
+// signed with a key derived from the secret in steps (date, region,
+// service), so a leaked signing key is only good for one day, one
+// region, and S3. The signature covers the time, and S3 refuses
+// requests more than 15 minutes off, so a captured request can't be
+// replayed later.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"", // No query
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretAccessKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// escapePath percent-encodes each segment of key the way SigV4 expects:
+// everything but letters, digits, and -._~ is escaped.
+func escapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-._~", c) >= 0 {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,161 @@
+// Package bulkhead keeps one tenant's load from taking the database
+// away from the others.
+//
+// THE PROBLEM:
+// Every tenant shares one connection pool (DB_MAX_OPEN_CONNS). A tenant
+// running a heavy integration, or a bulk export, can hold every
+// connection at once: the other tenants' requests then queue behind it
+// for a connection, and time out, although they asked for little.
+//
+// THE SOLUTION:
+// Like the watertight compartments of a ship's hull, each tenant gets a
+// compartment of its own: a semaphore capping how many of its requests
+// run at once. Requests beyond the cap wait a moment for a slot, then
+// are refused, and the tenant's flood stays in its compartment while
+// the rest of the pool serves everyone else.
+//
+// WHY CAP REQUESTS, NOT CONNECTIONS?
+// A request uses one connection at a time: its queries run one after
+// another, and a request transaction (package txn) holds one for the
+// whole request. So capping a tenant's requests caps its connections
+// at about the same number, with no change to the repositories. And a
+// request refused at the door has done nothing yet, where one refused
+// a connection halfway through has done half of its writes.
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go-basics/internal/metrics"
+)
+
+// ErrFull is returned by Acquire when the tenant's slots stayed taken
+// for the whole wait.
+var ErrFull = errors.New("bulkhead: tenant has too many requests in flight")
+
+// Bulkhead caps the requests each tenant has in flight.
+type Bulkhead struct {
+	limit  int            // Slots per tenant
+	limits map[string]int // Per-tenant overrides of limit; 0 is no cap
+	wait   time.Duration  // How long a request waits for a slot
+	labels *metrics.TenantLimiter
+
+	mu           sync.Mutex
+	compartments map[string]*compartment // Tenants with requests in flight or waiting
+	inFlight     map[string]int          // By metric label
+
+	inFlightGauge *metrics.GaugeVec
+	saturated     *metrics.CounterVec
+}
+
+// compartment is one tenant's slots.
+type compartment struct {
+	slots chan struct{} // One value per request in flight
+	refs  int           // Requests holding or waiting for a slot; guarded by Bulkhead.mu
+}
+
+// New creates a bulkhead giving each tenant limit slots, or the number
+// in limits for the tenants listed there (0 for no cap). A request
+// waits up to wait for a slot before Acquire gives up.
+//
+// It registers tenant_bulkhead_in_flight and
+// tenant_bulkhead_saturated_total on reg, with tenants turned into
+// label values by labels, so their number stays bounded.
+func New(limit int, limits map[string]int, wait time.Duration, reg *metrics.Registry, labels *metrics.TenantLimiter) *Bulkhead {
+	return &Bulkhead{
+		limit:        limit,
+		limits:       limits,
+		wait:         wait,
+		labels:       labels,
+		compartments: make(map[string]*compartment),
+		inFlight:     make(map[string]int),
+		inFlightGauge: reg.NewGaugeVec("tenant_bulkhead_in_flight",
+			"Requests each tenant has in flight under its bulkhead cap.", "tenant"),
+		saturated: reg.NewCounterVec("tenant_bulkhead_saturated_total",
+			"Requests that found their tenant's slots all taken, by tenant and outcome (waited for one, or rejected).", "tenant", "outcome"),
+	}
+}
+
+// limitFor returns tenant's number of slots; 0 means no cap.
+func (b *Bulkhead) limitFor(tenant string) int {
+	if limit, ok := b.limits[tenant]; ok {
+		return limit
+	}
+	return b.limit
+}
+
+// Acquire takes one of tenant's slots, waiting for one to free up if
+// they're all taken. Call release once the request is done. Requests
+// without a tenant, and tenants without a cap, aren't limited.
+//
+// It returns ErrFull if no slot freed up in time, or ctx's error if
+// the request was cancelled while waiting.
+func (b *Bulkhead) Acquire(ctx context.Context, tenant string) (release func(), err error) {
+	limit := b.limitFor(tenant)
+	if tenant == "" || limit <= 0 {
+		return func() {}, nil
+	}
+	label := b.labels.Label(tenant)
+	c := b.join(tenant, limit)
+
+	select {
+	case c.slots <- struct{}{}:
+	default:
+		timer := time.NewTimer(b.wait)
+		defer timer.Stop()
+		select {
+		case c.slots <- struct{}{}:
+			b.saturated.Inc(label, "waited")
+		case <-timer.C:
+			b.leave(tenant, c)
+			b.saturated.Inc(label, "rejected")
+			return nil, ErrFull
+		case <-ctx.Done():
+			b.leave(tenant, c)
+			return nil, ctx.Err()
+		}
+	}
+
+	b.track(label, 1)
+	return sync.OnceFunc(func() {
+		<-c.slots
+		b.track(label, -1)
+		b.leave(tenant, c)
+	}), nil
+}
+
+// join returns tenant's compartment, creating it for its first request.
+func (b *Bulkhead) join(tenant string, limit int) *compartment {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c, ok := b.compartments[tenant]
+	if !ok {
+		c = &compartment{slots: make(chan struct{}, limit)}
+		b.compartments[tenant] = c
+	}
+	c.refs++
+	return c
+}
+
+// leave drops tenant's compartment after its last request, so tenant
+// IDs, which clients choose, don't pile up in memory.
+func (b *Bulkhead) leave(tenant string, c *compartment) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c.refs--
+	if c.refs == 0 {
+		delete(b.compartments, tenant)
+	}
+}
+
+// track adds delta to the requests in flight under label. Tenants
+// sharing the "other" label add up.
+func (b *Bulkhead) track(label string, delta int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight[label] += delta
+	b.inFlightGauge.Set(float64(b.inFlight[label]), label)
+}
@@ -0,0 +1,46 @@
+package cache
+
+import "go-basics/internal/metrics"
+
+// Lookup results and eviction reasons, as metric labels.
+const (
+	resultHit  = "hit"
+	resultMiss = "miss"
+
+	reasonExpired  = "expired"  // Past its TTL
+	reasonCapacity = "capacity" // Least recently used, in a full cache
+)
+
+// Metrics counts what every cache sharing it does, by cache name.
+//
+// A hit rate is only meaningful next to the evictions: a cache evicting
+// for capacity all the time is too small for its working set, and its
+// hits are luck.
+type Metrics struct {
+	reg       *metrics.Registry
+	requests  *metrics.CounterVec // By cache and result
+	evictions *metrics.CounterVec // By cache and reason
+	entries   *metrics.GaugeVec   // By cache
+}
+
+// NewMetrics registers cache_requests_total, cache_evictions_total, and
+// cache_entries on reg. Create one and pass it to every cache (see
+// WithMetrics); a second would register the same names twice.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		reg: reg,
+		requests: reg.NewCounterVec("cache_requests_total",
+			"In-process cache lookups, by cache and result (hit, miss).", "cache", "result"),
+		evictions: reg.NewCounterVec("cache_evictions_total",
+			"Entries dropped from an in-process cache before being replaced, by cache and reason (expired, capacity).", "cache", "reason"),
+		entries: reg.NewGaugeVec("cache_entries",
+			"Entries held by an in-process cache, including expired ones not yet swept.", "cache"),
+	}
+}
+
+// track reports the cache called name's size at every scrape.
+func (m *Metrics) track(name string, size func() int) {
+	m.reg.OnScrape(func() {
+		m.entries.Set(float64(size()), name)
+	})
+}
@@ -0,0 +1,335 @@
+// Package cache provides TTL, a concurrency-safe in-process cache whose
+// entries expire, bounded in size.
+//
+// WHY ONE TYPE?
+// Several parts of the application keep something per user or per key
+// in memory for a while: token versions, rate limit buckets. Each used
+// to be a map behind a mutex, and each had to answer the same questions
+// on its own: when do entries go, what happens when there are a million
+// keys, how hot is the lock. The answers were "a sweep every 1024
+// calls", "nothing" or "start over", and "one lock for everything".
+// TTL answers them once:
+//
+//	expiry       every entry has a deadline; an expired one is never returned
+//	size         at most MaxEntries; the least recently used goes first
+//	contention   keys are spread over shards, each with its own lock
+//	visibility   hits, misses, and evictions are counted (see Metrics)
+package cache
+
+import (
+	"container/list"
+	"hash/maphash"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Defaults for New.
+const (
+	DefaultMaxEntries = 10000
+	DefaultShards     = 16
+)
+
+// sweepEvery is how many writes to a shard pass between removals of its
+// expired entries. Expired entries are never returned, but until a sweep
+// (or the LRU) gets to them they take up room.
+const sweepEvery = 1024
+
+// TTL is a cache from K to V. Its zero value isn't usable; call New.
+//
+// Entries expire after the cache's TTL (see WithTTL), shortened by up to
+// its jitter, or after the TTL given to Update. When the cache holds
+// MaxEntries, adding one evicts the least recently used.
+type TTL[K comparable, V any] struct {
+	name    string
+	ttl     time.Duration
+	jitter  float64
+	now     func() time.Time
+	metrics *Metrics
+
+	seed   maphash.Seed
+	shards []*shard[K, V]
+}
+
+// shard is one lock's worth of the cache: a map for lookups and a list
+// in recency order, most recent at the front.
+type shard[K comparable, V any] struct {
+	mu      sync.Mutex
+	entries map[K]*list.Element // Of *entry[K, V]
+	lru     *list.List
+	max     int
+	writes  int
+}
+
+// entry is one cached value.
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// config collects the Options; TTL's type parameters don't affect it.
+type config struct {
+	ttl        time.Duration
+	jitter     float64
+	maxEntries int
+	shards     int
+	now        func() time.Time
+	metrics    *Metrics
+}
+
+// Option configures a TTL.
+type Option func(*config)
+
+// WithTTL sets how long Set keeps an entry. Zero, the default, makes Set
+// do nothing: a cache configured not to cache.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *config) {
+		c.ttl = ttl
+	}
+}
+
+// WithJitter shortens each entry's TTL by a random fraction of it, up to
+// fraction (0 to 1).
+//
+// WHY JITTER?
+// Entries written together expire together. After a deploy every
+// instance fills its cache in the same few seconds, and ttl later they
+// all miss at once and hit the database at once. A random few percent
+// less spreads the refills out. It only ever shortens: a TTL is often a
+// promise ("a revoked token works at most this long"), and jitter mustn't
+// break it.
+func WithJitter(fraction float64) Option {
+	return func(c *config) {
+		c.jitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithMaxEntries bounds the number of entries (default DefaultMaxEntries).
+// The bound is split evenly between shards, so eviction starts when a
+// shard is full, a little before the whole cache is.
+func WithMaxEntries(n int) Option {
+	return func(c *config) {
+		c.maxEntries = n
+	}
+}
+
+// WithShards sets the number of shards (default DefaultShards), each with
+// its own lock. More shards mean less waiting under many concurrent
+// requests, and a less exact LRU: each shard evicts its own oldest.
+func WithShards(n int) Option {
+	return func(c *config) {
+		c.shards = n
+	}
+}
+
+// WithClock replaces time.Now, for tests.
+func WithClock(now func() time.Time) Option {
+	return func(c *config) {
+		c.now = now
+	}
+}
+
+// WithMetrics counts the cache's hits, misses, and evictions in m, under
+// the cache's name.
+func WithMetrics(m *Metrics) Option {
+	return func(c *config) {
+		c.metrics = m
+	}
+}
+
+// New creates an empty cache. name identifies it in metrics, e.g.
+// "token_versions".
+func New[K comparable, V any](name string, opts ...Option) *TTL[K, V] {
+	cfg := config{maxEntries: DefaultMaxEntries, shards: DefaultShards, now: time.Now}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.maxEntries = max(cfg.maxEntries, 1)
+	cfg.shards = min(max(cfg.shards, 1), cfg.maxEntries)
+
+	c := &TTL[K, V]{
+		name:    name,
+		ttl:     cfg.ttl,
+		jitter:  cfg.jitter,
+		now:     cfg.now,
+		metrics: cfg.metrics,
+		seed:    maphash.MakeSeed(),
+		shards:  make([]*shard[K, V], cfg.shards),
+	}
+	perShard := (cfg.maxEntries + cfg.shards - 1) / cfg.shards
+	for i := range c.shards {
+		c.shards[i] = &shard[K, V]{entries: make(map[K]*list.Element), lru: list.New(), max: perShard}
+	}
+	if c.metrics != nil {
+		c.metrics.track(name, c.Len)
+	}
+	return c
+}
+
+// shardFor returns the shard that holds key.
+func (c *TTL[K, V]) shardFor(key K) *shard[K, V] {
+	return c.shards[maphash.Comparable(c.seed, key)%uint64(len(c.shards))]
+}
+
+// Get returns the value for key, if there is one and it hasn't expired.
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	s := c.shardFor(key)
+	now := c.now()
+
+	var value V
+	s.mu.Lock()
+	e, expired := s.lookup(key, now)
+	if e != nil {
+		s.lru.MoveToFront(e)
+		value = e.Value.(*entry[K, V]).value
+	}
+	s.mu.Unlock()
+
+	if expired {
+		c.evicted(reasonExpired, 1)
+	}
+	if e == nil {
+		c.record(resultMiss)
+		return value, false
+	}
+	c.record(resultHit)
+	return value, true
+}
+
+// Set stores value for key for the cache's TTL, less jitter, replacing
+// any value it had.
+func (c *TTL[K, V]) Set(key K, value V) {
+	if c.ttl <= 0 {
+		return
+	}
+	ttl := c.ttl
+	if c.jitter > 0 {
+		ttl -= time.Duration(rand.Float64() * c.jitter * float64(ttl))
+	}
+	c.Update(key, func(V, bool) (V, time.Duration) {
+		return value, ttl
+	})
+}
+
+// Update replaces the value for key with fn's result, atomically: no
+// other call for a key in the same shard runs in between. fn gets the
+// current value, if there is one and it hasn't expired, and returns the
+// new value and how long to keep it, exactly (no jitter). A ttl of zero
+// or less deletes the entry.
+//
+// fn runs with the shard locked, so it must be quick and mustn't use the
+// cache. It's for read-modify-write, like taking a token from a bucket.
+func (c *TTL[K, V]) Update(key K, fn func(value V, found bool) (V, time.Duration)) {
+	s := c.shardFor(key)
+	now := c.now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.writes++
+	if s.writes%sweepEvery == 0 {
+		c.evicted(reasonExpired, s.sweep(now))
+	}
+
+	e, expired := s.lookup(key, now)
+	if expired {
+		c.evicted(reasonExpired, 1)
+	}
+	found := e != nil
+	var current V
+	if found {
+		current = e.Value.(*entry[K, V]).value
+	}
+	value, ttl := fn(current, found)
+
+	switch {
+	case ttl <= 0:
+		if found {
+			s.remove(e)
+		}
+	case found:
+		ent := e.Value.(*entry[K, V])
+		ent.value, ent.expires = value, now.Add(ttl)
+		s.lru.MoveToFront(e)
+	default:
+		if s.lru.Len() >= s.max {
+			s.remove(s.lru.Back())
+			c.evicted(reasonCapacity, 1)
+		}
+		s.entries[key] = s.lru.PushFront(&entry[K, V]{key: key, value: value, expires: now.Add(ttl)})
+	}
+}
+
+// Delete removes key, if it's cached.
+func (c *TTL[K, V]) Delete(key K) {
+	s := c.shardFor(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.entries[key]; ok {
+		s.remove(e)
+	}
+}
+
+// Len returns the number of entries, including expired ones no sweep
+// has removed yet.
+func (c *TTL[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		n += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// record counts a lookup, if the cache has metrics.
+func (c *TTL[K, V]) record(result string) {
+	if c.metrics != nil {
+		c.metrics.requests.Inc(c.name, result)
+	}
+}
+
+// evicted counts n evictions, if the cache has metrics.
+func (c *TTL[K, V]) evicted(reason string, n int) {
+	if c.metrics != nil {
+		for range n {
+			c.metrics.evictions.Inc(c.name, reason)
+		}
+	}
+}
+
+// lookup returns key's element, or nil if there's none. An expired one
+// is removed instead, and reported. The caller must hold s.mu.
+func (s *shard[K, V]) lookup(key K, now time.Time) (e *list.Element, expired bool) {
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !e.Value.(*entry[K, V]).expires.After(now) {
+		s.remove(e)
+		return nil, true
+	}
+	return e, false
+}
+
+// remove drops e. The caller must hold s.mu.
+func (s *shard[K, V]) remove(e *list.Element) {
+	s.lru.Remove(e)
+	delete(s.entries, e.Value.(*entry[K, V]).key)
+}
+
+// sweep drops expired entries and returns how many it dropped.
+// The caller must hold s.mu.
+func (s *shard[K, V]) sweep(now time.Time) int {
+	n := 0
+	for e := s.lru.Front(); e != nil; {
+		next := e.Next()
+		if !e.Value.(*entry[K, V]).expires.After(now) {
+			s.remove(e)
+			n++
+		}
+		e = next
+	}
+	return n
+}
@@ -0,0 +1,200 @@
+// Package captcha checks CAPTCHA answers with the service that issued
+// them: hCaptcha, Google reCAPTCHA, or Cloudflare Turnstile.
+//
+// HOW A CAPTCHA CHECK WORKS:
+// The client page shows the provider's widget, configured with our site
+// key. When the visitor passes it, the widget hands the page a one-time
+// token, which the page sends along with the form. We POST the token and
+// our secret key to the provider's siteverify endpoint, and it answers
+// whether the token is genuine, unused, and recent.
+//
+// WHY CHECK ON THE SERVER?
+// The widget running in the browser proves nothing: a bot skips the page
+// and calls the API directly. Only the provider can tell a real token from
+// a made-up one, and only our secret key can ask it.
+//
+// The three providers speak the same siteverify protocol, so they share
+// one implementation and differ only in their endpoint.
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// verifyTimeout bounds one siteverify request. The visitor is waiting on
+// it to sign up or in.
+const verifyTimeout = 5 * time.Second
+
+// Providers, as named in configuration.
+const (
+	HCaptcha  = "hcaptcha"
+	ReCAPTCHA = "recaptcha"
+	Turnstile = "turnstile"
+)
+
+// Providers lists the supported providers.
+var Providers = []string{HCaptcha, ReCAPTCHA, Turnstile}
+
+// endpoints are the providers' siteverify URLs.
+var endpoints = map[string]string{
+	HCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ReCAPTCHA: "https://www.google.com/recaptcha/api/siteverify",
+	Turnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// Sentinel errors.
+var (
+	// ErrMissing is returned when the request carries no token.
+	ErrMissing = errors.New("captcha required")
+
+	// ErrFailed is returned when the provider rejects the token: wrong,
+	// expired, already used, issued for another site, or (reCAPTCHA v3)
+	// scored as a bot.
+	ErrFailed = errors.New("captcha verification failed")
+
+	// ErrUnavailable is returned when the provider can't be asked. The
+	// request is refused anyway: letting it through would turn the
+	// check off for anyone who can slow the provider down.
+	ErrUnavailable = errors.New("captcha verification unavailable")
+
+	// ErrUnknownProvider is returned by New for a provider not in Providers.
+	ErrUnknownProvider = errors.New("unknown captcha provider")
+)
+
+// Verifier checks a CAPTCHA token.
+type Verifier interface {
+	// Verify returns nil if token is a valid answer from the visitor at
+	// remoteIP, for the form named action ("register", "login"). It
+	// returns ErrMissing, ErrFailed, or an error wrapping ErrUnavailable.
+	Verify(ctx context.Context, token, remoteIP, action string) error
+}
+
+// Option configures a Verifier.
+type Option func(*siteVerifier)
+
+// WithMinScore sets the lowest reCAPTCHA v3 score accepted, from 0.0
+// (certainly a bot) to 1.0 (certainly a person). Providers and versions
+// that don't score are unaffected.
+func WithMinScore(score float64) Option {
+	return func(v *siteVerifier) {
+		v.minScore = score
+	}
+}
+
+// WithHostnames only accepts tokens solved on these sites. Useful when
+// the site key is shared with other sites, or the provider is set to
+// skip its own domain check.
+func WithHostnames(hostnames ...string) Option {
+	return func(v *siteVerifier) {
+		for _, h := range hostnames {
+			v.hostnames[strings.ToLower(h)] = true
+		}
+	}
+}
+
+// WithEndpoint sends checks to a different siteverify URL, e.g. a
+// provider-compatible test server.
+func WithEndpoint(endpoint string) Option {
+	return func(v *siteVerifier) {
+		v.endpoint = endpoint
+	}
+}
+
+// New returns a Verifier for provider, authenticated with its secret key.
+func New(provider, secret string, opts ...Option) (Verifier, error) {
+	endpoint, ok := endpoints[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w %q (want one of %v)", ErrUnknownProvider, provider, Providers)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("%s needs a secret key", provider)
+	}
+	v := &siteVerifier{
+		provider:  provider,
+		endpoint:  endpoint,
+		secret:    secret,
+		hostnames: make(map[string]bool),
+		client:    &http.Client{Timeout: verifyTimeout},
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// siteVerifier implements Verifier with the siteverify protocol.
+type siteVerifier struct {
+	provider  string
+	endpoint  string
+	secret    string
+	minScore  float64
+	hostnames map[string]bool // Empty accepts any
+	client    *http.Client
+}
+
+// siteVerifyResponse is the providers' common answer. Score is only sent
+// by reCAPTCHA v3, and Action by reCAPTCHA v3 and Turnstile.
+type siteVerifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+	Hostname   string   `json:"hostname"`
+	Score      *float64 `json:"score"`
+	Action     string   `json:"action"`
+}
+
+// Verify implements Verifier.
+func (v *siteVerifier) Verify(ctx context.Context, token, remoteIP, action string) error {
+	if token == "" {
+		return ErrMissing
+	}
+	form := url.Values{"secret": {v.secret}, "response": {token}}
+	// The IP is an extra signal for the provider, not a requirement.
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrUnavailable, v.provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s answered %s", ErrUnavailable, v.provider, resp.Status)
+	}
+	var result siteVerifyResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&result); err != nil {
+		return fmt.Errorf("%w: decoding %s answer: %v", ErrUnavailable, v.provider, err)
+	}
+
+	switch {
+	case !result.Success:
+		// A bad secret is our misconfiguration, not the visitor's doing.
+		for _, code := range result.ErrorCodes {
+			if code == "invalid-input-secret" || code == "missing-input-secret" {
+				return fmt.Errorf("%w: %s rejected the secret key", ErrUnavailable, v.provider)
+			}
+		}
+		return fmt.Errorf("%w: %s", ErrFailed, strings.Join(result.ErrorCodes, ", "))
+	case len(v.hostnames) > 0 && !v.hostnames[strings.ToLower(result.Hostname)]:
+		return fmt.Errorf("%w: solved on %q", ErrFailed, result.Hostname)
+	// A token from the login form can't be replayed on the sign-up form.
+	case result.Action != "" && action != "" && result.Action != action:
+		return fmt.Errorf("%w: token is for %q, not %q", ErrFailed, result.Action, action)
+	case result.Score != nil && *result.Score < v.minScore:
+		return fmt.Errorf("%w: score %.1f is below %.1f", ErrFailed, *result.Score, v.minScore)
+	}
+	return nil
+}
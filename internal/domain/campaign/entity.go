@@ -0,0 +1,115 @@
+// Package campaign sends announcements from admins to a segment of the
+// users: everyone who signed up in a date range, holds a role, or has
+// (or hasn't) signed in lately.
+//
+// WHY NOT LOOP OVER THE USERS IN THE REQUEST?
+// A segment can be every account there is. Sending to all of them takes
+// longer than any request may, and faster than the mail provider will
+// take. So a campaign is stored, and the job system sends it one batch of
+// users at a time, at the rate the provider allows (see Service). Each
+// batch records who got the email, who didn't and why, and where the next
+// batch starts, so a campaign survives restarts and can be watched while
+// it goes out.
+package campaign
+
+import (
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// Status is where a campaign stands.
+type Status string
+
+// Campaign statuses.
+const (
+	StatusQueued    Status = "queued"    // Created; its first batch hasn't run yet
+	StatusSending   Status = "sending"   // Some batches ran, more are to come
+	StatusCompleted Status = "completed" // Every user in the segment was handled
+	StatusCanceled  Status = "canceled"  // An admin stopped it; the rest of the segment gets nothing
+)
+
+// Finished reports whether no more batches will run.
+func (s Status) Finished() bool {
+	return s == StatusCompleted || s == StatusCanceled
+}
+
+// Segment selects the users a campaign is sent to. Every condition set
+// must hold; zero values leave a condition out, so the zero Segment is
+// every user.
+type Segment struct {
+	// CreatedFrom and CreatedTo bound the signup time: at or after
+	// CreatedFrom, and before CreatedTo.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// Role, when set, matches only users who hold it.
+	Role user.Role
+
+	// ActiveSince matches users who signed in at or after it;
+	// InactiveSince those who haven't signed in since (or ever).
+	ActiveSince   time.Time
+	InactiveSince time.Time
+}
+
+// Campaign is one announcement and how far its sending has got.
+type Campaign struct {
+	ID        uint64
+	Subject   string // A text/template, like Body
+	Body      string // A text/template over Recipient, e.g. "Hi {{.Username}}"
+	Segment   Segment
+	Status    Status
+	CreatedBy uint64 // The admin who created it
+	CreatedAt time.Time
+	StartedAt *time.Time // When the first batch ran
+	EndedAt   *time.Time // When it completed or was canceled
+
+	// Cursor is where the next batch starts, an encoded user.Cursor; ""
+	// before the first.
+	Cursor string
+
+	// Progress, by delivery status.
+	Sent    int
+	Failed  int
+	Skipped int
+}
+
+// Recipient is what the subject and body templates are executed with.
+type Recipient struct {
+	ID       uint64
+	Email    string
+	Username string // "" if the user never chose one
+}
+
+// DeliveryStatus is what happened to a campaign's email to one user.
+type DeliveryStatus string
+
+// Delivery statuses.
+const (
+	DeliverySent    DeliveryStatus = "sent"    // Accepted by the mail provider
+	DeliveryFailed  DeliveryStatus = "failed"  // The provider refused it, or its template failed; Error says why
+	DeliverySkipped DeliveryStatus = "skipped" // In the segment, but not mailable; Error says why
+)
+
+// DeliveryStatuses lists the valid delivery statuses.
+var DeliveryStatuses = []DeliveryStatus{DeliverySent, DeliveryFailed, DeliverySkipped}
+
+// ParseDeliveryStatus validates a delivery status name.
+func ParseDeliveryStatus(s string) (DeliveryStatus, error) {
+	for _, status := range DeliveryStatuses {
+		if string(status) == s {
+			return status, nil
+		}
+	}
+	return "", ErrInvalidDeliveryStatus
+}
+
+// Delivery is the record of a campaign's email to one user.
+type Delivery struct {
+	CampaignID uint64
+	UserID     uint64
+	Email      string // The address it was sent to
+	Status     DeliveryStatus
+	Error      string // Why it failed or was skipped
+	At         time.Time
+}
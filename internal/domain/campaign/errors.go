@@ -0,0 +1,29 @@
+package campaign
+
+import "errors"
+
+// Sentinel errors for campaigns.
+var (
+	// ErrInvalidTemplate is returned for a subject or body that's empty,
+	// doesn't parse as a text/template, or uses a field Recipient hasn't.
+	ErrInvalidTemplate = errors.New("invalid campaign template")
+
+	// ErrInvalidSegment is returned for a segment with an unknown role,
+	// or a range that ends before it starts.
+	ErrInvalidSegment = errors.New("invalid campaign segment")
+
+	// ErrNotFound is returned for a campaign that doesn't exist.
+	ErrNotFound = errors.New("campaign not found")
+
+	// ErrFinished is returned for canceling a campaign that completed or
+	// was canceled already.
+	ErrFinished = errors.New("campaign already finished")
+
+	// ErrInvalidDeliveryStatus is returned for a delivery status that
+	// isn't one of DeliveryStatuses.
+	ErrInvalidDeliveryStatus = errors.New("invalid delivery status")
+
+	// ErrConflict is returned by Repository.SaveBatch when another batch
+	// of the campaign was saved first.
+	ErrConflict = errors.New("campaign progress was saved by another batch")
+)
@@ -0,0 +1,37 @@
+package campaign
+
+import (
+	"context"
+	"time"
+)
+
+// Repository stores campaigns and their deliveries.
+type Repository interface {
+	// Create stores a campaign and sets its ID.
+	Create(ctx context.Context, c *Campaign) error
+
+	// Campaign returns the campaign with id, or ErrNotFound.
+	Campaign(ctx context.Context, id uint64) (*Campaign, error)
+
+	// Campaigns returns up to limit campaigns, newest first.
+	Campaigns(ctx context.Context, limit int) ([]Campaign, error)
+
+	// SaveBatch records one batch, atomically: it stores the deliveries
+	// (keeping a user's earlier one instead, if any), adds the stored ones
+	// to the campaign's counts, and writes c's Cursor, Status, StartedAt,
+	// and EndedAt. A canceled campaign keeps its status and end time.
+	//
+	// It's conditional on the stored cursor still being from, so two
+	// runs of the same batch can't both count it: the second gets
+	// ErrConflict, and nothing is saved.
+	SaveBatch(ctx context.Context, c *Campaign, from string, deliveries []Delivery) error
+
+	// Cancel marks the campaign canceled at at, unless it finished
+	// already, and reports whether it did.
+	Cancel(ctx context.Context, id uint64, at time.Time) (bool, error)
+
+	// Deliveries returns up to limit of the campaign's deliveries with
+	// user IDs above afterUserID, in user ID order; only those with
+	// status, if it's set.
+	Deliveries(ctx context.Context, id uint64, status DeliveryStatus, afterUserID uint64, limit int) ([]Delivery, error)
+}
@@ -0,0 +1,421 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"go-basics/internal/domain/user"
+	"go-basics/internal/mail"
+)
+
+// saveTimeout bounds saving a batch's progress after the batch was cut
+// short by its context (see SendBatch).
+const saveTimeout = 5 * time.Second
+
+// Limits on a campaign's templates, the sizes of their columns.
+const (
+	maxSubjectLen = 255   // Characters
+	maxBodyLen    = 65535 // Bytes
+)
+
+// maxDeliveryError is the longest Delivery.Error stored; mail servers
+// can answer with pages.
+const maxDeliveryError = 255
+
+// BatchScheduler arranges for Service.SendBatch to run for a campaign.
+type BatchScheduler interface {
+	// ScheduleBatch makes sure a batch of the campaign runs soon. If one
+	// is already on its way it's left alone.
+	ScheduleBatch(ctx context.Context, campaignID uint64) error
+
+	// CancelBatch drops the campaign's waiting batch, if any.
+	CancelBatch(ctx context.Context, campaignID uint64) error
+}
+
+// Throttle paces sending to what the mail provider accepts.
+type Throttle interface {
+	// Wait blocks until one more email may be sent, or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// Draft is what an admin submits to create a campaign.
+type Draft struct {
+	Subject string
+	Body    string
+	Segment Segment
+}
+
+// Service creates campaigns and sends them.
+//
+// A campaign goes out one batch at a time: SendBatch lists the next
+// batchSize users in signup order, emails the ones in the segment, saves
+// the deliveries and the position reached, and schedules the next batch.
+// Only one batch of a campaign is ever scheduled, so batches run one
+// after another, and a campaign of any size holds one job worker at a
+// time.
+//
+// WHY CHECK ROLES AND ACTIVITY PER USER?
+// Users can be sharded, while roles and activity live in the main
+// database, so a segment can't be one query joining them. The signup
+// range is part of the user listing; roles and activity are looked up
+// for the users of a batch, and only if the segment asks for them.
+//
+// WHY SEND DIRECTLY INSTEAD OF THROUGH THE MAIL QUEUE?
+// Each delivery records whether the mail provider accepted the email.
+// Handing it to the queued mailer would only say it was queued, and
+// thousands of queued emails at once would crowd out password resets.
+type Service struct {
+	repo      Repository
+	users     user.Repository
+	roles     user.RoleRepository
+	activity  user.ActivityRepository
+	mailer    mail.Mailer
+	batches   BatchScheduler
+	throttle  Throttle
+	batchSize int // Users listed per batch
+	now       func() time.Time
+}
+
+// NewService creates the campaign service. mailer must send for real,
+// not queue (see Service).
+func NewService(repo Repository, users user.Repository, roles user.RoleRepository, activity user.ActivityRepository, mailer mail.Mailer, batches BatchScheduler, throttle Throttle, batchSize int) *Service {
+	return &Service{
+		repo:      repo,
+		users:     users,
+		roles:     roles,
+		activity:  activity,
+		mailer:    mailer,
+		batches:   batches,
+		throttle:  throttle,
+		batchSize: batchSize,
+		now:       time.Now,
+	}
+}
+
+// Create stores a campaign on behalf of the admin createdBy and
+// schedules its first batch. Returns ErrInvalidTemplate or
+// ErrInvalidSegment for a draft that can't be sent.
+func (s *Service) Create(ctx context.Context, draft Draft, createdBy uint64) (*Campaign, error) {
+	if _, _, err := parseTemplates(draft.Subject, draft.Body); err != nil {
+		return nil, err
+	}
+	if err := validateSegment(draft.Segment); err != nil {
+		return nil, err
+	}
+
+	c := &Campaign{
+		Subject:   draft.Subject,
+		Body:      draft.Body,
+		Segment:   draft.Segment,
+		Status:    StatusQueued,
+		CreatedBy: createdBy,
+		CreatedAt: s.now(),
+	}
+	if err := s.repo.Create(ctx, c); err != nil {
+		return nil, fmt.Errorf("storing campaign: %w", err)
+	}
+	if err := s.batches.ScheduleBatch(ctx, c.ID); err != nil {
+		return nil, fmt.Errorf("scheduling campaign: %w", err)
+	}
+	return c, nil
+}
+
+// Campaign returns one campaign, or ErrNotFound.
+func (s *Service) Campaign(ctx context.Context, id uint64) (*Campaign, error) {
+	return s.repo.Campaign(ctx, id)
+}
+
+// Campaigns returns up to limit campaigns, newest first.
+func (s *Service) Campaigns(ctx context.Context, limit int) ([]Campaign, error) {
+	return s.repo.Campaigns(ctx, limit)
+}
+
+// Deliveries returns a page of the campaign's deliveries, in user ID
+// order, with the given status ("" for any). Returns ErrNotFound for a
+// campaign that doesn't exist.
+func (s *Service) Deliveries(ctx context.Context, id uint64, status string, afterUserID uint64, limit int) ([]Delivery, error) {
+	var filter DeliveryStatus
+	if status != "" {
+		var err error
+		if filter, err = ParseDeliveryStatus(status); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := s.repo.Campaign(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.Deliveries(ctx, id, filter, afterUserID, limit)
+}
+
+// Cancel stops the campaign: no further batch runs. A batch that's
+// running finishes, and its deliveries count. Returns ErrFinished for a
+// campaign that completed or was canceled already.
+func (s *Service) Cancel(ctx context.Context, id uint64) (*Campaign, error) {
+	c, err := s.repo.Campaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status.Finished() {
+		return nil, ErrFinished
+	}
+	now := s.now()
+	canceled, err := s.repo.Cancel(ctx, id, now)
+	if err != nil {
+		return nil, fmt.Errorf("canceling campaign: %w", err)
+	}
+	if !canceled {
+		// Completed by its last batch since it was read.
+		return nil, ErrFinished
+	}
+	if err := s.batches.CancelBatch(ctx, id); err != nil {
+		// The batch finds the campaign canceled and does nothing.
+		return nil, fmt.Errorf("unscheduling campaign: %w", err)
+	}
+	c.Status, c.EndedAt = StatusCanceled, &now
+	return c, nil
+}
+
+// SendBatch sends the campaign's next batch, and schedules the one after
+// it, or marks the campaign completed when the segment runs out. It does
+// nothing for a campaign that's gone or finished.
+//
+// If ctx is done mid-batch (the server is shutting down) or a lookup
+// fails, the deliveries so far are saved before the error is returned,
+// so the retried job picks up where this one stopped instead of emailing
+// the same users twice.
+func (s *Service) SendBatch(ctx context.Context, id uint64) error {
+	c, err := s.repo.Campaign(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if c.Status.Finished() {
+		return nil
+	}
+	subject, body, err := parseTemplates(c.Subject, c.Body)
+	if err != nil {
+		return err
+	}
+
+	params := user.ListParams{
+		Limit:  s.batchSize,
+		Filter: user.ListFilter{CreatedFrom: c.Segment.CreatedFrom, CreatedTo: c.Segment.CreatedTo},
+	}
+	if c.Cursor != "" {
+		after, err := user.DecodeCursor(c.Cursor)
+		if err != nil {
+			return fmt.Errorf("decoding campaign cursor: %w", err)
+		}
+		params.After = &after
+	}
+	users, err := s.users.List(ctx, params)
+	if err != nil {
+		return fmt.Errorf("listing users: %w", err)
+	}
+
+	from := c.Cursor
+	now := s.now()
+	if c.StartedAt == nil {
+		c.StartedAt = &now
+	}
+	c.Status = StatusSending
+
+	var deliveries []Delivery
+	var stopped error
+	for _, u := range users {
+		match, err := s.matches(ctx, u, c.Segment)
+		if err != nil {
+			stopped = err
+			break
+		}
+		if match {
+			d, err := s.deliver(ctx, c.ID, u, subject, body)
+			if err != nil {
+				stopped = err
+				break
+			}
+			deliveries = append(deliveries, d)
+		}
+		next := user.CursorFor(u, params)
+		c.Cursor = next.Encode()
+	}
+
+	if stopped != nil {
+		if c.Cursor != from {
+			saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), saveTimeout)
+			defer cancel()
+			if err := s.repo.SaveBatch(saveCtx, c, from, deliveries); err != nil {
+				return errors.Join(stopped, fmt.Errorf("saving campaign progress: %w", err))
+			}
+		}
+		return stopped
+	}
+
+	if len(users) < s.batchSize {
+		c.Status, c.EndedAt = StatusCompleted, &now
+	}
+	err = s.repo.SaveBatch(ctx, c, from, deliveries)
+	if errors.Is(err, ErrConflict) {
+		// Another run of this batch saved it, and scheduled the next.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("saving campaign progress: %w", err)
+	}
+	if c.Status == StatusCompleted {
+		return nil
+	}
+	if err := s.batches.ScheduleBatch(ctx, c.ID); err != nil {
+		return fmt.Errorf("scheduling the next batch: %w", err)
+	}
+	return nil
+}
+
+// matches reports whether u is in seg, apart from the signup range,
+// which the listing applied already.
+func (s *Service) matches(ctx context.Context, u *user.User, seg Segment) (bool, error) {
+	if seg.Role != "" {
+		roles, err := s.roles.RolesFor(ctx, u.ID)
+		if err != nil {
+			return false, fmt.Errorf("reading roles of user %d: %w", u.ID, err)
+		}
+		if !slices.Contains(roles, seg.Role) {
+			return false, nil
+		}
+	}
+	if !seg.ActiveSince.IsZero() || !seg.InactiveSince.IsZero() {
+		a, err := s.activity.Find(ctx, u.ID)
+		if err != nil {
+			return false, fmt.Errorf("reading activity of user %d: %w", u.ID, err)
+		}
+		var last time.Time // Never signed in
+		if a != nil {
+			last = a.LastLoginAt
+		}
+		if !seg.ActiveSince.IsZero() && last.Before(seg.ActiveSince) {
+			return false, nil
+		}
+		if !seg.InactiveSince.IsZero() && !last.Before(seg.InactiveSince) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// deliver emails the campaign to u, or skips u, and returns the record
+// of it. A refused email is a failed delivery, not an error; the error
+// is ctx's, when it's done while waiting for the throttle.
+func (s *Service) deliver(ctx context.Context, campaignID uint64, u *user.User, subject, body *template.Template) (Delivery, error) {
+	d := Delivery{CampaignID: campaignID, UserID: u.ID, Email: u.Email}
+	if reason := skipReason(u); reason != "" {
+		d.Status, d.Error, d.At = DeliverySkipped, reason, s.now()
+		return d, nil
+	}
+
+	msg, err := message(subject, body, u)
+	if err != nil {
+		d.Status, d.Error, d.At = DeliveryFailed, truncate(err.Error(), maxDeliveryError), s.now()
+		return d, nil
+	}
+	if err := s.throttle.Wait(ctx); err != nil {
+		return Delivery{}, err
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		d.Status, d.Error, d.At = DeliveryFailed, truncate(err.Error(), maxDeliveryError), s.now()
+		return d, nil
+	}
+	d.Status, d.At = DeliverySent, s.now()
+	return d, nil
+}
+
+// skipReason says why u gets no campaign email, or "" if it does.
+// Announcements only go to addresses their owners proved they read:
+// mail to unverified or abandoned ones bounces, and bounces cost the
+// sender its reputation with the provider.
+func skipReason(u *user.User) string {
+	switch {
+	case !u.Active:
+		return "account deactivated"
+	case u.PasswordHash == user.InvitedPasswordHash:
+		return "invitation not accepted"
+	case !u.EmailVerified:
+		return "email not verified"
+	default:
+		return ""
+	}
+}
+
+// validateSegment checks the segment's role exists and its ranges are
+// not empty.
+func validateSegment(seg Segment) error {
+	if seg.Role != "" {
+		if _, err := user.ParseRole(string(seg.Role)); err != nil {
+			return fmt.Errorf("%w: unknown role %q", ErrInvalidSegment, seg.Role)
+		}
+	}
+	if !seg.CreatedFrom.IsZero() && !seg.CreatedTo.IsZero() && !seg.CreatedFrom.Before(seg.CreatedTo) {
+		return fmt.Errorf("%w: created_from must be before created_to", ErrInvalidSegment)
+	}
+	if !seg.ActiveSince.IsZero() && !seg.InactiveSince.IsZero() && !seg.ActiveSince.Before(seg.InactiveSince) {
+		return fmt.Errorf("%w: active_since must be before inactive_since", ErrInvalidSegment)
+	}
+	return nil
+}
+
+// parseTemplates parses a campaign's subject and body, and executes
+// them once for a blank recipient, so a field Recipient hasn't fails
+// now rather than in every delivery.
+func parseTemplates(subject, body string) (*template.Template, *template.Template, error) {
+	if strings.TrimSpace(subject) == "" || strings.TrimSpace(body) == "" {
+		return nil, nil, fmt.Errorf("%w: subject and body are required", ErrInvalidTemplate)
+	}
+	if utf8.RuneCountInString(subject) > maxSubjectLen || len(body) > maxBodyLen {
+		return nil, nil, fmt.Errorf("%w: subject must be at most %d characters, and body %d bytes", ErrInvalidTemplate, maxSubjectLen, maxBodyLen)
+	}
+	subj, err := template.New("subject").Parse(subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	text, err := template.New("body").Parse(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+	}
+	for _, t := range []*template.Template{subj, text} {
+		if err := t.Execute(new(strings.Builder), Recipient{}); err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidTemplate, err)
+		}
+	}
+	return subj, text, nil
+}
+
+// message renders the campaign email for u.
+func message(subject, body *template.Template, u *user.User) (mail.Message, error) {
+	r := Recipient{ID: u.ID, Email: u.Email, Username: u.Username}
+	var subj, text strings.Builder
+	if err := subject.Execute(&subj, r); err != nil {
+		return mail.Message{}, fmt.Errorf("rendering subject: %w", err)
+	}
+	if err := body.Execute(&text, r); err != nil {
+		return mail.Message{}, fmt.Errorf("rendering body: %w", err)
+	}
+	return mail.Message{To: u.Email, Subject: subj.String(), Body: text.String()}, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
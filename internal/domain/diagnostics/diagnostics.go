@@ -0,0 +1,36 @@
+// Package diagnostics defines read-only database diagnostics that operators
+// can run during incidents without direct database access.
+//
+// Only queries from a fixed whitelist can be run. Callers choose a query by
+// name and supply named parameters, which are always bound as placeholders.
+package diagnostics
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrUnknownQuery is returned when the requested query isn't whitelisted.
+	ErrUnknownQuery = errors.New("unknown diagnostic query")
+
+	// ErrInvalidParams is returned when parameters are missing or not allowed.
+	ErrInvalidParams = errors.New("invalid diagnostic parameters")
+)
+
+// Result holds the rows returned by a diagnostic query.
+type Result struct {
+	Query   string          `json:"query"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Runner executes whitelisted diagnostic queries.
+// The MySQL repository package provides the implementation.
+type Runner interface {
+	// Queries returns the names of all available queries.
+	Queries() []string
+
+	// Run executes the named query with the given parameters.
+	Run(ctx context.Context, name string, params map[string]string) (*Result, error)
+}
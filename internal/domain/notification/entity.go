@@ -0,0 +1,122 @@
+// Package notification tells users about things that happened to their
+// account, by email and, for browsers that subscribed, by web push.
+//
+// WHY NOT JUST SEND AN EMAIL?
+// Some events matter right away ("your password was changed"); most are
+// only worth knowing about eventually ("you signed in on a new device").
+// One email per event buries the first kind under the second, and users
+// learn to ignore the lot. So each notification has a priority: high ones
+// are sent at once, low ones wait and go out together in one digest, as
+// often as the user chose.
+package notification
+
+import "time"
+
+// Priority decides whether a notification can wait for the digest.
+type Priority int
+
+const (
+	// PriorityLow notifications wait for the user's next digest.
+	PriorityLow Priority = iota
+
+	// PriorityHigh notifications are sent at once, whatever the
+	// user's frequency.
+	PriorityHigh
+)
+
+// Notification kinds.
+const (
+	KindNewSignIn       = "security.new_sign_in"
+	KindPasswordChanged = "security.password_changed"
+)
+
+// Notification is one event to tell a user about.
+type Notification struct {
+	ID        uint64
+	UserID    uint64
+	Kind      string
+	Priority  Priority
+	Subject   string // The email subject, or the line in a digest
+	Body      string
+	CreatedAt time.Time
+}
+
+// NewSignIn is the low-priority notice of a sign-in.
+func NewSignIn(userID uint64, userAgent, ipAddress string) Notification {
+	if userAgent == "" {
+		userAgent = "an unknown device"
+	}
+	return Notification{
+		UserID:   userID,
+		Kind:     KindNewSignIn,
+		Priority: PriorityLow,
+		Subject:  "New sign-in to your account",
+		Body: "Your account was signed in to from " + userAgent + " (" + ipAddress + ").\n\n" +
+			"If it wasn't you, change your password now.\n",
+	}
+}
+
+// PasswordChanged is the high-priority notice of a password change.
+func PasswordChanged(userID uint64) Notification {
+	return Notification{
+		UserID:   userID,
+		Kind:     KindPasswordChanged,
+		Priority: PriorityHigh,
+		Subject:  "Your password was changed",
+		Body: "The password for your account was just changed, and every device was signed out.\n\n" +
+			"If it wasn't you, reset your password now: someone else has access to your account.\n",
+	}
+}
+
+// PushSubscription is a browser that asked for push notifications: the
+// PushSubscription object its service worker got from the browser.
+type PushSubscription struct {
+	ID        uint64
+	UserID    uint64
+	Endpoint  string // The push service URL to post to
+	P256dh    string // The browser's public key, base64url
+	Auth      string // The secret shared with the browser, base64url
+	UserAgent string // The browser that subscribed, for the user's list
+	CreatedAt time.Time
+}
+
+// Frequency is how often a user gets the digest of their low-priority
+// notifications.
+type Frequency string
+
+// Digest frequencies. FrequencyImmediate skips the digest: every
+// notification is sent on its own.
+const (
+	FrequencyImmediate Frequency = "immediate"
+	FrequencyHourly    Frequency = "hourly"
+	FrequencyDaily     Frequency = "daily"
+	FrequencyWeekly    Frequency = "weekly"
+)
+
+// Frequencies lists the valid frequencies, most frequent first.
+var Frequencies = []Frequency{FrequencyImmediate, FrequencyHourly, FrequencyDaily, FrequencyWeekly}
+
+// ParseFrequency validates a frequency name.
+func ParseFrequency(s string) (Frequency, error) {
+	for _, f := range Frequencies {
+		if string(f) == s {
+			return f, nil
+		}
+	}
+	return "", ErrInvalidFrequency
+}
+
+// Window is how long notifications wait for the digest: from the first
+// one collected to the digest that sends them.
+func (f Frequency) Window() time.Duration {
+	switch f {
+	case FrequencyHourly:
+		return time.Hour
+	case FrequencyDaily:
+		return 24 * time.Hour
+	case FrequencyWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
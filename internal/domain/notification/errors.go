@@ -0,0 +1,22 @@
+package notification
+
+import "errors"
+
+// Sentinel errors for notifications.
+var (
+	// ErrInvalidFrequency is returned for a digest frequency that isn't
+	// one of Frequencies.
+	ErrInvalidFrequency = errors.New("invalid notification frequency")
+
+	// ErrPushDisabled is returned by the push subscription methods when
+	// web push isn't configured.
+	ErrPushDisabled = errors.New("web push is not enabled")
+
+	// ErrInvalidSubscription is returned for a push subscription with an
+	// endpoint that isn't an allowed push service, or unusable keys.
+	ErrInvalidSubscription = errors.New("invalid push subscription")
+
+	// ErrSubscriptionNotFound is returned for a push subscription that
+	// doesn't exist or belongs to another user.
+	ErrSubscriptionNotFound = errors.New("push subscription not found")
+)
@@ -0,0 +1,144 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-basics/internal/webpush"
+)
+
+// maxSubscriptionsPerUser bounds the browsers one user gets pushes on.
+// Browsers that are uninstalled never unsubscribe, so the oldest beyond
+// this are dropped rather than the new one refused.
+const maxSubscriptionsPerUser = 10
+
+// Limits matching the push_subscriptions columns. Real endpoints are a
+// few hundred bytes.
+const (
+	maxEndpointLength  = 2048
+	maxUserAgentLength = 255
+)
+
+// Pusher sends one notification to one subscribed browser.
+type Pusher interface {
+	Push(ctx context.Context, sub PushSubscription, n Notification) error
+}
+
+// Option configures the Service.
+type Option func(*Service)
+
+// WithPush also sends every notification to the user's subscribed
+// browsers, the moment it happens.
+//
+// WHY PUSH EVERYTHING AT ONCE?
+// The digest exists to keep the inbox quiet. A push is one line on a
+// screen that goes away by itself, and it reaches users who never read
+// that inbox - so security alerts go out as they happen, whatever the
+// digest frequency. allowedHosts are the push service domains an endpoint
+// may be on (subdomains included).
+func WithPush(subs SubscriptionRepository, pusher Pusher, allowedHosts []string) Option {
+	return func(s *Service) {
+		s.subscriptions = subs
+		s.pusher = pusher
+		s.pushHosts = allowedHosts
+	}
+}
+
+// Subscribe stores a browser's push subscription for the user.
+func (s *Service) Subscribe(ctx context.Context, sub PushSubscription) (*PushSubscription, error) {
+	if s.pusher == nil {
+		return nil, ErrPushDisabled
+	}
+	if !s.allowedEndpoint(sub.Endpoint) {
+		return nil, ErrInvalidSubscription
+	}
+	keys := webpush.Subscription{Endpoint: sub.Endpoint, P256dh: sub.P256dh, Auth: sub.Auth}
+	if err := webpush.CheckSubscription(keys); err != nil {
+		return nil, ErrInvalidSubscription
+	}
+
+	sub.UserAgent = truncate(sub.UserAgent, maxUserAgentLength)
+	sub.CreatedAt = time.Now()
+	if err := s.subscriptions.SaveSubscription(ctx, &sub); err != nil {
+		return nil, fmt.Errorf("storing push subscription: %w", err)
+	}
+	if err := s.subscriptions.PruneSubscriptions(ctx, sub.UserID, maxSubscriptionsPerUser); err != nil {
+		return nil, fmt.Errorf("pruning push subscriptions: %w", err)
+	}
+	return &sub, nil
+}
+
+// Subscriptions returns the user's subscribed browsers, newest first.
+func (s *Service) Subscriptions(ctx context.Context, userID uint64) ([]PushSubscription, error) {
+	if s.pusher == nil {
+		return nil, ErrPushDisabled
+	}
+	subs, err := s.subscriptions.Subscriptions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing push subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// Unsubscribe removes one of the user's subscriptions.
+func (s *Service) Unsubscribe(ctx context.Context, userID, id uint64) error {
+	if s.pusher == nil {
+		return ErrPushDisabled
+	}
+	return s.subscriptions.DeleteSubscription(ctx, userID, id)
+}
+
+// push sends n to each of the user's browsers. One failing browser
+// doesn't keep the others from getting it.
+func (s *Service) push(ctx context.Context, n Notification) error {
+	if s.pusher == nil {
+		return nil
+	}
+	subs, err := s.subscriptions.Subscriptions(ctx, n.UserID)
+	if err != nil {
+		return fmt.Errorf("listing push subscriptions: %w", err)
+	}
+	var errs []error
+	for _, sub := range subs {
+		if err := s.pusher.Push(ctx, sub, n); err != nil {
+			errs = append(errs, fmt.Errorf("pushing to subscription %d: %w", sub.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// allowedEndpoint reports whether endpoint is an https URL on one of the
+// allowed push services.
+func (s *Service) allowedEndpoint(endpoint string) bool {
+	if len(endpoint) > maxEndpointLength {
+		return false
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range s.pushHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
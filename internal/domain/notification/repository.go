@@ -0,0 +1,46 @@
+package notification
+
+import "context"
+
+// Repository stores pending notifications and frequency preferences.
+type Repository interface {
+	// AddPending stores a notification for the user's next digest and
+	// sets its ID.
+	AddPending(ctx context.Context, n *Notification) error
+
+	// TakePending removes and returns the user's pending notifications,
+	// oldest first. Of two concurrent calls, only one gets each
+	// notification.
+	TakePending(ctx context.Context, userID uint64) ([]Notification, error)
+
+	// Frequency returns the user's chosen frequency, or "" if they
+	// never chose one.
+	Frequency(ctx context.Context, userID uint64) (Frequency, error)
+
+	// SetFrequency stores the user's frequency.
+	SetFrequency(ctx context.Context, userID uint64, f Frequency) error
+}
+
+// SubscriptionRepository stores browsers' push subscriptions.
+type SubscriptionRepository interface {
+	// SaveSubscription stores a subscription and sets its ID. A browser
+	// has one endpoint, so saving an endpoint that exists replaces it,
+	// keys and user included: whoever subscribed last on that browser
+	// gets its pushes.
+	SaveSubscription(ctx context.Context, sub *PushSubscription) error
+
+	// Subscription returns one subscription by ID, or
+	// ErrSubscriptionNotFound.
+	Subscription(ctx context.Context, id uint64) (*PushSubscription, error)
+
+	// Subscriptions returns the user's subscriptions, newest first.
+	Subscriptions(ctx context.Context, userID uint64) ([]PushSubscription, error)
+
+	// DeleteSubscription removes one of the user's subscriptions, or
+	// returns ErrSubscriptionNotFound.
+	DeleteSubscription(ctx context.Context, userID, id uint64) error
+
+	// PruneSubscriptions deletes all but the user's keep newest
+	// subscriptions.
+	PruneSubscriptions(ctx context.Context, userID uint64, keep int) error
+}
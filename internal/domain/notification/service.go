@@ -0,0 +1,184 @@
+package notification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-basics/internal/mail"
+)
+
+// EmailLookup returns the address to notify a user at, or "" (and no
+// error) if the user no longer exists.
+type EmailLookup func(ctx context.Context, userID uint64) (string, error)
+
+// DigestScheduler arranges for Service.SendDigest to run for a user.
+type DigestScheduler interface {
+	// ScheduleDigest makes sure a digest for the user runs within after.
+	// If one is already on its way it's left alone, so a digest goes out
+	// one window after the first notification it collects, not after
+	// the last.
+	ScheduleDigest(ctx context.Context, userID uint64, after time.Duration) error
+}
+
+// Service sends notifications, at once or batched into digests.
+//
+// WHY SCHEDULE A DIGEST PER USER?
+// A single "send every digest" run each hour would mean a scan of every
+// user for mostly nothing, and one huge batch of email at the top of the
+// hour. A digest scheduled when a user's first notification arrives only
+// exists for users who have something to read, and the sends spread out
+// over the day the way the events did.
+type Service struct {
+	repo             Repository
+	emails           EmailLookup
+	mailer           mail.Mailer
+	digests          DigestScheduler
+	defaultFrequency Frequency // For users who never chose one
+
+	// Web push, when configured (see WithPush).
+	subscriptions SubscriptionRepository
+	pusher        Pusher
+	pushHosts     []string
+}
+
+// NewService creates the notification service. Users who never chose a
+// frequency get defaultFrequency.
+func NewService(repo Repository, emails EmailLookup, mailer mail.Mailer, digests DigestScheduler, defaultFrequency Frequency, opts ...Option) *Service {
+	s := &Service{
+		repo:             repo,
+		emails:           emails,
+		mailer:           mailer,
+		digests:          digests,
+		defaultFrequency: defaultFrequency,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Notify pushes a notification to the user's browsers, if any, and
+// emails it: a high-priority one, or a low-priority one for a user who
+// wants them immediately, at once. Any other email waits for the user's
+// next digest.
+func (s *Service) Notify(ctx context.Context, n Notification) error {
+	pushErr := s.push(ctx, n)
+	return errors.Join(pushErr, s.email(ctx, n))
+}
+
+// email sends n now or adds it to the user's digest.
+func (s *Service) email(ctx context.Context, n Notification) error {
+	if n.Priority == PriorityHigh {
+		return s.send(ctx, n.UserID, n.Subject, n.Body)
+	}
+
+	freq, err := s.Frequency(ctx, n.UserID)
+	if err != nil {
+		return err
+	}
+	if freq == FrequencyImmediate {
+		return s.send(ctx, n.UserID, n.Subject, n.Body)
+	}
+
+	if err := s.repo.AddPending(ctx, &n); err != nil {
+		return fmt.Errorf("storing notification: %w", err)
+	}
+	if err := s.digests.ScheduleDigest(ctx, n.UserID, freq.Window()); err != nil {
+		return fmt.Errorf("scheduling digest: %w", err)
+	}
+	return nil
+}
+
+// SendDigest sends one email with all of the user's pending
+// notifications, if there are any.
+//
+// The notifications are removed before the email is handed to the
+// mailer, so two digests running at once can't both send them. With the
+// queued mailer, a failed send is retried by the mail job itself.
+func (s *Service) SendDigest(ctx context.Context, userID uint64) error {
+	pending, err := s.repo.TakePending(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("taking pending notifications: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	email, err := s.emails(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("finding user email: %w", err)
+	}
+	if email == "" {
+		// The account was deleted while the digest waited.
+		return nil
+	}
+	if err := s.mailer.Send(ctx, digestMessage(email, pending)); err != nil {
+		return fmt.Errorf("sending digest: %w", err)
+	}
+	return nil
+}
+
+// Frequency returns the user's digest frequency.
+func (s *Service) Frequency(ctx context.Context, userID uint64) (Frequency, error) {
+	freq, err := s.repo.Frequency(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("reading notification frequency: %w", err)
+	}
+	if freq == "" {
+		return s.defaultFrequency, nil
+	}
+	return freq, nil
+}
+
+// SetFrequency changes the user's digest frequency. Switching to
+// immediate sends whatever was waiting for the digest right away; other
+// changes apply from the next digest on.
+func (s *Service) SetFrequency(ctx context.Context, userID uint64, name string) (Frequency, error) {
+	freq, err := ParseFrequency(name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.SetFrequency(ctx, userID, freq); err != nil {
+		return "", fmt.Errorf("storing notification frequency: %w", err)
+	}
+	if freq == FrequencyImmediate {
+		if err := s.SendDigest(ctx, userID); err != nil {
+			return "", err
+		}
+	}
+	return freq, nil
+}
+
+// send emails one notification to the user, unless they no longer exist.
+func (s *Service) send(ctx context.Context, userID uint64, subject, body string) error {
+	email, err := s.emails(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("finding user email: %w", err)
+	}
+	if email == "" {
+		return nil
+	}
+	if err := s.mailer.Send(ctx, mail.Message{To: email, Subject: subject, Body: body}); err != nil {
+		return fmt.Errorf("sending notification: %w", err)
+	}
+	return nil
+}
+
+// digestMessage builds the summary of pending notifications.
+func digestMessage(to string, pending []Notification) mail.Message {
+	var body strings.Builder
+	body.WriteString("Here's what happened on your account:\n")
+	for _, n := range pending {
+		fmt.Fprintf(&body, "\n%s - %s\n\n%s", n.CreatedAt.UTC().Format("2006-01-02 15:04 UTC"), n.Subject, n.Body)
+	}
+	body.WriteString("\nYou get these summaries because of your notification settings.\n")
+
+	return mail.Message{
+		To:      to,
+		Subject: fmt.Sprintf("Your account activity: %d update(s)", len(pending)),
+		Body:    body.String(),
+	}
+}
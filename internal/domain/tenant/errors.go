@@ -0,0 +1,17 @@
+package tenant
+
+import "errors"
+
+// Sentinel errors for tenant policies.
+var (
+	// ErrInvalidTenantID is returned for a tenant ID that couldn't be an
+	// X-Tenant-ID value (see ValidTenantID).
+	ErrInvalidTenantID = errors.New("invalid tenant ID")
+
+	// ErrInvalidPolicy is returned, wrapped with the offending entry and
+	// the reason, for a policy that fails Validate.
+	ErrInvalidPolicy = errors.New("invalid tenant policy")
+
+	// ErrPolicyNotFound is returned for a tenant with no policy.
+	ErrPolicyNotFound = errors.New("tenant policy not found")
+)
@@ -0,0 +1,248 @@
+// Package tenant holds each tenant's security policy: the browser
+// origins allowed to call the API (CORS), the redirect URIs sign-in
+// flows may send users back to, and the URLs webhooks may be delivered
+// to.
+//
+// WHAT IS A TENANT?
+// An organization using the API, named by the X-Tenant-ID header the
+// gateway sets (see metrics.TenantHeader). Requests without one belong
+// to no tenant in particular.
+//
+// WHY PER TENANT, AND IN THE DATABASE?
+// Each of these lists is an allowlist of places outside the API that
+// the API trusts: an origin may read responses in a user's browser, a
+// redirect URI receives a user's tokens, a webhook URL receives events.
+// Each tenant has its own front ends and its own servers, and changes
+// them on its own schedule; a single environment variable for everyone
+// would mean a deploy per change, and every tenant trusting every other
+// tenant's sites. Admins edit them through /admin/tenants instead.
+package tenant
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Limits on a policy. Real lists are a handful of entries; the caps
+// keep a mistake (or a script gone wrong) from making every CORS check
+// walk thousands.
+const (
+	MaxEntries   = 50
+	MaxURLLength = 2048
+)
+
+// Wildcard in CORSOrigins allows every origin. Outside production only.
+const Wildcard = "*"
+
+// Policy is one tenant's allowlists.
+//
+// Entries are compared exactly, except wildcards: "*" as an origin, and
+// a host starting with "*." (https://*.preview.example.com), which
+// matches any subdomain of the rest. Wildcards are refused in production
+// (see Validate): a preview deployment on a shared host would otherwise
+// be as trusted as the real site.
+type Policy struct {
+	TenantID     string
+	CORSOrigins  []string // Origins, e.g. "https://app.example.com" (no path)
+	RedirectURIs []string // Absolute URLs, without a fragment
+	WebhookURLs  []string // Absolute URLs webhooks may be delivered to
+	UpdatedAt    time.Time
+}
+
+// tenantIDPattern is what an X-Tenant-ID value may look like.
+var tenantIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// ValidTenantID reports whether id can name a tenant: 1-64 letters,
+// digits, ".", "_", and "-", starting with a letter or digit.
+func ValidTenantID(id string) bool {
+	return tenantIDPattern.MatchString(id)
+}
+
+// Validate checks and normalizes the policy: entries are trimmed,
+// de-duplicated, and origins lowercased. strict, for production, refuses
+// wildcards and plain http, except to loopback addresses (a developer's
+// machine) for origins and redirect URIs. Webhooks are stricter still:
+// in production they must go to a public host (see checkWebhookHost).
+func (p *Policy) Validate(strict bool) error {
+	if !ValidTenantID(p.TenantID) {
+		return ErrInvalidTenantID
+	}
+	var err error
+	if p.CORSOrigins, err = normalize("cors_origins", p.CORSOrigins, strict, checkOrigin); err != nil {
+		return err
+	}
+	if p.RedirectURIs, err = normalize("redirect_uris", p.RedirectURIs, strict, checkRedirectURI); err != nil {
+		return err
+	}
+	if p.WebhookURLs, err = normalize("webhook_urls", p.WebhookURLs, strict, checkWebhookURL); err != nil {
+		return err
+	}
+	return nil
+}
+
+// normalize checks each entry of list with check, which returns its
+// normalized form, and drops duplicates.
+func normalize(field string, list []string, strict bool, check func(string, bool) (string, error)) ([]string, error) {
+	if len(list) > MaxEntries {
+		return nil, fmt.Errorf("%w: %s has %d entries, over %d", ErrInvalidPolicy, field, len(list), MaxEntries)
+	}
+	out := make([]string, 0, len(list))
+	for i, entry := range list {
+		entry = strings.TrimSpace(entry)
+		if len(entry) > MaxURLLength {
+			return nil, fmt.Errorf("%w: %s[%d] is over %d characters", ErrInvalidPolicy, field, i, MaxURLLength)
+		}
+		normalized, err := check(entry, strict)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s[%d] %q: %v", ErrInvalidPolicy, field, i, entry, err)
+		}
+		if !slices.Contains(out, normalized) {
+			out = append(out, normalized)
+		}
+	}
+	return out, nil
+}
+
+// checkOrigin accepts "*" or scheme://host[:port], as browsers send it
+// in the Origin header.
+func checkOrigin(origin string, strict bool) (string, error) {
+	if origin == Wildcard {
+		if strict {
+			return "", errWildcard
+		}
+		return origin, nil
+	}
+	u, err := checkURL(origin, strict, true)
+	if err != nil {
+		return "", err
+	}
+	// A trailing slash is forgiven: pasted from an address bar, it's
+	// still clearly an origin.
+	if (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.ForceQuery {
+		return "", errors.New("an origin is scheme://host[:port], with no path")
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// checkRedirectURI accepts an absolute http(s) URL without a fragment
+// (OAuth 2.0 forbids one: the authorization server appends its own).
+func checkRedirectURI(uri string, strict bool) (string, error) {
+	if _, err := checkURL(uri, strict, true); err != nil {
+		return "", err
+	}
+	return uri, nil
+}
+
+// checkWebhookURL accepts an absolute http(s) URL without a fragment;
+// in production only https, to a public host.
+func checkWebhookURL(raw string, strict bool) (string, error) {
+	u, err := checkURL(raw, strict, false)
+	if err != nil {
+		return "", err
+	}
+	if strict {
+		if err := checkWebhookHost(u.Hostname()); err != nil {
+			return "", err
+		}
+	}
+	return raw, nil
+}
+
+// errWildcard is the reason given for a wildcard in production.
+var errWildcard = errors.New("wildcards aren't allowed in production")
+
+// checkURL parses an absolute http(s) URL with a host and no user info
+// or fragment. A "*." host prefix is the only wildcard, outside strict
+// mode. In strict mode plain http is refused, except to loopback hosts
+// when loopbackHTTP is set.
+func checkURL(raw string, strict, loopbackHTTP bool) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.New("must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return nil, errors.New("must not contain user info")
+	}
+	if u.Fragment != "" || strings.Contains(raw, "#") {
+		return nil, errors.New("must not contain a fragment")
+	}
+	host := u.Hostname()
+	if strings.Contains(host, "*") {
+		if strict {
+			return nil, errWildcard
+		}
+		if !strings.HasPrefix(host, "*.") || strings.Contains(host[2:], "*") || !strings.Contains(host[2:], ".") {
+			return nil, errors.New("the only wildcard is a leading \"*.\" before a domain with a dot, e.g. *.example.com")
+		}
+	}
+	if strict && u.Scheme == "http" && !(loopbackHTTP && isLoopback(host)) {
+		return nil, errors.New("must use https in production")
+	}
+	return u, nil
+}
+
+// checkWebhookHost refuses hosts a webhook must never be delivered to
+// in production: localhost and private, loopback, and link-local IPs.
+//
+// WHY?
+// The API makes the request, from inside its own network. A webhook URL
+// of http://10.0.0.5/admin or http://169.254.169.254/ (the cloud
+// metadata service, which hands out credentials) would have it probe
+// its neighbors for whoever edited the policy: server-side request
+// forgery. A hostname can still resolve to such an address; whatever
+// delivers webhooks should check the address it connects to as well.
+func checkWebhookHost(host string) error {
+	if isLoopback(host) {
+		return errors.New("must not be a loopback host in production")
+	}
+	if ip := net.ParseIP(host); ip != nil &&
+		(ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() || ip.IsMulticast()) {
+		return errors.New("must not be a private or link-local address in production")
+	}
+	return nil
+}
+
+// isLoopback reports whether host is localhost or a loopback IP.
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Allows reports whether value matches an entry of list, exactly or by
+// wildcard (see Policy).
+func Allows(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == Wildcard || entry == value || matchesWildcard(entry, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesWildcard reports whether value matches pattern, a URL whose
+// host starts with "*.": the same URL, but on a subdomain (at any depth)
+// of the rest of the host.
+func matchesWildcard(pattern, value string) bool {
+	p, err := url.Parse(pattern)
+	if err != nil || !strings.HasPrefix(p.Hostname(), "*.") {
+		return false
+	}
+	v, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	suffix := strings.ToLower(p.Hostname()[1:]) // ".example.com"
+	host := strings.ToLower(v.Hostname())
+	return len(host) > len(suffix) && strings.HasSuffix(host, suffix) &&
+		p.Scheme == v.Scheme && p.Port() == v.Port() &&
+		p.EscapedPath() == v.EscapedPath() && p.RawQuery == v.RawQuery && v.User == nil
+}
@@ -0,0 +1,19 @@
+package tenant
+
+import "context"
+
+// Repository stores tenant policies.
+type Repository interface {
+	// Policies returns every tenant's policy, by tenant ID.
+	Policies(ctx context.Context) ([]Policy, error)
+
+	// Policy returns one tenant's policy, or ErrPolicyNotFound.
+	Policy(ctx context.Context, tenantID string) (*Policy, error)
+
+	// SavePolicy stores p, replacing the tenant's previous policy.
+	SavePolicy(ctx context.Context, p *Policy) error
+
+	// DeletePolicy removes the tenant's policy. Deleting a missing one
+	// isn't an error.
+	DeletePolicy(ctx context.Context, tenantID string) error
+}
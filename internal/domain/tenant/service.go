@@ -0,0 +1,179 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long the Service trusts its copy of the
+// policies when none is given.
+const DefaultCacheTTL = 30 * time.Second
+
+// retryAfter is how long a copy is kept when reloading it fails, before
+// the next attempt.
+const retryAfter = 5 * time.Second
+
+// Service manages tenant policies and answers whether a policy allows
+// an origin, a redirect URI, or a webhook URL.
+//
+// WHY CACHE EVERY POLICY AT ONCE?
+// The CORS check runs on every browser request, and its preflight (the
+// OPTIONS request a browser sends first) can't carry X-Tenant-ID: it
+// only names the headers the real request will send, not their values.
+// So an origin has to be looked up across all tenants, which no index
+// helps with once wildcards are involved. Policies are few and small,
+// so the Service keeps all of them in memory and reloads them after
+// ttl. A change through this instance drops its copy at once (see
+// SetPolicy); other instances see it within ttl.
+type Service struct {
+	repo   Repository
+	strict bool
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex // Held while reloading, so only one request does
+	snapshot *snapshot  // Guarded by mu
+}
+
+// snapshot is every policy, by tenant ID, as loaded at some moment.
+type snapshot struct {
+	policies map[string]*Policy
+	expires  time.Time
+}
+
+// NewService creates the tenant policy service. strict (production)
+// refuses wildcards and plain http in policies (see Policy.Validate).
+// Policies are cached for ttl, DefaultCacheTTL if zero.
+func NewService(repo Repository, strict bool, ttl time.Duration) *Service {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Service{repo: repo, strict: strict, ttl: ttl, now: time.Now}
+}
+
+// Policies returns every tenant's policy, read from the repository.
+func (s *Service) Policies(ctx context.Context) ([]Policy, error) {
+	policies, err := s.repo.Policies(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing tenant policies: %w", err)
+	}
+	return policies, nil
+}
+
+// Policy returns the tenant's policy, read from the repository, or
+// ErrPolicyNotFound.
+func (s *Service) Policy(ctx context.Context, tenantID string) (*Policy, error) {
+	if !ValidTenantID(tenantID) {
+		return nil, ErrInvalidTenantID
+	}
+	return s.repo.Policy(ctx, tenantID)
+}
+
+// SetPolicy validates p and makes it the tenant's policy, replacing the
+// previous one whole. It returns the policy as stored, normalized.
+func (s *Service) SetPolicy(ctx context.Context, p Policy) (*Policy, error) {
+	if err := p.Validate(s.strict); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = s.now().UTC().Truncate(time.Second)
+	if err := s.repo.SavePolicy(ctx, &p); err != nil {
+		return nil, fmt.Errorf("saving tenant policy: %w", err)
+	}
+	s.invalidate()
+	return &p, nil
+}
+
+// DeletePolicy removes the tenant's policy: nothing is allowed for it
+// any more.
+func (s *Service) DeletePolicy(ctx context.Context, tenantID string) error {
+	if !ValidTenantID(tenantID) {
+		return ErrInvalidTenantID
+	}
+	if err := s.repo.DeletePolicy(ctx, tenantID); err != nil {
+		return fmt.Errorf("deleting tenant policy: %w", err)
+	}
+	s.invalidate()
+	return nil
+}
+
+// AllowsOrigin reports whether the tenant's policy allows origin, the
+// Origin header of a browser request. With no tenant (a preflight, or a
+// request without X-Tenant-ID), any tenant's allowing it is enough.
+func (s *Service) AllowsOrigin(ctx context.Context, tenantID, origin string) (bool, error) {
+	return s.allows(ctx, tenantID, origin, func(p *Policy) []string { return p.CORSOrigins })
+}
+
+// AllowsRedirect reports whether the tenant's policy allows sending a
+// user's browser, with their tokens, to uri.
+func (s *Service) AllowsRedirect(ctx context.Context, tenantID, uri string) (bool, error) {
+	if tenantID == "" {
+		return false, nil // A redirect is always for a known tenant
+	}
+	return s.allows(ctx, tenantID, uri, func(p *Policy) []string { return p.RedirectURIs })
+}
+
+// AllowsWebhook reports whether the tenant's policy allows delivering
+// webhooks to url.
+func (s *Service) AllowsWebhook(ctx context.Context, tenantID, url string) (bool, error) {
+	if tenantID == "" {
+		return false, nil
+	}
+	return s.allows(ctx, tenantID, url, func(p *Policy) []string { return p.WebhookURLs })
+}
+
+// allows checks value against list of the tenant's policy, or of every
+// policy if tenantID is empty.
+func (s *Service) allows(ctx context.Context, tenantID, value string, list func(*Policy) []string) (bool, error) {
+	snap, err := s.current(ctx)
+	if err != nil {
+		return false, err
+	}
+	if tenantID != "" {
+		p, ok := snap.policies[tenantID]
+		return ok && Allows(list(p), value), nil
+	}
+	for _, p := range snap.policies {
+		if Allows(list(p), value) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// current returns the cached policies, reloading them if they expired.
+//
+// A failed reload keeps the old copy for retryAfter: a database blip
+// shouldn't turn away every browser, and the policies it would miss are
+// at most a few seconds newer. Only with no copy at all is it an error.
+func (s *Service) current(ctx context.Context) (*snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.snapshot != nil && now.Before(s.snapshot.expires) {
+		return s.snapshot, nil
+	}
+
+	policies, err := s.repo.Policies(ctx)
+	if err != nil {
+		if s.snapshot == nil {
+			return nil, fmt.Errorf("loading tenant policies: %w", err)
+		}
+		s.snapshot = &snapshot{policies: s.snapshot.policies, expires: now.Add(retryAfter)}
+		return s.snapshot, nil
+	}
+	snap := &snapshot{policies: make(map[string]*Policy, len(policies)), expires: now.Add(s.ttl)}
+	for i := range policies {
+		snap.policies[policies[i].TenantID] = &policies[i]
+	}
+	s.snapshot = snap
+	return snap, nil
+}
+
+// invalidate drops the cached policies, so the next check reloads them.
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	s.snapshot = nil
+	s.mu.Unlock()
+}
@@ -0,0 +1,55 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// Activity is when an account was last signed in to, and how far the
+// dormancy policy (see Dormancy) has gone with it. Zero times mean "not
+// yet".
+type Activity struct {
+	UserID      uint64
+	LastLoginAt time.Time // Last login, refresh, or registration
+	LastLoginIP string    // Address LastLoginAt was from; "" if unknown (e.g. registration)
+	WarnedAt    time.Time // When the dormancy warning was sent
+	DisabledAt  time.Time // When the account was disabled for dormancy
+	DeleteAfter time.Time // When the account will be deleted, if scheduled
+}
+
+// Disabled reports whether the account was disabled for dormancy.
+func (a *Activity) Disabled() bool {
+	return !a.DisabledAt.IsZero()
+}
+
+// ActivityRepository stores Activity, one row per account.
+//
+// WHY NOT A COLUMN ON users?
+// Activity lives in the main database (the directory when sharded), next
+// to sessions, so finding every dormant account is one indexed query
+// instead of one per shard. It's also written on every login and refresh,
+// which would otherwise bump users.updated_at for no profile change.
+type ActivityRepository interface {
+	// Touch records a login at at from ip ("" if unknown), creating the
+	// row if needed, and clears a pending warning and deletion: the
+	// account is in use again. It leaves DisabledAt alone; only
+	// Reactivate clears that.
+	Touch(ctx context.Context, userID uint64, at time.Time, ip string) error
+
+	// Find returns the user's activity, or nil if there's none recorded.
+	Find(ctx context.Context, userID uint64) (*Activity, error)
+
+	// Dormant returns up to limit accounts last signed in to before
+	// cutoff, with user IDs above afterID, in user ID order.
+	Dormant(ctx context.Context, cutoff time.Time, afterID uint64, limit int) ([]Activity, error)
+
+	// Save writes a's WarnedAt, DisabledAt, and DeleteAfter.
+	Save(ctx context.Context, a *Activity) error
+
+	// Reactivate clears everything the dormancy policy did and records a
+	// login at at, so the account's grace starts over.
+	Reactivate(ctx context.Context, userID uint64, at time.Time) error
+
+	// Delete removes the user's row. Deleting a missing row is a no-op.
+	Delete(ctx context.Context, userID uint64) error
+}
@@ -0,0 +1,237 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// AnonymizedPasswordHash replaces an anonymized account's password
+// hash. Like externalPasswordHash, it's in no known hash format, so no
+// password ever matches it.
+const AnonymizedPasswordHash = "!anonymized"
+
+// AnonymizedEmailDomain is the domain of the placeholder addresses that
+// replace anonymized users' emails. The .invalid top-level domain is
+// reserved (RFC 2606): mail to it can't be delivered anywhere.
+const AnonymizedEmailDomain = "anonymized.invalid"
+
+// AnonymizationRequest is a user's pending erasure: the account is
+// anonymized once AnonymizeAfter has passed, unless the request is
+// canceled first, or sooner if an admin confirms it.
+type AnonymizationRequest struct {
+	UserID         uint64
+	RequestedBy    uint64 // The user themselves, or the admin who asked for them
+	RequestedAt    time.Time
+	AnonymizeAfter time.Time // End of the grace period
+}
+
+// AnonymizationRepository stores anonymization requests, and erases the
+// personal data kept outside the users table.
+type AnonymizationRepository interface {
+	// CreateAnonymizationRequest stores req. It returns
+	// ErrAnonymizationPending if the user already has one.
+	CreateAnonymizationRequest(ctx context.Context, req *AnonymizationRequest) error
+
+	// AnonymizationRequest returns the user's pending request, or nil.
+	AnonymizationRequest(ctx context.Context, userID uint64) (*AnonymizationRequest, error)
+
+	// DeleteAnonymizationRequest removes the user's request and reports
+	// whether there was one.
+	DeleteAnonymizationRequest(ctx context.Context, userID uint64) (bool, error)
+
+	// PendingAnonymizations returns up to limit requests, soonest first:
+	// those due by dueBy, or all of them for a zero dueBy.
+	PendingAnonymizations(ctx context.Context, dueBy time.Time, limit int) ([]AnonymizationRequest, error)
+
+	// ErasePersonalData deletes everything about the user kept beside
+	// the users row (sessions, tokens, preferences, notifications,
+	// recovery codes, activity, sign-in countries) and their anonymization
+	// request.
+	ErasePersonalData(ctx context.Context, userID uint64) error
+}
+
+// Anonymization carries out the right to erasure: it replaces a user's
+// personal data with placeholders, after a grace period.
+//
+// WHY ANONYMIZE INSTEAD OF DELETING THE ROW?
+// Other records point at the user by ID: the audit trail ("user 42
+// assigned role admin to user 7"), role assignments, and whatever other
+// systems learned the ID through webhooks. Deleting the row would leave
+// them pointing at nothing, or let a new account reuse the ID. Scrubbing
+// the row instead keeps every reference valid while nothing left in it
+// identifies a person: the email becomes a placeholder, the password
+// and 2FA secret go, and the account is soft-deleted.
+//
+// WHY A GRACE PERIOD?
+// Erasure can't be undone, and a request may come from someone who only
+// has a stolen token. The grace period gives the owner (or support) time
+// to notice and cancel; an admin who has verified the request can
+// confirm it to anonymize at once.
+//
+// The audit trail isn't touched: it's append-only and hash-chained (see
+// package audit), and it names users only by ID.
+type Anonymization struct {
+	users   Repository
+	repo    AnonymizationRepository
+	grace   time.Duration
+	avatars *Avatars // nil: avatars aren't configured
+	audit   func(ctx context.Context, message string)
+	now     func() time.Time
+}
+
+// AnonymizationOption configures an Anonymization.
+type AnonymizationOption func(*Anonymization)
+
+// WithAvatarStore also deletes anonymized users' avatars from avatars'
+// blob store.
+func WithAvatarStore(avatars *Avatars) AnonymizationOption {
+	return func(a *Anonymization) {
+		a.avatars = avatars
+	}
+}
+
+// NewAnonymization creates the anonymization workflow. Requests wait
+// grace before they're carried out; audit is called for each account
+// anonymized.
+func NewAnonymization(users Repository, repo AnonymizationRepository, grace time.Duration, audit func(ctx context.Context, message string), opts ...AnonymizationOption) *Anonymization {
+	a := &Anonymization{users: users, repo: repo, grace: grace, audit: audit, now: time.Now}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Grace returns how long requests wait before they're carried out.
+func (a *Anonymization) Grace() time.Duration {
+	return a.grace
+}
+
+// Request schedules the user's anonymization, on behalf of requestedBy,
+// for when the grace period ends.
+func (a *Anonymization) Request(ctx context.Context, userID, requestedBy uint64) (*AnonymizationRequest, error) {
+	u, err := a.users.FindByID(ctx, userID, WithFields(FieldID))
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return nil, ErrNotFound
+	}
+
+	now := a.now().UTC().Truncate(time.Second)
+	req := &AnonymizationRequest{
+		UserID:         userID,
+		RequestedBy:    requestedBy,
+		RequestedAt:    now,
+		AnonymizeAfter: now.Add(a.grace),
+	}
+	if err := a.repo.CreateAnonymizationRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// Status returns the user's pending request, or
+// ErrNoAnonymizationRequest.
+func (a *Anonymization) Status(ctx context.Context, userID uint64) (*AnonymizationRequest, error) {
+	req, err := a.repo.AnonymizationRequest(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding anonymization request: %w", err)
+	}
+	if req == nil {
+		return nil, ErrNoAnonymizationRequest
+	}
+	return req, nil
+}
+
+// Cancel withdraws the user's pending request.
+func (a *Anonymization) Cancel(ctx context.Context, userID uint64) error {
+	ok, err := a.repo.DeleteAnonymizationRequest(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("deleting anonymization request: %w", err)
+	}
+	if !ok {
+		return ErrNoAnonymizationRequest
+	}
+	return nil
+}
+
+// Pending returns up to limit pending requests, soonest first.
+func (a *Anonymization) Pending(ctx context.Context, limit int) ([]AnonymizationRequest, error) {
+	reqs, err := a.repo.PendingAnonymizations(ctx, time.Time{}, limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing anonymization requests: %w", err)
+	}
+	return reqs, nil
+}
+
+// Due returns up to limit requests whose grace period has ended.
+func (a *Anonymization) Due(ctx context.Context, limit int) ([]AnonymizationRequest, error) {
+	reqs, err := a.repo.PendingAnonymizations(ctx, a.now().UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("listing due anonymization requests: %w", err)
+	}
+	return reqs, nil
+}
+
+// Confirm anonymizes the user now, without waiting for the grace period
+// to end. The user must have a pending request.
+func (a *Anonymization) Confirm(ctx context.Context, userID uint64) error {
+	if _, err := a.Status(ctx, userID); err != nil {
+		return err
+	}
+	return a.Anonymize(ctx, userID)
+}
+
+// Anonymize scrubs the user's personal data and removes their request.
+// It works on soft-deleted users too: deleting an account doesn't erase
+// it.
+//
+// Run it in a transaction (see txn), so the users row and the rest are
+// scrubbed together. The avatar is deleted from its store last, since
+// that can't be rolled back.
+func (a *Anonymization) Anonymize(ctx context.Context, userID uint64) error {
+	u, err := a.users.FindByID(ctx, userID, WithFields(FieldID, FieldEmail, FieldAvatarURL))
+	if err != nil {
+		return fmt.Errorf("finding user: %w", err)
+	}
+
+	email, err := anonymizedEmail(userID)
+	if err != nil {
+		return err
+	}
+	if err := a.users.Anonymize(ctx, userID, email); err != nil {
+		return fmt.Errorf("anonymizing user: %w", err)
+	}
+	if err := a.repo.ErasePersonalData(ctx, userID); err != nil {
+		return fmt.Errorf("erasing personal data: %w", err)
+	}
+	// A soft-deleted user isn't found, so their avatar can't be: it's
+	// left in the store, no longer linked from anywhere.
+	if u != nil && u.AvatarURL != "" && a.avatars != nil {
+		a.avatars.deleteStored(ctx, u.AvatarURL)
+	}
+
+	a.audit(ctx, fmt.Sprintf("anonymized user %d", userID))
+	return nil
+}
+
+// anonymizedEmail returns a placeholder address for the user: a hash of
+// the user ID and a random salt that's thrown away.
+//
+// WHY NOT A HASH OF THE EMAIL?
+// An unsalted hash can be reversed by hashing guesses: anyone with a
+// list of addresses could tell which one was erased. The random salt
+// leaves nothing to guess against; the ID only keeps placeholders
+// distinct, since emails are unique.
+func anonymizedEmail(userID uint64) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating placeholder email: %w", err)
+	}
+	sum := sha256.Sum256(append(salt, fmt.Sprintf(":%d", userID)...))
+	return "anonymized-" + hex.EncodeToString(sum[:12]) + "@" + AnonymizedEmailDomain, nil
+}
@@ -0,0 +1,208 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+
+	// Registered for image.Decode; GIFs are re-encoded as PNG.
+	_ "image/gif"
+
+	"go-basics/internal/blob"
+)
+
+// Avatar limits.
+const (
+	// DefaultAvatarSize is the side, in pixels, avatars are scaled down to.
+	DefaultAvatarSize = 256
+
+	// MaxAvatarPixels caps the width times height of an uploaded image.
+	//
+	// WHY COUNT PIXELS, WHEN THE UPLOAD SIZE IS CAPPED?
+	// Compressed size says little about decoded size: a PNG of 50,000 x
+	// 50,000 white pixels is a few hundred kilobytes and decodes to 10GB.
+	// The dimensions are in the header, so they're checked before
+	// anything is decoded.
+	MaxAvatarPixels = 40_000_000
+)
+
+// Avatars sets and removes users' profile pictures.
+//
+// An upload is decoded, cropped to the centered square, scaled down to
+// size x size, and encoded again before it's stored.
+//
+// WHY RE-ENCODE?
+// Besides making every avatar the same small size, re-encoding keeps
+// only the pixels. Photos from phones carry EXIF metadata, GPS position
+// included, that the uploader rarely means to publish. And a file that
+// is a valid image and something else at once (a "polyglot", e.g. an
+// image that is also HTML) doesn't survive being decoded and encoded,
+// so what's served from the public URL is only ever an image.
+type Avatars struct {
+	users Repository
+	store blob.Store
+	size  int
+}
+
+// NewAvatars creates the avatar flow, storing pictures of size x size
+// pixels (DefaultAvatarSize if size is zero) in store.
+func NewAvatars(users Repository, store blob.Store, size int) *Avatars {
+	if size <= 0 {
+		size = DefaultAvatarSize
+	}
+	return &Avatars{users: users, store: store, size: size}
+}
+
+// Set makes the image in data the user's avatar and returns the updated
+// user, whose AvatarURL is the new picture's public URL.
+//
+// The new picture is stored before the user points to it, and the old
+// one deleted only after, so the profile never shows a broken image.
+func (a *Avatars) Set(ctx context.Context, userID uint64, data []byte) (*User, error) {
+	u, err := a.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return nil, ErrNotFound
+	}
+
+	encoded, contentType, ext, err := processAvatar(data, a.size)
+	if err != nil {
+		return nil, err
+	}
+	// A new key for every picture: URLs can be cached forever (see
+	// blob.Store), and the user ID keeps each user's files together.
+	sum := sha256.Sum256(encoded)
+	key := fmt.Sprintf("%d-%x.%s", userID, sum[:8], ext)
+
+	url, err := a.store.Put(ctx, key, contentType, encoded)
+	if err != nil {
+		return nil, fmt.Errorf("storing avatar: %w", err)
+	}
+	old := u.AvatarURL
+	if old == url {
+		return u, nil // The same picture again
+	}
+	u.AvatarURL = url
+	if err := a.users.Update(ctx, u); err != nil {
+		a.store.Delete(ctx, key)
+		return nil, fmt.Errorf("updating user: %w", err)
+	}
+	a.deleteStored(ctx, old)
+	return u, nil
+}
+
+// Remove deletes the user's avatar, if they have one, and returns the
+// updated user.
+func (a *Avatars) Remove(ctx context.Context, userID uint64) (*User, error) {
+	u, err := a.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return nil, ErrNotFound
+	}
+	old := u.AvatarURL
+	if old == "" {
+		return u, nil
+	}
+	u.AvatarURL = ""
+	if err := a.users.Update(ctx, u); err != nil {
+		return nil, fmt.Errorf("updating user: %w", err)
+	}
+	a.deleteStored(ctx, old)
+	return u, nil
+}
+
+// deleteStored deletes the picture at url from the store, if it's there.
+//
+// A failure is ignored: the user already has their new avatar, and an
+// orphaned picture costs a few kilobytes. A URL from another store (one
+// configured before) is left alone.
+func (a *Avatars) deleteStored(ctx context.Context, url string) {
+	if key, ok := blob.KeyOf(a.store, url); ok {
+		a.store.Delete(ctx, key)
+	}
+}
+
+// processAvatar decodes data, crops it to the centered square, scales it
+// down to at most size x size, and encodes it again: JPEGs as JPEG,
+// anything else as PNG, which keeps transparency. An animated GIF keeps
+// its first frame.
+func processAvatar(data []byte, size int) (encoded []byte, contentType, ext string, err error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, "", "", ErrInvalidImage
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxAvatarPixels {
+		return nil, "", "", fmt.Errorf("%w: %dx%d is over %d", ErrImageTooLarge, cfg.Width, cfg.Height, MaxAvatarPixels)
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", "", ErrInvalidImage
+	}
+
+	dst := scaleSquare(src, size)
+	var buf bytes.Buffer
+	if format == "jpeg" {
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 85})
+		contentType, ext = "image/jpeg", "jpg"
+	} else {
+		err = png.Encode(&buf, dst)
+		contentType, ext = "image/png", "png"
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("encoding avatar: %w", err)
+	}
+	return buf.Bytes(), contentType, ext, nil
+}
+
+// scaleSquare crops src to its centered square and scales that down to
+// size x size, or leaves it at its size if it's smaller (scaling up only
+// adds blur).
+//
+// Each output pixel is the average of a grid of up to 4x4 samples from
+// the area of src it covers: far better than taking one pixel (which
+// turns fine detail into noise), and far cheaper than averaging all of
+// them, which for a 40-megapixel photo would be 40 million reads.
+func scaleSquare(src image.Image, size int) *image.RGBA {
+	b := src.Bounds()
+	side := min(b.Dx(), b.Dy())
+	x0 := b.Min.X + (b.Dx()-side)/2
+	y0 := b.Min.Y + (b.Dy()-side)/2
+	out := min(side, size)
+
+	// Samples per output pixel, per axis.
+	samples := min(max(side/out, 1), 4)
+
+	dst := image.NewRGBA(image.Rect(0, 0, out, out))
+	for y := range out {
+		for x := range out {
+			var r, g, bl, a, n uint64
+			for sy := range samples {
+				for sx := range samples {
+					// The centers of a samples x samples grid over the
+					// output pixel's area of the square.
+					px := x0 + ((2*x*samples+2*sx+1)*side)/(2*out*samples)
+					py := y0 + ((2*y*samples+2*sy+1)*side)/(2*out*samples)
+					cr, cg, cb, ca := src.At(px, py).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			// RGBA() is premultiplied 16-bit, as image.RGBA stores it (in 8).
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8), G: uint8(g / n >> 8), B: uint8(bl / n >> 8), A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
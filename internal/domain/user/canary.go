@@ -0,0 +1,84 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Canary manages the dedicated account used by synthetic monitoring.
+//
+// WHY A CANARY USER?
+// A health check that only pings the database proves the TCP connection
+// works. A canary proves the real path works: the same repository, hooks,
+// queries, and indexes a signup or profile read goes through. Because the
+// probe writes only to its own account, it never touches real user data.
+//
+// The canary can never log in: its password hash is in no known format
+// (see ErrUnsupportedHash), so no password matches it. Deleting it would
+// leave a soft-deleted row that blocks re-creation (emails are unique), so
+// it is created once and then touched on every probe instead.
+type Canary struct {
+	repo  Repository
+	roles RoleRepository
+	email string
+}
+
+// canaryPasswordHash is deliberately not a valid password hash.
+const canaryPasswordHash = "!canary"
+
+// NewCanary creates a canary for the account with the given email.
+func NewCanary(repo Repository, roles RoleRepository, email string) *Canary {
+	// Emails are stored lowercase (see NormalizeEmail), so compare that way.
+	return &Canary{repo: repo, roles: roles, email: strings.ToLower(email)}
+}
+
+// Touch creates the canary account if it's missing, or updates it
+// (bumping updated_at) if it exists. Either way it exercises a write.
+// It returns the canary's ID.
+func (c *Canary) Touch(ctx context.Context) (uint64, error) {
+	u, err := c.repo.FindByEmail(ctx, c.email)
+	if err != nil {
+		return 0, fmt.Errorf("finding canary: %w", err)
+	}
+
+	if u == nil {
+		u = &User{Email: c.email, PasswordHash: canaryPasswordHash}
+		if err := c.repo.Create(ctx, u); err != nil {
+			return 0, fmt.Errorf("creating canary: %w", err)
+		}
+		return u.ID, nil
+	}
+
+	if err := c.repo.Update(ctx, u); err != nil {
+		return 0, fmt.Errorf("touching canary: %w", err)
+	}
+	return u.ID, nil
+}
+
+// Read loads the canary by primary key, the path every profile read takes.
+func (c *Canary) Read(ctx context.Context, id uint64) error {
+	u, err := c.repo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("reading canary: %w", err)
+	}
+	if u == nil || u.Email != c.email {
+		return fmt.Errorf("reading canary: %w", ErrNotFound)
+	}
+	return nil
+}
+
+// Cleanup revokes any roles the canary has picked up (e.g. an operator
+// mistaking it for a real account), so the probe account stays powerless.
+func (c *Canary) Cleanup(ctx context.Context, id uint64) error {
+	roles, err := c.roles.RolesFor(ctx, id)
+	if err != nil {
+		return fmt.Errorf("listing canary roles: %w", err)
+	}
+	for _, role := range roles {
+		if err := c.roles.Revoke(ctx, id, role); err != nil {
+			return fmt.Errorf("revoking canary role %s: %w", role, err)
+		}
+	}
+	return nil
+}
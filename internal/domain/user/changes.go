@@ -0,0 +1,23 @@
+package user
+
+import (
+	"context"
+	"time"
+)
+
+// Change is a user row that was written: created, updated, deleted, or
+// anonymized, by this process or any other.
+type Change struct {
+	ID        uint64
+	Email     string    // The email after the write
+	UpdatedAt time.Time // When the row was written, by the database's clock
+}
+
+// ChangeFeed lists the users written since a point in time, whoever
+// wrote them, for caches that must forget a user as soon as it changes
+// (see package usercache).
+type ChangeFeed interface {
+	// ChangedSince returns the users written at or after since, oldest
+	// first. A user written several times is listed once.
+	ChangedSince(ctx context.Context, since time.Time) ([]Change, error)
+}
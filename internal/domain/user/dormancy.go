@@ -0,0 +1,379 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go-basics/internal/mail"
+)
+
+// DormancyAction is an automated step a DormancyPolicy may take against
+// a dormant account.
+type DormancyAction string
+
+// Dormancy actions, in the order they're taken.
+const (
+	// DormancyWarn emails the user to sign in before anything else happens.
+	DormancyWarn DormancyAction = "warn"
+
+	// DormancyDisable signs the account out everywhere and refuses logins
+	// until an admin reactivates it.
+	DormancyDisable DormancyAction = "disable"
+
+	// DormancyDelete schedules the account for deletion, and soft-deletes
+	// it once the grace period has passed.
+	DormancyDelete DormancyAction = "delete"
+)
+
+// DormancyActions lists every action, in order, for validating configuration.
+var DormancyActions = []DormancyAction{DormancyWarn, DormancyDisable, DormancyDelete}
+
+// ParseDormancyActions converts action names into actions. Unknown or
+// repeated names are an error.
+func ParseDormancyActions(names []string) ([]DormancyAction, error) {
+	var actions []DormancyAction
+	for _, name := range names {
+		action := DormancyAction(strings.TrimSpace(name))
+		if !slices.Contains(DormancyActions, action) {
+			return nil, fmt.Errorf("unknown dormancy action %q (want one of %v)", name, DormancyActions)
+		}
+		if slices.Contains(actions, action) {
+			return nil, fmt.Errorf("dormancy action %q listed twice", name)
+		}
+		actions = append(actions, action)
+	}
+	return actions, nil
+}
+
+// DormancyStep is what a run of the policy does (or, in a dry run, would
+// do) with one dormant account.
+type DormancyStep string
+
+// Dormancy steps.
+const (
+	StepNone             DormancyStep = "none"              // Reported only: no actions configured, or all taken
+	StepExempt           DormancyStep = "exempt"            // An admin or exempt account; never acted on
+	StepWait             DormancyStep = "wait"              // The grace period since the last action is running
+	StepWarn             DormancyStep = "warn"              // Send the warning email
+	StepDisable          DormancyStep = "disable"           // Disable the account
+	StepScheduleDeletion DormancyStep = "schedule_deletion" // Set the deletion date
+	StepDelete           DormancyStep = "delete"            // Soft-delete the account
+)
+
+// DormancyPolicy says when an account is dormant and what to do about it.
+type DormancyPolicy struct {
+	After   time.Duration    // No login for this long makes an account dormant
+	Actions []DormancyAction // Taken one per Grace, in DormancyActions order; none only reports
+	Grace   time.Duration    // Time between one action and the next
+	Exempt  []string         // Emails never acted on (e.g. the probe's canary)
+}
+
+// has reports whether the policy takes action.
+func (p DormancyPolicy) has(action DormancyAction) bool {
+	return slices.Contains(p.Actions, action)
+}
+
+// next returns the step due for a dormant account at now.
+//
+// WHY ONE STEP PER GRACE PERIOD?
+// Every step gives the user (or an admin) time to notice: the warning
+// comes a grace period before the account is disabled, and deletion is
+// scheduled a grace period after that and happens a grace period later
+// still. An account whose owner just forgot about it is never deleted
+// the day the policy first notices it.
+func (p DormancyPolicy) next(a Activity, now time.Time) DormancyStep {
+	if p.has(DormancyWarn) && a.WarnedAt.IsZero() {
+		return StepWarn
+	}
+	last := a.WarnedAt
+	if a.DisabledAt.After(last) {
+		last = a.DisabledAt
+	}
+	if !last.IsZero() && now.Before(last.Add(p.Grace)) {
+		return StepWait
+	}
+	if p.has(DormancyDisable) && a.DisabledAt.IsZero() {
+		return StepDisable
+	}
+	if p.has(DormancyDelete) {
+		switch {
+		case a.DeleteAfter.IsZero():
+			return StepScheduleDeletion
+		case now.Before(a.DeleteAfter):
+			return StepWait
+		default:
+			return StepDelete
+		}
+	}
+	return StepNone
+}
+
+// DormantAccount is one account in a DormancyReport.
+type DormantAccount struct {
+	Activity
+	Email string
+	Step  DormancyStep // Taken, or in a dry run, due
+	Error string       // Why the step failed, if it did
+}
+
+// DormancyReport is the result of a Dormancy run.
+type DormancyReport struct {
+	GeneratedAt time.Time
+	DryRun      bool
+	Cutoff      time.Time // Accounts last signed in to before this are dormant
+	Dormant     int
+	Steps       map[DormancyStep]int // Accounts per step
+	Failed      int                  // Steps that failed; retried next run
+	Accounts    []DormantAccount     // The first accounts, up to the run's limit
+	Truncated   bool                 // More accounts were dormant than listed
+}
+
+// dormancyBatch is how many dormant accounts one query returns.
+const dormancyBatch = 500
+
+// Dormancy finds accounts nobody has signed in to for a while and, if
+// its policy says so, warns, disables, and deletes them.
+//
+// WHY BOTHER?
+// An account nobody uses is all risk: a reused password from some other
+// site's breach still signs in to it, and nobody notices when someone
+// does. It's also personal data kept for no purpose, which privacy law
+// frowns on. Warning first gives owners who still want the account a
+// way to keep it: signing in resets everything.
+type Dormancy struct {
+	users    Repository
+	roles    RoleRepository
+	activity ActivityRepository
+	sessions SessionRepository // Revoked when disabling
+	mailer   mail.Mailer
+	policy   DormancyPolicy
+	audit    func(ctx context.Context, message string) // Records each action taken
+}
+
+// NewDormancy creates the dormancy report and policy runner. audit is
+// called with a description of every action taken.
+func NewDormancy(users Repository, roles RoleRepository, activity ActivityRepository, sessions SessionRepository, mailer mail.Mailer, policy DormancyPolicy, audit func(ctx context.Context, message string)) *Dormancy {
+	exempt := make([]string, len(policy.Exempt))
+	for i, email := range policy.Exempt {
+		exempt[i] = strings.ToLower(email)
+	}
+	policy.Exempt = exempt
+	return &Dormancy{users: users, roles: roles, activity: activity, sessions: sessions, mailer: mailer, policy: policy, audit: audit}
+}
+
+// Policy returns the policy runs follow.
+func (d *Dormancy) Policy() DormancyPolicy {
+	return d.policy
+}
+
+// Run checks every dormant account and takes the step the policy says
+// is due; with dryRun, it only reports what it would do. The report
+// lists up to limit accounts, and counts all of them.
+//
+// A failed step is reported and left for the next run; the rest still
+// run.
+func (d *Dormancy) Run(ctx context.Context, dryRun bool, limit int) (*DormancyReport, error) {
+	now := time.Now().UTC()
+	report := &DormancyReport{
+		GeneratedAt: now,
+		DryRun:      dryRun,
+		Cutoff:      now.Add(-d.policy.After),
+		Steps:       make(map[DormancyStep]int),
+	}
+
+	var after uint64
+	for {
+		batch, err := d.activity.Dormant(ctx, report.Cutoff, after, dormancyBatch)
+		if err != nil {
+			return nil, fmt.Errorf("finding dormant accounts: %w", err)
+		}
+		for _, a := range batch {
+			after = a.UserID
+			account, ok, err := d.check(ctx, a, now, dryRun)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			report.Dormant++
+			report.Steps[account.Step]++
+			if account.Error != "" {
+				report.Failed++
+			}
+			if len(report.Accounts) < limit {
+				report.Accounts = append(report.Accounts, account)
+			} else {
+				report.Truncated = true
+			}
+		}
+		if len(batch) < dormancyBatch {
+			return report, nil
+		}
+	}
+}
+
+// check works out (and unless dryRun, takes) the step due for one
+// account. ok is false for an account that no longer exists.
+func (d *Dormancy) check(ctx context.Context, a Activity, now time.Time, dryRun bool) (DormantAccount, bool, error) {
+	u, err := d.users.FindByID(ctx, a.UserID, WithFields(FieldID, FieldEmail))
+	if err != nil {
+		return DormantAccount{}, false, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		// Deleted some other way; its activity is left over.
+		if !dryRun {
+			if err := d.activity.Delete(ctx, a.UserID); err != nil {
+				return DormantAccount{}, false, fmt.Errorf("deleting activity: %w", err)
+			}
+		}
+		return DormantAccount{}, false, nil
+	}
+
+	account := DormantAccount{Activity: a, Email: u.Email, Step: d.policy.next(a, now)}
+	exempt, err := d.exempt(ctx, u)
+	if err != nil {
+		return DormantAccount{}, false, err
+	}
+	if exempt {
+		account.Step = StepExempt
+	}
+	if !dryRun {
+		if err := d.take(ctx, &account, now); err != nil {
+			account.Error = err.Error()
+		}
+	}
+	return account, true, nil
+}
+
+// exempt reports whether u is never acted on: admins (disabling the last
+// one would lock everyone out of the admin API) and the policy's list.
+func (d *Dormancy) exempt(ctx context.Context, u *User) (bool, error) {
+	if slices.Contains(d.policy.Exempt, u.Email) {
+		return true, nil
+	}
+	roles, err := d.roles.RolesFor(ctx, u.ID)
+	if err != nil {
+		return false, fmt.Errorf("loading roles: %w", err)
+	}
+	return slices.Contains(roles, RoleAdmin), nil
+}
+
+// take runs account's step and records it on its activity.
+func (d *Dormancy) take(ctx context.Context, account *DormantAccount, now time.Time) error {
+	a := &account.Activity
+	id := a.UserID
+	switch account.Step {
+	case StepWarn:
+		// Email first: if saving fails, the next run warns again rather
+		// than believing a warning went out that didn't.
+		if err := d.mailer.Send(ctx, d.warning(account.Email, a.LastLoginAt, now.Add(d.policy.Grace))); err != nil {
+			return fmt.Errorf("sending warning: %w", err)
+		}
+		a.WarnedAt = now
+		if err := d.activity.Save(ctx, a); err != nil {
+			return fmt.Errorf("saving activity: %w", err)
+		}
+		d.audit(ctx, fmt.Sprintf("warned dormant user %d (last login %s)", id, a.LastLoginAt.Format(time.DateOnly)))
+
+	case StepDisable:
+		a.DisabledAt = now
+		if err := d.activity.Save(ctx, a); err != nil {
+			return fmt.Errorf("saving activity: %w", err)
+		}
+		// Signed-in devices would otherwise keep the account in use.
+		if err := d.sessions.DeleteForUser(ctx, id); err != nil {
+			return fmt.Errorf("revoking sessions: %w", err)
+		}
+		u, err := d.users.FindByID(ctx, id)
+		if err != nil {
+			return fmt.Errorf("finding user: %w", err)
+		}
+		if u != nil {
+			u.RevokeTokens()
+			if err := d.users.Update(ctx, u); err != nil {
+				return fmt.Errorf("revoking tokens: %w", err)
+			}
+		}
+		d.audit(ctx, fmt.Sprintf("disabled dormant user %d (last login %s)", id, a.LastLoginAt.Format(time.DateOnly)))
+
+	case StepScheduleDeletion:
+		a.DeleteAfter = now.Add(d.policy.Grace)
+		if err := d.activity.Save(ctx, a); err != nil {
+			return fmt.Errorf("saving activity: %w", err)
+		}
+		d.audit(ctx, fmt.Sprintf("scheduled dormant user %d for deletion on %s", id, a.DeleteAfter.Format(time.DateOnly)))
+		if err := d.mailer.Send(ctx, d.deletionNotice(account.Email, a)); err != nil {
+			// The schedule stands (the warning, if any, already went out);
+			// the failure is reported so someone can tell the user.
+			return fmt.Errorf("scheduled, but sending the notice failed: %w", err)
+		}
+
+	case StepDelete:
+		if err := d.users.Delete(ctx, id); err != nil {
+			return fmt.Errorf("deleting user: %w", err)
+		}
+		if err := d.activity.Delete(ctx, id); err != nil {
+			return fmt.Errorf("deleting activity: %w", err)
+		}
+		d.audit(ctx, fmt.Sprintf("deleted dormant user %d (last login %s)", id, a.LastLoginAt.Format(time.DateOnly)))
+	}
+	return nil
+}
+
+// Reactivate undoes what the policy did to an account (disabled, warned,
+// or scheduled for deletion) and restarts its clock, as if the user had
+// just signed in. Returns ErrNotFound for an unknown user.
+func (d *Dormancy) Reactivate(ctx context.Context, userID uint64) error {
+	u, err := d.users.FindByID(ctx, userID, WithFields(FieldID))
+	if err != nil {
+		return fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return ErrNotFound
+	}
+	if err := d.activity.Reactivate(ctx, userID, time.Now().UTC()); err != nil {
+		return fmt.Errorf("reactivating: %w", err)
+	}
+	return nil
+}
+
+// warning is the email sent for StepWarn. It says what comes next, so
+// the user knows what signing in avoids.
+func (d *Dormancy) warning(to string, lastLogin, deadline time.Time) mail.Message {
+	var next string
+	switch {
+	case d.policy.has(DormancyDisable):
+		next = "it will be disabled"
+	case d.policy.has(DormancyDelete):
+		next = "it will be scheduled for deletion"
+	default:
+		next = "we'll remind you again"
+	}
+	return mail.Message{
+		To:      to,
+		Subject: "Your account hasn't been used in a while",
+		Body: fmt.Sprintf("Nobody has signed in to this account since %s.\n\n"+
+			"If you'd like to keep it, sign in before %s. Otherwise %s.\n\n"+
+			"If you no longer need it, you don't have to do anything.\n",
+			lastLogin.Format(time.DateOnly), deadline.Format(time.DateOnly), next),
+	}
+}
+
+// deletionNotice is the email sent for StepScheduleDeletion.
+func (d *Dormancy) deletionNotice(to string, a *Activity) mail.Message {
+	keep := "sign in before then"
+	if a.Disabled() {
+		keep = "contact support before then"
+	}
+	return mail.Message{
+		To:      to,
+		Subject: "Your account will be deleted",
+		Body: fmt.Sprintf("Nobody has signed in to this account since %s, so it will be deleted on %s.\n\n"+
+			"To keep it, %s.\n",
+			a.LastLoginAt.Format(time.DateOnly), a.DeleteAfter.Format(time.DateOnly), keep),
+	}
+}
@@ -0,0 +1,49 @@
+package user
+
+import "strings"
+
+// EmailNormalizer turns an email into the one form it's stored, compared,
+// and looked up in: trimmed and lowercased, and with FoldGmail, Gmail
+// addresses folded too.
+//
+// WHY NORMALIZE BEFORE LOOKUP TOO?
+// The unique key on users.email compares the stored strings. If
+// "Ann@Example.com" were stored as sent, "ann@example.com" could
+// register again, and couldn't sign in to the first account. Storing
+// one form only helps if every lookup asks for that same form, so every
+// email that reaches the repository goes through Normalize first.
+//
+// GMAIL FOLDING:
+// Gmail ignores dots in the local part and delivers "ann+news@gmail.com"
+// to "ann@gmail.com", so "a.n.n+1@googlemail.com" and "ann@gmail.com"
+// are one inbox. Folded, they're one account: a second signup with the
+// same inbox gets ErrEmailExists, the way it would without the tricks.
+// It's off by default, because the folded address is what's stored
+// (mail still arrives, but the user sees "ann@gmail.com"), and because
+// accounts created before it was turned on keep their unfolded address,
+// which lookups no longer find until it's rewritten.
+type EmailNormalizer struct {
+	FoldGmail bool
+}
+
+// gmailDomains are the domains Gmail folding applies to. Both deliver
+// to the same inboxes; googlemail.com folds to gmail.com.
+var gmailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true}
+
+// Normalize returns email's normalized form. It doesn't validate: an
+// address that isn't one comes back as some other string that isn't one.
+func (n EmailNormalizer) Normalize(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !n.FoldGmail {
+		return email
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 || !gmailDomains[email[at+1:]] {
+		return email
+	}
+	local := email[:at]
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	return strings.ReplaceAll(local, ".", "") + "@gmail.com"
+}
@@ -0,0 +1,193 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-basics/internal/mail"
+)
+
+// EmailChangeTokenRepository stores email change tokens. The contract is
+// ResetTokenRepository's, except that Consume returns
+// ErrInvalidEmailChangeToken.
+type EmailChangeTokenRepository ResetTokenRepository
+
+// EmailChange implements changing the email address of an account:
+//
+//  1. Request: the signed-in user submits the new address and their
+//     current password. The address is stored as pending, and a link with
+//     a single-use token is emailed to it.
+//  2. Confirm: the link's token moves the pending address into place.
+//
+// WHY NOT JUST UPDATE THE EMAIL?
+// The email is how an account is recovered. Whoever controls it can
+// reset the password. If a stolen access token were enough to change it,
+// a few minutes with the token would mean the account for good. So the
+// change needs the password (which the thief of a token doesn't have),
+// and only happens once the new inbox proves it's reachable. The old
+// address is told about the request, so the owner notices one they
+// didn't make.
+type EmailChange struct {
+	users      Repository
+	tokens     EmailChangeTokenRepository
+	mailer     mail.Mailer
+	hasher     PasswordHasher
+	confirmURL string          // Link sent to the new address; the token is appended as ?token=
+	ttl        time.Duration   // How long a token stays valid
+	emails     EmailNormalizer // The Service's, so the new address is stored like a signup's
+}
+
+// NewEmailChange creates the email change flow.
+func NewEmailChange(users Repository, tokens EmailChangeTokenRepository, mailer mail.Mailer, hasher PasswordHasher, confirmURL string, ttl time.Duration, emails EmailNormalizer) *EmailChange {
+	return &EmailChange{
+		users:      users,
+		tokens:     tokens,
+		mailer:     mailer,
+		hasher:     hasher,
+		confirmURL: confirmURL,
+		ttl:        ttl,
+		emails:     emails,
+	}
+}
+
+// Request records newEmail as the user's pending address and emails a
+// confirmation link to it. A new request replaces any earlier one: its
+// links stop working.
+func (c *EmailChange) Request(ctx context.Context, userID uint64, currentPassword, newEmail string) error {
+	newEmail = c.emails.Normalize(newEmail)
+	if err := validateEmail(newEmail); err != nil {
+		return err
+	}
+
+	u, err := c.users.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return ErrNotFound
+	}
+	ok, err := c.hasher.Verify(ctx, u.PasswordHash, currentPassword)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("verifying password: %w", err)
+	}
+	if err != nil || !ok {
+		return ErrIncorrectPassword
+	}
+	if newEmail == u.Email {
+		return ErrEmailUnchanged
+	}
+	if err := c.checkAvailable(ctx, newEmail, userID); err != nil {
+		return err
+	}
+
+	u.PendingEmail = newEmail
+	if err := c.users.Update(ctx, u); err != nil {
+		return fmt.Errorf("storing pending email: %w", err)
+	}
+	if err := c.tokens.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("deleting old email change tokens: %w", err)
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return fmt.Errorf("generating email change token: %w", err)
+	}
+	if err := c.tokens.Create(ctx, userID, hashSecretToken(token), time.Now().Add(c.ttl)); err != nil {
+		return fmt.Errorf("storing email change token: %w", err)
+	}
+
+	confirm, err := c.confirmMessage(newEmail, token)
+	if err != nil {
+		return err
+	}
+	if err := c.mailer.Send(ctx, confirm); err != nil {
+		return fmt.Errorf("sending confirmation email: %w", err)
+	}
+	if err := c.mailer.Send(ctx, c.noticeMessage(u.Email, newEmail)); err != nil {
+		return fmt.Errorf("sending notice to current email: %w", err)
+	}
+	return nil
+}
+
+// confirmMessage builds the email to the new address, with the link for
+// token. Like PasswordReset.message, EmailPreviews renders it too.
+func (c *EmailChange) confirmMessage(newEmail, token string) (mail.Message, error) {
+	link, err := url.Parse(c.confirmURL)
+	if err != nil {
+		return mail.Message{}, fmt.Errorf("parsing confirm URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mail.Message{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Someone asked to use this address for their account.\n\n"+
+			"To confirm, open this link within %s:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email; nothing will change.\n",
+			c.ttl, link),
+	}, nil
+}
+
+// noticeMessage builds the warning to the current address.
+func (c *EmailChange) noticeMessage(to, newEmail string) mail.Message {
+	return mail.Message{
+		To:      to,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Someone asked to change this account's email address to %s.\n\n"+
+			"It won't change until the new address is confirmed. If it wasn't you, "+
+			"change your password now: whoever did this knows it.\n", newEmail),
+	}
+}
+
+// Confirm moves the pending address into place using a token from Request.
+// Returns ErrInvalidEmailChangeToken if the token is unknown, expired,
+// used, or superseded, and ErrEmailExists if another account took the
+// address in the meantime.
+func (c *EmailChange) Confirm(ctx context.Context, token string) (*User, error) {
+	userID, err := c.tokens.Consume(ctx, hashSecretToken(token))
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := c.users.FindByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil || u.PendingEmail == "" {
+		// The account was deleted, or the change was already applied.
+		return nil, ErrInvalidEmailChangeToken
+	}
+	// The address was free at Request time, but pending addresses aren't
+	// reserved: someone may have registered it since. (One who registers
+	// it between this check and Update is caught by the unique key, and
+	// Update returns ErrEmailExists too.)
+	if err := c.checkAvailable(ctx, u.PendingEmail, userID); err != nil {
+		return nil, err
+	}
+
+	// Following the link proved the inbox is theirs.
+	u.Email, u.PendingEmail, u.EmailVerified = u.PendingEmail, "", true
+	if err := c.users.Update(ctx, u); err != nil {
+		return nil, fmt.Errorf("updating email: %w", err)
+	}
+	if err := c.tokens.DeleteForUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("deleting email change tokens: %w", err)
+	}
+	return u, nil
+}
+
+// checkAvailable returns ErrEmailExists if another account uses email.
+func (c *EmailChange) checkAvailable(ctx context.Context, email string, userID uint64) error {
+	existing, err := c.users.FindByEmail(ctx, email, WithFields(FieldID))
+	if err != nil {
+		return fmt.Errorf("checking email: %w", err)
+	}
+	if existing != nil && existing.ID != userID {
+		return ErrEmailExists
+	}
+	return nil
+}
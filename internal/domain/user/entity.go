@@ -1,12 +1,137 @@
 package user
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// User is a registered account.
+//
+// TIMESTAMPS:
+// CreatedAt and UpdatedAt are always set, so they're plain time.Time values.
+// The deletion time is optional (NULL in the database), so it's kept private
+// behind accessors. That way the domain never sees database types like
+// sql.NullTime - the repository converts them when scanning.
 type User struct {
 	ID           uint64
 	Email        string
 	PasswordHash string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
-	DeletedAt    *time.Time
+
+	// ULID is a second, public identifier: unique, sortable by creation
+	// time, and not guessable from the next account's, unlike ID. It's
+	// assigned before Create by the AssignULID hook and never changed.
+	// Empty for accounts created before the column existed.
+	ULID string
+
+	// Username is an optional handle to sign in with instead of the
+	// email, unique and stored normalized (see NormalizeUsername). Empty
+	// without one. Like Active, it's written by Create and
+	// Repository.Patch, never by Update.
+	Username string
+
+	// TokenVersion is copied into every access token issued to the user.
+	// Raising it (see RevokeTokens) invalidates every token issued before.
+	TokenVersion uint64
+
+	// PendingEmail is the address the user asked to change to, until
+	// they confirm it from that inbox (see EmailChange). Empty otherwise.
+	PendingEmail string
+
+	// EmailVerified is true once the user proved Email is theirs: by
+	// confirming it from that inbox (EmailChange), or by signing up
+	// through SSO, whose identity provider vouches for it. It never goes
+	// back to false.
+	EmailVerified bool
+
+	// AvatarURL is the public URL of the user's profile picture, empty
+	// without one. See Avatars.
+	AvatarURL string
+
+	// Active is false while an admin has the account deactivated (see
+	// Service.Deactivate): it can't sign in, and its tokens are refused.
+	// Unlike a deletion, nothing is hidden or lost, and Activate undoes
+	// it. It's only written by Repository.SetActive, never by Update.
+	Active bool
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	// deletedAt is nil for active users. Use DeletedAt / MarkDeleted.
+	deletedAt *time.Time
+
+	// MFASecret is the base32 TOTP secret; empty if the user never enrolled.
+	// The repository encrypts it at rest.
+	MFASecret string
+
+	// MFAEnabled is true once the user confirmed enrollment with a valid code.
+	// Until then, login doesn't ask for a code.
+	MFAEnabled bool
+
+	// Roles is only populated by operations that need it (e.g. Authenticate).
+	// It is stored in the user_roles table, not the users table.
+	Roles []Role
+}
+
+// DeletedAt returns when the user was soft-deleted.
+// ok is false if the user is active.
+func (u *User) DeletedAt() (t time.Time, ok bool) {
+	if u.deletedAt == nil {
+		return time.Time{}, false
+	}
+	return *u.deletedAt, true
+}
+
+// IsDeleted reports whether the user has been soft-deleted.
+func (u *User) IsDeleted() bool {
+	return u.deletedAt != nil
+}
+
+// RevokeTokens invalidates every access token issued to the user so
+// far, once the user is saved. Tokens carry the version they were issued
+// at, and the token validator rejects any older than the user's.
+func (u *User) RevokeTokens() {
+	u.TokenVersion++
+}
+
+// MarkDeleted records the soft-deletion time.
+// A zero time clears it, marking the user active again.
+func (u *User) MarkDeleted(at time.Time) {
+	if at.IsZero() {
+		u.deletedAt = nil
+		return
+	}
+	at = at.UTC()
+	u.deletedAt = &at
+}
+
+// userJSON is the JSON shape of a User.
+//
+// JSON RULES:
+//   - PasswordHash and MFASecret are NEVER marshaled, even by accident
+//     (e.g. in a log line).
+//   - Timestamps are RFC 3339 in UTC.
+//   - deleted_at is omitted for active users rather than sent as null.
+//   - roles is omitted when it wasn't loaded.
+//
+// API responses still use their own DTOs; this is a safe default for
+// anything else that encodes a User.
+type userJSON struct {
+	ID        uint64     `json:"id"`
+	Email     string     `json:"email"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Roles     []Role     `json:"roles,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (u User) MarshalJSON() ([]byte, error) {
+	return json.Marshal(userJSON{
+		ID:        u.ID,
+		Email:     u.Email,
+		CreatedAt: u.CreatedAt.UTC(),
+		UpdatedAt: u.UpdatedAt.UTC(),
+		DeletedAt: u.deletedAt,
+		Roles:     u.Roles,
+	})
 }
@@ -35,6 +35,17 @@ var (
 	// ErrInvalidEmail is returned when the email format is invalid.
 	ErrInvalidEmail = errors.New("invalid email format")
 
+	// ErrInvalidUsername is returned for a username of the wrong length
+	// or with characters usernames can't have (see usernameRegex).
+	ErrInvalidUsername = errors.New("username must be 3 to 30 letters, digits, underscores, or dots, starting with a letter")
+
+	// ErrUsernameReserved is returned for a username nobody can take,
+	// like "admin" or "support".
+	ErrUsernameReserved = errors.New("username is reserved")
+
+	// ErrUsernameTaken is returned for a username another user has.
+	ErrUsernameTaken = errors.New("username is taken")
+
 	// ErrPasswordTooShort is returned when the password doesn't meet
 	// minimum length requirements.
 	ErrPasswordTooShort = errors.New("password must be at least 8 characters")
@@ -42,6 +53,108 @@ var (
 	// ErrPasswordTooLong is returned when the password exceeds bcrypt's limit.
 	// bcrypt truncates passwords longer than 72 bytes, so we reject them.
 	ErrPasswordTooLong = errors.New("password must be at most 72 characters")
+
+	// ErrInvalidResetToken is returned when a password reset token is
+	// unknown, expired, or already used. We don't say which, for the same
+	// reason as ErrInvalidCredentials.
+	ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+	// ErrMFARequired is returned by Authenticate when the password is
+	// correct but the account has two-factor authentication enabled and
+	// no code was given. The client should ask for a code and retry.
+	ErrMFARequired = errors.New("two-factor code required")
+
+	// ErrInvalidMFACode is returned when a two-factor code is wrong or expired.
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+
+	// ErrMFAAlreadyEnabled is returned when enrolling an account that
+	// already has two-factor authentication turned on.
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+
+	// ErrMFANotEnrolled is returned when confirming or disabling two-factor
+	// authentication on an account that hasn't started enrollment.
+	ErrMFANotEnrolled = errors.New("two-factor authentication is not set up")
+
+	// ErrInvalidRecoveryCode is returned when a 2FA recovery code is
+	// wrong or was already used.
+	ErrInvalidRecoveryCode = errors.New("invalid or already used recovery code")
+
+	// ErrMFAResetNotAllowed is returned when resetting two-factor
+	// authentication with the password before a recovery code was used
+	// (see MFA.ResetAfterRecovery).
+	ErrMFAResetNotAllowed = errors.New("two-factor authentication can only be reset this way after signing in with a recovery code")
+
+	// ErrInvalidRefreshToken is returned when a refresh token is unknown,
+	// expired, revoked, or belongs to a deleted account.
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+	// ErrSessionNotFound is returned when revoking a session that doesn't
+	// exist or belongs to another user.
+	ErrSessionNotFound = errors.New("session not found")
+
+	// ErrIncorrectPassword is returned by ChangePassword when the current
+	// password is wrong. Unlike at login, the caller is already signed in
+	// and knows the account, so there's nothing to hide by being vague.
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+
+	// ErrInvalidEmailChangeToken is returned when an email change token
+	// is unknown, expired, already used, or was replaced by a newer request.
+	ErrInvalidEmailChangeToken = errors.New("invalid or expired email change token")
+
+	// ErrEmailUnchanged is returned when asking to change the email to
+	// the address the account already has.
+	ErrEmailUnchanged = errors.New("new email is the same as the current one")
+
+	// ErrUnknownEmailTemplate is returned when previewing an email that
+	// isn't in EmailTemplates.
+	ErrUnknownEmailTemplate = errors.New("unknown email template")
+
+	// ErrNoLinkedAccount is returned when an identity provider vouches
+	// for an email that has no account here, and accounts aren't created
+	// on first sign-in, or whose account is an invitation not yet accepted.
+	ErrNoLinkedAccount = errors.New("no account for this identity")
+
+	// ErrAnonymizationPending is returned when requesting the
+	// anonymization of a user who already has a request pending.
+	ErrAnonymizationPending = errors.New("anonymization already requested")
+
+	// ErrNoAnonymizationRequest is returned when checking, canceling, or
+	// confirming the anonymization of a user who has no request pending.
+	ErrNoAnonymizationRequest = errors.New("no anonymization request pending")
+
+	// ErrAccountDisabled is returned when signing in to an account the
+	// dormancy policy disabled (see Dormancy). Only an admin can
+	// reactivate it.
+	ErrAccountDisabled = errors.New("account is disabled for inactivity; contact support to reactivate it")
+
+	// ErrAccountDeactivated is returned when signing in to, refreshing a
+	// session of, or using a token of an account an admin deactivated.
+	ErrAccountDeactivated = errors.New("account is deactivated; contact support to activate it")
+
+	// ErrDeactivateSelf is returned when an admin tries to deactivate
+	// their own account, which would leave nobody to activate it again.
+	ErrDeactivateSelf = errors.New("admins can't deactivate their own account")
+
+	// ErrInvalidImage is returned for an avatar that isn't a JPEG, PNG,
+	// or GIF, or is corrupt.
+	ErrInvalidImage = errors.New("avatar must be a JPEG, PNG, or GIF image")
+
+	// ErrImageTooLarge is returned for an avatar with more pixels than
+	// MaxAvatarPixels.
+	ErrImageTooLarge = errors.New("avatar image has too many pixels")
+
+	// ErrInvalidInvitation is returned when accepting an invitation whose
+	// token is unknown or expired, or that was accepted or revoked. Like
+	// ErrInvalidResetToken, it doesn't say which.
+	ErrInvalidInvitation = errors.New("invalid or expired invitation")
+
+	// ErrInvitationNotFound is returned when resending or revoking an
+	// invitation that doesn't exist.
+	ErrInvitationNotFound = errors.New("invitation not found")
+
+	// ErrInvitationClosed is returned when resending or revoking an
+	// invitation that was already accepted or revoked.
+	ErrInvitationClosed = errors.New("invitation was already accepted or revoked")
 )
 
 // ValidationError represents a validation error with field-specific information.
@@ -49,9 +162,10 @@ var (
 //
 // Example usage:
 //
-//	return &ValidationError{Field: "email", Message: "invalid format"}
+//	return &ValidationError{Field: "email", Code: "email.invalid_format", Message: "invalid format"}
 type ValidationError struct {
 	Field   string // The field that failed validation
+	Code    string // Stable machine-readable code, "<field>.<problem>"
 	Message string // Human-readable error message
 }
 
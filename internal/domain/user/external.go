@@ -0,0 +1,63 @@
+package user
+
+import (
+	"context"
+	"fmt"
+)
+
+// externalPasswordHash marks accounts created by single sign-on. Like the
+// canary's, it's in no known hash format, so no password matches it until
+// the user sets one through a password reset.
+const externalPasswordHash = "!sso"
+
+// AuthenticateExternal signs in the user with email, which an external
+// identity provider (SAML SSO) has already verified. With provision, a
+// first sign-in creates the account, with the default role; without, it
+// returns ErrNoLinkedAccount. So does an invited account that hasn't
+// accepted its invitation: like PasswordReset, SSO mustn't become a way
+// in that revoking the invitation doesn't close.
+//
+// The user's roles are loaded, as by Authenticate.
+//
+// WHY NO PASSWORD OR MFA CHECK?
+// The identity provider did the authenticating, under its own policy
+// (including its own second factor). Asking again here would mean a
+// second password for the same person, which is what SSO exists to
+// avoid. The trust this takes is real: the IdP can sign in any address
+// it asserts, so limit it to your own domains (SAML_ALLOWED_DOMAINS).
+func (s *Service) AuthenticateExternal(ctx context.Context, email string, provision bool) (*User, error) {
+	email = s.emails.Normalize(email)
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.FindByEmail(ctx, email, WithFields(FieldID, FieldEmail, FieldEmailVerified, FieldActive, FieldPasswordHash, FieldTokenVersion))
+	if err != nil {
+		return nil, fmt.Errorf("finding user by email: %w", err)
+	}
+	if user != nil && user.PasswordHash == InvitedPasswordHash {
+		return nil, ErrNoLinkedAccount
+	}
+	if user == nil {
+		if !provision {
+			return nil, ErrNoLinkedAccount
+		}
+		// The IdP only asserts addresses it has verified.
+		user = &User{Email: email, PasswordHash: externalPasswordHash, EmailVerified: true}
+		if err := s.repo.Create(ctx, user); err != nil {
+			return nil, fmt.Errorf("creating user: %w", err)
+		}
+		if err := s.roles.Assign(ctx, user.ID, RoleUser); err != nil {
+			return nil, fmt.Errorf("assigning default role: %w", err)
+		}
+	}
+	if !user.Active {
+		return nil, ErrAccountDeactivated
+	}
+
+	user.Roles, err = s.roles.RolesFor(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("loading roles: %w", err)
+	}
+	return user, nil
+}
@@ -0,0 +1,66 @@
+package user
+
+// Field names a User attribute that a repository can load.
+//
+// WHY PROJECTION?
+// SELECT * (or selecting every column) reads more data than most callers need.
+// Login only needs the ID, email, and password hash. Loading fewer columns:
+// 1. Makes rows smaller (less network and memory)
+// 2. Lets MySQL answer from a covering index without touching the table
+type Field string
+
+// Fields that can be requested with WithFields.
+const (
+	FieldID            Field = "id"
+	FieldULID          Field = "ulid"
+	FieldEmail         Field = "email"
+	FieldUsername      Field = "username"
+	FieldPendingEmail  Field = "pending_email"
+	FieldEmailVerified Field = "email_verified_at"
+	FieldAvatarURL     Field = "avatar_url"
+	FieldActive        Field = "is_active"
+	FieldPasswordHash  Field = "password_hash"
+	FieldTokenVersion  Field = "token_version"
+	FieldCreatedAt     Field = "created_at"
+	FieldUpdatedAt     Field = "updated_at"
+	FieldDeletedAt     Field = "deleted_at"
+	FieldMFASecret     Field = "mfa_secret"
+	FieldMFAEnabled    Field = "mfa_enabled_at"
+)
+
+// FindOptions holds the optional settings for repository lookups.
+type FindOptions struct {
+	// Fields limits which attributes are loaded.
+	// An empty slice means "load everything".
+	// Attributes that aren't loaded are left at their zero value.
+	Fields []Field
+}
+
+// FindOption configures a repository lookup.
+//
+// FUNCTIONAL OPTIONS PATTERN:
+// Instead of adding parameters every time a lookup needs a new knob,
+// methods accept a variadic list of option functions:
+//
+//	repo.FindByEmail(ctx, email)                                // all fields
+//	repo.FindByEmail(ctx, email, user.WithFields(user.FieldID)) // only id
+//
+// Existing callers keep compiling when new options are added.
+type FindOption func(*FindOptions)
+
+// WithFields restricts a lookup to the given fields.
+func WithFields(fields ...Field) FindOption {
+	return func(o *FindOptions) {
+		o.Fields = append(o.Fields, fields...)
+	}
+}
+
+// ApplyFindOptions builds FindOptions from a list of options.
+// Repository implementations call this at the start of each lookup.
+func ApplyFindOptions(opts ...FindOption) FindOptions {
+	var o FindOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
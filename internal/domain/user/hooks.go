@@ -0,0 +1,149 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// BeforeHook runs before a write reaches the repository.
+// It may modify the user (e.g. normalize fields) or return an error
+// to abort the operation.
+type BeforeHook func(ctx context.Context, u *User) error
+
+// AfterHook runs after a write succeeded.
+// It can't undo the write, so it doesn't return an error;
+// hooks should log their own failures.
+type AfterHook func(ctx context.Context, u *User)
+
+// AfterDeleteHook runs after a user was deleted.
+type AfterDeleteHook func(ctx context.Context, id uint64)
+
+// Hooks groups lifecycle callbacks for repository operations.
+//
+// WHY NOT AN ORM?
+// ORMs like GORM let models define BeforeCreate/AfterDelete methods that run
+// "magically". That's convenient, but it hides behavior inside the model
+// and the SQL is generated for you.
+//
+// Here the SQL stays explicit in the repository, and hooks are plain
+// functions registered in one place (the composition root in internal/app).
+// Reading the wiring code tells you exactly what runs around each write.
+type Hooks struct {
+	BeforeCreate []BeforeHook
+	AfterCreate  []AfterHook
+	BeforeUpdate []BeforeHook
+	AfterUpdate  []AfterHook
+	AfterDelete  []AfterDeleteHook
+}
+
+// hookedRepository wraps a Repository and runs hooks around writes.
+//
+// It embeds the Repository interface, so every method we don't override
+// (FindByID, List, ...) is forwarded to the wrapped repository unchanged.
+type hookedRepository struct {
+	Repository
+	hooks Hooks
+}
+
+// WithHooks returns a Repository that runs the given hooks around
+// Create, Update, SetActive, Delete, and Anonymize. This is the Decorator pattern:
+// callers keep using the Repository interface and don't know hooks exist.
+func WithHooks(repo Repository, hooks Hooks) Repository {
+	return &hookedRepository{Repository: repo, hooks: hooks}
+}
+
+// Create runs BeforeCreate hooks, creates the user, then runs AfterCreate hooks.
+func (r *hookedRepository) Create(ctx context.Context, u *User) error {
+	for _, hook := range r.hooks.BeforeCreate {
+		if err := hook(ctx, u); err != nil {
+			return err
+		}
+	}
+	if err := r.Repository.Create(ctx, u); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks.AfterCreate {
+		hook(ctx, u)
+	}
+	return nil
+}
+
+// Update runs BeforeUpdate hooks, updates the user, then runs AfterUpdate hooks.
+func (r *hookedRepository) Update(ctx context.Context, u *User) error {
+	for _, hook := range r.hooks.BeforeUpdate {
+		if err := hook(ctx, u); err != nil {
+			return err
+		}
+	}
+	if err := r.Repository.Update(ctx, u); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks.AfterUpdate {
+		hook(ctx, u)
+	}
+	return nil
+}
+
+// SetActive deactivates or activates the user, then runs AfterUpdate
+// hooks with a User holding only the ID and the new Active: what reacts
+// to an update (dropping cached token versions) must react to this.
+func (r *hookedRepository) SetActive(ctx context.Context, id uint64, active bool) error {
+	if err := r.Repository.SetActive(ctx, id, active); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks.AfterUpdate {
+		hook(ctx, &User{ID: id, Active: active})
+	}
+	return nil
+}
+
+// Delete deletes the user, then runs AfterDelete hooks.
+func (r *hookedRepository) Delete(ctx context.Context, id uint64) error {
+	if err := r.Repository.Delete(ctx, id); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks.AfterDelete {
+		hook(ctx, id)
+	}
+	return nil
+}
+
+// Anonymize anonymizes the user, then runs AfterDelete hooks: the
+// account is soft-deleted too, and whatever reacts to a deletion should
+// react to this.
+func (r *hookedRepository) Anonymize(ctx context.Context, id uint64, email string) error {
+	if err := r.Repository.Anonymize(ctx, id, email); err != nil {
+		return err
+	}
+	for _, hook := range r.hooks.AfterDelete {
+		hook(ctx, id)
+	}
+	return nil
+}
+
+// NormalizeEmail is a BeforeHook that trims and lowercases the email,
+// so the same address can't be stored twice with different casing.
+// It's a safety net for writes that skipped the services, which
+// normalize with their EmailNormalizer first; an address that already
+// went through one comes out unchanged.
+func NormalizeEmail(ctx context.Context, u *User) error {
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	return nil
+}
+
+// AssignULID is a BeforeHook that gives a new user its ULID (see
+// User.ULID). One the caller already set is kept, so a Create retried
+// with the same User doesn't get a second one.
+func AssignULID(ctx context.Context, u *User) error {
+	if u.ULID != "" {
+		return nil
+	}
+	id, err := NewULID(time.Now())
+	if err != nil {
+		return fmt.Errorf("generating ULID: %w", err)
+	}
+	u.ULID = id
+	return nil
+}
@@ -0,0 +1,116 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// importedPasswordHash marks imported accounts that came without a
+// password hash. Like externalPasswordHash, it's in no known hash format,
+// so no password matches it until the user sets one through a reset.
+const importedPasswordHash = "!import"
+
+// ImportRow is one user brought over from another system (see Import).
+type ImportRow struct {
+	Email    string
+	Username string // Optional
+
+	// PasswordHash is the hash the old system stored, so users keep
+	// their password: bcrypt ("$2a$...") or Argon2id (PHC string).
+	// It's upgraded to the current algorithm at the first login, like
+	// any other. Empty leaves the account without a password.
+	PasswordHash string
+
+	EmailVerified bool
+	Roles         []Role // Given on top of RoleUser
+}
+
+// ImportStatus is what Import did with a row.
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created" // The user was created
+	ImportSkipped ImportStatus = "skipped" // An account with the email exists; it's left alone
+	ImportFailed  ImportStatus = "error"   // The row is invalid; nothing was written
+)
+
+// ImportResult is what became of one row.
+type ImportResult struct {
+	Status ImportStatus
+	UserID uint64 // For ImportCreated
+	Err    error  // Why the row was skipped or failed: ErrEmailExists, ErrInvalidEmail, ...
+}
+
+// Import creates the user in row, as it was in the old system: with its
+// password hash, verified or not, and with its roles.
+//
+// A row's own problems (an invalid email, an unsupported hash, a taken
+// username) come back in the result, and the caller moves on to the
+// next row. A row whose email is already registered is skipped, so an
+// import that stopped halfway can be run again from the top. err is
+// for everything else, like a lost database connection: run in a
+// transaction, the caller should roll back whatever it's batching.
+//
+// WHY TAKE HASHES, NOT PASSWORDS?
+// The old system doesn't know its users' passwords either, only hashes.
+// Formats this service verifies are imported as they are; users sign in
+// with their old password and never notice the move.
+func (s *Service) Import(ctx context.Context, row ImportRow) (ImportResult, error) {
+	failed := func(err error) (ImportResult, error) {
+		return ImportResult{Status: ImportFailed, Err: err}, nil
+	}
+
+	email := s.emails.Normalize(row.Email)
+	if err := validateEmail(email); err != nil {
+		return failed(err)
+	}
+	username := NormalizeUsername(row.Username)
+	if username != "" {
+		if err := validateUsername(username); err != nil {
+			return failed(err)
+		}
+	}
+	hash := row.PasswordHash
+	if hash == "" {
+		hash = importedPasswordHash
+	} else if !importableHash(hash) {
+		return failed(ErrUnsupportedHash)
+	}
+	for _, role := range row.Roles {
+		if !knownRoles[role] {
+			return failed(ErrUnknownRole)
+		}
+	}
+
+	u := &User{Email: email, Username: username, PasswordHash: hash, EmailVerified: row.EmailVerified}
+	err := s.repo.Create(ctx, u)
+	switch {
+	case errors.Is(err, ErrEmailExists):
+		return ImportResult{Status: ImportSkipped, Err: ErrEmailExists}, nil
+	case errors.Is(err, ErrUsernameTaken):
+		return failed(ErrUsernameTaken)
+	case err != nil:
+		return ImportResult{}, fmt.Errorf("creating user: %w", err)
+	}
+
+	for _, role := range append([]Role{RoleUser}, row.Roles...) {
+		if err := s.roles.Assign(ctx, u.ID, role); err != nil {
+			return ImportResult{}, fmt.Errorf("assigning role %s: %w", role, err)
+		}
+	}
+	return ImportResult{Status: ImportCreated, UserID: u.ID}, nil
+}
+
+// importableHash reports whether hash is in a format the hashers here
+// verify. Only the format is checked: nothing is hashed, so a whole
+// import costs less than one login.
+func importableHash(hash string) bool {
+	if _, _, _, err := parseArgon2id(hash); err == nil {
+		return true
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err == nil
+}
@@ -0,0 +1,331 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-basics/internal/mail"
+)
+
+// InvitedPasswordHash marks accounts created by an invitation that
+// hasn't been accepted yet. Like externalPasswordHash, it's in no known
+// hash format, so no password matches it: the account can't be signed
+// in to until Invitations.Accept sets a real one.
+const InvitedPasswordHash = "!invited"
+
+// InvitationStatus is where an invitation stands.
+type InvitationStatus string
+
+// Invitation statuses.
+const (
+	InvitationPending  InvitationStatus = "pending"  // Sent, and its link still works
+	InvitationExpired  InvitationStatus = "expired"  // Never accepted; Resend sends a new link
+	InvitationAccepted InvitationStatus = "accepted" // The invitee chose a password
+	InvitationRevoked  InvitationStatus = "revoked"  // An admin took it back, or invited the address again
+)
+
+// Invitation is an emailed offer to finish registering the account
+// created for Email. Only the hash of its token is stored, like a reset
+// token's.
+type Invitation struct {
+	ID         uint64
+	UserID     uint64 // The pending account, created with the invitation
+	Email      string
+	InvitedBy  uint64 // The admin who sent it
+	CreatedAt  time.Time
+	SentAt     time.Time // The latest send: creation, or the last Resend
+	ExpiresAt  time.Time
+	AcceptedAt *time.Time
+	RevokedAt  *time.Time
+}
+
+// Status returns the invitation's status at now.
+func (inv *Invitation) Status(now time.Time) InvitationStatus {
+	switch {
+	case inv.AcceptedAt != nil:
+		return InvitationAccepted
+	case inv.RevokedAt != nil:
+		return InvitationRevoked
+	case !now.Before(inv.ExpiresAt):
+		return InvitationExpired
+	default:
+		return InvitationPending
+	}
+}
+
+// InvitationRepository stores invitations.
+type InvitationRepository interface {
+	// CreateInvitation stores inv with the hash of its token, and sets
+	// inv.ID.
+	CreateInvitation(ctx context.Context, inv *Invitation, tokenHash string) error
+
+	// Invitation returns the invitation with id, or nil.
+	Invitation(ctx context.Context, id uint64) (*Invitation, error)
+
+	// Invitations returns up to limit invitations, newest first.
+	Invitations(ctx context.Context, limit int) ([]Invitation, error)
+
+	// RenewInvitation replaces the token of an invitation that was
+	// neither accepted nor revoked, and moves its sent and expiry times.
+	// It returns ErrInvitationClosed if the invitation was accepted or
+	// revoked meanwhile.
+	RenewInvitation(ctx context.Context, id uint64, tokenHash string, sentAt, expiresAt time.Time) error
+
+	// RevokeInvitation revokes the invitation, unless it was accepted or
+	// revoked already, and reports whether it did.
+	RevokeInvitation(ctx context.Context, id uint64, at time.Time) (bool, error)
+
+	// RevokeUserInvitations revokes the user's invitations that were
+	// neither accepted nor revoked.
+	RevokeUserInvitations(ctx context.Context, userID uint64, at time.Time) error
+
+	// AcceptInvitation marks the invitation with tokenHash accepted and
+	// returns it. Like ResetTokenRepository.Consume it must be atomic:
+	// two concurrent calls with the same hash can't both succeed. Returns
+	// ErrInvalidInvitation if the token doesn't exist, has expired, or
+	// its invitation was accepted or revoked.
+	AcceptInvitation(ctx context.Context, tokenHash string, at time.Time) (*Invitation, error)
+}
+
+// Invitations implements inviting people to an account an admin sets
+// up for them:
+//
+//  1. Invite: an admin submits an email. A pending account is created
+//     for it, with the default role and no usable password, and a link
+//     with a single-use token is emailed to the address.
+//  2. Accept: the invitee submits the token and a password. The account
+//     gets the password, and its email counts as verified: the link
+//     could only be followed from that inbox.
+//
+// Until then, admins can Resend the invitation (a new link, a new
+// expiry, and the old link stops working) or Revoke it.
+//
+// WHY CREATE THE ACCOUNT UP FRONT?
+// The address is taken as soon as it's invited: nobody else can register
+// it, an admin can grant roles to the account before its owner arrives,
+// and the account shows up in the user list with everyone else's. The
+// account can't be used meanwhile: no password matches
+// InvitedPasswordHash, PasswordReset won't set one either, and
+// AuthenticateExternal won't sign it in through SSO, so the invitation
+// is the only way in, and revoking it (or letting it expire) closes that
+// way.
+type Invitations struct {
+	users     Repository
+	roles     RoleRepository
+	repo      InvitationRepository
+	mailer    mail.Mailer
+	hasher    PasswordHasher
+	acceptURL string          // Link sent to the invitee; the token is appended as ?token=
+	ttl       time.Duration   // How long an invitation's link stays valid
+	emails    EmailNormalizer // The Service's, so the invited address is stored like a signup's
+	now       func() time.Time
+}
+
+// NewInvitations creates the invitation flow.
+func NewInvitations(users Repository, roles RoleRepository, repo InvitationRepository, mailer mail.Mailer, hasher PasswordHasher, acceptURL string, ttl time.Duration, emails EmailNormalizer) *Invitations {
+	return &Invitations{
+		users:     users,
+		roles:     roles,
+		repo:      repo,
+		mailer:    mailer,
+		hasher:    hasher,
+		acceptURL: acceptURL,
+		ttl:       ttl,
+		emails:    emails,
+		now:       time.Now,
+	}
+}
+
+// Invite creates a pending account for email on behalf of the admin
+// invitedBy, and emails the invitation. Returns ErrEmailExists if an
+// account that isn't pending has the address.
+//
+// Inviting an address again, while its account is still pending,
+// revokes the earlier invitations and sends a new one.
+func (i *Invitations) Invite(ctx context.Context, email string, invitedBy uint64) (*Invitation, error) {
+	email = i.emails.Normalize(email)
+	if err := validateEmail(email); err != nil {
+		return nil, err
+	}
+
+	now := i.now()
+	u, err := i.users.FindByEmail(ctx, email, WithFields(FieldID, FieldEmail, FieldPasswordHash))
+	if err != nil {
+		return nil, fmt.Errorf("finding user by email: %w", err)
+	}
+	switch {
+	case u == nil:
+		u = &User{Email: email, PasswordHash: InvitedPasswordHash}
+		if err := i.users.Create(ctx, u); err != nil {
+			return nil, fmt.Errorf("creating user: %w", err)
+		}
+		if err := i.roles.Assign(ctx, u.ID, RoleUser); err != nil {
+			return nil, fmt.Errorf("assigning default role: %w", err)
+		}
+	case u.PasswordHash != InvitedPasswordHash:
+		return nil, ErrEmailExists
+	default:
+		if err := i.repo.RevokeUserInvitations(ctx, u.ID, now); err != nil {
+			return nil, fmt.Errorf("revoking earlier invitations: %w", err)
+		}
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return nil, fmt.Errorf("generating invitation token: %w", err)
+	}
+	inv := &Invitation{
+		UserID:    u.ID,
+		Email:     u.Email,
+		InvitedBy: invitedBy,
+		CreatedAt: now,
+		SentAt:    now,
+		ExpiresAt: now.Add(i.ttl),
+	}
+	if err := i.repo.CreateInvitation(ctx, inv, hashSecretToken(token)); err != nil {
+		return nil, fmt.Errorf("storing invitation: %w", err)
+	}
+	if err := i.send(ctx, inv.Email, token); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Invitations returns up to limit invitations, newest first.
+func (i *Invitations) Invitations(ctx context.Context, limit int) ([]Invitation, error) {
+	return i.repo.Invitations(ctx, limit)
+}
+
+// Resend emails a new link for the invitation, valid for a full TTL
+// again; the earlier link stops working. Expired invitations can be
+// resent, accepted or revoked ones can't (ErrInvitationClosed).
+func (i *Invitations) Resend(ctx context.Context, id uint64) (*Invitation, error) {
+	inv, err := i.open(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return nil, fmt.Errorf("generating invitation token: %w", err)
+	}
+	now := i.now()
+	if err := i.repo.RenewInvitation(ctx, id, hashSecretToken(token), now, now.Add(i.ttl)); err != nil {
+		return nil, err
+	}
+	inv.SentAt, inv.ExpiresAt = now, now.Add(i.ttl)
+	if err := i.send(ctx, inv.Email, token); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Revoke takes the invitation back: its link stops working. The pending
+// account stays, so the address can be invited again; it still can't
+// be signed in to. Returns ErrInvitationClosed for an invitation that
+// was accepted or revoked already.
+func (i *Invitations) Revoke(ctx context.Context, id uint64) (*Invitation, error) {
+	inv, err := i.open(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := i.now()
+	revoked, err := i.repo.RevokeInvitation(ctx, id, now)
+	if err != nil {
+		return nil, fmt.Errorf("revoking invitation: %w", err)
+	}
+	if !revoked {
+		// Accepted or revoked since open read it.
+		return nil, ErrInvitationClosed
+	}
+	inv.RevokedAt = &now
+	return inv, nil
+}
+
+// open returns the invitation with id, if it was neither accepted nor
+// revoked. Returns ErrInvitationNotFound or ErrInvitationClosed.
+func (i *Invitations) open(ctx context.Context, id uint64) (*Invitation, error) {
+	inv, err := i.repo.Invitation(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("finding invitation: %w", err)
+	}
+	if inv == nil {
+		return nil, ErrInvitationNotFound
+	}
+	if inv.AcceptedAt != nil || inv.RevokedAt != nil {
+		return nil, ErrInvitationClosed
+	}
+	return inv, nil
+}
+
+// Accept completes the registration of the invited account using a token
+// from Invite or Resend: the account gets password, and its email counts
+// as verified. Returns ErrInvalidInvitation if the token is unknown,
+// expired, used, or revoked.
+func (i *Invitations) Accept(ctx context.Context, token, password string) (*User, error) {
+	// Validate first so a weak password doesn't burn the token.
+	if err := validatePassword(password); err != nil {
+		return nil, err
+	}
+
+	inv, err := i.repo.AcceptInvitation(ctx, hashSecretToken(token), i.now())
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := i.users.FindByID(ctx, inv.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil || u.PasswordHash != InvitedPasswordHash {
+		// The account was deleted, or got a password some other way
+		// (single sign-on, an import) since the invitation was sent.
+		return nil, ErrInvalidInvitation
+	}
+
+	u.PasswordHash, err = i.hasher.Hash(ctx, password)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+	// Following the link proved the inbox is theirs.
+	u.EmailVerified = true
+	if err := i.users.Update(ctx, u); err != nil {
+		return nil, fmt.Errorf("setting password: %w", err)
+	}
+	return u, nil
+}
+
+// send emails the invitation with the link for token.
+func (i *Invitations) send(ctx context.Context, to, token string) error {
+	msg, err := i.message(to, token)
+	if err != nil {
+		return err
+	}
+	if err := i.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("sending invitation email: %w", err)
+	}
+	return nil
+}
+
+// message builds the invitation email with the link for token. Like
+// PasswordReset.message, EmailPreviews renders it too.
+func (i *Invitations) message(to, token string) (mail.Message, error) {
+	link, err := url.Parse(i.acceptURL)
+	if err != nil {
+		return mail.Message{}, fmt.Errorf("parsing invitation URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mail.Message{
+		To:      to,
+		Subject: "You're invited to create an account",
+		Body: fmt.Sprintf("An account has been set up for this address.\n\n"+
+			"To choose your password and start using it, open this link within %s:\n\n%s\n\n"+
+			"If you weren't expecting this, ignore this email; the account can't be used without the link.\n",
+			i.ttl, link),
+	}, nil
+}
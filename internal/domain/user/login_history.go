@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// loginHistorySize is how many logins are kept per user; older ones are
+// deleted as new ones are recorded.
+//
+// WHY NOT KEEP THEM ALL?
+// The history is for a user checking "was that me?", which is about the
+// last few weeks, not years. Every row is also an IP address and a user
+// agent, personal data that's better not kept longer than it's useful.
+// A fixed number per user bounds the table without a cleanup job.
+const loginHistorySize = 50
+
+// Login is one sign-in: a password login, SSO, or the new session after
+// a password change (see Sessions.Start). Refreshes aren't logins.
+type Login struct {
+	ID        uint64
+	UserID    uint64
+	UserAgent string
+	IPAddress string
+	At        time.Time
+}
+
+// LoginHistory is what GET /users/{id}/logins shows: when and from where
+// the account was last used, and its recent logins.
+type LoginHistory struct {
+	LastLoginAt time.Time // Last login or refresh; zero if never recorded
+	LastLoginIP string    // Address of that login or refresh; "" if unknown
+	Logins      []*Login  // Most recent first
+}
+
+// LoginHistoryRepository stores logins.
+type LoginHistoryRepository interface {
+	// Record stores login, setting its ID, and deletes the user's logins
+	// beyond the keep most recent.
+	Record(ctx context.Context, login *Login, keep int) error
+
+	// ListForUser returns up to limit of the user's logins, most recent
+	// first.
+	ListForUser(ctx context.Context, userID uint64, limit int) ([]*Login, error)
+
+	// DeleteForUser removes all of the user's logins.
+	DeleteForUser(ctx context.Context, userID uint64) error
+}
+
+// WithLoginHistory records every login in history, for users and admins
+// to review (see Sessions.LoginHistory).
+func WithLoginHistory(history LoginHistoryRepository) SessionOption {
+	return func(s *Sessions) { s.history = history }
+}
+
+// LoginHistory returns the user's last login and recent logins.
+// Returns ErrNotFound for a user that doesn't exist, so an admin
+// can tell a mistyped ID from an account that never signed in.
+func (s *Sessions) LoginHistory(ctx context.Context, userID uint64) (*LoginHistory, error) {
+	u, err := s.users.FindByID(ctx, userID, WithFields(FieldID))
+	if err != nil {
+		return nil, fmt.Errorf("finding user by id: %w", err)
+	}
+	if u == nil {
+		return nil, ErrNotFound
+	}
+
+	history := &LoginHistory{}
+	if s.activity != nil {
+		a, err := s.activity.Find(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("checking activity: %w", err)
+		}
+		if a != nil {
+			history.LastLoginAt, history.LastLoginIP = a.LastLoginAt, a.LastLoginIP
+		}
+	}
+	if s.history != nil {
+		history.Logins, err = s.history.ListForUser(ctx, userID, loginHistorySize)
+		if err != nil {
+			return nil, fmt.Errorf("listing logins: %w", err)
+		}
+	}
+	return history, nil
+}
+
+// recordLogin adds a login from device to the user's history.
+func (s *Sessions) recordLogin(ctx context.Context, userID uint64, device Device) error {
+	if s.history == nil {
+		return nil
+	}
+	login := &Login{
+		UserID:    userID,
+		UserAgent: truncate(device.UserAgent, maxUserAgentLength),
+		IPAddress: device.IPAddress,
+		At:        time.Now().UTC(),
+	}
+	if err := s.history.Record(ctx, login, loginHistorySize); err != nil {
+		return fmt.Errorf("recording login: %w", err)
+	}
+	return nil
+}
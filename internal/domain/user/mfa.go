@@ -0,0 +1,238 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go-basics/internal/totp"
+)
+
+// MFAEnrollment is what a user needs to add the account to their
+// authenticator app.
+type MFAEnrollment struct {
+	// Secret is the base32 key, for typing in by hand.
+	Secret string
+
+	// URI is the otpauth:// provisioning URI. Show it as a QR code.
+	URI string
+}
+
+// MFA manages TOTP two-factor authentication for accounts.
+//
+// ENROLLMENT IS TWO STEPS:
+//  1. Enroll generates and stores a secret, but leaves 2FA OFF.
+//  2. Confirm turns it on once the user proves their app produces valid
+//     codes. This way a user who scans the QR code wrong isn't locked out.
+//
+// Confirm also hands out recovery codes: single-use codes that sign in
+// in place of the app's, for the day the phone is lost. They're shown
+// once; after that only their hashes exist (see RecoveryCodeRepository).
+type MFA struct {
+	repo   Repository
+	codes  RecoveryCodeRepository
+	hasher PasswordHasher // Checks the password for ResetAfterRecovery
+	issuer string         // Shown as the account's label in authenticator apps
+	audit  func(ctx context.Context, userID uint64, message string)
+}
+
+// NewMFA creates the two-factor authentication manager. Every change to
+// an account's 2FA is reported to audit.
+func NewMFA(repo Repository, codes RecoveryCodeRepository, hasher PasswordHasher, issuer string, audit func(ctx context.Context, userID uint64, message string)) *MFA {
+	return &MFA{repo: repo, codes: codes, hasher: hasher, issuer: issuer, audit: audit}
+}
+
+// Enroll generates a new secret for the user.
+// Calling it again before Confirm replaces the pending secret.
+func (m *MFA) Enroll(ctx context.Context, id uint64) (*MFAEnrollment, error) {
+	u, err := m.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	u.MFASecret = secret
+	if err := m.repo.Update(ctx, u); err != nil {
+		return nil, fmt.Errorf("storing MFA secret: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(m.issuer, u.Email, secret),
+	}, nil
+}
+
+// Confirm turns two-factor authentication on after checking a code
+// from the user's app against the pending secret. It returns the
+// account's recovery codes, the only time they're available.
+func (m *MFA) Confirm(ctx context.Context, id uint64, code string) ([]string, error) {
+	u, err := m.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.MFAEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if u.MFASecret == "" {
+		return nil, ErrMFANotEnrolled
+	}
+	if !totp.Validate(u.MFASecret, code, time.Now()) {
+		return nil, ErrInvalidMFACode
+	}
+
+	u.MFAEnabled = true
+	if err := m.repo.Update(ctx, u); err != nil {
+		return nil, fmt.Errorf("enabling MFA: %w", err)
+	}
+	codes, err := m.replaceCodes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.audit(ctx, id, "turned on two-factor authentication")
+	return codes, nil
+}
+
+// Disable turns two-factor authentication off and forgets the secret.
+// It requires a current code, so a stolen token alone can't remove 2FA.
+func (m *MFA) Disable(ctx context.Context, id uint64, code string) error {
+	u, err := m.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !u.MFAEnabled {
+		return ErrMFANotEnrolled
+	}
+	if !totp.Validate(u.MFASecret, code, time.Now()) {
+		return ErrInvalidMFACode
+	}
+
+	if err := m.turnOff(ctx, u); err != nil {
+		return err
+	}
+	m.audit(ctx, id, "turned off two-factor authentication")
+	return nil
+}
+
+// RecoveryStatus returns how many of the user's recovery codes are left
+// and used.
+func (m *MFA) RecoveryStatus(ctx context.Context, id uint64) (*RecoveryStatus, error) {
+	u, err := m.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !u.MFAEnabled {
+		return nil, ErrMFANotEnrolled
+	}
+	status, err := m.codes.RecoveryCodeStatus(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("counting recovery codes: %w", err)
+	}
+	return status, nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, used or
+// not, with new ones and returns them. Like Disable, it takes a current
+// code from the app: someone holding only a stolen token or a recovery
+// code can't mint more.
+func (m *MFA) RegenerateRecoveryCodes(ctx context.Context, id uint64, code string) ([]string, error) {
+	u, err := m.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !u.MFAEnabled {
+		return nil, ErrMFANotEnrolled
+	}
+	if !totp.Validate(u.MFASecret, code, time.Now()) {
+		return nil, ErrInvalidMFACode
+	}
+	codes, err := m.replaceCodes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	m.audit(ctx, id, "regenerated two-factor recovery codes")
+	return codes, nil
+}
+
+// ResetAfterRecovery turns two-factor authentication off for a user who
+// signed in with a recovery code since the codes were generated, so
+// they can enroll a new authenticator. Without the app there's no code
+// to give Disable, so it takes the password instead.
+//
+// WHY ONLY AFTER A RECOVERY CODE?
+// Otherwise the password alone would turn 2FA off, and 2FA is there
+// for when the password has leaked. Using a recovery code proves the
+// second factor, once.
+func (m *MFA) ResetAfterRecovery(ctx context.Context, id uint64, password string) error {
+	u, err := m.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !u.MFAEnabled {
+		return ErrMFANotEnrolled
+	}
+	status, err := m.codes.RecoveryCodeStatus(ctx, id)
+	if err != nil {
+		return fmt.Errorf("counting recovery codes: %w", err)
+	}
+	if !status.ReenrollmentRequired() {
+		return ErrMFAResetNotAllowed
+	}
+	ok, err := m.hasher.Verify(ctx, u.PasswordHash, password)
+	if err != nil && ctx.Err() != nil {
+		return fmt.Errorf("verifying password: %w", err)
+	}
+	if err != nil || !ok {
+		return ErrIncorrectPassword
+	}
+
+	if err := m.turnOff(ctx, u); err != nil {
+		return err
+	}
+	m.audit(ctx, id, "reset two-factor authentication after signing in with a recovery code")
+	return nil
+}
+
+// replaceCodes generates new recovery codes for the user and stores
+// their hashes in place of the old ones.
+func (m *MFA) replaceCodes(ctx context.Context, id uint64) ([]string, error) {
+	codes, hashes, err := newRecoveryCodes(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.codes.ReplaceRecoveryCodes(ctx, id, hashes); err != nil {
+		return nil, fmt.Errorf("storing recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// turnOff disables 2FA, forgetting the secret and the recovery codes.
+func (m *MFA) turnOff(ctx context.Context, u *User) error {
+	u.MFASecret = ""
+	u.MFAEnabled = false
+	if err := m.repo.Update(ctx, u); err != nil {
+		return fmt.Errorf("disabling MFA: %w", err)
+	}
+	if err := m.codes.DeleteRecoveryCodes(ctx, u.ID); err != nil {
+		return fmt.Errorf("deleting recovery codes: %w", err)
+	}
+	return nil
+}
+
+// find loads the full user (Update writes every column, so a partial
+// load would erase the fields that weren't loaded).
+func (m *MFA) find(ctx context.Context, id uint64) (*User, error) {
+	u, err := m.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return nil, ErrNotFound
+	}
+	return u, nil
+}
@@ -0,0 +1,262 @@
+package user
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pagination limits.
+const (
+	// DefaultListLimit is used when the caller doesn't ask for a page size.
+	DefaultListLimit = 20
+
+	// MaxListLimit caps the page size so a single request can't pull
+	// the whole table into memory.
+	MaxListLimit = 100
+)
+
+// ErrInvalidCursor is returned when a pagination cursor can't be decoded,
+// or comes from a listing in another order.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// ErrInvalidSort is returned for a sort field not in SortFields.
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// SortField names an order users can be listed in.
+type SortField string
+
+// Sort fields. Every one is a column with an index that starts with it,
+// so each page stays a single index seek, in either direction.
+const (
+	SortCreatedAt SortField = "created_at" // Signup order; the default
+	SortEmail     SortField = "email"      // Alphabetical by email
+)
+
+// SortFields are the orders List accepts.
+//
+// WHY A WHITELIST?
+// Sorting by an arbitrary column would need an index per column, or
+// every page would sort the whole table. It would also mean putting a
+// caller's string into ORDER BY, where placeholders don't work.
+var SortFields = []SortField{SortCreatedAt, SortEmail}
+
+// Cursor identifies a position in a listing: the sort key and id of the
+// last user on the previous page, and the order they were sorted in.
+//
+// KEYSET PAGINATION:
+// OFFSET pagination ("skip 10000 rows, take 20") gets slower the deeper
+// you go, because the database still has to walk every skipped row.
+// It also shifts results when rows are inserted while a client is paging.
+//
+// Keyset pagination remembers the LAST row of the previous page and asks
+// for rows that come after it:
+//
+//	WHERE (created_at, id) > (?, ?) ORDER BY created_at, id
+//
+// With an index on (created_at, id) every page is a single index seek.
+// We include id as a tie-breaker because many users can share the same
+// created_at second.
+//
+// The position only means something in the order it was taken in, so
+// the cursor carries that order, and List refuses it in any other.
+type Cursor struct {
+	Sort       SortField
+	Descending bool
+
+	CreatedAt time.Time // The sort key, for SortCreatedAt
+	Email     string    // The sort key, for SortEmail
+	ID        uint64
+}
+
+// CursorFor returns the cursor pointing just after u, in the order of params.
+func CursorFor(u *User, params ListParams) Cursor {
+	c := Cursor{Sort: params.sort(), Descending: params.Descending, ID: u.ID}
+	switch c.Sort {
+	case SortEmail:
+		c.Email = u.Email
+	default:
+		c.CreatedAt = u.CreatedAt
+	}
+	return c
+}
+
+// Encode returns an opaque, URL-safe representation of the cursor.
+// Clients should treat it as a black box and pass it back unchanged.
+//
+// The default order keeps the original "nanos:id" format, so cursors
+// handed out before sorting existed still work. Other orders are
+// "sort:direction:id:key", with the key last, since an email may
+// contain a colon.
+func (c Cursor) Encode() string {
+	if (c.Sort == "" || c.Sort == SortCreatedAt) && !c.Descending {
+		raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatUint(c.ID, 10)
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	direction := "asc"
+	if c.Descending {
+		direction = "desc"
+	}
+	key := c.Email
+	if c.Sort == SortCreatedAt {
+		key = strconv.FormatInt(c.CreatedAt.UnixNano(), 10)
+	}
+	raw := string(c.Sort) + ":" + direction + ":" + strconv.FormatUint(c.ID, 10) + ":" + key
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 4)
+	switch len(parts) {
+	case 2:
+		nanos, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+		id, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+		return Cursor{Sort: SortCreatedAt, CreatedAt: time.Unix(0, nanos).UTC(), ID: id}, nil
+
+	case 4:
+		c := Cursor{Sort: SortField(parts[0])}
+		switch parts[1] {
+		case "asc":
+		case "desc":
+			c.Descending = true
+		default:
+			return Cursor{}, ErrInvalidCursor
+		}
+		if c.ID, err = strconv.ParseUint(parts[2], 10, 64); err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+		switch c.Sort {
+		case SortCreatedAt:
+			nanos, err := strconv.ParseInt(parts[3], 10, 64)
+			if err != nil {
+				return Cursor{}, ErrInvalidCursor
+			}
+			c.CreatedAt = time.Unix(0, nanos).UTC()
+		case SortEmail:
+			c.Email = parts[3]
+		default:
+			return Cursor{}, ErrInvalidCursor
+		}
+		return c, nil
+
+	default:
+		return Cursor{}, ErrInvalidCursor
+	}
+}
+
+// ListFilter narrows a listing to the users matching every field set.
+// The zero value matches everyone.
+type ListFilter struct {
+	// EmailPrefix matches emails starting with it, ignoring case.
+	EmailPrefix string
+
+	// CreatedFrom and CreatedTo bound the signup time: at or after
+	// CreatedFrom, and before CreatedTo. A zero time leaves that end open.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// Verified, when set, matches only users whose EmailVerified is *Verified.
+	Verified *bool
+}
+
+// ListParams controls which page of users the repository returns.
+type ListParams struct {
+	// Limit is the maximum number of users to return.
+	Limit int
+
+	// After, when set, returns only users strictly after this position.
+	// A nil cursor starts from the beginning.
+	After *Cursor
+
+	// Filter selects which users are listed at all.
+	Filter ListFilter
+
+	// Sort orders the list, with id breaking ties. Empty means
+	// SortCreatedAt. Descending reverses both.
+	Sort       SortField
+	Descending bool
+}
+
+// sort returns the sort field, with the default filled in.
+func (p ListParams) sort() SortField {
+	if p.Sort == "" {
+		return SortCreatedAt
+	}
+	return p.Sort
+}
+
+// Before reports whether a comes before b in the order p asks for, the
+// order the repository returns them in (e.g. to merge pages from
+// several shards).
+func (p ListParams) Before(a, b *User) bool {
+	var cmp int
+	switch p.sort() {
+	case SortEmail:
+		cmp = strings.Compare(a.Email, b.Email)
+	default:
+		cmp = a.CreatedAt.Compare(b.CreatedAt)
+	}
+	if cmp == 0 {
+		switch {
+		case a.ID < b.ID:
+			cmp = -1
+		case a.ID > b.ID:
+			cmp = 1
+		}
+	}
+	if p.Descending {
+		return cmp > 0
+	}
+	return cmp < 0
+}
+
+// validate checks the sort field, and that the cursor continues a
+// listing in the same order.
+func (p ListParams) validate() error {
+	if !slices.Contains(SortFields, p.sort()) {
+		return ErrInvalidSort
+	}
+	if p.After != nil && (p.After.Sort != p.sort() || p.After.Descending != p.Descending) {
+		return ErrInvalidCursor
+	}
+	return nil
+}
+
+// Page is one page of users plus the cursor for the next page.
+type Page struct {
+	Users []*User
+
+	// Total is the number of users matching the filter in the whole list,
+	// not this page.
+	Total int64
+
+	// NextCursor is nil when there are no more results.
+	NextCursor *Cursor
+}
+
+// normalizeLimit applies the default and maximum page size.
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		return MaxListLimit
+	}
+	return limit
+}
@@ -0,0 +1,309 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnsupportedHash is returned by PasswordHasher.Verify when the stored
+// hash wasn't produced by that hasher (or isn't a password hash at all).
+var ErrUnsupportedHash = errors.New("unsupported password hash format")
+
+// PasswordHasher hashes and verifies passwords.
+//
+// WHY AN INTERFACE?
+// Password hashing algorithms age: bcrypt was the default for two decades,
+// Argon2id is today's recommendation, and something else will follow.
+// Stored hashes can't be converted (that's the point of hashing), so the
+// service must keep verifying the old format while writing the new one.
+// The interface lets it do that without knowing which algorithms exist.
+//
+// CONTEXTS AND HASHING:
+// A hash can't be stopped halfway: argon2 and bcrypt take no context.
+// So ctx only guards the start, like in mail.SMTPMailer.Send: a request
+// whose client has gone (or whose deadline passed) doesn't start a hash
+// nobody will see, and doesn't wait for a slot in NewBoundedHasher's
+// queue, which is where the time goes under load.
+type PasswordHasher interface {
+	// Hash returns a self-describing hash of password (algorithm,
+	// parameters, and salt included), ready to store.
+	Hash(ctx context.Context, password string) (string, error)
+
+	// Verify reports whether password matches hash. It returns
+	// ErrUnsupportedHash if hash is in a format it doesn't handle.
+	Verify(ctx context.Context, hash, password string) (bool, error)
+
+	// NeedsRehash reports whether hash should be replaced with a fresh
+	// Hash: it uses another algorithm or weaker parameters.
+	NeedsRehash(hash string) bool
+}
+
+// Argon2idParams are the Argon2id cost parameters.
+type Argon2idParams struct {
+	Memory      uint32 // KiB of memory per hash
+	Iterations  uint32 // Passes over the memory
+	Parallelism uint8  // Threads (lanes)
+}
+
+// Argon2id output sizes, in bytes.
+const (
+	argon2idSaltLen = 16
+	argon2idKeyLen  = 32
+)
+
+// argon2idHasher hashes with Argon2id.
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+// NewArgon2idHasher returns a PasswordHasher using Argon2id.
+//
+// WHY ARGON2ID?
+// bcrypt is CPU-hard: an attacker with GPUs or ASICs tries billions of
+// guesses cheaply, because each guess needs only a few KB of memory.
+// Argon2id is memory-hard: every guess needs Memory KiB, and memory is
+// what GPUs are short of. It won the Password Hashing Competition and is
+// the first choice in OWASP's password storage guidance.
+//
+// Hashes use the PHC string format, like every other Argon2 library:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+func NewArgon2idHasher(params Argon2idParams) PasswordHasher {
+	return &argon2idHasher{params: params}
+}
+
+// Hash implements PasswordHasher.
+func (h *argon2idHasher) Hash(ctx context.Context, password string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	salt := make([]byte, argon2idSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.params.Iterations, h.params.Memory, h.params.Parallelism, argon2idKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.params.Memory, h.params.Iterations, h.params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+// Verify implements PasswordHasher. It uses the parameters stored in the
+// hash, not the hasher's own, so hashes made before a change still verify.
+func (h *argon2idHasher) Verify(ctx context.Context, hash, password string) (bool, error) {
+	params, salt, key, err := parseArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+
+	// Constant time, so response times don't reveal how much matched.
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+// NeedsRehash implements PasswordHasher.
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	params, _, _, err := parseArgon2id(hash)
+	return err != nil || params != h.params
+}
+
+// parseArgon2id splits a PHC-format Argon2id hash into its parts.
+func parseArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	var params Argon2idParams
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Argon2idParams{}, nil, nil, ErrUnsupportedHash
+	}
+	return params, salt, key, nil
+}
+
+// bcryptHasher hashes with bcrypt.
+type bcryptHasher struct {
+	cost int
+}
+
+// NewBcryptHasher returns a PasswordHasher using bcrypt at the given cost.
+//
+// HOW BCRYPT WORKS:
+// 1. Generates a random salt (no need to store separately)
+// 2. Combines salt + password + cost factor
+// 3. Runs the expensive Blowfish cipher multiple times (2^cost)
+// 4. Returns a string containing: algorithm, cost, salt, and hash
+//
+// The result looks like: $2a$12$LQv3c1yqBw...
+// Where $2a$ = algorithm, $12$ = cost, rest = salt+hash
+func NewBcryptHasher(cost int) PasswordHasher {
+	return &bcryptHasher{cost: cost}
+}
+
+// Hash implements PasswordHasher.
+func (h *bcryptHasher) Hash(ctx context.Context, password string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
+// Verify implements PasswordHasher.
+// bcrypt.CompareHashAndPassword is constant-time to prevent timing attacks.
+func (h *bcryptHasher) Verify(ctx context.Context, hash, password string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return false, nil
+	default:
+		// Not a bcrypt hash: wrong prefix, too short, bad cost.
+		return false, ErrUnsupportedHash
+	}
+}
+
+// NeedsRehash implements PasswordHasher.
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.cost
+}
+
+// migratingHasher hashes with one algorithm and verifies with several.
+type migratingHasher struct {
+	current PasswordHasher
+	legacy  []PasswordHasher
+}
+
+// NewMigratingHasher returns a PasswordHasher that writes new hashes with
+// current and verifies hashes made by current or any of legacy.
+// NeedsRehash is true for every hash current didn't make (or made with
+// old parameters), so Service.Authenticate upgrades it at the next login.
+//
+// WHY REHASH ON LOGIN?
+// Login is the only time the plain-text password is available, so it's
+// the only time a hash can be upgraded. Active users move to the new
+// algorithm within days; dormant accounts keep their old hash until they
+// come back, which is why the legacy hashers stay configured.
+func NewMigratingHasher(current PasswordHasher, legacy ...PasswordHasher) PasswordHasher {
+	return &migratingHasher{current: current, legacy: legacy}
+}
+
+// Hash implements PasswordHasher.
+func (h *migratingHasher) Hash(ctx context.Context, password string) (string, error) {
+	return h.current.Hash(ctx, password)
+}
+
+// Verify implements PasswordHasher. Each hasher is asked in turn until
+// one recognizes the format.
+func (h *migratingHasher) Verify(ctx context.Context, hash, password string) (bool, error) {
+	for _, hasher := range append([]PasswordHasher{h.current}, h.legacy...) {
+		ok, err := hasher.Verify(ctx, hash, password)
+		if errors.Is(err, ErrUnsupportedHash) {
+			continue
+		}
+		return ok, err
+	}
+	return false, ErrUnsupportedHash
+}
+
+// NeedsRehash implements PasswordHasher.
+func (h *migratingHasher) NeedsRehash(hash string) bool {
+	return h.current.NeedsRehash(hash)
+}
+
+// boundedHasher limits how many hashes run at once.
+type boundedHasher struct {
+	inner PasswordHasher
+	slots chan struct{} // One token per running hash
+}
+
+// NewBoundedHasher returns a PasswordHasher that runs at most workers
+// Hash and Verify calls of inner at a time; the rest wait their turn.
+//
+// WHY BOUND IT?
+// A password hash is built to burn CPU (or memory): a bcrypt cost of 12
+// or a 19 MiB Argon2id pass takes tens of milliseconds of a whole core.
+// A burst of logins or registrations - or an attacker sending them on
+// purpose - would otherwise take every core, and unrelated requests
+// (reads, health checks) would time out behind them. With a bound, only
+// the password endpoints slow down.
+//
+// Waiting callers give up when their context ends: a client that
+// disconnected, or a request past its deadline (see http.Deadline),
+// leaves the queue instead of spending a slot on a hash nobody reads.
+func NewBoundedHasher(inner PasswordHasher, workers int) PasswordHasher {
+	return &boundedHasher{inner: inner, slots: make(chan struct{}, workers)}
+}
+
+// acquire waits for a free slot, or for ctx to end. Call the returned
+// func to release the slot.
+func (h *boundedHasher) acquire(ctx context.Context) (func(), error) {
+	select {
+	case h.slots <- struct{}{}:
+		return func() { <-h.slots }, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("waiting for a password hashing slot: %w", ctx.Err())
+	}
+}
+
+// Hash implements PasswordHasher.
+func (h *boundedHasher) Hash(ctx context.Context, password string) (string, error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return h.inner.Hash(ctx, password)
+}
+
+// Verify implements PasswordHasher.
+func (h *boundedHasher) Verify(ctx context.Context, hash, password string) (bool, error) {
+	release, err := h.acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer release()
+	return h.inner.Verify(ctx, hash, password)
+}
+
+// NeedsRehash implements PasswordHasher. It only parses the hash, so
+// it doesn't need a slot.
+func (h *boundedHasher) NeedsRehash(hash string) bool {
+	return h.inner.NeedsRehash(hash)
+}
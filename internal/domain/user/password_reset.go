@@ -0,0 +1,188 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-basics/internal/mail"
+)
+
+// secretTokenBytes is the amount of randomness in reset and refresh tokens.
+// 32 bytes (256 bits) can't be guessed, even with unlimited requests.
+const secretTokenBytes = 32
+
+// ResetTokenRepository stores password reset tokens.
+//
+// Only a SHA-256 hash of each token is stored. If the table leaks,
+// the hashes can't be used to reset anyone's password.
+type ResetTokenRepository interface {
+	// Create stores a token hash for the user.
+	Create(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time) error
+
+	// Consume marks the token as used and returns its user ID.
+	// It must be atomic: two concurrent calls with the same hash can't both
+	// succeed. Returns ErrInvalidResetToken if the token doesn't exist,
+	// has expired, or was already used.
+	Consume(ctx context.Context, tokenHash string) (uint64, error)
+
+	// DeleteForUser removes all of the user's tokens, used or not.
+	DeleteForUser(ctx context.Context, userID uint64) error
+}
+
+// PasswordReset implements the "forgot password" flow:
+//
+//  1. Request: the user submits their email. If it belongs to an account,
+//     we email them a link containing a random single-use token.
+//  2. Reset: the user submits the token and a new password. If the token
+//     is valid, the password is changed, the token is burned, and every
+//     device is signed out.
+type PasswordReset struct {
+	users    Repository
+	tokens   ResetTokenRepository
+	sessions SessionRepository // Revoked on reset
+	mailer   mail.Mailer
+	hasher   PasswordHasher
+	resetURL string          // Link sent to the user; the token is appended as ?token=
+	ttl      time.Duration   // How long a token stays valid
+	emails   EmailNormalizer // The Service's, so Request finds who signed up
+}
+
+// NewPasswordReset creates the password reset flow.
+func NewPasswordReset(users Repository, tokens ResetTokenRepository, sessions SessionRepository, mailer mail.Mailer, hasher PasswordHasher, resetURL string, ttl time.Duration, emails EmailNormalizer) *PasswordReset {
+	return &PasswordReset{
+		users:    users,
+		tokens:   tokens,
+		sessions: sessions,
+		mailer:   mailer,
+		hasher:   hasher,
+		resetURL: resetURL,
+		ttl:      ttl,
+		emails:   emails,
+	}
+}
+
+// Request emails a reset link if the address belongs to an account.
+//
+// SECURITY: Request returns nil for unknown emails too. Otherwise the
+// endpoint would tell attackers which addresses are registered.
+func (p *PasswordReset) Request(ctx context.Context, email string) error {
+	u, err := p.users.FindByEmail(ctx, p.emails.Normalize(email), WithFields(FieldID, FieldEmail, FieldPasswordHash))
+	if err != nil {
+		return fmt.Errorf("finding user by email: %w", err)
+	}
+	// An invited account gets its first password from its invitation
+	// only: otherwise revoking one wouldn't keep its invitee out.
+	if u == nil || u.PasswordHash == InvitedPasswordHash {
+		return nil
+	}
+
+	token, err := newSecretToken()
+	if err != nil {
+		return fmt.Errorf("generating reset token: %w", err)
+	}
+	if err := p.tokens.Create(ctx, u.ID, hashSecretToken(token), time.Now().Add(p.ttl)); err != nil {
+		return fmt.Errorf("storing reset token: %w", err)
+	}
+
+	msg, err := p.message(u.Email, token)
+	if err != nil {
+		return err
+	}
+	err = p.mailer.Send(ctx, msg)
+	if err != nil {
+		return fmt.Errorf("sending reset email: %w", err)
+	}
+	return nil
+}
+
+// message builds the reset email with the link for token.
+// EmailPreviews renders it too, so a preview is exactly what users get.
+func (p *PasswordReset) message(to, token string) (mail.Message, error) {
+	link, err := url.Parse(p.resetURL)
+	if err != nil {
+		return mail.Message{}, fmt.Errorf("parsing reset URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+
+	return mail.Message{
+		To:      to,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password for this account.\n\n"+
+			"To choose a new password, open this link within %s:\n\n%s\n\n"+
+			"If it wasn't you, ignore this email; your password won't change.\n",
+			p.ttl, link),
+	}, nil
+}
+
+// Reset sets a new password using a token from Request.
+// Returns ErrInvalidResetToken if the token is unknown, expired, or used.
+func (p *PasswordReset) Reset(ctx context.Context, token, newPassword string) error {
+	// Validate first so a weak password doesn't burn the token.
+	if err := validatePassword(newPassword); err != nil {
+		return err
+	}
+
+	userID, err := p.tokens.Consume(ctx, hashSecretToken(token))
+	if err != nil {
+		return err
+	}
+
+	u, err := p.users.FindByID(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("finding user by id: %w", err)
+	}
+	if u == nil {
+		// The account was deleted after the email was sent.
+		return ErrInvalidResetToken
+	}
+
+	u.PasswordHash, err = p.hasher.Hash(ctx, newPassword)
+	if err != nil {
+		return fmt.Errorf("hashing password: %w", err)
+	}
+	// Whoever made the reset necessary may be holding a token.
+	u.RevokeTokens()
+	if err := p.users.Update(ctx, u); err != nil {
+		return fmt.Errorf("updating password: %w", err)
+	}
+
+	// Any other outstanding links are now stale. Remove them so an old
+	// email can't be used to change the password again.
+	if err := p.tokens.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("deleting reset tokens: %w", err)
+	}
+	// Access tokens are revoked by the new token version; refresh tokens
+	// would mint new ones, so they go too.
+	if err := p.sessions.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("revoking sessions: %w", err)
+	}
+	return nil
+}
+
+// newSecretToken returns a random URL-safe token.
+func newSecretToken() (string, error) {
+	b := make([]byte, secretTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecretToken returns the hex SHA-256 of a token.
+//
+// WHY SHA-256 AND NOT A PASSWORD HASH?
+// Argon2id and bcrypt are slow on purpose because passwords are guessable.
+// A 256-bit random token isn't, so a fast hash is enough - and it lets us
+// look the token up by hash with an index.
+func hashSecretToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,85 @@
+package user
+
+import (
+	"context"
+	"fmt"
+)
+
+// Patch is a partial update of a user's profile. A nil field wasn't
+// sent and keeps its stored value; a non-nil one is written, even if
+// it's empty.
+//
+// WHY NOT UPDATE?
+// Repository.Update writes every column from a fully loaded User. A
+// caller that knows one field would have to load the rest first, and a
+// change to them landing between that read and the write would be
+// undone. A Patch is a field mask: the repository writes the columns it
+// sets, and no others.
+//
+// Email and password aren't here: they change through flows that check
+// the current password (and the new inbox) first, and a password is
+// never rehashed by a profile update.
+type Patch struct {
+	Username *string // "" removes it
+}
+
+// Fields returns the fields p sets.
+func (p Patch) Fields() []Field {
+	var fields []Field
+	if p.Username != nil {
+		fields = append(fields, FieldUsername)
+	}
+	return fields
+}
+
+// apply copies the fields p sets into u.
+func (p Patch) apply(u *User) {
+	if p.Username != nil {
+		u.Username = *p.Username
+	}
+}
+
+// Patch updates the fields p sets and returns the updated user. Fields
+// sent with the value already stored aren't written; with nothing left
+// to write, the user is returned as is.
+//
+// Returns ErrInvalidUsername or ErrUsernameReserved for a username that
+// can't be taken, and ErrUsernameTaken for another user's.
+func (s *Service) Patch(ctx context.Context, id uint64, p Patch) (*User, error) {
+	if p.Username != nil {
+		username := NormalizeUsername(*p.Username)
+		if username != "" {
+			if err := validateUsername(username); err != nil {
+				return nil, err
+			}
+		}
+		p.Username = &username
+	}
+
+	u, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Username != nil && *p.Username == u.Username {
+		p.Username = nil
+	}
+	if len(p.Fields()) == 0 {
+		return u, nil
+	}
+	// The unique key decides races; this only spares the write.
+	if p.Username != nil && *p.Username != "" {
+		existing, err := s.repo.FindByUsername(ctx, *p.Username, WithFields(FieldID))
+		if err != nil {
+			return nil, fmt.Errorf("checking username: %w", err)
+		}
+		if existing != nil {
+			return nil, ErrUsernameTaken
+		}
+	}
+
+	if err := s.repo.Patch(ctx, id, p); err != nil {
+		return nil, err
+	}
+	p.apply(u)
+	return u, nil
+}
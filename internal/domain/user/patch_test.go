@@ -0,0 +1,96 @@
+package user
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+// memoryUsers stores users in a map. It writes per field, like the
+// MySQL repository: Patch sets the fields named and leaves the rest.
+// Update fails the test: a partial update must never write every column.
+type memoryUsers struct {
+	Repository // Methods the tests don't reach panic
+	t          *testing.T
+	users      map[uint64]User
+	patches    []Patch
+}
+
+func (m *memoryUsers) FindByID(_ context.Context, id uint64, _ ...FindOption) (*User, error) {
+	u, ok := m.users[id]
+	if !ok {
+		return nil, nil
+	}
+	return &u, nil
+}
+
+func (m *memoryUsers) FindByUsername(_ context.Context, username string, _ ...FindOption) (*User, error) {
+	for _, u := range m.users {
+		if u.Username == username {
+			return &u, nil
+		}
+	}
+	return nil, nil
+}
+
+func (m *memoryUsers) Patch(_ context.Context, id uint64, p Patch) error {
+	m.patches = append(m.patches, p)
+	u := m.users[id]
+	p.apply(&u)
+	m.users[id] = u
+	return nil
+}
+
+func (m *memoryUsers) Update(context.Context, *User) error {
+	m.t.Error("Update called: a patch must write only the fields it sets")
+	return nil
+}
+
+// TestPatchKeepsOmittedFields patches one field and checks that every
+// other one keeps its stored value, the password hash included, and
+// that a patch sending nothing writes nothing.
+func TestPatchKeepsOmittedFields(t *testing.T) {
+	stored := User{
+		ID:           1,
+		Email:        "ann@example.com",
+		PasswordHash: "$2a$10$storedhashstoredhashstoredhashstoredhashstoredhash",
+		Username:     "ann",
+		AvatarURL:    "https://cdn.example.com/avatars/1.png",
+		Active:       true,
+		TokenVersion: 3,
+	}
+	repo := &memoryUsers{t: t, users: map[uint64]User{1: stored}}
+	s := NewService(repo, nil, nil, nil)
+
+	username := "  Ann.Smith "
+	got, err := s.Patch(context.Background(), 1, Patch{Username: &username})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := stored
+	want.Username = "ann.smith"
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("returned %+v, want %+v", *got, want)
+	}
+	if !reflect.DeepEqual(repo.users[1], want) {
+		t.Errorf("stored %+v, want %+v", repo.users[1], want)
+	}
+	if len(repo.patches) != 1 || !slices.Equal(repo.patches[0].Fields(), []Field{FieldUsername}) {
+		t.Fatalf("patches written = %+v, want one setting only the username", repo.patches)
+	}
+
+	// Nothing sent, and a field sent unchanged: nothing to write.
+	for _, p := range []Patch{{}, {Username: &want.Username}} {
+		got, err := s.Patch(context.Background(), 1, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("Patch(%+v) returned %+v, want %+v", p, *got, want)
+		}
+	}
+	if len(repo.patches) != 1 {
+		t.Errorf("patches written = %d, want still 1", len(repo.patches))
+	}
+}
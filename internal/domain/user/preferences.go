@@ -0,0 +1,214 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"time"
+
+	// Embedded so timezones validate the same on hosts without
+	// /usr/share/zoneinfo (e.g. scratch containers).
+	_ "time/tzdata"
+
+	"golang.org/x/text/language"
+)
+
+// Known preference values. The zero value of each string preference is
+// its default; Validate fills it in.
+const (
+	ThemeSystem = "system" // Follow the device's light or dark setting
+	ThemeLight  = "light"
+	ThemeDark   = "dark"
+
+	DensityComfortable = "comfortable"
+	DensityCompact     = "compact"
+)
+
+// Themes and Densities are the valid choices, defaults first.
+var (
+	Themes    = []string{ThemeSystem, ThemeLight, ThemeDark}
+	Densities = []string{DensityComfortable, DensityCompact}
+)
+
+// Limits on Preferences.Extras.
+const (
+	// MaxPreferenceExtras is how many extras a user may store.
+	MaxPreferenceExtras = 64
+
+	// MaxPreferenceExtrasSize caps the extras' encoded size, in bytes.
+	MaxPreferenceExtrasSize = 8 << 10
+)
+
+// extraKeyPattern is what an extra's key may look like: short, and safe
+// to show in an error's field ("extras.<key>").
+var extraKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Preferences are a user's settings for the clients they use: stored on
+// the server so they follow the user from device to device.
+//
+// WHY KNOWN KEYS AND EXTRAS?
+// The known keys are the ones every client shares (a dark theme on the
+// web should be dark on the phone too), so their values are checked: a
+// typo'd theme would otherwise be stored and quietly ignored by every
+// client. Extras are for whatever one client wants to remember (a
+// collapsed sidebar, a last-used filter) without a server release; the
+// server only bounds their size. A key that proves useful to every
+// client is promoted from the extras to a known key.
+type Preferences struct {
+	Theme    string // One of Themes
+	Language string // BCP 47 tag, e.g. "en-US"; "" lets the client decide
+	Timezone string // IANA name, e.g. "Europe/Berlin"; "" lets the client decide
+	Density  string // One of Densities
+
+	DesktopNotifications bool // Show browser notifications while the app is open
+	NotificationSound    bool // Play a sound with them
+
+	// Extras are free-form: any JSON value per key, up to
+	// MaxPreferenceExtras keys and MaxPreferenceExtrasSize bytes.
+	Extras map[string]json.RawMessage
+
+	UpdatedAt time.Time // Zero until the user first saves them
+}
+
+// DefaultPreferences returns the preferences of a user who never saved any.
+func DefaultPreferences() *Preferences {
+	return &Preferences{Theme: ThemeSystem, Density: DensityComfortable}
+}
+
+// Validate checks p and normalizes it: defaults for empty choices, the
+// canonical form of the language tag, and compacted extras. Errors are
+// *ValidationError, with the offending key as the field.
+func (p *Preferences) Validate() error {
+	if p.Theme == "" {
+		p.Theme = ThemeSystem
+	}
+	if !slices.Contains(Themes, p.Theme) {
+		return invalidPreference("theme", "must be one of %v", Themes)
+	}
+	if p.Density == "" {
+		p.Density = DensityComfortable
+	}
+	if !slices.Contains(Densities, p.Density) {
+		return invalidPreference("density", "must be one of %v", Densities)
+	}
+
+	if p.Language != "" {
+		tag, err := language.Parse(p.Language)
+		if err != nil {
+			return invalidPreference("language", "must be a BCP 47 language tag, e.g. en-US")
+		}
+		p.Language = tag.String()
+	}
+	if p.Timezone != "" {
+		// LoadLocation also takes "Local", which means the server's zone,
+		// not the user's.
+		if _, err := time.LoadLocation(p.Timezone); err != nil || p.Timezone == "Local" {
+			return invalidPreference("timezone", "must be an IANA time zone, e.g. Europe/Berlin")
+		}
+	}
+	return p.validateExtras()
+}
+
+// validateExtras checks the extras' keys and size, and compacts their
+// values so the size counts data, not whitespace.
+func (p *Preferences) validateExtras() error {
+	if len(p.Extras) > MaxPreferenceExtras {
+		return invalidExtras("extras", "at most %d keys are allowed", MaxPreferenceExtras)
+	}
+	size := 0
+	for key, value := range p.Extras {
+		if !extraKeyPattern.MatchString(key) {
+			return invalidExtras("extras", "key %q must be 1-64 letters, digits, '.', '_', or '-', starting with a letter or digit", key)
+		}
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, value); err != nil {
+			return invalidExtras("extras."+key, "must be a JSON value")
+		}
+		p.Extras[key] = buf.Bytes()
+		size += len(key) + buf.Len()
+	}
+	if size > MaxPreferenceExtrasSize {
+		return invalidExtras("extras", "must be at most %d bytes in total", MaxPreferenceExtrasSize)
+	}
+	return nil
+}
+
+// invalidPreference and invalidExtras build the ValidationErrors
+// Validate returns.
+func invalidPreference(field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Code: "preferences.invalid_value", Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidExtras(field, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Field: field, Code: "preferences.invalid_extras", Message: fmt.Sprintf(format, args...)}
+}
+
+// PreferenceRepository stores each user's preferences.
+type PreferenceRepository interface {
+	// Preferences returns the user's saved preferences, or nil if they
+	// never saved any.
+	Preferences(ctx context.Context, userID uint64) (*Preferences, error)
+
+	// SavePreferences inserts or replaces the user's preferences.
+	SavePreferences(ctx context.Context, userID uint64, p *Preferences) error
+}
+
+// PreferenceService reads and replaces users' preferences.
+type PreferenceService struct {
+	users Repository
+	prefs PreferenceRepository
+	now   func() time.Time
+}
+
+// NewPreferenceService creates the preference service.
+func NewPreferenceService(users Repository, prefs PreferenceRepository) *PreferenceService {
+	return &PreferenceService{users: users, prefs: prefs, now: time.Now}
+}
+
+// Get returns the user's preferences, or DefaultPreferences if they
+// never saved any.
+func (s *PreferenceService) Get(ctx context.Context, userID uint64) (*Preferences, error) {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	p, err := s.prefs.Preferences(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("loading preferences: %w", err)
+	}
+	if p == nil {
+		return DefaultPreferences(), nil
+	}
+	return p, nil
+}
+
+// Set validates p and makes it the user's preferences, replacing the
+// previous ones whole: a key left out goes back to its default, an
+// extra left out is removed. It returns the preferences as stored.
+func (s *PreferenceService) Set(ctx context.Context, userID uint64, p Preferences) (*Preferences, error) {
+	if err := s.checkUser(ctx, userID); err != nil {
+		return nil, err
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	p.UpdatedAt = s.now().UTC().Truncate(time.Second)
+	if err := s.prefs.SavePreferences(ctx, userID, &p); err != nil {
+		return nil, fmt.Errorf("saving preferences: %w", err)
+	}
+	return &p, nil
+}
+
+// checkUser returns ErrNotFound unless the user exists.
+func (s *PreferenceService) checkUser(ctx context.Context, userID uint64) error {
+	u, err := s.users.FindByID(ctx, userID, WithFields(FieldID))
+	if err != nil {
+		return fmt.Errorf("finding user: %w", err)
+	}
+	if u == nil {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RecoveryCodeCount is how many recovery codes an account gets at a time.
+const RecoveryCodeCount = 10
+
+// recoveryCodeAlphabet leaves out 0/o, 1/l/i, and the like: codes are
+// read off paper and typed by hand.
+const recoveryCodeAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// recoveryCodeLength is the number of characters in a code, shown in
+// groups of four ("k7mq-4xtd-9pwa"): about 59 bits of entropy.
+const recoveryCodeLength = 12
+
+// RecoveryCodeRepository stores hashes of accounts' 2FA recovery codes.
+//
+// Only a SHA-256 hash of each code is stored, like reset tokens (see
+// ResetTokenRepository). Codes aren't as long as tokens, so the user ID
+// is hashed in too: a leaked table can't be attacked with one
+// precomputed list for every account.
+type RecoveryCodeRepository interface {
+	// ReplaceRecoveryCodes makes hashes the user's only codes, all unused.
+	ReplaceRecoveryCodes(ctx context.Context, userID uint64, hashes []string) error
+
+	// UseRecoveryCode marks the user's unused code with hash as used and
+	// reports whether there was one. It must be atomic: two concurrent
+	// calls with the same hash can't both succeed.
+	UseRecoveryCode(ctx context.Context, userID uint64, hash string) (bool, error)
+
+	// RecoveryCodeStatus counts the user's unused and used codes.
+	RecoveryCodeStatus(ctx context.Context, userID uint64) (*RecoveryStatus, error)
+
+	// DeleteRecoveryCodes removes all of the user's codes.
+	DeleteRecoveryCodes(ctx context.Context, userID uint64) error
+}
+
+// RecoveryStatus is what's left of an account's recovery codes. The
+// codes themselves are only ever shown when they're generated.
+type RecoveryStatus struct {
+	Remaining int // Unused codes
+	Used      int // Codes used since they were generated
+}
+
+// ReenrollmentRequired reports whether the user signed in with a
+// recovery code since the codes were generated: they've likely lost
+// their authenticator, and should set 2FA up again (see
+// MFA.ResetAfterRecovery) or, if they found it, regenerate the codes.
+func (s *RecoveryStatus) ReenrollmentRequired() bool {
+	return s.Used > 0
+}
+
+// newRecoveryCodes generates RecoveryCodeCount codes for the user and
+// their hashes.
+func newRecoveryCodes(userID uint64) (codes, hashes []string, err error) {
+	codes = make([]string, RecoveryCodeCount)
+	hashes = make([]string, RecoveryCodeCount)
+	for i := range codes {
+		raw, err := randomRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12]
+		hashes[i] = hashRecoveryCode(userID, raw)
+	}
+	return codes, hashes, nil
+}
+
+// randomRecoveryCode returns recoveryCodeLength random characters of
+// recoveryCodeAlphabet.
+func randomRecoveryCode() (string, error) {
+	buf := make([]byte, recoveryCodeLength)
+	// Rejection sampling: bytes past the largest multiple of the
+	// alphabet's size are redrawn, so every character is equally likely.
+	limit := byte(256 - 256%len(recoveryCodeAlphabet))
+	var b [1]byte
+	for i := 0; i < len(buf); {
+		if _, err := rand.Read(b[:]); err != nil {
+			return "", fmt.Errorf("generating recovery code: %w", err)
+		}
+		if b[0] >= limit {
+			continue
+		}
+		buf[i] = recoveryCodeAlphabet[int(b[0])%len(recoveryCodeAlphabet)]
+		i++
+	}
+	return string(buf), nil
+}
+
+// hashRecoveryCode returns the hex SHA-256 of the user ID and the code
+// as typed, minus case, dashes, and spaces.
+func hashRecoveryCode(userID uint64, code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(strconv.FormatUint(userID, 10) + ":" + code))
+	return hex.EncodeToString(sum[:])
+}
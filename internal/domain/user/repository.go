@@ -4,8 +4,22 @@ import "context"
 
 type Repository interface {
 	Create(ctx context.Context, user *User) error
-	FindByID(ctx context.Context, id uint64) (*User, error)
-	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindByID(ctx context.Context, id uint64, opts ...FindOption) (*User, error)
+	FindByEmail(ctx context.Context, email string, opts ...FindOption) (*User, error)
+	// FindByUsername finds the user with a normalized username, or
+	// returns nil, like FindByEmail.
+	FindByUsername(ctx context.Context, username string, opts ...FindOption) (*User, error)
 	Update(ctx context.Context, user *User) error
 	Delete(ctx context.Context, id uint64) error
+	// SetActive deactivates or activates the user (see User.Active).
+	SetActive(ctx context.Context, id uint64, active bool) error
+	// Patch writes the fields p sets, and only those (see Patch).
+	// Returns ErrUsernameTaken if another user has the username.
+	Patch(ctx context.Context, id uint64, p Patch) error
+	// Anonymize scrubs the user's row, deleted or not (see Anonymization).
+	Anonymize(ctx context.Context, id uint64, email string) error
+	List(ctx context.Context, params ListParams) ([]*User, error)
+	Count(ctx context.Context, filter ListFilter) (int64, error)
+	Search(ctx context.Context, params SearchParams) ([]SearchHit, error)
+	SearchCount(ctx context.Context, params SearchParams) (int64, error)
 }
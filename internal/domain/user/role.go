@@ -0,0 +1,55 @@
+package user
+
+import (
+	"context"
+	"errors"
+)
+
+// Role is a named set of privileges granted to a user.
+//
+// RBAC (Role-Based Access Control):
+// Instead of checking "is this user allowed to do X?" for every user
+// individually, we group privileges into roles and give users roles.
+// Handlers then ask "does the caller have role admin?".
+type Role string
+
+// Built-in roles. These rows are seeded by the roles migration.
+const (
+	// RoleUser is given to every account at registration.
+	RoleUser Role = "user"
+
+	// RoleAdmin can manage other users and use admin endpoints.
+	RoleAdmin Role = "admin"
+)
+
+// ErrUnknownRole is returned when a role name doesn't exist.
+var ErrUnknownRole = errors.New("unknown role")
+
+// knownRoles lists every role that can be assigned.
+var knownRoles = map[Role]bool{
+	RoleUser:  true,
+	RoleAdmin: true,
+}
+
+// ParseRole converts a string into a known Role.
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if !knownRoles[role] {
+		return "", ErrUnknownRole
+	}
+	return role, nil
+}
+
+// RoleRepository stores which roles each user has.
+// It's separate from Repository because roles live in their own tables
+// (roles, user_roles) and most user lookups don't need them.
+type RoleRepository interface {
+	// RolesFor returns the roles assigned to a user (empty if none).
+	RolesFor(ctx context.Context, userID uint64) ([]Role, error)
+
+	// Assign gives a user a role. Assigning a role twice is a no-op.
+	Assign(ctx context.Context, userID uint64, role Role) error
+
+	// Revoke removes a role from a user. Revoking a missing role is a no-op.
+	Revoke(ctx context.Context, userID uint64, role Role) error
+}
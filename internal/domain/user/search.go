@@ -0,0 +1,168 @@
+package user
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Search limits.
+const (
+	// MaxSearchQueryLength caps ?q at the length of the longest email.
+	MaxSearchQueryLength = 255
+
+	// MaxSearchResults is how deep search results can be paged.
+	//
+	// WHY A CAP?
+	// Search pages by offset (see SearchCursor), and offsets get slower
+	// the deeper they go. Nobody reads the 1001st best match; someone
+	// who wants every user wants GET /users.
+	MaxSearchResults = 1000
+)
+
+// ErrInvalidSearch is returned for a search query that is empty, too
+// long, or has nothing to search for (only punctuation).
+var ErrInvalidSearch = errors.New("invalid search query")
+
+// SearchParams controls which page of search results the repository returns.
+type SearchParams struct {
+	// Query is what to look for in emails, already normalized by
+	// Service.Search: trimmed and lowercased.
+	Query string
+
+	// Limit is the maximum number of users to return.
+	Limit int
+
+	// Offset is how many of the best matches to skip.
+	Offset int
+}
+
+// Terms returns the words of the query: its runs of letters and digits.
+// "Ann.Smith@" gives ["ann", "smith"].
+//
+// Everything else is a separator, so the terms never carry a search
+// operator (+, -, *, quotes) into a FULLTEXT query.
+func (p SearchParams) Terms() []string {
+	return strings.FieldsFunc(p.Query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SearchHit is one search result: the user and how well they matched.
+// Scores only compare hits from the same query; higher is better.
+type SearchHit struct {
+	User  *User
+	Score float64
+}
+
+// SortHits orders hits best first, lowest ID first among equals: the
+// order the repository returns them in (e.g. to merge shards' results).
+func SortHits(hits []SearchHit) {
+	slices.SortFunc(hits, func(a, b SearchHit) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.User.ID, b.User.ID)
+	})
+}
+
+// SearchCursor is the position of the next page of search results.
+//
+// WHY AN OFFSET, WHEN LISTING USES KEYSETS?
+// A keyset needs a stable sort key, and relevance isn't one: every
+// signup changes how rare each word is, and so every score. Paging by
+// offset can repeat or skip a user when that happens, which is fine
+// for search, and MaxSearchResults keeps the offsets small.
+//
+// It's still opaque to clients, like Cursor, so it can change.
+type SearchCursor struct {
+	Offset int
+}
+
+// Encode returns an opaque, URL-safe representation of the cursor.
+func (c SearchCursor) Encode() string {
+	return base64.RawURLEncoding.EncodeToString([]byte("search:" + strconv.Itoa(c.Offset)))
+}
+
+// DecodeSearchCursor parses a cursor produced by SearchCursor.Encode.
+func DecodeSearchCursor(s string) (SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return SearchCursor{}, ErrInvalidCursor
+	}
+	offset, ok := strings.CutPrefix(string(raw), "search:")
+	if !ok {
+		return SearchCursor{}, ErrInvalidCursor
+	}
+	n, err := strconv.Atoi(offset)
+	if err != nil || n < 0 || n >= MaxSearchResults {
+		return SearchCursor{}, ErrInvalidCursor
+	}
+	return SearchCursor{Offset: n}, nil
+}
+
+// SearchPage is one page of search results, best match first.
+type SearchPage struct {
+	Users []*User
+
+	// Total is the number of users matching the query, not this page.
+	Total int64
+
+	// NextCursor is nil when there are no more results, or the next page
+	// would be past MaxSearchResults.
+	NextCursor *SearchCursor
+}
+
+// Search finds active users whose email matches query, best match
+// first, a page at a time. after is the previous page's NextCursor, or
+// nil for the first page.
+//
+// Matching is by word: "ann smith" finds ann.smith@example.com and
+// smith.ann@example.org, and a word matches as a prefix, so "ann" also
+// finds annabel@example.com. It isn't typo-tolerant: "anne" won't find
+// ann@example.com.
+func (s *Service) Search(ctx context.Context, query string, limit int, after *SearchCursor) (*SearchPage, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	if len(query) > MaxSearchQueryLength {
+		return nil, fmt.Errorf("%w: longer than %d characters", ErrInvalidSearch, MaxSearchQueryLength)
+	}
+	params := SearchParams{Query: query, Limit: normalizeLimit(limit)}
+	if len(params.Terms()) == 0 {
+		return nil, fmt.Errorf("%w: nothing to search for", ErrInvalidSearch)
+	}
+	if after != nil {
+		params.Offset = after.Offset
+	}
+	// Never page past the cap.
+	params.Limit = min(params.Limit, MaxSearchResults-params.Offset)
+
+	// One extra row says whether another page exists, as in List.
+	fetch := params
+	fetch.Limit++
+	hits, err := s.repo.Search(ctx, fetch)
+	if err != nil {
+		return nil, fmt.Errorf("searching users: %w", err)
+	}
+	total, err := s.repo.SearchCount(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("counting search results: %w", err)
+	}
+
+	page := &SearchPage{Users: make([]*User, 0, len(hits)), Total: total}
+	if len(hits) > params.Limit {
+		hits = hits[:params.Limit]
+		if next := params.Offset + params.Limit; next < MaxSearchResults {
+			page.NextCursor = &SearchCursor{Offset: next}
+		}
+	}
+	for _, hit := range hits {
+		page.Users = append(page.Users, hit.User)
+	}
+	return page, nil
+}
@@ -21,9 +21,9 @@ import (
 	"context"
 	"fmt"
 	"regexp"
-	"strings"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
+	"go-basics/internal/totp"
 )
 
 // Password constraints as constants.
@@ -34,13 +34,10 @@ const (
 	MinPasswordLength = 8
 
 	// MaxPasswordLength is the maximum allowed password length.
-	// bcrypt truncates at 72 bytes, so we enforce this limit.
+	// bcrypt truncates at 72 bytes, so we enforce this limit. Argon2id
+	// doesn't, but bcrypt hashes are still verified (see password.go)
+	// and may still be configured as the current algorithm.
 	MaxPasswordLength = 72
-
-	// bcryptCost determines how computationally expensive hashing is.
-	// Higher = more secure but slower. 10-12 is recommended for production.
-	// Each increment doubles the computation time.
-	bcryptCost = 12
 )
 
 // emailRegex is a simple regex for email validation.
@@ -58,14 +55,45 @@ var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]
 // 2. Flexibility - swap MySQL for PostgreSQL without changing this code
 // 3. Decoupling - service doesn't know or care about database details
 type Service struct {
-	repo Repository // Interface, not concrete type
+	repo   Repository     // Interface, not concrete type
+	roles  RoleRepository // Role assignments (RBAC)
+	hasher PasswordHasher // Password hashing (see password.go)
+
+	recovery RecoveryCodeRepository // 2FA recovery codes (see recovery.go)
+	emails   EmailNormalizer        // How emails are stored and looked up (see email.go)
+}
+
+// ServiceOption configures a Service.
+type ServiceOption func(*Service)
+
+// WithEmailNormalizer sets how emails are normalized. The default only
+// trims and lowercases.
+func WithEmailNormalizer(emails EmailNormalizer) ServiceOption {
+	return func(s *Service) { s.emails = emails }
 }
 
 // NewService creates a new user service.
 // This is a constructor function - a common Go pattern.
 // We pass dependencies as parameters (Dependency Injection).
-func NewService(repo Repository) *Service {
-	return &Service{repo: repo}
+func NewService(repo Repository, roles RoleRepository, hasher PasswordHasher, recovery RecoveryCodeRepository, opts ...ServiceOption) *Service {
+	s := &Service{repo: repo, roles: roles, hasher: hasher, recovery: recovery}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SecondFactor is what a login offers besides the password, for
+// accounts with two-factor authentication.
+type SecondFactor struct {
+	Code         string // Current code from the authenticator app
+	RecoveryCode string // Or one of the account's recovery codes
+}
+
+// UsesRecoveryCode reports whether the login relies on a recovery code:
+// one was given, and no app code.
+func (f SecondFactor) UsesRecoveryCode() bool {
+	return f.Code == "" && f.RecoveryCode != ""
 }
 
 // Create registers a new user in the system.
@@ -75,51 +103,65 @@ func NewService(repo Repository) *Service {
 //   - ctx: Context for cancellation and deadlines
 //   - email: The user's email address
 //   - password: The plain-text password (will be hashed)
+//   - username: An optional username (see NormalizeUsername); "" for none
 //
 // Returns:
 //   - The created user (with ID populated)
-//   - An error if validation fails or email exists
-func (s *Service) Create(ctx context.Context, email, password string) (*User, error) {
-	// Step 1: Validate input
+//   - An error if validation fails or the email or username exists
+func (s *Service) Create(ctx context.Context, email, password, username string) (*User, error) {
+	// Step 1: Normalize and validate input
 	// Always validate at the service layer, even if the handler validates too.
 	// This ensures business rules are enforced regardless of how the service is called.
+	email = s.emails.Normalize(email)
 	if err := validateEmail(email); err != nil {
 		return nil, err
 	}
 	if err := validatePassword(password); err != nil {
 		return nil, err
 	}
-
-	// Step 2: Check if email already exists
-	// We do this BEFORE hashing to avoid wasting CPU on duplicate requests.
-	existing, err := s.repo.FindByEmail(ctx, email)
-	if err != nil {
-		// Wrap errors with context using fmt.Errorf and %w.
-		// This preserves the original error while adding context.
-		return nil, fmt.Errorf("checking email existence: %w", err)
-	}
-	if existing != nil {
-		return nil, ErrEmailExists
+	username = NormalizeUsername(username)
+	if username != "" {
+		if err := validateUsername(username); err != nil {
+			return nil, err
+		}
 	}
 
-	// Step 3: Hash the password
+	// Step 2: Hash the password
+	//
+	// WHY NO "DOES THE EMAIL EXIST?" CHECK FIRST?
+	// Two signups for the same address can both pass such a check before
+	// either inserts. Only the database's unique keys see every insert,
+	// so the repository turns their refusal into ErrEmailExists or
+	// ErrUsernameTaken, and that's the one check. The price is a hash
+	// computed for a signup that then fails; duplicates are rare, and
+	// answering them as slowly as new addresses leaks less about which
+	// addresses have accounts.
 	// NEVER store plain-text passwords! Always hash them.
-	hashedPassword, err := hashPassword(password)
+	hashedPassword, err := s.hasher.Hash(ctx, password)
 	if err != nil {
 		return nil, fmt.Errorf("hashing password: %w", err)
 	}
 
-	// Step 4: Create the user entity
+	// Step 3: Create the user entity
 	user := &User{
-		Email:        strings.ToLower(email), // Normalize email to lowercase
+		Email:        email,
+		Username:     username,
 		PasswordHash: hashedPassword,
 	}
 
-	// Step 5: Persist to database
+	// Step 4: Persist to database
+	// Wrap errors with context using fmt.Errorf and %w. This preserves
+	// the original error (ErrEmailExists, say) while adding context.
 	if err := s.repo.Create(ctx, user); err != nil {
 		return nil, fmt.Errorf("creating user: %w", err)
 	}
 
+	// Step 5: Give every new account the default role
+	if err := s.roles.Assign(ctx, user.ID, RoleUser); err != nil {
+		return nil, fmt.Errorf("assigning default role: %w", err)
+	}
+	user.Roles = []Role{RoleUser}
+
 	return user, nil
 }
 
@@ -138,10 +180,23 @@ func (s *Service) GetByID(ctx context.Context, id uint64) (*User, error) {
 	return user, nil
 }
 
-// Update modifies an existing user's information.
-// Currently supports email and password updates.
-func (s *Service) Update(ctx context.Context, id uint64, email, password string) (*User, error) {
-	// Step 1: Verify user exists
+// ChangePassword replaces a user's password after checking the current one.
+//
+// WHY ASK FOR THE CURRENT PASSWORD?
+// The caller already has a valid access token, but a token can be stolen
+// (an unlocked laptop, a leaked log line). Without this check, whoever
+// holds the token could lock the owner out for good. Asking for the
+// password turns "I have your token" back into "I know your password".
+//
+// Every access token issued before the change stops working (see
+// User.RevokeTokens); the returned user has the new token version to
+// issue the caller a fresh one. Refresh tokens are separate: the caller
+// revokes the sessions (see Sessions.RevokeAll).
+func (s *Service) ChangePassword(ctx context.Context, id uint64, current, newPassword string) (*User, error) {
+	if err := validatePassword(newPassword); err != nil {
+		return nil, err
+	}
+
 	user, err := s.repo.FindByID(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("finding user: %w", err)
@@ -150,47 +205,90 @@ func (s *Service) Update(ctx context.Context, id uint64, email, password string)
 		return nil, ErrNotFound
 	}
 
-	// Step 2: Validate and update email if provided
-	if email != "" && email != user.Email {
-		if err := validateEmail(email); err != nil {
-			return nil, err
-		}
-		// Check if new email is taken by another user
-		existing, err := s.repo.FindByEmail(ctx, email)
-		if err != nil {
-			return nil, fmt.Errorf("checking email: %w", err)
-		}
-		if existing != nil && existing.ID != id {
-			return nil, ErrEmailExists
-		}
-		user.Email = strings.ToLower(email)
+	ok, err := s.hasher.Verify(ctx, user.PasswordHash, current)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("verifying password: %w", err)
 	}
-
-	// Step 3: Validate and update password if provided
-	if password != "" {
-		if err := validatePassword(password); err != nil {
-			return nil, err
-		}
-		hashedPassword, err := hashPassword(password)
-		if err != nil {
-			return nil, fmt.Errorf("hashing password: %w", err)
-		}
-		user.PasswordHash = hashedPassword
+	if err != nil || !ok {
+		return nil, ErrIncorrectPassword
 	}
 
-	// Step 4: Persist changes
+	user.PasswordHash, err = s.hasher.Hash(ctx, newPassword)
+	if err != nil {
+		return nil, fmt.Errorf("hashing password: %w", err)
+	}
+	user.RevokeTokens()
 	if err := s.repo.Update(ctx, user); err != nil {
-		return nil, fmt.Errorf("updating user: %w", err)
+		return nil, fmt.Errorf("updating password: %w", err)
 	}
-
 	return user, nil
 }
 
+// TokenVersion returns the user's current token version, for checking
+// access tokens (see auth.VersionCache). It returns ErrNotFound for a
+// deleted user, whose tokens are then rejected too, and
+// ErrAccountDeactivated for a deactivated one.
+func (s *Service) TokenVersion(ctx context.Context, id uint64) (uint64, error) {
+	user, err := s.repo.FindByID(ctx, id, WithFields(FieldTokenVersion, FieldActive))
+	if err != nil {
+		return 0, fmt.Errorf("finding user: %w", err)
+	}
+	if user == nil {
+		return 0, ErrNotFound
+	}
+	if !user.Active {
+		return 0, ErrAccountDeactivated
+	}
+	return user.TokenVersion, nil
+}
+
+// Deactivate suspends the user's account on behalf of the admin actorID:
+// it can't sign in, refresh its sessions, or use its access tokens until
+// Activate. Deactivating a deactivated account does nothing.
+//
+// WHY NOT DELETE?
+// A soft-deleted account is gone as far as the app is concerned: it
+// isn't found, its email can be registered again, and there's no way
+// back through the API. A suspension (a chargeback, an investigation,
+// an employee on leave) needs the opposite: everything kept and findable,
+// only the door shut, and a way to open it again. Nothing is revoked
+// either: sessions not tried in the meantime work again once it's
+// activated.
+func (s *Service) Deactivate(ctx context.Context, id, actorID uint64) error {
+	if id == actorID {
+		return ErrDeactivateSelf
+	}
+	return s.setActive(ctx, id, false)
+}
+
+// Activate undoes Deactivate. Activating an active account does nothing.
+func (s *Service) Activate(ctx context.Context, id uint64) error {
+	return s.setActive(ctx, id, true)
+}
+
+// setActive deactivates or activates the user, unless they already are.
+func (s *Service) setActive(ctx context.Context, id uint64, active bool) error {
+	user, err := s.repo.FindByID(ctx, id, WithFields(FieldID, FieldActive))
+	if err != nil {
+		return fmt.Errorf("finding user: %w", err)
+	}
+	if user == nil {
+		return ErrNotFound
+	}
+	if user.Active == active {
+		return nil
+	}
+	if err := s.repo.SetActive(ctx, id, active); err != nil {
+		return fmt.Errorf("setting active: %w", err)
+	}
+	return nil
+}
+
 // Delete removes a user from the system.
 // Uses soft delete - sets deleted_at instead of removing the row.
 func (s *Service) Delete(ctx context.Context, id uint64) error {
 	// Verify user exists before deleting
-	user, err := s.repo.FindByID(ctx, id)
+	user, err := s.repo.FindByID(ctx, id, WithFields(FieldID))
 	if err != nil {
 		return fmt.Errorf("finding user: %w", err)
 	}
@@ -204,16 +302,61 @@ func (s *Service) Delete(ctx context.Context, id uint64) error {
 	return nil
 }
 
+// List returns one page of the users matching params.Filter, ordered by
+// params.Sort (signup order by default).
+// Pass the previous page's NextCursor in params.After to get the next
+// page, with the same sort; the filter may change between pages.
+func (s *Service) List(ctx context.Context, params ListParams) (*Page, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	limit := normalizeLimit(params.Limit)
+
+	// Ask for one extra row so we know whether another page exists
+	// without running a separate COUNT query.
+	query := params
+	query.Limit = limit + 1
+	users, err := s.repo.List(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("listing users: %w", err)
+	}
+
+	// The total is a separate query, though: clients want "page 3 of 12".
+	total, err := s.repo.Count(ctx, params.Filter)
+	if err != nil {
+		return nil, fmt.Errorf("counting users: %w", err)
+	}
+
+	page := &Page{Users: users, Total: total}
+	if len(users) > limit {
+		page.Users = users[:limit]
+		next := CursorFor(page.Users[limit-1], params)
+		page.NextCursor = &next
+	}
+	return page, nil
+}
+
 // Authenticate verifies user credentials and returns the user if valid.
 // This is used for login functionality.
 //
+// factor is ignored for accounts without two-factor authentication; for
+// accounts with it, an empty factor returns ErrMFARequired. A recovery
+// code is used up by a successful check.
+//
 // SECURITY NOTES:
 // - We return the same error for "user not found" and "wrong password"
 //   to prevent attackers from discovering valid emails.
-// - We use constant-time comparison (bcrypt does this internally).
-func (s *Service) Authenticate(ctx context.Context, email, password string) (*User, error) {
-	// Find user by email
-	user, err := s.repo.FindByEmail(ctx, strings.ToLower(email))
+// - login is an email or a username (see FindByLogin).
+// - We use constant-time comparison (every PasswordHasher must).
+// - The code is only checked AFTER the password, so ErrMFARequired never
+//   reveals anything to someone who doesn't know the password.
+func (s *Service) Authenticate(ctx context.Context, login, password string, factor SecondFactor) (*User, error) {
+	// Find user by email or username.
+	// Login only needs these columns, so we don't load the rest.
+	// (pending_email is only here for rehash: Update writes it back.
+	// username and email_verified_at are for the login response.)
+	user, err := FindByLogin(ctx, s.repo, s.emails, login,
+		WithFields(FieldID, FieldEmail, FieldUsername, FieldPendingEmail, FieldEmailVerified, FieldActive, FieldPasswordHash, FieldTokenVersion, FieldMFASecret, FieldMFAEnabled))
 	if err != nil {
 		return nil, fmt.Errorf("finding user: %w", err)
 	}
@@ -222,21 +365,114 @@ func (s *Service) Authenticate(ctx context.Context, email, password string) (*Us
 		return nil, ErrInvalidCredentials
 	}
 
-	// Compare password with hash
-	// bcrypt.CompareHashAndPassword is constant-time to prevent timing attacks.
-	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password))
-	if err != nil {
+	// Compare password with hash.
+	// A hash in an unknown format (e.g. the probe canary's) never matches.
+	ok, err := s.hasher.Verify(ctx, user.PasswordHash, password)
+	if err != nil && ctx.Err() != nil {
+		// The client left, or the request ran out of time, before the
+		// password was checked: not a failed login, and not counted as one.
+		return nil, fmt.Errorf("verifying password: %w", err)
+	}
+	if err != nil || !ok {
 		// Wrong password - return same generic error
 		return nil, ErrInvalidCredentials
 	}
 
+	// Like a dormancy-disabled account (see Sessions.Start), a
+	// deactivated one is only revealed to someone who knows the password.
+	if !user.Active {
+		return nil, ErrAccountDeactivated
+	}
+
+	// Second factor
+	if user.MFAEnabled {
+		if err := s.checkSecondFactor(ctx, user, factor); err != nil {
+			return nil, err
+		}
+	}
+
+	// Upgrade an old hash (bcrypt, or weaker parameters) while we have
+	// the plain-text password. Only after MFA, so a stolen password
+	// alone can't even change the stored hash.
+	if s.hasher.NeedsRehash(user.PasswordHash) {
+		s.rehash(ctx, user, password)
+	}
+
+	// Load roles so they can be embedded in the token
+	user.Roles, err = s.roles.RolesFor(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("loading roles: %w", err)
+	}
+
 	return user, nil
 }
 
+// checkSecondFactor checks an app code, or uses up a recovery code.
+func (s *Service) checkSecondFactor(ctx context.Context, user *User, factor SecondFactor) error {
+	switch {
+	case factor.Code != "":
+		if !totp.Validate(user.MFASecret, factor.Code, time.Now()) {
+			return ErrInvalidMFACode
+		}
+		return nil
+	case factor.RecoveryCode != "":
+		if s.recovery == nil {
+			return ErrInvalidRecoveryCode
+		}
+		// Marking the code used is the check: the UPDATE only matches
+		// an unused code, so a code can't sign in twice, even at once.
+		ok, err := s.recovery.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(user.ID, factor.RecoveryCode))
+		if err != nil {
+			return fmt.Errorf("using recovery code: %w", err)
+		}
+		if !ok {
+			return ErrInvalidRecoveryCode
+		}
+		return nil
+	default:
+		return ErrMFARequired
+	}
+}
+
+// Roles returns the roles assigned to a user.
+func (s *Service) Roles(ctx context.Context, id uint64) ([]Role, error) {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	roles, err := s.roles.RolesFor(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("loading roles: %w", err)
+	}
+	return roles, nil
+}
+
+// AssignRole gives a user a role.
+// Changes take effect at the user's next login, when a new token is issued.
+func (s *Service) AssignRole(ctx context.Context, id uint64, role Role) error {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return err
+	}
+	if err := s.roles.Assign(ctx, id, role); err != nil {
+		return fmt.Errorf("assigning role: %w", err)
+	}
+	return nil
+}
+
+// RevokeRole removes a role from a user.
+func (s *Service) RevokeRole(ctx context.Context, id uint64, role Role) error {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return err
+	}
+	if err := s.roles.Revoke(ctx, id, role); err != nil {
+		return fmt.Errorf("revoking role: %w", err)
+	}
+	return nil
+}
+
 // validateEmail checks if the email format is valid.
 func validateEmail(email string) error {
 	if email == "" {
-		return &ValidationError{Field: "email", Message: "email is required"}
+		return &ValidationError{Field: "email", Code: "email.required", Message: "email is required"}
 	}
 	if !emailRegex.MatchString(email) {
 		return ErrInvalidEmail
@@ -247,7 +483,7 @@ func validateEmail(email string) error {
 // validatePassword checks if the password meets requirements.
 func validatePassword(password string) error {
 	if password == "" {
-		return &ValidationError{Field: "password", Message: "password is required"}
+		return &ValidationError{Field: "password", Code: "password.required", Message: "password is required"}
 	}
 	if len(password) < MinPasswordLength {
 		return ErrPasswordTooShort
@@ -258,20 +494,19 @@ func validatePassword(password string) error {
 	return nil
 }
 
-// hashPassword creates a bcrypt hash of the password.
+// rehash replaces user's stored hash with a fresh one.
 //
-// HOW BCRYPT WORKS:
-// 1. Generates a random salt (no need to store separately)
-// 2. Combines salt + password + cost factor
-// 3. Runs the expensive Blowfish cipher multiple times (2^cost)
-// 4. Returns a string containing: algorithm, cost, salt, and hash
-//
-// The result looks like: $2a$12$LQv3c1yqBw...
-// Where $2a$ = algorithm, $12$ = cost, rest = salt+hash
-func hashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+// Failures are ignored on purpose: the user has proven their password
+// and should be logged in. The old hash still works, and the upgrade
+// is simply tried again at the next login.
+func (s *Service) rehash(ctx context.Context, user *User, password string) {
+	hash, err := s.hasher.Hash(ctx, password)
 	if err != nil {
-		return "", err
+		return
+	}
+	old := user.PasswordHash
+	user.PasswordHash = hash
+	if err := s.repo.Update(ctx, user); err != nil {
+		user.PasswordHash = old
 	}
-	return string(bytes), nil
 }
@@ -0,0 +1,270 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// maxUserAgentLength matches the user_agent column size.
+const maxUserAgentLength = 255
+
+// Session is one signed-in device: a refresh token plus where it's used.
+//
+// ACCESS TOKENS vs REFRESH TOKENS:
+// Access tokens (JWTs) are short-lived and checked without a database
+// lookup, so they can't be revoked - they just expire. A refresh token is
+// long-lived and stored server-side, so deleting its row signs the device
+// out: the next refresh fails and the user has to log in again.
+type Session struct {
+	ID            uint64
+	UserID        uint64
+	UserAgent     string // Browser or app that signed in
+	IPAddress     string // Address of the most recent login or refresh
+	KeyThumbprint string // DPoP key the refresh token is bound to; "" if none
+	CreatedAt     time.Time
+	LastUsedAt    time.Time
+	ExpiresAt     time.Time
+}
+
+// Device describes the client a session belongs to.
+type Device struct {
+	UserAgent string
+	IPAddress string
+
+	// KeyThumbprint is the DPoP key the client proved it holds (see
+	// auth.DPoPVerifier), "" if it sent no proof. A session started with
+	// one only refreshes with a proof from the same key, so a stolen
+	// refresh token is as useless as a stolen access token.
+	KeyThumbprint string
+}
+
+// SessionRepository stores sessions.
+//
+// Like reset tokens, only a SHA-256 hash of each refresh token is stored,
+// so a leaked table can't be used to sign in.
+type SessionRepository interface {
+	// Create stores a new session and sets its ID and timestamps.
+	Create(ctx context.Context, session *Session, tokenHash string) error
+
+	// Rotate replaces the session's token hash, records the device, and
+	// extends its expiry to expiresAt, but never past maxLifetime after
+	// the session was created (0: no limit). It must be atomic: of two
+	// concurrent calls with the same old hash, only one can succeed.
+	// Returns ErrInvalidRefreshToken if no unexpired session has oldHash,
+	// or the session is bound to another DPoP key than the device's.
+	Rotate(ctx context.Context, oldHash, newHash string, device Device, expiresAt time.Time, maxLifetime time.Duration) (*Session, error)
+
+	// ListForUser returns the user's unexpired sessions, most recently used first.
+	ListForUser(ctx context.Context, userID uint64) ([]*Session, error)
+
+	// Delete removes one of the user's sessions.
+	// Returns ErrSessionNotFound if the user has no session with that ID.
+	Delete(ctx context.Context, userID, id uint64) error
+
+	// DeleteForUser removes all of the user's sessions.
+	DeleteForUser(ctx context.Context, userID uint64) error
+}
+
+// Sessions issues, rotates, and revokes refresh tokens.
+type Sessions struct {
+	repo        SessionRepository
+	users       Repository
+	roles       RoleRepository
+	ttl         time.Duration          // How long a session lasts without being used
+	maxLifetime time.Duration          // How long a session lasts however it's used; 0 for no limit
+	activity    ActivityRepository     // Records logins; nil if not tracked
+	history     LoginHistoryRepository // Lists logins; nil if not kept
+}
+
+// SessionOption configures Sessions.
+type SessionOption func(*Sessions)
+
+// WithActivity records every login and refresh in activity, for the
+// dormancy report, and refuses to start sessions for accounts the
+// dormancy policy disabled.
+//
+// Every way of signing in (password, SSO, a password change) ends in
+// Start, so this is the one place that sees them all.
+func WithActivity(activity ActivityRepository) SessionOption {
+	return func(s *Sessions) { s.activity = activity }
+}
+
+// WithMaxLifetime caps how long a session lasts, however actively it's
+// used: each refresh still extends it, but never past maxLifetime after
+// the login, when the user has to sign in again.
+//
+// WHY A CAP?
+// Sliding expiry keeps a device that's used daily signed in forever,
+// and a stolen refresh token that's used daily as well. A cap bounds
+// that, at the cost of a login every maxLifetime. A cap equal to the
+// session TTL turns sliding off: sessions end a fixed time after login.
+func WithMaxLifetime(maxLifetime time.Duration) SessionOption {
+	return func(s *Sessions) { s.maxLifetime = maxLifetime }
+}
+
+// NewSessions creates the session service.
+func NewSessions(repo SessionRepository, users Repository, roles RoleRepository, ttl time.Duration, opts ...SessionOption) *Sessions {
+	s := &Sessions{repo: repo, users: users, roles: roles, ttl: ttl}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Start opens a session for a user who just logged in and returns its
+// refresh token. The token is only ever returned here and by Refresh.
+//
+// Returns ErrAccountDisabled for an account disabled for dormancy. The
+// check is here, after the password, so only someone who knows it learns
+// the account is disabled.
+func (s *Sessions) Start(ctx context.Context, userID uint64, device Device) (string, error) {
+	if err := s.touch(ctx, userID, device.IPAddress); err != nil {
+		return "", err
+	}
+	if err := s.recordLogin(ctx, userID, device); err != nil {
+		return "", err
+	}
+	token, err := newSecretToken()
+	if err != nil {
+		return "", fmt.Errorf("generating refresh token: %w", err)
+	}
+
+	session := &Session{
+		UserID:        userID,
+		UserAgent:     truncate(device.UserAgent, maxUserAgentLength),
+		IPAddress:     device.IPAddress,
+		KeyThumbprint: device.KeyThumbprint,
+		ExpiresAt:     time.Now().Add(s.initialTTL()),
+	}
+	if err := s.repo.Create(ctx, session, hashSecretToken(token)); err != nil {
+		return "", fmt.Errorf("storing session: %w", err)
+	}
+	return token, nil
+}
+
+// Refresh exchanges a refresh token for a new one and returns the user
+// (with roles loaded, ready for a new access token).
+//
+// WHY ROTATE?
+// Each refresh token works once. If one is stolen and used, the real
+// device's next refresh fails, the user logs in again, and the stolen
+// copy is already worthless. Every refresh also pushes the expiry out,
+// so active devices stay signed in and idle ones fall off, up to the
+// session's maximum lifetime (see WithMaxLifetime).
+func (s *Sessions) Refresh(ctx context.Context, token string, device Device) (*User, string, error) {
+	newToken, err := newSecretToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("generating refresh token: %w", err)
+	}
+
+	device.UserAgent = truncate(device.UserAgent, maxUserAgentLength)
+	session, err := s.repo.Rotate(ctx, hashSecretToken(token), hashSecretToken(newToken), device, time.Now().Add(s.ttl), s.maxLifetime)
+	if err != nil {
+		return nil, "", err
+	}
+
+	u, err := s.users.FindByID(ctx, session.UserID, WithFields(FieldID, FieldEmail, FieldActive, FieldTokenVersion))
+	if err != nil {
+		return nil, "", fmt.Errorf("finding user by id: %w", err)
+	}
+	if u == nil {
+		// The account was deleted while the device was signed in.
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if !u.Active {
+		return nil, "", ErrAccountDeactivated
+	}
+	// A device refreshing is the account in use, as much as a login.
+	if err := s.touch(ctx, u.ID, device.IPAddress); err != nil {
+		return nil, "", err
+	}
+	u.Roles, err = s.roles.RolesFor(ctx, u.ID)
+	if err != nil {
+		return nil, "", fmt.Errorf("loading roles: %w", err)
+	}
+	return u, newToken, nil
+}
+
+// initialTTL is how long a new session lasts: the TTL, or the maximum
+// lifetime if that's shorter.
+func (s *Sessions) initialTTL() time.Duration {
+	if s.maxLifetime > 0 {
+		return min(s.ttl, s.maxLifetime)
+	}
+	return s.ttl
+}
+
+// List returns the user's active sessions.
+func (s *Sessions) List(ctx context.Context, userID uint64) ([]*Session, error) {
+	sessions, err := s.repo.ListForUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("listing sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// KnownDevice reports whether one of the user's active sessions is from
+// userAgent. An empty user agent is never known: every script sends it.
+func (s *Sessions) KnownDevice(ctx context.Context, userID uint64, userAgent string) (bool, error) {
+	if userAgent == "" {
+		return false, nil
+	}
+	sessions, err := s.List(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	userAgent = truncate(userAgent, maxUserAgentLength)
+	for _, session := range sessions {
+		if session.UserAgent == userAgent {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Revoke signs one of the user's devices out.
+// Access tokens already issued to it stay valid until they expire.
+func (s *Sessions) Revoke(ctx context.Context, userID, id uint64) error {
+	return s.repo.Delete(ctx, userID, id)
+}
+
+// RevokeAll signs every one of the user's devices out, e.g. after a
+// password change. Like Revoke, it leaves issued access tokens alone.
+func (s *Sessions) RevokeAll(ctx context.Context, userID uint64) error {
+	if err := s.repo.DeleteForUser(ctx, userID); err != nil {
+		return fmt.Errorf("deleting sessions: %w", err)
+	}
+	return nil
+}
+
+// touch records the account as in use from ip, or returns
+// ErrAccountDisabled.
+func (s *Sessions) touch(ctx context.Context, userID uint64, ip string) error {
+	if s.activity == nil {
+		return nil
+	}
+	a, err := s.activity.Find(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("checking activity: %w", err)
+	}
+	if a != nil && a.Disabled() {
+		return ErrAccountDisabled
+	}
+	if err := s.activity.Touch(ctx, userID, time.Now().UTC(), ip); err != nil {
+		return fmt.Errorf("recording activity: %w", err)
+	}
+	return nil
+}
+
+// truncate shortens s to at most n bytes without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
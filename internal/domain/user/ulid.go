@@ -0,0 +1,46 @@
+package user
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// crockford is Crockford's base 32 alphabet: digits and capitals,
+// without I, L, O, and U, so an ID read aloud or retyped can't be
+// mistaken for another.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID (https://github.com/ulid/spec) for t: 26
+// characters encoding a 48-bit millisecond timestamp, then 80 random
+// bits.
+//
+// WHY ULID AND NOT A UUID?
+// Both are unique without asking the database. A ULID also sorts by
+// creation time as a plain string, so an index on it grows at the end
+// like the AUTO_INCREMENT one instead of splitting pages at random, and
+// it's shorter in URLs.
+//
+// IDs from the same millisecond are in random order: the spec's
+// "monotonic" mode would need shared state across instances, and
+// nothing here relies on ordering within a millisecond.
+func NewULID(t time.Time) (string, error) {
+	var id [16]byte
+	binary.BigEndian.PutUint16(id[0:2], uint16(t.UnixMilli()>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(t.UnixMilli()))
+	if _, err := rand.Read(id[6:]); err != nil {
+		return "", err
+	}
+
+	// 128 bits in 26 characters of 5 bits: the first character carries
+	// only the top 3 bits, so read the ID as a 130-bit number.
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
@@ -0,0 +1,71 @@
+package user
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// Username length limits. MaxUsernameLength matches the username column.
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 30
+)
+
+// usernameRegex is what a normalized username looks like: a letter,
+// then letters, digits, underscores, and dots, no two dots in a row and
+// none at the end.
+//
+// WHY SO STRICT?
+// A username shows up in URLs, mentions, and support tickets, where
+// "Ann", "ann", and "аnn" (with a Cyrillic а) must not be three people.
+// ASCII only, stored lowercase, rules out lookalikes. And no "@": a
+// login with one is an email, one without is a username (see
+// FindByLogin), so they can never be mistaken for each other.
+var usernameRegex = regexp.MustCompile(`^[a-z][a-z0-9_]*(\.[a-z0-9_]+)*$`)
+
+// reservedUsernames can't be taken: names that would look official,
+// or collide with routes and system accounts if usernames ever appear
+// in URLs.
+var reservedUsernames = map[string]bool{
+	"abuse": true, "admin": true, "administrator": true, "anonymous": true,
+	"api": true, "billing": true, "help": true, "info": true,
+	"login": true, "logout": true, "me": true, "moderator": true,
+	"mod": true, "noreply": true, "no_reply": true, "null": true,
+	"official": true, "owner": true, "postmaster": true, "register": true,
+	"root": true, "security": true, "settings": true, "signup": true,
+	"staff": true, "support": true, "sysadmin": true, "system": true,
+	"undefined": true, "user": true, "users": true, "webmaster": true,
+	"www": true,
+}
+
+// NormalizeUsername trims and lowercases a username, the form it's
+// stored, compared, and looked up in.
+func NormalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// validateUsername checks a normalized username.
+func validateUsername(username string) error {
+	if len(username) < MinUsernameLength || len(username) > MaxUsernameLength || !usernameRegex.MatchString(username) {
+		return ErrInvalidUsername
+	}
+	if reservedUsernames[username] {
+		return ErrUsernameReserved
+	}
+	return nil
+}
+
+// FindByLogin finds the user signing in with login: an email if it has
+// an "@", normalized by emails, a username otherwise. Like FindByEmail,
+// it returns nil, not an error, when nobody has it.
+func FindByLogin(ctx context.Context, repo Repository, emails EmailNormalizer, login string, opts ...FindOption) (*User, error) {
+	if strings.Contains(login, "@") {
+		return repo.FindByEmail(ctx, emails.Normalize(login), opts...)
+	}
+	username := NormalizeUsername(login)
+	if username == "" {
+		return nil, nil
+	}
+	return repo.FindByUsername(ctx, username, opts...)
+}
@@ -0,0 +1,85 @@
+// Package encryption encrypts small secrets before they're stored.
+//
+// WHY ENCRYPT AND NOT HASH?
+// Passwords are hashed because we only ever need to CHECK them. Some
+// secrets, like TOTP seeds, must be read back in full to compute codes,
+// so they're encrypted instead. A leaked database dump is then useless
+// without the key, which lives in the environment, not the database.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the required key length: 32 bytes selects AES-256.
+const KeySize = 32
+
+// ErrDecrypt is returned when a ciphertext can't be decrypted: it was
+// tampered with, truncated, or encrypted with a different key.
+var ErrDecrypt = errors.New("decrypting secret failed")
+
+// Cipher encrypts and decrypts with AES-256-GCM.
+//
+// GCM is authenticated encryption: besides hiding the data, it detects
+// any modification of the ciphertext, so Decrypt fails instead of
+// returning garbage.
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher creates a cipher from a 32-byte key.
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// NewCipherFromBase64 creates a cipher from a base64-encoded key,
+// the form the key takes in configuration. Generate one with:
+//
+//	openssl rand -base64 32
+func NewCipherFromBase64(encoded string) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding encryption key: %w", err)
+	}
+	return NewCipher(key)
+}
+
+// Encrypt returns nonce || ciphertext.
+// A fresh random nonce is used every time, so encrypting the same
+// plaintext twice gives different results.
+func (c *Cipher) Encrypt(plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating nonce: %w", err)
+	}
+	return c.aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt reverses Encrypt.
+func (c *Cipher) Decrypt(data []byte) ([]byte, error) {
+	size := c.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := c.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,51 @@
+package failover
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// mysqlConn is the set of driver interfaces the MySQL driver's connections
+// implement. database/sql discovers optional features (context-aware
+// queries, session reset, validation) with type assertions, so a wrapper
+// must implement every one of them or the pool silently falls back to
+// slower paths.
+type mysqlConn interface {
+	driver.Conn
+	driver.Pinger
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.SessionResetter
+	driver.Validator
+	driver.NamedValueChecker
+}
+
+// failoverConn remembers which generation of the Connector dialed it.
+//
+// WHY A GENERATION NUMBER?
+// database/sql keeps idle connections around and hands them out again.
+// After a switch, those connections still point at the old target.
+// database/sql asks IsValid before reusing a connection, so reporting
+// "invalid" for older generations makes the pool close them and dial
+// fresh ones through Connect, which now picks the new target.
+type failoverConn struct {
+	mysqlConn
+	owner      *Connector
+	generation uint64
+}
+
+// IsValid reports false once the connector has switched targets.
+func (c *failoverConn) IsValid() bool {
+	return c.generation == c.owner.generation.Load() && c.mysqlConn.IsValid()
+}
+
+// ResetSession runs before a pooled connection is reused. Returning
+// driver.ErrBadConn for a stale connection discards it before the query.
+func (c *failoverConn) ResetSession(ctx context.Context) error {
+	if c.generation != c.owner.generation.Load() {
+		return driver.ErrBadConn
+	}
+	return c.mysqlConn.ResetSession(ctx)
+}
@@ -0,0 +1,302 @@
+// Package failover switches a MySQL connection pool from a primary
+// database to a standby when the primary stops answering health checks.
+//
+// HOW IT PLUGS IN:
+// Connector is a database/sql/driver.Connector. sql.OpenDB(connector)
+// gives an ordinary *sql.DB, so repositories, transactions, and the
+// readiness check work unchanged; only the place new connections are
+// dialed to moves. When the target changes, pooled connections to the
+// old target are discarded the next time they're taken from the pool.
+//
+// THE THREE MODES:
+//
+//	primary        all connections go to the primary (normal operation)
+//	standby-reads  the primary has been failing for the whole window:
+//	               connections go to the standby as READ ONLY sessions,
+//	               so reads keep working and writes fail fast
+//	standby        an operator confirmed the standby was promoted:
+//	               connections go to the standby read-write
+//
+// WHY DON'T WRITES FAIL OVER AUTOMATICALLY?
+// From inside one application instance, "the primary is down" and "this
+// instance can't reach the primary" look the same. If writes moved on
+// their own during a network partition, both nodes could accept writes
+// and diverge (split brain). Reads are safe to move - at worst they're a
+// little stale - so they move automatically; writes wait for a human who
+// has promoted the standby (STOP REPLICA, read_only=OFF) and called
+// Promote. Promotion is one-way: going back to the original primary is a
+// redeploy with the DSNs swapped, once it has been rebuilt as a replica.
+//
+// This is deliberately simple and meant for two-node setups. Larger
+// clusters should use a proxy (ProxySQL, MySQL Router) or orchestrator.
+package failover
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"go-basics/internal/metrics"
+)
+
+// Mode is where new connections are dialed.
+type Mode int32
+
+const (
+	ModePrimary      Mode = iota // Everything on the primary
+	ModeStandbyReads             // Read-only sessions on the standby
+	ModeStandby                  // Read-write sessions on the promoted standby
+)
+
+// String returns the mode's name as used in logs, metrics, and the admin API.
+func (m Mode) String() string {
+	switch m {
+	case ModePrimary:
+		return "primary"
+	case ModeStandbyReads:
+		return "standby-reads"
+	case ModeStandby:
+		return "standby"
+	default:
+		return fmt.Sprintf("Mode(%d)", int32(m))
+	}
+}
+
+// ErrNotFailedOver is returned by Promote unless reads have already
+// failed over to the standby.
+var ErrNotFailedOver = errors.New("reads have not failed over to the standby")
+
+// Connector dials the primary or the standby depending on its Mode.
+type Connector struct {
+	primary driver.Connector
+	standby driver.Connector
+	window  time.Duration // How long a target must be (un)healthy before switching
+
+	mode       atomic.Int32
+	generation atomic.Uint64 // Bumped on every switch; older connections are discarded
+
+	mu          sync.Mutex // Guards the fields below and serializes switches
+	healthy     bool       // Result of the last primary health check
+	changedAt   time.Time  // When healthy last flipped
+	lastError   string     // Last primary health check error
+	switchedAt  time.Time  // When the mode last changed
+	transitions *metrics.CounterVec
+	state       *metrics.GaugeVec
+}
+
+// Status is a snapshot of the connector's state for the admin API.
+type Status struct {
+	Mode           string     `json:"mode"`
+	PrimaryHealthy bool       `json:"primary_healthy"`
+	HealthSince    time.Time  `json:"health_since"` // When PrimaryHealthy last changed
+	LastError      string     `json:"last_error,omitempty"`
+	SwitchedAt     *time.Time `json:"switched_at,omitempty"`
+}
+
+// New creates a connector for the given primary and standby DSNs.
+// window is how long the primary must fail health checks before reads
+// move to the standby, and how long it must pass them before they move
+// back. It registers db_failover_transitions_total and db_failover_mode
+// on reg. opts apply to both DSNs, e.g. rotating credentials (see
+// secrets.DBCredentials).
+func New(primaryDSN, standbyDSN string, window time.Duration, reg *metrics.Registry, opts ...mysql.Option) (*Connector, error) {
+	primary, err := newConnector(primaryDSN, opts)
+	if err != nil {
+		return nil, fmt.Errorf("primary DSN: %w", err)
+	}
+	standby, err := newConnector(standbyDSN, opts)
+	if err != nil {
+		return nil, fmt.Errorf("standby DSN: %w", err)
+	}
+
+	c := &Connector{
+		primary:   primary,
+		standby:   standby,
+		window:    window,
+		healthy:   true,
+		changedAt: time.Now(),
+		transitions: reg.NewCounterVec("db_failover_transitions_total",
+			"Database failover mode changes, by the mode switched to.", "to"),
+		state: reg.NewGaugeVec("db_failover_mode",
+			"Current database failover mode: 0 primary, 1 standby-reads, 2 standby."),
+	}
+	c.state.Set(float64(ModePrimary))
+	return c, nil
+}
+
+// newConnector parses a DSN into a MySQL driver connector.
+func newConnector(dsn string, opts []mysql.Option) (driver.Connector, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Apply(opts...); err != nil {
+		return nil, err
+	}
+	return mysql.NewConnector(cfg)
+}
+
+// Mode returns the current mode.
+func (c *Connector) Mode() Mode {
+	return Mode(c.mode.Load())
+}
+
+// Connect dials a connection for the current mode.
+// database/sql calls it whenever the pool needs a new connection.
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	generation := c.generation.Load()
+	mode := c.Mode()
+
+	target := c.primary
+	if mode != ModePrimary {
+		target = c.standby
+	}
+	raw, err := target.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, ok := raw.(mysqlConn)
+	if !ok {
+		raw.Close()
+		return nil, fmt.Errorf("failover: unexpected driver connection type %T", raw)
+	}
+
+	// Until promotion, the standby is someone else's replica: make sure
+	// nothing we send can write to it, even if it isn't read_only itself.
+	if mode == ModeStandbyReads {
+		if _, err := conn.ExecContext(ctx, "SET SESSION TRANSACTION READ ONLY", nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("making standby session read-only: %w", err)
+		}
+	}
+
+	return &failoverConn{mysqlConn: conn, owner: c, generation: generation}, nil
+}
+
+// Driver returns the MySQL driver, as driver.Connector requires.
+func (c *Connector) Driver() driver.Driver {
+	return c.primary.Driver()
+}
+
+// Run health-checks the primary every interval until ctx is cancelled.
+func (c *Connector) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx, interval)
+		}
+	}
+}
+
+// check pings the primary once and switches modes if the window has passed.
+func (c *Connector) check(ctx context.Context, timeout time.Duration) {
+	err := ping(ctx, c.primary, timeout)
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if healthy := err == nil; healthy != c.healthy {
+		c.healthy = healthy
+		c.changedAt = now
+		if healthy {
+			log.Printf("failover: primary database is healthy again")
+		} else {
+			log.Printf("failover: primary database health check failed: %v", err)
+		}
+	}
+	if err != nil {
+		c.lastError = err.Error()
+	}
+
+	stable := now.Sub(c.changedAt) >= c.window
+	switch mode := c.Mode(); {
+	case mode == ModePrimary && !c.healthy && stable:
+		// Only move if there's somewhere to move to.
+		if err := ping(ctx, c.standby, timeout); err != nil {
+			log.Printf("failover: primary down for %v but standby is unreachable too: %v", now.Sub(c.changedAt).Round(time.Second), err)
+			return
+		}
+		c.switchTo(ModeStandbyReads, now)
+	case mode == ModeStandbyReads && c.healthy && stable:
+		c.switchTo(ModePrimary, now)
+	}
+}
+
+// Promote moves writes to the standby. Call it only after the standby has
+// actually been promoted (replication stopped, read_only off), and only
+// while reads are already on the standby. Promotion can't be undone.
+func (c *Connector) Promote() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.Mode() != ModeStandbyReads {
+		return ErrNotFailedOver
+	}
+	c.switchTo(ModeStandby, time.Now())
+	return nil
+}
+
+// Status returns a snapshot of the connector's state.
+func (c *Connector) Status() Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s := Status{
+		Mode:           c.Mode().String(),
+		PrimaryHealthy: c.healthy,
+		HealthSince:    c.changedAt,
+		LastError:      c.lastError,
+	}
+	if !c.switchedAt.IsZero() {
+		switchedAt := c.switchedAt
+		s.SwitchedAt = &switchedAt
+	}
+	return s
+}
+
+// switchTo changes the mode and invalidates existing connections.
+// The caller must hold c.mu.
+func (c *Connector) switchTo(mode Mode, now time.Time) {
+	from := c.Mode()
+	c.mode.Store(int32(mode))
+	c.generation.Add(1)
+	c.switchedAt = now
+
+	c.transitions.Inc(mode.String())
+	c.state.Set(float64(mode))
+	log.Printf("failover: database mode %s -> %s", from, mode)
+}
+
+// ping opens a fresh connection and pings it.
+//
+// WHY NOT PING THROUGH THE POOL?
+// The pool may be pointing at the standby, and even when it isn't, a
+// pooled connection can look healthy while new connections are refused.
+// Dialing fresh tests exactly what the pool would have to do.
+func ping(ctx context.Context, target driver.Connector, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	conn, err := target.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if p, ok := conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
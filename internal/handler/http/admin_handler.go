@@ -0,0 +1,865 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-basics/config"
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/diagnostics"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/failover"
+	"go-basics/internal/jobs"
+	"go-basics/internal/slo"
+	"go-basics/internal/tunables"
+)
+
+// AdminTokenHeader carries the static admin token required by admin routes.
+const AdminTokenHeader = "X-Admin-Token"
+
+// explainRequest is the expected JSON body for POST /admin/sql/explain.
+type explainRequest struct {
+	Query  string            `json:"query"`
+	Params map[string]string `json:"params"`
+}
+
+// rolesResponse lists a user's roles.
+type rolesResponse struct {
+	UserID uint64   `json:"user_id"`
+	Roles  []string `json:"roles"`
+}
+
+// impersonationResponse is the response for POST /admin/impersonate/{userID}.
+type impersonationResponse struct {
+	Token     string       `json:"token"`
+	ExpiresIn int64        `json:"expires_in"` // Seconds
+	User      userResponse `json:"user"`       // Who the token acts as
+}
+
+// tunableRequest is the expected JSON body for PUT /admin/tunables/{name}.
+type tunableRequest struct {
+	Value string `json:"value"`
+	TTL   string `json:"ttl"` // e.g. "30m"; empty means tunables.DefaultTTL
+}
+
+// Limits for the lists in GET /admin/jobs and GET /admin/jobs/dead-letters.
+const (
+	defaultJobListLimit = 50
+	maxJobListLimit     = 500
+)
+
+// jobsResponse is the response for GET /admin/jobs.
+type jobsResponse struct {
+	Kinds        []string           `json:"kinds"`
+	Workers      int                `json:"workers"`
+	Capacity     int                `json:"capacity"`
+	Queued       int                `json:"queued"`
+	Running      int                `json:"running"`
+	RetryWaiting int                `json:"retry_waiting"`
+	DeadLetters  int                `json:"dead_letters"`
+	Scheduled    []scheduleResponse `json:"scheduled"`
+}
+
+// scheduleResponse is one scheduled job. Like a dead letter in a list,
+// it leaves the payload out.
+type scheduleResponse struct {
+	ID        uint64    `json:"id"`
+	Kind      string    `json:"kind"`
+	UniqueKey string    `json:"unique_key,omitempty"`
+	RunAt     time.Time `json:"run_at"`
+	Every     string    `json:"every,omitempty"` // e.g. "24h0m0s"; empty for a one-off
+}
+
+// deadLetterResponse is one dead-lettered job. The payload is only
+// included when inspecting a single job: it can hold personal data (an
+// email and its links), so listing doesn't spread it around.
+type deadLetterResponse struct {
+	ID       uint64          `json:"id"`
+	Kind     string          `json:"kind"`
+	Attempts int             `json:"attempts"`
+	Errors   []string        `json:"errors"`
+	FailedAt time.Time       `json:"failed_at"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+}
+
+// newDeadLetterResponse converts a dead letter, leaving the payload out.
+func newDeadLetterResponse(letter jobs.DeadLetter) deadLetterResponse {
+	return deadLetterResponse{
+		ID:       letter.ID,
+		Kind:     letter.Kind,
+		Attempts: letter.Attempts,
+		Errors:   letter.Errors,
+		FailedAt: letter.FailedAt,
+	}
+}
+
+// emailTestSendRequest is the expected JSON body for POST /admin/emails/test-send.
+type emailTestSendRequest struct {
+	Template string `json:"template"`
+	To       string `json:"to"`
+	UserID   uint64 `json:"user_id"` // Renders with this user's data; 0 for sample data
+}
+
+// emailResponse is a rendered email.
+type emailResponse struct {
+	Template string `json:"template"`
+	To       string `json:"to"`
+	Subject  string `json:"subject"`
+	Body     string `json:"body"`
+}
+
+// dormancyReportResponse is the response for GET /admin/accounts/dormant.
+type dormancyReportResponse struct {
+	GeneratedAt time.Time                 `json:"generated_at"`
+	DryRun      bool                      `json:"dry_run"`
+	Policy      dormancyPolicyResponse    `json:"policy"`
+	Cutoff      time.Time                 `json:"cutoff"`
+	Dormant     int                       `json:"dormant"`
+	Steps       map[user.DormancyStep]int `json:"steps"`
+	Accounts    []dormantAccountResponse  `json:"accounts"`
+	Truncated   bool                      `json:"truncated"`
+}
+
+// dormancyPolicyResponse is the policy a dormancy report followed.
+type dormancyPolicyResponse struct {
+	After   string                `json:"after"` // e.g. "4320h0m0s"
+	Actions []user.DormancyAction `json:"actions"`
+	Grace   string                `json:"grace"`
+}
+
+// dormantAccountResponse is one account in a dormancy report. Unset
+// times are left out.
+type dormantAccountResponse struct {
+	UserID      uint64            `json:"user_id"`
+	Email       string            `json:"email"`
+	LastLoginAt time.Time         `json:"last_login_at"`
+	WarnedAt    *time.Time        `json:"warned_at,omitempty"`
+	DisabledAt  *time.Time        `json:"disabled_at,omitempty"`
+	DeleteAfter *time.Time        `json:"delete_after,omitempty"`
+	Next        user.DormancyStep `json:"next"` // What the next run will do
+}
+
+// newDormancyReportResponse converts a report.
+func newDormancyReportResponse(report *user.DormancyReport, policy user.DormancyPolicy) dormancyReportResponse {
+	resp := dormancyReportResponse{
+		GeneratedAt: report.GeneratedAt,
+		DryRun:      report.DryRun,
+		Policy: dormancyPolicyResponse{
+			After:   policy.After.String(),
+			Actions: policy.Actions,
+			Grace:   policy.Grace.String(),
+		},
+		Cutoff:    report.Cutoff,
+		Dormant:   report.Dormant,
+		Steps:     report.Steps,
+		Accounts:  make([]dormantAccountResponse, 0, len(report.Accounts)),
+		Truncated: report.Truncated,
+	}
+	if resp.Policy.Actions == nil {
+		resp.Policy.Actions = []user.DormancyAction{}
+	}
+	optional := func(t time.Time) *time.Time {
+		if t.IsZero() {
+			return nil
+		}
+		return &t
+	}
+	for _, a := range report.Accounts {
+		resp.Accounts = append(resp.Accounts, dormantAccountResponse{
+			UserID:      a.UserID,
+			Email:       a.Email,
+			LastLoginAt: a.LastLoginAt,
+			WarnedAt:    optional(a.WarnedAt),
+			DisabledAt:  optional(a.DisabledAt),
+			DeleteAfter: optional(a.DeleteAfter),
+			Next:        a.Step,
+		})
+	}
+	return resp
+}
+
+// AdminHandler handles operational endpoints for administrators.
+type AdminHandler struct {
+	users       *user.Service       // For role management
+	diagnostics diagnostics.Runner  // Whitelisted read-only queries
+	slo         *slo.Tracker        // Per-route SLO status
+	failover    *failover.Connector // Database failover; nil when not configured
+	settings    []config.Setting    // Loaded configuration, secrets redacted
+	adminToken  string              // Static token required for diagnostics
+
+	jwtManager       *auth.JWTManager // Issues impersonation tokens
+	impersonationTTL time.Duration    // Lifetime of impersonation tokens
+
+	tunables  *tunables.Registry  // Runtime knobs
+	jobs      *jobs.Queue         // Background jobs on this instance
+	scheduler *jobs.Scheduler     // Delayed and recurring jobs
+	emails    *user.EmailPreviews // Renders account emails for review
+	audit     *audit.Logger       // Records who did what
+	dormancy  *user.Dormancy      // Inactive account report and policy
+}
+
+// NewAdminHandler creates a new admin handler.
+// An empty adminToken disables the diagnostics routes.
+// A nil dbFailover leaves out the failover routes.
+// settings must already be redacted (see config.Config.Settings).
+// impersonationTTL is the lifetime of tokens from POST /admin/impersonate.
+func NewAdminHandler(users *user.Service, diagnostics diagnostics.Runner, sloTracker *slo.Tracker, dbFailover *failover.Connector, settings []config.Setting, adminToken string, jwtManager *auth.JWTManager, impersonationTTL time.Duration, knobs *tunables.Registry, queue *jobs.Queue, scheduler *jobs.Scheduler, emails *user.EmailPreviews, auditLog *audit.Logger, dormancy *user.Dormancy) *AdminHandler {
+	return &AdminHandler{
+		users:            users,
+		diagnostics:      diagnostics,
+		slo:              sloTracker,
+		failover:         dbFailover,
+		settings:         settings,
+		adminToken:       adminToken,
+		jwtManager:       jwtManager,
+		impersonationTTL: impersonationTTL,
+		tunables:         knobs,
+		jobs:             queue,
+		scheduler:        scheduler,
+		emails:           emails,
+		audit:            auditLog,
+		dormancy:         dormancy,
+	}
+}
+
+// RegisterRoutes sets up HTTP routes for admin operations.
+//
+// Every admin route requires a valid JWT with the route's scope
+// (granted by the admin role). Raw database diagnostics additionally
+// require the static admin token in the X-Admin-Token header.
+func (h *AdminHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	// scoped chains the guards: authenticate first, then check the scope.
+	scoped := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware.AuthenticateFunc(auth.RequireScope(scope)(next))
+	}
+	requireToken := auth.RequireToken(AdminTokenHeader, h.adminToken)
+
+	mux.HandleFunc("POST /admin/sql/explain", scoped(auth.ScopeDiagnosticsRun, requireToken(h.explain)))
+	mux.HandleFunc("GET /admin/slo", scoped(auth.ScopeDiagnosticsRun, h.sloSummary))
+	mux.HandleFunc("GET /admin/config", scoped(auth.ScopeDiagnosticsRun, requireToken(h.configSettings)))
+
+	if h.failover != nil {
+		mux.HandleFunc("GET /admin/db/failover", scoped(auth.ScopeDiagnosticsRun, h.failoverStatus))
+		mux.HandleFunc("POST /admin/db/failover/promote", scoped(auth.ScopeDiagnosticsRun, requireToken(h.promoteStandby)))
+	}
+
+	mux.HandleFunc("GET /admin/users/{id}/roles", scoped(auth.ScopeRolesManage, h.listRoles))
+	mux.HandleFunc("PUT /admin/users/{id}/roles/{role}", scoped(auth.ScopeRolesManage, h.assignRole))
+	mux.HandleFunc("DELETE /admin/users/{id}/roles/{role}", scoped(auth.ScopeRolesManage, h.revokeRole))
+
+	mux.HandleFunc("POST /admin/impersonate/{userID}", scoped(auth.ScopeUsersImpersonate, requireToken(h.impersonate)))
+
+	mux.HandleFunc("GET /admin/tunables", scoped(auth.ScopeTunablesManage, h.listTunables))
+	mux.HandleFunc("PUT /admin/tunables/{name}", scoped(auth.ScopeTunablesManage, requireToken(h.setTunable)))
+	mux.HandleFunc("DELETE /admin/tunables/{name}", scoped(auth.ScopeTunablesManage, requireToken(h.resetTunable)))
+
+	mux.HandleFunc("GET /admin/jobs", scoped(auth.ScopeJobsManage, h.jobsSummary))
+	mux.HandleFunc("GET /admin/jobs/dead-letters", scoped(auth.ScopeJobsManage, h.listDeadLetters))
+	// Inspecting a job shows its payload, so it needs the token too.
+	mux.HandleFunc("GET /admin/jobs/dead-letters/{id}", scoped(auth.ScopeJobsManage, requireToken(h.getDeadLetter)))
+	mux.HandleFunc("POST /admin/jobs/dead-letters/{id}/requeue", scoped(auth.ScopeJobsManage, requireToken(h.requeueDeadLetter)))
+	mux.HandleFunc("DELETE /admin/jobs/dead-letters/{id}", scoped(auth.ScopeJobsManage, requireToken(h.discardDeadLetter)))
+
+	// A preview can show a real user's address; a test send mails out.
+	mux.HandleFunc("GET /admin/emails/{template}/preview", scoped(auth.ScopeEmailsManage, requireToken(h.previewEmail)))
+	mux.HandleFunc("POST /admin/emails/test-send", scoped(auth.ScopeEmailsManage, requireToken(h.testSendEmail)))
+
+	// The report lists real users' addresses.
+	mux.HandleFunc("GET /admin/accounts/dormant", scoped(auth.ScopeAccountsManage, requireToken(h.previewDormancy)))
+	mux.HandleFunc("POST /admin/accounts/{id}/reactivate", scoped(auth.ScopeAccountsManage, requireToken(h.reactivateAccount)))
+
+	// Suspending an account is an everyday support action: no admin
+	// token, just the scope.
+	mux.HandleFunc("POST /users/{id}/deactivate", scoped(auth.ScopeAccountsManage, h.deactivateUser))
+	mux.HandleFunc("POST /users/{id}/activate", scoped(auth.ScopeAccountsManage, h.activateUser))
+}
+
+// sloSummary handles GET /admin/slo
+// Reports error budget consumption and burn rates for every route
+// that has received traffic on this instance.
+func (h *AdminHandler) sloSummary(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"routes": h.slo.Summary(),
+	})
+}
+
+// configSettings handles GET /admin/config
+// Shows the configuration this instance is running with. Secrets are
+// redacted, but the rest (hosts, limits) still helps an attacker, so
+// the route needs the admin token too.
+func (h *AdminHandler) configSettings(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"settings": h.settings,
+	})
+}
+
+// failoverStatus handles GET /admin/db/failover
+// Reports which database this instance is using and the primary's health.
+func (h *AdminHandler) failoverStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, h.failover.Status())
+}
+
+// promoteStandby handles POST /admin/db/failover/promote
+// The operator confirms the standby has been promoted, so writes may go
+// to it. Only allowed once reads have failed over; see package failover.
+func (h *AdminHandler) promoteStandby(w http.ResponseWriter, r *http.Request) {
+	if err := h.failover.Promote(); err != nil {
+		if errors.Is(err, failover.ErrNotFailedOver) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// Promotion is rare, one-way, and worth an audit trail.
+	h.logAdminAction(r, "promoted the standby database for writes")
+
+	writeJSON(w, http.StatusOK, h.failover.Status())
+}
+
+// listRoles handles GET /admin/users/{id}/roles
+func (h *AdminHandler) listRoles(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return
+	}
+
+	roles, err := h.users.Roles(r.Context(), id)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rolesResponse{UserID: id, Roles: roleNames(roles)})
+}
+
+// assignRole handles PUT /admin/users/{id}/roles/{role}
+// PUT is idempotent: assigning a role the user already has succeeds.
+func (h *AdminHandler) assignRole(w http.ResponseWriter, r *http.Request) {
+	id, role, ok := parseUserRole(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.users.AssignRole(r.Context(), id, role); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "assigned role %q to user %d", role, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeRole handles DELETE /admin/users/{id}/roles/{role}
+func (h *AdminHandler) revokeRole(w http.ResponseWriter, r *http.Request) {
+	id, role, ok := parseUserRole(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.users.RevokeRole(r.Context(), id, role); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "revoked role %q from user %d", role, id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// impersonate handles POST /admin/impersonate/{userID}
+// Issues a short-lived token that acts as the user, for support staff
+// reproducing what the user sees. The token carries the user's roles
+// and an "act" claim naming the admin (see auth.ImpersonatedBy).
+//
+// No refresh token is issued: when the token expires, the admin asks
+// for a new one, which leaves another line in the audit log.
+// Admins can't be impersonated, so the token never grants more than
+// an ordinary user has.
+func (h *AdminHandler) impersonate(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetClaimsFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	// The token names a staff member as the actor; a service isn't one.
+	if claims.UserID == 0 {
+		writeError(w, http.StatusForbidden, "only staff members can impersonate")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("userID"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return
+	}
+	if id == claims.UserID {
+		writeCode(w, CodeImpersonationSelf, "you can't impersonate yourself")
+		return
+	}
+
+	target, err := h.users.GetByID(r.Context(), id)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	roles, err := h.users.Roles(r.Context(), id)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	names := roleNames(roles)
+	for _, role := range names {
+		if role == auth.RoleAdmin {
+			writeError(w, http.StatusForbidden, "admins can't be impersonated")
+			return
+		}
+	}
+
+	token, err := h.jwtManager.GenerateTokenContext(r.Context(), target.ID, target.Email, names,
+		auth.ImpersonatedBy(auth.Actor{UserID: claims.UserID, Email: claims.Email}),
+		auth.ValidFor(h.impersonationTTL),
+		auth.AtVersion(target.TokenVersion),
+		auth.BoundTo(r),
+	)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+
+	h.logAdminAction(r, "started impersonating user %d for %v", id, h.impersonationTTL)
+
+	writeJSON(w, http.StatusOK, impersonationResponse{
+		Token:     token,
+		ExpiresIn: int64(h.impersonationTTL / time.Second),
+		User:      userV1(target),
+	})
+}
+
+// listTunables handles GET /admin/tunables
+// Lists every runtime knob on this instance, with any active override.
+func (h *AdminHandler) listTunables(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"tunables": h.tunables.List(),
+	})
+}
+
+// setTunable handles PUT /admin/tunables/{name}
+// Overrides a knob on this instance until the TTL passes.
+func (h *AdminHandler) setTunable(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeJSON[tunableRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	ttl := tunables.DefaultTTL
+	if req.TTL != "" {
+		if ttl, err = config.ParseDuration(req.TTL); err != nil {
+			writeCode(w, CodeTunableInvalid, "ttl: "+err.Error())
+			return
+		}
+	}
+
+	// The registry writes the audit log: it also logs expiries, which
+	// happen without a request.
+	status, err := h.tunables.Set(r.PathValue("name"), req.Value, ttl, actorName(r.Context()))
+	if err != nil {
+		writeTunableError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// resetTunable handles DELETE /admin/tunables/{name}
+// Reverts a knob to its configured default now.
+func (h *AdminHandler) resetTunable(w http.ResponseWriter, r *http.Request) {
+	status, err := h.tunables.Reset(r.PathValue("name"), actorName(r.Context()))
+	if err != nil {
+		writeTunableError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// writeTunableError maps tunables errors to HTTP responses.
+func writeTunableError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, tunables.ErrUnknownKnob):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, tunables.ErrInvalidValue), errors.Is(err, tunables.ErrInvalidTTL):
+		writeCode(w, CodeTunableInvalid, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// jobsSummary handles GET /admin/jobs?limit=50
+// Reports this instance's queue and lists the soonest scheduled jobs.
+func (h *AdminHandler) jobsSummary(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseJobListLimit(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.jobs.Stats(r.Context())
+	if err != nil {
+		writeJobsError(w, err)
+		return
+	}
+	schedules, err := h.scheduler.List(r.Context(), limit)
+	if err != nil {
+		writeJobsError(w, err)
+		return
+	}
+
+	resp := jobsResponse{
+		Kinds:        stats.Kinds,
+		Workers:      stats.Workers,
+		Capacity:     stats.Capacity,
+		Queued:       stats.Queued,
+		Running:      stats.Running,
+		RetryWaiting: stats.RetryWaiting,
+		DeadLetters:  stats.DeadLetters,
+		Scheduled:    make([]scheduleResponse, 0, len(schedules)),
+	}
+	for _, sched := range schedules {
+		item := scheduleResponse{ID: sched.ID, Kind: sched.Kind, UniqueKey: sched.UniqueKey, RunAt: sched.RunAt}
+		if sched.Every > 0 {
+			item.Every = sched.Every.String()
+		}
+		resp.Scheduled = append(resp.Scheduled, item)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// listDeadLetters handles GET /admin/jobs/dead-letters?limit=50
+// Lists the newest jobs that failed on every attempt, with their errors.
+func (h *AdminHandler) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseJobListLimit(w, r)
+	if !ok {
+		return
+	}
+
+	letters, err := h.jobs.DeadLetters(r.Context(), limit)
+	if err != nil {
+		writeJobsError(w, err)
+		return
+	}
+	resp := make([]deadLetterResponse, 0, len(letters))
+	for _, letter := range letters {
+		resp = append(resp, newDeadLetterResponse(letter))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dead_letters": resp,
+	})
+}
+
+// getDeadLetter handles GET /admin/jobs/dead-letters/{id}
+// Shows one dead-lettered job, payload included.
+func (h *AdminHandler) getDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseDeadLetterID(w, r)
+	if !ok {
+		return
+	}
+
+	letter, err := h.jobs.DeadLetter(r.Context(), id)
+	if err != nil {
+		writeJobsError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "inspected dead-lettered job %d (%s)", id, letter.Kind)
+
+	resp := newDeadLetterResponse(*letter)
+	resp.Payload = letter.Payload
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// requeueDeadLetter handles POST /admin/jobs/dead-letters/{id}/requeue
+// Runs the job again with a fresh set of attempts, once the cause of
+// its failures is fixed.
+func (h *AdminHandler) requeueDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseDeadLetterID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.jobs.Requeue(r.Context(), id); err != nil {
+		writeJobsError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "requeued dead-lettered job %d", id)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// discardDeadLetter handles DELETE /admin/jobs/dead-letters/{id}
+// Deletes the job for good.
+func (h *AdminHandler) discardDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseDeadLetterID(w, r)
+	if !ok {
+		return
+	}
+
+	letter, err := h.jobs.Discard(r.Context(), id)
+	if err != nil {
+		writeJobsError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "discarded dead-lettered job %d (%s, %d attempts)", id, letter.Kind, letter.Attempts)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// previewEmail handles GET /admin/emails/{template}/preview?user_id=
+// Renders an account email as the user would get it, or with sample data
+// without user_id. Links carry a placeholder token and don't work.
+func (h *AdminHandler) previewEmail(w http.ResponseWriter, r *http.Request) {
+	var userID uint64
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		var err error
+		if userID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			writeCode(w, CodeRequestInvalidID, "invalid user ID")
+			return
+		}
+	}
+
+	template := r.PathValue("template")
+	msg, err := h.emails.Preview(r.Context(), template, userID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if userID != 0 {
+		h.logAdminAction(r, "previewed email %s for user %d", template, userID)
+	}
+	writeJSON(w, http.StatusOK, emailResponse{Template: template, To: msg.To, Subject: msg.Subject, Body: msg.Body})
+}
+
+// testSendEmail handles POST /admin/emails/test-send
+// Renders an email like previewEmail and sends it to the given address,
+// so it can be checked in a real mail client.
+func (h *AdminHandler) testSendEmail(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeJSON[emailTestSendRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	msg, err := h.emails.TestSend(r.Context(), req.Template, req.UserID, req.To)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "sent test email %s to %s", req.Template, msg.To)
+	writeJSON(w, http.StatusAccepted, emailResponse{Template: req.Template, To: msg.To, Subject: msg.Subject, Body: msg.Body})
+}
+
+// previewDormancy handles GET /admin/accounts/dormant?limit=50
+// Runs the dormancy report as a dry run: which accounts are dormant, and
+// what the next scheduled run would do to each. Nothing is changed and
+// no email is sent.
+func (h *AdminHandler) previewDormancy(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseJobListLimit(w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.dormancy.Run(r.Context(), true, limit)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newDormancyReportResponse(report, h.dormancy.Policy()))
+}
+
+// reactivateAccount handles POST /admin/accounts/{id}/reactivate
+// Undoes the dormancy policy for one account: re-enables it if it was
+// disabled, cancels a scheduled deletion, and restarts its clock.
+func (h *AdminHandler) reactivateAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return
+	}
+
+	if err := h.dormancy.Reactivate(r.Context(), id); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "reactivated user %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deactivateUser handles POST /users/{id}/deactivate
+// Suspends the account: its sign-ins, refreshes, and access tokens are
+// refused with 403 until it's activated again. Unlike DELETE, nothing
+// is hidden or removed.
+func (h *AdminHandler) deactivateUser(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetClaimsFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return
+	}
+
+	if err := h.users.Deactivate(r.Context(), id, claims.UserID); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "deactivated user %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// activateUser handles POST /users/{id}/activate
+// Lifts a deactivation. Activating an active account does nothing.
+func (h *AdminHandler) activateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return
+	}
+
+	if err := h.users.Activate(r.Context(), id); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.logAdminAction(r, "activated user %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseJobListLimit reads the optional limit query parameter.
+// It writes a 400 response and returns ok=false if it's invalid.
+func parseJobListLimit(w http.ResponseWriter, r *http.Request) (int, bool) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultJobListLimit, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxJobListLimit {
+		writeCode(w, CodeRequestInvalidLimit, fmt.Sprintf("limit must be between 1 and %d", maxJobListLimit))
+		return 0, false
+	}
+	return n, true
+}
+
+// parseDeadLetterID reads the {id} path parameter.
+// It writes a 400 response and returns ok=false if it's invalid.
+func parseDeadLetterID(w http.ResponseWriter, r *http.Request) (uint64, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid dead letter ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// writeJobsError maps jobs errors to HTTP responses.
+func writeJobsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrDeadLetterNotFound):
+		writeError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, jobs.ErrUnknownKind):
+		// The deploy that dropped the handler also dropped the way to run it.
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, jobs.ErrFull), errors.Is(err, jobs.ErrClosed):
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	default:
+		log.Printf("admin jobs: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+	}
+}
+
+// parseUserRole reads the {id} and {role} path parameters.
+// It writes a 400 response and returns ok=false if either is invalid.
+func parseUserRole(w http.ResponseWriter, r *http.Request) (uint64, user.Role, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return 0, "", false
+	}
+	role, err := user.ParseRole(r.PathValue("role"))
+	if err != nil {
+		writeCode(w, CodeRoleUnknown, "unknown role")
+		return 0, "", false
+	}
+	return id, role, true
+}
+
+// logAdminAction records who performed an admin action in the audit log.
+func (h *AdminHandler) logAdminAction(r *http.Request, format string, args ...interface{}) {
+	h.audit.Record(r.Context(), audit.CategoryAdmin, actorName(r.Context()), format, args...)
+}
+
+// actorName identifies the authenticated caller for audit logs, e.g.
+// "user 7". On an impersonation token, the real actor is named too, and
+// so is a service calling with a client certificate.
+func actorName(ctx context.Context) string {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return "user 0"
+	}
+	if claims.Service != "" && claims.UserID == 0 {
+		return "service " + claims.Service
+	}
+	who := fmt.Sprintf("user %d", claims.UserID)
+	if claims.Impersonated() {
+		who += fmt.Sprintf(" (impersonated by user %d)", claims.Actor.UserID)
+	}
+	if claims.Service != "" {
+		who += " (via service " + claims.Service + ")"
+	}
+	return who
+}
+
+// explain handles POST /admin/sql/explain
+// Runs one whitelisted diagnostic query and returns its rows.
+func (h *AdminHandler) explain(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeJSON[explainRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	result, err := h.diagnostics.Run(r.Context(), req.Query, req.Params)
+	switch {
+	case errors.Is(err, diagnostics.ErrUnknownQuery):
+		// Tell the operator what they CAN run.
+		writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+			"error":   "unknown query",
+			"code":    CodeDiagnosticUnknown,
+			"field":   "query",
+			"queries": h.diagnostics.Queries(),
+		})
+		return
+	case errors.Is(err, diagnostics.ErrInvalidParams):
+		writeCode(w, CodeDiagnosticInvalid, err.Error())
+		return
+	case err != nil:
+		log.Printf("diagnostic query %q failed: %v", req.Query, err)
+		writeError(w, http.StatusInternalServerError, "diagnostic query failed")
+		return
+	}
+
+	// Log who ran what. Diagnostics are rare and worth an audit trail.
+	h.logAdminAction(r, "ran diagnostic %q", req.Query)
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,156 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/txn"
+)
+
+// anonymizationResponse is a pending anonymization request.
+type anonymizationResponse struct {
+	UserID         uint64    `json:"user_id"`
+	RequestedBy    uint64    `json:"requested_by"`
+	RequestedAt    time.Time `json:"requested_at"`
+	AnonymizeAfter time.Time `json:"anonymize_after"` // Canceling is possible until then
+}
+
+// anonymizationListResponse is the response for
+// GET /admin/accounts/anonymizations.
+type anonymizationListResponse struct {
+	Requests []anonymizationResponse `json:"requests"`
+}
+
+// AnonymizationHandler handles right-to-erasure requests: users (or
+// admins on their behalf) request and cancel them, and admins confirm
+// them early.
+type AnonymizationHandler struct {
+	anonymization *user.Anonymization
+	audit         *audit.Logger
+}
+
+// NewAnonymizationHandler creates a new anonymization handler. Requests,
+// cancellations, and confirmations are recorded in auditLog.
+func NewAnonymizationHandler(anonymization *user.Anonymization, auditLog *audit.Logger) *AnonymizationHandler {
+	return &AnonymizationHandler{anonymization: anonymization, audit: auditLog}
+}
+
+// RegisterRoutes sets up HTTP routes for anonymization. A user manages
+// their own requests; an admin anyone's. Confirming one, which erases
+// the account at once, takes the accounts:manage scope.
+func (h *AnonymizationHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	read := auth.RequireScope(auth.ScopeUsersRead)
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	owner := auth.RequireSelfOrRole("id", auth.RoleAdmin)
+	mux.HandleFunc("POST /users/{id}/anonymize", authMiddleware.AuthenticateFunc(write(owner(h.request))))
+	mux.HandleFunc("GET /users/{id}/anonymize", authMiddleware.AuthenticateFunc(read(owner(Handle(h.status)))))
+	mux.HandleFunc("DELETE /users/{id}/anonymize", authMiddleware.AuthenticateFunc(write(owner(Handle(h.cancel, WithStatus(http.StatusNoContent))))))
+	mux.HandleFunc("POST /me/anonymize", authMiddleware.AuthenticateFunc(write(asSelf(h.request))))
+	mux.HandleFunc("GET /me/anonymize", authMiddleware.AuthenticateFunc(read(asSelf(Handle(h.status)))))
+	mux.HandleFunc("DELETE /me/anonymize", authMiddleware.AuthenticateFunc(write(asSelf(Handle(h.cancel, WithStatus(http.StatusNoContent))))))
+
+	manage := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeAccountsManage)(next))
+	}
+	mux.HandleFunc("GET /admin/accounts/anonymizations", manage(h.list))
+	// The users row and everything else are scrubbed together.
+	mux.HandleFunc("POST /admin/accounts/{id}/anonymize", manage(txn.Middleware(h.confirm)))
+}
+
+// request handles POST /users/{id}/anonymize and POST /me/anonymize
+// Schedules the user's anonymization for when the grace period ends
+// (ANONYMIZE_GRACE). Until then the account works as before, and the
+// request can be canceled.
+func (h *AnonymizationHandler) request(w http.ResponseWriter, r *http.Request) {
+	id, err := pathUserID(r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	req, err := h.anonymization.Request(r.Context(), id, claims.UserID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.CategoryAccounts, actorName(r.Context()), "requested anonymization of user %d, due %s",
+		id, req.AnonymizeAfter.Format(time.RFC3339))
+	writeJSON(w, http.StatusAccepted, anonymizationV1(req))
+}
+
+// status handles GET /users/{id}/anonymize and GET /me/anonymize
+// Returns the pending request, or 404 anonymization.not_found.
+func (h *AnonymizationHandler) status(ctx context.Context, req userIDRequest) (anonymizationResponse, error) {
+	pending, err := h.anonymization.Status(ctx, req.ID)
+	if err != nil {
+		return anonymizationResponse{}, err
+	}
+	return anonymizationV1(pending), nil
+}
+
+// cancel handles DELETE /users/{id}/anonymize and DELETE /me/anonymize
+// Withdraws the pending request.
+func (h *AnonymizationHandler) cancel(ctx context.Context, req userIDRequest) (NoContent, error) {
+	if err := h.anonymization.Cancel(ctx, req.ID); err != nil {
+		return NoContent{}, err
+	}
+	h.audit.Record(ctx, audit.CategoryAccounts, actorName(ctx), "canceled anonymization of user %d", req.ID)
+	return NoContent{}, nil
+}
+
+// list handles GET /admin/accounts/anonymizations?limit=50
+// Returns pending requests, soonest due first.
+func (h *AnonymizationHandler) list(w http.ResponseWriter, r *http.Request) {
+	limit, ok := parseJobListLimit(w, r)
+	if !ok {
+		return
+	}
+
+	pending, err := h.anonymization.Pending(r.Context(), limit)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	resp := anonymizationListResponse{Requests: make([]anonymizationResponse, 0, len(pending))}
+	for i := range pending {
+		resp.Requests = append(resp.Requests, anonymizationV1(&pending[i]))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// confirm handles POST /admin/accounts/{id}/anonymize
+// Anonymizes a user with a pending request now, without waiting for the
+// grace period: for an admin who has verified the request.
+func (h *AnonymizationHandler) confirm(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid user ID")
+		return
+	}
+
+	if err := h.anonymization.Confirm(r.Context(), id); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	h.audit.Record(r.Context(), audit.CategoryAccounts, actorName(r.Context()), "confirmed anonymization of user %d", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// anonymizationV1 converts a request to its response.
+func anonymizationV1(req *user.AnonymizationRequest) anonymizationResponse {
+	return anonymizationResponse{
+		UserID:         req.UserID,
+		RequestedBy:    req.RequestedBy,
+		RequestedAt:    req.RequestedAt.UTC(),
+		AnonymizeAfter: req.AnonymizeAfter.UTC(),
+	}
+}
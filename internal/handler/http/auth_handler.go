@@ -0,0 +1,310 @@
+package http
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/txn"
+)
+
+// forgotPasswordRequest is the expected JSON body for POST /auth/forgot-password.
+type forgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+// resetPasswordRequest is the expected JSON body for POST /auth/reset-password.
+type resetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// changeEmailRequest is the expected JSON body for POST /users/{id}/email.
+type changeEmailRequest struct {
+	ID              uint64 `json:"-"`
+	Email           string `json:"email"`
+	CurrentPassword string `json:"current_password"`
+}
+
+// bind reads the user ID from the path (see Handle).
+func (req *changeEmailRequest) bind(r *http.Request) (err error) {
+	req.ID, err = pathUserID(r)
+	return err
+}
+
+// confirmEmailRequest is the expected JSON body for POST /auth/confirm-email.
+type confirmEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// mfaCodeRequest is the expected JSON body for confirming or disabling 2FA.
+type mfaCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// mfaEnrollResponse is returned when 2FA enrollment starts.
+type mfaEnrollResponse struct {
+	Secret string `json:"secret"`      // For typing into the app by hand
+	URI    string `json:"otpauth_uri"` // Render as a QR code for the app to scan
+}
+
+// mfaResetRequest is the expected JSON body for POST /auth/mfa/reset.
+type mfaResetRequest struct {
+	Password string `json:"password"`
+}
+
+// mfaRecoveryCodesResponse carries newly generated recovery codes. This
+// is the only time they're shown.
+type mfaRecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaRecoveryStatusResponse is returned by GET /auth/mfa/recovery-codes.
+type mfaRecoveryStatusResponse struct {
+	Remaining            int  `json:"remaining"`
+	Used                 int  `json:"used"`
+	ReenrollmentRequired bool `json:"reenrollment_required"` // A code was used: set up 2FA again, or regenerate
+}
+
+// messageResponse carries a human-readable status message.
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// AuthHandler handles account security endpoints: password recovery,
+// email changes, and two-factor authentication.
+type AuthHandler struct {
+	reset       *user.PasswordReset
+	emailChange *user.EmailChange
+	mfa         *user.MFA  // nil when two-factor authentication isn't configured
+	limit       Middleware // Rate limit for forgot-password
+}
+
+// NewAuthHandler creates a new auth handler.
+// Pass a nil mfa to leave the two-factor routes unregistered.
+func NewAuthHandler(reset *user.PasswordReset, emailChange *user.EmailChange, mfa *user.MFA, limit Middleware) *AuthHandler {
+	return &AuthHandler{reset: reset, emailChange: emailChange, mfa: mfa, limit: limit}
+}
+
+// RegisterRoutes sets up HTTP routes for account security.
+func (h *AuthHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	// Password recovery routes are public: the user can't log in, that's the point.
+	// Forgot-password is rate limited so it can't be used to flood an inbox.
+	mux.HandleFunc("POST /auth/forgot-password", h.limit(h.forgotPassword))
+	// The password change and the token cleanup commit together.
+	mux.HandleFunc("POST /auth/reset-password", txn.Middleware(h.resetPassword))
+
+	// Changing the email takes the password; confirming it takes only the
+	// token, since the link may be opened on a device that isn't signed in.
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	mux.HandleFunc("POST /users/{id}/email", authMiddleware.AuthenticateFunc(write(txn.Middleware(Handle(h.changeEmail, WithStatus(http.StatusAccepted))))))
+	mux.HandleFunc("POST /auth/confirm-email", txn.Middleware(Handle(h.confirmEmail)))
+
+	if h.mfa == nil {
+		return
+	}
+
+	// Two-factor routes act on the caller's own account. Those that
+	// change 2FA together with the recovery codes run in a transaction,
+	// so neither is left half done.
+	read := auth.RequireScope(auth.ScopeUsersRead)
+	mux.HandleFunc("POST /auth/mfa/enroll", authMiddleware.AuthenticateFunc(write(h.enrollMFA)))
+	mux.HandleFunc("POST /auth/mfa/confirm", authMiddleware.AuthenticateFunc(write(txn.Middleware(h.confirmMFA))))
+	mux.HandleFunc("POST /auth/mfa/disable", authMiddleware.AuthenticateFunc(write(txn.Middleware(h.disableMFA))))
+	mux.HandleFunc("GET /auth/mfa/recovery-codes", authMiddleware.AuthenticateFunc(read(h.recoveryStatus)))
+	mux.HandleFunc("POST /auth/mfa/recovery-codes", authMiddleware.AuthenticateFunc(write(txn.Middleware(h.regenerateRecoveryCodes))))
+	mux.HandleFunc("POST /auth/mfa/reset", authMiddleware.AuthenticateFunc(write(txn.Middleware(h.resetMFA))))
+}
+
+// forgotPassword handles POST /auth/forgot-password
+// Emails a reset link if the address belongs to an account.
+//
+// The response is ALWAYS 202 with the same message, whether or not the
+// email exists and even if sending fails. Any difference would let an
+// attacker probe which addresses are registered.
+func (h *AuthHandler) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeJSON[forgotPasswordRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	if err := h.reset.Request(r.Context(), req.Email); err != nil {
+		log.Printf("password reset request failed: %v", err)
+	}
+
+	writeJSON(w, http.StatusAccepted, messageResponse{
+		Message: "if that email is registered, a reset link has been sent",
+	})
+}
+
+// resetPassword handles POST /auth/reset-password
+// Sets a new password using the token from the reset email.
+func (h *AuthHandler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeJSON[resetPasswordRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	if err := h.reset.Reset(r.Context(), req.Token, req.Password); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// changeEmail handles POST /users/{id}/email
+// Emails a confirmation link to the new address; the email changes only
+// once it's followed (see confirmEmail).
+func (h *AuthHandler) changeEmail(ctx context.Context, req changeEmailRequest) (messageResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return messageResponse{}, errUnauthorized
+	}
+	if claims.UserID != req.ID {
+		return messageResponse{}, forbidden("you can only change your own email")
+	}
+
+	if err := h.emailChange.Request(ctx, req.ID, req.CurrentPassword, req.Email); err != nil {
+		return messageResponse{}, err
+	}
+	return messageResponse{
+		Message: "a confirmation link has been sent to the new address",
+	}, nil
+}
+
+// confirmEmail handles POST /auth/confirm-email
+// Applies a pending email change using the token from the confirmation email.
+//
+// Access tokens issued before the change still carry the old email in
+// their claims until they expire or are refreshed.
+func (h *AuthHandler) confirmEmail(ctx context.Context, req confirmEmailRequest) (userResponse, error) {
+	u, err := h.emailChange.Confirm(ctx, req.Token)
+	if err != nil {
+		return userResponse{}, err
+	}
+	return userV1(u), nil
+}
+
+// enrollMFA handles POST /auth/mfa/enroll
+// Starts two-factor enrollment and returns the secret to add to an
+// authenticator app. 2FA stays off until confirmMFA succeeds.
+func (h *AuthHandler) enrollMFA(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	enrollment, err := h.mfa.Enroll(r.Context(), claims.UserID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaEnrollResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+// confirmMFA handles POST /auth/mfa/confirm
+// Turns two-factor authentication on with a code from the app, and
+// returns the account's recovery codes.
+func (h *AuthHandler) confirmMFA(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	req, err := DecodeJSON[mfaCodeRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	codes, err := h.mfa.Confirm(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// disableMFA handles POST /auth/mfa/disable
+// Turns two-factor authentication off. Requires a current code.
+func (h *AuthHandler) disableMFA(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	req, err := DecodeJSON[mfaCodeRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	if err := h.mfa.Disable(r.Context(), claims.UserID, req.Code); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recoveryStatus handles GET /auth/mfa/recovery-codes
+// Counts the caller's remaining and used recovery codes. The codes
+// themselves can't be shown again: only their hashes are stored.
+func (h *AuthHandler) recoveryStatus(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	status, err := h.mfa.RecoveryStatus(r.Context(), claims.UserID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaRecoveryStatusResponse{
+		Remaining:            status.Remaining,
+		Used:                 status.Used,
+		ReenrollmentRequired: status.ReenrollmentRequired(),
+	})
+}
+
+// regenerateRecoveryCodes handles POST /auth/mfa/recovery-codes
+// Replaces the caller's recovery codes with new ones. Requires a
+// current code from the app.
+func (h *AuthHandler) regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	req, err := DecodeJSON[mfaCodeRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(r.Context(), claims.UserID, req.Code)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, mfaRecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// resetMFA handles POST /auth/mfa/reset
+// Turns two-factor authentication off with the password, once the
+// caller has signed in with a recovery code, so they can enroll a new
+// authenticator (see user.MFA.ResetAfterRecovery).
+func (h *AuthHandler) resetMFA(w http.ResponseWriter, r *http.Request) {
+	claims, _ := auth.GetClaimsFromContext(r.Context())
+
+	req, err := DecodeJSON[mfaResetRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	if err := h.mfa.ResetAfterRecovery(r.Context(), claims.UserID, req.Password); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,133 @@
+package http
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+)
+
+// AvatarField is the multipart form field that carries the picture:
+//
+//	curl -X PUT -H "Authorization: Bearer $TOKEN" -F avatar=@me.jpg .../me/avatar
+const AvatarField = "avatar"
+
+// AvatarHandler handles profile picture uploads.
+type AvatarHandler struct {
+	avatars *user.Avatars
+	maxSize int64 // Largest accepted picture, in bytes (AVATAR_MAX_UPLOAD_SIZE)
+}
+
+// NewAvatarHandler creates a new avatar handler.
+func NewAvatarHandler(avatars *user.Avatars, maxSize int64) *AvatarHandler {
+	return &AvatarHandler{avatars: avatars, maxSize: maxSize}
+}
+
+// RegisterRoutes sets up HTTP routes for avatars. Like the profile
+// itself, a user's avatar can be changed by them or by an admin.
+func (h *AvatarHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	owner := auth.RequireSelfOrRole("id", auth.RoleAdmin)
+	mux.HandleFunc("PUT /users/{id}/avatar", authMiddleware.AuthenticateFunc(write(owner(h.upload))))
+	mux.HandleFunc("DELETE /users/{id}/avatar", authMiddleware.AuthenticateFunc(write(owner(h.remove))))
+	mux.HandleFunc("PUT /me/avatar", authMiddleware.AuthenticateFunc(write(asSelf(h.upload))))
+	mux.HandleFunc("DELETE /me/avatar", authMiddleware.AuthenticateFunc(write(asSelf(h.remove))))
+}
+
+// BodyLimits returns the upload routes' body limits, which replace
+// SERVER_MAX_BODY_SIZE on them (see LimitBody). The multipart framing
+// around the picture gets a few kilobytes on top.
+func (h *AvatarHandler) BodyLimits() map[string]int64 {
+	limit := h.maxSize + 16<<10
+	return map[string]int64{
+		"PUT /users/{id}/avatar": limit,
+		"PUT /me/avatar":         limit,
+	}
+}
+
+// upload handles PUT /users/{id}/avatar and PUT /me/avatar
+// Reads the picture from the multipart body and makes it the avatar.
+//
+// The body is read part by part rather than with ParseMultipartForm,
+// which would spool other parts to temporary files: only the avatar
+// part is read, and only up to maxSize.
+func (h *AvatarHandler) upload(w http.ResponseWriter, r *http.Request) {
+	id, err := pathUserID(r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	data, err := h.readAvatar(r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	u, err := h.avatars.Set(r.Context(), id, data)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, userV1(u))
+}
+
+// remove handles DELETE /users/{id}/avatar and DELETE /me/avatar
+func (h *AvatarHandler) remove(w http.ResponseWriter, r *http.Request) {
+	id, err := pathUserID(r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if _, err := h.avatars.Remove(r.Context(), id); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// readAvatar returns the contents of the request's AvatarField part.
+func (h *AvatarHandler) readAvatar(r *http.Request) ([]byte, error) {
+	missing := badRequest(CodeAvatarRequired, "send multipart/form-data with the picture in the %q field", AvatarField)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		return nil, missing
+	}
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, missing
+		}
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		if part.FormName() != AvatarField {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, h.maxSize+1))
+		if err != nil {
+			return nil, bodyError(err)
+		}
+		if int64(len(data)) > h.maxSize {
+			return nil, &RequestError{
+				Status:  http.StatusRequestEntityTooLarge,
+				Code:    CodeRequestTooLarge,
+				Message: fmt.Sprintf("avatar must not exceed %d bytes", h.maxSize),
+			}
+		}
+		return data, nil
+	}
+}
+
+// bodyError describes a failure reading a multipart body: over the
+// LimitBody cap, or not multipart at all.
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return decodeError(err)
+	}
+	return badRequest(CodeRequestInvalid, "malformed multipart body: %v", err)
+}
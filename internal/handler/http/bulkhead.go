@@ -0,0 +1,42 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"go-basics/internal/bulkhead"
+	"go-basics/internal/metrics"
+)
+
+// bulkheadRetryAfter is the Retry-After sent with tenant.busy, in
+// seconds: a slot frees up as soon as one of the tenant's requests ends.
+const bulkheadRetryAfter = "1"
+
+// TenantBulkhead caps the requests each tenant (X-Tenant-ID) has in
+// flight, so one tenant can't hold every database connection (see
+// package bulkhead). Requests over the cap wait briefly for a slot,
+// then are answered 503 tenant.busy.
+//
+// /health, /ready and /metrics aren't counted: the load balancer and
+// monitoring must get through whoever is flooding the pool.
+func TenantBulkhead(next http.Handler, b *bulkhead.Bulkhead) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health", "/ready", "/metrics":
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, err := b.Acquire(r.Context(), r.Header.Get(metrics.TenantHeader))
+		if errors.Is(err, bulkhead.ErrFull) {
+			w.Header().Set("Retry-After", bulkheadRetryAfter)
+			writeCode(w, CodeTenantBusy, "too many requests in flight for this tenant, please retry later")
+			return
+		}
+		if err != nil {
+			// The client went away while waiting: nobody to answer.
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
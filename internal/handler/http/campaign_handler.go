@@ -0,0 +1,303 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/campaign"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/txn"
+)
+
+// Limits for the lists in GET /admin/campaigns and
+// GET /admin/campaigns/{id}/deliveries.
+const (
+	defaultCampaignListLimit = 50
+	maxCampaignListLimit     = 500
+)
+
+// segmentBody selects a campaign's recipients. Omitted fields leave that
+// condition out.
+type segmentBody struct {
+	CreatedFrom   time.Time `json:"created_from"`
+	CreatedTo     time.Time `json:"created_to"`
+	Role          string    `json:"role"`
+	ActiveSince   time.Time `json:"active_since"`
+	InactiveSince time.Time `json:"inactive_since"`
+}
+
+// createCampaignRequest is the expected JSON body for
+// POST /admin/campaigns. Subject and body are Go text/templates over the
+// recipient's .ID, .Email, and .Username.
+type createCampaignRequest struct {
+	Subject string      `json:"subject"`
+	Body    string      `json:"body"`
+	Segment segmentBody `json:"segment"`
+}
+
+// campaignIDRequest is the request for routes that act on one campaign.
+type campaignIDRequest struct {
+	ID uint64
+}
+
+// bind reads the campaign ID from the path (see Handle).
+func (req *campaignIDRequest) bind(r *http.Request) error {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return badRequest(CodeRequestInvalidID, "invalid campaign ID")
+	}
+	req.ID = id
+	return nil
+}
+
+// campaignListRequest is the request for GET /admin/campaigns.
+type campaignListRequest struct {
+	Limit int
+}
+
+// bind reads ?limit (see Handle).
+func (req *campaignListRequest) bind(r *http.Request) error {
+	limit, err := campaignListLimit(r)
+	req.Limit = limit
+	return err
+}
+
+// deliveryListRequest is the request for
+// GET /admin/campaigns/{id}/deliveries.
+type deliveryListRequest struct {
+	ID     uint64
+	Status string
+	After  uint64
+	Limit  int
+}
+
+// bind reads the campaign ID from the path, and ?status, ?after, and
+// ?limit (see Handle).
+func (req *deliveryListRequest) bind(r *http.Request) error {
+	id := campaignIDRequest{}
+	if err := id.bind(r); err != nil {
+		return err
+	}
+	req.ID = id.ID
+	query := r.URL.Query()
+	req.Status = query.Get("status")
+	if v := query.Get("after"); v != "" {
+		after, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return badRequest(CodeRequestInvalidCursor, "after must be a next_cursor from the previous page")
+		}
+		req.After = after
+	}
+	limit, err := campaignListLimit(r)
+	req.Limit = limit
+	return err
+}
+
+// campaignListLimit reads ?limit for the campaign lists.
+func campaignListLimit(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultCampaignListLimit, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxCampaignListLimit {
+		return 0, badRequest(CodeRequestInvalidLimit, "limit must be between 1 and %d", maxCampaignListLimit)
+	}
+	return n, nil
+}
+
+// segmentResponse is a campaign's segment. Conditions left out are too.
+type segmentResponse struct {
+	CreatedFrom   *time.Time `json:"created_from,omitempty"`
+	CreatedTo     *time.Time `json:"created_to,omitempty"`
+	Role          string     `json:"role,omitempty"`
+	ActiveSince   *time.Time `json:"active_since,omitempty"`
+	InactiveSince *time.Time `json:"inactive_since,omitempty"`
+}
+
+// campaignResponse is one campaign and its progress. Unset times are
+// left out.
+type campaignResponse struct {
+	ID        uint64          `json:"id"`
+	Subject   string          `json:"subject"`
+	Body      string          `json:"body"`
+	Segment   segmentResponse `json:"segment"`
+	Status    campaign.Status `json:"status"`
+	CreatedBy uint64          `json:"created_by"`
+	CreatedAt time.Time       `json:"created_at"`
+	StartedAt *time.Time      `json:"started_at,omitempty"`
+	EndedAt   *time.Time      `json:"ended_at,omitempty"`
+	Sent      int             `json:"sent"`
+	Failed    int             `json:"failed"`
+	Skipped   int             `json:"skipped"`
+}
+
+// campaignListResponse is the response for GET /admin/campaigns.
+type campaignListResponse struct {
+	Campaigns []campaignResponse `json:"campaigns"`
+}
+
+// deliveryResponse is what happened to a campaign's email to one user.
+type deliveryResponse struct {
+	UserID uint64                  `json:"user_id"`
+	Email  string                  `json:"email"`
+	Status campaign.DeliveryStatus `json:"status"`
+	Error  string                  `json:"error,omitempty"` // Why it failed or was skipped
+	At     time.Time               `json:"at"`
+}
+
+// deliveryListResponse is the response for
+// GET /admin/campaigns/{id}/deliveries.
+type deliveryListResponse struct {
+	Deliveries []deliveryResponse `json:"deliveries"`
+	NextCursor string             `json:"next_cursor,omitempty"` // Pass as ?after for the next page; absent on the last
+}
+
+// CampaignHandler handles admin email campaigns: creating them, following
+// their progress and deliveries, and canceling them.
+type CampaignHandler struct {
+	campaigns *campaign.Service
+	audit     *audit.Logger
+}
+
+// NewCampaignHandler creates a new campaign handler. Campaigns created
+// and canceled are recorded in auditLog.
+func NewCampaignHandler(campaigns *campaign.Service, auditLog *audit.Logger) *CampaignHandler {
+	return &CampaignHandler{campaigns: campaigns, audit: auditLog}
+}
+
+// RegisterRoutes sets up the campaign routes, all of which need a JWT
+// with the campaigns:manage scope.
+func (h *CampaignHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	manage := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeCampaignsManage)(next))
+	}
+	// The campaign and its first batch's schedule are created together.
+	mux.HandleFunc("POST /admin/campaigns", manage(txn.Middleware(Handle(h.create, WithStatus(http.StatusAccepted)))))
+	mux.HandleFunc("GET /admin/campaigns", manage(Handle(h.list)))
+	mux.HandleFunc("GET /admin/campaigns/{id}", manage(Handle(h.get)))
+	mux.HandleFunc("GET /admin/campaigns/{id}/deliveries", manage(Handle(h.deliveries)))
+	mux.HandleFunc("POST /admin/campaigns/{id}/cancel", manage(Handle(h.cancel)))
+}
+
+// create handles POST /admin/campaigns
+// Stores the campaign and queues it; the job system sends it in batches.
+// Follow its progress with GET /admin/campaigns/{id}.
+func (h *CampaignHandler) create(ctx context.Context, req createCampaignRequest) (campaignResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return campaignResponse{}, errUnauthorized
+	}
+	c, err := h.campaigns.Create(ctx, campaign.Draft{
+		Subject: req.Subject,
+		Body:    req.Body,
+		Segment: campaign.Segment{
+			CreatedFrom:   req.Segment.CreatedFrom,
+			CreatedTo:     req.Segment.CreatedTo,
+			Role:          user.Role(req.Segment.Role),
+			ActiveSince:   req.Segment.ActiveSince,
+			InactiveSince: req.Segment.InactiveSince,
+		},
+	}, claims.UserID)
+	if err != nil {
+		return campaignResponse{}, err
+	}
+	h.audit.Record(ctx, audit.CategoryAdmin, actorName(ctx), "created email campaign %d", c.ID)
+	return campaignV1(c), nil
+}
+
+// list handles GET /admin/campaigns
+// Returns the newest campaigns, whatever their status.
+func (h *CampaignHandler) list(ctx context.Context, req campaignListRequest) (campaignListResponse, error) {
+	campaigns, err := h.campaigns.Campaigns(ctx, req.Limit)
+	if err != nil {
+		return campaignListResponse{}, err
+	}
+	resp := campaignListResponse{Campaigns: make([]campaignResponse, 0, len(campaigns))}
+	for i := range campaigns {
+		resp.Campaigns = append(resp.Campaigns, campaignV1(&campaigns[i]))
+	}
+	return resp, nil
+}
+
+// get handles GET /admin/campaigns/{id}
+// Returns the campaign with its progress so far.
+func (h *CampaignHandler) get(ctx context.Context, req campaignIDRequest) (campaignResponse, error) {
+	c, err := h.campaigns.Campaign(ctx, req.ID)
+	if err != nil {
+		return campaignResponse{}, err
+	}
+	return campaignV1(c), nil
+}
+
+// deliveries handles GET /admin/campaigns/{id}/deliveries
+// Returns a page of the campaign's recipients in user ID order, with
+// what happened to each one's email; ?status=sent, failed, or skipped
+// narrows it down.
+func (h *CampaignHandler) deliveries(ctx context.Context, req deliveryListRequest) (deliveryListResponse, error) {
+	deliveries, err := h.campaigns.Deliveries(ctx, req.ID, req.Status, req.After, req.Limit)
+	if err != nil {
+		return deliveryListResponse{}, err
+	}
+	resp := deliveryListResponse{Deliveries: make([]deliveryResponse, 0, len(deliveries))}
+	for _, d := range deliveries {
+		resp.Deliveries = append(resp.Deliveries, deliveryResponse{
+			UserID: d.UserID,
+			Email:  d.Email,
+			Status: d.Status,
+			Error:  d.Error,
+			At:     d.At,
+		})
+	}
+	if len(deliveries) == req.Limit {
+		resp.NextCursor = strconv.FormatUint(deliveries[len(deliveries)-1].UserID, 10)
+	}
+	return resp, nil
+}
+
+// cancel handles POST /admin/campaigns/{id}/cancel
+// No further batch is sent; one that's running finishes.
+func (h *CampaignHandler) cancel(ctx context.Context, req campaignIDRequest) (campaignResponse, error) {
+	c, err := h.campaigns.Cancel(ctx, req.ID)
+	if err != nil {
+		return campaignResponse{}, err
+	}
+	h.audit.Record(ctx, audit.CategoryAdmin, actorName(ctx), "canceled email campaign %d (%d sent)", c.ID, c.Sent)
+	return campaignV1(c), nil
+}
+
+// campaignV1 converts a campaign to its response.
+func campaignV1(c *campaign.Campaign) campaignResponse {
+	return campaignResponse{
+		ID:      c.ID,
+		Subject: c.Subject,
+		Body:    c.Body,
+		Segment: segmentResponse{
+			CreatedFrom:   optionalTime(c.Segment.CreatedFrom),
+			CreatedTo:     optionalTime(c.Segment.CreatedTo),
+			Role:          string(c.Segment.Role),
+			ActiveSince:   optionalTime(c.Segment.ActiveSince),
+			InactiveSince: optionalTime(c.Segment.InactiveSince),
+		},
+		Status:    c.Status,
+		CreatedBy: c.CreatedBy,
+		CreatedAt: c.CreatedAt,
+		StartedAt: c.StartedAt,
+		EndedAt:   c.EndedAt,
+		Sent:      c.Sent,
+		Failed:    c.Failed,
+		Skipped:   c.Skipped,
+	}
+}
+
+// optionalTime returns nil for the zero time, so it's left out of JSON.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
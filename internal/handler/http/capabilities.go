@@ -0,0 +1,178 @@
+package http
+
+import "net/http"
+
+// Feature names, as GET /capabilities reports them.
+const (
+	FeatureMFA          = "mfa"              // TOTP two-factor authentication (/auth/mfa/*)
+	FeaturePasskeys     = "passkeys"         // WebAuthn sign-in (not implemented yet)
+	FeatureSCIM         = "scim"             // SCIM user provisioning (not implemented yet)
+	FeatureGraphQL      = "graphql"          // GraphQL endpoint (not implemented yet)
+	FeatureSSO          = "sso_saml"         // SAML single sign-on (/sso/saml/*)
+	FeatureCaptcha      = "captcha"          // captcha_token required on /register and /login
+	FeatureWebPush      = "web_push"         // Browser push notifications
+	FeatureTokenBinding = "token_binding"    // Access tokens only work from the client they were issued to
+	FeatureTokenJWE     = "encrypted_tokens" // Access tokens are JWE; treat them as opaque
+	FeatureClaimsJWE    = "encrypted_claims" // Access tokens are readable JWTs with some claims encrypted in "enc"
+	FeatureHTTP3        = "http3"            // HTTP/3 over QUIC, advertised with Alt-Svc
+	FeatureMTLS         = "mtls"             // Services may authenticate with client certificates
+	FeatureAvatars      = "avatars"          // Profile picture uploads (PUT /users/{id}/avatar)
+	FeatureSignedAuth   = "signed_requests"  // Integrations may authenticate by signing requests (HMAC)
+	FeatureRiskScoring  = "risk_scoring"     // /login may ask for captcha_token or 2FA, or refuse, by the attempt's risk
+	FeatureDPoP         = "dpop"             // /login and /auth/refresh bind tokens to the key of a DPoP proof (RFC 9449)
+)
+
+// apiVersions are the API versions this server speaks, oldest first.
+var apiVersions = []string{"v1"}
+
+// Capabilities is what this deployment offers clients, filled in from
+// configuration at startup.
+type Capabilities struct {
+	Features        map[string]bool // By Feature* name; every name is listed, on or off
+	CaptchaProvider string          // Which widget to show, when FeatureCaptcha is on
+	MaxBodySize     int64           // Largest request body, in bytes
+
+	// RateLimits returns the limits in force. It's a function because
+	// they're runtime tunables, read on every request.
+	RateLimits func() []RateLimitInfo
+}
+
+// RateLimitInfo describes one rate limit, for clients to pace
+// themselves by. Requests is 0 when the limit is off.
+type RateLimitInfo struct {
+	Name          string   `json:"name"`
+	Per           string   `json:"per"` // What it counts by: "ip", "email"
+	Routes        []string `json:"routes"`
+	Requests      int      `json:"requests"`
+	WindowSeconds int64    `json:"window_seconds"`
+}
+
+// deprecation announces a part of the API that will go away.
+type deprecation struct {
+	Feature     string `json:"feature"`     // e.g. "GET /users/{id} email field"
+	Since       string `json:"since"`       // Date it was deprecated, YYYY-MM-DD
+	Sunset      string `json:"sunset"`      // Date it stops working
+	Replacement string `json:"replacement"` // What to use instead
+}
+
+// changelogEntry is one client-visible change to the API.
+type changelogEntry struct {
+	Date    string `json:"date"` // YYYY-MM-DD
+	Version string `json:"version"`
+	Kind    string `json:"kind"` // "added", "changed", "deprecated", "removed"
+	Change  string `json:"change"`
+}
+
+// deprecations lists what's on its way out. Add an entry at least one
+// release before removing anything, and keep it until the sunset date
+// has passed.
+var deprecations = []deprecation{}
+
+// apiChangelog lists client-visible changes, newest first. Add one with
+// every change a client could notice; internal changes don't belong here.
+var apiChangelog = []changelogEntry{
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /invitations/accept sets the password of an account an admin invited, with the token from the invitation email, and returns the user; unusable tokens get 400 invitation.invalid"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "A tenant (X-Tenant-ID) with too many requests in flight gets 503 tenant.busy with Retry-After, when the deployment caps them; retry after it"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /users/{id}/logins (and /me/logins) shows the account's last sign-in time and address and its recent logins, for the user and admins"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /login and POST /auth/refresh take a DPoP proof header and then return token_type \"DPoP\": the token is sent as \"Authorization: DPoP\" with a proof on every request, and the refresh token only refreshes with proofs from the same key. Bad proofs get 400 dpop.invalid_proof or dpop.use_nonce; GET /capabilities reports it as the dpop feature"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Access tokens can be bound to the client certificate they were issued over, or to a secret HttpOnly cookie the API sets; browser apps must send cookies with their API calls, and get 401 and refresh when a token is used without them"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Access tokens may carry some claims (e.g. email, roles) encrypted in an enc claim while the rest stays readable; GET /capabilities reports it as the encrypted_claims feature"},
+	{Date: "2026-10-18", Version: "v1", Kind: "changed", Change: "Emails are trimmed and lowercased (and, where Gmail folding is on, stored without dots or +tags) before they're stored or looked up, so user responses may show a different form than was sent; two signups racing for one email now get 409 email.exists rather than 500"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Users can have a unique username: POST /register and PATCH /users/{id} take username (errors username.invalid, username.reserved, username.taken), user responses include it, and POST /login takes it instead of email"},
+	{Date: "2026-10-18", Version: "v1", Kind: "changed", Change: "Access tokens can live longer or shorter depending on their scopes and audience (read exp, don't assume 15 minutes); sessions can have an absolute lifetime, past which POST /auth/refresh returns 401 refresh_token.invalid"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /users/{id}/deactivate and /activate suspend and restore an account; a deactivated account's logins, refreshes, and tokens get 403 auth.account_deactivated"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /login can be risk-scored; risky attempts need captcha_token, are refused with 403 risk.mfa_required on accounts without 2FA, or 403 risk.blocked. GET /capabilities reports it as the risk_scoring feature"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /users/{id}/anonymize (and /me/anonymize) requests the account's anonymization after a grace period; GET shows and DELETE cancels the pending request"},
+	{Date: "2026-10-18", Version: "v1", Kind: "changed", Change: "POST /auth/mfa/confirm returns 200 with the account's recovery codes instead of 204"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /login takes recovery_code instead of mfa_code and then sets mfa_reenrollment_required; GET/POST /auth/mfa/recovery-codes count and regenerate codes, POST /auth/mfa/reset turns 2FA off after a recovery code login"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /sso/saml/login takes ?return_to= (and ?tenant=) to come back to an allowed page; disallowed URLs get 400 redirect.invalid or redirect.not_allowed"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET/PUT /users/{id}/preferences and /me/preferences store client preferences: validated known keys (theme, language, timezone, density, notification toggles) plus free-form extras"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Browser apps can call the API cross-origin from origins their tenant allows (CORS); preflights are answered for any tenant's origins, requests with X-Tenant-ID for that tenant's"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Integrations can authenticate with HMAC-signed requests on routes configured for it; GET /capabilities reports it as the signed_requests feature"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "PUT /users/{id}/avatar uploads a profile picture; user responses include avatar_url when there is one"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Internal services can authenticate with client certificates on routes configured for it; GET /capabilities reports it as the mtls feature"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "PATCH /users/{id} and PATCH /me update only the fields sent; email and password are rejected when present, even empty"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "The API can be served over HTTP/3, advertised with Alt-Svc; GET /capabilities reports it as the http3 feature"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /users/search finds users for admins by words in their email, best match first"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /users takes ?after as another name for ?cursor"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /users filters by email_prefix, created_from/created_to, and verified, and sorts by created_at or email (-field for descending)"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "User responses include email_verified"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /users lists users for admins, a page at a time, with ?limit, ?cursor, and a total"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "GET /capabilities describes enabled features, limits, versions, and deprecations"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Access tokens may be encrypted (JWE); clients must treat them as opaque"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "Error responses carry a stable code and, for one bad field, its name; GET /error-codes lists them"},
+	{Date: "2026-10-18", Version: "v1", Kind: "added", Change: "POST /register and POST /login take captcha_token when CAPTCHA is enabled"},
+}
+
+// capabilitiesResponse is the body of GET /capabilities.
+type capabilitiesResponse struct {
+	APIVersions     []string         `json:"api_versions"`
+	CurrentVersion  string           `json:"current_version"`
+	Features        map[string]bool  `json:"features"`
+	CaptchaProvider string           `json:"captcha_provider,omitempty"`
+	Limits          limitsResponse   `json:"limits"`
+	Deprecations    []deprecation    `json:"deprecations"`
+	Changelog       []changelogEntry `json:"changelog"`
+}
+
+// limitsResponse is the limits part of GET /capabilities.
+type limitsResponse struct {
+	MaxBodyBytes int64           `json:"max_body_bytes"`
+	RateLimits   []RateLimitInfo `json:"rate_limits"`
+}
+
+// CapabilitiesHandler serves GET /capabilities.
+type CapabilitiesHandler struct {
+	caps Capabilities
+}
+
+// NewCapabilitiesHandler creates a handler reporting caps.
+func NewCapabilitiesHandler(caps Capabilities) *CapabilitiesHandler {
+	return &CapabilitiesHandler{caps: caps}
+}
+
+// RegisterRoutes sets up the capabilities route.
+func (h *CapabilitiesHandler) RegisterRoutes(mux *http.ServeMux) {
+	// Public: clients read it before signing in, e.g. to know whether to
+	// show a CAPTCHA widget on the login form.
+	mux.HandleFunc("GET /capabilities", h.capabilities)
+}
+
+// capabilities handles GET /capabilities
+// Describes what this deployment offers, so clients can adapt to it
+// instead of hard-coding assumptions that differ between deployments.
+//
+// WHY NOT LET CLIENTS PROBE?
+// A client could find out that 2FA is off by calling /auth/mfa/enroll
+// and getting a 404, but it would have to do that for every feature,
+// and a 404 doesn't say "off here" as opposed to "doesn't exist yet".
+func (h *CapabilitiesHandler) capabilities(w http.ResponseWriter, r *http.Request) {
+	var rateLimits []RateLimitInfo
+	if h.caps.RateLimits != nil {
+		rateLimits = h.caps.RateLimits()
+	}
+	writeJSON(w, http.StatusOK, capabilitiesV1(h.caps, rateLimits))
+}
+
+// capabilitiesV1 builds the GET /capabilities response. Lists are never
+// null, so clients can iterate without checking.
+func capabilitiesV1(caps Capabilities, rateLimits []RateLimitInfo) capabilitiesResponse {
+	if rateLimits == nil {
+		rateLimits = []RateLimitInfo{}
+	}
+	resp := capabilitiesResponse{
+		APIVersions:    apiVersions,
+		CurrentVersion: apiVersions[len(apiVersions)-1],
+		Features:       caps.Features,
+		Limits: limitsResponse{
+			MaxBodyBytes: caps.MaxBodySize,
+			RateLimits:   rateLimits,
+		},
+		Deprecations: deprecations,
+		Changelog:    apiChangelog,
+	}
+	if caps.Features[FeatureCaptcha] {
+		resp.CaptchaProvider = caps.CaptchaProvider
+	}
+	return resp
+}
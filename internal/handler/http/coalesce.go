@@ -0,0 +1,188 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/metrics"
+)
+
+// Coalescer merges identical GET requests that arrive at the same time.
+//
+// THE THUNDERING HERD PROBLEM:
+// When one resource gets hot (say, a profile linked from a popular page),
+// hundreds of identical requests can hit the database at the same moment.
+// Each one does exactly the same work and gets exactly the same answer.
+//
+// SINGLEFLIGHT:
+// The first request for a key (the "leader") runs the handler. Requests
+// for the same key that arrive while it's running wait and receive a copy
+// of the leader's response instead of running the handler themselves.
+// Nothing is cached: once the leader finishes, the next request runs fresh.
+//
+// Only wrap handlers that are safe to share:
+//   - GET only (no side effects)
+//   - the response depends on nothing but the path, query, and caller
+//
+// CANCELLATION:
+// The shared call can't use the leader's context: the leader's client
+// leaving would fail everyone else's request. It runs under a context of
+// its own instead, cancelled once every request waiting on it has gone
+// (see flight). Each waiter stops waiting as soon as its own client
+// goes, so nobody is stuck behind a slow leader they no longer need.
+type Coalescer struct {
+	group    singleflight.Group
+	requests *metrics.CounterVec
+
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+// flight tracks the requests waiting on one key's shared call.
+type flight struct {
+	ctx     context.Context // The shared call's context
+	cancel  context.CancelFunc
+	waiters int
+}
+
+// join registers r as waiting on key and returns the context the shared
+// call runs with. Call leave with the same key when r stops waiting.
+func (c *Coalescer) join(key string, r *http.Request) context.Context {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.flights[key]
+	if !ok {
+		// Values (claims, trace IDs) come from the first request; its
+		// cancellation and deadline don't (see CANCELLATION above).
+		ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+		f = &flight{ctx: ctx, cancel: cancel}
+		c.flights[key] = f
+	}
+	f.waiters++
+	return f.ctx
+}
+
+// leave unregisters a waiter on key. The last one out cancels the shared
+// call, if it's still running: nobody is left to read its answer.
+func (c *Coalescer) leave(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.flights[key]
+	f.waiters--
+	if f.waiters == 0 {
+		f.cancel()
+		delete(c.flights, key)
+	}
+}
+
+// NewCoalescer creates a coalescer and registers its metrics.
+func NewCoalescer(reg *metrics.Registry) *Coalescer {
+	return &Coalescer{
+		requests: reg.NewCounterVec("http_coalesced_requests_total",
+			"Requests through coalesced routes by result (leader = ran the handler, shared = copied a concurrent identical response, abandoned = client left before the response).",
+			"route", "result"),
+		flights: make(map[string]*flight),
+	}
+}
+
+// recordedResponse is a handler's response, captured so it can be replayed.
+type recordedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// responseRecorder buffers everything a handler writes.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) Header() http.Header { return r.header }
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+// Wrap returns next with coalescing applied. Routes opt in one by one:
+//
+//	mux.HandleFunc("GET /users/{id}", authMiddleware.AuthenticateFunc(coalescer.Wrap(h.get)))
+//
+// It must run INSIDE Authenticate. The caller's user ID is part of the key,
+// so two users never share a response, even for the same URL.
+//
+// A nil Coalescer returns next unchanged, so coalescing can be switched off
+// without touching route registration.
+func (c *Coalescer) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	if c == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next(w, r)
+			return
+		}
+
+		principal := "anonymous"
+		if claims, ok := auth.GetClaimsFromContext(r.Context()); ok {
+			principal = strconv.FormatUint(claims.UserID, 10)
+		}
+		key := principal + " " + r.URL.RequestURI()
+
+		ctx := c.join(key, r)
+		defer c.leave(key)
+
+		leader := false
+		results := c.group.DoChan(key, func() (interface{}, error) {
+			leader = true
+			rec := &responseRecorder{header: make(http.Header)}
+			next(rec, r.WithContext(ctx))
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			return &recordedResponse{status: rec.status, header: rec.header, body: rec.body.Bytes()}, nil
+		})
+
+		var result singleflight.Result
+		select {
+		case result = <-results:
+		case <-r.Context().Done():
+			// Our client is gone. The call carries on for the others, or
+			// is cancelled by leave if we were the last one waiting.
+			c.requests.Inc(r.Pattern, "abandoned")
+			w.WriteHeader(statusClientClosedRequest)
+			return
+		}
+		// Do's own "shared" flag is also true for the leader whenever anyone
+		// joined it, so count by who actually ran the handler instead.
+		// (leader was set before the result was sent, so reading it is safe.)
+		if leader {
+			c.requests.Inc(r.Pattern, "leader")
+		} else {
+			c.requests.Inc(r.Pattern, "shared")
+		}
+
+		resp := result.Val.(*recordedResponse)
+		for name, values := range resp.header {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		w.WriteHeader(resp.status)
+		w.Write(resp.body)
+	}
+}
@@ -0,0 +1,160 @@
+package http
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+
+	"go-basics/internal/metrics"
+)
+
+// TestMain fails the package's tests if any goroutine outlives them,
+// such as a coalesced call nobody is waiting on any more.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// blockingConnector is a database whose every query blocks until its
+// context is cancelled, so the test can see whether a coalesced query is
+// still running after the requests waiting on it have gone.
+type blockingConnector struct {
+	started  atomic.Int64 // Queries that reached the database
+	inFlight atomic.Int64 // Queries still blocked in it
+}
+
+func (c *blockingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &blockingConn{c}, nil
+}
+
+func (c *blockingConnector) Driver() driver.Driver { return nil }
+
+type blockingConn struct{ c *blockingConnector }
+
+func (*blockingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (*blockingConn) Close() error { return nil }
+
+func (*blockingConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+
+func (conn *blockingConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	conn.c.started.Add(1)
+	conn.c.inFlight.Add(1)
+	defer conn.c.inFlight.Add(-1)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// waitFor polls cond until it holds or a few seconds pass.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestCoalescerCancelledMidFlight aborts every request waiting on one
+// coalesced query, leader first, and checks that nothing outlives them:
+// the query is cancelled, its connection goes back to the pool, and the
+// goroutine count returns to where it started.
+func TestCoalescerCancelledMidFlight(t *testing.T) {
+	connector := &blockingConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	db.SetMaxIdleConns(0) // So a leaked connection shows up in Stats
+
+	baseline := runtime.NumGoroutine()
+
+	coalescer := NewCoalescer(metrics.NewRegistry())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{id}", coalescer.Wrap(func(w http.ResponseWriter, r *http.Request) {
+		var n int
+		if err := db.QueryRowContext(r.Context(), "SELECT 1").Scan(&n); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv := httptest.NewServer(mux)
+	transport := &http.Transport{}
+	client := &http.Client{Transport: transport}
+
+	waiters := func() int {
+		coalescer.mu.Lock()
+		defer coalescer.mu.Unlock()
+		if f, ok := coalescer.flights["anonymous /users/1"]; ok {
+			return f.waiters
+		}
+		return 0
+	}
+
+	const clients = 5
+	cancels := make([]context.CancelFunc, clients)
+	var done sync.WaitGroup
+	for i := range cancels {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		done.Add(1)
+		go func() {
+			defer done.Done()
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+				t.Errorf("request %d: got %s, want it aborted", i, resp.Status)
+			}
+		}()
+		if i == 0 {
+			// The first request leads; the rest must join its query.
+			waitFor(t, "the leader's query", func() bool { return connector.inFlight.Load() == 1 })
+		}
+	}
+	waitFor(t, "every request to join", func() bool { return waiters() == clients })
+
+	// The leader's client leaving must not cancel the query the others share.
+	cancels[0]()
+	waitFor(t, "the leader to leave", func() bool { return waiters() == clients-1 })
+	if got := connector.inFlight.Load(); got != 1 {
+		t.Fatalf("queries in flight after the leader left = %d, want 1", got)
+	}
+
+	// The last one out cancels it.
+	for _, cancel := range cancels[1:] {
+		cancel()
+	}
+	done.Wait()
+	waitFor(t, "the shared query to be cancelled", func() bool { return connector.inFlight.Load() == 0 })
+
+	if got := connector.started.Load(); got != 1 {
+		t.Errorf("queries started = %d, want 1 (the requests were identical)", got)
+	}
+	waitFor(t, "the connection to return to the pool", func() bool { return db.Stats().InUse == 0 })
+	if stats := db.Stats(); stats.OpenConnections != 0 {
+		t.Errorf("open connections = %d, want 0", stats.OpenConnections)
+	}
+	if n := waiters(); n != 0 {
+		t.Errorf("flight still has %d waiters", n)
+	}
+
+	srv.Close()
+	transport.CloseIdleConnections()
+	waitFor(t, "goroutines to return to baseline", func() bool { return runtime.NumGoroutine() <= baseline })
+}
@@ -0,0 +1,94 @@
+package http
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-basics/internal/metrics"
+)
+
+// CORS response header values. Methods and headers are the ones the API
+// uses; exposed headers are the ones a browser app might read besides
+// the few (Content-Type, Cache-Control, ...) it always may.
+const (
+	corsAllowMethods   = "GET, POST, PUT, PATCH, DELETE"
+	corsExposeHeaders  = "Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, Server-Timing, WWW-Authenticate, DPoP-Nonce"
+	corsPreflightCache = "600" // Seconds a browser may reuse a preflight answer
+)
+
+// OriginAllowed reports whether a browser on origin may call the API
+// for the tenant, or, with tenantID empty, for any tenant
+// (tenant.Service.AllowsOrigin).
+type OriginAllowed func(ctx context.Context, tenantID, origin string) (bool, error)
+
+// CORS lets browser apps on the origins tenants allowed (see package
+// tenant) call the API.
+//
+// WHAT IS CORS?
+// A browser won't let a script on https://app.example.com read a
+// response from the API, a different origin, unless the response says
+// that origin may: Access-Control-Allow-Origin. For anything beyond a
+// simple GET (an Authorization header, a JSON body) the browser first
+// asks with an OPTIONS "preflight", and only sends the real request if
+// the answer allows it.
+//
+// A preflight can't carry X-Tenant-ID - it names the headers the real
+// request will send, not their values - so it's answered for the origin
+// alone: allowed if any tenant allows it. The real request is then
+// checked against its own tenant's list, if it names one.
+//
+// Requests without an Origin header (curl, servers, same-origin) pass
+// through untouched: CORS is a browser's protection, not the API's.
+// Neither do disallowed origins get an error: they just don't get the
+// headers, and the browser refuses to hand the response over.
+func CORS(next http.Handler, allowed OriginAllowed) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// The answer depends on Origin: caches must keep one per origin.
+		w.Header().Add("Vary", "Origin")
+
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		tenantID := ""
+		if !preflight {
+			tenantID = r.Header.Get(metrics.TenantHeader)
+		}
+		ok, err := allowed(r.Context(), tenantID, strings.ToLower(origin))
+		if err != nil {
+			// Refused, not allowed blindly; the request still goes
+			// through for clients that don't enforce CORS.
+			log.Printf("CORS: checking origin %q: %v", origin, err)
+		}
+
+		if preflight {
+			if ok {
+				h := w.Header()
+				h.Set("Access-Control-Allow-Origin", origin)
+				h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+				// Whatever headers the app sends are fine once its
+				// origin is trusted; the API checks them itself.
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					h.Set("Access-Control-Allow-Headers", headers)
+				}
+				h.Set("Access-Control-Max-Age", corsPreflightCache)
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+			// A preflight never reaches the routes, which mostly don't
+			// take OPTIONS and would answer 405.
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if ok {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
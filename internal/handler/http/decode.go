@@ -0,0 +1,139 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// RequestError is a problem with the client's request, carrying the
+// status, code, and message to send back. handleServiceError writes it
+// as-is.
+type RequestError struct {
+	Status  int
+	Code    ErrorCode // Empty uses the status's fallback code
+	Field   string    // Empty uses the code's field from the catalog
+	Message string
+}
+
+// Error implements the error interface.
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+// errUnauthorized is returned when a route that needs claims has none.
+// It means Authenticate wasn't applied, so it should never reach clients.
+var errUnauthorized = &RequestError{Status: http.StatusUnauthorized, Code: CodeAuthUnauthorized, Message: "unauthorized"}
+
+// forbidden returns a 403 RequestError for an authenticated caller who
+// isn't allowed to act on the resource.
+func forbidden(message string) *RequestError {
+	return &RequestError{Status: http.StatusForbidden, Code: CodeAuthForbidden, Message: message}
+}
+
+// badRequest returns a 400 RequestError with code and a formatted message.
+func badRequest(code ErrorCode, format string, args ...interface{}) *RequestError {
+	return &RequestError{Status: http.StatusBadRequest, Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// DecodeJSON reads the request body as a single JSON value of type T.
+//
+// Compared to a bare json.NewDecoder(r.Body).Decode(&req), it:
+//   - answers 413 when the body is over the LimitBody cap
+//   - rejects fields T doesn't have, so typos like "emial" fail loudly
+//     instead of being silently ignored
+//   - rejects trailing data after the JSON value
+//   - says WHAT is wrong, e.g. "body.email: expected string, got number"
+//     or "malformed JSON at byte 17", instead of "invalid JSON format"
+//
+// WHY GENERICS?
+// The type parameter lets callers write
+//
+//	req, err := DecodeJSON[loginRequest](r)
+//
+// instead of declaring a variable and passing a pointer, and the compiler
+// checks that the result is used as the right type.
+//
+// The returned error is always a *RequestError; pass it to
+// handleServiceError to send it.
+func DecodeJSON[T any](r *http.Request) (T, error) {
+	var v T
+
+	// The body size is capped by LimitBody, applied to every route.
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&v); err != nil {
+		return v, decodeError(err)
+	}
+	// Decode stops after the first value; anything left is a client bug
+	// (e.g. two objects concatenated) we shouldn't silently accept.
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		return v, badRequest(CodeRequestMultipleValues, "request body must contain a single JSON value")
+	}
+	return v, nil
+}
+
+// decodeError turns an encoding/json error into a client-facing RequestError.
+func decodeError(err error) *RequestError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var tooLarge *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, io.EOF):
+		return badRequest(CodeRequestEmptyBody, "request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return badRequest(CodeRequestMalformedJSON, "malformed JSON: unexpected end of body")
+	case errors.As(err, &syntaxErr):
+		return badRequest(CodeRequestMalformedJSON, "malformed JSON at byte %d", syntaxErr.Offset)
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return badRequest(CodeRequestInvalidType, "body: expected %s, got %s", jsonTypeName(typeErr.Type), typeErr.Value)
+		}
+		e := badRequest(CodeRequestInvalidType, "body.%s: expected %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value)
+		e.Field = typeErr.Field
+		return e
+	case errors.As(err, &tooLarge):
+		return &RequestError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    CodeRequestTooLarge,
+			Message: fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit),
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for this one.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		e := badRequest(CodeRequestUnknownField, "body: unknown field %q", field)
+		e.Field = field
+		return e
+	default:
+		return badRequest(CodeRequestMalformedJSON, "invalid JSON body")
+	}
+}
+
+// jsonTypeName names a Go type the way a JSON client thinks of it,
+// so messages say "expected object" rather than "expected http.loginRequest".
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Map:
+		return "object"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Pointer:
+		return jsonTypeName(t.Elem())
+	default:
+		return t.String()
+	}
+}
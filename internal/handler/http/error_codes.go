@@ -0,0 +1,307 @@
+package http
+
+import (
+	"net/http"
+)
+
+// ErrorCode is a stable, machine-readable name for an error response,
+// sent as "code" next to the human-readable "error":
+//
+//	{"error": "password must be at least 8 characters", "code": "password.too_short", "field": "password"}
+//
+// WHY CODES?
+// The message is written for developers reading responses, in English,
+// and we reword it whenever it reads better. A frontend that matched on
+// it would break each time, and couldn't show its users their own
+// language anyway. The code never changes once published: frontends map
+// it to their own copy, and GET /error-codes lists every one.
+//
+// Codes are "<subject>.<problem>". Add new ones to errorCatalog; never
+// rename or reuse one, only retire it.
+type ErrorCode string
+
+// Error codes, grouped by subject.
+const (
+	// The request as a whole: its body, path, or query.
+	CodeRequestInvalid        ErrorCode = "request.invalid"
+	CodeRequestEmptyBody      ErrorCode = "request.empty_body"
+	CodeRequestMalformedJSON  ErrorCode = "request.malformed_json"
+	CodeRequestMultipleValues ErrorCode = "request.multiple_values"
+	CodeRequestInvalidType    ErrorCode = "request.invalid_type"
+	CodeRequestUnknownField   ErrorCode = "request.unknown_field"
+	CodeRequestTooLarge       ErrorCode = "request.too_large"
+	CodeRequestInvalidID      ErrorCode = "request.invalid_id"
+	CodeRequestInvalidLimit   ErrorCode = "request.invalid_limit"
+	CodeRequestInvalidCursor  ErrorCode = "request.invalid_cursor"
+	CodeRequestInvalidSort    ErrorCode = "request.invalid_sort"
+	CodeRequestInvalidFilter  ErrorCode = "request.invalid_filter"
+	CodeRequestInvalidSearch  ErrorCode = "request.invalid_search"
+
+	CodeEmailRequired           ErrorCode = "email.required"
+	CodeEmailInvalidFormat      ErrorCode = "email.invalid_format"
+	CodeEmailExists             ErrorCode = "email.exists"
+	CodeEmailUnchanged          ErrorCode = "email.unchanged"
+	CodeEmailChangeTokenInvalid ErrorCode = "email.change_token_invalid"
+	CodeEmailReadOnly           ErrorCode = "email.read_only"
+
+	CodeUsernameInvalid  ErrorCode = "username.invalid"
+	CodeUsernameReserved ErrorCode = "username.reserved"
+	CodeUsernameTaken    ErrorCode = "username.taken"
+
+	CodePasswordRequired          ErrorCode = "password.required"
+	CodePasswordTooShort          ErrorCode = "password.too_short"
+	CodePasswordTooLong           ErrorCode = "password.too_long"
+	CodePasswordIncorrect         ErrorCode = "password.incorrect"
+	CodePasswordResetTokenInvalid ErrorCode = "password.reset_token_invalid"
+	CodePasswordReadOnly          ErrorCode = "password.read_only"
+
+	CodeAuthUnauthorized       ErrorCode = "auth.unauthorized"
+	CodeAuthForbidden          ErrorCode = "auth.forbidden"
+	CodeAuthInvalidCredentials ErrorCode = "auth.invalid_credentials"
+	CodeAuthAccountDisabled    ErrorCode = "auth.account_disabled"
+	CodeAuthAccountDeactivated ErrorCode = "auth.account_deactivated"
+	CodeAuthNoLinkedAccount    ErrorCode = "auth.no_linked_account"
+	CodeAuthSSOExpired         ErrorCode = "auth.sso_expired"
+	CodeAuthSSONoEmail         ErrorCode = "auth.sso_no_email"
+
+	CodeMFARequired            ErrorCode = "mfa.required"
+	CodeMFAInvalidCode         ErrorCode = "mfa.invalid_code"
+	CodeMFAInvalidRecoveryCode ErrorCode = "mfa.invalid_recovery_code"
+	CodeMFAAlreadyEnabled      ErrorCode = "mfa.already_enabled"
+	CodeMFANotEnrolled         ErrorCode = "mfa.not_enrolled"
+	CodeMFAResetNotAllowed     ErrorCode = "mfa.reset_not_allowed"
+
+	CodeCaptchaRequired    ErrorCode = "captcha.required"
+	CodeCaptchaFailed      ErrorCode = "captcha.failed"
+	CodeCaptchaUnavailable ErrorCode = "captcha.unavailable"
+
+	CodeRiskBlocked     ErrorCode = "risk.blocked"
+	CodeRiskMFARequired ErrorCode = "risk.mfa_required"
+
+	CodeRefreshTokenRequired ErrorCode = "refresh_token.required"
+	CodeRefreshTokenInvalid  ErrorCode = "refresh_token.invalid"
+
+	CodeDPoPInvalidProof ErrorCode = "dpop.invalid_proof"
+	CodeDPoPUseNonce     ErrorCode = "dpop.use_nonce"
+
+	CodeUserNotFound          ErrorCode = "user.not_found"
+	CodeSessionNotFound       ErrorCode = "session.not_found"
+	CodeRoleUnknown           ErrorCode = "role.unknown"
+	CodeImpersonationSelf     ErrorCode = "impersonation.self"
+	CodeDeactivationSelf      ErrorCode = "deactivation.self"
+	CodeEmailTemplateUnknown  ErrorCode = "email_template.unknown"
+	CodeTunableInvalid        ErrorCode = "tunable.invalid"
+	CodeDiagnosticUnknown     ErrorCode = "diagnostic.unknown_query"
+	CodeDiagnosticInvalid     ErrorCode = "diagnostic.invalid_params"
+	CodeFrequencyInvalid      ErrorCode = "notification.invalid_frequency"
+	CodePushSubscriptionEmpty ErrorCode = "push.subscription_incomplete"
+	CodePushInvalid           ErrorCode = "push.invalid_subscription"
+	CodePushNotFound          ErrorCode = "push.subscription_not_found"
+	CodePushDisabled          ErrorCode = "push.disabled"
+	CodeAvatarRequired        ErrorCode = "avatar.required"
+	CodeAvatarInvalid         ErrorCode = "avatar.invalid_image"
+	CodeAvatarTooLarge        ErrorCode = "avatar.too_many_pixels"
+	CodeTenantInvalidID       ErrorCode = "tenant.invalid_id"
+	CodeTenantPolicyInvalid   ErrorCode = "tenant.invalid_policy"
+	CodeTenantPolicyNotFound  ErrorCode = "tenant.policy_not_found"
+	CodeTenantBusy            ErrorCode = "tenant.busy"
+	CodePreferenceInvalid     ErrorCode = "preferences.invalid_value"
+	CodePreferenceExtras      ErrorCode = "preferences.invalid_extras"
+	CodeRedirectInvalid       ErrorCode = "redirect.invalid"
+	CodeRedirectNotAllowed    ErrorCode = "redirect.not_allowed"
+	CodeAnonymizationPending  ErrorCode = "anonymization.pending"
+	CodeAnonymizationNotFound ErrorCode = "anonymization.not_found"
+	CodeImportUnsupportedType ErrorCode = "import.unsupported_type"
+	CodeImportInvalidHeader   ErrorCode = "import.invalid_header"
+	CodeImportMalformedRow    ErrorCode = "import.malformed_row"
+	CodeImportInvalidHash     ErrorCode = "import.invalid_password_hash"
+	CodeImportRolesForbidden  ErrorCode = "import.roles_forbidden"
+	CodeImportBatchFailed     ErrorCode = "import.batch_failed"
+	CodeExportInvalidFormat   ErrorCode = "export.invalid_format"
+	CodeInvitationInvalid     ErrorCode = "invitation.invalid"
+	CodeInvitationNotFound    ErrorCode = "invitation.not_found"
+	CodeInvitationClosed      ErrorCode = "invitation.closed"
+	CodeCampaignTemplate      ErrorCode = "campaign.invalid_template"
+	CodeCampaignSegment       ErrorCode = "campaign.invalid_segment"
+	CodeCampaignNotFound      ErrorCode = "campaign.not_found"
+	CodeCampaignFinished      ErrorCode = "campaign.finished"
+	CodeDeliveryStatusInvalid ErrorCode = "campaign.invalid_delivery_status"
+
+	// Fallbacks for errors without a code of their own, by status.
+	CodeNotFound    ErrorCode = "not_found"
+	CodeConflict    ErrorCode = "conflict"
+	CodeRateLimited ErrorCode = "rate_limited"
+	CodeInternal    ErrorCode = "internal"
+	CodeUnavailable ErrorCode = "unavailable"
+)
+
+// errorCodeInfo describes one code in the catalog.
+type errorCodeInfo struct {
+	Code        ErrorCode `json:"code"`
+	Status      int       `json:"status"`          // HTTP status it's sent with
+	Field       string    `json:"field,omitempty"` // Request field it's about, if one
+	Description string    `json:"description"`     // What it means, in English
+}
+
+// errorCatalog lists every code, in the order GET /error-codes returns
+// them. Each code is always sent with its Status.
+var errorCatalog = []errorCodeInfo{
+	{CodeRequestInvalid, http.StatusBadRequest, "", "The request is invalid; the message says how"},
+	{CodeRequestEmptyBody, http.StatusBadRequest, "", "The request needs a JSON body"},
+	{CodeRequestMalformedJSON, http.StatusBadRequest, "", "The body isn't valid JSON"},
+	{CodeRequestMultipleValues, http.StatusBadRequest, "", "The body holds more than one JSON value"},
+	{CodeRequestInvalidType, http.StatusBadRequest, "", "A body field has the wrong JSON type; field names it"},
+	{CodeRequestUnknownField, http.StatusBadRequest, "", "The body has a field this endpoint doesn't take; field names it"},
+	{CodeRequestTooLarge, http.StatusRequestEntityTooLarge, "", "The body is over the size limit"},
+	{CodeRequestInvalidID, http.StatusBadRequest, "", "An ID in the path or query isn't a valid ID"},
+	{CodeRequestInvalidLimit, http.StatusBadRequest, "limit", "The limit query parameter is out of range"},
+	{CodeRequestInvalidCursor, http.StatusBadRequest, "cursor", "The cursor (or after) query parameter isn't one this API returned, or came from another listing or sort"},
+	{CodeRequestInvalidSort, http.StatusBadRequest, "sort", "The sort query parameter isn't a field the list can be sorted by"},
+	{CodeRequestInvalidFilter, http.StatusBadRequest, "", "A filter query parameter isn't valid; the message names it"},
+	{CodeRequestInvalidSearch, http.StatusBadRequest, "q", "The search query is missing, too long, or has no letters or digits to search for"},
+
+	{CodeEmailRequired, http.StatusBadRequest, "email", "The email is missing"},
+	{CodeEmailInvalidFormat, http.StatusBadRequest, "email", "The email isn't a valid address"},
+	{CodeEmailExists, http.StatusConflict, "email", "An account with this email already exists"},
+	{CodeEmailUnchanged, http.StatusBadRequest, "email", "The new email is the account's current one"},
+	{CodeEmailChangeTokenInvalid, http.StatusBadRequest, "token", "The email change link is invalid, expired, or used"},
+	{CodeEmailReadOnly, http.StatusBadRequest, "email", "The email can't be changed here; use POST /users/{id}/email"},
+
+	{CodeUsernameInvalid, http.StatusBadRequest, "username", "The username isn't 3 to 30 lowercase letters, digits, underscores, or dots starting with a letter"},
+	{CodeUsernameReserved, http.StatusBadRequest, "username", "The username is reserved and can't be taken"},
+	{CodeUsernameTaken, http.StatusConflict, "username", "Another account has this username"},
+
+	{CodePasswordRequired, http.StatusBadRequest, "password", "The password is missing"},
+	{CodePasswordTooShort, http.StatusBadRequest, "password", "The password is shorter than 8 characters"},
+	{CodePasswordTooLong, http.StatusBadRequest, "password", "The password is longer than 72 bytes"},
+	{CodePasswordIncorrect, http.StatusForbidden, "current_password", "The current password is wrong"},
+	{CodePasswordResetTokenInvalid, http.StatusBadRequest, "token", "The reset link is invalid, expired, or used"},
+	{CodePasswordReadOnly, http.StatusBadRequest, "password", "The password can't be changed here; use POST /users/{id}/password"},
+
+	{CodeAuthUnauthorized, http.StatusUnauthorized, "", "The request needs a valid access token"},
+	{CodeAuthForbidden, http.StatusForbidden, "", "The caller isn't allowed to do this"},
+	{CodeAuthInvalidCredentials, http.StatusUnauthorized, "", "The email or password is wrong"},
+	{CodeAuthAccountDisabled, http.StatusForbidden, "", "The account was disabled for inactivity; an admin can reactivate it"},
+	{CodeAuthAccountDeactivated, http.StatusForbidden, "", "The account was deactivated; an admin can activate it"},
+	{CodeAuthNoLinkedAccount, http.StatusForbidden, "", "Single sign-on succeeded, but there's no account for the email, or its invitation hasn't been accepted"},
+	{CodeAuthSSOExpired, http.StatusBadRequest, "", "The single sign-on attempt expired or wasn't started here"},
+	{CodeAuthSSONoEmail, http.StatusBadRequest, "", "The identity provider sent no email address"},
+
+	{CodeMFARequired, http.StatusUnauthorized, "mfa_code", "The account has two-factor authentication; repeat the login with mfa_code"},
+	{CodeMFAInvalidCode, http.StatusUnauthorized, "mfa_code", "The two-factor code is wrong or expired"},
+	{CodeMFAAlreadyEnabled, http.StatusConflict, "", "Two-factor authentication is already on"},
+	{CodeMFANotEnrolled, http.StatusConflict, "", "Two-factor authentication hasn't been set up"},
+	{CodeMFAInvalidRecoveryCode, http.StatusUnauthorized, "recovery_code", "The recovery code is wrong or was already used"},
+	{CodeMFAResetNotAllowed, http.StatusForbidden, "", "Two-factor authentication can be reset with the password only after signing in with a recovery code"},
+
+	{CodeCaptchaRequired, http.StatusBadRequest, "captcha_token", "The CAPTCHA token is missing"},
+	{CodeCaptchaFailed, http.StatusForbidden, "captcha_token", "The CAPTCHA wasn't solved, or the token expired or was used"},
+	{CodeCaptchaUnavailable, http.StatusServiceUnavailable, "", "The CAPTCHA provider can't be reached; try again later"},
+
+	{CodeRiskBlocked, http.StatusForbidden, "", "The sign-in looked too risky and was refused; try again later or from a device used before"},
+	{CodeRiskMFARequired, http.StatusForbidden, "", "The sign-in looked risky and the account has no two-factor authentication; sign in from a device used before"},
+
+	{CodeRefreshTokenRequired, http.StatusBadRequest, "refresh_token", "The refresh token is missing"},
+	{CodeRefreshTokenInvalid, http.StatusUnauthorized, "refresh_token", "The refresh token is invalid, expired, or revoked; sign in again"},
+
+	{CodeDPoPInvalidProof, http.StatusBadRequest, "", "The DPoP proof is malformed, expired, already used, or not for this request"},
+	{CodeDPoPUseNonce, http.StatusBadRequest, "", "The DPoP proof needs a server nonce; retry with the one in the DPoP-Nonce header"},
+
+	{CodeUserNotFound, http.StatusNotFound, "", "There's no such user"},
+	{CodeSessionNotFound, http.StatusNotFound, "", "There's no such session"},
+	{CodeRoleUnknown, http.StatusBadRequest, "role", "There's no such role"},
+	{CodeImpersonationSelf, http.StatusBadRequest, "", "Admins can't impersonate themselves"},
+	{CodeDeactivationSelf, http.StatusBadRequest, "", "Admins can't deactivate their own account"},
+	{CodeEmailTemplateUnknown, http.StatusNotFound, "", "There's no such email template"},
+	{CodeTunableInvalid, http.StatusBadRequest, "", "The knob value or TTL is invalid"},
+	{CodeDiagnosticUnknown, http.StatusBadRequest, "query", "There's no such diagnostic query; queries lists them"},
+	{CodeDiagnosticInvalid, http.StatusBadRequest, "", "The diagnostic query's parameters are invalid"},
+	{CodeFrequencyInvalid, http.StatusBadRequest, "frequency", "The digest frequency isn't one of immediate, hourly, daily, or weekly"},
+	{CodePushSubscriptionEmpty, http.StatusBadRequest, "", "The push subscription needs endpoint, keys.p256dh, and keys.auth"},
+	{CodePushInvalid, http.StatusBadRequest, "", "The push subscription's endpoint or keys are invalid"},
+	{CodePushNotFound, http.StatusNotFound, "", "There's no such push subscription"},
+	{CodePushDisabled, http.StatusNotFound, "", "Web push isn't enabled on this server"},
+	{CodeAvatarRequired, http.StatusBadRequest, "avatar", "The upload isn't multipart/form-data with the picture in the avatar field"},
+	{CodeAvatarInvalid, http.StatusBadRequest, "avatar", "The picture isn't a JPEG, PNG, or GIF, or is corrupt"},
+	{CodeAvatarTooLarge, http.StatusBadRequest, "avatar", "The picture has more than 40 megapixels"},
+	{CodeTenantInvalidID, http.StatusBadRequest, "tenant", "The tenant ID isn't 1-64 letters, digits, '.', '_', or '-'"},
+	{CodeTenantPolicyInvalid, http.StatusBadRequest, "", "An origin, redirect URI, or webhook URL is malformed, or a wildcard or plain http in production"},
+	{CodeTenantPolicyNotFound, http.StatusNotFound, "", "The tenant has no policy"},
+	{CodeTenantBusy, http.StatusServiceUnavailable, "", "The tenant has too many requests in flight; retry after the Retry-After seconds"},
+	{CodePreferenceInvalid, http.StatusBadRequest, "", "A known preference (theme, density, language, or timezone) has an invalid value; field names it"},
+	{CodePreferenceExtras, http.StatusBadRequest, "extras", "A preference extra's key is malformed, or the extras exceed 64 keys or 8 KiB"},
+	{CodeRedirectInvalid, http.StatusBadRequest, "return_to", "The return URL isn't an http(s) URL or a path, or has user info, a fragment, backslashes, or control characters"},
+	{CodeRedirectNotAllowed, http.StatusBadRequest, "return_to", "The return URL isn't in REDIRECT_ALLOWED_URLS or the tenant's redirect URIs"},
+	{CodeAnonymizationPending, http.StatusConflict, "", "The user's anonymization was already requested; cancel it to request again"},
+	{CodeAnonymizationNotFound, http.StatusNotFound, "", "The user has no anonymization request pending"},
+	{CodeImportUnsupportedType, http.StatusUnsupportedMediaType, "", "The import isn't text/csv or application/x-ndjson"},
+	{CodeImportInvalidHeader, http.StatusBadRequest, "", "The CSV header has no email column, or a column the import doesn't take"},
+	{CodeImportMalformedRow, http.StatusBadRequest, "", "An import row isn't valid CSV or JSON, or a field has the wrong type"},
+	{CodeImportInvalidHash, http.StatusBadRequest, "password_hash", "An import row's password hash isn't bcrypt or Argon2id"},
+	{CodeImportRolesForbidden, http.StatusForbidden, "roles", "An import row grants roles, which needs the roles:manage scope"},
+	{CodeImportBatchFailed, http.StatusInternalServerError, "", "An import row's batch was rolled back by a database error; import it again"},
+	{CodeExportInvalidFormat, http.StatusBadRequest, "format", "The export format isn't csv or ndjson"},
+	{CodeInvitationInvalid, http.StatusBadRequest, "token", "The invitation link is invalid or expired, or was used or revoked"},
+	{CodeInvitationNotFound, http.StatusNotFound, "", "There's no such invitation"},
+	{CodeInvitationClosed, http.StatusConflict, "", "The invitation was already accepted or revoked"},
+	{CodeCampaignTemplate, http.StatusBadRequest, "body", "The campaign's subject or body is missing, too long, or not a valid template over .ID, .Email, and .Username"},
+	{CodeCampaignSegment, http.StatusBadRequest, "segment", "The campaign's segment names an unknown role, or a range that ends before it starts"},
+	{CodeCampaignNotFound, http.StatusNotFound, "", "There's no such campaign"},
+	{CodeCampaignFinished, http.StatusConflict, "", "The campaign already completed or was canceled"},
+	{CodeDeliveryStatusInvalid, http.StatusBadRequest, "status", "The delivery status isn't sent, failed, or skipped"},
+
+	{CodeNotFound, http.StatusNotFound, "", "Not found"},
+	{CodeConflict, http.StatusConflict, "", "The request conflicts with the current state"},
+	{CodeRateLimited, http.StatusTooManyRequests, "", "Too many requests; retry later"},
+	{CodeInternal, http.StatusInternalServerError, "", "Something went wrong on our side"},
+	{CodeUnavailable, http.StatusServiceUnavailable, "", "The service is temporarily unavailable"},
+}
+
+// errorCodes indexes errorCatalog by code.
+var errorCodes = func() map[ErrorCode]errorCodeInfo {
+	codes := make(map[ErrorCode]errorCodeInfo, len(errorCatalog))
+	for _, info := range errorCatalog {
+		codes[info.Code] = info
+	}
+	return codes
+}()
+
+// statusCode is the fallback code for an error sent with status but no
+// code of its own.
+func statusCode(status int) ErrorCode {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeRequestInvalid
+	case http.StatusUnauthorized:
+		return CodeAuthUnauthorized
+	case http.StatusForbidden:
+		return CodeAuthForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeRequestTooLarge
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
+
+// writeCode writes an error response with code, its catalog status and
+// field, and message.
+func writeCode(w http.ResponseWriter, code ErrorCode, message string) {
+	info := errorCodes[code]
+	writeJSON(w, info.Status, errorResponse{Error: message, Code: code, Field: info.Field})
+}
+
+// ErrorCodes handles GET /error-codes
+// Returns the catalog of error codes, for frontends mapping them to
+// their own copy. It's public: the codes are no secret, and clients need
+// them before anyone signs in.
+func ErrorCodes(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"codes": errorCatalog})
+}
@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"net/http"
+
+	"go-basics/internal/timing"
+)
+
+// Middleware wraps a handler with extra behavior, e.g. a rate limiter.
+type Middleware func(http.HandlerFunc) http.HandlerFunc
+
+// Validator is implemented by request DTOs that can check themselves.
+// Handle calls Validate after decoding; a non-nil error is sent through
+// handleServiceError, so return a *RequestError or a domain error.
+type Validator interface {
+	Validate() error
+}
+
+// requestBinder is implemented by request DTOs that take values from the
+// URL (path parameters) rather than, or in addition to, the JSON body.
+type requestBinder interface {
+	bind(r *http.Request) error
+}
+
+// NoContent is the response type for endpoints that return no body.
+// Use it with WithStatus(http.StatusNoContent).
+type NoContent struct{}
+
+// handleConfig holds the optional settings for Handle.
+type handleConfig struct {
+	status int
+}
+
+// HandleOption configures Handle.
+type HandleOption func(*handleConfig)
+
+// WithStatus sets the status code for successful responses (default 200).
+func WithStatus(status int) HandleOption {
+	return func(c *handleConfig) {
+		c.status = status
+	}
+}
+
+// Handle adapts a typed function to an http.HandlerFunc.
+//
+// THE BOILERPLATE IT REMOVES:
+// Every handler used to repeat the same steps: decode the body, parse path
+// parameters, call the service, map the error to a status, encode the
+// response. Handle does those once, so an endpoint is written as a plain
+// function from a request DTO to a response DTO:
+//
+//	mux.HandleFunc("GET /users/{id}", Handle(h.get))
+//
+//	func (h *UserHandler) get(ctx context.Context, req userIDRequest) (userResponse, error)
+//
+// For each request, Handle:
+//  1. decodes the JSON body into Req (POST, PUT, and PATCH only)
+//  2. lets Req read path parameters, if it has a bind method
+//  3. calls Req.Validate, if Req implements Validator
+//  4. calls fn with the request context (claims are available through
+//     auth.GetClaimsFromContext as usual)
+//  5. writes the error with handleServiceError, or Resp as JSON
+//
+// Handlers that need the raw request beyond that (e.g. to record metrics
+// for malformed bodies) are still written as plain http.HandlerFuncs.
+func Handle[Req, Resp any](fn func(ctx context.Context, req Req) (Resp, error), opts ...HandleOption) http.HandlerFunc {
+	cfg := handleConfig{status: http.StatusOK}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req Req
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+			decoded, err := DecodeJSON[Req](r)
+			if err != nil {
+				handleServiceError(w, err)
+				return
+			}
+			req = decoded
+		}
+
+		// Check *Req: bind has to modify the request, so it (and usually
+		// Validate alongside it) is declared on the pointer receiver.
+		if b, ok := interface{}(&req).(requestBinder); ok {
+			if err := b.bind(r); err != nil {
+				handleServiceError(w, err)
+				return
+			}
+		}
+		if v, ok := interface{}(&req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				handleServiceError(w, err)
+				return
+			}
+		}
+
+		endService := timing.Start(r.Context(), timing.Service)
+		resp, err := fn(r.Context(), req)
+		endService()
+		if err != nil {
+			handleServiceError(w, err)
+			return
+		}
+
+		if cfg.status == http.StatusNoContent {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeJSON(w, cfg.status, resp)
+	}
+}
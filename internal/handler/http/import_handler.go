@@ -0,0 +1,417 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/txn"
+)
+
+// Import file formats, by Content-Type.
+//
+// CSV has a header row naming its columns, in any order; only email is
+// required. Roles are separated by ";":
+//
+//	email,username,password_hash,email_verified,roles
+//	ann@example.com,ann,$2a$10$...,true,user;admin
+//
+// NDJSON has one JSON object per line, with the same fields:
+//
+//	{"email": "ann@example.com", "password_hash": "$2a$10$...", "email_verified": true}
+const (
+	importCSV    = "text/csv"
+	importNDJSON = "application/x-ndjson"
+)
+
+// importColumns are the CSV columns the import takes.
+var importColumns = map[string]bool{
+	"email": true, "username": true, "password_hash": true, "email_verified": true, "roles": true,
+}
+
+// importLine is one NDJSON line.
+type importLine struct {
+	Email         string   `json:"email"`
+	Username      string   `json:"username"`
+	PasswordHash  string   `json:"password_hash"`
+	EmailVerified bool     `json:"email_verified"`
+	Roles         []string `json:"roles"`
+}
+
+// importRowResponse is what became of one row.
+type importRowResponse struct {
+	Line   int               `json:"line"` // In the file, counting the CSV header
+	Email  string            `json:"email,omitempty"`
+	Status user.ImportStatus `json:"status"` // created, skipped, or error
+	UserID uint64            `json:"user_id,omitempty"`
+	Code   ErrorCode         `json:"code,omitempty"` // Why it was skipped or failed
+	Error  string            `json:"error,omitempty"`
+}
+
+// importResponse is the response for POST /admin/users/import.
+type importResponse struct {
+	Created int                 `json:"created"`
+	Skipped int                 `json:"skipped"`
+	Failed  int                 `json:"failed"`
+	Rows    []importRowResponse `json:"rows"`
+
+	// Code and Error say why the file was only read partway. Rows
+	// before that point are in Rows, and were imported.
+	Code  ErrorCode `json:"code,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// importRecord is a row read from the file, not yet imported.
+type importRecord struct {
+	line  int
+	email string
+	row   user.ImportRow
+	err   error // The row couldn't be read; it isn't imported
+}
+
+// importRowError is a row that couldn't be read: bad CSV or JSON, or a
+// field of the wrong type.
+type importRowError struct {
+	msg string
+}
+
+func (e *importRowError) Error() string { return e.msg }
+
+// errImportRoles is a row granting roles, from a caller who can't.
+var errImportRoles = errors.New("granting roles needs the roles:manage scope")
+
+// ImportHandler handles bulk user imports from another system.
+type ImportHandler struct {
+	users      *user.Service
+	audit      *audit.Logger
+	adminToken string
+	maxSize    int64 // Largest accepted file, in bytes (IMPORT_MAX_BODY_SIZE)
+	batchSize  int   // Rows per transaction (IMPORT_BATCH_SIZE)
+}
+
+// NewImportHandler creates a new import handler. Like the diagnostics
+// routes, imports need the static admin token; an empty adminToken
+// disables them.
+func NewImportHandler(users *user.Service, auditLog *audit.Logger, adminToken string, maxSize int64, batchSize int) *ImportHandler {
+	return &ImportHandler{users: users, audit: auditLog, adminToken: adminToken, maxSize: maxSize, batchSize: batchSize}
+}
+
+// RegisterRoutes sets up the import route. Creating accounts takes the
+// accounts:manage scope; rows that grant roles also take roles:manage.
+func (h *ImportHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	manage := auth.RequireScope(auth.ScopeAccountsManage)
+	requireToken := auth.RequireToken(AdminTokenHeader, h.adminToken)
+	mux.HandleFunc("POST /admin/users/import", authMiddleware.AuthenticateFunc(manage(requireToken(h.importUsers))))
+}
+
+// BodyLimits returns the import route's body limit, which replaces
+// SERVER_MAX_BODY_SIZE on it (see LimitBody).
+func (h *ImportHandler) BodyLimits() map[string]int64 {
+	return map[string]int64{"POST /admin/users/import": h.maxSize}
+}
+
+// importUsers handles POST /admin/users/import
+// Creates the users in a CSV or NDJSON file, from a legacy system, and
+// reports what became of each row: created, skipped (the email has an
+// account already), or error (the row is invalid).
+//
+// The file is read as it arrives and written IMPORT_BATCH_SIZE rows per
+// transaction, so neither the file nor one huge transaction has to fit
+// anywhere. A batch that fails on a database error rolls back alone, and
+// its rows are reported as import.batch_failed.
+//
+// A file that can't be read to the end (it's too large, or a line
+// isn't NDJSON at all) gets the report with code and error set, and that
+// code's status. The rows read before that point were still imported.
+//
+// WHY IS RUNNING IT TWICE SAFE?
+// Existing emails are skipped, not overwritten. After a partial import
+// (a batch failed, or the connection dropped) the same file can be sent
+// again: what made it in is skipped, and the rest is created.
+func (h *ImportHandler) importUsers(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetClaimsFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var next func() (importRecord, error)
+	switch mediaType {
+	case importCSV:
+		var err error
+		if next, err = csvImportRows(r.Body); err != nil {
+			writeCode(w, CodeImportInvalidHeader, err.Error())
+			return
+		}
+	case importNDJSON:
+		next = ndjsonImportRows(r.Body)
+	default:
+		writeCode(w, CodeImportUnsupportedType, "import must be "+importCSV+" or "+importNDJSON)
+		return
+	}
+	canGrant := claims.HasScope(auth.ScopeRolesManage)
+
+	var resp importResponse
+	var batch []importRecord
+	flush := func() {
+		h.importBatch(r, batch, &resp)
+		batch = batch[:0]
+	}
+	for {
+		rec, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The rest of the file is unreadable. What was read still
+			// goes in, and the report says where it stopped.
+			resp.Code, resp.Error = CodeImportMalformedRow, fmt.Sprintf("reading the import stopped: %v", err)
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				resp.Code, resp.Error = CodeRequestTooLarge, fmt.Sprintf("import is larger than %d bytes; rows after the limit weren't read", maxBytes.Limit)
+			}
+			break
+		}
+		if rec.err == nil && !canGrant && grantsRoles(rec.row.Roles) {
+			rec.err = errImportRoles
+		}
+		if rec.err != nil {
+			resp.add(rec, user.ImportResult{Status: user.ImportFailed, Err: rec.err})
+			continue
+		}
+		if batch = append(batch, rec); len(batch) >= h.batchSize {
+			flush()
+		}
+	}
+	flush()
+
+	// Unreadable rows were reported as they came, batched ones after.
+	sort.Slice(resp.Rows, func(i, j int) bool { return resp.Rows[i].Line < resp.Rows[j].Line })
+	h.audit.Record(r.Context(), audit.CategoryAdmin, actorName(r.Context()), "imported users: %d created, %d skipped, %d failed",
+		resp.Created, resp.Skipped, resp.Failed)
+	status := http.StatusOK
+	if resp.Code != "" {
+		status = errorCodes[resp.Code].Status
+	}
+	writeJSON(w, status, resp)
+}
+
+// importBatch imports records in one transaction and adds them to resp.
+func (h *ImportHandler) importBatch(r *http.Request, records []importRecord, resp *importResponse) {
+	if len(records) == 0 {
+		return
+	}
+	results := make([]user.ImportResult, len(records))
+	err := txn.Run(r.Context(), func(ctx context.Context) error {
+		for i, rec := range records {
+			result, err := h.users.Import(ctx, rec.row)
+			if err != nil {
+				return err
+			}
+			results[i] = result
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("user import: batch from line %d: %v", records[0].line, err)
+	}
+	for i, rec := range records {
+		if err != nil {
+			results[i] = user.ImportResult{Status: user.ImportFailed, Err: errImportBatch}
+		}
+		resp.add(rec, results[i])
+	}
+}
+
+// errImportBatch is a row whose batch rolled back.
+var errImportBatch = errors.New("batch rolled back on a database error; import the row again")
+
+// add reports what became of rec.
+func (resp *importResponse) add(rec importRecord, result user.ImportResult) {
+	row := importRowResponse{Line: rec.line, Email: rec.email, Status: result.Status, UserID: result.UserID}
+	if result.Err != nil {
+		row.Code, row.Error = importErrorCode(result.Err)
+	}
+	switch result.Status {
+	case user.ImportCreated:
+		resp.Created++
+	case user.ImportSkipped:
+		resp.Skipped++
+	default:
+		resp.Failed++
+	}
+	resp.Rows = append(resp.Rows, row)
+}
+
+// importErrorCode returns the code and message for a row's error.
+func importErrorCode(err error) (ErrorCode, string) {
+	var rowErr *importRowError
+	switch {
+	case errors.As(err, &rowErr):
+		return CodeImportMalformedRow, rowErr.msg
+	case errors.Is(err, user.ErrEmailExists):
+		return CodeEmailExists, "email already exists"
+	case errors.Is(err, user.ErrInvalidEmail):
+		return CodeEmailInvalidFormat, "invalid email format"
+	case errors.Is(err, user.ErrInvalidUsername):
+		return CodeUsernameInvalid, "invalid username"
+	case errors.Is(err, user.ErrUsernameReserved):
+		return CodeUsernameReserved, "username is reserved"
+	case errors.Is(err, user.ErrUsernameTaken):
+		return CodeUsernameTaken, "username is taken"
+	case errors.Is(err, user.ErrUnsupportedHash):
+		return CodeImportInvalidHash, "password_hash isn't a bcrypt or Argon2id hash"
+	case errors.Is(err, user.ErrUnknownRole):
+		return CodeRoleUnknown, "unknown role"
+	case errors.Is(err, errImportRoles):
+		return CodeImportRolesForbidden, err.Error()
+	default:
+		return CodeImportBatchFailed, err.Error()
+	}
+}
+
+// grantsRoles reports whether roles has more than the role every
+// account gets anyway.
+func grantsRoles(roles []user.Role) bool {
+	for _, role := range roles {
+		if role != user.RoleUser {
+			return true
+		}
+	}
+	return false
+}
+
+// parseImportRoles parses role names; unknown ones fail the row.
+func parseImportRoles(names []string) ([]user.Role, error) {
+	roles := make([]user.Role, 0, len(names))
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		role, err := user.ParseRole(name)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// csvImportRows reads the CSV header from body and returns a function
+// that reads one row per call, and io.EOF at the end.
+func csvImportRows(body io.Reader) (func() (importRecord, error), error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1 // Checked below, with a clearer message
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading the CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !importColumns[name] {
+			return nil, fmt.Errorf("unknown column %q in the CSV header", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["email"]; !ok {
+		return nil, errors.New("the CSV header has no email column")
+	}
+
+	return func() (importRecord, error) {
+		for {
+			fields, err := reader.Read()
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				// A bad quote spoils its row, not the reader.
+				return importRecord{line: parseErr.StartLine, err: &importRowError{msg: parseErr.Err.Error()}}, nil
+			}
+			if err != nil {
+				return importRecord{}, err
+			}
+			line, _ := reader.FieldPos(0)
+			if len(fields) == 1 && strings.TrimSpace(fields[0]) == "" {
+				continue // A blank line
+			}
+			if len(fields) != len(header) {
+				return importRecord{line: line, err: &importRowError{msg: fmt.Sprintf("row has %d fields, the header %d", len(fields), len(header))}}, nil
+			}
+
+			field := func(name string) string {
+				if i, ok := columns[name]; ok {
+					return strings.TrimSpace(fields[i])
+				}
+				return ""
+			}
+			rec := importRecord{line: line, email: field("email")}
+			rec.row = user.ImportRow{Email: rec.email, Username: field("username"), PasswordHash: field("password_hash")}
+			if verified := field("email_verified"); verified != "" {
+				if rec.row.EmailVerified, err = strconv.ParseBool(verified); err != nil {
+					rec.err = &importRowError{msg: fmt.Sprintf("email_verified %q is not true or false", verified)}
+					return rec, nil
+				}
+			}
+			if roles := field("roles"); roles != "" {
+				rec.row.Roles, rec.err = parseImportRoles(strings.Split(roles, ";"))
+			}
+			return rec, nil
+		}
+	}, nil
+}
+
+// maxImportLine caps an NDJSON line. A user is a few hundred bytes; a
+// line this long is a file that isn't NDJSON.
+const maxImportLine = 64 << 10
+
+// ndjsonImportRows returns a function that reads one NDJSON row from
+// body per call, and io.EOF at the end.
+func ndjsonImportRows(body io.Reader) func() (importRecord, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 4096), maxImportLine)
+	line := 0
+
+	return func() (importRecord, error) {
+		for scanner.Scan() {
+			line++
+			text := bytes.TrimSpace(scanner.Bytes())
+			if len(text) == 0 {
+				continue
+			}
+
+			var l importLine
+			dec := json.NewDecoder(bytes.NewReader(text))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&l); err != nil {
+				return importRecord{line: line, err: &importRowError{msg: err.Error()}}, nil
+			}
+			if dec.More() {
+				return importRecord{line: line, err: &importRowError{msg: "line holds more than one JSON value"}}, nil
+			}
+
+			rec := importRecord{line: line, email: l.Email}
+			rec.row = user.ImportRow{Email: l.Email, Username: l.Username, PasswordHash: l.PasswordHash, EmailVerified: l.EmailVerified}
+			rec.row.Roles, rec.err = parseImportRoles(l.Roles)
+			return rec, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return importRecord{}, err
+		}
+		return importRecord{}, io.EOF
+	}
+}
@@ -0,0 +1,192 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/txn"
+)
+
+// Limits for the list in GET /invitations.
+const (
+	defaultInvitationListLimit = 50
+	maxInvitationListLimit     = 500
+)
+
+// inviteRequest is the expected JSON body for POST /invitations.
+type inviteRequest struct {
+	Email string `json:"email"`
+}
+
+// invitationIDRequest is the request for routes that act on one
+// invitation.
+type invitationIDRequest struct {
+	ID uint64
+}
+
+// bind reads the invitation ID from the path (see Handle).
+func (req *invitationIDRequest) bind(r *http.Request) error {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return badRequest(CodeRequestInvalidID, "invalid invitation ID")
+	}
+	req.ID = id
+	return nil
+}
+
+// invitationListRequest is the request for GET /invitations.
+type invitationListRequest struct {
+	Limit int
+}
+
+// bind reads ?limit (see Handle).
+func (req *invitationListRequest) bind(r *http.Request) error {
+	req.Limit = defaultInvitationListLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxInvitationListLimit {
+			return badRequest(CodeRequestInvalidLimit, "limit must be between 1 and %d", maxInvitationListLimit)
+		}
+		req.Limit = n
+	}
+	return nil
+}
+
+// acceptInvitationRequest is the expected JSON body for
+// POST /invitations/accept.
+type acceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// invitationResponse is one invitation. Unset times are left out.
+type invitationResponse struct {
+	ID         uint64                `json:"id"`
+	UserID     uint64                `json:"user_id"`
+	Email      string                `json:"email"`
+	InvitedBy  uint64                `json:"invited_by"`
+	Status     user.InvitationStatus `json:"status"`
+	CreatedAt  time.Time             `json:"created_at"`
+	SentAt     time.Time             `json:"sent_at"`
+	ExpiresAt  time.Time             `json:"expires_at"`
+	AcceptedAt *time.Time            `json:"accepted_at,omitempty"`
+	RevokedAt  *time.Time            `json:"revoked_at,omitempty"`
+}
+
+// invitationListResponse is the response for GET /invitations.
+type invitationListResponse struct {
+	Invitations []invitationResponse `json:"invitations"`
+}
+
+// InvitationHandler handles inviting users: admins invite, resend, and
+// revoke; invitees accept.
+type InvitationHandler struct {
+	invitations *user.Invitations
+	audit       *audit.Logger
+}
+
+// NewInvitationHandler creates a new invitation handler. Invitations
+// sent and revoked are recorded in auditLog.
+func NewInvitationHandler(invitations *user.Invitations, auditLog *audit.Logger) *InvitationHandler {
+	return &InvitationHandler{invitations: invitations, audit: auditLog}
+}
+
+// RegisterRoutes sets up the invitation routes. Managing invitations
+// needs a JWT with the users:invite scope; accepting one takes only the
+// token, since the invitee has no way to sign in yet.
+func (h *InvitationHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	invite := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeUsersInvite)(next))
+	}
+	// The account, its role, and the invitation are created together.
+	mux.HandleFunc("POST /invitations", invite(txn.Middleware(Handle(h.invite, WithStatus(http.StatusCreated)))))
+	mux.HandleFunc("GET /invitations", invite(Handle(h.list)))
+	mux.HandleFunc("POST /invitations/{id}/resend", invite(Handle(h.resend)))
+	mux.HandleFunc("DELETE /invitations/{id}", invite(Handle(h.revoke, WithStatus(http.StatusNoContent))))
+	// The password and the accepted invitation commit together.
+	mux.HandleFunc("POST /invitations/accept", txn.Middleware(Handle(h.accept)))
+}
+
+// invite handles POST /invitations
+// Creates a pending account for the email and emails it an invitation.
+func (h *InvitationHandler) invite(ctx context.Context, req inviteRequest) (invitationResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return invitationResponse{}, errUnauthorized
+	}
+	inv, err := h.invitations.Invite(ctx, req.Email, claims.UserID)
+	if err != nil {
+		return invitationResponse{}, err
+	}
+	h.audit.Record(ctx, audit.CategoryAdmin, actorName(ctx), "invited user %d (invitation %d)", inv.UserID, inv.ID)
+	return invitationV1(inv), nil
+}
+
+// list handles GET /invitations
+// Returns the newest invitations, whatever their status.
+func (h *InvitationHandler) list(ctx context.Context, req invitationListRequest) (invitationListResponse, error) {
+	invs, err := h.invitations.Invitations(ctx, req.Limit)
+	if err != nil {
+		return invitationListResponse{}, err
+	}
+	resp := invitationListResponse{Invitations: make([]invitationResponse, 0, len(invs))}
+	for i := range invs {
+		resp.Invitations = append(resp.Invitations, invitationV1(&invs[i]))
+	}
+	return resp, nil
+}
+
+// resend handles POST /invitations/{id}/resend
+// Emails a new link, valid for INVITATION_TOKEN_TTL again; the old one
+// stops working. Expired invitations can be resent.
+func (h *InvitationHandler) resend(ctx context.Context, req invitationIDRequest) (invitationResponse, error) {
+	inv, err := h.invitations.Resend(ctx, req.ID)
+	if err != nil {
+		return invitationResponse{}, err
+	}
+	return invitationV1(inv), nil
+}
+
+// revoke handles DELETE /invitations/{id}
+// The link stops working. The pending account stays, and can be
+// invited again.
+func (h *InvitationHandler) revoke(ctx context.Context, req invitationIDRequest) (NoContent, error) {
+	inv, err := h.invitations.Revoke(ctx, req.ID)
+	if err != nil {
+		return NoContent{}, err
+	}
+	h.audit.Record(ctx, audit.CategoryAdmin, actorName(ctx), "revoked invitation %d of user %d", inv.ID, inv.UserID)
+	return NoContent{}, nil
+}
+
+// accept handles POST /invitations/accept
+// Sets the invited account's password using the token from the
+// invitation email. The invitee signs in as usual afterwards.
+func (h *InvitationHandler) accept(ctx context.Context, req acceptInvitationRequest) (userResponse, error) {
+	u, err := h.invitations.Accept(ctx, req.Token, req.Password)
+	if err != nil {
+		return userResponse{}, err
+	}
+	return userV1(u), nil
+}
+
+// invitationV1 converts an invitation to its response.
+func invitationV1(inv *user.Invitation) invitationResponse {
+	return invitationResponse{
+		ID:         inv.ID,
+		UserID:     inv.UserID,
+		Email:      inv.Email,
+		InvitedBy:  inv.InvitedBy,
+		Status:     inv.Status(time.Now()),
+		CreatedAt:  inv.CreatedAt,
+		SentAt:     inv.SentAt,
+		ExpiresAt:  inv.ExpiresAt,
+		AcceptedAt: inv.AcceptedAt,
+		RevokedAt:  inv.RevokedAt,
+	}
+}
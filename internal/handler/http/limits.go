@@ -0,0 +1,77 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// LimitBody caps every request body at limit bytes (SERVER_MAX_BODY_SIZE),
+// except on the routes in larger, by pattern, which get their own cap
+// (e.g. avatar uploads; see AvatarHandler.BodyLimits).
+//
+// A request that announces a larger Content-Length is rejected with 413
+// before any handler runs. For chunked bodies of unknown length, the body
+// is wrapped in http.MaxBytesReader, so reading past the limit fails with
+// *http.MaxBytesError, which DecodeJSON also turns into a 413.
+//
+// WHY HERE AND NOT IN EACH HANDLER?
+// Handlers read bodies in several places (DecodeJSON, the rate limiter's
+// email key). One limit at the edge covers them all, including routes
+// added later, and is configured in one place.
+//
+// The route is looked up in mux before it's served: the cap has to be
+// on the body before any handler reads it, and ServeMux only sets
+// r.Pattern on the way in.
+func LimitBody(mux *http.ServeMux, limit int64, larger map[string]int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := limit
+		if len(larger) > 0 {
+			if _, pattern := mux.Handler(r); larger[pattern] > 0 {
+				limit = larger[pattern]
+			}
+		}
+		if r.ContentLength > limit {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body must not exceed %d bytes", limit))
+			return
+		}
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Deadline gives every request's context a deadline timeout from now
+// (SERVER_WRITE_TIMEOUT), except on the routes of mux in longer, by
+// pattern, which get their own (e.g. the user export; see
+// ExportHandler.Timeouts). Zero leaves requests without one.
+//
+// WHY? THE SERVER HAS A WRITE TIMEOUT ALREADY.
+// http.Server's WriteTimeout only makes writes to the connection fail
+// after it; it doesn't stop the handler. A handler stuck behind a slow
+// query or a queue of password hashes would keep going, holding a
+// database connection, long after its response could be sent. The
+// request context is what every layer below watches (the password
+// hasher, every SQL query), so putting the same limit on it stops them
+// all when the response is no longer deliverable. A client that
+// disconnects cancels the same context sooner.
+//
+// Routes are looked up in mux the way LimitBody does.
+func Deadline(next http.Handler, timeout time.Duration, mux *http.ServeMux, longer map[string]time.Duration) http.Handler {
+	if timeout <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := timeout
+		if len(longer) > 0 {
+			if _, pattern := mux.Handler(r); longer[pattern] > 0 {
+				timeout = longer[pattern]
+			}
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,42 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+)
+
+// maintenanceRetryAfter is the Retry-After sent during maintenance, in seconds.
+const maintenanceRetryAfter = "60"
+
+// Maintenance answers 503 Service Unavailable while enabled() is true,
+// e.g. during a database migration that can't run online.
+//
+// Some routes stay up, or maintenance mode couldn't be watched or ended:
+//   - /health, /ready, and /metrics, for the load balancer and monitoring
+//   - /admin/..., where maintenance mode is switched off again
+//   - POST /login and POST /auth/refresh, so an operator can get the
+//     token the admin routes need
+//
+// enabled is called on every request, so it must be cheap (an atomic
+// load, like a tunables knob).
+func Maintenance(next http.Handler, enabled func() bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !enabled() || maintenanceExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", maintenanceRetryAfter)
+		writeError(w, http.StatusServiceUnavailable, "down for maintenance, please retry later")
+	})
+}
+
+// maintenanceExempt reports whether r is served during maintenance.
+func maintenanceExempt(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/health", "/ready", "/metrics":
+		return true
+	case "/login", "/auth/refresh":
+		return r.Method == http.MethodPost
+	}
+	return strings.HasPrefix(r.URL.Path, "/admin/")
+}
@@ -0,0 +1,204 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/notification"
+	"go-basics/internal/webpush"
+)
+
+// notificationSettingsRequest is the expected JSON body for
+// PUT /me/notifications.
+type notificationSettingsRequest struct {
+	Frequency string `json:"frequency"`
+}
+
+// notificationSettingsResponse is the caller's notification settings.
+type notificationSettingsResponse struct {
+	Frequency   notification.Frequency   `json:"frequency"`
+	Frequencies []notification.Frequency `json:"frequencies"` // The valid choices
+}
+
+// pushSubscribeRequest is the expected JSON body for
+// POST /me/push-subscriptions: the browser's PushSubscription.toJSON().
+type pushSubscribeRequest struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+	UserAgent string `json:"-"` // From the request headers
+}
+
+// bind records the subscribing browser (see Handle).
+func (req *pushSubscribeRequest) bind(r *http.Request) error {
+	req.UserAgent = r.UserAgent()
+	return nil
+}
+
+// Validate implements Validator.
+func (req *pushSubscribeRequest) Validate() error {
+	if req.Endpoint == "" || req.Keys.P256dh == "" || req.Keys.Auth == "" {
+		return badRequest(CodePushSubscriptionEmpty, "endpoint, keys.p256dh, and keys.auth are required")
+	}
+	return nil
+}
+
+// pushSubscriptionIDRequest is the request for routes that take a
+// subscription ID.
+type pushSubscriptionIDRequest struct {
+	ID uint64
+}
+
+// bind reads the subscription ID from the path (see Handle).
+func (req *pushSubscriptionIDRequest) bind(r *http.Request) error {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return badRequest(CodeRequestInvalidID, "invalid subscription ID")
+	}
+	req.ID = id
+	return nil
+}
+
+// pushSubscriptionResponse describes one subscribed browser. The keys
+// aren't returned: the browser has them, and nobody else needs them.
+type pushSubscriptionResponse struct {
+	ID        uint64    `json:"id"`
+	Endpoint  string    `json:"endpoint"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// vapidKeyResponse carries the key browsers subscribe with.
+type vapidKeyResponse struct {
+	PublicKey string `json:"public_key"`
+}
+
+// NotificationHandler handles the caller's notification settings and
+// push subscriptions.
+type NotificationHandler struct {
+	service *notification.Service
+	push    *webpush.Sender // nil when web push is off
+}
+
+// NewNotificationHandler creates a new notification handler. push may be
+// nil, leaving out the web push routes.
+func NewNotificationHandler(service *notification.Service, push *webpush.Sender) *NotificationHandler {
+	return &NotificationHandler{service: service, push: push}
+}
+
+// RegisterRoutes sets up HTTP routes for notification settings and, with
+// web push on, push subscriptions.
+func (h *NotificationHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	read := auth.RequireScope(auth.ScopeUsersRead)
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	mux.HandleFunc("GET /me/notifications", authMiddleware.AuthenticateFunc(read(Handle(h.settings))))
+	mux.HandleFunc("PUT /me/notifications", authMiddleware.AuthenticateFunc(write(Handle(h.update))))
+
+	if h.push == nil {
+		return
+	}
+	// The public key is public: the page needs it before subscribing.
+	mux.HandleFunc("GET /push/vapid-public-key", Handle(h.vapidKey))
+	mux.HandleFunc("GET /me/push-subscriptions", authMiddleware.AuthenticateFunc(read(Handle(h.subscriptions))))
+	mux.HandleFunc("POST /me/push-subscriptions", authMiddleware.AuthenticateFunc(write(Handle(h.subscribe, WithStatus(http.StatusCreated)))))
+	mux.HandleFunc("DELETE /me/push-subscriptions/{id}", authMiddleware.AuthenticateFunc(write(Handle(h.unsubscribe, WithStatus(http.StatusNoContent)))))
+}
+
+// settings handles GET /me/notifications
+// Returns how often the caller gets the digest of low-priority notifications.
+func (h *NotificationHandler) settings(ctx context.Context, _ struct{}) (notificationSettingsResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return notificationSettingsResponse{}, errUnauthorized
+	}
+	freq, err := h.service.Frequency(ctx, claims.UserID)
+	if err != nil {
+		return notificationSettingsResponse{}, err
+	}
+	return notificationSettingsResponse{Frequency: freq, Frequencies: notification.Frequencies}, nil
+}
+
+// update handles PUT /me/notifications
+// Sets the digest frequency. "immediate" sends anything waiting right away.
+func (h *NotificationHandler) update(ctx context.Context, req notificationSettingsRequest) (notificationSettingsResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return notificationSettingsResponse{}, errUnauthorized
+	}
+	freq, err := h.service.SetFrequency(ctx, claims.UserID, req.Frequency)
+	if err != nil {
+		return notificationSettingsResponse{}, err
+	}
+	return notificationSettingsResponse{Frequency: freq, Frequencies: notification.Frequencies}, nil
+}
+
+// vapidKey handles GET /push/vapid-public-key
+// Returns the applicationServerKey for pushManager.subscribe.
+func (h *NotificationHandler) vapidKey(_ context.Context, _ struct{}) (vapidKeyResponse, error) {
+	return vapidKeyResponse{PublicKey: h.push.PublicKey()}, nil
+}
+
+// subscriptions handles GET /me/push-subscriptions
+// Lists the caller's browsers that get push notifications, newest first.
+func (h *NotificationHandler) subscriptions(ctx context.Context, _ struct{}) ([]pushSubscriptionResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return nil, errUnauthorized
+	}
+	subs, err := h.service.Subscriptions(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	// Always return an array, never null, so clients can iterate safely.
+	resp := make([]pushSubscriptionResponse, 0, len(subs))
+	for _, sub := range subs {
+		resp = append(resp, toPushSubscriptionResponse(&sub))
+	}
+	return resp, nil
+}
+
+// subscribe handles POST /me/push-subscriptions
+// Registers the calling browser for push notifications. Registering the
+// same endpoint again replaces it.
+func (h *NotificationHandler) subscribe(ctx context.Context, req pushSubscribeRequest) (pushSubscriptionResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return pushSubscriptionResponse{}, errUnauthorized
+	}
+	sub, err := h.service.Subscribe(ctx, notification.PushSubscription{
+		UserID:    claims.UserID,
+		Endpoint:  req.Endpoint,
+		P256dh:    req.Keys.P256dh,
+		Auth:      req.Keys.Auth,
+		UserAgent: req.UserAgent,
+	})
+	if err != nil {
+		return pushSubscriptionResponse{}, err
+	}
+	return toPushSubscriptionResponse(sub), nil
+}
+
+// unsubscribe handles DELETE /me/push-subscriptions/{id}
+// Stops push notifications to one of the caller's browsers.
+func (h *NotificationHandler) unsubscribe(ctx context.Context, req pushSubscriptionIDRequest) (NoContent, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return NoContent{}, errUnauthorized
+	}
+	return NoContent{}, h.service.Unsubscribe(ctx, claims.UserID, req.ID)
+}
+
+// toPushSubscriptionResponse converts a subscription to its response.
+func toPushSubscriptionResponse(sub *notification.PushSubscription) pushSubscriptionResponse {
+	return pushSubscriptionResponse{
+		ID:        sub.ID,
+		Endpoint:  sub.Endpoint,
+		UserAgent: sub.UserAgent,
+		CreatedAt: sub.CreatedAt,
+	}
+}
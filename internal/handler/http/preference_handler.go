@@ -0,0 +1,117 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+)
+
+// preferencesRequest is the expected JSON body for
+// PUT /users/{id}/preferences. It replaces the preferences whole: a key
+// left out goes back to its default. Unknown keys are refused (see
+// DecodeJSON), so a client's own settings go in extras.
+type preferencesRequest struct {
+	UserID               uint64                     `json:"-"`
+	Theme                string                     `json:"theme"`
+	Language             string                     `json:"language"`
+	Timezone             string                     `json:"timezone"`
+	Density              string                     `json:"density"`
+	DesktopNotifications bool                       `json:"desktop_notifications"`
+	NotificationSound    bool                       `json:"notification_sound"`
+	Extras               map[string]json.RawMessage `json:"extras"`
+}
+
+// bind reads the user ID from the path (see Handle).
+func (req *preferencesRequest) bind(r *http.Request) (err error) {
+	req.UserID, err = pathUserID(r)
+	return err
+}
+
+// preferencesResponse is a user's preferences, defaults filled in.
+type preferencesResponse struct {
+	Theme                string                     `json:"theme"`
+	Language             string                     `json:"language"`
+	Timezone             string                     `json:"timezone"`
+	Density              string                     `json:"density"`
+	DesktopNotifications bool                       `json:"desktop_notifications"`
+	NotificationSound    bool                       `json:"notification_sound"`
+	Extras               map[string]json.RawMessage `json:"extras"`
+	UpdatedAt            *time.Time                 `json:"updated_at,omitempty"` // Absent until first saved
+}
+
+// PreferenceHandler handles users' client preferences.
+type PreferenceHandler struct {
+	preferences *user.PreferenceService
+}
+
+// NewPreferenceHandler creates a new preference handler.
+func NewPreferenceHandler(preferences *user.PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{preferences: preferences}
+}
+
+// RegisterRoutes sets up HTTP routes for preferences. Unlike the
+// profile, preferences are private: only the user and admins may read
+// them.
+func (h *PreferenceHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	read := auth.RequireScope(auth.ScopeUsersRead)
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	owner := auth.RequireSelfOrRole("id", auth.RoleAdmin)
+	mux.HandleFunc("GET /users/{id}/preferences", authMiddleware.AuthenticateFunc(read(owner(Handle(h.get)))))
+	mux.HandleFunc("PUT /users/{id}/preferences", authMiddleware.AuthenticateFunc(write(owner(Handle(h.set)))))
+	mux.HandleFunc("GET /me/preferences", authMiddleware.AuthenticateFunc(read(asSelf(Handle(h.get)))))
+	mux.HandleFunc("PUT /me/preferences", authMiddleware.AuthenticateFunc(write(asSelf(Handle(h.set)))))
+}
+
+// get handles GET /users/{id}/preferences and GET /me/preferences
+// Returns the defaults for a user who never saved any.
+func (h *PreferenceHandler) get(ctx context.Context, req userIDRequest) (preferencesResponse, error) {
+	p, err := h.preferences.Get(ctx, req.ID)
+	if err != nil {
+		return preferencesResponse{}, err
+	}
+	return preferencesV1(p), nil
+}
+
+// set handles PUT /users/{id}/preferences and PUT /me/preferences
+// Returns the preferences as stored, normalized (see user.Preferences.Validate).
+func (h *PreferenceHandler) set(ctx context.Context, req preferencesRequest) (preferencesResponse, error) {
+	p, err := h.preferences.Set(ctx, req.UserID, user.Preferences{
+		Theme:                req.Theme,
+		Language:             req.Language,
+		Timezone:             req.Timezone,
+		Density:              req.Density,
+		DesktopNotifications: req.DesktopNotifications,
+		NotificationSound:    req.NotificationSound,
+		Extras:               req.Extras,
+	})
+	if err != nil {
+		return preferencesResponse{}, err
+	}
+	return preferencesV1(p), nil
+}
+
+// preferencesV1 converts preferences to their response. No extras are
+// sent as {}, not null.
+func preferencesV1(p *user.Preferences) preferencesResponse {
+	resp := preferencesResponse{
+		Theme:                p.Theme,
+		Language:             p.Language,
+		Timezone:             p.Timezone,
+		Density:              p.Density,
+		DesktopNotifications: p.DesktopNotifications,
+		NotificationSound:    p.NotificationSound,
+		Extras:               p.Extras,
+	}
+	if resp.Extras == nil {
+		resp.Extras = map[string]json.RawMessage{}
+	}
+	if !p.UpdatedAt.IsZero() {
+		updated := p.UpdatedAt.UTC()
+		resp.UpdatedAt = &updated
+	}
+	return resp
+}
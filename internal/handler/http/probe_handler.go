@@ -0,0 +1,112 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+)
+
+// ProbeTokenHeader carries the static token required by /probe/e2e.
+const ProbeTokenHeader = "X-Probe-Token"
+
+// probeTimeout bounds the whole probe so a hung database shows up as a
+// failed check instead of an uptime checker timing out with no details.
+const probeTimeout = 5 * time.Second
+
+// probeStep is the outcome of one step of the end-to-end probe.
+type probeStep struct {
+	Name       string  `json:"name"`
+	DurationMS float64 `json:"duration_ms"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// probeResponse is returned by GET /probe/e2e.
+type probeResponse struct {
+	Status     string      `json:"status"` // "ok" or "failed"
+	DurationMS float64     `json:"duration_ms"`
+	Steps      []probeStep `json:"steps"`
+}
+
+// ProbeHandler serves the synthetic monitoring endpoint.
+//
+// HEALTH vs PROBE:
+// /health answers "is the process up?" and /ready "is the database
+// reachable?". /probe/e2e goes further: it writes and reads a real row
+// through the same repository stack user requests use, and reports how
+// long each step took, so an external uptime check catches slow queries,
+// broken migrations, or a read-only replica that a ping would miss.
+type ProbeHandler struct {
+	canary *user.Canary
+	token  string // Static token required in X-Probe-Token
+}
+
+// NewProbeHandler creates a new probe handler.
+// An empty token disables the endpoint.
+func NewProbeHandler(canary *user.Canary, token string) *ProbeHandler {
+	return &ProbeHandler{canary: canary, token: token}
+}
+
+// RegisterRoutes sets up the probe route.
+// It uses a static token instead of a JWT: the uptime checker is not a
+// user, and it shouldn't need to log in (or hold credentials) to probe.
+func (h *ProbeHandler) RegisterRoutes(mux *http.ServeMux) {
+	requireToken := auth.RequireToken(ProbeTokenHeader, h.token)
+	mux.HandleFunc("GET /probe/e2e", requireToken(h.e2e))
+}
+
+// e2e handles GET /probe/e2e
+// Runs create-or-touch, read, and cleanup against the canary user.
+// Returns 200 when every step succeeds, 503 with the failing step otherwise.
+func (h *ProbeHandler) e2e(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	resp := probeResponse{Status: "ok"}
+	start := time.Now()
+
+	// run times one step and records it. Once a step fails, the rest are
+	// skipped: they depend on the canary ID from the first step.
+	run := func(name string, step func() error) {
+		if resp.Status != "ok" {
+			return
+		}
+		stepStart := time.Now()
+		err := step()
+		result := probeStep{Name: name, DurationMS: milliseconds(time.Since(stepStart))}
+		if err != nil {
+			result.Error = err.Error()
+			resp.Status = "failed"
+		}
+		resp.Steps = append(resp.Steps, result)
+	}
+
+	var canaryID uint64
+	run("create_or_touch", func() (err error) {
+		canaryID, err = h.canary.Touch(ctx)
+		return err
+	})
+	run("read", func() error {
+		return h.canary.Read(ctx, canaryID)
+	})
+	run("cleanup", func() error {
+		return h.canary.Cleanup(ctx, canaryID)
+	})
+
+	resp.DurationMS = milliseconds(time.Since(start))
+
+	// Probe responses must never be cached by a proxy in between.
+	w.Header().Set("Cache-Control", "no-store")
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// milliseconds converts a duration to fractional milliseconds for JSON.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,135 @@
+package http
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// v1Responses are the v1 response bodies clients parse, by name. Admin
+// and probe responses aren't here: they're for operators, who upgrade
+// their tooling with the server.
+var v1Responses = map[string]interface{}{
+	"user":                  userResponse{},
+	"user_list":             userListResponse{},
+	"login":                 loginResponse{},
+	"refresh":               refreshResponse{},
+	"session":               sessionResponse{},
+	"login_history":         loginHistoryResponse{},
+	"error":                 errorResponse{},
+	"error_code":            errorCodeInfo{},
+	"message":               messageResponse{},
+	"mfa_enroll":            mfaEnrollResponse{},
+	"mfa_recovery_codes":    mfaRecoveryCodesResponse{},
+	"mfa_recovery_status":   mfaRecoveryStatusResponse{},
+	"notification_settings": notificationSettingsResponse{},
+	"push_subscription":     pushSubscriptionResponse{},
+	"vapid_key":             vapidKeyResponse{},
+	"preferences":           preferencesResponse{},
+	"anonymization":         anonymizationResponse{},
+	"capabilities":          capabilitiesResponse{},
+}
+
+// ResponseManifest records the shape of one release's v1 responses:
+// for each response, every JSON field (nested ones as "user.email") and
+// its JSON type.
+//
+// Generate it from the release being replaced (`api response-manifest`)
+// and feed it to LintResponses, like the schema manifest for migrations.
+// testdata/v1_responses.json is one committed for the tests, which
+// check every build against it.
+type ResponseManifest struct {
+	Version   string                       `json:"version"`
+	Responses map[string]map[string]string `json:"responses"` // response -> field -> type
+}
+
+// CurrentResponseManifest describes this build's v1 responses.
+func CurrentResponseManifest() ResponseManifest {
+	m := ResponseManifest{Version: "v1", Responses: make(map[string]map[string]string, len(v1Responses))}
+	for name, resp := range v1Responses {
+		fields := make(map[string]string)
+		shapeOf(reflect.TypeOf(resp), "", fields)
+		m.Responses[name] = fields
+	}
+	return m
+}
+
+// timeType is encoded as an RFC 3339 string, not as the struct it is.
+var timeType = reflect.TypeOf(time.Time{})
+
+// shapeOf adds the JSON fields of t, a struct, to fields, prefixing
+// their names with prefix.
+func shapeOf(t reflect.Type, prefix string, fields map[string]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && ft != timeType {
+			fields[prefix+name] = "object"
+			shapeOf(ft, prefix+name+".", fields)
+			continue
+		}
+		fields[prefix+name] = jsonType(ft)
+	}
+}
+
+// jsonType names the JSON type t is encoded as.
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array of " + jsonType(t.Elem())
+	case reflect.Map:
+		return "object"
+	case reflect.Struct:
+		if t == timeType {
+			return "string (date-time)"
+		}
+		return "object"
+	default:
+		return t.Kind().String()
+	}
+}
+
+// LintResponses lists the ways current breaks clients of previous: a
+// response or field that's gone (or renamed), or a field whose type
+// changed. New responses and fields break nobody and aren't listed.
+func LintResponses(previous, current ResponseManifest) []string {
+	var problems []string
+	for name, fields := range previous.Responses {
+		now, ok := current.Responses[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: response removed", name))
+			continue
+		}
+		for field, typ := range fields {
+			switch nowType, ok := now[field]; {
+			case !ok:
+				problems = append(problems, fmt.Sprintf("%s: field %q removed or renamed", name, field))
+			case nowType != typ:
+				problems = append(problems, fmt.Sprintf("%s: field %q changed from %s to %s", name, field, typ, nowType))
+			}
+		}
+	}
+	// Maps iterate in random order; keep the report stable.
+	sort.Strings(problems)
+	return problems
+}
@@ -0,0 +1,58 @@
+package http
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"testing"
+)
+
+// updateResponses rewrites the snapshot instead of checking against it:
+//
+//	go test ./internal/handler/http -run TestV1Responses -update
+var updateResponses = flag.Bool("update", false, "rewrite testdata/v1_responses.json from the current responses")
+
+// v1Snapshot is the committed record of the v1 response shapes.
+const v1Snapshot = "testdata/v1_responses.json"
+
+// TestV1ResponsesCompatible fails when a v1 response loses a field,
+// renames one, or changes its type, compared with the committed snapshot.
+//
+// Additions break no client, but they fail here too until the snapshot
+// is regenerated: a field missing from the snapshot is a field whose
+// later removal nothing would catch.
+func TestV1ResponsesCompatible(t *testing.T) {
+	current := CurrentResponseManifest()
+
+	if *updateResponses {
+		data, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(v1Snapshot, append(data, '\n'), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	data, err := os.ReadFile(v1Snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var snapshot ResponseManifest
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatalf("parsing %s: %v", v1Snapshot, err)
+	}
+
+	for _, problem := range LintResponses(snapshot, current) {
+		t.Errorf("breaking change to a v1 response: %s", problem)
+	}
+	if t.Failed() {
+		return
+	}
+
+	// Nothing broke; any difference left is an addition.
+	if added := LintResponses(current, snapshot); len(added) > 0 {
+		t.Errorf("v1 responses have fields the snapshot doesn't (%d); if they're meant to ship, run with -update and commit %s", len(added), v1Snapshot)
+	}
+}
@@ -0,0 +1,194 @@
+package http
+
+import (
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// Version 1 of the API's user and session responses, and their builders.
+//
+// WHY BUILDERS?
+// A response built field by field from the domain model only changes
+// when someone changes it here. If a handler encoded a *user.User
+// directly, or copied it with a struct conversion, a new column on the
+// model (a password hash, an internal flag) or a renamed field would
+// reach every client the moment it was added, and a client parsing the
+// old name would break. So:
+//
+//   - Handlers never encode domain types; they call a builder.
+//   - A builder copies named fields, one by one. No embedding, no
+//     conversions.
+//   - A v1 field is never renamed, retyped, or removed: clients depend
+//     on it. `api response-lint` checks that against the previous
+//     release (see ResponseManifest). Adding a field is fine.
+//
+// A breaking change gets new types and builders (userV2, ...) next to
+// these, served to clients that ask for the new version, while v1 keeps
+// its shape.
+
+// userResponse is returned for single user operations.
+// PendingEmail is only filled in for the user's own profile (GET /me).
+type userResponse struct {
+	ID            uint64 `json:"id"`
+	Email         string `json:"email"`
+	Username      string `json:"username,omitempty"` // Absent without a username
+	EmailVerified bool   `json:"email_verified"`
+	PendingEmail  string `json:"pending_email,omitempty"`
+	AvatarURL     string `json:"avatar_url,omitempty"`  // Absent without an avatar
+	Deactivated   bool   `json:"deactivated,omitempty"` // Absent while the account is active
+}
+
+// loginResponse includes the JWT token for authentication.
+type loginResponse struct {
+	Token        string       `json:"token"`
+	TokenType    string       `json:"token_type,omitempty"` // "DPoP" for a DPoP-bound token; send it as "Authorization: DPoP"
+	RefreshToken string       `json:"refresh_token"`        // Exchange at POST /auth/refresh
+	User         userResponse `json:"user"`
+
+	// MFAReenrollmentRequired is set when the login used a recovery
+	// code: the client should prompt the user to set up two-factor
+	// authentication again (POST /auth/mfa/reset, then enroll) or, if
+	// they still have the app, regenerate their codes.
+	MFAReenrollmentRequired bool `json:"mfa_reenrollment_required,omitempty"`
+}
+
+// refreshResponse carries a new access token and the rotated refresh token.
+// The old refresh token stops working as soon as this is returned.
+type refreshResponse struct {
+	Token        string `json:"token"`
+	TokenType    string `json:"token_type,omitempty"` // As in loginResponse
+	RefreshToken string `json:"refresh_token"`
+}
+
+// sessionResponse describes one signed-in device.
+type sessionResponse struct {
+	ID         uint64    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// loginHistoryResponse is GET /users/{id}/logins: the account's last
+// sign-in (a login or a refresh), left out if never recorded, and its
+// recent logins.
+type loginHistoryResponse struct {
+	LastLoginAt *time.Time           `json:"last_login_at,omitempty"`
+	LastLoginIP string               `json:"last_login_ip,omitempty"`
+	Logins      []loginEntryResponse `json:"logins"`
+}
+
+// loginEntryResponse is one login in a login history.
+type loginEntryResponse struct {
+	ID        uint64    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	IPAddress string    `json:"ip_address"`
+	At        time.Time `json:"at"`
+}
+
+// userListResponse is one page of GET /users or GET /users/search.
+type userListResponse struct {
+	Data       []userResponse     `json:"data"`
+	Pagination paginationResponse `json:"pagination"`
+}
+
+// paginationResponse says where a page sits in the whole list.
+type paginationResponse struct {
+	Limit      int    `json:"limit"`
+	Total      int64  `json:"total"`                 // Users in the whole list, not this page
+	NextCursor string `json:"next_cursor,omitempty"` // Pass as ?after for the next page; absent on the last
+}
+
+// userV1 describes a user to anyone allowed to see them.
+func userV1(u *user.User) userResponse {
+	return userResponse{
+		ID:            u.ID,
+		Email:         u.Email,
+		Username:      u.Username,
+		EmailVerified: u.EmailVerified,
+		AvatarURL:     u.AvatarURL,
+		Deactivated:   !u.Active,
+	}
+}
+
+// meV1 describes the caller to themselves: userV1, plus the email
+// change they have pending, which is nobody else's business.
+func meV1(u *user.User) userResponse {
+	resp := userV1(u)
+	resp.PendingEmail = u.PendingEmail
+	return resp
+}
+
+// loginV1 is the response to a sign-in: tokens for u.
+func loginV1(token, refreshToken string, u *user.User) loginResponse {
+	return loginResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		User:         userV1(u),
+	}
+}
+
+// refreshV1 is the response to a token refresh.
+func refreshV1(token, refreshToken string) refreshResponse {
+	return refreshResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+	}
+}
+
+// sessionV1 describes one of the caller's signed-in devices.
+func sessionV1(s *user.Session) sessionResponse {
+	return sessionResponse{
+		ID:         s.ID,
+		UserAgent:  s.UserAgent,
+		IPAddress:  s.IPAddress,
+		CreatedAt:  s.CreatedAt,
+		LastUsedAt: s.LastUsedAt,
+		ExpiresAt:  s.ExpiresAt,
+	}
+}
+
+// loginHistoryV1 describes a login history. Logins is never null, so
+// clients can iterate without checking.
+func loginHistoryV1(h *user.LoginHistory) loginHistoryResponse {
+	resp := loginHistoryResponse{
+		LastLoginIP: h.LastLoginIP,
+		Logins:      make([]loginEntryResponse, 0, len(h.Logins)),
+	}
+	if !h.LastLoginAt.IsZero() {
+		at := h.LastLoginAt.UTC()
+		resp.LastLoginAt = &at
+	}
+	for _, l := range h.Logins {
+		resp.Logins = append(resp.Logins, loginEntryResponse{ID: l.ID, UserAgent: l.UserAgent, IPAddress: l.IPAddress, At: l.At})
+	}
+	return resp
+}
+
+// userListV1 describes one page of users, fetched limit at a time. Data
+// is never null, so clients can iterate without checking.
+func userListV1(page *user.Page, limit int) userListResponse {
+	resp := userListResponse{
+		Data:       make([]userResponse, 0, len(page.Users)),
+		Pagination: paginationResponse{Limit: limit, Total: page.Total},
+	}
+	for _, u := range page.Users {
+		resp.Data = append(resp.Data, userV1(u))
+	}
+	if page.NextCursor != nil {
+		resp.Pagination.NextCursor = page.NextCursor.Encode()
+	}
+	return resp
+}
+
+// userSearchV1 describes one page of search results, fetched limit at
+// a time, in the same shape as a page of GET /users.
+func userSearchV1(page *user.SearchPage, limit int) userListResponse {
+	resp := userListV1(&user.Page{Users: page.Users, Total: page.Total}, limit)
+	if page.NextCursor != nil {
+		resp.Pagination.NextCursor = page.NextCursor.Encode()
+	}
+	return resp
+}
@@ -0,0 +1,198 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/user"
+)
+
+// refreshRequest is the expected JSON body for POST /auth/refresh.
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// SessionHandler handles refresh tokens, the "signed-in devices" list,
+// and login history.
+type SessionHandler struct {
+	sessions   *user.Sessions
+	jwtManager *auth.JWTManager // For issuing access tokens on refresh
+}
+
+// NewSessionHandler creates a new session handler.
+func NewSessionHandler(sessions *user.Sessions, jwtManager *auth.JWTManager) *SessionHandler {
+	return &SessionHandler{sessions: sessions, jwtManager: jwtManager}
+}
+
+// RegisterRoutes sets up HTTP routes for sessions.
+func (h *SessionHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	// Refresh is public: the access token has usually expired by then.
+	// The refresh token in the body is the credential.
+	mux.HandleFunc("POST /auth/refresh", h.refresh)
+
+	// Session management acts on the caller's own devices.
+	read := auth.RequireScope(auth.ScopeUsersRead)
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	mux.HandleFunc("GET /auth/sessions", authMiddleware.AuthenticateFunc(read(h.list)))
+	mux.HandleFunc("DELETE /auth/sessions/{id}", authMiddleware.AuthenticateFunc(write(h.revoke)))
+
+	// Login history is private, like preferences: only the user and
+	// admins may read it.
+	owner := auth.RequireSelfOrRole("id", auth.RoleAdmin)
+	mux.HandleFunc("GET /users/{id}/logins", authMiddleware.AuthenticateFunc(read(owner(Handle(h.logins)))))
+	mux.HandleFunc("GET /me/logins", authMiddleware.AuthenticateFunc(read(asSelf(Handle(h.logins)))))
+}
+
+// refresh handles POST /auth/refresh
+// Exchanges a refresh token for a new access token and a new refresh token.
+func (h *SessionHandler) refresh(w http.ResponseWriter, r *http.Request) {
+	req, err := DecodeJSON[refreshRequest](r)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	if req.RefreshToken == "" {
+		writeCode(w, CodeRefreshTokenRequired, "refresh_token is required")
+		return
+	}
+
+	// A session started with a DPoP key only refreshes with a proof
+	// from that key (see user.Device).
+	device := deviceFromRequest(r)
+	var ok bool
+	if device.KeyThumbprint, ok = proofKey(w, r, h.jwtManager); !ok {
+		return
+	}
+	u, refreshToken, err := h.sessions.Refresh(r.Context(), req.RefreshToken, device)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	// Roles are re-read on every refresh, so a revoked role disappears
+	// from the user's tokens within one access token lifetime.
+	token, err := h.jwtManager.GenerateTokenContext(r.Context(), u.ID, u.Email, roleNames(u.Roles), auth.AtVersion(u.TokenVersion),
+		auth.BoundTo(r), auth.BoundToKey(device.KeyThumbprint))
+	if err != nil {
+		log.Printf("failed to generate token: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+
+	resp := refreshV1(token, refreshToken)
+	resp.TokenType = tokenType(device.KeyThumbprint)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// list handles GET /auth/sessions
+// Returns the caller's signed-in devices, most recently used first.
+func (h *SessionHandler) list(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetClaimsFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	sessions, err := h.sessions.List(r.Context(), claims.UserID)
+	if err != nil {
+		handleServiceError(w, err)
+		return
+	}
+
+	// Always return an array, never null, so clients can iterate safely.
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, sessionV1(s))
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// revoke handles DELETE /auth/sessions/{id}
+// Signs one of the caller's devices out. Its current access token keeps
+// working until it expires; its refresh token stops working immediately.
+func (h *SessionHandler) revoke(w http.ResponseWriter, r *http.Request) {
+	claims, ok := auth.GetClaimsFromContext(r.Context())
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeCode(w, CodeRequestInvalidID, "invalid session ID")
+		return
+	}
+
+	if err := h.sessions.Revoke(r.Context(), claims.UserID, id); err != nil {
+		handleServiceError(w, err)
+		return
+	}
+	h.jwtManager.Emit(r.Context(), auth.TokenRevoked{UserID: claims.UserID, SessionID: id, Reason: auth.RevokedLogout, At: time.Now().UTC()})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logins handles GET /users/{id}/logins and GET /me/logins
+// Returns when and from where the account was last used, and its recent
+// logins, most recent first, so the user can spot one that wasn't them.
+func (h *SessionHandler) logins(ctx context.Context, req userIDRequest) (loginHistoryResponse, error) {
+	history, err := h.sessions.LoginHistory(ctx, req.ID)
+	if err != nil {
+		return loginHistoryResponse{}, err
+	}
+	return loginHistoryV1(history), nil
+}
+
+// deviceFromRequest describes the client for the session list.
+//
+// The IP is the TCP peer address. Behind a reverse proxy that is the
+// proxy's address; X-Forwarded-For is deliberately ignored because any
+// client can set it.
+func deviceFromRequest(r *http.Request) user.Device {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return user.Device{UserAgent: r.UserAgent(), IPAddress: ip}
+}
+
+// proofKey checks the DPoP proof on a token request (login, refresh)
+// and returns the thumbprint of its key, to bind the new tokens to, or
+// "" for a request without one. On a bad proof it writes the error and
+// returns false.
+//
+// Every response carries a fresh nonce when nonces are required, so a
+// client's first, nonce-less proof is refused with the nonce to retry
+// with, and its next request has a current one.
+func proofKey(w http.ResponseWriter, r *http.Request, jwtManager *auth.JWTManager) (string, bool) {
+	if nonce := jwtManager.DPoPNonce(); nonce != "" {
+		w.Header().Set(auth.DPoPNonceHeader, nonce)
+	}
+	thumbprint, err := jwtManager.ProofKey(r)
+	switch {
+	case err == nil:
+		return thumbprint, true
+	case errors.Is(err, auth.ErrDPoPNonce):
+		writeCode(w, CodeDPoPUseNonce, "DPoP proof needs the nonce in the DPoP-Nonce header")
+	case errors.Is(err, auth.ErrInvalidDPoPProof), errors.Is(err, auth.ErrReplayedDPoPProof):
+		writeCode(w, CodeDPoPInvalidProof, err.Error())
+	default:
+		log.Printf("verifying DPoP proof: %v", err)
+		writeError(w, http.StatusServiceUnavailable, "try again later")
+	}
+	return "", false
+}
+
+// tokenType is the token_type of a token bound to the DPoP key with
+// thumbprint: "DPoP", or "" (a bearer token) without one.
+func tokenType(thumbprint string) string {
+	if thumbprint == "" {
+		return ""
+	}
+	return auth.DPoPScheme
+}
@@ -0,0 +1,264 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/notification"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/redirect"
+	"go-basics/internal/sso"
+	"go-basics/internal/txn"
+)
+
+// samlRequestCookie remembers the ID of the AuthnRequest a browser was
+// sent to the IdP with, until the IdP posts the response back.
+const samlRequestCookie = "saml_request"
+
+// samlReturnCookie remembers where the browser asked to be sent after
+// signing in (?return_to= on the login route), with its tenant.
+const samlReturnCookie = "saml_return_to"
+
+// samlRequestTTL is how long a user has to sign in at the IdP.
+const samlRequestTTL = 10 * time.Minute
+
+// SSOHandler handles SAML single sign-on.
+type SSOHandler struct {
+	saml          *sso.SAML
+	users         *user.Service
+	jwtManager    *auth.JWTManager
+	sessions      *user.Sessions
+	notifications *notification.Service
+	provision     bool   // Create accounts on first sign-in
+	redirectURL   string // Where to send the browser with its tokens; empty returns JSON
+	returns       *redirect.Validator
+}
+
+// NewSSOHandler creates a new SSO handler.
+func NewSSOHandler(saml *sso.SAML, users *user.Service, jwtManager *auth.JWTManager, sessions *user.Sessions, notifications *notification.Service, provision bool, redirectURL string, returns *redirect.Validator) *SSOHandler {
+	return &SSOHandler{
+		saml:          saml,
+		users:         users,
+		jwtManager:    jwtManager,
+		sessions:      sessions,
+		notifications: notifications,
+		provision:     provision,
+		redirectURL:   redirectURL,
+		returns:       returns,
+	}
+}
+
+// RegisterRoutes sets up HTTP routes for SSO. They're all public: the
+// IdP's signed assertion is the credential.
+func (h *SSOHandler) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET "+sso.MetadataPath, h.metadata)
+	mux.HandleFunc("GET /sso/saml/login", h.login)
+	// No txn.Middleware: acs commits its own writes (see there).
+	mux.HandleFunc("POST "+sso.ACSPath, h.acs)
+}
+
+// metadata handles GET /sso/saml/metadata
+// Describes this service provider, for registering it with the IdP.
+func (h *SSOHandler) metadata(w http.ResponseWriter, r *http.Request) {
+	data, err := h.saml.Metadata()
+	if err != nil {
+		log.Printf("sso: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(data)
+}
+
+// login handles GET /sso/saml/login
+// Sends the browser to the IdP to sign in. ?return_to= names the page
+// to come back to instead of SAML_REDIRECT_URL; it must be allowed (see
+// package redirect), by REDIRECT_ALLOWED_URLS or by the policy of the
+// tenant in ?tenant=.
+func (h *SSOHandler) login(w http.ResponseWriter, r *http.Request) {
+	var returnTo string
+	if raw := r.URL.Query().Get("return_to"); raw != "" {
+		tenantID := r.URL.Query().Get("tenant")
+		u, err := h.returns.Check(r.Context(), tenantID, raw)
+		if err != nil {
+			handleServiceError(w, err)
+			return
+		}
+		returnTo = url.Values{"tenant": {tenantID}, "url": {u.String()}}.Encode()
+	}
+
+	target, requestID, err := h.saml.AuthnRequest()
+	if err != nil {
+		log.Printf("sso: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// The IdP posts the response from its own site, so the cookie must be
+	// SameSite=None (which requires Secure) to come along. It's no secret
+	// - the assertion's signature is what's trusted - but it ties the
+	// response to the browser that asked for it.
+	http.SetCookie(w, &http.Cookie{
+		Name:     samlRequestCookie,
+		Value:    requestID,
+		Path:     sso.ACSPath,
+		MaxAge:   int(samlRequestTTL / time.Second),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteNoneMode,
+	})
+	if returnTo != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     samlReturnCookie,
+			Value:    returnTo,
+			Path:     sso.ACSPath,
+			MaxAge:   int(samlRequestTTL / time.Second),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteNoneMode,
+		})
+	}
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// acs handles POST /sso/saml/acs (the assertion consumer service)
+// Checks the IdP's response and signs the user in, like POST /login.
+func (h *SSOHandler) acs(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(samlRequestCookie)
+	if err != nil {
+		writeCode(w, CodeAuthSSOExpired, "sign-in expired or not started here; start again")
+		return
+	}
+	// Single use: the request it names has now been answered.
+	http.SetCookie(w, &http.Cookie{Name: samlRequestCookie, Path: sso.ACSPath, MaxAge: -1,
+		HttpOnly: true, Secure: true, SameSite: http.SameSiteNoneMode})
+
+	identity, err := h.saml.Identity(r, cookie.Value)
+	switch {
+	case errors.Is(err, sso.ErrInvalidAssertion):
+		writeError(w, http.StatusUnauthorized, "SSO sign-in failed")
+		return
+	case errors.Is(err, sso.ErrNoEmail):
+		writeCode(w, CodeAuthSSONoEmail, "the identity provider sent no email address")
+		return
+	case errors.Is(err, sso.ErrDomainNotAllowed):
+		writeError(w, http.StatusForbidden, "this email domain can't sign in with SSO")
+		return
+	case err != nil:
+		log.Printf("sso: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal server error")
+		return
+	}
+
+	// WHY txn.Run AND NOT txn.Middleware?
+	// The middleware commits only on a 2xx status, and with a redirect URL
+	// this answers 303: the user a first sign-in creates, its role and the
+	// session would all roll back while the browser still got tokens for
+	// them. Commit them together, before answering.
+	var (
+		u                   *user.User
+		token, refreshToken string
+		fail                func() // Answers for the step that failed
+	)
+	device := deviceFromRequest(r)
+	err = txn.Run(r.Context(), func(ctx context.Context) error {
+		var err error
+		u, err = h.users.AuthenticateExternal(ctx, identity.Email, h.provision)
+		if err != nil {
+			fail = func() { handleServiceError(w, err) }
+			return err
+		}
+		token, err = h.jwtManager.GenerateTokenContext(ctx, u.ID, u.Email, roleNames(u.Roles), auth.AtVersion(u.TokenVersion), auth.BoundTo(r))
+		if err != nil {
+			fail = func() {
+				log.Printf("failed to generate token: %v", err)
+				writeError(w, http.StatusInternalServerError, "failed to generate token")
+			}
+			return err
+		}
+		refreshToken, err = h.sessions.Start(ctx, u.ID, device)
+		if errors.Is(err, user.ErrAccountDisabled) {
+			fail = func() { handleServiceError(w, err) }
+			return err
+		}
+		if err != nil {
+			fail = func() {
+				log.Printf("failed to start session: %v", err)
+				writeError(w, http.StatusInternalServerError, "failed to start session")
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		if fail == nil {
+			log.Printf("sso: committing sign-in: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal server error")
+			return
+		}
+		fail()
+		return
+	}
+	if err := h.notifications.Notify(r.Context(), notification.NewSignIn(u.ID, device.UserAgent, device.IPAddress)); err != nil {
+		log.Printf("notifying user %d (%s): %v", u.ID, notification.KindNewSignIn, err)
+	}
+	log.Printf("sso: user %d signed in via SAML (name ID %q)", u.ID, identity.NameID)
+	h.jwtManager.Emit(r.Context(), auth.LoginSucceeded{
+		UserID:    u.ID,
+		Email:     u.Email,
+		Method:    auth.MethodSSO,
+		IPAddress: device.IPAddress,
+		UserAgent: device.UserAgent,
+		At:        time.Now().UTC(),
+	})
+
+	redirectURL := h.redirectURL
+	if returnTo := h.returnTo(w, r); returnTo != "" {
+		redirectURL = returnTo
+	}
+	if redirectURL == "" {
+		writeJSON(w, http.StatusOK, loginV1(token, refreshToken, u))
+		return
+	}
+
+	// WHY THE FRAGMENT?
+	// The browser arrives here by a form post from the IdP, so the tokens
+	// have to reach the app through a redirect. Unlike the query string,
+	// the fragment isn't sent to servers, so the tokens stay out of
+	// access logs and Referer headers; the app's page reads them with
+	// JavaScript and clears them from the address bar.
+	fragment := url.Values{}
+	fragment.Set("token", token)
+	fragment.Set("refresh_token", refreshToken)
+	http.Redirect(w, r, redirectURL+"#"+fragment.Encode(), http.StatusSeeOther)
+}
+
+// returnTo returns the return URL login remembered for this browser, or
+// "" if there's none, and forgets it.
+//
+// It's checked again: the tokens go wherever it points, and a cookie is
+// only as trustworthy as every site that can set one for our domain.
+func (h *SSOHandler) returnTo(w http.ResponseWriter, r *http.Request) string {
+	cookie, err := r.Cookie(samlReturnCookie)
+	if err != nil {
+		return ""
+	}
+	http.SetCookie(w, &http.Cookie{Name: samlReturnCookie, Path: sso.ACSPath, MaxAge: -1,
+		HttpOnly: true, Secure: true, SameSite: http.SameSiteNoneMode})
+
+	values, err := url.ParseQuery(cookie.Value)
+	if err != nil {
+		return ""
+	}
+	u, err := h.returns.Check(r.Context(), values.Get("tenant"), values.Get("url"))
+	if err != nil {
+		log.Printf("sso: dropping return URL %q: %v", values.Get("url"), err)
+		return ""
+	}
+	return u.String()
+}
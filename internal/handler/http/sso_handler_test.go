@@ -0,0 +1,275 @@
+package http
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/crewjam/saml"
+
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/notification"
+	"go-basics/internal/domain/user"
+	"go-basics/internal/redirect"
+	userRepo "go-basics/internal/repository/mysql"
+	"go-basics/internal/sso"
+)
+
+// recordingConnector is a database that keeps every write it's sent,
+// and remembers which of them were committed: those outside a
+// transaction, and those in one that committed. Queries find no rows.
+type recordingConnector struct {
+	mu        sync.Mutex
+	committed []string
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{c: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver { return nil }
+
+// wrote reports whether a committed write starts with prefix.
+func (c *recordingConnector) wrote(prefix string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, query := range c.committed {
+		if strings.HasPrefix(query, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type recordingConn struct {
+	c       *recordingConnector
+	pending []string // Writes of the open transaction
+	inTx    bool
+}
+
+func (*recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (*recordingConn) Close() error { return nil }
+
+func (conn *recordingConn) Begin() (driver.Tx, error) {
+	conn.inTx = true
+	return conn, nil
+}
+
+func (conn *recordingConn) Commit() error {
+	conn.c.mu.Lock()
+	conn.c.committed = append(conn.c.committed, conn.pending...)
+	conn.c.mu.Unlock()
+	conn.pending, conn.inTx = nil, false
+	return nil
+}
+
+func (conn *recordingConn) Rollback() error {
+	conn.pending, conn.inTx = nil, false
+	return nil
+}
+
+func (conn *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	query = strings.Join(strings.Fields(query), " ")
+	if conn.inTx {
+		conn.pending = append(conn.pending, query)
+	} else {
+		conn.c.mu.Lock()
+		conn.c.committed = append(conn.c.committed, query)
+		conn.c.mu.Unlock()
+	}
+	return insertResult{}, nil
+}
+
+// insertResult is one row written, with ID 1.
+type insertResult struct{}
+
+func (insertResult) LastInsertId() (int64, error) { return 1, nil }
+func (insertResult) RowsAffected() (int64, error) { return 1, nil }
+
+func (*recordingConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return noRows{}, nil
+}
+
+// noRows is an empty result set.
+type noRows struct{}
+
+func (noRows) Columns() []string         { return nil }
+func (noRows) Close() error              { return nil }
+func (noRows) Next([]driver.Value) error { return io.EOF }
+
+// testIDP is an identity provider that signs responses for a service
+// provider built from the same files a deployment would use.
+type testIDP struct {
+	idp *saml.IdentityProvider
+	sp  *saml.EntityDescriptor // The service provider's metadata
+}
+
+// newTestSAML returns a service provider at rootURL that trusts a new
+// test identity provider, and that provider.
+func newTestSAML(t *testing.T, rootURL string) (*sso.SAML, *testIDP) {
+	t.Helper()
+	dir := t.TempDir()
+
+	idpKey, idpCert := newKeyPair(t, "idp.example.com")
+	idp := &saml.IdentityProvider{
+		Key:         idpKey,
+		Certificate: idpCert,
+		MetadataURL: url.URL{Scheme: "https", Host: "idp.example.com", Path: "/metadata"},
+		SSOURL:      url.URL{Scheme: "https", Host: "idp.example.com", Path: "/sso"},
+	}
+	metadata, err := xml.Marshal(idp.Metadata())
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadataFile := filepath.Join(dir, "idp.xml")
+	writeFile(t, metadataFile, metadata)
+
+	spKey, spCert := newKeyPair(t, "api.example.com")
+	certFile, keyFile := filepath.Join(dir, "sp.crt"), filepath.Join(dir, "sp.key")
+	writeFile(t, certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: spCert.Raw}))
+	writeFile(t, keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(spKey)}))
+
+	sp, err := sso.NewSAML(context.Background(), sso.Options{
+		RootURL:         rootURL,
+		IDPMetadataFile: metadataFile,
+		CertFile:        certFile,
+		KeyFile:         keyFile,
+		EmailAttribute:  "mail",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spMetadata, err := sp.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var descriptor saml.EntityDescriptor
+	if err := xml.Unmarshal(spMetadata, &descriptor); err != nil {
+		t.Fatal(err)
+	}
+	return sp, &testIDP{idp: idp, sp: &descriptor}
+}
+
+// respond returns the SAMLResponse form value answering the request
+// with requestID for a user with email.
+func (p *testIDP) respond(t *testing.T, requestID, email string) string {
+	t.Helper()
+	descriptor := &p.sp.SPSSODescriptors[0]
+	req := &saml.IdpAuthnRequest{
+		IDP:                     p.idp,
+		HTTPRequest:             httptest.NewRequest(http.MethodGet, p.idp.SSOURL.String(), nil),
+		Request:                 saml.AuthnRequest{ID: requestID, IssueInstant: time.Now()},
+		ServiceProviderMetadata: p.sp,
+		SPSSODescriptor:         descriptor,
+		ACSEndpoint:             &descriptor.AssertionConsumerServices[0],
+		Now:                     time.Now(),
+	}
+	session := &saml.Session{ID: "session-1", NameID: email, UserEmail: email, CreateTime: time.Now(), ExpireTime: time.Now().Add(time.Hour)}
+	if err := (saml.DefaultAssertionMaker{}).MakeAssertion(req, session); err != nil {
+		t.Fatal(err)
+	}
+	form, err := req.PostBinding()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form.SAMLResponse
+}
+
+// newKeyPair returns an RSA key and a self-signed certificate for it.
+func newKeyPair(t *testing.T, name string) (*rsa.PrivateKey, *x509.Certificate) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(name, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestSSOFirstSignInRedirectCommits signs a new user in with a redirect
+// URL configured, so the route answers 303, and checks that the user,
+// its role and its session were committed: the browser leaves with
+// tokens for them.
+func TestSSOFirstSignInRedirectCommits(t *testing.T) {
+	connector := &recordingConnector{}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	users := userRepo.NewUserRepository(db)
+	roles := userRepo.NewRoleRepository(db)
+	sessions := user.NewSessions(userRepo.NewSessionRepository(db), users, roles, time.Hour)
+	noEmail := func(context.Context, uint64) (string, error) { return "", nil }
+	notifications := notification.NewService(userRepo.NewNotificationRepository(db), noEmail, nil, nil, notification.FrequencyImmediate)
+	returns, err := redirect.NewValidator(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const rootURL = "https://api.example.com"
+	sp, idp := newTestSAML(t, rootURL)
+	h := NewSSOHandler(sp, user.NewService(users, roles, nil, nil), auth.NewJWTManager("test-secret-test-secret-test-secret", time.Minute, "test"),
+		sessions, notifications, true, "https://app.example.com/signed-in", returns)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	const requestID = "id-4c9a1f"
+	form := url.Values{"SAMLResponse": {idp.respond(t, requestID, "new.user@example.com")}}
+	r := httptest.NewRequest(http.MethodPost, rootURL+sso.ACSPath, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: samlRequestCookie, Value: requestID})
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, http.StatusSeeOther, w.Body)
+	}
+	if location := w.Header().Get("Location"); !strings.Contains(location, "#") || !strings.Contains(location, "refresh_token=") {
+		t.Fatalf("Location = %q, want the tokens in the fragment", location)
+	}
+	for _, write := range []string{"INSERT INTO users", "INSERT IGNORE INTO user_roles", "INSERT INTO sessions"} {
+		if !connector.wrote(write) {
+			t.Errorf("%s... was not committed", write)
+		}
+	}
+}
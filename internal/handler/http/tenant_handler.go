@@ -0,0 +1,149 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-basics/internal/audit"
+	"go-basics/internal/auth"
+	"go-basics/internal/domain/tenant"
+)
+
+// tenantPolicyRequest is the expected JSON body for
+// PUT /admin/tenants/{tenant}/policy. It replaces the whole policy: a
+// list left out is emptied.
+type tenantPolicyRequest struct {
+	TenantID     string   `json:"-"`
+	CORSOrigins  []string `json:"cors_origins"`
+	RedirectURIs []string `json:"redirect_uris"`
+	WebhookURLs  []string `json:"webhook_urls"`
+}
+
+// bind reads the tenant ID from the path (see Handle).
+func (req *tenantPolicyRequest) bind(r *http.Request) error {
+	req.TenantID = r.PathValue("tenant")
+	return nil
+}
+
+// tenantIDRequest is the request for routes that only take a tenant ID.
+type tenantIDRequest struct {
+	TenantID string
+}
+
+// bind reads the tenant ID from the path (see Handle).
+func (req *tenantIDRequest) bind(r *http.Request) error {
+	req.TenantID = r.PathValue("tenant")
+	return nil
+}
+
+// tenantPolicyResponse is one tenant's policy.
+type tenantPolicyResponse struct {
+	TenantID     string    `json:"tenant_id"`
+	CORSOrigins  []string  `json:"cors_origins"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	WebhookURLs  []string  `json:"webhook_urls"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// tenantPolicyListResponse is every tenant's policy.
+type tenantPolicyListResponse struct {
+	Policies []tenantPolicyResponse `json:"policies"`
+}
+
+// TenantHandler handles the admin API for tenant policies.
+type TenantHandler struct {
+	tenants *tenant.Service
+	audit   *audit.Logger
+}
+
+// NewTenantHandler creates a new tenant policy handler. Changes are
+// recorded in auditLog.
+func NewTenantHandler(tenants *tenant.Service, auditLog *audit.Logger) *TenantHandler {
+	return &TenantHandler{tenants: tenants, audit: auditLog}
+}
+
+// RegisterRoutes sets up the admin routes for tenant policies. Like the
+// other admin routes, they need a JWT with their scope.
+func (h *TenantHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
+	manage := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeTenantsManage)(next))
+	}
+	mux.HandleFunc("GET /admin/tenants", manage(Handle(h.list)))
+	mux.HandleFunc("GET /admin/tenants/{tenant}/policy", manage(Handle(h.get)))
+	mux.HandleFunc("PUT /admin/tenants/{tenant}/policy", manage(Handle(h.set)))
+	mux.HandleFunc("DELETE /admin/tenants/{tenant}/policy", manage(Handle(h.remove, WithStatus(http.StatusNoContent))))
+}
+
+// list handles GET /admin/tenants
+// Returns every tenant that has a policy.
+func (h *TenantHandler) list(ctx context.Context, _ struct{}) (tenantPolicyListResponse, error) {
+	policies, err := h.tenants.Policies(ctx)
+	if err != nil {
+		return tenantPolicyListResponse{}, err
+	}
+	resp := tenantPolicyListResponse{Policies: make([]tenantPolicyResponse, 0, len(policies))}
+	for i := range policies {
+		resp.Policies = append(resp.Policies, tenantPolicyV1(&policies[i]))
+	}
+	return resp, nil
+}
+
+// get handles GET /admin/tenants/{tenant}/policy
+func (h *TenantHandler) get(ctx context.Context, req tenantIDRequest) (tenantPolicyResponse, error) {
+	p, err := h.tenants.Policy(ctx, req.TenantID)
+	if err != nil {
+		return tenantPolicyResponse{}, err
+	}
+	return tenantPolicyV1(p), nil
+}
+
+// set handles PUT /admin/tenants/{tenant}/policy
+// Replaces the tenant's policy and returns it normalized (see
+// tenant.Policy.Validate). This instance applies it at once, the others
+// within TENANT_POLICY_CACHE_TTL.
+func (h *TenantHandler) set(ctx context.Context, req tenantPolicyRequest) (tenantPolicyResponse, error) {
+	p, err := h.tenants.SetPolicy(ctx, tenant.Policy{
+		TenantID:     req.TenantID,
+		CORSOrigins:  req.CORSOrigins,
+		RedirectURIs: req.RedirectURIs,
+		WebhookURLs:  req.WebhookURLs,
+	})
+	if err != nil {
+		return tenantPolicyResponse{}, err
+	}
+	// What's trusted changes, so it's worth an audit trail, with the
+	// lists in full: "who let that origin in?" is the question.
+	h.audit.Record(ctx, audit.CategoryAdmin, actorName(ctx), "set tenant %s policy: cors_origins=[%s] redirect_uris=[%s] webhook_urls=[%s]",
+		p.TenantID, strings.Join(p.CORSOrigins, " "), strings.Join(p.RedirectURIs, " "), strings.Join(p.WebhookURLs, " "))
+	return tenantPolicyV1(p), nil
+}
+
+// remove handles DELETE /admin/tenants/{tenant}/policy
+// The tenant then allows nothing.
+func (h *TenantHandler) remove(ctx context.Context, req tenantIDRequest) (NoContent, error) {
+	if err := h.tenants.DeletePolicy(ctx, req.TenantID); err != nil {
+		return NoContent{}, err
+	}
+	h.audit.Record(ctx, audit.CategoryAdmin, actorName(ctx), "deleted tenant %s policy", req.TenantID)
+	return NoContent{}, nil
+}
+
+// tenantPolicyV1 converts a policy to its response. Empty lists are
+// sent as [], not null.
+func tenantPolicyV1(p *tenant.Policy) tenantPolicyResponse {
+	orEmpty := func(list []string) []string {
+		if list == nil {
+			return []string{}
+		}
+		return list
+	}
+	return tenantPolicyResponse{
+		TenantID:     p.TenantID,
+		CORSOrigins:  orEmpty(p.CORSOrigins),
+		RedirectURIs: orEmpty(p.RedirectURIs),
+		WebhookURLs:  orEmpty(p.WebhookURLs),
+		UpdatedAt:    p.UpdatedAt,
+	}
+}
@@ -13,14 +13,29 @@
 package http
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"go-basics/internal/auth"
+	"go-basics/internal/captcha"
+	"go-basics/internal/domain/campaign"
+	"go-basics/internal/domain/notification"
+	"go-basics/internal/domain/tenant"
 	"go-basics/internal/domain/user"
+	"go-basics/internal/metrics"
+	"go-basics/internal/redirect"
+	"go-basics/internal/risk"
+	"go-basics/internal/timing"
+	"go-basics/internal/txn"
 )
 
 // Request DTOs (Data Transfer Objects)
@@ -29,58 +44,294 @@ import (
 
 // registerRequest is the expected JSON body for user registration.
 // struct tags like `json:"email"` map JSON keys to struct fields.
+// Username is optional; one can be set later with PATCH /users/{id}.
+// CaptchaToken is only needed when CAPTCHA_PROVIDER is set.
 type registerRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email        string `json:"email"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password"`
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
 // loginRequest is the expected JSON body for user login.
+// The account is named by Email or Username; either field takes either,
+// so a login form with one "email or username" box can send it as email.
+// MFACode is only needed for accounts with two-factor authentication,
+// and CaptchaToken when CAPTCHA_PROVIDER is set.
 type loginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email        string `json:"email,omitempty"`
+	Username     string `json:"username,omitempty"`
+	Password     string `json:"password"`
+	MFACode      string `json:"mfa_code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"` // Instead of mfa_code, when the app is lost
+	CaptchaToken string `json:"captcha_token,omitempty"`
 }
 
-// updateRequest is the expected JSON body for user updates.
-// Both fields are optional - only non-empty fields are updated.
+// login returns what the account was named by: Email, or Username when
+// Email is empty.
+func (req loginRequest) login() string {
+	if req.Email != "" {
+		return req.Email
+	}
+	return req.Username
+}
+
+// updateRequest is the expected JSON body for user updates, with PUT or
+// PATCH. ID comes from the URL, not the body.
+//
+// Fields are pointers so that "not sent" (nil) and "sent empty" ("")
+// differ: an update changes only the fields it sends, and leaves the
+// rest alone. That's PATCH's meaning, and PUT here behaves the same.
+//
+// Email and Password are only here to reject them: they change through
+// POST /users/{id}/email and POST /users/{id}/password, which check the
+// current password (and, for the email, the new inbox) first. Sending
+// either, even empty, is an error, so a client that sends back the
+// whole profile learns that instead of thinking it changed something.
+//
+// Username is the one field that changes here; "" removes it.
 type updateRequest struct {
-	Email    string `json:"email,omitempty"`
-	Password string `json:"password,omitempty"`
+	ID       uint64  `json:"-"`
+	Email    *string `json:"email,omitempty"`
+	Password *string `json:"password,omitempty"`
+	Username *string `json:"username,omitempty"`
 }
 
-// Response DTOs
-// We use separate response types to control what data is exposed.
-// NEVER expose password hashes or internal fields in responses!
+// bind reads the user ID from the path (see Handle).
+func (req *updateRequest) bind(r *http.Request) (err error) {
+	req.ID, err = pathUserID(r)
+	return err
+}
+
+// Validate implements Validator.
+func (req *updateRequest) Validate() error {
+	if req.Password != nil {
+		return badRequest(CodePasswordReadOnly, "change the password with POST /users/%d/password", req.ID)
+	}
+	if req.Email != nil {
+		return badRequest(CodeEmailReadOnly, "change the email with POST /users/%d/email", req.ID)
+	}
+	return nil
+}
+
+// changePasswordRequest is the expected JSON body for a password change.
+// Device is the client making the change, which gets a new session.
+type changePasswordRequest struct {
+	ID              uint64      `json:"-"`
+	Device          user.Device `json:"-"`
+	CurrentPassword string      `json:"current_password"`
+	NewPassword     string      `json:"new_password"`
+}
+
+// bind reads the user ID from the path and the device from the request.
+func (req *changePasswordRequest) bind(r *http.Request) (err error) {
+	req.Device = deviceFromRequest(r)
+	req.ID, err = pathUserID(r)
+	return err
+}
+
+// userIDRequest is the request for routes that only take a user ID.
+type userIDRequest struct {
+	ID uint64
+}
+
+// bind reads the user ID from the path (see Handle).
+func (req *userIDRequest) bind(r *http.Request) (err error) {
+	req.ID, err = pathUserID(r)
+	return err
+}
+
+// listUsersRequest is the request for GET /users: the page size and
+// position, the filters, and the order, all from the query string.
+type listUsersRequest struct {
+	Limit      int
+	After      *user.Cursor
+	Filter     user.ListFilter
+	Sort       user.SortField
+	Descending bool
+}
+
+// bind reads the query parameters (see Handle). All are optional:
+// without them, the first DefaultListLimit users are returned, oldest
+// first.
+//
+//	?limit=50&after=<next_cursor>&email_prefix=ann&created_from=2026-01-01T00:00:00Z&verified=true&sort=-created_at
+func (req *listUsersRequest) bind(r *http.Request) error {
+	query := r.URL.Query()
+
+	limit, after, err := pageQuery(query)
+	if err != nil {
+		return err
+	}
+	req.Limit = limit
+	if after != "" {
+		cursor, err := user.DecodeCursor(after)
+		if err != nil {
+			return err
+		}
+		req.After = &cursor
+	}
+
+	// "-field" sorts descending, the convention most APIs share.
+	if v := query.Get("sort"); v != "" {
+		field, desc := strings.CutPrefix(v, "-")
+		req.Sort, req.Descending = user.SortField(field), desc
+		if !slices.Contains(user.SortFields, req.Sort) {
+			return badRequest(CodeRequestInvalidSort, "sort must be one of %v, optionally prefixed with -", user.SortFields)
+		}
+	}
+
+	req.Filter, err = listFilterQuery(query)
+	return err
+}
+
+// listFilterQuery reads the user list filters from a query string, for
+// GET /users and the export, which take the same ones:
+//
+//	?email_prefix=ann&created_from=2026-01-01T00:00:00Z&created_to=2026-02-01T00:00:00Z&verified=true
+func listFilterQuery(query url.Values) (user.ListFilter, error) {
+	filter := user.ListFilter{EmailPrefix: query.Get("email_prefix")}
+	for _, bound := range []struct {
+		name string
+		dest *time.Time
+	}{
+		{"created_from", &filter.CreatedFrom},
+		{"created_to", &filter.CreatedTo},
+	} {
+		if v := query.Get(bound.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return user.ListFilter{}, badRequest(CodeRequestInvalidFilter, "%s must be an RFC 3339 time, e.g. 2026-01-02T15:04:05Z", bound.name)
+			}
+			*bound.dest = t
+		}
+	}
+	if v := query.Get("verified"); v != "" {
+		verified, err := strconv.ParseBool(v)
+		if err != nil {
+			return user.ListFilter{}, badRequest(CodeRequestInvalidFilter, "verified must be true or false")
+		}
+		filter.Verified = &verified
+	}
+	return filter, nil
+}
+
+// searchUsersRequest is the request for GET /users/search: what to look
+// for, and the page size and position.
+type searchUsersRequest struct {
+	Query string
+	Limit int
+	After *user.SearchCursor
+}
+
+// bind reads the query parameters (see Handle). ?q is required; the
+// service decides whether there's anything in it to search for.
+//
+//	?q=ann smith&limit=50&after=<next_cursor>
+func (req *searchUsersRequest) bind(r *http.Request) error {
+	query := r.URL.Query()
+
+	req.Query = query.Get("q")
+	if strings.TrimSpace(req.Query) == "" {
+		return badRequest(CodeRequestInvalidSearch, "q is required")
+	}
+
+	limit, after, err := pageQuery(query)
+	if err != nil {
+		return err
+	}
+	req.Limit = limit
+	if after != "" {
+		cursor, err := user.DecodeSearchCursor(after)
+		if err != nil {
+			return err
+		}
+		req.After = &cursor
+	}
+	return nil
+}
 
-// userResponse is returned for single user operations.
-type userResponse struct {
-	ID    uint64 `json:"id"`
-	Email string `json:"email"`
+// pageQuery reads the page size and position every paginated listing
+// takes: ?limit, defaulting to DefaultListLimit, and ?after, the
+// previous page's next_cursor, still undecoded.
+//
+// ?after is the name most keyset-paginated APIs use; ?cursor came
+// first and stays. They're the same thing, so asking for two positions
+// at once is a mistake.
+func pageQuery(query url.Values) (limit int, after string, err error) {
+	limit = user.DefaultListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > user.MaxListLimit {
+			return 0, "", badRequest(CodeRequestInvalidLimit, "limit must be between 1 and %d", user.MaxListLimit)
+		}
+		limit = n
+	}
+
+	after = query.Get("after")
+	if c := query.Get("cursor"); c != "" {
+		if after != "" && after != c {
+			return 0, "", badRequest(CodeRequestInvalidCursor, "after and cursor are the same parameter; pass one")
+		}
+		after = c
+	}
+	return limit, after, nil
 }
 
-// loginResponse includes the JWT token for authentication.
-type loginResponse struct {
-	Token string       `json:"token"`
-	User  userResponse `json:"user"`
+// pathUserID parses the {id} path parameter.
+//
+// GO 1.22+: Extract path parameter using PathValue
+// Before 1.22, you'd have to manually parse the URL path
+func pathUserID(r *http.Request) (uint64, error) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, badRequest(CodeRequestInvalidID, "invalid user ID")
+	}
+	return id, nil
 }
 
+// Response DTOs
+// We use separate response types to control what data is exposed.
+// NEVER expose password hashes or internal fields in responses!
+// The user and session ones are built in response_v1.go.
+
 // errorResponse provides consistent error formatting.
+// Code is stable for clients to match on (see ErrorCode); Error is for
+// people and may be reworded.
 type errorResponse struct {
-	Error string `json:"error"`
+	Error string    `json:"error"`
+	Code  ErrorCode `json:"code"`
+	Field string    `json:"field,omitempty"` // The request field at fault, if one
 }
 
 // UserHandler handles HTTP requests for user operations.
 // It depends on the user service and JWT manager for authentication.
 type UserHandler struct {
-	service    *user.Service  // Business logic layer
-	jwtManager *auth.JWTManager // For generating tokens on login
+	service    *user.Service        // Business logic layer
+	jwtManager *auth.JWTManager     // For generating tokens on login
+	metrics    *metrics.AuthMetrics // Sign-up and login counters
+	coalescer  *Coalescer           // Merges concurrent identical reads (nil = off)
+	sessions   *user.Sessions       // Issues a refresh token per login
+	limit      Middleware           // Rate limit for /login
+
+	notifications *notification.Service // Tells users about sign-ins and password changes
+	captcha       captcha.Verifier      // Checks /register and /login for bots (nil = off)
+	risk          *risk.Assessor        // Scores logins, deciding what each takes (nil = off)
 }
 
 // NewUserHandler creates a new user handler.
 // This is dependency injection - we pass dependencies as parameters.
-func NewUserHandler(service *user.Service, jwtManager *auth.JWTManager) *UserHandler {
+func NewUserHandler(service *user.Service, jwtManager *auth.JWTManager, authMetrics *metrics.AuthMetrics, coalescer *Coalescer, sessions *user.Sessions, limit Middleware, notifications *notification.Service, captchaVerifier captcha.Verifier, riskAssessor *risk.Assessor) *UserHandler {
 	return &UserHandler{
-		service:    service,
-		jwtManager: jwtManager,
+		service:       service,
+		jwtManager:    jwtManager,
+		metrics:       authMetrics,
+		coalescer:     coalescer,
+		sessions:      sessions,
+		limit:         limit,
+		notifications: notifications,
+		captcha:       captchaVerifier,
+		risk:          riskAssessor,
 	}
 }
 
@@ -108,205 +359,448 @@ func NewUserHandler(service *user.Service, jwtManager *auth.JWTManager) *UserHan
 // Access path params with r.PathValue("id")
 func (h *UserHandler) RegisterRoutes(mux *http.ServeMux, authMiddleware *auth.Middleware) {
 	// Public routes - no authentication required
-	mux.HandleFunc("POST /register", h.register)
-	mux.HandleFunc("POST /login", h.login)
+	// Signup writes the user and its default role; txn.Middleware makes
+	// them commit together, so a failure can't leave a user without a role.
+	mux.HandleFunc("POST /register", txn.Middleware(h.register))
+	// Login is rate limited per IP and per email against password guessing.
+	mux.HandleFunc("POST /login", h.limit(h.login))
 
 	// Protected routes - require valid JWT token
-	// We wrap handlers with authMiddleware.AuthenticateFunc()
-	mux.HandleFunc("GET /users/{id}", authMiddleware.AuthenticateFunc(h.get))
-	mux.HandleFunc("PUT /users/{id}", authMiddleware.AuthenticateFunc(h.update))
-	mux.HandleFunc("DELETE /users/{id}", authMiddleware.AuthenticateFunc(h.delete))
+	// We wrap handlers with authMiddleware.AuthenticateFunc(),
+	// and each route declares the scope it needs with auth.RequireScope().
+	read := auth.RequireScope(auth.ScopeUsersRead)
+	write := auth.RequireScope(auth.ScopeUsersWrite)
+	// Users may only modify their own record; admins may modify anyone's.
+	owner := auth.RequireSelfOrRole("id", auth.RoleAdmin)
+	// Hot profiles are read by many clients at once, so identical
+	// concurrent GETs share one service call (see Coalescer).
+	// Handle turns each typed method into an http.HandlerFunc.
+	// Enumerating users is for admins: users:list isn't in RoleUser.
+	mux.HandleFunc("GET /users", authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeUsersList)(Handle(h.list))))
+	// Searching is enumerating by another name, so it takes the same scope.
+	// The literal "search" takes precedence over the {id} wildcard below.
+	mux.HandleFunc("GET /users/search", authMiddleware.AuthenticateFunc(auth.RequireScope(auth.ScopeUsersList)(Handle(h.search))))
+	mux.HandleFunc("GET /users/{id}", authMiddleware.AuthenticateFunc(read(h.coalescer.Wrap(Handle(h.get)))))
+	mux.HandleFunc("PUT /users/{id}", authMiddleware.AuthenticateFunc(write(owner(Handle(h.update)))))
+	// PATCH is the honest name for a partial update; PUT stays for the
+	// clients already using it.
+	mux.HandleFunc("PATCH /users/{id}", authMiddleware.AuthenticateFunc(write(owner(Handle(h.update)))))
+	mux.HandleFunc("DELETE /users/{id}", authMiddleware.AuthenticateFunc(write(owner(Handle(h.delete, WithStatus(http.StatusNoContent))))))
+	// The new password and the signed-out sessions commit together.
+	mux.HandleFunc("POST /users/{id}/password", authMiddleware.AuthenticateFunc(write(txn.Middleware(Handle(h.changePassword)))))
 
-	// Example of a protected route that gets current user info
-	mux.HandleFunc("GET /me", authMiddleware.AuthenticateFunc(h.me))
+	// The same operations on the caller's own account, for clients that
+	// don't know (and shouldn't depend on) their numeric ID.
+	mux.HandleFunc("GET /me", authMiddleware.AuthenticateFunc(h.coalescer.Wrap(Handle(h.me))))
+	mux.HandleFunc("PUT /me", authMiddleware.AuthenticateFunc(write(asSelf(Handle(h.update)))))
+	mux.HandleFunc("PATCH /me", authMiddleware.AuthenticateFunc(write(asSelf(Handle(h.update)))))
+	mux.HandleFunc("DELETE /me", authMiddleware.AuthenticateFunc(write(asSelf(Handle(h.delete, WithStatus(http.StatusNoContent))))))
+}
+
+// asSelf makes a /me route act like its /users/{id} twin by setting the
+// {id} path parameter to the caller's own ID, from the token's claims.
+//
+// WHY REUSE THE /users/{id} HANDLERS?
+// /me is only a different way to name the target. Going through the same
+// handler (and its bind, validation, and hooks) means the two can't drift
+// apart, e.g. with a check added to one and forgotten in the other.
+//
+// Must be applied INSIDE Authenticate, like auth.RequireScope.
+func asSelf(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims, ok := auth.GetClaimsFromContext(r.Context())
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "unauthorized")
+			return
+		}
+		r.SetPathValue("id", strconv.FormatUint(claims.UserID, 10))
+		next(w, r)
+	}
 }
 
 // register handles POST /register
 // Creates a new user account.
+//
+// register and login stay plain http.HandlerFuncs rather than using Handle:
+// they count malformed bodies in the auth metrics (with the request's trace
+// ID), which happens before a typed function would ever be called.
 func (h *UserHandler) register(w http.ResponseWriter, r *http.Request) {
 	// Step 1: Parse JSON request body
-	var req registerRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		// Client sent invalid JSON
-		writeError(w, http.StatusBadRequest, "invalid JSON format")
+	req, err := DecodeJSON[registerRequest](r)
+	if err != nil {
+		h.metrics.Signups.IncWithExemplar(metrics.TraceID(r), metrics.ResultFailure, reasonInvalidRequest)
+		handleServiceError(w, err)
 		return
 	}
 
-	// Step 2: Call service to create user
+	// Step 2: Make sure a person filled in the form, before any work
+	// (or database write) on the bot's behalf.
+	if err := h.checkCaptcha(r, req.CaptchaToken, "register"); err != nil {
+		h.metrics.Signups.IncWithExemplar(metrics.TraceID(r), metrics.ResultFailure, failureReason(err))
+		handleServiceError(w, err)
+		return
+	}
+
+	// Step 3: Call service to create user
 	// The service handles validation and business logic
-	newUser, err := h.service.Create(r.Context(), req.Email, req.Password)
+	endService := timing.Start(r.Context(), timing.Service)
+	newUser, err := h.service.Create(r.Context(), req.Email, req.Password, req.Username)
+	endService()
 	if err != nil {
+		h.metrics.Signups.IncWithExemplar(metrics.TraceID(r), metrics.ResultFailure, failureReason(err))
 		// Map domain errors to HTTP status codes
 		handleServiceError(w, err)
 		return
 	}
+	h.metrics.Signups.IncWithExemplar(metrics.TraceID(r), metrics.ResultSuccess, reasonOK)
 
-	// Step 3: Return success response
+	// Step 4: Return success response
 	// 201 Created is the correct status for successful resource creation
-	writeJSON(w, http.StatusCreated, userResponse{
-		ID:    newUser.ID,
-		Email: newUser.Email,
-	})
+	writeJSON(w, http.StatusCreated, userV1(newUser))
 }
 
 // login handles POST /login
 // Authenticates a user and returns a JWT token.
 func (h *UserHandler) login(w http.ResponseWriter, r *http.Request) {
-	var req loginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON format")
+	traceID := metrics.TraceID(r)
+
+	req, err := DecodeJSON[loginRequest](r)
+	if err != nil {
+		h.loginFailed(r, "", reasonInvalidRequest)
+		handleServiceError(w, err)
 		return
 	}
 
-	// Authenticate user (verify email and password)
-	authenticatedUser, err := h.service.Authenticate(r.Context(), req.Email, req.Password)
+	login := req.login()
+
+	// With risk scoring on, the attempt's score decides whether it needs
+	// a CAPTCHA, a second factor, or is refused (see package risk).
+	device := deviceFromRequest(r)
+	var ok bool
+	if device.KeyThumbprint, ok = proofKey(w, r, h.jwtManager); !ok {
+		h.loginFailed(r, login, reasonInvalidRequest)
+		return
+	}
+	attempt := risk.Attempt{Email: login, IPAddress: device.IPAddress, UserAgent: device.UserAgent}
+	needsCaptcha, needsMFA := true, false
+	if h.risk != nil {
+		attempt.Country = h.risk.Locate(r)
+		decision, err := h.risk.Assess(r.Context(), attempt)
+		if err != nil {
+			log.Printf("assessing login risk: %v", err)
+			h.loginFailed(r, login, reasonError)
+			writeError(w, http.StatusInternalServerError, "failed to assess login")
+			return
+		}
+		if decision.Requires(risk.ActionBlock) {
+			h.loginFailed(r, login, reasonRiskBlocked)
+			handleServiceError(w, risk.ErrBlocked)
+			return
+		}
+		needsCaptcha, needsMFA = decision.Requires(risk.ActionCaptcha), decision.Requires(risk.ActionMFA)
+	}
+
+	// Bots don't get to guess passwords. The rate limit still applies
+	// to people: it ran before this.
+	if needsCaptcha {
+		if err := h.checkCaptcha(r, req.CaptchaToken, "login"); err != nil {
+			h.loginFailed(r, login, failureReason(err))
+			handleServiceError(w, err)
+			return
+		}
+	}
+
+	// Authenticate user (verify email or username, and password)
+	endService := timing.Start(r.Context(), timing.Service)
+	factor := user.SecondFactor{Code: req.MFACode, RecoveryCode: req.RecoveryCode}
+	authenticatedUser, err := h.service.Authenticate(r.Context(), login, req.Password, factor)
+	endService()
+	switch {
+	case errors.Is(err, user.ErrMFARequired):
+		h.metrics.MFAChallenges.IncWithExemplar(traceID, metrics.ResultRequired)
+	case errors.Is(err, user.ErrInvalidMFACode), errors.Is(err, user.ErrInvalidRecoveryCode):
+		h.metrics.MFAChallenges.IncWithExemplar(traceID, metrics.ResultFailure)
+	case err == nil && authenticatedUser.MFAEnabled:
+		h.metrics.MFAChallenges.IncWithExemplar(traceID, metrics.ResultSuccess)
+	}
 	if err != nil {
+		h.loginFailed(r, login, failureReason(err))
 		handleServiceError(w, err)
 		return
 	}
+	// An account with 2FA just gave its second factor. One without has
+	// none to ask for, so a score that calls for one refuses the login;
+	// the owner can still sign in from a device they used before.
+	if needsMFA && !authenticatedUser.MFAEnabled {
+		h.loginFailed(r, login, reasonRiskMFA)
+		handleServiceError(w, risk.ErrSecondFactorRequired)
+		return
+	}
 
 	// Generate JWT token for the authenticated user
-	token, err := h.jwtManager.GenerateToken(authenticatedUser.ID, authenticatedUser.Email)
+	// Roles are embedded so RequireRole can authorize without a DB lookup
+	token, err := h.jwtManager.GenerateTokenContext(r.Context(), authenticatedUser.ID, authenticatedUser.Email, roleNames(authenticatedUser.Roles),
+		auth.AtVersion(authenticatedUser.TokenVersion), auth.BoundTo(r), auth.BoundToKey(device.KeyThumbprint))
 	if err != nil {
 		// Token generation shouldn't fail normally - log for debugging
 		log.Printf("failed to generate token: %v", err)
+		h.loginFailed(r, login, reasonError)
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
 	}
 
-	// Return token and user info
-	writeJSON(w, http.StatusOK, loginResponse{
-		Token: token,
-		User: userResponse{
-			ID:    authenticatedUser.ID,
-			Email: authenticatedUser.Email,
-		},
+	// Open a session for this device. Its refresh token gets new access
+	// tokens after this one expires, without asking for the password again.
+	refreshToken, err := h.sessions.Start(r.Context(), authenticatedUser.ID, device)
+	if errors.Is(err, user.ErrAccountDisabled) {
+		h.loginFailed(r, login, failureReason(err))
+		handleServiceError(w, err)
+		return
+	}
+	if err != nil {
+		log.Printf("failed to start session: %v", err)
+		h.loginFailed(r, login, reasonError)
+		writeError(w, http.StatusInternalServerError, "failed to start session")
+		return
+	}
+	h.notify(r.Context(), notification.NewSignIn(authenticatedUser.ID, device.UserAgent, device.IPAddress))
+	if h.risk != nil {
+		// The country becomes a known one; failing to note it only means
+		// the next login from there scores a little higher.
+		if err := h.risk.Succeeded(r.Context(), authenticatedUser.ID, attempt); err != nil {
+			log.Printf("recording login for risk scoring: %v", err)
+		}
+	}
+	h.metrics.LoginAttempts.IncWithExemplar(traceID, metrics.ResultSuccess, reasonOK)
+	// A recovery code login is reported as its own method, so hooks can
+	// audit it and warn the user: it means the app is lost, or someone
+	// has both the password and a code.
+	recovered := authenticatedUser.MFAEnabled && factor.UsesRecoveryCode()
+	method := auth.MethodPassword
+	if recovered {
+		method = auth.MethodRecoveryCode
+	}
+	h.jwtManager.Emit(r.Context(), auth.LoginSucceeded{
+		UserID:    authenticatedUser.ID,
+		Email:     authenticatedUser.Email,
+		Method:    method,
+		IPAddress: device.IPAddress,
+		UserAgent: device.UserAgent,
+		At:        time.Now().UTC(),
 	})
+
+	// Return tokens and user info
+	resp := loginV1(token, refreshToken, authenticatedUser)
+	resp.TokenType = tokenType(device.KeyThumbprint)
+	resp.MFAReenrollmentRequired = recovered
+	writeJSON(w, http.StatusOK, resp)
 }
 
-// get handles GET /users/{id}
-// Retrieves a user by ID. Requires authentication.
-func (h *UserHandler) get(w http.ResponseWriter, r *http.Request) {
-	// GO 1.22+: Extract path parameter using PathValue
-	// Before 1.22, you'd have to manually parse the URL path
-	idStr := r.PathValue("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
-	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid user ID")
-		return
+// loginFailed counts a refused login and reports it to the auth event
+// hooks. reason is the metric label, which doubles as the event's reason.
+func (h *UserHandler) loginFailed(r *http.Request, email, reason string) {
+	h.metrics.LoginAttempts.IncWithExemplar(metrics.TraceID(r), metrics.ResultFailure, reason)
+	device := deviceFromRequest(r)
+	h.jwtManager.Emit(r.Context(), auth.LoginFailed{
+		Email:     email,
+		Method:    auth.MethodPassword,
+		Reason:    reason,
+		IPAddress: device.IPAddress,
+		UserAgent: device.UserAgent,
+		At:        time.Now().UTC(),
+	})
+}
+
+// checkCaptcha verifies the CAPTCHA token sent with the form named
+// action, if CAPTCHA is enabled.
+//
+// WHY A TOKEN ON EVERY LOGIN, AND NOT ONLY AFTER FAILURES?
+// Credential stuffing spreads guesses across many accounts, so no one
+// account sees enough failures to trip a "show a CAPTCHA now" rule. The
+// widget is invisible to most people (Turnstile, reCAPTCHA v3), so the
+// check costs them nothing. With risk scoring on, the policy decides
+// instead: failures are only one of its signals, and a stuffing attempt
+// comes from a device the account has never seen. "captcha=0" still
+// asks every login.
+func (h *UserHandler) checkCaptcha(r *http.Request, token, action string) error {
+	if h.captcha == nil {
+		return nil
 	}
+	err := h.captcha.Verify(r.Context(), token, deviceFromRequest(r).IPAddress, action)
+	if errors.Is(err, captcha.ErrUnavailable) {
+		log.Printf("captcha: %v", err)
+	}
+	return err
+}
 
+// get handles GET /users/{id}
+// Retrieves a user by ID. Requires authentication.
+func (h *UserHandler) get(ctx context.Context, req userIDRequest) (userResponse, error) {
 	// Get user from service
-	foundUser, err := h.service.GetByID(r.Context(), id)
+	foundUser, err := h.service.GetByID(ctx, req.ID)
 	if err != nil {
-		handleServiceError(w, err)
-		return
+		return userResponse{}, err
 	}
 
-	writeJSON(w, http.StatusOK, userResponse{
-		ID:    foundUser.ID,
-		Email: foundUser.Email,
-	})
+	return userV1(foundUser), nil
 }
 
-// update handles PUT /users/{id}
-// Updates a user's information. Requires authentication.
-func (h *UserHandler) update(w http.ResponseWriter, r *http.Request) {
-	// Parse path parameter
-	idStr := r.PathValue("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+// list handles GET /users
+// Returns one page of the users matching the filters, oldest first
+// unless ?sort says otherwise, and the cursor for the next.
+//
+// WHY CURSORS, NOT ?page=N?
+// A page number turns into OFFSET, which gets slower the deeper a client
+// pages and skips or repeats users when someone signs up meanwhile (see
+// user.Cursor). Clients that want "page 3 of 12" still get the total.
+func (h *UserHandler) list(ctx context.Context, req listUsersRequest) (userListResponse, error) {
+	page, err := h.service.List(ctx, user.ListParams{
+		Limit:      req.Limit,
+		After:      req.After,
+		Filter:     req.Filter,
+		Sort:       req.Sort,
+		Descending: req.Descending,
+	})
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid user ID")
-		return
+		return userListResponse{}, err
 	}
+	return userListV1(page, req.Limit), nil
+}
 
-	// AUTHORIZATION CHECK:
-	// Users should only be able to update their own profile.
-	// Get the authenticated user's ID from the JWT claims in context.
-	claims, ok := auth.GetClaimsFromContext(r.Context())
-	if !ok {
-		writeError(w, http.StatusUnauthorized, "unauthorized")
-		return
-	}
-	if claims.UserID != id {
-		// User is trying to update someone else's profile
-		writeError(w, http.StatusForbidden, "you can only update your own profile")
-		return
+// search handles GET /users/search
+// Returns one page of the users whose email matches ?q, best match
+// first, and the cursor for the next (see user.Service.Search).
+func (h *UserHandler) search(ctx context.Context, req searchUsersRequest) (userListResponse, error) {
+	page, err := h.service.Search(ctx, req.Query, req.Limit, req.After)
+	if err != nil {
+		return userListResponse{}, err
 	}
+	return userSearchV1(page, req.Limit), nil
+}
 
-	// Parse request body
-	var req updateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid JSON format")
-		return
-	}
+// update handles PUT and PATCH on /users/{id} and /me
+// Updates the caller's own profile, or any profile for an admin, changing
+// only the fields sent (see updateRequest).
+//
+// No path through here touches the password hash: the password isn't a
+// Patch field, and a Patch writes only the columns it sets, so an update
+// can't rehash it, changed or not.
+func (h *UserHandler) update(ctx context.Context, req updateRequest) (userResponse, error) {
+	// AUTHORIZATION: the route's RequireSelfOrRole already made sure the
+	// caller owns this profile or is an admin.
 
-	// Update user
-	updatedUser, err := h.service.Update(r.Context(), id, req.Email, req.Password)
+	// Email and password have endpoints of their own (see Validate).
+	// Fields left out of the body (nil) keep their stored values; with
+	// none sent, the profile comes back as is.
+	updated, err := h.service.Patch(ctx, req.ID, user.Patch{Username: req.Username})
 	if err != nil {
-		handleServiceError(w, err)
-		return
+		return userResponse{}, err
 	}
 
 	// 200 OK for successful update
-	writeJSON(w, http.StatusOK, userResponse{
-		ID:    updatedUser.ID,
-		Email: updatedUser.Email,
-	})
+	return userV1(updated), nil
 }
 
-// delete handles DELETE /users/{id}
-// Soft-deletes a user. Requires authentication.
-func (h *UserHandler) delete(w http.ResponseWriter, r *http.Request) {
-	idStr := r.PathValue("id")
-	id, err := strconv.ParseUint(idStr, 10, 64)
+// changePassword handles POST /users/{id}/password
+// Changes the password if the current one is right, and signs every
+// device out. The caller gets fresh tokens, so only it stays signed in.
+//
+// WHY SIGN EVERYONE OUT?
+// A password change is often a reaction to "someone else has my
+// account". Their refresh token would otherwise keep working for weeks,
+// and their access token until it expires. The change raises the
+// user's token version, which revokes every access token, this one
+// included; the sessions are revoked here.
+func (h *UserHandler) changePassword(ctx context.Context, req changePasswordRequest) (loginResponse, error) {
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return loginResponse{}, errUnauthorized
+	}
+	if claims.UserID != req.ID {
+		return loginResponse{}, forbidden("you can only change your own password")
+	}
+	// The response is a full, non-impersonation token for the user, so an
+	// admin acting as them must not get one this way.
+	if claims.Impersonated() {
+		return loginResponse{}, forbidden("passwords can't be changed while impersonating")
+	}
+
+	u, err := h.service.ChangePassword(ctx, req.ID, req.CurrentPassword, req.NewPassword)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid user ID")
-		return
+		return loginResponse{}, err
+	}
+	if err := h.sessions.RevokeAll(ctx, req.ID); err != nil {
+		return loginResponse{}, err
 	}
+	h.jwtManager.Emit(ctx, auth.TokenRevoked{UserID: req.ID, Reason: auth.RevokedPasswordChanged, At: time.Now().UTC()})
+	h.notify(ctx, notification.PasswordChanged(req.ID))
 
-	// Authorization: users can only delete themselves
-	claims, ok := auth.GetClaimsFromContext(r.Context())
-	if !ok {
-		writeError(w, http.StatusUnauthorized, "unauthorized")
-		return
+	// Sign this device back in, as at login, with its DPoP key if its
+	// token had one: the middleware checked the proof.
+	req.Device.KeyThumbprint = claims.DPoPKey()
+	refreshToken, err := h.sessions.Start(ctx, req.ID, req.Device)
+	if err != nil {
+		return loginResponse{}, err
 	}
-	if claims.UserID != id {
-		writeError(w, http.StatusForbidden, "you can only delete your own account")
-		return
+	// The caller's token got here from the client it's bound to, so the
+	// new one is bound the same way.
+	token, err := h.jwtManager.GenerateTokenContext(ctx, claims.UserID, claims.Email, claims.Roles, auth.AtVersion(u.TokenVersion),
+		auth.BoundLike(claims))
+	if err != nil {
+		return loginResponse{}, fmt.Errorf("generating token: %w", err)
 	}
 
-	if err := h.service.Delete(r.Context(), id); err != nil {
-		handleServiceError(w, err)
-		return
+	resp := loginV1(token, refreshToken, u)
+	resp.TokenType = tokenType(claims.DPoPKey())
+	return resp, nil
+}
+
+// delete handles DELETE /users/{id} and DELETE /me
+// Soft-deletes the caller's own account, or any account for an admin.
+// Registered WithStatus(http.StatusNoContent): 204 is standard for DELETE.
+func (h *UserHandler) delete(ctx context.Context, req userIDRequest) (NoContent, error) {
+	// Authorization: the route's RequireSelfOrRole lets users delete
+	// themselves and admins delete anyone.
+	claims, ok := auth.GetClaimsFromContext(ctx)
+	if !ok {
+		return NoContent{}, errUnauthorized
 	}
 
-	// 204 No Content is standard for successful DELETE
-	w.WriteHeader(http.StatusNoContent)
+	if err := h.service.Delete(ctx, req.ID); err != nil {
+		return NoContent{}, err
+	}
+	if claims.UserID != req.ID {
+		// Deleting someone else's account is an admin action; keep a trail.
+		log.Printf("admin: user %d deleted user %d", claims.UserID, req.ID)
+	}
+	return NoContent{}, nil
 }
 
 // me handles GET /me
 // Returns the currently authenticated user's information.
 // This is a convenience endpoint so users don't need to know their ID.
-func (h *UserHandler) me(w http.ResponseWriter, r *http.Request) {
+func (h *UserHandler) me(ctx context.Context, _ struct{}) (userResponse, error) {
 	// Get user ID from JWT claims
-	claims, ok := auth.GetClaimsFromContext(r.Context())
+	claims, ok := auth.GetClaimsFromContext(ctx)
 	if !ok {
-		writeError(w, http.StatusUnauthorized, "unauthorized")
-		return
+		return userResponse{}, errUnauthorized
 	}
 
 	// Fetch full user data
-	currentUser, err := h.service.GetByID(r.Context(), claims.UserID)
+	currentUser, err := h.service.GetByID(ctx, claims.UserID)
 	if err != nil {
-		handleServiceError(w, err)
-		return
+		return userResponse{}, err
 	}
 
-	writeJSON(w, http.StatusOK, userResponse{
-		ID:    currentUser.ID,
-		Email: currentUser.Email,
-	})
+	return meV1(currentUser), nil
+}
+
+// notify sends a notification, logging a failure: the action it
+// reports has already happened, and shouldn't fail because of it.
+func (h *UserHandler) notify(ctx context.Context, n notification.Notification) {
+	if err := h.notifications.Notify(ctx, n); err != nil {
+		log.Printf("notifying user %d (%s): %v", n.UserID, n.Kind, err)
+	}
 }
 
 // handleServiceError maps domain errors to HTTP responses.
@@ -322,22 +816,147 @@ func (h *UserHandler) me(w http.ResponseWriter, r *http.Request) {
 func handleServiceError(w http.ResponseWriter, err error) {
 	switch {
 	case errors.Is(err, user.ErrNotFound):
-		writeError(w, http.StatusNotFound, "user not found")
+		writeCode(w, CodeUserNotFound, "user not found")
 	case errors.Is(err, user.ErrEmailExists):
-		writeError(w, http.StatusConflict, "email already exists")
+		writeCode(w, CodeEmailExists, "email already exists")
 	case errors.Is(err, user.ErrInvalidCredentials):
-		writeError(w, http.StatusUnauthorized, "invalid email or password")
+		writeCode(w, CodeAuthInvalidCredentials, "invalid email, username, or password")
 	case errors.Is(err, user.ErrInvalidEmail):
-		writeError(w, http.StatusBadRequest, "invalid email format")
+		writeCode(w, CodeEmailInvalidFormat, "invalid email format")
+	case errors.Is(err, user.ErrInvalidUsername):
+		writeCode(w, CodeUsernameInvalid, fmt.Sprintf("username must be %d to %d lowercase letters, digits, underscores, or dots, starting with a letter",
+			user.MinUsernameLength, user.MaxUsernameLength))
+	case errors.Is(err, user.ErrUsernameReserved):
+		writeCode(w, CodeUsernameReserved, "username is reserved")
+	case errors.Is(err, user.ErrUsernameTaken):
+		writeCode(w, CodeUsernameTaken, "username is taken")
 	case errors.Is(err, user.ErrPasswordTooShort):
-		writeError(w, http.StatusBadRequest, "password must be at least 8 characters")
+		writeCode(w, CodePasswordTooShort, "password must be at least 8 characters")
 	case errors.Is(err, user.ErrPasswordTooLong):
-		writeError(w, http.StatusBadRequest, "password must be at most 72 characters")
+		writeCode(w, CodePasswordTooLong, "password must be at most 72 characters")
+	case errors.Is(err, user.ErrUnknownRole):
+		writeCode(w, CodeRoleUnknown, "unknown role")
+	case errors.Is(err, user.ErrInvalidResetToken):
+		writeCode(w, CodePasswordResetTokenInvalid, "invalid or expired reset token")
+	case errors.Is(err, user.ErrMFARequired):
+		// The client should prompt for a code and repeat the login with mfa_code.
+		writeCode(w, CodeMFARequired, "two-factor code required")
+	case errors.Is(err, user.ErrInvalidMFACode):
+		writeCode(w, CodeMFAInvalidCode, "invalid two-factor code")
+	case errors.Is(err, user.ErrInvalidRecoveryCode):
+		writeCode(w, CodeMFAInvalidRecoveryCode, "invalid or already used recovery code")
+	case errors.Is(err, user.ErrMFAResetNotAllowed):
+		writeCode(w, CodeMFAResetNotAllowed, "sign in with a recovery code before resetting two-factor authentication")
+	case errors.Is(err, user.ErrMFAAlreadyEnabled):
+		writeCode(w, CodeMFAAlreadyEnabled, "two-factor authentication is already enabled")
+	case errors.Is(err, user.ErrMFANotEnrolled):
+		writeCode(w, CodeMFANotEnrolled, "two-factor authentication is not set up")
+	case errors.Is(err, user.ErrInvalidRefreshToken):
+		// The client should send the user back to the login screen.
+		writeCode(w, CodeRefreshTokenInvalid, "invalid or expired refresh token")
+	case errors.Is(err, user.ErrInvalidCursor):
+		writeCode(w, CodeRequestInvalidCursor, "invalid cursor, or one from another listing or sort")
+	case errors.Is(err, user.ErrInvalidSearch):
+		writeCode(w, CodeRequestInvalidSearch, err.Error())
+	case errors.Is(err, user.ErrInvalidSort):
+		writeCode(w, CodeRequestInvalidSort, fmt.Sprintf("sort must be one of %v", user.SortFields))
+	case errors.Is(err, user.ErrSessionNotFound):
+		writeCode(w, CodeSessionNotFound, "session not found")
+	case errors.Is(err, user.ErrIncorrectPassword):
+		writeCode(w, CodePasswordIncorrect, "current password is incorrect")
+	case errors.Is(err, user.ErrInvalidEmailChangeToken):
+		writeCode(w, CodeEmailChangeTokenInvalid, "invalid or expired email change token")
+	case errors.Is(err, user.ErrEmailUnchanged):
+		writeCode(w, CodeEmailUnchanged, "new email is the same as the current one")
+	case errors.Is(err, user.ErrUnknownEmailTemplate):
+		writeCode(w, CodeEmailTemplateUnknown, "unknown email template")
+	case errors.Is(err, user.ErrNoLinkedAccount):
+		writeCode(w, CodeAuthNoLinkedAccount, "no account for this identity")
+	case errors.Is(err, user.ErrAccountDisabled):
+		writeCode(w, CodeAuthAccountDisabled, err.Error())
+	case errors.Is(err, user.ErrAccountDeactivated):
+		writeCode(w, CodeAuthAccountDeactivated, err.Error())
+	case errors.Is(err, user.ErrDeactivateSelf):
+		writeCode(w, CodeDeactivationSelf, "you can't deactivate yourself")
+	case errors.Is(err, captcha.ErrMissing):
+		writeCode(w, CodeCaptchaRequired, "captcha_token is required")
+	case errors.Is(err, captcha.ErrFailed):
+		writeCode(w, CodeCaptchaFailed, "captcha verification failed")
+	case errors.Is(err, captcha.ErrUnavailable):
+		// Refused rather than let through: see captcha.ErrUnavailable.
+		writeCode(w, CodeCaptchaUnavailable, "captcha verification is unavailable, try again later")
+	case errors.Is(err, risk.ErrBlocked):
+		writeCode(w, CodeRiskBlocked, "sign-in blocked")
+	case errors.Is(err, risk.ErrSecondFactorRequired):
+		writeCode(w, CodeRiskMFARequired, "this sign-in needs two-factor authentication")
+	case errors.Is(err, user.ErrInvalidImage):
+		writeCode(w, CodeAvatarInvalid, err.Error())
+	case errors.Is(err, user.ErrImageTooLarge):
+		writeCode(w, CodeAvatarTooLarge, err.Error())
+	case errors.Is(err, redirect.ErrInvalid):
+		writeCode(w, CodeRedirectInvalid, err.Error())
+	case errors.Is(err, redirect.ErrNotAllowed):
+		writeCode(w, CodeRedirectNotAllowed, err.Error())
+	case errors.Is(err, user.ErrAnonymizationPending):
+		writeCode(w, CodeAnonymizationPending, "anonymization already requested")
+	case errors.Is(err, user.ErrNoAnonymizationRequest):
+		writeCode(w, CodeAnonymizationNotFound, "no anonymization request pending")
+	case errors.Is(err, user.ErrInvalidInvitation):
+		writeCode(w, CodeInvitationInvalid, "invalid or expired invitation")
+	case errors.Is(err, user.ErrInvitationNotFound):
+		writeCode(w, CodeInvitationNotFound, "invitation not found")
+	case errors.Is(err, user.ErrInvitationClosed):
+		writeCode(w, CodeInvitationClosed, "invitation was already accepted or revoked")
+	case errors.Is(err, campaign.ErrInvalidTemplate):
+		writeCode(w, CodeCampaignTemplate, err.Error())
+	case errors.Is(err, campaign.ErrInvalidSegment):
+		writeCode(w, CodeCampaignSegment, err.Error())
+	case errors.Is(err, campaign.ErrNotFound):
+		writeCode(w, CodeCampaignNotFound, "campaign not found")
+	case errors.Is(err, campaign.ErrFinished):
+		writeCode(w, CodeCampaignFinished, "campaign already completed or was canceled")
+	case errors.Is(err, campaign.ErrInvalidDeliveryStatus):
+		writeCode(w, CodeDeliveryStatusInvalid, fmt.Sprintf("status must be one of %v", campaign.DeliveryStatuses))
+	case errors.Is(err, tenant.ErrInvalidTenantID):
+		writeCode(w, CodeTenantInvalidID, "invalid tenant ID")
+	case errors.Is(err, tenant.ErrInvalidPolicy):
+		writeCode(w, CodeTenantPolicyInvalid, err.Error())
+	case errors.Is(err, tenant.ErrPolicyNotFound):
+		writeCode(w, CodeTenantPolicyNotFound, "tenant has no policy")
+	case errors.Is(err, notification.ErrInvalidFrequency):
+		writeCode(w, CodeFrequencyInvalid, fmt.Sprintf("frequency must be one of %v", notification.Frequencies))
+	case errors.Is(err, notification.ErrInvalidSubscription):
+		writeCode(w, CodePushInvalid, "invalid push subscription: endpoint must be a known push service and keys must come from the browser")
+	case errors.Is(err, notification.ErrSubscriptionNotFound):
+		writeCode(w, CodePushNotFound, "push subscription not found")
+	case errors.Is(err, notification.ErrPushDisabled):
+		writeCode(w, CodePushDisabled, "web push is not enabled")
+	case errors.Is(err, context.DeadlineExceeded):
+		// The request ran past its deadline (see Deadline). Nothing is
+		// wrong with it or with us, so it isn't logged as an internal error.
+		writeCode(w, CodeUnavailable, "request timed out, try again")
+	case errors.Is(err, context.Canceled):
+		// The client went away; nobody will read this. The status is
+		// nginx's "client closed request", so metrics and access logs
+		// tell these apart from real failures.
+		w.WriteHeader(statusClientClosedRequest)
 	default:
+		// Problems with the request itself (e.g. from DecodeJSON)
+		// already carry their status, code, and message.
+		var requestErr *RequestError
+		if errors.As(err, &requestErr) {
+			writeRequestError(w, requestErr)
+			return
+		}
+
 		// Check if it's a validation error
 		var validationErr *user.ValidationError
 		if errors.As(err, &validationErr) {
-			writeError(w, http.StatusBadRequest, validationErr.Error())
+			code := ErrorCode(validationErr.Code)
+			if code == "" {
+				code = CodeRequestInvalid
+			}
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: validationErr.Error(), Code: code, Field: validationErr.Field})
 			return
 		}
 		// Unknown error - log it but don't expose details to client
@@ -346,22 +965,118 @@ func handleServiceError(w http.ResponseWriter, err error) {
 	}
 }
 
+// Metric reason labels for sign-up and login attempts.
+// Keep this set small and fixed: each value becomes a separate time series.
+const (
+	reasonOK                 = "ok"
+	reasonInvalidRequest     = "invalid_request"
+	reasonInvalidEmail       = "invalid_email"
+	reasonInvalidPassword    = "invalid_password"
+	reasonEmailExists        = "email_exists"
+	reasonInvalidUsername    = "invalid_username"
+	reasonUsernameTaken      = "username_taken"
+	reasonInvalidCredentials = "invalid_credentials"
+	reasonMFARequired        = "mfa_required"
+	reasonInvalidMFACode     = "invalid_mfa_code"
+	reasonInvalidRecovery    = "invalid_recovery_code"
+	reasonAccountDisabled    = "account_disabled"
+	reasonAccountDeactivated = "account_deactivated"
+	reasonCaptcha            = "captcha"
+	reasonRiskBlocked        = "risk_blocked"
+	reasonRiskMFA            = "risk_mfa_required"
+	reasonCanceled           = "canceled" // The client left, or the request timed out
+	reasonError              = "error"
+)
+
+// statusClientClosedRequest is the status recorded for a request whose
+// client disconnected before the response. It's not in the HTTP spec;
+// nginx introduced it for the same purpose.
+const statusClientClosedRequest = 499
+
+// failureReason maps a service error to a metric reason label.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, user.ErrInvalidCredentials):
+		return reasonInvalidCredentials
+	case errors.Is(err, user.ErrMFARequired):
+		return reasonMFARequired
+	case errors.Is(err, user.ErrInvalidMFACode):
+		return reasonInvalidMFACode
+	case errors.Is(err, user.ErrInvalidRecoveryCode):
+		return reasonInvalidRecovery
+	case errors.Is(err, user.ErrAccountDisabled):
+		return reasonAccountDisabled
+	case errors.Is(err, user.ErrAccountDeactivated):
+		return reasonAccountDeactivated
+	case errors.Is(err, captcha.ErrMissing), errors.Is(err, captcha.ErrFailed):
+		return reasonCaptcha
+	case errors.Is(err, risk.ErrBlocked):
+		return reasonRiskBlocked
+	case errors.Is(err, risk.ErrSecondFactorRequired):
+		return reasonRiskMFA
+	case errors.Is(err, user.ErrEmailExists):
+		return reasonEmailExists
+	case errors.Is(err, user.ErrInvalidEmail):
+		return reasonInvalidEmail
+	case errors.Is(err, user.ErrInvalidUsername), errors.Is(err, user.ErrUsernameReserved):
+		return reasonInvalidUsername
+	case errors.Is(err, user.ErrUsernameTaken):
+		return reasonUsernameTaken
+	case errors.Is(err, user.ErrPasswordTooShort), errors.Is(err, user.ErrPasswordTooLong):
+		return reasonInvalidPassword
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return reasonCanceled
+	default:
+		return reasonError
+	}
+}
+
+// roleNames converts domain roles to the plain strings stored in tokens.
+func roleNames(roles []user.Role) []string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = string(role)
+	}
+	return names
+}
+
 // writeJSON writes a JSON response with the given status code.
 // This is a helper function to reduce code duplication.
+//
+// The body is encoded before the status is written, so the encoding time
+// can still make it into the Server-Timing header (see package timing).
 func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	endEncode := timing.StartWriter(w, timing.Encode)
+	body, err := json.Marshal(data)
+	endEncode()
+	if err != nil {
+		// This shouldn't happen with valid data, but log it if it does
+		log.Printf("failed to encode JSON response: %v", err)
+	}
+
 	// Set Content-Type header BEFORE WriteHeader
 	// Headers must be set before writing the body
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-
-	// Encode data to JSON and write to response
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		// This shouldn't happen with valid data, but log it if it does
-		log.Printf("failed to encode JSON response: %v", err)
-	}
+	// json.Encoder ended the body with a newline; keep doing so.
+	w.Write(append(body, '\n'))
 }
 
-// writeError writes an error response in JSON format.
+// writeError writes an error response in JSON format, with the status's
+// fallback code. Prefer writeCode when the error has a code of its own.
 func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, errorResponse{Error: message})
+	writeJSON(w, status, errorResponse{Error: message, Code: statusCode(status)})
+}
+
+// writeRequestError writes a RequestError, filling in its code and field
+// when it has none of its own.
+func writeRequestError(w http.ResponseWriter, e *RequestError) {
+	code, field := e.Code, e.Field
+	if code == "" {
+		code = statusCode(e.Status)
+	}
+	if field == "" {
+		field = errorCodes[code].Field
+	}
+	writeJSON(w, e.Status, errorResponse{Error: e.Message, Code: code, Field: field})
 }
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrDeadLetterNotFound is returned for a dead-letter ID that doesn't
+// exist (or was requeued or discarded already).
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a job that failed on every attempt, kept for an operator
+// to look into. Job.Errors is its error trace.
+type DeadLetter struct {
+	ID uint64
+	Job
+	FailedAt time.Time
+}
+
+// DeadLetterStore keeps jobs that failed for good. It's shared by every
+// instance, so an operator sees them all in one place.
+type DeadLetterStore interface {
+	// Add stores a failed job.
+	Add(ctx context.Context, job Job) error
+
+	// List returns up to limit dead letters, newest first.
+	List(ctx context.Context, limit int) ([]DeadLetter, error)
+
+	// Get returns one dead letter, or ErrDeadLetterNotFound.
+	Get(ctx context.Context, id uint64) (*DeadLetter, error)
+
+	// Take removes and returns one dead letter, or ErrDeadLetterNotFound.
+	// Of two concurrent Takes of the same ID, only one gets it.
+	Take(ctx context.Context, id uint64) (*DeadLetter, error)
+
+	// Count returns how many dead letters there are.
+	Count(ctx context.Context) (int, error)
+}
+
+// DeadLetters returns up to limit dead letters, newest first.
+func (q *Queue) DeadLetters(ctx context.Context, limit int) ([]DeadLetter, error) {
+	return q.dead.List(ctx, limit)
+}
+
+// DeadLetter returns one dead letter.
+func (q *Queue) DeadLetter(ctx context.Context, id uint64) (*DeadLetter, error) {
+	return q.dead.Get(ctx, id)
+}
+
+// Requeue moves a dead letter back to the queue with a fresh set of
+// attempts, for once the cause of its failures has been fixed.
+//
+// The dead letter is taken out of the store first, so two operators
+// requeueing it at once don't run it twice. If it then can't be queued
+// (the queue is full, or its kind no longer has a handler), it goes back
+// to the store under a new ID.
+func (q *Queue) Requeue(ctx context.Context, id uint64) error {
+	letter, err := q.dead.Take(ctx, id)
+	if err != nil {
+		return err
+	}
+	job := Job{Kind: letter.Kind, Payload: letter.Payload}
+
+	if _, ok := q.handlers[job.Kind]; ok {
+		err = q.push(job)
+	} else {
+		err = fmt.Errorf("%w %q", ErrUnknownKind, job.Kind)
+	}
+	if err == nil {
+		return nil
+	}
+	if addErr := q.dead.Add(ctx, letter.Job); addErr != nil {
+		log.Printf("jobs: requeueing dead letter %d failed and it couldn't be put back, the job is lost: %v", id, addErr)
+	}
+	return err
+}
+
+// Discard deletes a dead letter and returns it.
+func (q *Queue) Discard(ctx context.Context, id uint64) (*DeadLetter, error) {
+	return q.dead.Take(ctx, id)
+}
@@ -0,0 +1,498 @@
+// Package jobs runs background work (sending email, for now) on a pool
+// of workers, off the request path.
+//
+// WHY A QUEUE?
+// A request that sends an email waits for the SMTP server. A slow or
+// unreachable mail server then becomes a slow or failing endpoint. With
+// a queue, the request only records what to send and returns; workers
+// send it in the background.
+//
+// WHAT HAPPENS ON DEPLOY?
+// The queue lives in memory, so a process that just exits loses whatever
+// was waiting. Shutdown prevents that: it stops accepting jobs, gives the
+// running ones until a deadline to finish, and saves everything left -
+// queued jobs and jobs cut off at the deadline - to a Spool. The next
+// process to Start (on any replica) takes them back.
+//
+// Delivery is at least once: a job cut off mid-send (the SMTP server had
+// the message but hadn't answered yet) runs again after the restart.
+// Handlers should tolerate that.
+//
+// WHAT HAPPENS WHEN A JOB FAILS?
+// It's retried, with a growing delay, up to a maximum number of attempts
+// (see WithRetries). A job that fails every time is moved to the
+// dead-letter store with the error from each attempt, so an operator can
+// see what went wrong, fix the cause, and requeue or discard it. It isn't
+// dropped: a lost password-reset email is a user locked out of their
+// account.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-basics/internal/metrics"
+)
+
+// spoolTimeout bounds saving to the spool at shutdown. It runs after the
+// drain deadline has passed, so it can't use the caller's context.
+// Dead-lettering a job uses the same bound.
+const spoolTimeout = 5 * time.Second
+
+// scrapeTimeout bounds counting dead letters for the metrics endpoint.
+const scrapeTimeout = 2 * time.Second
+
+// Sentinel errors for Enqueue.
+var (
+	// ErrClosed is returned once Shutdown has started.
+	ErrClosed = errors.New("job queue is shut down")
+
+	// ErrFull is returned when the queue is at capacity.
+	ErrFull = errors.New("job queue is full")
+
+	// ErrUnknownKind is returned for a kind with no registered handler.
+	ErrUnknownKind = errors.New("unknown job kind")
+)
+
+// maxRetryDelay caps the exponential backoff between attempts.
+const maxRetryDelay = time.Hour
+
+// Job is one unit of work: a kind, which picks the handler, and the
+// handler's JSON-encoded input.
+type Job struct {
+	Kind    string
+	Payload []byte
+
+	// Attempts counts the runs that failed, and Errors holds their errors,
+	// oldest first. A run cut off at shutdown doesn't count: a deploy
+	// shouldn't use up a job's retries.
+	Attempts int
+	Errors   []string
+}
+
+// HandlerFunc does the work of one job. It must stop when ctx is
+// cancelled: that means the drain deadline has passed, and the job will
+// be saved and run again after the restart.
+type HandlerFunc func(ctx context.Context, payload []byte) error
+
+// Spool stores jobs across restarts.
+type Spool interface {
+	// Save stores jobs for a later Take.
+	Save(ctx context.Context, jobs []Job) error
+
+	// Take removes and returns every stored job. Concurrent calls (two
+	// replicas starting together) must not return the same job twice.
+	Take(ctx context.Context) ([]Job, error)
+}
+
+// ShutdownReport says what happened to the work in the queue at shutdown.
+type ShutdownReport struct {
+	Drained   int // Jobs that were running and finished before the deadline
+	Abandoned int // Jobs still running at the deadline (saved to run again)
+	Saved     int // Jobs saved to the spool, including the abandoned ones
+}
+
+// Option configures a Queue.
+type Option func(*Queue)
+
+// WithRetries runs a failing job up to maxAttempts times in all before
+// it's dead-lettered, waiting backoff after the first failure and twice
+// as long after each one that follows (up to an hour). Without it, a job
+// is dead-lettered after its first failure.
+func WithRetries(maxAttempts int, backoff time.Duration) Option {
+	return func(q *Queue) {
+		q.maxAttempts = max(maxAttempts, 1)
+		q.backoff = backoff
+	}
+}
+
+// Queue is an in-memory job queue with a fixed pool of workers.
+type Queue struct {
+	handlers map[string]HandlerFunc
+	jobs     chan Job
+	workers  int
+	spool    Spool
+
+	dead        DeadLetterStore
+	maxAttempts int
+	backoff     time.Duration
+
+	mu       sync.RWMutex // Guards closed, retrying, and leftover
+	closed   bool
+	retrying map[*Job]*time.Timer // Failed jobs waiting for their next attempt
+	stop     chan struct{}        // Closed by Shutdown: workers stop taking jobs
+	ctx      context.Context
+	cancel   context.CancelFunc // Cancels running jobs at the drain deadline
+	wg       sync.WaitGroup     // Workers
+	feeder   sync.WaitGroup     // requeue
+	inflight sync.Map           // Running jobs, by *Job
+	leftover []Job              // Spooled jobs not yet queued when Shutdown started
+	drained  atomic.Int64
+
+	processed   *metrics.CounterVec
+	depth       *metrics.GaugeVec
+	waiting     *metrics.GaugeVec
+	deadLetters *metrics.GaugeVec
+}
+
+// NewQueue creates a queue holding up to capacity waiting jobs, run by
+// workers goroutines once Start is called. Jobs that fail for good go
+// to dead. It registers jobs_processed_total, jobs_queued,
+// jobs_retry_waiting, and jobs_dead_letters on reg.
+func NewQueue(workers, capacity int, spool Spool, dead DeadLetterStore, reg *metrics.Registry, opts ...Option) *Queue {
+	ctx, cancel := context.WithCancel(context.Background())
+	q := &Queue{
+		handlers:    make(map[string]HandlerFunc),
+		jobs:        make(chan Job, capacity),
+		workers:     workers,
+		spool:       spool,
+		dead:        dead,
+		maxAttempts: 1,
+		retrying:    make(map[*Job]*time.Timer),
+		stop:        make(chan struct{}),
+		ctx:         ctx,
+		cancel:      cancel,
+		processed: reg.NewCounterVec("jobs_processed_total",
+			"Background job runs, by kind and result (success, retry, dead_letter).", "kind", "result"),
+		depth: reg.NewGaugeVec("jobs_queued",
+			"Background jobs waiting for a worker."),
+		waiting: reg.NewGaugeVec("jobs_retry_waiting",
+			"Failed background jobs waiting for their next attempt."),
+		deadLetters: reg.NewGaugeVec("jobs_dead_letters",
+			"Background jobs in the dead-letter store. Every instance reports the same shared store."),
+	}
+	for _, opt := range opts {
+		opt(q)
+	}
+	reg.OnScrape(q.scrape)
+	return q
+}
+
+// scrape updates the gauges.
+func (q *Queue) scrape() {
+	q.depth.Set(float64(len(q.jobs)))
+
+	q.mu.RLock()
+	q.waiting.Set(float64(len(q.retrying)))
+	q.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), scrapeTimeout)
+	defer cancel()
+	n, err := q.dead.Count(ctx)
+	if err != nil {
+		// Keep the last value; a gap would read as an empty store.
+		log.Printf("jobs: counting dead letters: %v", err)
+		return
+	}
+	q.deadLetters.Set(float64(n))
+}
+
+// Handle registers the handler for jobs of kind. Register every kind
+// before Start; a duplicate is a programming error and panics.
+func (q *Queue) Handle(kind string, fn HandlerFunc) {
+	if _, dup := q.handlers[kind]; dup {
+		panic("jobs: duplicate handler for " + kind)
+	}
+	q.handlers[kind] = fn
+}
+
+// Stats is a snapshot of the queue on this instance. DeadLetters counts
+// the shared store, so it's the same on every instance.
+type Stats struct {
+	Kinds        []string // Registered job kinds, sorted
+	Workers      int
+	Capacity     int
+	Queued       int // Waiting for a worker
+	Running      int
+	RetryWaiting int // Failed, waiting for their next attempt
+	DeadLetters  int
+}
+
+// Stats reports what the queue is doing.
+func (q *Queue) Stats(ctx context.Context) (Stats, error) {
+	stats := Stats{
+		Kinds:    slices.Sorted(maps.Keys(q.handlers)),
+		Workers:  q.workers,
+		Capacity: cap(q.jobs),
+		Queued:   len(q.jobs),
+	}
+	q.inflight.Range(func(_, _ interface{}) bool {
+		stats.Running++
+		return true
+	})
+	q.mu.RLock()
+	stats.RetryWaiting = len(q.retrying)
+	q.mu.RUnlock()
+
+	n, err := q.dead.Count(ctx)
+	if err != nil {
+		return stats, err
+	}
+	stats.DeadLetters = n
+	return stats, nil
+}
+
+// Enqueue adds a job of kind with payload encoded as JSON.
+// It never blocks: a full queue returns ErrFull.
+func (q *Queue) Enqueue(kind string, payload interface{}) error {
+	if _, ok := q.handlers[kind]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encoding %s job: %w", kind, err)
+	}
+	return q.push(Job{Kind: kind, Payload: data})
+}
+
+// push adds job to the queue without blocking.
+func (q *Queue) push(job Job) error {
+	// The read lock keeps Shutdown from draining the channel while a job
+	// is being added to it.
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+	select {
+	case q.jobs <- job:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+// Start takes the jobs a previous process saved and starts the workers.
+// Saved jobs are queued in the background, behind any new ones.
+func (q *Queue) Start(ctx context.Context) error {
+	saved, err := q.spool.Take(ctx)
+	if err != nil {
+		return fmt.Errorf("taking spooled jobs: %w", err)
+	}
+	if len(saved) > 0 {
+		log.Printf("jobs: resuming %d job(s) saved at the last shutdown", len(saved))
+	}
+
+	for range q.workers {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.feeder.Add(1)
+	go q.requeue(saved)
+	return nil
+}
+
+// requeue feeds saved jobs to the workers, keeping the ones it didn't
+// get to when Shutdown starts.
+func (q *Queue) requeue(saved []Job) {
+	defer q.feeder.Done()
+	for i, job := range saved {
+		select {
+		case q.jobs <- job:
+		case <-q.stop:
+			q.mu.Lock()
+			q.leftover = append(q.leftover, saved[i:]...)
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+// work runs jobs until Shutdown.
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		// Check stop first: select picks at random among ready cases, and
+		// a worker must not start a new job once shutdown has begun.
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+		select {
+		case <-q.stop:
+			return
+		case job := <-q.jobs:
+			q.run(&job)
+		}
+	}
+}
+
+// run runs one job and records the result.
+func (q *Queue) run(job *Job) {
+	q.inflight.Store(job, struct{}{})
+	err := q.call(job)
+
+	// Shutdown cancels q.ctx and collects the running jobs under the lock,
+	// so a job is either still running then (and saved as abandoned) or
+	// done with and, if it's to be retried, in q.retrying - never both.
+	q.mu.Lock()
+	if q.ctx.Err() != nil {
+		// Cut off at the deadline; Shutdown saved it and reports it.
+		q.mu.Unlock()
+		return
+	}
+	q.inflight.Delete(job)
+	if q.closed {
+		q.drained.Add(1)
+	}
+	if err != nil {
+		job.Attempts++
+		job.Errors = append(job.Errors, fmt.Sprintf("attempt %d at %s: %v",
+			job.Attempts, time.Now().UTC().Format(time.RFC3339), err))
+	}
+	retry := err != nil && job.Attempts < q.maxAttempts
+	if retry {
+		q.retryLater(*job)
+	}
+	q.mu.Unlock()
+
+	switch {
+	case err == nil:
+		q.processed.Inc(job.Kind, "success")
+	case retry:
+		q.processed.Inc(job.Kind, "retry")
+		log.Printf("jobs: %s failed (attempt %d of %d), will retry: %v", job.Kind, job.Attempts, q.maxAttempts, err)
+	default:
+		q.processed.Inc(job.Kind, "dead_letter")
+		log.Printf("jobs: %s failed (attempt %d of %d), dead-lettering it: %v", job.Kind, job.Attempts, q.maxAttempts, err)
+		q.deadLetter(*job)
+	}
+}
+
+// call runs job's handler.
+func (q *Queue) call(job *Job) error {
+	handler, ok := q.handlers[job.Kind]
+	if !ok {
+		// Saved or scheduled by a release that had the handler. It ends
+		// up dead-lettered, where it can be requeued once it's back.
+		return fmt.Errorf("%w %q", ErrUnknownKind, job.Kind)
+	}
+	return handler(q.ctx, job.Payload)
+}
+
+// retryLater queues job again after its backoff. q.mu must be held.
+// Once Shutdown has started, the job is saved with the rest instead.
+func (q *Queue) retryLater(job Job) {
+	if q.closed {
+		q.leftover = append(q.leftover, job)
+		return
+	}
+	delay := q.backoff
+	for i := 1; i < job.Attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	q.schedule(&job, min(delay, maxRetryDelay))
+}
+
+// schedule queues job after delay. q.mu must be held.
+func (q *Queue) schedule(job *Job, delay time.Duration) {
+	q.retrying[job] = time.AfterFunc(delay, func() {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		if _, ok := q.retrying[job]; !ok || q.closed {
+			return // Shutdown saves it
+		}
+		delete(q.retrying, job)
+		select {
+		case q.jobs <- *job:
+		default:
+			// Full: try again after another backoff rather than count a
+			// busy queue against the job.
+			q.schedule(job, q.backoff)
+		}
+	})
+}
+
+// deadLetter moves job, which has failed for good, to the dead-letter
+// store. It runs on a fresh context: a job failing during the drain
+// must still be kept.
+func (q *Queue) deadLetter(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), spoolTimeout)
+	defer cancel()
+	if err := q.dead.Add(ctx, job); err != nil {
+		log.Printf("jobs: dead-lettering %s failed, the job is lost: %v (errors: %q)", job.Kind, err, job.Errors)
+	}
+}
+
+// Shutdown stops the queue: Enqueue starts returning ErrClosed, workers
+// finish the job they're running but take no new ones, and whatever is
+// left is saved to the spool. Running jobs get until ctx is done; then
+// they're cancelled and saved too.
+func (q *Queue) Shutdown(ctx context.Context) (ShutdownReport, error) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return ShutdownReport{}, ErrClosed
+	}
+	q.closed = true
+	close(q.stop)
+	q.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	var abandoned []Job
+	select {
+	case <-done:
+	case <-ctx.Done():
+		q.mu.Lock()
+		q.cancel()
+		q.inflight.Range(func(key, _ interface{}) bool {
+			abandoned = append(abandoned, *key.(*Job))
+			return true
+		})
+		q.mu.Unlock()
+	}
+
+	// No Enqueue can add to the channel any more, and requeue stops
+	// promptly, so this empties it.
+	q.feeder.Wait()
+	var left []Job
+	for empty := false; !empty; {
+		select {
+		case job := <-q.jobs:
+			left = append(left, job)
+		default:
+			empty = true
+		}
+	}
+	q.mu.Lock()
+	left = append(left, q.leftover...)
+	for job, timer := range q.retrying {
+		// Saved with its attempts so far; the next process retries it
+		// straight away rather than after the rest of its backoff.
+		timer.Stop()
+		left = append(left, *job)
+	}
+	clear(q.retrying)
+	q.mu.Unlock()
+	left = append(left, abandoned...)
+
+	report := ShutdownReport{
+		Drained:   int(q.drained.Load()),
+		Abandoned: len(abandoned),
+	}
+	if len(left) == 0 {
+		return report, nil
+	}
+
+	saveCtx, cancel := context.WithTimeout(context.Background(), spoolTimeout)
+	defer cancel()
+	if err := q.spool.Save(saveCtx, left); err != nil {
+		return report, fmt.Errorf("saving %d unfinished job(s): %w", len(left), err)
+	}
+	report.Saved = len(left)
+	return report, nil
+}
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+
+	"go-basics/internal/metrics"
+)
+
+// TestMain fails the package's tests if any goroutine outlives them:
+// a worker, the spool feeder, or Shutdown's wait for the workers.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m)
+}
+
+// memorySpool is a Spool in memory.
+type memorySpool struct {
+	mu   sync.Mutex
+	jobs []Job
+}
+
+func (s *memorySpool) Save(_ context.Context, jobs []Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, jobs...)
+	return nil
+}
+
+func (s *memorySpool) Take(context.Context) ([]Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := s.jobs
+	s.jobs = nil
+	return jobs, nil
+}
+
+// noDeadLetters is a DeadLetterStore for tests where no job fails.
+type noDeadLetters struct{ DeadLetterStore }
+
+func (noDeadLetters) Count(context.Context) (int, error) { return 0, nil }
+
+// TestShutdownAbandonsRunningJob shuts down a queue while a job is
+// still running past the deadline: the job is cancelled and saved with
+// the one queued behind it, and a new queue on the same spool runs both.
+func TestShutdownAbandonsRunningJob(t *testing.T) {
+	spool := &memorySpool{}
+
+	started := make(chan struct{}, 1)
+	q := NewQueue(1, 10, spool, noDeadLetters{}, metrics.NewRegistry())
+	q.Handle("slow", func(ctx context.Context, _ []byte) error {
+		started <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if err := q.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := q.Enqueue("slow", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	report, err := q.Shutdown(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Abandoned != 1 || report.Saved != 2 {
+		t.Fatalf("report = %+v, want 1 abandoned and 2 saved", report)
+	}
+	if err := q.Enqueue("slow", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("Enqueue after Shutdown = %v, want ErrClosed", err)
+	}
+
+	var mu sync.Mutex
+	ran := 0
+	resumed := NewQueue(2, 10, spool, noDeadLetters{}, metrics.NewRegistry())
+	resumed.Handle("slow", func(context.Context, []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		ran++
+		return nil
+	})
+	if err := resumed.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		mu.Lock()
+		n := ran
+		mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resumed queue ran %d of the 2 saved jobs", n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if report, err := resumed.Shutdown(context.Background()); err != nil || report.Saved != 0 {
+		t.Errorf("second Shutdown = %+v, %v; want nothing saved", report, err)
+	}
+}
@@ -0,0 +1,186 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-basics/internal/metrics"
+)
+
+// claimBatch is how many due schedules one poll hands to the queue at most.
+const claimBatch = 100
+
+// Sentinel errors for schedules.
+var (
+	// ErrDuplicateSchedule is returned when a pending schedule already
+	// has the unique key.
+	ErrDuplicateSchedule = errors.New("a job with this unique key is already scheduled")
+
+	// ErrScheduleNotFound is returned when no schedule has the unique key.
+	ErrScheduleNotFound = errors.New("scheduled job not found")
+
+	// ErrInvalidInterval is returned for a recurring interval under a second.
+	ErrInvalidInterval = errors.New("recurring interval must be at least a second")
+)
+
+// Schedule is a job to queue at RunAt, and again every Every after
+// that if Every is set.
+type Schedule struct {
+	ID        uint64
+	Kind      string
+	Payload   []byte
+	UniqueKey string // Empty for none
+	RunAt     time.Time
+	Every     time.Duration // Zero for a one-off
+}
+
+// ScheduleStore keeps schedules in a store every instance shares.
+type ScheduleStore interface {
+	// Add stores a schedule and returns its ID. It returns
+	// ErrDuplicateSchedule if s.UniqueKey is set and already taken.
+	Add(ctx context.Context, s Schedule) (uint64, error)
+
+	// Cancel deletes the schedule with the unique key, or returns
+	// ErrScheduleNotFound.
+	Cancel(ctx context.Context, uniqueKey string) error
+
+	// List returns up to limit schedules, soonest first.
+	List(ctx context.Context, limit int) ([]Schedule, error)
+
+	// Claim calls dispatch for up to limit schedules due at now, soonest
+	// first, and then deletes each dispatched one-off and moves each
+	// dispatched recurring schedule to its next run. It stops at the
+	// first dispatch error, leaving the rest for the next Claim, and
+	// returns how many it dispatched. Concurrent Claims must not
+	// dispatch the same schedule.
+	Claim(ctx context.Context, now time.Time, limit int, dispatch func(Schedule) error) (int, error)
+}
+
+// ScheduleOption configures a schedule.
+type ScheduleOption func(*Schedule)
+
+// Unique gives the schedule a key that no other pending schedule may
+// have. Keys name what the job is about, e.g. "reverify-reminder:user:42",
+// so a user gets one reminder schedule however often the code asks for
+// one, and the schedule can be cancelled by key when it's no longer needed.
+func Unique(key string) ScheduleOption {
+	return func(s *Schedule) { s.UniqueKey = key }
+}
+
+// Every makes the schedule recurring: after the first run at runAt, it
+// runs every interval, for good or until cancelled.
+func Every(interval time.Duration) ScheduleOption {
+	return func(s *Schedule) { s.Every = interval }
+}
+
+// Scheduler queues jobs at a later time.
+//
+// WHY NOT time.AfterFunc?
+// A timer lives in memory: a deploy between scheduling a reminder for
+// next week and next week would lose it. Schedules are rows in a shared
+// table instead, and the scheduler polls for the due ones and hands them
+// to the queue. Run it on one instance (a leader.Task): a second poller
+// would only contend for the same rows.
+type Scheduler struct {
+	queue *Queue
+	store ScheduleStore
+	poll  time.Duration
+
+	dispatched *metrics.CounterVec
+}
+
+// NewScheduler creates a scheduler that checks store for due jobs every
+// poll and queues them on queue. It registers
+// jobs_scheduled_dispatched_total on reg.
+//
+// A job runs up to poll late, so choose a poll well under the shortest
+// delay that matters.
+func NewScheduler(queue *Queue, store ScheduleStore, poll time.Duration, reg *metrics.Registry) *Scheduler {
+	return &Scheduler{
+		queue: queue,
+		store: store,
+		poll:  poll,
+		dispatched: reg.NewCounterVec("jobs_scheduled_dispatched_total",
+			"Scheduled background jobs handed to the queue, by kind.", "kind"),
+	}
+}
+
+// At schedules a job of kind with payload encoded as JSON to run at
+// runAt (or at the next poll, if that's in the past), and returns the
+// schedule's ID.
+func (s *Scheduler) At(ctx context.Context, kind string, payload interface{}, runAt time.Time, opts ...ScheduleOption) (uint64, error) {
+	if _, ok := s.queue.handlers[kind]; !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnknownKind, kind)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("encoding %s job: %w", kind, err)
+	}
+	sched := Schedule{Kind: kind, Payload: data, RunAt: runAt.UTC()}
+	for _, opt := range opts {
+		opt(&sched)
+	}
+	if sched.Every != 0 && sched.Every < time.Second {
+		return 0, ErrInvalidInterval
+	}
+	return s.store.Add(ctx, sched)
+}
+
+// After schedules a job to run after delay; see At.
+func (s *Scheduler) After(ctx context.Context, kind string, payload interface{}, delay time.Duration, opts ...ScheduleOption) (uint64, error) {
+	return s.At(ctx, kind, payload, time.Now().Add(delay), opts...)
+}
+
+// Cancel deletes the schedule with the unique key.
+// A job it already queued still runs.
+func (s *Scheduler) Cancel(ctx context.Context, uniqueKey string) error {
+	return s.store.Cancel(ctx, uniqueKey)
+}
+
+// List returns up to limit pending schedules, soonest first.
+func (s *Scheduler) List(ctx context.Context, limit int) ([]Schedule, error) {
+	return s.store.List(ctx, limit)
+}
+
+// Run queues due jobs every poll until ctx is done.
+// Its signature makes it a leader.Task.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.poll)
+	defer ticker.Stop()
+	for {
+		s.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatch queues the due jobs, a batch at a time, until none are left
+// or the queue refuses one.
+func (s *Scheduler) dispatch(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := s.store.Claim(ctx, time.Now().UTC(), claimBatch, func(sched Schedule) error {
+			if err := s.queue.push(Job{Kind: sched.Kind, Payload: sched.Payload}); err != nil {
+				return err
+			}
+			s.dispatched.Inc(sched.Kind)
+			return nil
+		})
+		switch {
+		case errors.Is(err, ErrFull), errors.Is(err, ErrClosed):
+			// Left in the store; the next poll tries again.
+			return
+		case err != nil:
+			log.Printf("jobs: dispatching scheduled jobs: %v", err)
+			return
+		case n < claimBatch:
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Package leader elects one instance of a multi-replica deployment to
+// run the background subsystems that must not run twice (a scheduler, an
+// outbox relay, a retention engine).
+//
+// HOW IT WORKS:
+// Leadership is a long-lived distributed lock (see package lock). Every
+// instance runs an Elector; the one that takes the lock starts the
+// subsystems and keeps renewing its lease. The others retry every few
+// seconds. If the leader dies, its lease expires (Redis) or its database
+// session ends (MySQL), and the next retry elsewhere wins: failover takes
+// at most the lease TTL plus one retry interval.
+//
+// WHY NOT ONE LOCK PER JOB?
+// lock.Manager.Run is right for a job that starts, works, and stops. A
+// relay or a scheduler runs for the life of the process; it wants to know
+// "am I the one?" once, and to be stopped when the answer changes.
+// Grouping them under one leader also keeps them together, so a
+// scheduler and the relay it feeds aren't split across instances.
+//
+// lock_held{name="leader"} is 1 on the current leader.
+package leader
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-basics/internal/lock"
+)
+
+// LockName is the lock the leader holds.
+const LockName = "leader"
+
+// Task is a background subsystem that runs only on the leader. It must
+// return promptly once ctx is cancelled: that means leadership was lost
+// (or the process is shutting down) and another instance may already be
+// starting its own copy.
+type Task func(ctx context.Context)
+
+// Elector runs tasks while this instance is the leader.
+type Elector struct {
+	locks   *lock.Manager
+	retry   time.Duration // How often a follower tries to take over
+	leading atomic.Bool
+}
+
+// New creates an elector taking leadership through locks. Followers
+// retry every retry interval.
+func New(locks *lock.Manager, retry time.Duration) *Elector {
+	return &Elector{locks: locks, retry: retry}
+}
+
+// IsLeader reports whether this instance is the leader right now.
+func (e *Elector) IsLeader() bool {
+	return e.leading.Load()
+}
+
+// Run competes for leadership until ctx is cancelled, running tasks
+// whenever this instance wins. Call it in its own goroutine.
+func (e *Elector) Run(ctx context.Context, tasks ...Task) {
+	for {
+		err := e.locks.Run(ctx, LockName, func(ctx context.Context) error {
+			e.lead(ctx, tasks)
+			return nil
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil && !errors.Is(err, lock.ErrNotAcquired) {
+			log.Printf("leader: election failed, will retry: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.retry):
+		}
+	}
+}
+
+// lead runs tasks until ctx is cancelled, then waits for them to stop.
+// It doesn't return early even if every task has: giving the lock up
+// would only make the instances take turns.
+func (e *Elector) lead(ctx context.Context, tasks []Task) {
+	e.leading.Store(true)
+	log.Printf("leader: this instance is the leader; starting %d background task(s)", len(tasks))
+
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			task(ctx)
+		}()
+	}
+	<-ctx.Done()
+	wg.Wait()
+
+	e.leading.Store(false)
+	log.Printf("leader: no longer the leader; background tasks stopped")
+}
@@ -0,0 +1,56 @@
+// Package lock provides distributed locks, so that a job which must run
+// on one replica at a time (a purge, a backup, an outbox relay) does.
+//
+// WHY NOT sync.Mutex?
+// A mutex only excludes goroutines in the same process. With three
+// replicas behind a load balancer, a nightly purge scheduled in every
+// replica would run three times, at the same time, on the same rows. The
+// lock has to live somewhere every replica can see: Redis or MySQL.
+//
+// LEASES, NOT LOCKS:
+// A replica can die while holding a lock. If the lock lasted until it was
+// released, nobody would ever run the job again. So every lock is a lease:
+// it expires on its own unless the holder keeps renewing it. Manager.Run
+// renews it in the background while the job runs and, if a renewal fails,
+// cancels the job's context - another replica may already have taken
+// over, and two copies of a job must not keep running side by side.
+//
+// Two backends implement Locker:
+//
+//	RedisLocker  SET NX PX with a random token; the lease is the key's TTL
+//	MySQLLocker  GET_LOCK on a dedicated connection; the lease is the session
+package lock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Sentinel errors for lock operations.
+var (
+	// ErrNotAcquired is returned when another holder has the lock.
+	// For a singleton job this is the normal case on every replica but one.
+	ErrNotAcquired = errors.New("lock held by another holder")
+
+	// ErrLost is returned by Lease.Renew when the lease has expired or
+	// been taken over; the holder must stop what it's doing.
+	ErrLost = errors.New("lock lost")
+)
+
+// Locker takes named locks.
+type Locker interface {
+	// TryAcquire takes the lock called name for ttl, without waiting.
+	// It returns ErrNotAcquired if someone else holds it.
+	TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lease, error)
+}
+
+// Lease is a held lock.
+type Lease interface {
+	// Renew extends the lease to its full TTL from now.
+	// It returns ErrLost if the lock is no longer held.
+	Renew(ctx context.Context) error
+
+	// Release gives the lock up. Releasing a lost lease is not an error.
+	Release(ctx context.Context) error
+}
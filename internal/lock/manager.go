@@ -0,0 +1,128 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go-basics/internal/metrics"
+)
+
+// releaseTimeout bounds Release, which runs on a fresh context: the lock
+// must be given up even when the job's context was cancelled.
+const releaseTimeout = 5 * time.Second
+
+// Manager runs jobs under a lock, renewing the lease while they run.
+type Manager struct {
+	locker Locker
+	ttl    time.Duration
+
+	acquisitions *metrics.CounterVec // By name and result
+	lost         *metrics.CounterVec // Leases lost while a job ran
+	held         *metrics.GaugeVec   // 1 while this instance holds the lock
+}
+
+// NewManager creates a manager taking locks from locker with leases of
+// ttl. It registers lock_acquisitions_total, lock_lost_total, and
+// lock_held on reg.
+//
+// Choose a ttl well above a renewal's round trip: leases are renewed
+// every ttl/3, and a lock whose holder died stays taken for up to ttl.
+func NewManager(locker Locker, ttl time.Duration, reg *metrics.Registry) *Manager {
+	return &Manager{
+		locker: locker,
+		ttl:    ttl,
+		acquisitions: reg.NewCounterVec("lock_acquisitions_total",
+			"Attempts to take a job lock, by lock and result (acquired, contended, error).", "name", "result"),
+		lost: reg.NewCounterVec("lock_lost_total",
+			"Job locks lost while the job was running.", "name"),
+		held: reg.NewGaugeVec("lock_held",
+			"Whether this instance holds the job lock (1) or not (0).", "name"),
+	}
+}
+
+// Run runs job if it can take the lock called name, and returns job's
+// error. If another instance holds the lock, job doesn't run and Run
+// returns ErrNotAcquired; a scheduler should treat that as "someone
+// else has it" and try again at the next tick.
+//
+// job's context is cancelled if the lease is lost, so a long job must
+// check ctx between steps and stop when it's done.
+func (m *Manager) Run(ctx context.Context, name string, job func(ctx context.Context) error) error {
+	lease, err := m.locker.TryAcquire(ctx, name, m.ttl)
+	switch {
+	case errors.Is(err, ErrNotAcquired):
+		m.acquisitions.Inc(name, "contended")
+		return err
+	case err != nil:
+		m.acquisitions.Inc(name, "error")
+		return err
+	}
+	m.acquisitions.Inc(name, "acquired")
+	m.held.Set(1, name)
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		m.renew(jobCtx, cancel, name, lease)
+	}()
+
+	err = job(jobCtx)
+
+	cancel()
+	<-renewed
+	m.held.Set(0, name)
+
+	releaseCtx, cancelRelease := context.WithTimeout(context.Background(), releaseTimeout)
+	defer cancelRelease()
+	if relErr := lease.Release(releaseCtx); relErr != nil {
+		// Not the job's failure: the lease expires (Redis) or the
+		// session is closed (MySQL) on its own.
+		log.Printf("lock: releasing %q: %v", name, relErr)
+	}
+	return err
+}
+
+// renew extends lease every ttl/3 until ctx is done. It calls cancel
+// once the lease can't be trusted any more: when the backend says it's
+// lost, or when renewals have failed for so long that it may have expired.
+func (m *Manager) renew(ctx context.Context, cancel context.CancelFunc, name string, lease Lease) {
+	interval := max(m.ttl/3, time.Millisecond)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	expires := time.Now().Add(m.ttl)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		renewCtx, cancelRenew := context.WithTimeout(ctx, interval)
+		err := lease.Renew(renewCtx)
+		cancelRenew()
+		if ctx.Err() != nil {
+			return // The job finished while we were renewing
+		}
+
+		switch {
+		case err == nil:
+			expires = time.Now().Add(m.ttl)
+			continue
+		case errors.Is(err, ErrLost):
+			log.Printf("lock: lost %q, cancelling the job", name)
+		case time.Until(expires) > interval:
+			// A transient error: the lease is still good until the next try.
+			log.Printf("lock: renewing %q failed, will retry: %v", name, err)
+			continue
+		default:
+			log.Printf("lock: renewing %q failed, cancelling the job before the lease expires: %v", name, err)
+		}
+		m.lost.Inc(name)
+		cancel()
+		return
+	}
+}
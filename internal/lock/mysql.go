@@ -0,0 +1,85 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// MySQLLocker takes locks with MySQL's GET_LOCK, like the migration lock
+// (see mysql.Migrate), so a deployment without Redis still gets them.
+//
+// A GET_LOCK lock belongs to a database session, not a key with a TTL:
+// it is held until released or until the session ends. So each lease
+// keeps one connection out of the pool for as long as it's held. If the
+// replica dies, MySQL notices the dropped connection and frees the lock;
+// the ttl argument plays no part. Renew checks that the session still
+// holds the lock, which also catches a connection that was killed.
+//
+// Lock names are server-wide and at most 64 characters.
+type MySQLLocker struct {
+	db *sql.DB
+}
+
+// NewMySQLLocker creates a locker on db.
+func NewMySQLLocker(db *sql.DB) *MySQLLocker {
+	return &MySQLLocker{db: db}
+}
+
+// TryAcquire implements Locker.
+func (l *MySQLLocker) TryAcquire(ctx context.Context, name string, _ time.Duration) (Lease, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquiring lock %q: %w", name, err)
+	}
+
+	// GET_LOCK returns 1 when acquired, 0 if another session holds it,
+	// NULL on error. A timeout of 0 means don't wait.
+	var got sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&got); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("acquiring lock %q: %w", name, err)
+	}
+	switch {
+	case !got.Valid:
+		conn.Close()
+		return nil, fmt.Errorf("acquiring lock %q: GET_LOCK returned NULL", name)
+	case got.Int64 != 1:
+		conn.Close()
+		return nil, ErrNotAcquired
+	}
+	return &mysqlLease{conn: conn, name: name}, nil
+}
+
+// mysqlLease is a lock held by a MySQL session.
+type mysqlLease struct {
+	conn *sql.Conn
+	name string
+}
+
+func (l *mysqlLease) Renew(ctx context.Context) error {
+	var held sql.NullBool
+	err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", l.name).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("renewing lock %q: %w", l.name, err)
+	}
+	if !held.Valid || !held.Bool {
+		return ErrLost
+	}
+	return nil
+}
+
+func (l *mysqlLease) Release(ctx context.Context) error {
+	_, err := l.conn.ExecContext(ctx, "DO RELEASE_LOCK(?)", l.name)
+	if err != nil {
+		// The session may still hold the lock. Returning the connection to
+		// the pool would keep it held by whoever borrows it next, so have
+		// the pool discard it instead: closing the session frees the lock.
+		// (Raw closes the Conn when its func returns ErrBadConn.)
+		l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		return fmt.Errorf("releasing lock %q: %w", l.name, err)
+	}
+	return l.conn.Close()
+}
@@ -0,0 +1,101 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// renewScript extends the key's TTL only if it still holds our token.
+//
+// WHY COMPARE THE TOKEN?
+// If this holder stalled (a long GC pause, a frozen VM) past its TTL, the
+// key expired and another replica may have taken the lock. A plain
+// PEXPIRE or DEL would then extend or delete *their* lock. Checking and
+// acting in one script makes the two steps atomic.
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// releaseScript deletes the key only if it still holds our token.
+var releaseScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisLocker keeps locks as Redis keys that expire after their TTL.
+//
+// Each lock is a single key, so it works on a Redis Cluster too. It is
+// not Redlock: if the Redis primary fails over before replicating a
+// SET, two holders can briefly coexist. For jobs that are idempotent
+// (purges, relays that deduplicate) that is an acceptable trade.
+type RedisLocker struct {
+	client redis.UniversalClient
+	prefix string // Namespaces keys, e.g. "lock:"
+}
+
+// NewRedisLocker creates a locker on an existing Redis client.
+func NewRedisLocker(client redis.UniversalClient, prefix string) *RedisLocker {
+	return &RedisLocker{client: client, prefix: prefix}
+}
+
+// TryAcquire implements Locker.
+func (l *RedisLocker) TryAcquire(ctx context.Context, name string, ttl time.Duration) (Lease, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	key := l.prefix + name
+	ok, err := l.client.SetNX(ctx, key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("acquiring lock %q: %w", name, err)
+	}
+	if !ok {
+		return nil, ErrNotAcquired
+	}
+	return &redisLease{client: l.client, key: key, token: token, ttl: ttl}, nil
+}
+
+// newToken returns a random value identifying one holder of a lock.
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// redisLease is a lock held in Redis.
+type redisLease struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+}
+
+func (l *redisLease) Renew(ctx context.Context) error {
+	n, err := renewScript.Run(ctx, l.client, []string{l.key}, l.token, l.ttl.Milliseconds()).Int64()
+	if err != nil {
+		return fmt.Errorf("renewing lock %q: %w", l.key, err)
+	}
+	if n == 0 {
+		return ErrLost
+	}
+	return nil
+}
+
+func (l *redisLease) Release(ctx context.Context) error {
+	if err := releaseScript.Run(ctx, l.client, []string{l.key}, l.token).Err(); err != nil {
+		return fmt.Errorf("releasing lock %q: %w", l.key, err)
+	}
+	return nil
+}
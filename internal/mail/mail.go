@@ -0,0 +1,88 @@
+// Package mail sends email.
+//
+// WHY AN INTERFACE?
+// The code that decides WHAT to send (e.g. the password reset flow) shouldn't
+// care HOW it's sent. Production can use SMTP, development can just log the
+// message, and a hosted provider (SES, SendGrid, ...) can be added later as
+// another Mailer implementation without touching any caller.
+package mail
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email messages.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// LogMailer "sends" messages by writing them to the log.
+// Use it in development so flows like password reset work without an
+// SMTP server - copy the link from the log.
+//
+// NEVER use it in production: messages often contain secrets (reset links).
+type LogMailer struct{}
+
+// NewLogMailer creates a mailer that logs messages instead of sending them.
+func NewLogMailer() Mailer {
+	return LogMailer{}
+}
+
+// Send logs the message.
+func (LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("mail: to=%s subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// SMTPMailer sends messages through an SMTP server.
+type SMTPMailer struct {
+	addr string    // host:port of the SMTP server
+	auth smtp.Auth // nil when the server doesn't require authentication
+	from string    // Envelope and header sender address
+}
+
+// NewSMTPMailer creates a mailer for the SMTP server at addr (host:port).
+// Empty username disables authentication.
+//
+// smtp.PlainAuth refuses to send credentials over an unencrypted connection
+// (except to localhost), so the server must support STARTTLS.
+func NewSMTPMailer(addr, username, password, from string) Mailer {
+	m := &SMTPMailer{addr: addr, from: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send delivers the message.
+//
+// net/smtp has no context support, so ctx only guards the start:
+// a request that's already cancelled won't send anything.
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Header values come from our own code, but strip line breaks anyway:
+	// a newline in a header would let the value inject extra headers.
+	header := strings.NewReplacer("\r", "", "\n", "")
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
+		header.Replace(m.from), header.Replace(msg.To), header.Replace(msg.Subject), msg.Body)
+
+	if err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("sending mail: %w", err)
+	}
+	return nil
+}
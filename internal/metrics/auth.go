@@ -0,0 +1,58 @@
+package metrics
+
+//go:generate go run ../../cmd/dashboard -o ../../dashboards/auth.json
+
+// Metric names for authentication.
+// The dashboard generator (cmd/dashboard) builds its queries from these,
+// so a rename here can't silently break the dashboard.
+const (
+	LoginAttemptsName = "auth_login_attempts_total"
+	TokenFailuresName = "auth_token_validation_failures_total"
+	MFAChallengesName = "auth_mfa_challenges_total"
+	SignupsName       = "auth_signups_total"
+)
+
+// Label values for the "result" label.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+
+	// ResultRequired counts 2FA challenges issued: the password was
+	// right and the client was asked for a code.
+	ResultRequired = "required"
+)
+
+// AuthMetrics are the counters for sign-up, login, and token validation.
+//
+// Keep label values to a small fixed set (reasons, causes) - never user
+// input like emails. Every distinct label combination is a separate time
+// series, and unbounded labels can overwhelm Prometheus.
+type AuthMetrics struct {
+	// LoginAttempts counts POST /login calls by result and reason,
+	// e.g. {result="failure", reason="invalid_credentials"}.
+	LoginAttempts *CounterVec
+
+	// TokenFailures counts rejected bearer tokens by cause,
+	// e.g. {cause="expired"}. See auth.FailureCause for the values.
+	TokenFailures *CounterVec
+
+	// MFAChallenges counts second-factor checks by result.
+	MFAChallenges *CounterVec
+
+	// Signups counts POST /register calls by result and reason.
+	Signups *CounterVec
+}
+
+// NewAuthMetrics registers the authentication counters.
+func NewAuthMetrics(reg *Registry) *AuthMetrics {
+	return &AuthMetrics{
+		LoginAttempts: reg.NewCounterVec(LoginAttemptsName,
+			"Login attempts by result and reason.", "result", "reason"),
+		TokenFailures: reg.NewCounterVec(TokenFailuresName,
+			"Bearer tokens rejected by the auth middleware, by cause.", "cause"),
+		MFAChallenges: reg.NewCounterVec(MFAChallengesName,
+			"Two-factor authentication challenges by result.", "result"),
+		Signups: reg.NewCounterVec(SignupsName,
+			"Sign-up attempts by result and reason.", "result", "reason"),
+	}
+}
@@ -0,0 +1,153 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBuckets are histogram bucket bounds (in seconds) suited to
+// HTTP request latency: 5ms up to 10s.
+var DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewHistogramVec registers a histogram with the given bucket upper bounds
+// and label names.
+//
+// WHY HISTOGRAMS FOR LATENCY?
+// A counter can tell you how many requests were slow, but only for one
+// threshold you picked in advance. A histogram counts requests into
+// several buckets ("<= 5ms", "<= 10ms", ...), so Prometheus can estimate
+// any percentile later with histogram_quantile(), aggregated across
+// instances - something averages and pre-computed percentiles can't do.
+//
+// Buckets must be sorted in increasing order; the implicit +Inf bucket is
+// added automatically.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 || !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: histogram %q needs increasing buckets", name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, h := range r.histograms {
+		if h.name == name {
+			panic(fmt.Sprintf("metrics: histogram %q registered twice", name))
+		}
+	}
+
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: append([]float64(nil), buckets...),
+		series:  make(map[string]*histogramSeries),
+	}
+	r.histograms = append(r.histograms, h)
+	return h
+}
+
+// HistogramVec is a histogram split by label values,
+// e.g. request latency by route.
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries // keyed by the joined label values
+}
+
+// histogramSeries is one combination of label values.
+//
+// counts are per bucket (not cumulative) with one extra slot for +Inf;
+// the cumulative counts Prometheus expects are computed when rendering.
+// Each bucket keeps its own exemplar, so a slow bucket links to a slow trace.
+type histogramSeries struct {
+	values    []string
+	counts    []uint64
+	exemplars []*exemplar
+	sum       float64
+	count     uint64
+}
+
+// Observe records one value in the series with the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	h.ObserveWithExemplar("", v, values...)
+}
+
+// ObserveWithExemplar is like Observe and also records traceID as the
+// exemplar of the bucket v falls into. An empty traceID records no exemplar.
+func (h *HistogramVec) ObserveWithExemplar(traceID string, v float64, values ...string) {
+	if len(values) != len(h.labels) {
+		panic(fmt.Sprintf("metrics: %s expects labels %v, got %d values", h.name, h.labels, len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+	// The first bucket whose upper bound is >= v; len(buckets) means +Inf.
+	i := sort.SearchFloat64s(h.buckets, v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			values:    append([]string(nil), values...),
+			counts:    make([]uint64, len(h.buckets)+1),
+			exemplars: make([]*exemplar, len(h.buckets)+1),
+		}
+		h.series[key] = s
+	}
+	s.counts[i]++
+	s.sum += v
+	s.count++
+	if traceID != "" {
+		s.exemplars[i] = &exemplar{traceID: traceID, value: v, at: time.Now()}
+	}
+}
+
+// write renders the histogram and all of its series:
+// cumulative _bucket lines (one per bound plus +Inf), then _sum and _count.
+func (h *HistogramVec) write(w io.Writer, openMetrics bool) {
+	fmt.Fprintf(w, "# HELP %s %s\n", h.name, escapeHelp(h.help))
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.name)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	keys := make([]string, 0, len(h.series))
+	for k := range h.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	bucketLabels := append(append([]string(nil), h.labels...), "le")
+	for _, k := range keys {
+		s := h.series[k]
+
+		var cumulative uint64
+		for i, n := range s.counts {
+			cumulative += n
+			le := "+Inf"
+			if i < len(h.buckets) {
+				le = strconv.FormatFloat(h.buckets[i], 'g', -1, 64)
+			}
+			values := append(append([]string(nil), s.values...), le)
+			fmt.Fprintf(w, "%s_bucket%s %d", h.name, formatLabels(bucketLabels, values), cumulative)
+			if openMetrics && s.exemplars[i] != nil {
+				e := s.exemplars[i]
+				fmt.Fprintf(w, " # {trace_id=\"%s\"} %g %.3f",
+					escapeLabel(e.traceID), e.value, float64(e.at.UnixMilli())/1000)
+			}
+			fmt.Fprint(w, "\n")
+		}
+
+		labels := formatLabels(h.labels, s.values)
+		fmt.Fprintf(w, "%s_sum%s %g\n", h.name, labels, s.sum)
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labels, s.count)
+	}
+}
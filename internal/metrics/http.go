@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// TenantHeader identifies the tenant (organization) a request belongs to.
+//
+// SECURITY: the API doesn't authenticate this header; it's only a metrics
+// label. Have the gateway in front of the API set it (and strip any value
+// sent by clients), otherwise tenants can attribute load to each other.
+const TenantHeader = "X-Tenant-ID"
+
+// HTTPMetrics records request latency per route, status class, and tenant.
+type HTTPMetrics struct {
+	duration *HistogramVec
+	tenants  *TenantLimiter
+}
+
+// NewHTTPMetrics registers http_request_duration_seconds.
+func NewHTTPMetrics(reg *Registry, tenants *TenantLimiter) *HTTPMetrics {
+	return &HTTPMetrics{
+		duration: reg.NewHistogramVec("http_request_duration_seconds",
+			"Time to serve a request, by route, status class, and tenant.",
+			DefaultLatencyBuckets, "route", "status", "tenant"),
+		tenants: tenants,
+	}
+}
+
+// Middleware times every routed request. Requests that matched no route
+// are skipped, so scanners probing random paths can't add series.
+//
+// When the request carries a traceparent header, its trace ID becomes the
+// exemplar of the latency bucket, linking a slow bucket to a slow trace.
+func (m *HTTPMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		if r.Pattern == "" {
+			return
+		}
+		m.duration.ObserveWithExemplar(TraceID(r), time.Since(start).Seconds(),
+			r.Pattern, statusClass(rec.status), m.tenants.Label(r.Header.Get(TenantHeader)))
+	})
+}
+
+// statusClass groups status codes as "2xx", "4xx", ... to keep the
+// number of series small; exact codes rarely matter for latency.
+func statusClass(status int) string {
+	return strconv.Itoa(status/100) + "xx"
+}
+
+// statusRecorder remembers the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status and passes it on.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,298 @@
+// Package metrics collects application counters and exposes them for
+// Prometheus to scrape.
+//
+// WHY NOT THE OFFICIAL CLIENT LIBRARY?
+// This project only needs labelled counters, gauges, and fixed-bucket
+// histograms, and the exposition format is simple text. A small stdlib
+// implementation keeps the dependency list short and shows exactly what a
+// scraper receives. If summaries or native histograms are ever needed,
+// switch to github.com/prometheus/client_golang.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry holds every metric the application exposes.
+// Create one at startup and pass it to the code that records metrics.
+type Registry struct {
+	mu         sync.Mutex
+	counters   []*CounterVec
+	gauges     []*GaugeVec
+	histograms []*HistogramVec
+	onScrape   []func()
+}
+
+// NewRegistry creates an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// NewCounterVec registers a counter with the given label names.
+//
+// Counter names must end in "_total" (a Prometheus convention that tools
+// rely on). Registering a bad or duplicate name is a programming error,
+// so it panics at startup rather than failing silently at scrape time.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	if !strings.HasSuffix(name, "_total") {
+		panic(fmt.Sprintf("metrics: counter %q must end in _total", name))
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.counters {
+		if c.name == name {
+			panic(fmt.Sprintf("metrics: counter %q registered twice", name))
+		}
+	}
+
+	c := &CounterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	r.counters = append(r.counters, c)
+	return c
+}
+
+// NewGaugeVec registers a gauge with the given label names.
+// Gauges hold a current value that can go up or down, e.g. a burn rate.
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, g := range r.gauges {
+		if g.name == name {
+			panic(fmt.Sprintf("metrics: gauge %q registered twice", name))
+		}
+	}
+
+	g := &GaugeVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		series: make(map[string]*gaugeSeries),
+	}
+	r.gauges = append(r.gauges, g)
+	return g
+}
+
+// OnScrape registers fn to run before every scrape.
+// Use it to refresh gauges that are expensive to keep up to date on every
+// change but cheap to compute once per scrape.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onScrape = append(r.onScrape, fn)
+}
+
+// CounterVec is a counter split by label values,
+// e.g. login attempts by result and reason.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*series // keyed by the joined label values
+}
+
+// series is one combination of label values.
+type series struct {
+	values   []string
+	count    float64
+	exemplar *exemplar
+}
+
+// exemplar links a sample to a trace, so a dashboard can jump from a
+// spike in a graph to an example request that caused it.
+type exemplar struct {
+	traceID string
+	value   float64
+	at      time.Time
+}
+
+// Inc adds one to the series with the given label values.
+// Values must be given in the order the labels were registered.
+func (c *CounterVec) Inc(values ...string) {
+	c.IncWithExemplar("", values...)
+}
+
+// IncWithExemplar is like Inc and also records traceID as the series'
+// exemplar. An empty traceID records no exemplar.
+func (c *CounterVec) IncWithExemplar(traceID string, values ...string) {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects labels %v, got %d values", c.name, c.labels, len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		c.series[key] = s
+	}
+	s.count++
+	if traceID != "" {
+		s.exemplar = &exemplar{traceID: traceID, value: 1, at: time.Now()}
+	}
+}
+
+// GaugeVec is a gauge split by label values.
+type GaugeVec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*gaugeSeries // keyed by the joined label values
+}
+
+// gaugeSeries is one combination of label values.
+type gaugeSeries struct {
+	values []string
+	value  float64
+}
+
+// Set sets the series with the given label values to v.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	if len(values) != len(g.labels) {
+		panic(fmt.Sprintf("metrics: %s expects labels %v, got %d values", g.name, g.labels, len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.series[key]
+	if !ok {
+		s = &gaugeSeries{values: append([]string(nil), values...)}
+		g.series[key] = s
+	}
+	s.value = v
+}
+
+// write renders the gauge and all of its series.
+func (g *GaugeVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", g.name, escapeHelp(g.help))
+	fmt.Fprintf(w, "# TYPE %s gauge\n", g.name)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	keys := make([]string, 0, len(g.series))
+	for k := range g.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := g.series[k]
+		fmt.Fprintf(w, "%s%s %g\n", g.name, formatLabels(g.labels, s.values), s.value)
+	}
+}
+
+// Handler serves the registry in the Prometheus text format.
+//
+// Exemplars are only defined in the OpenMetrics format, so they're included
+// when the scraper asks for it (Prometheus does when exemplar storage is
+// enabled). Plain scrapers get the classic text format without them.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		openMetrics := strings.Contains(req.Header.Get("Accept"), "application/openmetrics-text")
+		if openMetrics {
+			w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		}
+		r.write(w, openMetrics)
+	})
+}
+
+// write renders every metric to w.
+func (r *Registry) write(w io.Writer, openMetrics bool) {
+	r.mu.Lock()
+	counters := append([]*CounterVec(nil), r.counters...)
+	gauges := append([]*GaugeVec(nil), r.gauges...)
+	histograms := append([]*HistogramVec(nil), r.histograms...)
+	onScrape := append([]func(){}, r.onScrape...)
+	r.mu.Unlock()
+
+	for _, fn := range onScrape {
+		fn()
+	}
+
+	sort.Slice(counters, func(i, j int) bool { return counters[i].name < counters[j].name })
+	for _, c := range counters {
+		c.write(w, openMetrics)
+	}
+	sort.Slice(gauges, func(i, j int) bool { return gauges[i].name < gauges[j].name })
+	for _, g := range gauges {
+		g.write(w)
+	}
+	sort.Slice(histograms, func(i, j int) bool { return histograms[i].name < histograms[j].name })
+	for _, h := range histograms {
+		h.write(w, openMetrics)
+	}
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// write renders one counter and all of its series.
+func (c *CounterVec) write(w io.Writer, openMetrics bool) {
+	// OpenMetrics names the metric family without the _total suffix.
+	family := c.name
+	if openMetrics {
+		family = strings.TrimSuffix(c.name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", family, escapeHelp(c.help))
+	fmt.Fprintf(w, "# TYPE %s counter\n", family)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Sort for stable output; scrapers don't care, humans reading it do.
+	keys := make([]string, 0, len(c.series))
+	for k := range c.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		s := c.series[k]
+		fmt.Fprintf(w, "%s%s %g", c.name, formatLabels(c.labels, s.values), s.count)
+		if openMetrics && s.exemplar != nil {
+			e := s.exemplar
+			fmt.Fprintf(w, " # {trace_id=\"%s\"} %g %.3f",
+				escapeLabel(e.traceID), e.value, float64(e.at.UnixMilli())/1000)
+		}
+		fmt.Fprint(w, "\n")
+	}
+}
+
+// formatLabels renders {name="value",...}, or nothing without labels.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = fmt.Sprintf("%s=\"%s\"", name, escapeLabel(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escapeLabel escapes a label value as the text format requires.
+var escapeLabel = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
+
+// escapeHelp escapes HELP text as the text format requires.
+var escapeHelp = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace
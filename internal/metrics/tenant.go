@@ -0,0 +1,75 @@
+package metrics
+
+import "sync"
+
+// Tenant label values that don't name a real tenant.
+const (
+	TenantNone  = "none"  // The request carried no tenant
+	TenantOther = "other" // The tenant isn't allowed its own series
+)
+
+// TenantLimiter turns tenant IDs into safe label values.
+//
+// THE CARDINALITY PROBLEM:
+// Every distinct label value creates a new time series in Prometheus,
+// and every series costs memory on every scrape, forever. A label taken
+// straight from a request ("tenant=<whatever the client sent>") lets one
+// misbehaving client create millions of series and take monitoring down.
+//
+// So tenants only get their own label value when:
+//   - they're on the allowlist, or
+//   - there's no allowlist and fewer than max tenants have been seen yet
+//     (first come, first served; a restart resets the set)
+//
+// Everyone else is folded into "other", and each fold is counted in
+// metrics_tenant_overflow_total so operators can tell when the limit bites.
+type TenantLimiter struct {
+	allow    map[string]bool
+	max      int
+	overflow *CounterVec
+
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+// NewTenantLimiter creates a limiter. With a non-empty allowlist, max is
+// ignored. With neither, every tenant is reported as "other".
+func NewTenantLimiter(reg *Registry, allowlist []string, max int) *TenantLimiter {
+	l := &TenantLimiter{
+		allow: make(map[string]bool, len(allowlist)),
+		max:   max,
+		overflow: reg.NewCounterVec("metrics_tenant_overflow_total",
+			"Observations whose tenant was reported as \"other\" because of the tenant allowlist or limit."),
+		seen: make(map[string]bool),
+	}
+	for _, tenant := range allowlist {
+		l.allow[tenant] = true
+	}
+	return l
+}
+
+// Label returns the label value to use for tenant.
+func (l *TenantLimiter) Label(tenant string) string {
+	if tenant == "" {
+		return TenantNone
+	}
+	if len(l.allow) > 0 {
+		if l.allow[tenant] {
+			return tenant
+		}
+		l.overflow.Inc()
+		return TenantOther
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.seen[tenant] {
+		return tenant
+	}
+	if len(l.seen) < l.max {
+		l.seen[tenant] = true
+		return tenant
+	}
+	l.overflow.Inc()
+	return TenantOther
+}
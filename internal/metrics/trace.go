@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TraceID returns the trace ID from the request's W3C "traceparent" header,
+// or "" if there isn't a valid one.
+//
+// The header looks like:
+//
+//	traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//	             ^^ ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^ ^^^^^^^^^^^^^^^^ ^^
+//	        version            trace-id               parent-id      flags
+//
+// A tracing proxy or load balancer in front of the API sets it. Recording
+// the trace ID as an exemplar lets Grafana link a metric to that trace.
+func TraceID(r *http.Request) string {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 || !isHex(parts[1]) {
+		return ""
+	}
+	// An all-zero trace ID is explicitly invalid.
+	if strings.Trim(parts[1], "0") == "" {
+		return ""
+	}
+	return parts[1]
+}
+
+// isHex reports whether s only contains lowercase hex digits.
+func isHex(s string) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// fallbackCooldown is how long FallbackStore stays on its fallback after
+// the primary fails, before trying the primary again.
+const fallbackCooldown = 10 * time.Second
+
+// FallbackStore uses a shared store (Redis) and switches to a local one
+// (memory) while the shared one is failing.
+//
+// WHY NOT JUST FAIL OPEN?
+// Middleware lets requests through when the store errors, so a Redis
+// outage doesn't become a login outage. But it also switches rate
+// limiting off for as long as Redis is down - exactly when an attacker
+// might be hammering it. Local limits are looser (each instance counts
+// on its own, so the effective limit is multiplied by the number of
+// instances), but far better than none.
+//
+// After a failure the primary is left alone for a cooldown, so a Redis
+// that is timing out doesn't add its timeout to every request.
+type FallbackStore struct {
+	primary  Store
+	fallback Store
+
+	mu        sync.Mutex
+	downUntil time.Time // Zero while the primary is healthy
+	now       func() time.Time
+}
+
+// NewFallbackStore creates a store that prefers primary.
+func NewFallbackStore(primary, fallback Store) *FallbackStore {
+	return &FallbackStore{primary: primary, fallback: fallback, now: time.Now}
+}
+
+// Take implements Store.
+func (s *FallbackStore) Take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	if s.primaryDown() {
+		return s.fallback.Take(ctx, key, limit)
+	}
+
+	decision, err := s.primary.Take(ctx, key, limit)
+	if err == nil {
+		s.recovered()
+		return decision, nil
+	}
+
+	s.failed(err)
+	return s.fallback.Take(ctx, key, limit)
+}
+
+// primaryDown reports whether the primary is in its cooldown.
+func (s *FallbackStore) primaryDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.now().Before(s.downUntil)
+}
+
+// failed starts (or extends) a cooldown.
+func (s *FallbackStore) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.downUntil.IsZero() {
+		log.Printf("rate limit store failed, using local limits: %v", err)
+	}
+	s.downUntil = s.now().Add(fallbackCooldown)
+}
+
+// recovered ends the outage, logging it once.
+func (s *FallbackStore) recovered() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.downUntil.IsZero() {
+		log.Printf("rate limit store recovered, using shared limits again")
+		s.downUntil = time.Time{}
+	}
+}
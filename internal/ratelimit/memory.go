@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go-basics/internal/cache"
+)
+
+// maxLocalKeys bounds the keys an in-memory store tracks.
+//
+// WHY A BOUND?
+// Keys come from requests: an attacker spraying logins from many IPs at
+// many emails creates a bucket per pair, as fast as they can send. When
+// the store is full, the least recently seen key is forgotten, and gets
+// a fresh allowance if it comes back. That's a key an attacker has left
+// alone for longest, and a far better outcome than running out of memory.
+const maxLocalKeys = 100000
+
+// MemoryStore keeps buckets in process memory.
+type MemoryStore struct {
+	buckets *cache.TTL[string, bucket]
+	now     func() time.Time
+}
+
+// bucket is one key's token bucket.
+//
+// Instead of a token count that a timer refills, it stores the time at
+// which the bucket will be full again ("theoretical arrival time"). The
+// tokens available at any moment follow from that, so there's nothing to
+// update in the background.
+type bucket struct {
+	fullAt time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store. opts are passed to
+// its cache, e.g. cache.WithMetrics.
+//
+// A bucket is kept until it's full again, when it holds no information.
+func NewMemoryStore(opts ...cache.Option) *MemoryStore {
+	s := &MemoryStore{now: time.Now}
+	opts = append([]cache.Option{cache.WithMaxEntries(maxLocalKeys), cache.WithClock(s.now)}, opts...)
+	s.buckets = cache.New[string, bucket]("ratelimit_token_bucket", opts...)
+	return s
+}
+
+// Take implements Store.
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (Decision, error) {
+	now := s.now()
+	interval := limit.interval()
+
+	var decision Decision
+	s.buckets.Update(key, func(b bucket, _ bool) (bucket, time.Duration) {
+		// A bucket that filled up in the past (or a new one) is simply full.
+		fullAt := b.fullAt
+		if fullAt.Before(now) {
+			fullAt = now
+		}
+
+		// Taking a token pushes "full again" one interval further out. If
+		// that would be more than a whole period away, the bucket is empty.
+		next := fullAt.Add(interval)
+		if next.Sub(now) > limit.Period {
+			decision = Decision{RetryAfter: next.Sub(now) - limit.Period, ResetAfter: fullAt.Sub(now)}
+			return b, fullAt.Sub(now)
+		}
+		decision = Decision{
+			Allowed:    true,
+			Remaining:  int((limit.Period - next.Sub(now)) / interval),
+			ResetAfter: next.Sub(now),
+		}
+		return bucket{fullAt: next}, next.Sub(now)
+	})
+	return decision, nil
+}
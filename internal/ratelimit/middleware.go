@@ -0,0 +1,172 @@
+package ratelimit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPeekBytes caps how much of a body ByEmail reads.
+const maxPeekBytes = 1 << 20
+
+// KeyFunc picks the bucket a request counts against.
+// An empty key means the rule doesn't apply to the request.
+type KeyFunc func(r *http.Request) string
+
+// Rule is one limit applied to requests grouped by Key.
+type Rule struct {
+	Name  string // Prefix for bucket keys, e.g. "login-ip"
+	Limit Limit
+	Key   KeyFunc
+
+	// LimitFunc, when set, replaces Limit and is called on every request,
+	// so the limit can be changed while the server runs (see package
+	// tunables). Buckets keep their state across changes.
+	LimitFunc func() Limit
+}
+
+// limit returns the rule's current limit.
+func (r Rule) limit() Limit {
+	if r.LimitFunc != nil {
+		return r.LimitFunc()
+	}
+	return r.Limit
+}
+
+// Middleware returns middleware that enforces every rule, answering
+// 429 Too Many Requests with a Retry-After header when any bucket is empty.
+// Rules whose Limit isn't enabled are skipped.
+//
+// Every limited response carries X-RateLimit-Limit, X-RateLimit-Remaining,
+// and X-RateLimit-Reset (seconds until the full limit is back) for the
+// rule closest to its limit. With a shared store, every instance reports
+// the same numbers, so clients see one consistent limit.
+//
+// If the store fails (e.g. Redis is down), the request is let through and
+// the error logged. Failing closed would turn a Redis outage into a login
+// outage for everyone, which is worse than a few minutes without limits.
+// (FallbackStore keeps local limits in force during the outage.)
+//
+// Usage:
+//
+//	limit := ratelimit.Middleware(store,
+//	    ratelimit.Rule{Name: "login-ip", Limit: perIP, Key: ratelimit.ByIP},
+//	    ratelimit.Rule{Name: "login-email", Limit: perEmail, Key: ratelimit.ByEmail},
+//	)
+//	mux.HandleFunc("POST /login", limit(h.login))
+func Middleware(store Store, rules ...Rule) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			var tightest *headerState
+			for _, rule := range rules {
+				limit := rule.limit()
+				if !limit.Enabled() {
+					continue
+				}
+				key := rule.Key(r)
+				if key == "" {
+					continue
+				}
+
+				decision, err := store.Take(r.Context(), rule.Name+":"+key, limit)
+				if err != nil {
+					log.Printf("rate limit %s: %v (allowing request)", rule.Name, err)
+					continue
+				}
+				if tightest == nil || decision.Remaining < tightest.decision.Remaining {
+					tightest = &headerState{limit: limit, decision: decision}
+				}
+				if !decision.Allowed {
+					setLimitHeaders(w, limit, decision)
+					// Retry-After is in whole seconds; round up so clients
+					// that honor it don't come back a moment too early.
+					w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+					http.Error(w, "too many requests", http.StatusTooManyRequests)
+					return
+				}
+			}
+			if tightest != nil {
+				setLimitHeaders(w, tightest.limit, tightest.decision)
+			}
+			next(w, r)
+		}
+	}
+}
+
+// headerState is the rule reported in the X-RateLimit headers.
+type headerState struct {
+	limit    Limit
+	decision Decision
+}
+
+// setLimitHeaders describes limit and decision to the client.
+func setLimitHeaders(w http.ResponseWriter, limit Limit, decision Decision) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(limit.Burst))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(max(decision.Remaining, 0)))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.ResetAfter)))
+}
+
+// ceilSeconds rounds d up to whole seconds, at least 1.
+func ceilSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
+
+// ByIP keys requests by the client's IP address.
+//
+// It uses the TCP peer address. Behind a reverse proxy every request
+// comes from the proxy, so configure the proxy to rate limit instead (or
+// to overwrite RemoteAddr); X-Forwarded-For is ignored because any client
+// can set it to dodge the limit.
+func ByIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// ByEmail keys requests by the "email" field of their JSON body, so one
+// account can't be attacked from many IPs at once.
+//
+// The body is read and then put back for the handler. The email is hashed
+// so bucket keys (which may end up in Redis) don't store addresses.
+func ByEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	// Put what we read back in front of whatever we didn't, so the handler
+	// sees the whole body - and the same error if reading failed, e.g. the
+	// server's body size limit (which the handler turns into a 413).
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBytes))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return ""
+	}
+
+	var fields struct {
+		Email string `json:"email"`
+	}
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	// Normalize like the user service does, so "A@x.com" and "a@x.com"
+	// share a bucket.
+	email := strings.ToLower(strings.TrimSpace(fields.Email))
+	if email == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(email))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,55 @@
+// Package ratelimit throttles requests with token buckets.
+//
+// THE TOKEN BUCKET ALGORITHM:
+// Each key (an IP address, an email) has a bucket holding up to Burst
+// tokens. A request takes one token; an empty bucket means "429 Too Many
+// Requests". Tokens drip back in at a steady rate - Burst tokens per
+// Period - so a client can make a short burst of requests, then has to
+// slow down to the average rate.
+//
+// WHY RATE LIMIT LOGIN?
+// Without a limit, an attacker can try thousands of passwords per second
+// against one account (limited per email), or one common password
+// against thousands of accounts (limited per IP). Limiting forgot-password
+// stops the endpoint from being used to flood someone's inbox.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Limit is a token bucket size and refill speed.
+type Limit struct {
+	Burst  int           // Bucket capacity: requests allowed back to back
+	Period time.Duration // Time for an empty bucket to refill completely
+}
+
+// Enabled reports whether the limit restricts anything.
+// A zero Burst or Period means "no limit".
+func (l Limit) Enabled() bool {
+	return l.Burst > 0 && l.Period > 0
+}
+
+// interval is the time it takes for one token to drip back in.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Burst)
+}
+
+// Decision is the outcome of asking a Store for a token.
+type Decision struct {
+	Allowed    bool
+	RetryAfter time.Duration // When denied: how long until a token is available
+	Remaining  int           // Requests still allowed right now
+	ResetAfter time.Duration // How long until the full Burst is available again
+}
+
+// Store keeps the buckets.
+//
+// Use MemoryStore for a single instance. With several instances behind a
+// load balancer each would keep its own buckets, multiplying the real
+// limit by the number of instances; use RedisStore to share them.
+type Store interface {
+	// Take removes one token from key's bucket if there is one.
+	Take(ctx context.Context, key string, limit Limit) (Decision, error)
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/goleak"
+)
+
+// TestMain fails the package's tests if any goroutine outlives them:
+// a Redis client's connections, or a request left blocked in a store.
+//
+// go-redis probes an unreachable server from a goroutine of its own once
+// enough dials have failed, and only notices Close between probes, a
+// second apart. That one is the library's and ends on its own.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		goleak.IgnoreAnyFunction("github.com/redis/go-redis/v9/internal/pool.(*ConnPool).tryDial"))
+}
+
+// unreachableRedis returns a client for an address nothing listens on.
+func unreachableRedis(t *testing.T) *redis.Client {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DialTimeout: time.Second})
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// TestFallbackStoreConcurrent takes tokens from many goroutines while
+// Redis is down: the local store must answer every one, and hand out no
+// more than the burst between them.
+func TestFallbackStoreConcurrent(t *testing.T) {
+	store := NewFallbackStore(NewRedisStore(unreachableRedis(t), "test:"), NewMemoryStore())
+	limit := Limit{Burst: 5, Period: time.Hour}
+
+	var allowed atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err := store.Take(context.Background(), "login:1.2.3.4", limit)
+			if err != nil {
+				t.Errorf("Take: %v", err)
+				return
+			}
+			if decision.Allowed {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != int64(limit.Burst) {
+		t.Errorf("allowed %d requests, want %d", got, limit.Burst)
+	}
+}
@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// takeScript is the token bucket from MemoryStore, run inside Redis.
+//
+// WHY A LUA SCRIPT?
+// Reading the bucket, deciding, and writing it back must happen as one
+// step, or two instances could both take the last token. Redis runs a
+// script atomically, with no other command in between.
+//
+// The clock is Redis's own (TIME), so instances with skewed clocks still
+// agree. Keys expire once the bucket is full again, so idle keys vanish.
+//
+// Returns {retry after, remaining, reset after}, times in milliseconds;
+// retry after is 0 when the request is allowed.
+var takeScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local interval = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+
+local full_at = tonumber(redis.call('GET', KEYS[1]) or now)
+if full_at < now then
+	full_at = now
+end
+
+local next_full = full_at + interval
+if next_full - now > period then
+	return {next_full - now - period, 0, full_at - now}
+end
+
+redis.call('SET', KEYS[1], next_full, 'PX', math.max(next_full - now, 1))
+return {0, math.floor((period - (next_full - now)) / interval), next_full - now}
+`)
+
+// RedisStore keeps buckets in Redis so every instance shares them.
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string // Namespaces keys, e.g. "ratelimit:"
+}
+
+// NewRedisStore creates a store on an existing Redis client.
+func NewRedisStore(client redis.UniversalClient, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+// Take implements Store.
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	// Millisecond resolution; a limit finer than 1ms per request isn't a limit.
+	interval := max(limit.interval().Milliseconds(), 1)
+
+	result, err := takeScript.Run(ctx, s.client, []string{s.prefix + key},
+		interval, limit.Period.Milliseconds()).Int64Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("running rate limit script: %w", err)
+	}
+	return scriptDecision(result)
+}
+
+// scriptDecision converts a script's {retry after, remaining, reset after}
+// reply (milliseconds) into a Decision.
+func scriptDecision(result []int64) (Decision, error) {
+	if len(result) != 3 {
+		return Decision{}, fmt.Errorf("rate limit script returned %d values, want 3", len(result))
+	}
+	return Decision{
+		Allowed:    result[0] == 0,
+		RetryAfter: time.Duration(result[0]) * time.Millisecond,
+		Remaining:  int(result[1]),
+		ResetAfter: time.Duration(result[2]) * time.Millisecond,
+	}, nil
+}
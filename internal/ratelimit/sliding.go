@@ -0,0 +1,222 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"go-basics/internal/cache"
+)
+
+// THE SLIDING WINDOW ALGORITHM:
+// A fixed window ("at most Burst requests per 15-minute window") lets a
+// client send Burst requests at 12:14:59 and Burst more at 12:15:00. A
+// sliding window counts the requests of the last Period, whenever "now"
+// is. Keeping every timestamp is expensive, so, like most production
+// limiters, we approximate it from two fixed-window counters:
+//
+//	count = previous window's count * (share of it still inside Period)
+//	      + current window's count
+//
+// Ten seconds into a one-minute window, 5/6 of the previous window still
+// counts. The estimate assumes the previous window's requests were spread
+// evenly, which is close enough and never lets a client double its rate.
+//
+// Compared with the token bucket (MemoryStore, RedisStore), a sliding
+// window has no burst-then-refill shape: Burst is simply "requests per
+// Period". The Store interface is the same, so the middleware doesn't care.
+
+// slidingWindow is the state of one key: two fixed-window counters.
+type slidingWindow struct {
+	start    int64 // Index of the current window: unix ms / period ms
+	current  int64 // Requests in the current window
+	previous int64 // Requests in the window before it
+}
+
+// advance moves w to window index, carrying or dropping the counts.
+func (w *slidingWindow) advance(index int64) {
+	switch {
+	case w.start == index:
+	case w.start == index-1:
+		w.previous, w.current = w.current, 0
+	default:
+		w.previous, w.current = 0, 0
+	}
+	w.start = index
+}
+
+// take counts a request at nowMS if it fits under burst. It's the same
+// arithmetic as slidingScript; keep the two in step.
+func (w *slidingWindow) take(nowMS, periodMS int64, burst int) Decision {
+	w.advance(nowMS / periodMS)
+	elapsed := nowMS % periodMS
+	weighted := float64(w.previous) * float64(periodMS-elapsed) / float64(periodMS)
+	count := weighted + float64(w.current)
+
+	if count+1 > float64(burst) {
+		return Decision{
+			RetryAfter: ms(slidingRetryAfter(w.previous, w.current, int64(burst), elapsed, periodMS)),
+			ResetAfter: ms(slidingResetAfter(w.current, elapsed, periodMS)),
+		}
+	}
+	w.current++
+	return Decision{
+		Allowed:    true,
+		Remaining:  int(math.Floor(float64(burst) - count - 1)),
+		ResetAfter: ms(slidingResetAfter(w.current, elapsed, periodMS)),
+	}
+}
+
+// slidingRetryAfter is how long until one more request fits: until enough
+// of the previous window has slid out, or, if the current window alone is
+// full, until enough of it has slid out after it becomes the previous one.
+func slidingRetryAfter(previous, current, burst, elapsed, period int64) int64 {
+	free := burst - current - 1 // Room left for the previous window's share
+	if free >= 0 && previous > 0 {
+		// previous * (period - elapsed - t) / period <= free
+		return max(period-elapsed-free*period/previous, 1)
+	}
+	// Wait for the next window, where current becomes the previous one:
+	// current * (period - e) / period <= burst - 1
+	wait := period - elapsed
+	if current > 0 {
+		wait += max(period-(burst-1)*period/current, 0)
+	}
+	return max(wait, 1)
+}
+
+// slidingResetAfter is how long until no past request counts any more:
+// the end of the next window if this one has requests, else this one's.
+func slidingResetAfter(current, elapsed, period int64) int64 {
+	if current > 0 {
+		return 2*period - elapsed
+	}
+	return period - elapsed
+}
+
+// ms converts milliseconds to a Duration.
+func ms(n int64) time.Duration {
+	return time.Duration(n) * time.Millisecond
+}
+
+// SlidingWindowStore is a sliding window limiter in process memory.
+type SlidingWindowStore struct {
+	windows *cache.TTL[string, slidingEntry]
+	now     func() time.Time
+}
+
+// slidingEntry is a key's window plus its period.
+type slidingEntry struct {
+	slidingWindow
+	periodMS int64
+}
+
+// NewSlidingWindowStore creates an empty in-memory sliding window store.
+// opts are passed to its cache, e.g. cache.WithMetrics.
+//
+// A window is kept until none of its requests is inside the period any
+// more, at the end of the window after it.
+func NewSlidingWindowStore(opts ...cache.Option) *SlidingWindowStore {
+	s := &SlidingWindowStore{now: time.Now}
+	opts = append([]cache.Option{cache.WithMaxEntries(maxLocalKeys), cache.WithClock(s.now)}, opts...)
+	s.windows = cache.New[string, slidingEntry]("ratelimit_sliding_window", opts...)
+	return s
+}
+
+// Take implements Store.
+func (s *SlidingWindowStore) Take(_ context.Context, key string, limit Limit) (Decision, error) {
+	nowMS := s.now().UnixMilli()
+	periodMS := max(limit.Period.Milliseconds(), 1)
+
+	var decision Decision
+	s.windows.Update(key, func(w slidingEntry, ok bool) (slidingEntry, time.Duration) {
+		if !ok || w.periodMS != periodMS {
+			// A changed period (see Rule.LimitFunc) makes the old counts meaningless.
+			w = slidingEntry{slidingWindow: slidingWindow{start: nowMS / periodMS}, periodMS: periodMS}
+		}
+		decision = w.take(nowMS, periodMS, limit.Burst)
+		return w, ms((w.start+2)*periodMS - nowMS)
+	})
+	return decision, nil
+}
+
+// slidingScript is SlidingWindowStore.Take run inside Redis; see
+// takeScript for why it's a script and uses Redis's clock.
+//
+// The state is one hash per key (fields s, c, p: window start, current
+// and previous counts), so every command touches a single key. In a
+// Redis Cluster a script may only use keys in one hash slot; with one
+// key per call that holds whatever slot the key lands in.
+//
+// Returns {retry after, remaining, reset after}, times in milliseconds;
+// retry after is 0 when the request is allowed.
+var slidingScript = redis.NewScript(`
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+local period = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+
+local index = math.floor(now / period)
+local state = redis.call('HMGET', KEYS[1], 's', 'c', 'p')
+local start = tonumber(state[1])
+local current = tonumber(state[2]) or 0
+local previous = tonumber(state[3]) or 0
+if start == nil or start < index - 1 then
+	current, previous = 0, 0
+elseif start == index - 1 then
+	current, previous = 0, current
+end
+
+local elapsed = now - index * period
+local count = previous * (period - elapsed) / period + current
+
+if count + 1 > burst then
+	local retry
+	local free = burst - current - 1
+	if free >= 0 and previous > 0 then
+		retry = period - elapsed - math.floor(free * period / previous)
+	else
+		retry = period - elapsed
+		if current > 0 then
+			retry = retry + math.max(period - math.floor((burst - 1) * period / current), 0)
+		end
+	end
+	local reset = period - elapsed
+	if current > 0 then
+		reset = 2 * period - elapsed
+	end
+	return {math.max(retry, 1), 0, reset}
+end
+
+current = current + 1
+redis.call('HSET', KEYS[1], 's', index, 'c', current, 'p', previous)
+redis.call('PEXPIRE', KEYS[1], 2 * period)
+return {0, math.floor(burst - count - 1), 2 * period - elapsed}
+`)
+
+// RedisSlidingWindowStore is a sliding window limiter shared through Redis
+// (a single server or a Redis Cluster).
+type RedisSlidingWindowStore struct {
+	client redis.UniversalClient
+	prefix string // Namespaces keys, e.g. "ratelimit:"
+}
+
+// NewRedisSlidingWindowStore creates a store on an existing Redis client.
+// Pass a *redis.ClusterClient (or a UniversalClient with several
+// addresses) to spread keys across a cluster.
+func NewRedisSlidingWindowStore(client redis.UniversalClient, prefix string) *RedisSlidingWindowStore {
+	return &RedisSlidingWindowStore{client: client, prefix: prefix}
+}
+
+// Take implements Store.
+func (s *RedisSlidingWindowStore) Take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	result, err := slidingScript.Run(ctx, s.client, []string{s.prefix + key},
+		max(limit.Period.Milliseconds(), 1), limit.Burst).Int64Slice()
+	if err != nil {
+		return Decision{}, fmt.Errorf("running sliding window script: %w", err)
+	}
+	return scriptDecision(result)
+}
@@ -0,0 +1,190 @@
+// Package redirect checks URLs a client asks to be sent back to after a
+// flow (a sign-in, a confirmation link, an authorization) before the
+// server redirects a browser there.
+//
+// WHAT IS AN OPEN REDIRECT?
+// A sign-in page that takes ?return_to= and redirects to whatever it's
+// given lets anyone craft a link on our domain that lands on theirs:
+// https://api.example.com/sso/saml/login?return_to=https://examp1e.com.
+// The victim sees a trusted domain in the link, signs in, and arrives at
+// a look-alike page asking for their password again. Worse, a flow that
+// hands tokens to the return URL (as SSO does, in the fragment) hands
+// them to the attacker.
+//
+// WHY ONE SHARED VALIDATOR?
+// Browsers are lenient about URLs in ways a quick check isn't: they read
+// "/\evil.com" and "/<tab>/evil.com" as "//evil.com", a host on another
+// site, and "https://app.example.com@evil.com" as evil.com with a user
+// name. Every flow that redirects should refuse the same tricks, so they
+// all go through Validator.Check rather than each testing a prefix.
+package redirect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Sentinel errors.
+var (
+	// ErrInvalid is returned for a URL that isn't a plain http(s) URL or
+	// path: another scheme (javascript:, data:), user info, a fragment,
+	// control characters, or backslashes.
+	ErrInvalid = errors.New("invalid redirect URL")
+
+	// ErrNotAllowed is returned for a well-formed URL on no allowlist.
+	ErrNotAllowed = errors.New("redirect URL is not allowed")
+)
+
+// TenantPolicy reports whether the tenant allows redirecting to uri
+// (tenant.Service.AllowsRedirect).
+type TenantPolicy func(ctx context.Context, tenantID, uri string) (bool, error)
+
+// Validator checks return URLs against an allowlist.
+//
+// An allowlist entry is an absolute URL: scheme, host, optional port,
+// optional path. A return URL matches it when the scheme, host, and port
+// are the same and its path is the entry's path or below it ("/app"
+// allows "/app" and "/app/settings", not "/application"). A host of
+// "*.example.com" matches any subdomain of example.com.
+type Validator struct {
+	base    *url.URL // Where paths resolve; nil refuses them
+	allowed []*url.URL
+	tenants TenantPolicy // nil: tenants allow nothing more
+}
+
+// Option configures a Validator.
+type Option func(*Validator)
+
+// WithBase resolves return URLs given as a path ("/settings") against
+// base, the app's address. Without it only absolute URLs are accepted.
+// base is allowed itself.
+func WithBase(base string) Option {
+	return func(v *Validator) {
+		if u, err := url.Parse(base); err == nil && base != "" {
+			v.base = u
+		}
+	}
+}
+
+// WithTenantPolicy also allows, for requests naming a tenant, what the
+// tenant's policy allows.
+func WithTenantPolicy(policy TenantPolicy) Option {
+	return func(v *Validator) {
+		v.tenants = policy
+	}
+}
+
+// NewValidator creates a Validator allowing the URLs in allowed (see
+// Validator). Malformed entries are an error.
+func NewValidator(allowed []string, opts ...Option) (*Validator, error) {
+	v := &Validator{}
+	for _, opt := range opts {
+		opt(v)
+	}
+	for _, entry := range allowed {
+		u, err := url.Parse(entry)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") ||
+			u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+			return nil, fmt.Errorf("redirect allowlist entry %q: must be an absolute http or https URL without user info, query, or fragment", entry)
+		}
+		if host := u.Hostname(); strings.Contains(host, "*") &&
+			(!strings.HasPrefix(host, "*.") || strings.Contains(host[2:], "*")) {
+			return nil, fmt.Errorf("redirect allowlist entry %q: the only wildcard is a leading \"*.\" in the host", entry)
+		}
+		v.allowed = append(v.allowed, u)
+	}
+	if v.base != nil {
+		v.allowed = append(v.allowed, v.base)
+	}
+	return v, nil
+}
+
+// Check returns the absolute URL to redirect to for raw, a return URL
+// from a client: an absolute URL, or a path when the Validator has a
+// base. tenantID, if not empty, adds the tenant's allowed redirect URIs
+// to the allowlist.
+//
+// It returns ErrInvalid or ErrNotAllowed, or the tenant policy's error.
+func (v *Validator) Check(ctx context.Context, tenantID, raw string) (*url.URL, error) {
+	u, err := v.parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range v.allowed {
+		if matches(entry, u) {
+			return u, nil
+		}
+	}
+	if tenantID != "" && v.tenants != nil {
+		ok, err := v.tenants(ctx, tenantID, u.String())
+		if err != nil {
+			return nil, fmt.Errorf("checking tenant redirect policy: %w", err)
+		}
+		if ok {
+			return u, nil
+		}
+	}
+	return nil, ErrNotAllowed
+}
+
+// parse refuses anything a browser might read differently than
+// url.Parse does, and resolves paths against the base.
+func (v *Validator) parse(raw string) (*url.URL, error) {
+	if raw == "" || len(raw) > 2048 {
+		return nil, ErrInvalid
+	}
+	// Browsers drop tabs and newlines inside URLs and treat "\" as "/",
+	// turning "/\t/evil.com" or "/\evil.com" into "//evil.com".
+	for _, c := range raw {
+		if c < 0x20 || c == 0x7f || c == '\\' {
+			return nil, ErrInvalid
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil || u.Fragment != "" || strings.Contains(raw, "#") {
+		return nil, ErrInvalid
+	}
+	// Browsers treat "%2e" as a dot in paths, so "/app/%2e%2e/admin"
+	// would escape an entry's path; real return paths don't need it.
+	if strings.Contains(strings.ToLower(u.EscapedPath()), "%2e") {
+		return nil, ErrInvalid
+	}
+
+	if !u.IsAbs() {
+		// Only a path: "//evil.com" is absolute in all but name, and
+		// "evil.com" or "https:evil.com" are misreadings waiting to
+		// happen.
+		if v.base == nil || u.Host != "" || u.Opaque != "" || !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") {
+			return nil, ErrInvalid
+		}
+		return v.base.ResolveReference(u), nil
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Opaque != "" {
+		return nil, ErrInvalid
+	}
+	// Resolving against nothing removes "." and ".." segments, so the
+	// path matched is the path the browser will load.
+	return u.ResolveReference(&url.URL{}), nil
+}
+
+// matches reports whether u falls under entry (see Validator).
+func matches(entry, u *url.URL) bool {
+	if !strings.EqualFold(entry.Scheme, u.Scheme) || entry.Port() != u.Port() {
+		return false
+	}
+	host, pattern := strings.ToLower(u.Hostname()), strings.ToLower(entry.Hostname())
+	if suffix, ok := strings.CutPrefix(pattern, "*"); ok {
+		if len(host) <= len(suffix) || !strings.HasSuffix(host, suffix) {
+			return false
+		}
+	} else if host != pattern {
+		return false
+	}
+
+	prefix := strings.TrimSuffix(entry.EscapedPath(), "/")
+	path := u.EscapedPath()
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,131 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// ActivityRepository implements user.ActivityRepository for MySQL, in the
+// main database (the directory in sharded mode).
+type ActivityRepository struct {
+	db *sql.DB
+}
+
+// NewActivityRepository creates a new account activity repository.
+func NewActivityRepository(db *sql.DB) user.ActivityRepository {
+	return &ActivityRepository{db: db}
+}
+
+// Touch records a login. The upsert keeps disabled_at: a disabled
+// account is only cleared by Reactivate.
+func (r *ActivityRepository) Touch(ctx context.Context, userID uint64, at time.Time, ip string) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO account_activity (user_id, last_login_at, last_login_ip) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE last_login_at = VALUES(last_login_at), last_login_ip = VALUES(last_login_ip),
+			warned_at = NULL, delete_after = NULL`,
+		userID, at, sql.NullString{String: ip, Valid: ip != ""})
+	if err != nil {
+		return fmt.Errorf("recording activity: %w", err)
+	}
+	return nil
+}
+
+// Find returns one account's activity, or nil.
+func (r *ActivityRepository) Find(ctx context.Context, userID uint64) (*user.Activity, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT user_id, last_login_at, last_login_ip, warned_at, disabled_at, delete_after
+		FROM account_activity WHERE user_id = ?`, userID)
+	a, err := scanActivity(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying activity: %w", err)
+	}
+	return &a, nil
+}
+
+// Dormant returns a page of accounts last signed in to before cutoff.
+// Paging by user_id (the primary key) rather than OFFSET keeps every page
+// as cheap as the first, and accounts the caller deletes along the way
+// don't shift the next page.
+func (r *ActivityRepository) Dormant(ctx context.Context, cutoff time.Time, afterID uint64, limit int) ([]user.Activity, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT user_id, last_login_at, last_login_ip, warned_at, disabled_at, delete_after
+		FROM account_activity
+		WHERE last_login_at < ? AND user_id > ?
+		ORDER BY user_id LIMIT ?`, cutoff, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying dormant accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var accounts []user.Activity
+	for rows.Next() {
+		a, err := scanActivity(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning activity: %w", err)
+		}
+		accounts = append(accounts, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating activity: %w", err)
+	}
+	return accounts, nil
+}
+
+// Save writes the dormancy policy's progress.
+func (r *ActivityRepository) Save(ctx context.Context, a *user.Activity) error {
+	_, err := r.db.ExecContext(ctx,
+		`UPDATE account_activity SET warned_at = ?, disabled_at = ?, delete_after = ? WHERE user_id = ?`,
+		nullTime(a.WarnedAt), nullTime(a.DisabledAt), nullTime(a.DeleteAfter), a.UserID)
+	if err != nil {
+		return fmt.Errorf("saving activity: %w", err)
+	}
+	return nil
+}
+
+// Reactivate clears the policy's progress and records a login.
+func (r *ActivityRepository) Reactivate(ctx context.Context, userID uint64, at time.Time) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO account_activity (user_id, last_login_at) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE last_login_at = VALUES(last_login_at),
+			warned_at = NULL, disabled_at = NULL, delete_after = NULL`,
+		userID, at)
+	if err != nil {
+		return fmt.Errorf("reactivating: %w", err)
+	}
+	return nil
+}
+
+// Delete removes one account's activity.
+func (r *ActivityRepository) Delete(ctx context.Context, userID uint64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM account_activity WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("deleting activity: %w", err)
+	}
+	return nil
+}
+
+// scanActivity reads one account_activity row, turning NULLs into zero
+// values.
+func scanActivity(row interface{ Scan(...interface{}) error }) (user.Activity, error) {
+	var a user.Activity
+	var ip sql.NullString
+	var warned, disabled, deleteAfter sql.NullTime
+	if err := row.Scan(&a.UserID, &a.LastLoginAt, &ip, &warned, &disabled, &deleteAfter); err != nil {
+		return user.Activity{}, err
+	}
+	a.LastLoginIP = ip.String
+	a.WarnedAt, a.DisabledAt, a.DeleteAfter = warned.Time, disabled.Time, deleteAfter.Time
+	return a, nil
+}
+
+// nullTime stores a zero time as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+
+	"go-basics/internal/domain/user"
+)
+
+// personalDataTables are the tables in the main database (the directory
+// in sharded mode) with rows about one user, keyed by user_id, that
+// ErasePersonalData deletes. A new table holding personal data belongs
+// here.
+//
+// user_roles stays: a role isn't personal data, and audit_events is
+// append-only (see package audit).
+var personalDataTables = []string{
+	"sessions",
+	"password_reset_tokens",
+	"email_change_tokens",
+	"invitations",
+	"mfa_recovery_codes",
+	"account_activity",
+	"login_countries",
+	"login_history",
+	"user_preferences",
+	"notification_preferences",
+	"pending_notifications",
+	"push_subscriptions",
+	"anonymization_requests",
+	"campaign_deliveries",
+}
+
+// AnonymizationRepository implements user.AnonymizationRepository for
+// MySQL. Requests live in the main database (the directory in sharded
+// mode).
+type AnonymizationRepository struct {
+	db dbtx
+}
+
+// NewAnonymizationRepository creates a new anonymization repository.
+func NewAnonymizationRepository(db *sql.DB) user.AnonymizationRepository {
+	return &AnonymizationRepository{db: scoped(db)}
+}
+
+// CreateAnonymizationRequest inserts req. The primary key on user_id
+// refuses a second request, atomically, where a SELECT first wouldn't.
+func (r *AnonymizationRepository) CreateAnonymizationRequest(ctx context.Context, req *user.AnonymizationRequest) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO anonymization_requests (user_id, requested_by, requested_at, anonymize_after)
+		VALUES (?, ?, ?, ?)
+	`, req.UserID, req.RequestedBy, req.RequestedAt.UTC(), req.AnonymizeAfter.UTC())
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+		return user.ErrAnonymizationPending
+	}
+	if err != nil {
+		return fmt.Errorf("inserting anonymization request: %w", err)
+	}
+	return nil
+}
+
+// AnonymizationRequest returns the user's request, or nil.
+func (r *AnonymizationRepository) AnonymizationRequest(ctx context.Context, userID uint64) (*user.AnonymizationRequest, error) {
+	var req user.AnonymizationRequest
+	err := r.db.QueryRowContext(ctx, `
+		SELECT user_id, requested_by, requested_at, anonymize_after
+		FROM anonymization_requests
+		WHERE user_id = ?
+	`, userID).Scan(&req.UserID, &req.RequestedBy, &req.RequestedAt, &req.AnonymizeAfter)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying anonymization request: %w", err)
+	}
+	return &req, nil
+}
+
+// DeleteAnonymizationRequest removes the user's request.
+func (r *AnonymizationRepository) DeleteAnonymizationRequest(ctx context.Context, userID uint64) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM anonymization_requests WHERE user_id = ?`, userID)
+	if err != nil {
+		return false, fmt.Errorf("deleting anonymization request: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// PendingAnonymizations returns requests in anonymize_after order, from
+// the idx_anonymization_requests_anonymize_after index.
+func (r *AnonymizationRepository) PendingAnonymizations(ctx context.Context, dueBy time.Time, limit int) ([]user.AnonymizationRequest, error) {
+	query := `
+		SELECT user_id, requested_by, requested_at, anonymize_after
+		FROM anonymization_requests`
+	args := []interface{}{}
+	if !dueBy.IsZero() {
+		query += ` WHERE anonymize_after <= ?`
+		args = append(args, dueBy.UTC())
+	}
+	query += ` ORDER BY anonymize_after, user_id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying anonymization requests: %w", err)
+	}
+	defer rows.Close()
+
+	var reqs []user.AnonymizationRequest
+	for rows.Next() {
+		var req user.AnonymizationRequest
+		if err := rows.Scan(&req.UserID, &req.RequestedBy, &req.RequestedAt, &req.AnonymizeAfter); err != nil {
+			return nil, fmt.Errorf("scanning anonymization request: %w", err)
+		}
+		reqs = append(reqs, req)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating anonymization requests: %w", err)
+	}
+	return reqs, nil
+}
+
+// ErasePersonalData deletes the user's rows from personalDataTables.
+// The statements join the request transaction (see scoped).
+func (r *AnonymizationRepository) ErasePersonalData(ctx context.Context, userID uint64) error {
+	for _, table := range personalDataTables {
+		if _, err := r.db.ExecContext(ctx, `DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("erasing %s: %w", table, err)
+		}
+	}
+	return nil
+}
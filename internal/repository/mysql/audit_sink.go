@@ -0,0 +1,98 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go-basics/internal/audit"
+)
+
+// AuditSink implements audit.Sink with the audit_events table in the
+// main database (the directory in sharded mode).
+//
+// The sink only ever inserts events. For a trail the application can't
+// alter, write it through a MySQL account granted INSERT and SELECT on
+// audit_events (plus SELECT and UPDATE on audit_chain_head) and nothing
+// else, so even a compromised application server can't rewrite history.
+//
+// Rows are hash-chained (see audit.Event.Chain). The end of the chain is
+// the single row of audit_chain_head: each insert locks it, so instances
+// append one at a time and no two rows get the same sequence number.
+type AuditSink struct {
+	db *sql.DB
+}
+
+// NewAuditSink creates an audit sink.
+func NewAuditSink(db *sql.DB) audit.Sink {
+	return &AuditSink{db: db}
+}
+
+// Write implements audit.Sink.
+func (s *AuditSink) Write(ctx context.Context, e audit.Event) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	// Rollback after Commit is a no-op.
+	defer tx.Rollback()
+
+	var prev audit.Link
+	if err := tx.QueryRowContext(ctx,
+		`SELECT seq, hash FROM audit_chain_head WHERE id = 1 FOR UPDATE`).Scan(&prev.Seq, &prev.Hash); err != nil {
+		return fmt.Errorf("reading audit chain head: %w", err)
+	}
+	e = e.Chain(prev)
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO audit_events (occurred_at, category, actor, message, seq, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		e.Time, string(e.Category), e.Actor, e.Message, e.Seq, e.PrevHash, e.Hash); err != nil {
+		return fmt.Errorf("inserting audit event: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE audit_chain_head SET seq = ?, hash = ? WHERE id = 1`, e.Seq, e.Hash); err != nil {
+		return fmt.Errorf("advancing audit chain head: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing: %w", err)
+	}
+	return nil
+}
+
+// Close implements audit.Sink. The pool belongs to the application.
+func (s *AuditSink) Close() error { return nil }
+
+// VerifyAuditChain checks every row of audit_events, in insertion order,
+// with v. It also returns the recorded chain head, which should equal
+// v.Head(): rows deleted from the end leave no gap, only a head that
+// points past the last row.
+func VerifyAuditChain(ctx context.Context, db *sql.DB, v *audit.Verifier) (audit.Link, error) {
+	rows, err := db.QueryContext(ctx,
+		`SELECT occurred_at, category, actor, message, seq, prev_hash, hash
+		FROM audit_events ORDER BY id`)
+	if err != nil {
+		return audit.Link{}, fmt.Errorf("querying audit events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e audit.Event
+		var category string
+		if err := rows.Scan(&e.Time, &category, &e.Actor, &e.Message, &e.Seq, &e.PrevHash, &e.Hash); err != nil {
+			return audit.Link{}, fmt.Errorf("scanning audit event: %w", err)
+		}
+		e.Category = audit.Category(category)
+		v.Check(e)
+	}
+	if err := rows.Err(); err != nil {
+		return audit.Link{}, fmt.Errorf("iterating audit events: %w", err)
+	}
+
+	var head audit.Link
+	if err := db.QueryRowContext(ctx,
+		`SELECT seq, hash FROM audit_chain_head WHERE id = 1`).Scan(&head.Seq, &head.Hash); err != nil {
+		return audit.Link{}, fmt.Errorf("reading audit chain head: %w", err)
+	}
+	return head, nil
+}
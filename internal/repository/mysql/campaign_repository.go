@@ -0,0 +1,231 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/campaign"
+	"go-basics/internal/domain/user"
+)
+
+// campaignColumns are the columns scanned by scanCampaign, in order.
+const campaignColumns = `id, subject, body, segment_created_from, segment_created_to, segment_role,
+	segment_active_since, segment_inactive_since, status, created_by, created_at, started_at, ended_at,
+	cursor_pos, sent, failed, skipped`
+
+// CampaignRepository implements campaign.Repository for MySQL, in the
+// main database (the directory in sharded mode).
+type CampaignRepository struct {
+	db     *sql.DB // For SaveBatch's own transaction; batches run outside requests
+	scoped dbtx
+}
+
+// NewCampaignRepository creates a new campaign repository.
+func NewCampaignRepository(db *sql.DB) campaign.Repository {
+	return &CampaignRepository{db: db, scoped: scoped(db)}
+}
+
+// Create inserts c and sets its ID.
+func (r *CampaignRepository) Create(ctx context.Context, c *campaign.Campaign) error {
+	seg := c.Segment
+	result, err := r.scoped.ExecContext(ctx, `
+		INSERT INTO campaigns (subject, body, segment_created_from, segment_created_to, segment_role,
+			segment_active_since, segment_inactive_since, status, created_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, c.Subject, c.Body, nullTime(seg.CreatedFrom), nullTime(seg.CreatedTo), string(seg.Role),
+		nullTime(seg.ActiveSince), nullTime(seg.InactiveSince), string(c.Status), c.CreatedBy, c.CreatedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("inserting campaign: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	c.ID = uint64(id)
+	return nil
+}
+
+// Campaign returns the campaign with id, or campaign.ErrNotFound.
+func (r *CampaignRepository) Campaign(ctx context.Context, id uint64) (*campaign.Campaign, error) {
+	c, err := scanCampaign(r.scoped.QueryRowContext(ctx,
+		`SELECT `+campaignColumns+` FROM campaigns WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, campaign.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying campaign: %w", err)
+	}
+	return c, nil
+}
+
+// Campaigns returns the newest campaigns, by the primary key.
+func (r *CampaignRepository) Campaigns(ctx context.Context, limit int) ([]campaign.Campaign, error) {
+	rows, err := r.scoped.QueryContext(ctx,
+		`SELECT `+campaignColumns+` FROM campaigns ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	var campaigns []campaign.Campaign
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning campaign: %w", err)
+		}
+		campaigns = append(campaigns, *c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// SaveBatch stores the deliveries and the campaign's progress in one
+// transaction.
+//
+// Deliveries are inserted one by one with INSERT IGNORE, so the counts
+// only grow by the rows that were new: a user already recorded (by a
+// batch that sent and then failed to save its cursor) isn't counted
+// twice. MySQL applies SET assignments left to right, so ended_at is
+// decided on the status before it's changed.
+func (r *CampaignRepository) SaveBatch(ctx context.Context, c *campaign.Campaign, from string, deliveries []campaign.Delivery) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	// Rollback after Commit is a no-op.
+	defer tx.Rollback()
+
+	counts := make(map[campaign.DeliveryStatus]int)
+	for _, d := range deliveries {
+		result, err := tx.ExecContext(ctx, `
+			INSERT IGNORE INTO campaign_deliveries (campaign_id, user_id, email, status, error, delivered_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+		`, c.ID, d.UserID, d.Email, string(d.Status), d.Error, d.At.UTC())
+		if err != nil {
+			return fmt.Errorf("inserting delivery: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("getting rows affected: %w", err)
+		}
+		counts[d.Status] += int(affected)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE campaigns
+		SET cursor_pos = ?,
+			sent = sent + ?, failed = failed + ?, skipped = skipped + ?,
+			started_at = COALESCE(started_at, ?),
+			ended_at = IF(status = 'canceled', ended_at, ?),
+			status = IF(status = 'canceled', status, ?)
+		WHERE id = ? AND cursor_pos = ?
+	`, c.Cursor, counts[campaign.DeliverySent], counts[campaign.DeliveryFailed], counts[campaign.DeliverySkipped],
+		nullTimePtr(c.StartedAt), nullTimePtr(c.EndedAt), string(c.Status), c.ID, from)
+	if err != nil {
+		return fmt.Errorf("saving campaign progress: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return campaign.ErrConflict
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing: %w", err)
+	}
+	return nil
+}
+
+// Cancel cancels a campaign that hasn't finished.
+func (r *CampaignRepository) Cancel(ctx context.Context, id uint64, at time.Time) (bool, error) {
+	result, err := r.scoped.ExecContext(ctx, `
+		UPDATE campaigns
+		SET status = 'canceled', ended_at = ?
+		WHERE id = ? AND status IN ('queued', 'sending')
+	`, at.UTC(), id)
+	if err != nil {
+		return false, fmt.Errorf("canceling campaign: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// Deliveries returns a page of the campaign's deliveries. Paging by
+// user_id, the second column of both indexes, keeps every page as cheap
+// as the first, with or without the status filter.
+func (r *CampaignRepository) Deliveries(ctx context.Context, id uint64, status campaign.DeliveryStatus, afterUserID uint64, limit int) ([]campaign.Delivery, error) {
+	query := `SELECT campaign_id, user_id, email, status, error, delivered_at
+		FROM campaign_deliveries WHERE campaign_id = ? AND user_id > ?`
+	args := []interface{}{id, afterUserID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, string(status))
+	}
+	query += ` ORDER BY user_id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := r.scoped.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []campaign.Delivery
+	for rows.Next() {
+		var d campaign.Delivery
+		var status string
+		if err := rows.Scan(&d.CampaignID, &d.UserID, &d.Email, &status, &d.Error, &d.At); err != nil {
+			return nil, fmt.Errorf("scanning delivery: %w", err)
+		}
+		d.Status = campaign.DeliveryStatus(status)
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// scanCampaign reads one row of campaignColumns.
+func scanCampaign(row interface{ Scan(...interface{}) error }) (*campaign.Campaign, error) {
+	var c campaign.Campaign
+	var role, status string
+	var createdFrom, createdTo, activeSince, inactiveSince, started, ended sql.NullTime
+	if err := row.Scan(&c.ID, &c.Subject, &c.Body, &createdFrom, &createdTo, &role,
+		&activeSince, &inactiveSince, &status, &c.CreatedBy, &c.CreatedAt, &started, &ended,
+		&c.Cursor, &c.Sent, &c.Failed, &c.Skipped); err != nil {
+		return nil, err
+	}
+	c.Segment = campaign.Segment{
+		CreatedFrom:   createdFrom.Time,
+		CreatedTo:     createdTo.Time,
+		Role:          user.Role(role),
+		ActiveSince:   activeSince.Time,
+		InactiveSince: inactiveSince.Time,
+	}
+	c.Status = campaign.Status(status)
+	if started.Valid {
+		c.StartedAt = &started.Time
+	}
+	if ended.Valid {
+		c.EndedAt = &ended.Time
+	}
+	return &c, nil
+}
+
+// nullTimePtr stores a nil time as NULL.
+func nullTimePtr(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+
+	"go-basics/internal/domain/user"
+)
+
+// userColumn describes one selectable column of the users table.
+type userColumn struct {
+	field  user.Field
+	column string
+
+	// dest returns a pointer to the row field that receives the value.
+	// The pointer is passed to Scan, which writes the column value into it.
+	dest func(r *userRow) interface{}
+}
+
+// userColumns lists every column a query may select, in the default order.
+//
+// SAFE QUERY BUILDING:
+// Column names can't be passed as ? placeholders - placeholders only work
+// for values. So projections have to be built into the SQL string.
+// To keep that safe, callers never supply column names directly:
+// they pass user.Field values, which are looked up in this whitelist.
+// Anything not in the list is rejected before it gets near the query.
+var userColumns = []userColumn{
+	{user.FieldID, "id", func(r *userRow) interface{} { return &r.ID }},
+	{user.FieldULID, "ulid", func(r *userRow) interface{} { return &r.ULID }},
+	{user.FieldEmail, "email", func(r *userRow) interface{} { return &r.Email }},
+	{user.FieldUsername, "username", func(r *userRow) interface{} { return &r.Username }},
+	{user.FieldPendingEmail, "pending_email", func(r *userRow) interface{} { return &r.PendingEmail }},
+	{user.FieldEmailVerified, "email_verified_at", func(r *userRow) interface{} { return &r.EmailVerifiedAt }},
+	{user.FieldAvatarURL, "avatar_url", func(r *userRow) interface{} { return &r.AvatarURL }},
+	{user.FieldActive, "is_active", func(r *userRow) interface{} { return &r.IsActive }},
+	{user.FieldPasswordHash, "password_hash", func(r *userRow) interface{} { return &r.PasswordHash }},
+	{user.FieldTokenVersion, "token_version", func(r *userRow) interface{} { return &r.TokenVersion }},
+	{user.FieldCreatedAt, "created_at", func(r *userRow) interface{} { return &r.CreatedAt }},
+	{user.FieldUpdatedAt, "updated_at", func(r *userRow) interface{} { return &r.UpdatedAt }},
+	{user.FieldDeletedAt, "deleted_at", func(r *userRow) interface{} { return &r.DeletedAt }},
+	{user.FieldMFASecret, "mfa_secret", func(r *userRow) interface{} { return &r.MFASecret }},
+	{user.FieldMFAEnabled, "mfa_enabled_at", func(r *userRow) interface{} { return &r.MFAEnabledAt }},
+}
+
+// projection is a validated list of columns plus matching scan targets.
+type projection struct {
+	columns []userColumn
+}
+
+// newProjection builds a projection for the requested fields.
+// No fields means all columns, in table order.
+func newProjection(fields []user.Field) (projection, error) {
+	if len(fields) == 0 {
+		return projection{columns: userColumns}, nil
+	}
+
+	// Keep table order regardless of the order fields were requested in,
+	// and silently drop duplicates.
+	wanted := make(map[user.Field]bool, len(fields))
+	for _, f := range fields {
+		wanted[f] = true
+	}
+
+	var p projection
+	for _, c := range userColumns {
+		if wanted[c.field] {
+			p.columns = append(p.columns, c)
+			delete(wanted, c.field)
+		}
+	}
+	for f := range wanted {
+		return projection{}, fmt.Errorf("unknown user field %q", f)
+	}
+	return p, nil
+}
+
+// selectList returns the comma-separated column list for a SELECT clause.
+func (p projection) selectList() string {
+	names := make([]string, len(p.columns))
+	for i, c := range p.columns {
+		names[i] = c.column
+	}
+	return strings.Join(names, ", ")
+}
+
+// scanDest returns the Scan arguments for r, in SELECT order.
+func (p projection) scanDest(r *userRow) []interface{} {
+	dest := make([]interface{}, len(p.columns))
+	for i, c := range p.columns {
+		dest[i] = c.dest(r)
+	}
+	return dest
+}
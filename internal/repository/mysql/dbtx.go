@@ -0,0 +1,106 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"go-basics/internal/encryption"
+	"go-basics/internal/timing"
+	"go-basics/internal/txn"
+)
+
+// dbtx is the subset of *sql.DB the repositories use to run queries.
+//
+// *sql.DB and *sql.Tx both satisfy it, and so do decorators like the
+// index advisor's sampler. Repositories depend on this interface instead
+// of *sql.DB so queries can be instrumented without changing any SQL.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scopedDB is a dbtx that joins the request transaction when there is one.
+//
+// Each query checks its context for a txn.Scope (set by txn.Middleware).
+// With a scope, the query runs in the scope's transaction on this
+// database; without one, it runs on the pool as usual. Repositories
+// don't need to know which: they just pass ctx along, as they always have.
+//
+// Each query (and beginning the transaction) also counts towards the
+// request's "repo" Server-Timing span, if it asked for one.
+type scopedDB struct {
+	db *sql.DB
+}
+
+// scoped wraps db so queries join the request transaction, if any.
+func scoped(db *sql.DB) dbtx {
+	return scopedDB{db: db}
+}
+
+// conn returns the transaction from ctx's scope, or the pool.
+func (s scopedDB) conn(ctx context.Context) (dbtx, error) {
+	scope := txn.FromContext(ctx)
+	if scope == nil {
+		return s.db, nil
+	}
+	return scope.Tx(ctx, s.db)
+}
+
+func (s scopedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer timing.Start(ctx, timing.Repo)()
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.ExecContext(ctx, query, args...)
+}
+
+func (s scopedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer timing.Start(ctx, timing.Repo)()
+	c, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.QueryContext(ctx, query, args...)
+}
+
+// QueryRowContext can't return an error directly; *sql.Row reports it
+// from Scan. Beginning the transaction rarely fails, so in that case we
+// fall back to the pool, where the query fails the same way (no database)
+// or succeeds outside the transaction - which is fine for a read.
+func (s scopedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer timing.Start(ctx, timing.Repo)()
+	c, err := s.conn(ctx)
+	if err != nil {
+		return s.db.QueryRowContext(ctx, query, args...)
+	}
+	return c.QueryRowContext(ctx, query, args...)
+}
+
+// RepositoryOption configures optional UserRepository behavior.
+type RepositoryOption func(*UserRepository)
+
+// WithSecretCipher sets the key used to encrypt MFA secrets at rest.
+// Without it, reading or writing a user with an MFA secret fails.
+func WithSecretCipher(c *encryption.Cipher) RepositoryOption {
+	return func(r *UserRepository) {
+		r.secrets = c
+	}
+}
+
+// WithIndexAdvisor samples the repository's queries with EXPLAIN
+// and warns about full table scans (see IndexAdvisor).
+func WithIndexAdvisor(advisor *IndexAdvisor) RepositoryOption {
+	return func(r *UserRepository) {
+		r.db = advisor.wrap(r.db)
+	}
+}
+
+// WithSlowQueryLog logs the repository's queries that take longer than
+// the log's threshold (see SlowQueryLog).
+func WithSlowQueryLog(l *SlowQueryLog) RepositoryOption {
+	return func(r *UserRepository) {
+		r.db = l.wrap(r.db)
+	}
+}
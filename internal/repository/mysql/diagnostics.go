@@ -0,0 +1,179 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"go-basics/internal/domain/diagnostics"
+	"go-basics/internal/domain/user"
+)
+
+// diagnosticTimeout bounds how long a single diagnostic query may run,
+// so a bad EXPLAIN can't pile load onto a database that's already struggling.
+const diagnosticTimeout = 5 * time.Second
+
+// diagnosticQuery is one whitelisted query.
+type diagnosticQuery struct {
+	// params are the named parameters, in placeholder order.
+	params []string
+
+	// sql is the statement to run. It must be read-only.
+	sql string
+}
+
+// diagnosticQueries is the whitelist. Nothing outside this map can be run.
+//
+// The EXPLAIN entries are built from the same query builders the repository
+// uses, so they always show the plan for the SQL that actually runs.
+var diagnosticQueries = map[string]diagnosticQuery{
+	"table_sizes": {
+		sql: `
+			SELECT TABLE_NAME, TABLE_ROWS, DATA_LENGTH, INDEX_LENGTH
+			FROM information_schema.TABLES
+			WHERE TABLE_SCHEMA = DATABASE()
+			ORDER BY TABLE_NAME
+		`,
+	},
+	"users_count": {
+		sql: `
+			SELECT COUNT(*) AS total,
+			       COALESCE(SUM(deleted_at IS NULL), 0) AS active,
+			       COALESCE(SUM(deleted_at IS NOT NULL), 0) AS deleted
+			FROM users
+		`,
+	},
+	"index_stats": {
+		params: []string{"table"},
+		sql: `
+			SELECT INDEX_NAME, SEQ_IN_INDEX, COLUMN_NAME, CARDINALITY, NON_UNIQUE
+			FROM information_schema.STATISTICS
+			WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+			ORDER BY INDEX_NAME, SEQ_IN_INDEX
+		`,
+	},
+	"explain_find_by_id": {
+		params: []string{"id"},
+		sql:    "EXPLAIN " + findByIDQuery(projection{columns: userColumns}),
+	},
+	"explain_find_by_email": {
+		params: []string{"email"},
+		sql:    "EXPLAIN " + findByEmailQuery(projection{columns: userColumns}),
+	},
+	"explain_list": {
+		params: []string{"limit"},
+		sql:    "EXPLAIN " + explainListQuery(user.ListParams{}),
+	},
+	"explain_list_after": {
+		params: []string{"created_at", "id", "limit"},
+		sql:    "EXPLAIN " + explainListQuery(user.ListParams{After: &user.Cursor{}}),
+	},
+}
+
+// explainListQuery returns the SQL List runs for params, unfiltered and
+// in the default order, whose only arguments are the cursor's and the
+// limit.
+func explainListQuery(params user.ListParams) string {
+	query, _, err := listQuery(projection{columns: userColumns}, params)
+	if err != nil {
+		// The default order is always in sortColumns.
+		panic(err)
+	}
+	return query
+}
+
+// Diagnostics runs whitelisted read-only queries against the database.
+// It implements diagnostics.Runner.
+type Diagnostics struct {
+	db *sql.DB
+}
+
+// NewDiagnostics creates a diagnostics runner.
+func NewDiagnostics(db *sql.DB) diagnostics.Runner {
+	return &Diagnostics{db: db}
+}
+
+// Queries returns the whitelisted query names in alphabetical order.
+func (d *Diagnostics) Queries() []string {
+	names := make([]string, 0, len(diagnosticQueries))
+	for name := range diagnosticQueries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run executes a whitelisted query inside a READ ONLY transaction.
+//
+// The read-only transaction is a second line of defense: even if a
+// writing statement ever slipped into the whitelist, MySQL would refuse it.
+func (d *Diagnostics) Run(ctx context.Context, name string, params map[string]string) (*diagnostics.Result, error) {
+	q, ok := diagnosticQueries[name]
+	if !ok {
+		return nil, diagnostics.ErrUnknownQuery
+	}
+
+	// Every declared parameter is required and nothing else is accepted.
+	if len(params) != len(q.params) {
+		return nil, fmt.Errorf("%w: %s expects %v", diagnostics.ErrInvalidParams, name, q.params)
+	}
+	args := make([]interface{}, len(q.params))
+	for i, p := range q.params {
+		value, ok := params[p]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s expects %v", diagnostics.ErrInvalidParams, name, q.params)
+		}
+		args[i] = value
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, diagnosticTimeout)
+	defer cancel()
+
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("starting read-only transaction: %w", err)
+	}
+	// Rollback is fine for a read-only transaction; there's nothing to commit.
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, q.sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("running %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("reading columns: %w", err)
+	}
+
+	result := &diagnostics.Result{Query: name, Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		// We don't know the column types ahead of time, so scan into
+		// interface{} values and let the driver pick the Go type.
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("scanning row: %w", err)
+		}
+
+		// The MySQL driver returns text columns as []byte, which would be
+		// JSON-encoded as base64. Convert them to strings for readability.
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		result.Rows = append(result.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating rows: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,198 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math/rand/v2"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// explainTimeout bounds each sampled EXPLAIN.
+const explainTimeout = 2 * time.Second
+
+// whereColumnRegex finds "column <op>" pairs in a WHERE clause.
+// It's a heuristic for suggesting an index, not a SQL parser.
+var whereColumnRegex = regexp.MustCompile(`(?i)\(?\b([a-z_][a-z0-9_]*)\b\)?\s*(?:=|>|<|>=|<=|\bIN\b|\bLIKE\b|\bIS\b)`)
+
+// IndexAdvisor samples repository queries with EXPLAIN and logs a
+// structured warning when a query scans a whole table.
+//
+// WHY?
+// A missing index is invisible on a laptop with 50 rows and painful in
+// production with 5 million. Running EXPLAIN on a small sample of real
+// queries in development and staging catches the regression while the
+// fix is still cheap.
+//
+// Do NOT enable this in production: every sampled query runs twice.
+type IndexAdvisor struct {
+	sampleRate   float64 // Fraction of queries to EXPLAIN (0.0-1.0)
+	rowThreshold int64   // Warn when a full scan examines at least this many rows
+	logger       *slog.Logger
+
+	warned sync.Map // query text -> struct{}; each query is reported once
+}
+
+// NewIndexAdvisor creates an advisor. Each wrapped repository runs its
+// EXPLAINs on its own database, so one advisor can serve several shards.
+func NewIndexAdvisor(sampleRate float64, rowThreshold int64) *IndexAdvisor {
+	return &IndexAdvisor{
+		sampleRate:   sampleRate,
+		rowThreshold: rowThreshold,
+		logger:       slog.Default(),
+	}
+}
+
+// wrap returns a dbtx that forwards to inner and samples SELECTs.
+func (a *IndexAdvisor) wrap(inner dbtx) dbtx {
+	return &sampledDB{inner: inner, advisor: a}
+}
+
+// maybeExplain runs EXPLAIN for a sampled SELECT on db in the background,
+// so the request that triggered it isn't slowed down.
+func (a *IndexAdvisor) maybeExplain(db dbtx, query string, args []interface{}) {
+	if !strings.HasPrefix(strings.ToUpper(strings.TrimSpace(query)), "SELECT") {
+		return
+	}
+	if _, done := a.warned.Load(query); done {
+		return
+	}
+	if rand.Float64() >= a.sampleRate {
+		return
+	}
+
+	go a.explain(db, query, args)
+}
+
+// explain runs EXPLAIN and logs a warning for full table scans.
+func (a *IndexAdvisor) explain(db dbtx, query string, args []interface{}) {
+	// The request context may already be canceled by the time we run,
+	// so use our own short deadline.
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	rows, err := db.QueryContext(ctx, "EXPLAIN "+query, args...)
+	if err != nil {
+		a.logger.Debug("index advisor: explain failed", "error", err)
+		return
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return
+	}
+
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return
+		}
+
+		plan := make(map[string]string, len(columns))
+		for i, c := range columns {
+			plan[c] = values[i].String
+		}
+
+		// type=ALL means MySQL reads every row of the table.
+		if plan["type"] != "ALL" {
+			continue
+		}
+		examined := parseRows(plan["rows"])
+		if examined < a.rowThreshold {
+			continue
+		}
+
+		// Report each query only once per process to avoid log spam.
+		if _, loaded := a.warned.LoadOrStore(query, struct{}{}); loaded {
+			return
+		}
+		a.logger.Warn("index advisor: full table scan",
+			"table", plan["table"],
+			"rows_examined", examined,
+			"possible_keys", plan["possible_keys"],
+			"suggested_index", suggestIndex(plan["table"], query),
+			"query", compactSQL(query),
+		)
+	}
+}
+
+// parseRows converts the EXPLAIN "rows" column to an integer.
+func parseRows(s string) int64 {
+	var n int64
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			break
+		}
+		n = n*10 + int64(c-'0')
+	}
+	return n
+}
+
+// suggestIndex proposes an index over the columns filtered in WHERE.
+// It names the columns in the order they appear, which is a reasonable
+// starting point; the team should still review it.
+func suggestIndex(table, query string) string {
+	upper := strings.ToUpper(query)
+	where := strings.Index(upper, "WHERE")
+	if where < 0 || table == "" {
+		return ""
+	}
+	clause := query[where+len("WHERE"):]
+	for _, stop := range []string{"ORDER BY", "GROUP BY", "LIMIT"} {
+		if i := strings.Index(strings.ToUpper(clause), stop); i >= 0 {
+			clause = clause[:i]
+		}
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	for _, m := range whereColumnRegex.FindAllStringSubmatch(clause, -1) {
+		col := strings.ToLower(m[1])
+		switch col {
+		case "and", "or", "not", "null":
+			continue
+		}
+		if !seen[col] {
+			seen[col] = true
+			columns = append(columns, col)
+		}
+	}
+	if len(columns) == 0 {
+		return ""
+	}
+	return "CREATE INDEX idx_" + table + "_" + strings.Join(columns, "_") +
+		" ON " + table + " (" + strings.Join(columns, ", ") + ")"
+}
+
+// compactSQL collapses whitespace so the query fits on one log line.
+func compactSQL(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// sampledDB forwards queries to inner and hands SELECTs to the advisor.
+type sampledDB struct {
+	inner   dbtx
+	advisor *IndexAdvisor
+}
+
+func (s *sampledDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.inner.ExecContext(ctx, query, args...)
+}
+
+func (s *sampledDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	s.advisor.maybeExplain(s.inner, query, args)
+	return s.inner.QueryContext(ctx, query, args...)
+}
+
+func (s *sampledDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	s.advisor.maybeExplain(s.inner, query, args)
+	return s.inner.QueryRowContext(ctx, query, args...)
+}
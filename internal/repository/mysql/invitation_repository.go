@@ -0,0 +1,175 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// invitationColumns are the columns scanned by scanInvitation, in order.
+const invitationColumns = `id, user_id, email, invited_by, created_at, sent_at, expires_at, accepted_at, revoked_at`
+
+// InvitationRepository implements user.InvitationRepository for MySQL.
+// Invitations live in the main database (the directory in sharded
+// mode), like the other tokens.
+type InvitationRepository struct {
+	db dbtx
+}
+
+// NewInvitationRepository creates a new invitation repository.
+func NewInvitationRepository(db *sql.DB) user.InvitationRepository {
+	return &InvitationRepository{db: scoped(db)}
+}
+
+// CreateInvitation inserts inv and sets its ID.
+func (r *InvitationRepository) CreateInvitation(ctx context.Context, inv *user.Invitation, tokenHash string) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO invitations (user_id, email, invited_by, token_hash, created_at, sent_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, inv.UserID, inv.Email, inv.InvitedBy, tokenHash, inv.CreatedAt.UTC(), inv.SentAt.UTC(), inv.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("inserting invitation: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	inv.ID = uint64(id)
+	return nil
+}
+
+// Invitation returns the invitation with id, or nil.
+func (r *InvitationRepository) Invitation(ctx context.Context, id uint64) (*user.Invitation, error) {
+	inv, err := scanInvitation(r.db.QueryRowContext(ctx,
+		`SELECT `+invitationColumns+` FROM invitations WHERE id = ?`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// Invitations returns the newest invitations, by the primary key.
+func (r *InvitationRepository) Invitations(ctx context.Context, limit int) ([]user.Invitation, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+invitationColumns+` FROM invitations ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invs []user.Invitation
+	for rows.Next() {
+		inv, err := scanInvitation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning invitation: %w", err)
+		}
+		invs = append(invs, *inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating invitations: %w", err)
+	}
+	return invs, nil
+}
+
+// RenewInvitation replaces the token of an open invitation. The
+// condition makes it atomic with an Accept or Revoke racing it.
+func (r *InvitationRepository) RenewInvitation(ctx context.Context, id uint64, tokenHash string, sentAt, expiresAt time.Time) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE invitations
+		SET token_hash = ?, sent_at = ?, expires_at = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+	`, tokenHash, sentAt.UTC(), expiresAt.UTC(), id)
+	if err != nil {
+		return fmt.Errorf("renewing invitation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return user.ErrInvitationClosed
+	}
+	return nil
+}
+
+// RevokeInvitation revokes an open invitation.
+func (r *InvitationRepository) RevokeInvitation(ctx context.Context, id uint64, at time.Time) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE invitations
+		SET revoked_at = ?
+		WHERE id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+	`, at.UTC(), id)
+	if err != nil {
+		return false, fmt.Errorf("revoking invitation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RevokeUserInvitations revokes the user's open invitations.
+func (r *InvitationRepository) RevokeUserInvitations(ctx context.Context, userID uint64, at time.Time) error {
+	if _, err := r.db.ExecContext(ctx, `
+		UPDATE invitations
+		SET revoked_at = ?
+		WHERE user_id = ? AND accepted_at IS NULL AND revoked_at IS NULL
+	`, at.UTC(), userID); err != nil {
+		return fmt.Errorf("revoking invitations: %w", err)
+	}
+	return nil
+}
+
+// AcceptInvitation marks the invitation accepted, then reads it back.
+// Like TokenRepository.Consume, the conditional UPDATE comes first, so
+// only one of two concurrent calls can succeed.
+func (r *InvitationRepository) AcceptInvitation(ctx context.Context, tokenHash string, at time.Time) (*user.Invitation, error) {
+	at = at.UTC()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE invitations
+		SET accepted_at = ?
+		WHERE token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?
+	`, at, tokenHash, at)
+	if err != nil {
+		return nil, fmt.Errorf("accepting invitation: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return nil, user.ErrInvalidInvitation
+	}
+
+	inv, err := scanInvitation(r.db.QueryRowContext(ctx,
+		`SELECT `+invitationColumns+` FROM invitations WHERE token_hash = ?`, tokenHash))
+	if err != nil {
+		return nil, fmt.Errorf("reading invitation: %w", err)
+	}
+	return inv, nil
+}
+
+// scanInvitation reads one row of invitationColumns.
+func scanInvitation(row interface{ Scan(...interface{}) error }) (*user.Invitation, error) {
+	var inv user.Invitation
+	var accepted, revoked sql.NullTime
+	if err := row.Scan(&inv.ID, &inv.UserID, &inv.Email, &inv.InvitedBy,
+		&inv.CreatedAt, &inv.SentAt, &inv.ExpiresAt, &accepted, &revoked); err != nil {
+		return nil, err
+	}
+	if accepted.Valid {
+		inv.AcceptedAt = &accepted.Time
+	}
+	if revoked.Valid {
+		inv.RevokedAt = &revoked.Time
+	}
+	return &inv, nil
+}
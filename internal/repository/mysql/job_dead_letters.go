@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go-basics/internal/jobs"
+)
+
+// JobDeadLetters implements jobs.DeadLetterStore with the
+// job_dead_letters table in the main database (the directory in sharded
+// mode).
+type JobDeadLetters struct {
+	db *sql.DB
+}
+
+// NewJobDeadLetters creates a dead-letter store.
+func NewJobDeadLetters(db *sql.DB) jobs.DeadLetterStore {
+	return &JobDeadLetters{db: db}
+}
+
+// Add inserts a failed job.
+func (s *JobDeadLetters) Add(ctx context.Context, job jobs.Job) error {
+	trace, err := encodeErrorTrace(job.Errors)
+	if err != nil {
+		return err
+	}
+	if trace == nil {
+		trace = "[]" // The column is NOT NULL: every dead letter has failed
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO job_dead_letters (kind, payload, attempts, error_trace) VALUES (?, ?, ?, ?)`,
+		job.Kind, job.Payload, job.Attempts, trace)
+	if err != nil {
+		return fmt.Errorf("inserting dead letter: %w", err)
+	}
+	return nil
+}
+
+// List returns the newest dead letters.
+func (s *JobDeadLetters) List(ctx context.Context, limit int) ([]jobs.DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, kind, payload, attempts, error_trace, failed_at
+		FROM job_dead_letters ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying dead letters: %w", err)
+	}
+	defer rows.Close()
+
+	var letters []jobs.DeadLetter
+	for rows.Next() {
+		letter, err := scanDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, *letter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating dead letters: %w", err)
+	}
+	return letters, nil
+}
+
+// Get returns one dead letter.
+func (s *JobDeadLetters) Get(ctx context.Context, id uint64) (*jobs.DeadLetter, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT id, kind, payload, attempts, error_trace, failed_at
+		FROM job_dead_letters WHERE id = ?`, id)
+	return scanDeadLetter(row)
+}
+
+// Take reads and deletes one dead letter in a transaction. The row lock
+// from FOR UPDATE makes a concurrent Take wait, then find nothing.
+func (s *JobDeadLetters) Take(ctx context.Context, id uint64) (*jobs.DeadLetter, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	// Rollback after Commit is a no-op.
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx,
+		`SELECT id, kind, payload, attempts, error_trace, failed_at
+		FROM job_dead_letters WHERE id = ? FOR UPDATE`, id)
+	letter, err := scanDeadLetter(row)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM job_dead_letters WHERE id = ?`, id); err != nil {
+		return nil, fmt.Errorf("deleting dead letter: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing: %w", err)
+	}
+	return letter, nil
+}
+
+// Count returns the number of dead letters.
+func (s *JobDeadLetters) Count(ctx context.Context) (int, error) {
+	var n int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM job_dead_letters`).Scan(&n); err != nil {
+		return 0, fmt.Errorf("counting dead letters: %w", err)
+	}
+	return n, nil
+}
+
+// scanDeadLetter reads one job_dead_letters row.
+func scanDeadLetter(row interface{ Scan(...interface{}) error }) (*jobs.DeadLetter, error) {
+	var letter jobs.DeadLetter
+	var trace string
+	err := row.Scan(&letter.ID, &letter.Kind, &letter.Payload, &letter.Attempts, &trace, &letter.FailedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, jobs.ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scanning dead letter: %w", err)
+	}
+	if letter.Errors, err = decodeErrorTrace(trace); err != nil {
+		return nil, err
+	}
+	return &letter, nil
+}
@@ -0,0 +1,163 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+
+	"go-basics/internal/jobs"
+)
+
+// errDuplicateEntry is MySQL's error number for a unique key violation.
+const errDuplicateEntry = 1062
+
+// JobSchedules implements jobs.ScheduleStore with the scheduled_jobs
+// table in the main database (the directory in sharded mode).
+type JobSchedules struct {
+	db *sql.DB
+}
+
+// NewJobSchedules creates a schedule store.
+func NewJobSchedules(db *sql.DB) jobs.ScheduleStore {
+	return &JobSchedules{db: db}
+}
+
+// Add inserts a schedule. The unique index on unique_key enforces
+// uniqueness, so two instances adding the same key at once can't both
+// succeed; NULL keys don't collide.
+func (s *JobSchedules) Add(ctx context.Context, sched jobs.Schedule) (uint64, error) {
+	var key sql.NullString
+	if sched.UniqueKey != "" {
+		key = sql.NullString{String: sched.UniqueKey, Valid: true}
+	}
+	result, err := s.db.ExecContext(ctx,
+		`INSERT INTO scheduled_jobs (kind, payload, unique_key, run_at, every_seconds) VALUES (?, ?, ?, ?, ?)`,
+		sched.Kind, sched.Payload, key, sched.RunAt, int64(sched.Every/time.Second))
+	var mysqlErr *mysqldriver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == errDuplicateEntry {
+		return 0, jobs.ErrDuplicateSchedule
+	}
+	if err != nil {
+		return 0, fmt.Errorf("inserting scheduled job: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("reading scheduled job ID: %w", err)
+	}
+	return uint64(id), nil
+}
+
+// Cancel deletes the schedule with the unique key.
+func (s *JobSchedules) Cancel(ctx context.Context, uniqueKey string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM scheduled_jobs WHERE unique_key = ?`, uniqueKey)
+	if err != nil {
+		return fmt.Errorf("deleting scheduled job: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("checking deleted scheduled job: %w", err)
+	}
+	if n == 0 {
+		return jobs.ErrScheduleNotFound
+	}
+	return nil
+}
+
+// List returns the soonest schedules.
+func (s *JobSchedules) List(ctx context.Context, limit int) ([]jobs.Schedule, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, kind, payload, unique_key, run_at, every_seconds
+		FROM scheduled_jobs ORDER BY run_at, id LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying scheduled jobs: %w", err)
+	}
+	defer rows.Close()
+	return scanSchedules(rows)
+}
+
+// Claim dispatches due schedules in one transaction.
+//
+// Like JobSpool.Take, FOR UPDATE SKIP LOCKED keeps two concurrent Claims
+// (a leader and one that doesn't know it was replaced yet) from
+// dispatching the same row. The rows dispatched before a dispatch error
+// are still updated, so they aren't dispatched twice.
+func (s *JobSchedules) Claim(ctx context.Context, now time.Time, limit int, dispatch func(jobs.Schedule) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("starting transaction: %w", err)
+	}
+	// Rollback after Commit is a no-op.
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, kind, payload, unique_key, run_at, every_seconds
+		FROM scheduled_jobs WHERE run_at <= ? ORDER BY run_at, id LIMIT ? FOR UPDATE SKIP LOCKED`, now, limit)
+	if err != nil {
+		return 0, fmt.Errorf("querying due jobs: %w", err)
+	}
+	due, err := scanSchedules(rows)
+	rows.Close()
+	if err != nil {
+		return 0, err
+	}
+
+	dispatched := 0
+	var dispatchErr error
+	for _, sched := range due {
+		if dispatchErr = dispatch(sched); dispatchErr != nil {
+			break
+		}
+		if err := s.advance(ctx, tx, sched, now); err != nil {
+			return 0, err
+		}
+		dispatched++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("committing: %w", err)
+	}
+	return dispatched, dispatchErr
+}
+
+// advance deletes a dispatched one-off, or moves a recurring schedule to
+// its next run. A schedule that fell behind (the scheduler was down)
+// runs once to catch up, not once for every run it missed.
+func (s *JobSchedules) advance(ctx context.Context, tx *sql.Tx, sched jobs.Schedule, now time.Time) error {
+	if sched.Every == 0 {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM scheduled_jobs WHERE id = ?`, sched.ID); err != nil {
+			return fmt.Errorf("deleting dispatched job: %w", err)
+		}
+		return nil
+	}
+	next := sched.RunAt.Add(sched.Every)
+	if !next.After(now) {
+		next = now.Add(sched.Every)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE scheduled_jobs SET run_at = ? WHERE id = ?`, next, sched.ID); err != nil {
+		return fmt.Errorf("rescheduling recurring job: %w", err)
+	}
+	return nil
+}
+
+// scanSchedules reads scheduled_jobs rows.
+func scanSchedules(rows *sql.Rows) ([]jobs.Schedule, error) {
+	var schedules []jobs.Schedule
+	for rows.Next() {
+		var sched jobs.Schedule
+		var key sql.NullString
+		var everySeconds int64
+		if err := rows.Scan(&sched.ID, &sched.Kind, &sched.Payload, &key, &sched.RunAt, &everySeconds); err != nil {
+			return nil, fmt.Errorf("scanning scheduled job: %w", err)
+		}
+		sched.UniqueKey = key.String
+		sched.Every = time.Duration(everySeconds) * time.Second
+		schedules = append(schedules, sched)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating scheduled jobs: %w", err)
+	}
+	return schedules, nil
+}
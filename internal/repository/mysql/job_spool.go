@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"go-basics/internal/jobs"
+)
+
+// JobSpool implements jobs.Spool with the job_spool table in the main
+// database (the directory in sharded mode).
+type JobSpool struct {
+	db *sql.DB
+}
+
+// NewJobSpool creates a job spool.
+func NewJobSpool(db *sql.DB) jobs.Spool {
+	return &JobSpool{db: db}
+}
+
+// Save inserts the jobs in one statement.
+func (s *JobSpool) Save(ctx context.Context, saved []jobs.Job) error {
+	if len(saved) == 0 {
+		return nil
+	}
+	args := make([]interface{}, 0, 4*len(saved))
+	for _, job := range saved {
+		trace, err := encodeErrorTrace(job.Errors)
+		if err != nil {
+			return err
+		}
+		args = append(args, job.Kind, job.Payload, job.Attempts, trace)
+	}
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?), ", len(saved)), ", ")
+	if _, err := s.db.ExecContext(ctx, `INSERT INTO job_spool (kind, payload, attempts, error_trace) VALUES `+values, args...); err != nil {
+		return fmt.Errorf("inserting spooled jobs: %w", err)
+	}
+	return nil
+}
+
+// Take reads and deletes the spooled jobs in one transaction.
+//
+// FOR UPDATE SKIP LOCKED makes concurrent Takes split the rows instead of
+// both reading them: each locks the rows it reads, and skips (rather than
+// waits for) rows another transaction has locked.
+func (s *JobSpool) Take(ctx context.Context) ([]jobs.Job, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	// Rollback after Commit is a no-op.
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, kind, payload, attempts, error_trace FROM job_spool ORDER BY id FOR UPDATE SKIP LOCKED`)
+	if err != nil {
+		return nil, fmt.Errorf("querying spooled jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var taken []jobs.Job
+	var ids []interface{}
+	for rows.Next() {
+		var id uint64
+		var job jobs.Job
+		var trace sql.NullString
+		if err := rows.Scan(&id, &job.Kind, &job.Payload, &job.Attempts, &trace); err != nil {
+			return nil, fmt.Errorf("scanning spooled job: %w", err)
+		}
+		if job.Errors, err = decodeErrorTrace(trace.String); err != nil {
+			return nil, err
+		}
+		taken = append(taken, job)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating spooled jobs: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	if _, err := tx.ExecContext(ctx, `DELETE FROM job_spool WHERE id IN (`+in+`)`, ids...); err != nil {
+		return nil, fmt.Errorf("deleting spooled jobs: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing: %w", err)
+	}
+	return taken, nil
+}
+
+// encodeErrorTrace stores a job's errors as a JSON array.
+// A job that hasn't failed is stored as NULL.
+func encodeErrorTrace(errs []string) (interface{}, error) {
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(errs)
+	if err != nil {
+		return nil, fmt.Errorf("encoding error trace: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeErrorTrace reads what encodeErrorTrace stored.
+func decodeErrorTrace(trace string) ([]string, error) {
+	if trace == "" {
+		return nil, nil
+	}
+	var errs []string
+	if err := json.Unmarshal([]byte(trace), &errs); err != nil {
+		return nil, fmt.Errorf("decoding error trace: %w", err)
+	}
+	return errs, nil
+}
@@ -0,0 +1,66 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-basics/internal/risk"
+)
+
+// maxLoginCountries bounds the countries read per user. Someone who
+// signed in from more than this many has no anomaly to detect.
+const maxLoginCountries = 50
+
+// LoginCountryRepository implements risk.CountryStore for MySQL.
+// Countries live in the main database (the directory in sharded mode),
+// next to sessions.
+type LoginCountryRepository struct {
+	db *sql.DB
+}
+
+// NewLoginCountryRepository creates a new login country repository.
+func NewLoginCountryRepository(db *sql.DB) risk.CountryStore {
+	return &LoginCountryRepository{db: db}
+}
+
+// Countries returns the user's countries, most recently seen first.
+func (r *LoginCountryRepository) Countries(ctx context.Context, userID uint64) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT country FROM login_countries
+		WHERE user_id = ?
+		ORDER BY last_seen_at DESC
+		LIMIT ?
+	`, userID, maxLoginCountries)
+	if err != nil {
+		return nil, fmt.Errorf("querying login countries: %w", err)
+	}
+	defer rows.Close()
+
+	var countries []string
+	for rows.Next() {
+		var country string
+		if err := rows.Scan(&country); err != nil {
+			return nil, fmt.Errorf("scanning login country: %w", err)
+		}
+		countries = append(countries, country)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating login countries: %w", err)
+	}
+	return countries, nil
+}
+
+// RecordCountry inserts the country, or moves its last_seen_at.
+func (r *LoginCountryRepository) RecordCountry(ctx context.Context, userID uint64, country string) error {
+	now := time.Now().UTC()
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO login_countries (user_id, country, first_seen_at, last_seen_at)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE last_seen_at = VALUES(last_seen_at)`, userID, country, now, now)
+	if err != nil {
+		return fmt.Errorf("recording login country: %w", err)
+	}
+	return nil
+}
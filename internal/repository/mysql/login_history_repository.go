@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go-basics/internal/domain/user"
+)
+
+// LoginHistoryRepository implements user.LoginHistoryRepository for
+// MySQL. Logins live in the main database (the directory in sharded
+// mode), next to sessions.
+type LoginHistoryRepository struct {
+	db dbtx
+}
+
+// NewLoginHistoryRepository creates a new login history repository.
+func NewLoginHistoryRepository(db *sql.DB) user.LoginHistoryRepository {
+	return &LoginHistoryRepository{db: scoped(db)}
+}
+
+// Record inserts the login, then deletes the user's logins older than
+// the keep most recent.
+//
+// The subquery finds the newest login past the ones kept. It's wrapped
+// in a derived table because MySQL won't DELETE from a table a plain
+// subquery reads; with fewer logins it's NULL, and nothing matches.
+func (r *LoginHistoryRepository) Record(ctx context.Context, login *user.Login, keep int) error {
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO login_history (user_id, user_agent, ip_address, created_at)
+		VALUES (?, ?, ?, ?)
+	`, login.UserID, login.UserAgent, login.IPAddress, login.At.UTC())
+	if err != nil {
+		return fmt.Errorf("inserting login: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	login.ID = uint64(id)
+
+	if _, err := r.db.ExecContext(ctx, `
+		DELETE FROM login_history
+		WHERE user_id = ? AND id <= (
+			SELECT id FROM (
+				SELECT id FROM login_history WHERE user_id = ? ORDER BY id DESC LIMIT 1 OFFSET ?
+			) AS oldest
+		)
+	`, login.UserID, login.UserID, keep); err != nil {
+		return fmt.Errorf("deleting old logins: %w", err)
+	}
+	return nil
+}
+
+// ListForUser returns the user's most recent logins. IDs grow with
+// time, so ordering by id is ordering by created_at, and InnoDB's user_id
+// index holds the primary key: no sort is needed.
+func (r *LoginHistoryRepository) ListForUser(ctx context.Context, userID uint64, limit int) ([]*user.Login, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, user_id, user_agent, ip_address, created_at
+		FROM login_history
+		WHERE user_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying logins: %w", err)
+	}
+	defer rows.Close()
+
+	var logins []*user.Login
+	for rows.Next() {
+		var l user.Login
+		if err := rows.Scan(&l.ID, &l.UserID, &l.UserAgent, &l.IPAddress, &l.At); err != nil {
+			return nil, fmt.Errorf("scanning login: %w", err)
+		}
+		logins = append(logins, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating logins: %w", err)
+	}
+	return logins, nil
+}
+
+// DeleteForUser removes all of the user's logins.
+func (r *LoginHistoryRepository) DeleteForUser(ctx context.Context, userID uint64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM login_history WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("deleting logins: %w", err)
+	}
+	return nil
+}
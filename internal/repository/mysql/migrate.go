@@ -0,0 +1,240 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockName is the MySQL advisory lock held while migrating.
+// GET_LOCK names are server-wide, so the name includes the application.
+const migrationLockName = "go-basics.migrate"
+
+// ErrMigrationLockTimeout is returned when another instance held the
+// migration lock for longer than the lock timeout.
+var ErrMigrationLockTimeout = errors.New("timed out waiting for the migration lock")
+
+// migration is one *.up.sql file.
+type migration struct {
+	version uint64 // The timestamp prefix, e.g. 20260119093000
+	name    string // The file name, for logs
+}
+
+// Migrate applies every migration in files that the database hasn't seen
+// yet, in version order, and records each in the schema_migrations table.
+//
+// WHY AN ADVISORY LOCK?
+// When several replicas boot at once (a rolling deploy, an autoscaler),
+// each would see the same pending migrations and run them concurrently:
+// one CREATE TABLE succeeds and the others fail, or worse, a data
+// migration runs twice. GET_LOCK is a named mutex held by one MySQL
+// session. The first instance takes it and migrates; the others block in
+// GET_LOCK until it's released, then find nothing left to do.
+//
+// The lock belongs to a session (connection), not to the pool, so every
+// statement runs on one dedicated *sql.Conn. If the migrating instance
+// crashes, MySQL drops its session and the lock with it.
+//
+// MySQL commits DDL implicitly, so migrations can't run in a transaction.
+// A migration that fails halfway stays half-applied and unrecorded;
+// fix the database by hand before retrying.
+func Migrate(ctx context.Context, db *sql.DB, files fs.FS, lockTimeout time.Duration) error {
+	pending, err := readMigrations(files)
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("reserving migration connection: %w", err)
+	}
+	defer conn.Close()
+
+	release, err := acquireMigrationLock(ctx, conn, lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Read what's applied only after taking the lock: another instance
+	// may have just finished the migrations this one was waiting on.
+	applied, err := appliedMigrations(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	count := 0
+	for _, m := range pending {
+		if applied[m.version] {
+			continue
+		}
+		if err := applyMigration(ctx, conn, files, m); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count == 0 {
+		log.Println("Migrations: database is up to date")
+	} else {
+		log.Printf("Migrations: applied %d migration(s)", count)
+	}
+	return nil
+}
+
+// acquireMigrationLock blocks until this session holds the migration lock
+// or timeout passes. The returned func releases it.
+func acquireMigrationLock(ctx context.Context, conn *sql.Conn, timeout time.Duration) (func(), error) {
+	log.Printf("Migrations: waiting for lock %q (timeout %v)", migrationLockName, timeout)
+	start := time.Now()
+
+	// GET_LOCK returns 1 when acquired, 0 on timeout, NULL on error
+	// (e.g. the session was killed). The timeout is in whole seconds.
+	var got sql.NullInt64
+	seconds := int(timeout.Round(time.Second) / time.Second)
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationLockName, seconds).Scan(&got); err != nil {
+		return nil, fmt.Errorf("acquiring migration lock: %w", err)
+	}
+	switch {
+	case !got.Valid:
+		return nil, fmt.Errorf("acquiring migration lock: GET_LOCK returned NULL")
+	case got.Int64 != 1:
+		return nil, fmt.Errorf("%w %q after %v", ErrMigrationLockTimeout, migrationLockName, timeout)
+	}
+	log.Printf("Migrations: lock acquired after %v", time.Since(start).Round(time.Millisecond))
+
+	return func() {
+		// Use a fresh context: the lock must be released even if ctx
+		// was cancelled mid-migration. Closing the connection would
+		// release it too, but the pool may keep the connection open.
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := conn.ExecContext(releaseCtx, "DO RELEASE_LOCK(?)", migrationLockName); err != nil {
+			log.Printf("Migrations: releasing lock: %v", err)
+		}
+	}, nil
+}
+
+// appliedMigrations creates schema_migrations if needed and returns the
+// versions already recorded in it.
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[uint64]bool, error) {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT UNSIGNED NOT NULL PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[uint64]bool)
+	for rows.Next() {
+		var version uint64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration runs one migration's statements and records its version.
+func applyMigration(ctx context.Context, conn *sql.Conn, files fs.FS, m migration) error {
+	data, err := fs.ReadFile(files, m.name)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", m.name, err)
+	}
+
+	start := time.Now()
+	for i, stmt := range splitStatements(string(data)) {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("applying %s (statement %d): %w", m.name, i+1, err)
+		}
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", m.version); err != nil {
+		return fmt.Errorf("recording %s: %w", m.name, err)
+	}
+
+	log.Printf("Migrations: applied %s (%v)", m.name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// versionLayout is the time layout of a migration version.
+const versionLayout = "20060102150405"
+
+// readMigrations lists the *.up.sql files in files, sorted by version.
+// File names must start with a version that's a UTC timestamp,
+// YYYYMMDDHHMMSS: 20260119093000_name.up.sql.
+//
+// Versions are compared as numbers, so an impossible time (hour 24)
+// would still sort; it's refused anyway, because other tools read the
+// prefix as a timestamp and would reject or misorder the file.
+func readMigrations(files fs.FS) ([]migration, error) {
+	names, err := fs.Glob(files, "*.up.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]migration, 0, len(names))
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(path.Base(name), "_")
+		version, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: file name must start with a numeric version", name)
+		}
+		if _, err := time.Parse(versionLayout, prefix); err != nil {
+			return nil, fmt.Errorf("migration %s: version must be a YYYYMMDDHHMMSS timestamp: %w", name, err)
+		}
+		migrations = append(migrations, migration{version: version, name: name})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].version < migrations[j].version
+	})
+	return migrations, nil
+}
+
+// splitStatements splits a migration file into single statements.
+//
+// The driver runs one statement per Exec unless the DSN enables
+// multiStatements, which we avoid because it makes SQL injection worse.
+// The rules are simple, so keep migrations simple: a statement ends with
+// a semicolon at the end of a line, and "--" comment lines are dropped.
+func splitStatements(script string) []string {
+	var statements []string
+	var current strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current.WriteString(line)
+		current.WriteString("\n")
+
+		if strings.HasSuffix(trimmed, ";") {
+			stmt := strings.TrimSpace(current.String())
+			statements = append(statements, strings.TrimSuffix(stmt, ";"))
+			current.Reset()
+		}
+	}
+	// A last statement without a semicolon still counts.
+	if rest := strings.TrimSpace(current.String()); rest != "" {
+		statements = append(statements, rest)
+	}
+	return statements
+}
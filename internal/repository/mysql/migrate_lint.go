@@ -0,0 +1,297 @@
+package mysql
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"strings"
+)
+
+// SchemaManifest records what one release of the code expects from the
+// database: the newest migration it ships and every column it uses.
+//
+// Generate it from the release being replaced (`api schema-manifest`) and
+// feed it to LintMigrations to check the next release's migrations.
+type SchemaManifest struct {
+	MigrationVersion uint64              `json:"migration_version"`
+	Tables           map[string][]string `json:"tables"` // table -> columns the code reads or writes
+}
+
+// references reports whether the manifest's code uses the table, and
+// the column too when column is non-empty.
+func (m SchemaManifest) references(table, column string) bool {
+	columns, ok := m.Tables[table]
+	if !ok || column == "" {
+		return ok
+	}
+	for _, c := range columns {
+		if strings.EqualFold(c, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// CurrentManifest describes this build: expectedSchema plus the newest
+// migration in files.
+func CurrentManifest(files fs.FS) (SchemaManifest, error) {
+	migrations, err := readMigrations(files)
+	if err != nil {
+		return SchemaManifest{}, err
+	}
+
+	m := SchemaManifest{Tables: make(map[string][]string, len(expectedSchema))}
+	if len(migrations) > 0 {
+		m.MigrationVersion = migrations[len(migrations)-1].version
+	}
+	for table, expected := range expectedSchema {
+		for _, c := range expected.columns {
+			m.Tables[table] = append(m.Tables[table], c.name)
+		}
+	}
+	return m, nil
+}
+
+// Lint finding severities. Errors break the previous release; warnings
+// are risky but sometimes intended.
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintFinding is one problem in one migration statement.
+type LintFinding struct {
+	Migration string `json:"migration"`
+	Severity  string `json:"severity"`
+	Message   string `json:"message"`
+}
+
+// String formats the finding as "file: severity: message".
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Migration, f.Severity, f.Message)
+}
+
+// LintMigrations checks every migration newer than previous.MigrationVersion
+// for changes that would break the previous release while both run.
+//
+// WHY?
+// In a blue/green (or rolling) deploy, migrations run BEFORE the old
+// release is gone. For a while, old code talks to the new schema. So a
+// migration must be backwards compatible with the previous release:
+//   - Don't drop or rename a table or column the old code still uses.
+//     Stop using it in one release, drop it in the next ("expand/contract").
+//   - Don't add a NOT NULL column without a DEFAULT: the old code's
+//     INSERTs don't know about it and fail.
+//   - Don't build indexes in a way that locks the table: the old release
+//     is serving traffic on it. Spell out ALGORITHM=INPLACE, LOCK=NONE so
+//     MySQL refuses (instead of silently locking) if it can't build online.
+//
+// The checks read the SQL with regular expressions, so they understand
+// the plain DDL this repository writes, not every statement MySQL accepts.
+func LintMigrations(files fs.FS, previous SchemaManifest) ([]LintFinding, error) {
+	migrations, err := readMigrations(files)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []LintFinding
+	for _, m := range migrations {
+		if m.version <= previous.MigrationVersion {
+			continue
+		}
+		data, err := fs.ReadFile(files, m.name)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", m.name, err)
+		}
+
+		// Tables created by this same migration are brand new: nothing
+		// uses them yet, so locking or reshaping them is harmless.
+		created := make(map[string]bool)
+		for _, stmt := range splitStatements(string(data)) {
+			for _, f := range lintStatement(stmt, previous, created) {
+				findings = append(findings, LintFinding{Migration: m.name, Severity: f.severity, Message: f.message})
+			}
+		}
+	}
+	return findings, nil
+}
+
+// finding is a LintFinding before it's tied to a migration file.
+type finding struct {
+	severity string
+	message  string
+}
+
+// Statement patterns. Identifiers may be `quoted`.
+var (
+	createTableRe = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?` + "`?" + `(\w+)`)
+	dropTableRe   = regexp.MustCompile(`(?is)^DROP\s+TABLE\s+(?:IF\s+EXISTS\s+)?(.+)$`)
+	renameTableRe = regexp.MustCompile(`(?is)^RENAME\s+TABLE\s+` + "`?" + `(\w+)`)
+	createIndexRe = regexp.MustCompile(`(?is)^CREATE\s+(?:UNIQUE\s+|FULLTEXT\s+|SPATIAL\s+)?INDEX\s+\S+\s+ON\s+` + "`?" + `(\w+)`)
+	alterTableRe  = regexp.MustCompile(`(?is)^ALTER\s+TABLE\s+` + "`?" + `(\w+)` + "`?" + `\s+(.+)$`)
+
+	dropColumnRe   = regexp.MustCompile(`(?is)^DROP\s+(?:COLUMN\s+)?` + "`?" + `(\w+)`)
+	renameColumnRe = regexp.MustCompile(`(?is)^RENAME\s+COLUMN\s+` + "`?" + `(\w+)`)
+	renameIndexRe  = regexp.MustCompile(`(?is)^RENAME\s+(?:INDEX|KEY)\b`)
+	changeColumnRe = regexp.MustCompile(`(?is)^CHANGE\s+(?:COLUMN\s+)?` + "`?" + `(\w+)` + "`?" + `\s+` + "`?" + `(\w+)`)
+	modifyColumnRe = regexp.MustCompile(`(?is)^MODIFY\s+(?:COLUMN\s+)?` + "`?" + `(\w+)`)
+	addIndexRe     = regexp.MustCompile(`(?is)^ADD\s+(?:CONSTRAINT\s+\S+\s+)?(?:UNIQUE|FULLTEXT|SPATIAL|INDEX|KEY)\b`)
+	addColumnRe    = regexp.MustCompile(`(?is)^ADD\s+(?:COLUMN\s+)?` + "`?" + `(\w+)` + "`?" + `\s+(.+)$`)
+	renameToRe     = regexp.MustCompile(`(?is)^RENAME\s+(?:TO\s+|AS\s+)?` + "`?" + `\w+`)
+
+	onlineIndexRe = regexp.MustCompile(`(?is)\bLOCK\s*=?\s*NONE\b`)
+	fulltextRe    = regexp.MustCompile(`(?is)\bFULLTEXT\b`)
+	notNullRe     = regexp.MustCompile(`(?is)\bNOT\s+NULL\b`)
+	defaultRe     = regexp.MustCompile(`(?is)\b(?:DEFAULT|AUTO_INCREMENT|GENERATED\s+ALWAYS|AS\s*\()`)
+)
+
+// nonColumnDrops are DROP clauses that remove something other than a column.
+var nonColumnDrops = map[string]bool{
+	"INDEX": true, "KEY": true, "PRIMARY": true, "FOREIGN": true,
+	"CONSTRAINT": true, "CHECK": true, "PARTITION": true,
+}
+
+// lintStatement checks one statement. created collects tables created
+// earlier in the same migration.
+func lintStatement(stmt string, previous SchemaManifest, created map[string]bool) []finding {
+	var findings []finding
+	used := func(table string) bool {
+		return !created[strings.ToLower(table)] && previous.references(table, "")
+	}
+
+	switch {
+	case createTableRe.MatchString(stmt):
+		created[strings.ToLower(createTableRe.FindStringSubmatch(stmt)[1])] = true
+
+	case dropTableRe.MatchString(stmt):
+		for _, table := range strings.Split(dropTableRe.FindStringSubmatch(stmt)[1], ",") {
+			table = strings.Trim(strings.TrimSpace(table), "`")
+			if used(table) {
+				findings = append(findings, finding{LintError, fmt.Sprintf("drops table %s, which the previous release still uses", table)})
+			}
+		}
+
+	case renameTableRe.MatchString(stmt):
+		if table := renameTableRe.FindStringSubmatch(stmt)[1]; used(table) {
+			findings = append(findings, finding{LintError, fmt.Sprintf("renames table %s, which the previous release still uses", table)})
+		}
+
+	case createIndexRe.MatchString(stmt):
+		table := createIndexRe.FindStringSubmatch(stmt)[1]
+		switch {
+		case !used(table):
+		case fulltextRe.MatchString(stmt):
+			findings = append(findings, fulltextIndex(table))
+		case !onlineIndexRe.MatchString(stmt):
+			findings = append(findings, lockingIndex(table))
+		}
+
+	case alterTableRe.MatchString(stmt):
+		match := alterTableRe.FindStringSubmatch(stmt)
+		table, clauses := match[1], splitClauses(match[2])
+		if !used(table) {
+			break
+		}
+		online := onlineIndexRe.MatchString(match[2])
+		for _, clause := range clauses {
+			findings = append(findings, lintAlterClause(table, clause, online, previous)...)
+		}
+	}
+	return findings
+}
+
+// lintAlterClause checks one comma-separated clause of an ALTER TABLE.
+// online reports whether the statement asks for LOCK=NONE.
+func lintAlterClause(table, clause string, online bool, previous SchemaManifest) []finding {
+	word := strings.ToUpper(strings.Fields(clause + " ")[0])
+	second := ""
+	if fields := strings.Fields(clause); len(fields) > 1 {
+		second = strings.ToUpper(fields[1])
+	}
+
+	switch {
+	case word == "DROP" && !nonColumnDrops[second]:
+		if column := dropColumnRe.FindStringSubmatch(clause)[1]; previous.references(table, column) {
+			return []finding{{LintError, fmt.Sprintf("drops column %s.%s, which the previous release still uses", table, column)}}
+		}
+
+	case renameColumnRe.MatchString(clause):
+		if column := renameColumnRe.FindStringSubmatch(clause)[1]; previous.references(table, column) {
+			return []finding{{LintError, fmt.Sprintf("renames column %s.%s, which the previous release still uses", table, column)}}
+		}
+
+	case renameIndexRe.MatchString(clause):
+		// Only the name changes; queries don't name indexes, so the
+		// previous release can't tell. Checked before renameToRe, which
+		// would take INDEX for the table's new name.
+
+	case changeColumnRe.MatchString(clause):
+		match := changeColumnRe.FindStringSubmatch(clause)
+		if previous.references(table, match[1]) {
+			if !strings.EqualFold(match[1], match[2]) {
+				return []finding{{LintError, fmt.Sprintf("renames column %s.%s to %s, which the previous release still uses", table, match[1], match[2])}}
+			}
+			return []finding{changedType(table, match[1])}
+		}
+
+	case modifyColumnRe.MatchString(clause):
+		if column := modifyColumnRe.FindStringSubmatch(clause)[1]; previous.references(table, column) {
+			return []finding{changedType(table, column)}
+		}
+
+	case addIndexRe.MatchString(clause):
+		if fulltextRe.MatchString(clause) {
+			return []finding{fulltextIndex(table)}
+		}
+		if !online {
+			return []finding{lockingIndex(table)}
+		}
+
+	case addColumnRe.MatchString(clause):
+		match := addColumnRe.FindStringSubmatch(clause)
+		if notNullRe.MatchString(match[2]) && !defaultRe.MatchString(match[2]) {
+			return []finding{{LintError, fmt.Sprintf("adds NOT NULL column %s.%s without a DEFAULT; the previous release's INSERTs will fail", table, match[1])}}
+		}
+
+	case word == "RENAME" && renameToRe.MatchString(clause):
+		return []finding{{LintError, fmt.Sprintf("renames table %s, which the previous release still uses", table)}}
+	}
+	return nil
+}
+
+// lockingIndex reports an index build that may lock a live table.
+func lockingIndex(table string) finding {
+	return finding{LintWarning, fmt.Sprintf("builds an index on %s without LOCK=NONE; add ALGORITHM=INPLACE, LOCK=NONE so MySQL refuses instead of blocking writes", table)}
+}
+
+// fulltextIndex reports a FULLTEXT index build, which InnoDB can't do
+// with LOCK=NONE: writes to the table wait until it's done.
+func fulltextIndex(table string) finding {
+	return finding{LintWarning, fmt.Sprintf("builds a FULLTEXT index on %s, which blocks writes to it however it's run (LOCK=SHARED at best); run it when the table is quiet", table)}
+}
+
+// changedType reports a column redefinition the previous release may not expect.
+func changedType(table, column string) finding {
+	return finding{LintWarning, fmt.Sprintf("redefines column %s.%s, which the previous release still uses; check the new type is compatible", table, column)}
+}
+
+// splitClauses splits an ALTER TABLE body on commas outside parentheses,
+// so "ADD COLUMN a DECIMAL(10,2), DROP b" yields two clauses.
+func splitClauses(body string) []string {
+	var clauses []string
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, strings.TrimSpace(body[start:]))
+}
@@ -0,0 +1,27 @@
+package mysql
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"go-basics/migrations"
+)
+
+// TestMigrationVersionsAreTimestamps reads the shipped migrations, whose
+// versions must all be valid times, and checks that one with an
+// impossible time is refused even though it would sort.
+func TestMigrationVersionsAreTimestamps(t *testing.T) {
+	if _, err := readMigrations(migrations.FS); err != nil {
+		t.Fatal(err)
+	}
+
+	files := fstest.MapFS{
+		"20261018230100_valid.up.sql":   {Data: []byte("SELECT 1;")},
+		"20261018240000_hour_24.up.sql": {Data: []byte("SELECT 1;")},
+	}
+	_, err := readMigrations(files)
+	if err == nil || !strings.Contains(err.Error(), "20261018240000_hour_24.up.sql") {
+		t.Fatalf("err = %v, want the hour-24 migration refused", err)
+	}
+}
@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/user"
+	"go-basics/internal/encryption"
+)
+
+// errNoSecretCipher is returned when a row holds (or would hold) an
+// encrypted column but the repository wasn't given a key.
+var errNoSecretCipher = errors.New("MFA secret present but no encryption key configured (see WithSecretCipher)")
+
+// userRow is the persistence model: one row of the users table,
+// with Go types that match the column types exactly.
+//
+// WHY A SEPARATE STRUCT?
+// The domain User is shaped for business logic; this struct is shaped for
+// the database. Scanning straight into user.User would force the domain to
+// use database types (sql.NullTime for deleted_at) and break whenever
+// either side changes. With a row struct, the two can evolve independently
+// and the conversion lives in one place: toDomain / newUserRow below.
+type userRow struct {
+	ID              uint64
+	ULID            sql.NullString // NULL for accounts created before the column existed
+	Email           string
+	Username        sql.NullString // NULL without a username
+	PendingEmail    sql.NullString // NULL when no email change is pending
+	EmailVerifiedAt sql.NullTime   // NULL until the email is verified
+	AvatarURL       sql.NullString // NULL without an avatar
+	IsActive        sql.NullBool   // NOT NULL; Valid is false when it wasn't selected
+	PasswordHash    string
+	TokenVersion    uint64
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	DeletedAt       sql.NullTime // NULL for active users
+	MFASecret       []byte       // AES-GCM ciphertext; NULL if not enrolled
+	MFAEnabledAt    sql.NullTime // NULL until enrollment is confirmed
+}
+
+// newUserRow converts a domain user to its row representation,
+// encrypting the MFA secret with secrets.
+func newUserRow(u *user.User, secrets *encryption.Cipher) (userRow, error) {
+	row := userRow{
+		ID:           u.ID,
+		Email:        u.Email,
+		IsActive:     sql.NullBool{Bool: u.Active, Valid: true},
+		PasswordHash: u.PasswordHash,
+		TokenVersion: u.TokenVersion,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    u.UpdatedAt,
+	}
+	row.ULID.String, row.ULID.Valid = u.ULID, u.ULID != ""
+	row.Username.String, row.Username.Valid = u.Username, u.Username != ""
+	row.PendingEmail.String, row.PendingEmail.Valid = u.PendingEmail, u.PendingEmail != ""
+	row.AvatarURL.String, row.AvatarURL.Valid = u.AvatarURL, u.AvatarURL != ""
+	row.DeletedAt.Time, row.DeletedAt.Valid = u.DeletedAt()
+	row.EmailVerifiedAt.Valid = u.EmailVerified
+	row.MFAEnabledAt.Valid = u.MFAEnabled
+
+	if u.MFASecret != "" {
+		if secrets == nil {
+			return userRow{}, errNoSecretCipher
+		}
+		var err error
+		if row.MFASecret, err = secrets.Encrypt([]byte(u.MFASecret)); err != nil {
+			return userRow{}, fmt.Errorf("encrypting MFA secret: %w", err)
+		}
+	}
+	return row, nil
+}
+
+// toDomain converts the row to a domain user, decrypting the MFA secret.
+// Columns that weren't selected (see projection) keep their zero values,
+// except is_active: an account is taken to be active unless it was read
+// as deactivated, so only the lookups that enforce it need to load it.
+func (r userRow) toDomain(secrets *encryption.Cipher) (*user.User, error) {
+	u := &user.User{
+		ID:            r.ID,
+		ULID:          r.ULID.String,
+		Email:         r.Email,
+		Username:      r.Username.String,
+		PendingEmail:  r.PendingEmail.String,
+		EmailVerified: r.EmailVerifiedAt.Valid,
+		AvatarURL:     r.AvatarURL.String,
+		Active:        !r.IsActive.Valid || r.IsActive.Bool,
+		PasswordHash:  r.PasswordHash,
+		TokenVersion:  r.TokenVersion,
+		CreatedAt:     r.CreatedAt,
+		UpdatedAt:     r.UpdatedAt,
+		MFAEnabled:    r.MFAEnabledAt.Valid,
+	}
+	if r.DeletedAt.Valid {
+		u.MarkDeleted(r.DeletedAt.Time)
+	}
+
+	if len(r.MFASecret) > 0 {
+		if secrets == nil {
+			return nil, errNoSecretCipher
+		}
+		secret, err := secrets.Decrypt(r.MFASecret)
+		if err != nil {
+			return nil, fmt.Errorf("user %d: %w", r.ID, err)
+		}
+		u.MFASecret = string(secret)
+	}
+	return u, nil
+}
@@ -0,0 +1,110 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"go-basics/internal/domain/notification"
+)
+
+// NotificationRepository implements notification.Repository for MySQL.
+// Notifications live in the main database (the directory in sharded mode).
+type NotificationRepository struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new notification repository.
+func NewNotificationRepository(db *sql.DB) notification.Repository {
+	return &NotificationRepository{db: db}
+}
+
+// AddPending stores a notification for the next digest.
+func (r *NotificationRepository) AddPending(ctx context.Context, n *notification.Notification) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO pending_notifications (user_id, kind, subject, body) VALUES (?, ?, ?, ?)`,
+		n.UserID, n.Kind, n.Subject, n.Body)
+	if err != nil {
+		return fmt.Errorf("inserting notification: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	n.ID = uint64(id)
+	return nil
+}
+
+// TakePending reads and deletes the user's pending notifications in a
+// transaction. FOR UPDATE makes a concurrent TakePending wait, then find
+// nothing; a notification added meanwhile waits for the next digest.
+func (r *NotificationRepository) TakePending(ctx context.Context, userID uint64) ([]notification.Notification, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("starting transaction: %w", err)
+	}
+	// Rollback after Commit is a no-op.
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, user_id, kind, subject, body, created_at
+		FROM pending_notifications WHERE user_id = ? ORDER BY id FOR UPDATE`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying pending notifications: %w", err)
+	}
+	var pending []notification.Notification
+	for rows.Next() {
+		n := notification.Notification{Priority: notification.PriorityLow}
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Kind, &n.Subject, &n.Body, &n.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning notification: %w", err)
+		}
+		pending = append(pending, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating pending notifications: %w", err)
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	// Delete only the rows read: the last ID bounds them.
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM pending_notifications WHERE user_id = ? AND id <= ?`,
+		userID, pending[len(pending)-1].ID); err != nil {
+		return nil, fmt.Errorf("deleting pending notifications: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("committing: %w", err)
+	}
+	return pending, nil
+}
+
+// Frequency returns the user's digest frequency, or "" if they never set one.
+func (r *NotificationRepository) Frequency(ctx context.Context, userID uint64) (notification.Frequency, error) {
+	var freq string
+	err := r.db.QueryRowContext(ctx,
+		`SELECT frequency FROM notification_preferences WHERE user_id = ?`, userID).Scan(&freq)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("querying notification frequency: %w", err)
+	}
+	return notification.Frequency(freq), nil
+}
+
+// SetFrequency inserts or replaces the user's digest frequency.
+// VALUES() is deprecated from MySQL 8.0.20 in favor of a row alias, but
+// unlike the alias it works on every 8.0 release.
+func (r *NotificationRepository) SetFrequency(ctx context.Context, userID uint64, f notification.Frequency) error {
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO notification_preferences (user_id, frequency) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE frequency = VALUES(frequency)`, userID, string(f))
+	if err != nil {
+		return fmt.Errorf("storing notification frequency: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// PreferenceRepository implements user.PreferenceRepository for MySQL.
+// Preferences live in the main database (the directory in sharded mode),
+// next to notification_preferences.
+//
+// Each user's preferences are one JSON document in a TEXT column, like
+// tenant_policies' lists: they're only ever read and written whole, and
+// a known key added later needs no migration, only a field below.
+type PreferenceRepository struct {
+	db *sql.DB
+}
+
+// NewPreferenceRepository creates a new preference repository.
+func NewPreferenceRepository(db *sql.DB) user.PreferenceRepository {
+	return &PreferenceRepository{db: db}
+}
+
+// preferencesDocument is the stored form of user.Preferences. It's kept
+// apart from the domain type so renaming a Go field can't silently lose
+// everyone's saved value.
+type preferencesDocument struct {
+	Theme                string                     `json:"theme"`
+	Language             string                     `json:"language,omitempty"`
+	Timezone             string                     `json:"timezone,omitempty"`
+	Density              string                     `json:"density"`
+	DesktopNotifications bool                       `json:"desktop_notifications"`
+	NotificationSound    bool                       `json:"notification_sound"`
+	Extras               map[string]json.RawMessage `json:"extras,omitempty"`
+}
+
+// Preferences returns the user's saved preferences, or nil if they never
+// saved any.
+func (r *PreferenceRepository) Preferences(ctx context.Context, userID uint64) (*user.Preferences, error) {
+	var data string
+	var updatedAt time.Time
+	err := r.db.QueryRowContext(ctx,
+		`SELECT data, updated_at FROM user_preferences WHERE user_id = ?`, userID).Scan(&data, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying preferences: %w", err)
+	}
+
+	var doc preferencesDocument
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("decoding preferences of user %d: %w", userID, err)
+	}
+	return &user.Preferences{
+		Theme:                doc.Theme,
+		Language:             doc.Language,
+		Timezone:             doc.Timezone,
+		Density:              doc.Density,
+		DesktopNotifications: doc.DesktopNotifications,
+		NotificationSound:    doc.NotificationSound,
+		Extras:               doc.Extras,
+		UpdatedAt:            updatedAt,
+	}, nil
+}
+
+// SavePreferences inserts or replaces the user's preferences. VALUES()
+// as in NotificationRepository.SetFrequency.
+func (r *PreferenceRepository) SavePreferences(ctx context.Context, userID uint64, p *user.Preferences) error {
+	data, err := json.Marshal(preferencesDocument{
+		Theme:                p.Theme,
+		Language:             p.Language,
+		Timezone:             p.Timezone,
+		Density:              p.Density,
+		DesktopNotifications: p.DesktopNotifications,
+		NotificationSound:    p.NotificationSound,
+		Extras:               p.Extras,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding preferences: %w", err)
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO user_preferences (user_id, data, updated_at) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE data = VALUES(data), updated_at = VALUES(updated_at)`,
+		userID, string(data), p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("storing preferences: %w", err)
+	}
+	return nil
+}
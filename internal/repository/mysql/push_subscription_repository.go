@@ -0,0 +1,129 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"go-basics/internal/domain/notification"
+)
+
+// PushSubscriptionRepository implements notification.SubscriptionRepository
+// for MySQL, in the main database (the directory in sharded mode).
+//
+// Endpoints can be longer than an index allows, so they're unique by
+// SHA-256 hash instead; the hash is only an index key, not a secret.
+type PushSubscriptionRepository struct {
+	db *sql.DB
+}
+
+// NewPushSubscriptionRepository creates a new push subscription repository.
+func NewPushSubscriptionRepository(db *sql.DB) notification.SubscriptionRepository {
+	return &PushSubscriptionRepository{db: db}
+}
+
+// SaveSubscription inserts a subscription, or replaces the one with the
+// same endpoint. LAST_INSERT_ID(id) makes the replaced row's ID the one
+// returned, so sub.ID is right either way.
+func (r *PushSubscriptionRepository) SaveSubscription(ctx context.Context, sub *notification.PushSubscription) error {
+	result, err := r.db.ExecContext(ctx,
+		`INSERT INTO push_subscriptions (user_id, endpoint_hash, endpoint, p256dh, auth, user_agent, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id), user_id = VALUES(user_id),
+			p256dh = VALUES(p256dh), auth = VALUES(auth), user_agent = VALUES(user_agent),
+			created_at = VALUES(created_at)`,
+		sub.UserID, endpointHash(sub.Endpoint), sub.Endpoint, sub.P256dh, sub.Auth, sub.UserAgent, sub.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("storing push subscription: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	sub.ID = uint64(id)
+	return nil
+}
+
+// Subscription returns one subscription by ID.
+func (r *PushSubscriptionRepository) Subscription(ctx context.Context, id uint64) (*notification.PushSubscription, error) {
+	var sub notification.PushSubscription
+	err := r.db.QueryRowContext(ctx,
+		`SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at
+		FROM push_subscriptions WHERE id = ?`, id).
+		Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.UserAgent, &sub.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notification.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("querying push subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// Subscriptions returns the user's subscriptions, newest first.
+func (r *PushSubscriptionRepository) Subscriptions(ctx context.Context, userID uint64) ([]notification.PushSubscription, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, user_id, endpoint, p256dh, auth, user_agent, created_at
+		FROM push_subscriptions WHERE user_id = ? ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []notification.PushSubscription
+	for rows.Next() {
+		var sub notification.PushSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.UserAgent, &sub.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scanning push subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating push subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+// DeleteSubscription removes one subscription. The user_id condition
+// means users can only remove their own, even if they guess another ID.
+func (r *PushSubscriptionRepository) DeleteSubscription(ctx context.Context, userID, id uint64) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM push_subscriptions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("deleting push subscription: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return notification.ErrSubscriptionNotFound
+	}
+	return nil
+}
+
+// PruneSubscriptions deletes all but the user's keep newest subscriptions.
+// MySQL refuses LIMIT in an IN subquery, and a DELETE reading its own
+// table, unless the subquery is wrapped in a derived table as here.
+func (r *PushSubscriptionRepository) PruneSubscriptions(ctx context.Context, userID uint64, keep int) error {
+	_, err := r.db.ExecContext(ctx,
+		`DELETE FROM push_subscriptions WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM (
+				SELECT id FROM push_subscriptions WHERE user_id = ?
+				ORDER BY created_at DESC, id DESC LIMIT ?
+			) AS newest
+		)`, userID, userID, keep)
+	if err != nil {
+		return fmt.Errorf("pruning push subscriptions: %w", err)
+	}
+	return nil
+}
+
+// endpointHash is the unique index key for an endpoint.
+func endpointHash(endpoint string) string {
+	sum := sha256.Sum256([]byte(endpoint))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// RecoveryCodeRepository implements user.RecoveryCodeRepository for
+// MySQL. Codes live in the main database (the directory in sharded mode),
+// next to the reset tokens they resemble.
+type RecoveryCodeRepository struct {
+	db dbtx
+}
+
+// NewRecoveryCodeRepository creates a new recovery code repository.
+func NewRecoveryCodeRepository(db *sql.DB) user.RecoveryCodeRepository {
+	return &RecoveryCodeRepository{db: scoped(db)}
+}
+
+// ReplaceRecoveryCodes deletes the user's codes and inserts hashes.
+//
+// The two statements join the request transaction (see scoped), so the
+// routes that call this run in one (txn.Middleware): without it, a
+// failed INSERT would leave the user with no codes at all.
+func (r *RecoveryCodeRepository) ReplaceRecoveryCodes(ctx context.Context, userID uint64, hashes []string) error {
+	if err := r.DeleteRecoveryCodes(ctx, userID); err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	placeholders := make([]string, len(hashes))
+	args := make([]interface{}, 0, 2*len(hashes))
+	for i, hash := range hashes {
+		placeholders[i] = "(?, ?)"
+		args = append(args, userID, hash)
+	}
+	query := `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ` + strings.Join(placeholders, ", ")
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("inserting recovery codes: %w", err)
+	}
+	return nil
+}
+
+// UseRecoveryCode marks an unused code as used. Like
+// TokenRepository.Consume, the conditional UPDATE is the check: only one
+// request can flip used_at from NULL.
+func (r *RecoveryCodeRepository) UseRecoveryCode(ctx context.Context, userID uint64, hash string) (bool, error) {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE mfa_recovery_codes
+		SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL
+	`, time.Now().UTC(), userID, hash)
+	if err != nil {
+		return false, fmt.Errorf("using recovery code: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("getting rows affected: %w", err)
+	}
+	return affected > 0, nil
+}
+
+// RecoveryCodeStatus counts the user's unused and used codes.
+func (r *RecoveryCodeRepository) RecoveryCodeStatus(ctx context.Context, userID uint64) (*user.RecoveryStatus, error) {
+	var status user.RecoveryStatus
+	err := r.db.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(used_at IS NULL), 0), COALESCE(SUM(used_at IS NOT NULL), 0)
+		FROM mfa_recovery_codes
+		WHERE user_id = ?
+	`, userID).Scan(&status.Remaining, &status.Used)
+	if err != nil {
+		return nil, fmt.Errorf("counting recovery codes: %w", err)
+	}
+	return &status, nil
+}
+
+// DeleteRecoveryCodes removes all of the user's codes.
+func (r *RecoveryCodeRepository) DeleteRecoveryCodes(ctx context.Context, userID uint64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("deleting recovery codes: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go-basics/internal/domain/user"
+)
+
+// RoleRepository implements user.RoleRepository for MySQL.
+//
+// Schema (see migrations):
+//
+//	roles      (id, name)          - one row per role
+//	user_roles (user_id, role_id)  - many-to-many link between users and roles
+type RoleRepository struct {
+	db dbtx
+}
+
+// NewRoleRepository creates a new role repository.
+func NewRoleRepository(db *sql.DB) user.RoleRepository {
+	return &RoleRepository{db: scoped(db)}
+}
+
+// RolesFor returns the names of all roles assigned to the user.
+func (r *RoleRepository) RolesFor(ctx context.Context, userID uint64) ([]user.Role, error) {
+	query := `
+		SELECT r.name
+		FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = ?
+		ORDER BY r.name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("querying roles: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []user.Role
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("scanning role: %w", err)
+		}
+		roles = append(roles, user.Role(name))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating roles: %w", err)
+	}
+	return roles, nil
+}
+
+// Assign links the user to the role.
+// INSERT IGNORE skips the row if the (user_id, role_id) pair already exists.
+// INSERT ... SELECT resolves the role name to its ID in the same statement.
+func (r *RoleRepository) Assign(ctx context.Context, userID uint64, role user.Role) error {
+	query := `
+		INSERT IGNORE INTO user_roles (user_id, role_id)
+		SELECT ?, id FROM roles WHERE name = ?
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, string(role))
+	if err != nil {
+		return fmt.Errorf("assigning role: %w", err)
+	}
+
+	// Zero rows affected means either the role name doesn't exist
+	// or the user already had it. Tell them apart with a lookup.
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		var exists bool
+		if err := r.db.QueryRowContext(ctx,
+			`SELECT EXISTS(SELECT 1 FROM roles WHERE name = ?)`, string(role),
+		).Scan(&exists); err != nil {
+			return fmt.Errorf("checking role: %w", err)
+		}
+		if !exists {
+			return user.ErrUnknownRole
+		}
+	}
+	return nil
+}
+
+// Revoke removes the link between the user and the role.
+func (r *RoleRepository) Revoke(ctx context.Context, userID uint64, role user.Role) error {
+	query := `
+		DELETE ur FROM user_roles ur
+		JOIN roles r ON r.id = ur.role_id
+		WHERE ur.user_id = ? AND r.name = ?
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, string(role)); err != nil {
+		return fmt.Errorf("revoking role: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,646 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// expectedColumn describes a column the repository code reads or writes.
+type expectedColumn struct {
+	name     string
+	typ      string // information_schema COLUMN_TYPE, e.g. "varchar(255)"
+	nullable bool
+}
+
+// expectedIndex describes an index the repository queries rely on.
+// Indexes are matched by their columns, not their names, because the
+// migration files have used different naming styles over time.
+//
+// The exception is a unique key whose name the code reads: the only way
+// to tell which key refused a write is the name in MySQL's "Duplicate
+// entry" message (see userConflict). An inline UNIQUE gets named after
+// its column, so for those the name is checked too.
+type expectedIndex struct {
+	columns  []string
+	unique   bool
+	fulltext bool   // MATCH ... AGAINST needs a FULLTEXT index; no other kind will do
+	name     string // "" = any name will do
+}
+
+// expectedTable is the structure the code expects for one table.
+type expectedTable struct {
+	columns []expectedColumn
+	indexes []expectedIndex
+}
+
+// expectedCharset is the character set every table must use.
+// utf8mb4 is required for full Unicode (including emoji) in emails.
+const expectedCharset = "utf8mb4"
+
+// expectedSchema lists every table the repositories use.
+//
+// KEEP THIS IN SYNC WITH migrations/.
+// When a migration adds a column the code depends on, add it here too.
+// Startup validation compares this against information_schema, so drift
+// is reported at boot with a precise diff instead of as a confusing
+// "Scan error on column index 3" in the middle of a request.
+var expectedSchema = map[string]expectedTable{
+	"users": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"ulid", "char(26)", true},
+			{"email", "varchar(255)", false},
+			{"username", "varchar(30)", true},
+			{"pending_email", "varchar(255)", true},
+			{"email_verified_at", "timestamp", true},
+			{"avatar_url", "varchar(2048)", true},
+			{"is_active", "tinyint(1)", false},
+			{"password_hash", "varchar(255)", false},
+			{"token_version", "int unsigned", false},
+			{"created_at", "timestamp", false},
+			{"updated_at", "timestamp", false},
+			{"deleted_at", "timestamp", true},
+			{"mfa_secret", "varbinary(255)", true},
+			{"mfa_enabled_at", "timestamp", true},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"email"}, unique: true, name: "uk_users_email"},
+			{columns: []string{"username"}, unique: true, name: "uk_users_username"},
+			{columns: []string{"ulid"}, unique: true, name: "uk_users_ulid"},
+			{columns: []string{"email"}, fulltext: true},
+			{columns: []string{"created_at", "id"}},
+			{columns: []string{"updated_at", "id"}},
+		},
+	},
+	"roles": {
+		columns: []expectedColumn{
+			{"id", "int unsigned", false},
+			{"name", "varchar(50)", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"name"}, unique: true},
+		},
+	},
+	"user_roles": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"role_id", "int unsigned", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id", "role_id"}, unique: true},
+		},
+	},
+	"password_reset_tokens": {
+		columns: []expectedColumn{
+			{"token_hash", "char(64)", false},
+			{"user_id", "bigint unsigned", false},
+			{"expires_at", "timestamp", false},
+			{"used_at", "timestamp", true},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"token_hash"}, unique: true},
+			{columns: []string{"user_id"}},
+		},
+	},
+	"email_change_tokens": {
+		columns: []expectedColumn{
+			{"token_hash", "char(64)", false},
+			{"user_id", "bigint unsigned", false},
+			{"expires_at", "timestamp", false},
+			{"used_at", "timestamp", true},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"token_hash"}, unique: true},
+			{columns: []string{"user_id"}},
+		},
+	},
+	"sessions": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"user_id", "bigint unsigned", false},
+			{"token_hash", "char(64)", false},
+			{"user_agent", "varchar(255)", false},
+			{"ip_address", "varchar(45)", false},
+			{"dpop_jkt", "char(43)", true},
+			{"created_at", "timestamp", false},
+			{"last_used_at", "timestamp", false},
+			{"expires_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"token_hash"}, unique: true},
+			{columns: []string{"user_id"}},
+		},
+	},
+	"account_activity": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"last_login_at", "timestamp", false},
+			{"last_login_ip", "varchar(45)", true},
+			{"warned_at", "timestamp", true},
+			{"disabled_at", "timestamp", true},
+			{"delete_after", "timestamp", true},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id"}, unique: true},
+			{columns: []string{"last_login_at"}},
+		},
+	},
+	"mfa_recovery_codes": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"code_hash", "char(64)", false},
+			{"used_at", "timestamp", true},
+			{"created_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id", "code_hash"}, unique: true},
+		},
+	},
+	"anonymization_requests": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"requested_by", "bigint unsigned", false},
+			{"requested_at", "timestamp", false},
+			{"anonymize_after", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id"}, unique: true},
+			{columns: []string{"anonymize_after"}},
+		},
+	},
+	"login_countries": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"country", "char(2)", false},
+			{"first_seen_at", "timestamp", false},
+			{"last_seen_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id", "country"}, unique: true},
+		},
+	},
+	"login_history": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"user_id", "bigint unsigned", false},
+			{"user_agent", "varchar(255)", false},
+			{"ip_address", "varchar(45)", false},
+			{"created_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"user_id"}},
+		},
+	},
+	"invitations": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"user_id", "bigint unsigned", false},
+			{"email", "varchar(255)", false},
+			{"invited_by", "bigint unsigned", false},
+			{"token_hash", "char(64)", false},
+			{"created_at", "timestamp", false},
+			{"sent_at", "timestamp", false},
+			{"expires_at", "timestamp", false},
+			{"accepted_at", "timestamp", true},
+			{"revoked_at", "timestamp", true},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"token_hash"}, unique: true},
+			{columns: []string{"user_id"}},
+		},
+	},
+	"campaigns": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"subject", "varchar(255)", false},
+			{"body", "text", false},
+			{"segment_created_from", "timestamp", true},
+			{"segment_created_to", "timestamp", true},
+			{"segment_role", "varchar(50)", false},
+			{"segment_active_since", "timestamp", true},
+			{"segment_inactive_since", "timestamp", true},
+			{"status", "varchar(16)", false},
+			{"created_by", "bigint unsigned", false},
+			{"created_at", "timestamp", false},
+			{"started_at", "timestamp", true},
+			{"ended_at", "timestamp", true},
+			{"cursor_pos", "varchar(255)", false},
+			{"sent", "int unsigned", false},
+			{"failed", "int unsigned", false},
+			{"skipped", "int unsigned", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+		},
+	},
+	"campaign_deliveries": {
+		columns: []expectedColumn{
+			{"campaign_id", "bigint unsigned", false},
+			{"user_id", "bigint unsigned", false},
+			{"email", "varchar(255)", false},
+			{"status", "varchar(16)", false},
+			{"error", "varchar(255)", false},
+			{"delivered_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"campaign_id", "user_id"}, unique: true},
+			{columns: []string{"campaign_id", "status", "user_id"}},
+			{columns: []string{"user_id"}},
+		},
+	},
+	"tenant_policies": {
+		columns: []expectedColumn{
+			{"tenant_id", "varchar(64)", false},
+			{"cors_origins", "text", false},
+			{"redirect_uris", "text", false},
+			{"webhook_urls", "text", false},
+			{"updated_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"tenant_id"}, unique: true},
+		},
+	},
+	"user_preferences": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"data", "text", false},
+			{"updated_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id"}, unique: true},
+		},
+	},
+	"job_spool": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"kind", "varchar(100)", false},
+			{"payload", "mediumblob", false},
+			{"attempts", "int unsigned", false},
+			{"error_trace", "mediumtext", true},
+			{"created_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+		},
+	},
+	"job_dead_letters": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"kind", "varchar(100)", false},
+			{"payload", "mediumblob", false},
+			{"attempts", "int unsigned", false},
+			{"error_trace", "mediumtext", false},
+			{"failed_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+		},
+	},
+	"scheduled_jobs": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"kind", "varchar(100)", false},
+			{"payload", "mediumblob", false},
+			{"unique_key", "varchar(191)", true},
+			{"run_at", "timestamp", false},
+			{"every_seconds", "int unsigned", false},
+			{"created_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"unique_key"}, unique: true},
+			{columns: []string{"run_at"}},
+		},
+	},
+	"pending_notifications": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"user_id", "bigint unsigned", false},
+			{"kind", "varchar(100)", false},
+			{"subject", "varchar(255)", false},
+			{"body", "text", false},
+			{"created_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"user_id", "id"}},
+		},
+	},
+	"notification_preferences": {
+		columns: []expectedColumn{
+			{"user_id", "bigint unsigned", false},
+			{"frequency", "varchar(16)", false},
+			{"updated_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"user_id"}, unique: true},
+		},
+	},
+	"push_subscriptions": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"user_id", "bigint unsigned", false},
+			{"endpoint_hash", "char(64)", false},
+			{"endpoint", "text", false},
+			{"p256dh", "varchar(128)", false},
+			{"auth", "varchar(64)", false},
+			{"user_agent", "varchar(255)", false},
+			{"created_at", "timestamp", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"endpoint_hash"}, unique: true},
+			{columns: []string{"user_id", "created_at"}},
+		},
+	},
+	"audit_events": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+			{"occurred_at", "timestamp(6)", false},
+			{"category", "varchar(32)", false},
+			{"actor", "varchar(255)", false},
+			{"message", "text", false},
+			{"seq", "bigint unsigned", false},
+			{"prev_hash", "char(64)", false},
+			{"hash", "char(64)", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+			{columns: []string{"category", "occurred_at"}},
+			{columns: []string{"seq"}},
+		},
+	},
+	"audit_chain_head": {
+		columns: []expectedColumn{
+			{"id", "tinyint unsigned", false},
+			{"seq", "bigint unsigned", false},
+			{"hash", "char(64)", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+		},
+	},
+	"user_id_sequence": {
+		columns: []expectedColumn{
+			{"id", "bigint unsigned", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"id"}, unique: true},
+		},
+	},
+	"user_email_index": {
+		columns: []expectedColumn{
+			{"email", "varchar(255)", false},
+			{"user_id", "bigint unsigned", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"email"}, unique: true},
+			{columns: []string{"user_id"}, unique: true},
+		},
+	},
+	"user_username_index": {
+		columns: []expectedColumn{
+			{"username", "varchar(30)", false},
+			{"user_id", "bigint unsigned", false},
+		},
+		indexes: []expectedIndex{
+			{columns: []string{"username"}, unique: true},
+			{columns: []string{"user_id"}, unique: true},
+		},
+	},
+}
+
+// Tables used in each deployment mode.
+var (
+	// UserTables are the tables a (non-sharded) user database needs.
+	// Shards in sharded mode need the same tables.
+	UserTables = []string{"users"}
+
+	// DirectoryTables are the tables the shard directory needs.
+	DirectoryTables = []string{"user_id_sequence", "user_email_index", "user_username_index"}
+
+	// RoleTables are the RBAC tables. They live in the main database
+	// (the directory in sharded mode), never on shards.
+	RoleTables = []string{"roles", "user_roles"}
+
+	// AuthTables hold account recovery, invitation, session, activity,
+	// and sign-in history state. Like RoleTables they live in the main
+	// database (the directory in sharded mode).
+	AuthTables = []string{"password_reset_tokens", "email_change_tokens", "invitations", "sessions", "account_activity", "mfa_recovery_codes", "login_countries", "login_history"}
+
+	// JobTables hold background jobs saved across restarts, scheduled for
+	// later, or failed for good, in the main database (the directory in
+	// sharded mode).
+	JobTables = []string{"job_spool", "job_dead_letters", "scheduled_jobs"}
+
+	// NotificationTables hold digest notifications, preferences, and
+	// push subscriptions, in the main database (the directory in sharded
+	// mode).
+	NotificationTables = []string{"pending_notifications", "notification_preferences", "push_subscriptions"}
+
+	// AuditTables hold the audit trail written by the mysql audit sink
+	// and the end of its hash chain, in the main database (the directory
+	// in sharded mode).
+	AuditTables = []string{"audit_events", "audit_chain_head"}
+
+	// TenantTables hold each tenant's security policy, in the main
+	// database (the directory in sharded mode).
+	TenantTables = []string{"tenant_policies"}
+
+	// PreferenceTables hold users' client preferences, in the main
+	// database (the directory in sharded mode).
+	PreferenceTables = []string{"user_preferences"}
+
+	// PrivacyTables hold pending anonymization requests, in the main
+	// database (the directory in sharded mode).
+	PrivacyTables = []string{"anonymization_requests"}
+
+	// CampaignTables hold admin email campaigns and their deliveries, in
+	// the main database (the directory in sharded mode).
+	CampaignTables = []string{"campaigns", "campaign_deliveries"}
+)
+
+// ValidateSchema compares the live schema of the given tables against
+// expectedSchema and returns one human-readable line per difference.
+// An empty result means the schema matches.
+//
+// Only things the code depends on are checked. Extra columns or indexes
+// are fine: a newer migration may have added them ahead of a deploy.
+func ValidateSchema(ctx context.Context, db *sql.DB, tables ...string) ([]string, error) {
+	var diffs []string
+	for _, table := range tables {
+		expected, ok := expectedSchema[table]
+		if !ok {
+			return nil, fmt.Errorf("no expected schema for table %q", table)
+		}
+
+		tableDiffs, err := validateTable(ctx, db, table, expected)
+		if err != nil {
+			return nil, fmt.Errorf("validating %s: %w", table, err)
+		}
+		diffs = append(diffs, tableDiffs...)
+	}
+	return diffs, nil
+}
+
+// validateTable checks one table's charset, columns, and indexes.
+func validateTable(ctx context.Context, db *sql.DB, table string, expected expectedTable) ([]string, error) {
+	// Table existence and charset.
+	// TABLE_COLLATION looks like "utf8mb4_unicode_ci"; the charset is the prefix.
+	var collation sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT TABLE_COLLATION
+		FROM information_schema.TABLES
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+	`, table).Scan(&collation)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []string{fmt.Sprintf("%s: table is missing", table)}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	if !strings.HasPrefix(collation.String, expectedCharset+"_") {
+		diffs = append(diffs, fmt.Sprintf("%s: collation %q, want a %s collation", table, collation.String, expectedCharset))
+	}
+
+	columnDiffs, err := validateColumns(ctx, db, table, expected.columns)
+	if err != nil {
+		return nil, err
+	}
+	diffs = append(diffs, columnDiffs...)
+
+	indexDiffs, err := validateIndexes(ctx, db, table, expected.indexes)
+	if err != nil {
+		return nil, err
+	}
+	return append(diffs, indexDiffs...), nil
+}
+
+// validateColumns checks that every expected column exists with the right type.
+func validateColumns(ctx context.Context, db *sql.DB, table string, expected []expectedColumn) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT COLUMN_NAME, COLUMN_TYPE, IS_NULLABLE
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actual := make(map[string]expectedColumn)
+	for rows.Next() {
+		var c expectedColumn
+		var nullable string
+		if err := rows.Scan(&c.name, &c.typ, &nullable); err != nil {
+			return nil, err
+		}
+		c.nullable = nullable == "YES"
+		actual[c.name] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	for _, want := range expected {
+		got, ok := actual[want.name]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s.%s: column is missing", table, want.name))
+		case got.typ != want.typ:
+			diffs = append(diffs, fmt.Sprintf("%s.%s: type %s, want %s", table, want.name, got.typ, want.typ))
+		case got.nullable != want.nullable:
+			diffs = append(diffs, fmt.Sprintf("%s.%s: nullable=%t, want nullable=%t", table, want.name, got.nullable, want.nullable))
+		}
+	}
+	return diffs, nil
+}
+
+// validateIndexes checks that an index exists for every expected column list.
+func validateIndexes(ctx context.Context, db *sql.DB, table string, expected []expectedIndex) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT INDEX_NAME, COLUMN_NAME, NON_UNIQUE, INDEX_TYPE
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME, SEQ_IN_INDEX
+	`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Group columns by index name, preserving column order.
+	type liveIndex struct {
+		name     string
+		columns  []string
+		unique   bool
+		fulltext bool
+	}
+	live := make(map[string]*liveIndex)
+	for rows.Next() {
+		var name, column, indexType string
+		var nonUnique int
+		if err := rows.Scan(&name, &column, &nonUnique, &indexType); err != nil {
+			return nil, err
+		}
+		idx, ok := live[name]
+		if !ok {
+			idx = &liveIndex{name: name, unique: nonUnique == 0, fulltext: indexType == "FULLTEXT"}
+			live[name] = idx
+		}
+		idx.columns = append(idx.columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Index by column signature so names don't matter. A FULLTEXT index
+	// answers different queries than a BTREE one on the same columns, so
+	// it gets a signature of its own.
+	signature := func(columns []string, fulltext bool) string {
+		sig := strings.Join(columns, ",")
+		if fulltext {
+			sig += " fulltext"
+		}
+		return sig
+	}
+	bySignature := make(map[string]*liveIndex, len(live))
+	// If two indexes cover the same columns, prefer the unique one.
+	for _, idx := range live {
+		sig := signature(idx.columns, idx.fulltext)
+		if existing, ok := bySignature[sig]; ok && existing.unique {
+			continue
+		}
+		bySignature[sig] = idx
+	}
+
+	var diffs []string
+	for _, want := range expected {
+		got, ok := bySignature[signature(want.columns, want.fulltext)]
+		if named, found := live[want.name]; found && signature(named.columns, named.fulltext) == signature(want.columns, want.fulltext) {
+			got = named
+		}
+		switch {
+		case !ok && want.fulltext:
+			diffs = append(diffs, fmt.Sprintf("%s: missing FULLTEXT index on (%s)", table, strings.Join(want.columns, ", ")))
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s: missing index on (%s)", table, strings.Join(want.columns, ", ")))
+		case want.unique && !got.unique:
+			diffs = append(diffs, fmt.Sprintf("%s: index on (%s) must be UNIQUE", table, strings.Join(want.columns, ", ")))
+		case want.name != "" && got.name != want.name:
+			diffs = append(diffs, fmt.Sprintf("%s: index on (%s) is named %s, want %s", table, strings.Join(want.columns, ", "), got.name, want.name))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs, nil
+}
@@ -0,0 +1,166 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// SessionRepository implements user.SessionRepository for MySQL.
+// Sessions live in the main database (the directory in sharded mode).
+type SessionRepository struct {
+	db dbtx
+}
+
+// NewSessionRepository creates a new session repository.
+func NewSessionRepository(db *sql.DB) user.SessionRepository {
+	return &SessionRepository{db: scoped(db)}
+}
+
+// sessionColumns is the column list every session query selects.
+const sessionColumns = `id, user_id, user_agent, ip_address, dpop_jkt, created_at, last_used_at, expires_at`
+
+// scanSession reads one row selected with sessionColumns.
+func scanSession(row interface{ Scan(...interface{}) error }) (*user.Session, error) {
+	var s user.Session
+	var jkt sql.NullString
+	err := row.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &jkt, &s.CreatedAt, &s.LastUsedAt, &s.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	s.KeyThumbprint = jkt.String
+	return &s, nil
+}
+
+// Create stores a new session.
+//
+// It also deletes the user's expired sessions. Signing in is rare enough
+// that this keeps the table small without a separate cleanup job.
+func (r *SessionRepository) Create(ctx context.Context, s *user.Session, tokenHash string) error {
+	now := time.Now().UTC()
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE user_id = ? AND expires_at <= ?`, s.UserID, now,
+	); err != nil {
+		return fmt.Errorf("deleting expired sessions: %w", err)
+	}
+
+	// NULL, not "", for an unbound session, so Rotate can tell them apart.
+	var jkt sql.NullString
+	if s.KeyThumbprint != "" {
+		jkt = sql.NullString{String: s.KeyThumbprint, Valid: true}
+	}
+	result, err := r.db.ExecContext(ctx, `
+		INSERT INTO sessions (user_id, token_hash, user_agent, ip_address, dpop_jkt, created_at, last_used_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, s.UserID, tokenHash, s.UserAgent, s.IPAddress, jkt, now, now, s.ExpiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("inserting session: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting last insert id: %w", err)
+	}
+	s.ID = uint64(id)
+	s.CreatedAt = now
+	s.LastUsedAt = now
+	return nil
+}
+
+// Rotate swaps the token hash and returns the updated session.
+//
+// Like TokenRepository.Consume, the conditional UPDATE is what makes
+// this safe under concurrency: only one request can change a row away from
+// oldHash, so a refresh token can't be used twice.
+//
+// The cap is computed from created_at in the same statement, so it
+// costs no extra read. So is the DPoP binding: a bound session's row
+// only matches a device with the same key, and a mismatch looks like
+// any other invalid token.
+func (r *SessionRepository) Rotate(ctx context.Context, oldHash, newHash string, device user.Device, expiresAt time.Time, maxLifetime time.Duration) (*user.Session, error) {
+	now := time.Now().UTC()
+	expiry, args := "?", []interface{}{expiresAt.UTC()}
+	if maxLifetime > 0 {
+		expiry = "LEAST(?, created_at + INTERVAL ? SECOND)"
+		args = append(args, int64(maxLifetime/time.Second))
+	}
+	args = append([]interface{}{newHash, device.UserAgent, device.IPAddress, now}, args...)
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE sessions
+		SET token_hash = ?, user_agent = ?, ip_address = ?, last_used_at = ?, expires_at = `+expiry+`
+		WHERE token_hash = ? AND expires_at > ? AND (dpop_jkt IS NULL OR dpop_jkt = ?)
+	`, append(args, oldHash, now, device.KeyThumbprint)...)
+	if err != nil {
+		return nil, fmt.Errorf("rotating session: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return nil, user.ErrInvalidRefreshToken
+	}
+
+	s, err := scanSession(r.db.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE token_hash = ?`, newHash))
+	if err != nil {
+		return nil, fmt.Errorf("reading session: %w", err)
+	}
+	return s, nil
+}
+
+// ListForUser returns the user's unexpired sessions, most recently used first.
+func (r *SessionRepository) ListForUser(ctx context.Context, userID uint64) ([]*user.Session, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+sessionColumns+`
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_used_at DESC, id DESC
+	`, userID, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*user.Session
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scanning session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+// Delete removes one session. The user_id condition means a user can only
+// revoke their own sessions, even if they guess another session's ID.
+func (r *SessionRepository) Delete(ctx context.Context, userID, id uint64) error {
+	result, err := r.db.ExecContext(ctx,
+		`DELETE FROM sessions WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return fmt.Errorf("deleting session: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return user.ErrSessionNotFound
+	}
+	return nil
+}
+
+// DeleteForUser removes all of the user's sessions, expired or not.
+func (r *SessionRepository) DeleteForUser(ctx context.Context, userID uint64) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("deleting sessions: %w", err)
+	}
+	return nil
+}
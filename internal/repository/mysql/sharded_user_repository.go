@@ -0,0 +1,492 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+
+	"go-basics/internal/domain/user"
+)
+
+// ShardedUserRepository spreads users across several MySQL databases.
+//
+// HOW SHARDING WORKS HERE:
+// Every shard has its own users table with the normal schema.
+// A small "directory" database (the primary DSN) holds three global tables:
+//
+//	user_id_sequence     - hands out unique user IDs across all shards
+//	user_email_index     - maps email -> user_id, so login can find the shard
+//	user_username_index  - maps username -> user_id, the same for usernames
+//
+// SHARD ASSIGNMENT:
+// A user lives on shard  fnv1a64(bigEndian(id)) % len(shards).
+// The assignment depends only on the ID and the NUMBER of shards, so it is
+// stable across restarts and identical on every instance.
+//
+// IMPORTANT: Never change the number (or order) of shards on a live system.
+// Doing so moves most users to a different shard. Growing the cluster
+// requires copying rows to their new shard first (a resharding migration).
+type ShardedUserRepository struct {
+	directory dbtx
+	shards    []*UserRepository
+}
+
+// NewShardedUserRepository creates a repository over the given shards.
+// directory holds the ID sequence and email index; shards hold the users.
+// opts are applied to the repository of every shard.
+func NewShardedUserRepository(directory *sql.DB, shards []*sql.DB, opts ...RepositoryOption) user.Repository {
+	repos := make([]*UserRepository, len(shards))
+	for i, db := range shards {
+		repos[i] = newUserRepository(db, opts...)
+	}
+	return &ShardedUserRepository{directory: scoped(directory), shards: repos}
+}
+
+// shardIndex returns which shard owns the given user ID.
+// We hash the ID instead of using id % n directly so that sequential IDs
+// (which are allocated in bursts) still spread evenly across shards.
+func (r *ShardedUserRepository) shardIndex(id uint64) int {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], id)
+
+	h := fnv.New64a()
+	h.Write(buf[:])
+	return int(h.Sum64() % uint64(len(r.shards)))
+}
+
+// shardFor returns the repository for the shard that owns id.
+func (r *ShardedUserRepository) shardFor(id uint64) *UserRepository {
+	return r.shards[r.shardIndex(id)]
+}
+
+// Create allocates a global ID, claims the email (and username, if any),
+// and inserts the user on its shard.
+//
+// There's no distributed transaction across databases, so if a later step
+// fails we undo the earlier claims by hand (a compensating action).
+func (r *ShardedUserRepository) Create(ctx context.Context, u *user.User) error {
+	// Step 1: Allocate a globally unique ID from the directory.
+	result, err := r.directory.ExecContext(ctx, `INSERT INTO user_id_sequence () VALUES ()`)
+	if err != nil {
+		return fmt.Errorf("allocating user id: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("getting allocated user id: %w", err)
+	}
+
+	// Step 2: Claim the email in the global index.
+	// The unique key on email makes this the cross-shard uniqueness check.
+	if _, err := r.directory.ExecContext(ctx,
+		`INSERT INTO user_email_index (email, user_id) VALUES (?, ?)`,
+		u.Email, id,
+	); err != nil {
+		if isDuplicateEntry(err) {
+			return user.ErrEmailExists
+		}
+		return fmt.Errorf("indexing email: %w", err)
+	}
+
+	// Step 3: Claim the username the same way. Each shard's unique key
+	// only sees its own users.
+	if u.Username != "" {
+		if _, err := r.directory.ExecContext(ctx,
+			`INSERT INTO user_username_index (username, user_id) VALUES (?, ?)`,
+			u.Username, id,
+		); err != nil {
+			if isDuplicateEntry(err) {
+				err = user.ErrUsernameTaken
+			} else {
+				err = fmt.Errorf("indexing username: %w", err)
+			}
+			return r.releaseIndexes(ctx, uint64(id), err)
+		}
+	}
+
+	// Step 4: Insert the user on its shard with the allocated ID.
+	u.ID = uint64(id)
+	if err := r.shardFor(u.ID).Create(ctx, u); err != nil {
+		u.ID = 0
+		return r.releaseIndexes(ctx, uint64(id), err)
+	}
+	return nil
+}
+
+// releaseIndexes undoes Create's claims after err, and returns err with
+// any failure to undo them.
+func (r *ShardedUserRepository) releaseIndexes(ctx context.Context, id uint64, err error) error {
+	if _, cerr := r.directory.ExecContext(ctx,
+		`DELETE FROM user_email_index WHERE user_id = ?`, id,
+	); cerr != nil {
+		err = errors.Join(err, fmt.Errorf("releasing email index: %w", cerr))
+	}
+	if cerr := r.releaseUsername(ctx, id); cerr != nil {
+		err = errors.Join(err, cerr)
+	}
+	return err
+}
+
+// releaseUsername deletes the user's username index entry, if any.
+func (r *ShardedUserRepository) releaseUsername(ctx context.Context, id uint64) error {
+	if _, err := r.directory.ExecContext(ctx,
+		`DELETE FROM user_username_index WHERE user_id = ?`, id,
+	); err != nil {
+		return fmt.Errorf("releasing username index: %w", err)
+	}
+	return nil
+}
+
+// FindByID reads the user from the shard that owns the ID.
+func (r *ShardedUserRepository) FindByID(ctx context.Context, id uint64, opts ...user.FindOption) (*user.User, error) {
+	return r.shardFor(id).FindByID(ctx, id, opts...)
+}
+
+// FindByEmail looks up the owning user ID in the email index,
+// then reads the user from its shard.
+func (r *ShardedUserRepository) FindByEmail(ctx context.Context, email string, opts ...user.FindOption) (*user.User, error) {
+	var id uint64
+	err := r.directory.QueryRowContext(ctx,
+		`SELECT user_id FROM user_email_index WHERE email = ?`, email,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up email index: %w", err)
+	}
+
+	return r.shardFor(id).FindByID(ctx, id, opts...)
+}
+
+// FindByUsername looks up the owning user ID in the username index,
+// then reads the user from its shard.
+func (r *ShardedUserRepository) FindByUsername(ctx context.Context, username string, opts ...user.FindOption) (*user.User, error) {
+	var id uint64
+	err := r.directory.QueryRowContext(ctx,
+		`SELECT user_id FROM user_username_index WHERE username = ?`, username,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up username index: %w", err)
+	}
+
+	return r.shardFor(id).FindByID(ctx, id, opts...)
+}
+
+// Patch writes p to the user's shard. A patch that sets the username
+// first moves the user's username index entry.
+//
+// The entry is renamed in place rather than deleted and reinserted, so
+// a user who loses a race for the new name keeps the old one. Users
+// without an entry yet get one inserted; INSERT IGNORE plus reading the
+// owner back covers a race for the name. If the shard write then fails,
+// the entry is put back the way it was (see restoreUsername).
+func (r *ShardedUserRepository) Patch(ctx context.Context, id uint64, p user.Patch) error {
+	if p.Username == nil {
+		return r.shardFor(id).Patch(ctx, id, p)
+	}
+	username := *p.Username
+	previous, err := r.indexedUsername(ctx, id)
+	if err != nil {
+		return err
+	}
+	if previous == username {
+		return r.shardFor(id).Patch(ctx, id, p)
+	}
+
+	if username == "" {
+		if err := r.releaseUsername(ctx, id); err != nil {
+			return err
+		}
+		if err := r.shardFor(id).Patch(ctx, id, p); err != nil {
+			return r.restoreUsername(ctx, id, previous, username, err)
+		}
+		return nil
+	}
+
+	if _, err := r.directory.ExecContext(ctx,
+		`UPDATE user_username_index SET username = ? WHERE user_id = ?`,
+		username, id,
+	); err != nil {
+		if isDuplicateEntry(err) {
+			return user.ErrUsernameTaken
+		}
+		return fmt.Errorf("updating username index: %w", err)
+	}
+	if _, err := r.directory.ExecContext(ctx,
+		`INSERT IGNORE INTO user_username_index (username, user_id) VALUES (?, ?)`,
+		username, id,
+	); err != nil {
+		return r.restoreUsername(ctx, id, previous, username, fmt.Errorf("indexing username: %w", err))
+	}
+	var owner uint64
+	if err := r.directory.QueryRowContext(ctx,
+		`SELECT user_id FROM user_username_index WHERE username = ?`, username,
+	).Scan(&owner); err != nil {
+		return r.restoreUsername(ctx, id, previous, username, fmt.Errorf("looking up username index: %w", err))
+	}
+	if owner != id {
+		return user.ErrUsernameTaken
+	}
+	if err := r.shardFor(id).Patch(ctx, id, p); err != nil {
+		return r.restoreUsername(ctx, id, previous, username, err)
+	}
+	return nil
+}
+
+// indexedUsername returns the username the index holds for id, or ""
+// if it holds none.
+func (r *ShardedUserRepository) indexedUsername(ctx context.Context, id uint64) (string, error) {
+	var username string
+	err := r.directory.QueryRowContext(ctx,
+		`SELECT username FROM user_username_index WHERE user_id = ?`, id,
+	).Scan(&username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("looking up username index: %w", err)
+	}
+	return username, nil
+}
+
+// restoreUsername puts the user's username index entry back to previous
+// ("" = none) after changing it to current failed with err, and returns
+// err with any failure to restore it. Only an entry still holding current
+// is touched: one that changed since isn't this call's to undo.
+//
+// It runs even if ctx was cancelled, the likeliest reason the change
+// failed: an index left pointing at the wrong name has to be repaired by
+// hand.
+func (r *ShardedUserRepository) restoreUsername(ctx context.Context, id uint64, previous, current string, err error) error {
+	ctx = context.WithoutCancel(ctx)
+	var cerr error
+	switch {
+	case previous == "":
+		_, cerr = r.directory.ExecContext(ctx,
+			`DELETE FROM user_username_index WHERE user_id = ? AND username = ?`, id, current)
+	case current == "":
+		_, cerr = r.directory.ExecContext(ctx,
+			`INSERT IGNORE INTO user_username_index (username, user_id) VALUES (?, ?)`, previous, id)
+	default:
+		_, cerr = r.directory.ExecContext(ctx,
+			`UPDATE user_username_index SET username = ? WHERE user_id = ? AND username = ?`, previous, id, current)
+	}
+	if cerr != nil {
+		err = errors.Join(err, fmt.Errorf("restoring username index: %w", cerr))
+	}
+	return err
+}
+
+// Update writes the user to its shard and keeps the email index in sync.
+//
+// A new email is claimed in the index first, since its unique key is the
+// only check that spans shards. If the shard write then fails, the old
+// email is put back: otherwise the index would send lookups for the new
+// address to a user whose row still has the old one.
+func (r *ShardedUserRepository) Update(ctx context.Context, u *user.User) error {
+	var previous string
+	err := r.directory.QueryRowContext(ctx,
+		`SELECT email FROM user_email_index WHERE user_id = ?`, u.ID,
+	).Scan(&previous)
+	switch {
+	case errors.Is(err, sql.ErrNoRows), err == nil && previous == u.Email:
+		// Nothing in the index to change.
+		return r.shardFor(u.ID).Update(ctx, u)
+	case err != nil:
+		return fmt.Errorf("looking up email index: %w", err)
+	}
+
+	if _, err := r.directory.ExecContext(ctx,
+		`UPDATE user_email_index SET email = ? WHERE user_id = ?`,
+		u.Email, u.ID,
+	); err != nil {
+		if isDuplicateEntry(err) {
+			return user.ErrEmailExists
+		}
+		return fmt.Errorf("updating email index: %w", err)
+	}
+	if err := r.shardFor(u.ID).Update(ctx, u); err != nil {
+		// Like restoreUsername: only our own change is undone, and even
+		// on a cancelled ctx.
+		if _, cerr := r.directory.ExecContext(context.WithoutCancel(ctx),
+			`UPDATE user_email_index SET email = ? WHERE user_id = ? AND email = ?`,
+			previous, u.ID, u.Email,
+		); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("restoring email index: %w", cerr))
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete soft-deletes the user on its shard and releases the email and
+// username, so they can be registered again.
+func (r *ShardedUserRepository) Delete(ctx context.Context, id uint64) error {
+	if err := r.shardFor(id).Delete(ctx, id); err != nil {
+		return err
+	}
+	if _, err := r.directory.ExecContext(ctx,
+		`DELETE FROM user_email_index WHERE user_id = ?`, id,
+	); err != nil {
+		return fmt.Errorf("releasing email index: %w", err)
+	}
+	return r.releaseUsername(ctx, id)
+}
+
+// SetActive sets is_active on the user's shard. The email index doesn't
+// change: a deactivated account keeps its address.
+func (r *ShardedUserRepository) SetActive(ctx context.Context, id uint64, active bool) error {
+	return r.shardFor(id).SetActive(ctx, id, active)
+}
+
+// Anonymize scrubs the user on its shard and, like Delete, releases the
+// email and username index entries: the old ones mustn't stay findable
+// there.
+func (r *ShardedUserRepository) Anonymize(ctx context.Context, id uint64, email string) error {
+	if err := r.shardFor(id).Anonymize(ctx, id, email); err != nil {
+		return err
+	}
+	if _, err := r.directory.ExecContext(ctx,
+		`DELETE FROM user_email_index WHERE user_id = ?`, id,
+	); err != nil {
+		return fmt.Errorf("releasing email index: %w", err)
+	}
+	return r.releaseUsername(ctx, id)
+}
+
+// List queries every shard in parallel and merges the results (scatter-gather).
+//
+// Each shard returns its own first `limit` rows after the cursor.
+// The global first `limit` rows must be among those, so merging the
+// per-shard pages and truncating gives the correct page.
+func (r *ShardedUserRepository) List(ctx context.Context, params user.ListParams) ([]*user.User, error) {
+	results := make([][]*user.User, len(r.shards))
+	errs := make([]error, len(r.shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = shard.List(ctx, params)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var merged []*user.User
+	for _, users := range results {
+		merged = append(merged, users...)
+	}
+	sort.Slice(merged, func(i, j int) bool {
+		return params.Before(merged[i], merged[j])
+	})
+	if len(merged) > params.Limit {
+		merged = merged[:params.Limit]
+	}
+	return merged, nil
+}
+
+// Count adds up every shard's count, queried in parallel.
+func (r *ShardedUserRepository) Count(ctx context.Context, filter user.ListFilter) (int64, error) {
+	counts := make([]int64, len(r.shards))
+	errs := make([]error, len(r.shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts[i], errs[i] = shard.Count(ctx, filter)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
+
+// Search queries every shard in parallel for its best offset+limit
+// matches, and merges them. As in List, the global page must be among
+// those.
+//
+// Each shard scores against its own users, so a word that's rare on one
+// shard and common on another ranks differently on each. Across shards
+// the order is close to, not exactly, what one database would give.
+func (r *ShardedUserRepository) Search(ctx context.Context, params user.SearchParams) ([]user.SearchHit, error) {
+	results := make([][]user.SearchHit, len(r.shards))
+	errs := make([]error, len(r.shards))
+
+	perShard := params
+	perShard.Offset, perShard.Limit = 0, params.Offset+params.Limit
+
+	var wg sync.WaitGroup
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = shard.Search(ctx, perShard)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	var merged []user.SearchHit
+	for _, hits := range results {
+		merged = append(merged, hits...)
+	}
+	user.SortHits(merged)
+	if len(merged) <= params.Offset {
+		return nil, nil
+	}
+	merged = merged[params.Offset:]
+	if len(merged) > params.Limit {
+		merged = merged[:params.Limit]
+	}
+	return merged, nil
+}
+
+// SearchCount adds up every shard's count, queried in parallel.
+func (r *ShardedUserRepository) SearchCount(ctx context.Context, params user.SearchParams) (int64, error) {
+	counts := make([]int64, len(r.shards))
+	errs := make([]error, len(r.shards))
+
+	var wg sync.WaitGroup
+	for i, shard := range r.shards {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts[i], errs[i] = shard.SearchCount(ctx, params)
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total, nil
+}
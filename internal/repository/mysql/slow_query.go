@@ -0,0 +1,85 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// SlowQueryLog logs repository queries that take longer than a threshold.
+//
+// Both settings are functions so they can change while the server runs
+// (see package tunables): lower the threshold during an incident to see
+// more, lower the sample rate when a slow database floods the log.
+//
+// The time measured is until MySQL starts returning results, not until
+// the caller has read every row, so it reflects the database, not the
+// code consuming the rows.
+type SlowQueryLog struct {
+	threshold  func() time.Duration // Zero disables the log
+	sampleRate func() float64       // Fraction of slow queries logged (0.0-1.0)
+	logger     *slog.Logger
+}
+
+// NewSlowQueryLog creates a slow query log.
+func NewSlowQueryLog(threshold func() time.Duration, sampleRate func() float64) *SlowQueryLog {
+	return &SlowQueryLog{
+		threshold:  threshold,
+		sampleRate: sampleRate,
+		logger:     slog.Default(),
+	}
+}
+
+// wrap returns a dbtx that forwards to inner and times every query.
+func (l *SlowQueryLog) wrap(inner dbtx) dbtx {
+	return &timedDB{inner: inner, log: l}
+}
+
+// observe logs query if it took at least the threshold and is sampled.
+func (l *SlowQueryLog) observe(query string, start time.Time, err error) {
+	threshold := l.threshold()
+	elapsed := time.Since(start)
+	if threshold <= 0 || elapsed < threshold {
+		return
+	}
+	if rand.Float64() >= l.sampleRate() {
+		return
+	}
+	l.logger.Warn("slow query",
+		"duration", elapsed.Round(time.Millisecond),
+		"threshold", threshold,
+		"failed", err != nil,
+		"query", compactSQL(query),
+	)
+}
+
+// timedDB forwards queries to inner and reports their duration.
+type timedDB struct {
+	inner dbtx
+	log   *SlowQueryLog
+}
+
+func (t *timedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	result, err := t.inner.ExecContext(ctx, query, args...)
+	t.log.observe(query, start, err)
+	return result, err
+}
+
+func (t *timedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := t.inner.QueryContext(ctx, query, args...)
+	t.log.observe(query, start, err)
+	return rows, err
+}
+
+// QueryRowContext runs the query before returning, so timing it here
+// is accurate; its error (if any) surfaces later, from Scan.
+func (t *timedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	start := time.Now()
+	row := t.inner.QueryRowContext(ctx, query, args...)
+	t.log.observe(query, start, row.Err())
+	return row
+}
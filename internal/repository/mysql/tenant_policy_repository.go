@@ -0,0 +1,137 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go-basics/internal/domain/tenant"
+)
+
+// TenantPolicyRepository implements tenant.Repository for MySQL.
+// Policies live in the main database (the directory in sharded mode).
+//
+// Each list is a JSON array in a TEXT column, like job_spool's
+// error_trace: the lists are only ever read and written whole, so a
+// table per list would add joins for nothing.
+type TenantPolicyRepository struct {
+	db *sql.DB
+}
+
+// NewTenantPolicyRepository creates a new tenant policy repository.
+func NewTenantPolicyRepository(db *sql.DB) tenant.Repository {
+	return &TenantPolicyRepository{db: db}
+}
+
+// tenantPolicyColumns is the SELECT list scanTenantPolicy expects.
+const tenantPolicyColumns = `tenant_id, cors_origins, redirect_uris, webhook_urls, updated_at`
+
+// Policies returns every policy, by tenant ID.
+func (r *TenantPolicyRepository) Policies(ctx context.Context) ([]tenant.Policy, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT `+tenantPolicyColumns+` FROM tenant_policies ORDER BY tenant_id`)
+	if err != nil {
+		return nil, fmt.Errorf("querying tenant policies: %w", err)
+	}
+	defer rows.Close()
+
+	var policies []tenant.Policy
+	for rows.Next() {
+		p, err := scanTenantPolicy(rows)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating tenant policies: %w", err)
+	}
+	return policies, nil
+}
+
+// Policy returns one tenant's policy, or tenant.ErrPolicyNotFound.
+func (r *TenantPolicyRepository) Policy(ctx context.Context, tenantID string) (*tenant.Policy, error) {
+	p, err := scanTenantPolicy(r.db.QueryRowContext(ctx,
+		`SELECT `+tenantPolicyColumns+` FROM tenant_policies WHERE tenant_id = ?`, tenantID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, tenant.ErrPolicyNotFound
+	}
+	return p, err
+}
+
+// SavePolicy inserts or replaces the tenant's policy. VALUES() as in
+// NotificationRepository.SetFrequency.
+func (r *TenantPolicyRepository) SavePolicy(ctx context.Context, p *tenant.Policy) error {
+	origins, err := encodeList(p.CORSOrigins)
+	if err != nil {
+		return err
+	}
+	redirects, err := encodeList(p.RedirectURIs)
+	if err != nil {
+		return err
+	}
+	webhooks, err := encodeList(p.WebhookURLs)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx,
+		`INSERT INTO tenant_policies (tenant_id, cors_origins, redirect_uris, webhook_urls, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE cors_origins = VALUES(cors_origins), redirect_uris = VALUES(redirect_uris),
+			webhook_urls = VALUES(webhook_urls), updated_at = VALUES(updated_at)`,
+		p.TenantID, origins, redirects, webhooks, p.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("storing tenant policy: %w", err)
+	}
+	return nil
+}
+
+// DeletePolicy removes the tenant's policy, if it has one.
+func (r *TenantPolicyRepository) DeletePolicy(ctx context.Context, tenantID string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM tenant_policies WHERE tenant_id = ?`, tenantID); err != nil {
+		return fmt.Errorf("deleting tenant policy: %w", err)
+	}
+	return nil
+}
+
+// scanTenantPolicy reads one row of tenantPolicyColumns. sql.ErrNoRows
+// is returned unwrapped, for Policy to recognize.
+func scanTenantPolicy(row interface{ Scan(...interface{}) error }) (*tenant.Policy, error) {
+	var p tenant.Policy
+	var origins, redirects, webhooks string
+	err := row.Scan(&p.TenantID, &origins, &redirects, &webhooks, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("scanning tenant policy: %w", err)
+	}
+	for _, list := range []struct {
+		column string
+		raw    string
+		into   *[]string
+	}{
+		{"cors_origins", origins, &p.CORSOrigins},
+		{"redirect_uris", redirects, &p.RedirectURIs},
+		{"webhook_urls", webhooks, &p.WebhookURLs},
+	} {
+		if err := json.Unmarshal([]byte(list.raw), list.into); err != nil {
+			return nil, fmt.Errorf("decoding %s of tenant %s: %w", list.column, p.TenantID, err)
+		}
+	}
+	return &p, nil
+}
+
+// encodeList encodes list as a JSON array; nil as [], not null.
+func encodeList(list []string) (string, error) {
+	if list == nil {
+		list = []string{}
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("encoding list: %w", err)
+	}
+	return string(data), nil
+}
@@ -0,0 +1,90 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// TokenRepository stores single-use secret tokens for MySQL: password
+// reset tokens (user.ResetTokenRepository) and email change tokens
+// (user.EmailChangeTokenRepository). Both have the same rules, so they
+// share the code and differ only in their table.
+// Tokens live in the main database (the directory in sharded mode).
+type TokenRepository struct {
+	db         dbtx
+	table      string // A constant below, never user input
+	errInvalid error  // Returned by Consume for an unusable token
+}
+
+// NewResetTokenRepository creates a new reset token repository.
+func NewResetTokenRepository(db *sql.DB) user.ResetTokenRepository {
+	return &TokenRepository{db: scoped(db), table: "password_reset_tokens", errInvalid: user.ErrInvalidResetToken}
+}
+
+// NewEmailChangeTokenRepository creates a new email change token repository.
+func NewEmailChangeTokenRepository(db *sql.DB) user.EmailChangeTokenRepository {
+	return &TokenRepository{db: scoped(db), table: "email_change_tokens", errInvalid: user.ErrInvalidEmailChangeToken}
+}
+
+// Create stores a token hash.
+func (r *TokenRepository) Create(ctx context.Context, userID uint64, tokenHash string, expiresAt time.Time) error {
+	query := `
+		INSERT INTO ` + r.table + ` (token_hash, user_id, expires_at)
+		VALUES (?, ?, ?)
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, tokenHash, userID, expiresAt.UTC()); err != nil {
+		return fmt.Errorf("inserting token: %w", err)
+	}
+	return nil
+}
+
+// Consume marks the token as used and returns its owner.
+//
+// WHY UPDATE FIRST, THEN SELECT?
+// A SELECT followed by an UPDATE would let two concurrent requests both
+// see the token as unused. The conditional UPDATE is atomic: only one
+// request can flip used_at from NULL, and only that one gets a row affected.
+//
+// The current time comes from Go, like expires_at in Create, so both sides
+// of the comparison are converted the same way by the driver.
+func (r *TokenRepository) Consume(ctx context.Context, tokenHash string) (uint64, error) {
+	now := time.Now().UTC()
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE `+r.table+`
+		SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+	`, now, tokenHash, now)
+	if err != nil {
+		return 0, fmt.Errorf("consuming token: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return 0, r.errInvalid
+	}
+
+	var userID uint64
+	if err := r.db.QueryRowContext(ctx,
+		`SELECT user_id FROM `+r.table+` WHERE token_hash = ?`, tokenHash,
+	).Scan(&userID); err != nil {
+		return 0, fmt.Errorf("reading token: %w", err)
+	}
+	return userID, nil
+}
+
+// DeleteForUser removes all of the user's tokens.
+func (r *TokenRepository) DeleteForUser(ctx context.Context, userID uint64) error {
+	if _, err := r.db.ExecContext(ctx,
+		`DELETE FROM `+r.table+` WHERE user_id = ?`, userID,
+	); err != nil {
+		return fmt.Errorf("deleting tokens: %w", err)
+	}
+	return nil
+}
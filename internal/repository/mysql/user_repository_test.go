@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"go-basics/internal/domain/user"
+)
+
+// execRecorder is a database that records the statements it's sent,
+// with their arguments, and runs none of them.
+type execRecorder struct {
+	queries []string
+	args    [][]driver.NamedValue
+}
+
+func (r *execRecorder) Connect(context.Context) (driver.Conn, error) { return r, nil }
+func (r *execRecorder) Driver() driver.Driver                        { return nil }
+func (r *execRecorder) Prepare(string) (driver.Stmt, error)          { return nil, errors.New("not supported") }
+func (r *execRecorder) Close() error                                 { return nil }
+func (r *execRecorder) Begin() (driver.Tx, error)                    { return nil, errors.New("not supported") }
+
+func (r *execRecorder) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r.queries = append(r.queries, strings.Join(strings.Fields(query), " "))
+	r.args = append(r.args, args)
+	return driver.RowsAffected(1), nil
+}
+
+// TestPatchWritesOnlySentColumns checks the UPDATE a patch sends: the
+// columns it sets and updated_at, nothing else, so every column left
+// out keeps its stored value. A patch setting nothing sends nothing.
+func TestPatchWritesOnlySentColumns(t *testing.T) {
+	recorder := &execRecorder{}
+	db := sql.OpenDB(recorder)
+	defer db.Close()
+	repo := NewUserRepository(db)
+
+	if err := repo.Patch(context.Background(), 7, user.Patch{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(recorder.queries) != 0 {
+		t.Fatalf("an empty patch sent %q, want nothing", recorder.queries)
+	}
+
+	for _, tc := range []struct {
+		username string
+		want     interface{}
+	}{
+		{"ann", "ann"},
+		{"", nil}, // Removing it stores NULL, which the unique key allows many of
+	} {
+		recorder.queries, recorder.args = nil, nil
+		if err := repo.Patch(context.Background(), 7, user.Patch{Username: &tc.username}); err != nil {
+			t.Fatal(err)
+		}
+		const want = "UPDATE users SET username = ?, updated_at = NOW() WHERE id = ? AND deleted_at IS NULL"
+		if len(recorder.queries) != 1 || recorder.queries[0] != want {
+			t.Fatalf("sent %q, want [%q]", recorder.queries, want)
+		}
+		args := recorder.args[0]
+		if len(args) != 2 || args[0].Value != tc.want || args[1].Value != int64(7) {
+			t.Errorf("username %q: args = %+v, want [%v 7]", tc.username, args, tc.want)
+		}
+	}
+}
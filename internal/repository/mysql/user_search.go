@@ -0,0 +1,141 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"go-basics/internal/domain/user"
+)
+
+// InnoDB's FULLTEXT defaults. A word shorter than ftMinTokenSize, or in
+// ftStopwords, is never indexed, so a search for it finds nothing.
+// Servers can change both (innodb_ft_min_token_size,
+// innodb_ft_server_stopword_table); these are what a stock MySQL 8 uses.
+const ftMinTokenSize = 3
+
+var ftStopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "com": true, "de": true, "en": true, "for": true,
+	"from": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true,
+	"where": true, "who": true, "will": true, "with": true, "und": true,
+	"www": true,
+}
+
+// fullTextSearchable reports whether the FULLTEXT index can answer a
+// search for terms: whether every one of them was indexed.
+func fullTextSearchable(terms []string) bool {
+	for _, t := range terms {
+		if utf8.RuneCountInString(t) < ftMinTokenSize || ftStopwords[t] {
+			return false
+		}
+	}
+	return true
+}
+
+// searchMatch returns the score expression and WHERE conditions for a
+// search, and the arguments of each.
+//
+// FULLTEXT, WITH A LIKE FALLBACK:
+// The FULLTEXT index on email splits each address into words at the
+// punctuation ("ann.smith@example.com" is ann, smith, example, com), so
+//
+//	MATCH(email) AGAINST('+ann* +smi*' IN BOOLEAN MODE)
+//
+// finds every email with a word starting "ann" and one starting "smi"
+// without reading the table, and scores rarer words higher.
+//
+// It can't find what it never indexed, though: "jo" in jo@example.com
+// is too short, "com" a stopword. A search for those falls back to
+//
+//	email LIKE '%jo%' AND email LIKE '%com%'
+//
+// which finds them anywhere in the email, by reading every active row.
+// Its score is coarse: the whole email, then a prefix, then anywhere.
+func searchMatch(params user.SearchParams) (score string, scoreArgs []interface{}, where string, whereArgs []interface{}) {
+	terms := params.Terms()
+	if fullTextSearchable(terms) {
+		// Terms are letters and digits only (see SearchParams.Terms), so
+		// nothing in them is a boolean-mode operator.
+		against := "+" + strings.Join(terms, "* +") + "*"
+		match := `MATCH(email) AGAINST(? IN BOOLEAN MODE)`
+		return match, []interface{}{against}, match, []interface{}{against}
+	}
+
+	conditions := make([]string, len(terms))
+	for i, t := range terms {
+		conditions[i] = `email LIKE ? ESCAPE '!'`
+		whereArgs = append(whereArgs, "%"+likeEscaper.Replace(t)+"%")
+	}
+	score = `(email = ?) * 4 + (email LIKE ? ESCAPE '!') * 2 + 1`
+	scoreArgs = []interface{}{params.Query, likeEscaper.Replace(terms[0]) + "%"}
+	return score, scoreArgs, strings.Join(conditions, ` AND `), whereArgs
+}
+
+// searchQuery selects a page of active users matching params, best
+// first, each followed by its score, and returns it with its arguments.
+func searchQuery(p projection, params user.SearchParams) (string, []interface{}) {
+	score, scoreArgs, where, whereArgs := searchMatch(params)
+	query := `
+		SELECT ` + p.selectList() + `, ` + score + ` AS score
+		FROM users
+		WHERE deleted_at IS NULL AND ` + where + `
+		ORDER BY score DESC, id
+		LIMIT ? OFFSET ?`
+	args := append(scoreArgs, whereArgs...)
+	return query, append(args, params.Limit, params.Offset)
+}
+
+// searchCountQuery counts the active users matching params, the rows
+// searchQuery pages through, and returns it with its arguments.
+func searchCountQuery(params user.SearchParams) (string, []interface{}) {
+	_, _, where, args := searchMatch(params)
+	return `SELECT COUNT(*) FROM users WHERE deleted_at IS NULL AND ` + where, args
+}
+
+// Search returns a page of the active users whose email matches
+// params.Query, best match first (see searchMatch).
+func (r *UserRepository) Search(ctx context.Context, params user.SearchParams) ([]user.SearchHit, error) {
+	proj, err := newProjection(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query, args := searchQuery(proj, params)
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("searching users: %w", err)
+	}
+	defer rows.Close()
+
+	hits := make([]user.SearchHit, 0, params.Limit)
+	for rows.Next() {
+		var u userRow
+		var score float64
+		if err := rows.Scan(append(proj.scanDest(&u), &score)...); err != nil {
+			return nil, fmt.Errorf("scanning user: %w", err)
+		}
+		domainUser, err := u.toDomain(r.secrets)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, user.SearchHit{User: domainUser, Score: score})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterating users: %w", err)
+	}
+	return hits, nil
+}
+
+// SearchCount returns the number of active users matching params.Query.
+func (r *UserRepository) SearchCount(ctx context.Context, params user.SearchParams) (int64, error) {
+	query, args := searchCountQuery(params)
+	var n int64
+	if err := r.db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, fmt.Errorf("counting search results: %w", err)
+	}
+	return n, nil
+}
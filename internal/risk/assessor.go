@@ -0,0 +1,222 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// History is what's known about an account's earlier sign-ins.
+type History interface {
+	// Profile returns the history of the account with email, as seen
+	// from userAgent. It returns a zero Profile, not an error, when no
+	// account has the email.
+	Profile(ctx context.Context, email, userAgent string) (Profile, error)
+
+	// RecordCountry notes that the user signed in from country.
+	RecordCountry(ctx context.Context, userID uint64, country string) error
+}
+
+// Profile is an account's sign-in history.
+type Profile struct {
+	UserID      uint64   // 0 when no account has the email
+	KnownDevice bool     // An active session is from the same user agent
+	Countries   []string // Where the user signed in from before
+}
+
+// CountryStore keeps the countries each user signed in from, for
+// History implementations.
+type CountryStore interface {
+	// Countries returns the countries the user signed in from.
+	Countries(ctx context.Context, userID uint64) ([]string, error)
+
+	// RecordCountry adds country to the user's, or notes it was seen
+	// again.
+	RecordCountry(ctx context.Context, userID uint64, country string) error
+}
+
+// Locator finds the country a request comes from, as an ISO 3166 code,
+// or "" when it can't tell.
+type Locator interface {
+	Locate(r *http.Request) string
+}
+
+// HeaderLocator reads the country from a request header set by a proxy
+// in front of the app, like Cloudflare's CF-IPCountry.
+//
+// SECURITY: a client can send any header it likes. Use this only behind
+// a proxy that sets the header on every request, overwriting what the
+// client sent; otherwise anyone can claim the victim's country.
+type HeaderLocator string
+
+// Locate implements Locator.
+func (h HeaderLocator) Locate(r *http.Request) string {
+	country := strings.ToUpper(strings.TrimSpace(r.Header.Get(string(h))))
+	// Cloudflare sends XX for unknown and T1 for Tor: neither is a place.
+	if len(country) != 2 || country == "XX" || country == "T1" {
+		return ""
+	}
+	return country
+}
+
+// disposableDomains are widely used throwaway mail providers. Deployments
+// add their own with WithDisposableDomains (RISK_DISPOSABLE_DOMAINS).
+var disposableDomains = []string{
+	"10minutemail.com",
+	"discard.email",
+	"dispostable.com",
+	"getnada.com",
+	"guerrillamail.com",
+	"mailinator.com",
+	"maildrop.cc",
+	"mintemail.com",
+	"sharklasers.com",
+	"temp-mail.org",
+	"tempmail.com",
+	"throwawaymail.com",
+	"trashmail.com",
+	"yopmail.com",
+}
+
+// Assessor scores sign-in attempts and decides what each one takes.
+type Assessor struct {
+	policy     Policy
+	history    History
+	failures   *Failures
+	scorer     Scorer
+	locator    Locator         // nil: the geo signal never fires
+	disposable map[string]bool // Lowercase domains
+	audit      func(ctx context.Context, decision Decision)
+}
+
+// Option configures an Assessor.
+type Option func(*Assessor)
+
+// WithScorer replaces the default scorer, DefaultWeights.
+func WithScorer(scorer Scorer) Option {
+	return func(a *Assessor) {
+		a.scorer = scorer
+	}
+}
+
+// WithLocator turns the geo signal on: attempts from a country the
+// account never signed in from raise the score.
+func WithLocator(locator Locator) Option {
+	return func(a *Assessor) {
+		a.locator = locator
+	}
+}
+
+// WithDisposableDomains counts addresses at domains, and their
+// subdomains, as disposable, on top of the built-in list.
+func WithDisposableDomains(domains ...string) Option {
+	return func(a *Assessor) {
+		for _, domain := range domains {
+			if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+				a.disposable[domain] = true
+			}
+		}
+	}
+}
+
+// New creates an Assessor deciding by policy. audit is called with every
+// decision, including the ones that allow the attempt.
+func New(policy Policy, history History, failures *Failures, audit func(ctx context.Context, decision Decision), opts ...Option) *Assessor {
+	a := &Assessor{
+		policy:     policy,
+		history:    history,
+		failures:   failures,
+		scorer:     DefaultWeights,
+		disposable: make(map[string]bool, len(disposableDomains)),
+		audit:      audit,
+	}
+	for _, domain := range disposableDomains {
+		a.disposable[domain] = true
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Policy returns the policy the Assessor decides by.
+func (a *Assessor) Policy() Policy {
+	return a.policy
+}
+
+// Locate returns the country r comes from, or "" without a Locator.
+func (a *Assessor) Locate(r *http.Request) string {
+	if a.locator == nil {
+		return ""
+	}
+	return a.locator.Locate(r)
+}
+
+// Assess gathers the attempt's signals, scores them, and decides.
+//
+// It runs before the password is checked, and an email without an
+// account is assessed like an account with no history (a new device, no
+// known countries): the decision mustn't tell a guesser which emails are
+// registered.
+func (a *Assessor) Assess(ctx context.Context, attempt Attempt) (Decision, error) {
+	profile, err := a.history.Profile(ctx, attempt.Email, attempt.UserAgent)
+	if err != nil {
+		return Decision{}, fmt.Errorf("reading sign-in history: %w", err)
+	}
+
+	signals := Signals{
+		NewDevice:       !profile.KnownDevice,
+		GeoAnomaly:      attempt.Country != "" && len(profile.Countries) > 0 && !containsFold(profile.Countries, attempt.Country),
+		FailedAttempts:  a.failures.Count(attempt.Email),
+		DisposableEmail: a.isDisposable(attempt.Email),
+	}
+	score := min(max(a.scorer.Score(ctx, attempt, signals), 0), MaxScore)
+
+	decision := Decision{
+		Attempt: attempt,
+		UserID:  profile.UserID,
+		Signals: signals,
+		Score:   score,
+		Action:  a.policy.Action(score),
+		policy:  a.policy,
+	}
+	a.audit(ctx, decision)
+	return decision, nil
+}
+
+// Succeeded records a successful sign-in by userID: the attempt's
+// country becomes a known one, and the email's failures are forgotten.
+func (a *Assessor) Succeeded(ctx context.Context, userID uint64, attempt Attempt) error {
+	a.failures.Reset(attempt.Email)
+	if attempt.Country == "" {
+		return nil
+	}
+	if err := a.history.RecordCountry(ctx, userID, attempt.Country); err != nil {
+		return fmt.Errorf("recording sign-in country: %w", err)
+	}
+	return nil
+}
+
+// isDisposable reports whether email's domain, or a domain above it, is
+// a disposable one.
+func (a *Assessor) isDisposable(email string) bool {
+	_, domain, ok := strings.Cut(normalizeEmail(email), "@")
+	for ok && domain != "" {
+		if a.disposable[domain] {
+			return true
+		}
+		_, domain, ok = strings.Cut(domain, ".")
+	}
+	return false
+}
+
+// containsFold reports whether list holds s, ignoring case.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package risk
+
+import (
+	"strings"
+	"time"
+
+	"go-basics/internal/cache"
+)
+
+// maxTrackedEmails bounds the emails Failures remembers. Past it, the
+// least recently failed are forgotten first.
+const maxTrackedEmails = 100000
+
+// Failures counts recent failed logins per email, for the
+// failed-attempts signal. Each failure keeps the count for another
+// window; a quiet window, or a successful login, resets it.
+//
+// Counts are kept per email, not per account, so an email that matches
+// no account scores like one that does: the signal can't tell anyone
+// which emails are registered.
+//
+// Like the in-memory rate limit store, each instance counts only the
+// failures it saw. Behind a load balancer that spreads one client's
+// requests, the counts are lower than the truth; the rate limits, which
+// can be shared through Redis, still cap the guessing.
+type Failures struct {
+	window time.Duration
+	counts *cache.TTL[string, int] // Normalized email -> failures
+}
+
+// NewFailures creates an empty counter whose counts last window past the
+// latest failure. opts are passed to its cache, e.g. cache.WithMetrics.
+func NewFailures(window time.Duration, opts ...cache.Option) *Failures {
+	opts = append([]cache.Option{cache.WithMaxEntries(maxTrackedEmails)}, opts...)
+	return &Failures{window: window, counts: cache.New[string, int]("risk_login_failures", opts...)}
+}
+
+// Add counts a failed login for email.
+func (f *Failures) Add(email string) {
+	if email = normalizeEmail(email); email == "" {
+		return
+	}
+	f.counts.Update(email, func(count int, _ bool) (int, time.Duration) {
+		return count + 1, f.window
+	})
+}
+
+// Reset forgets email's failures, after it signed in.
+func (f *Failures) Reset(email string) {
+	f.counts.Delete(normalizeEmail(email))
+}
+
+// Count returns email's recent failures.
+func (f *Failures) Count(email string) int {
+	count, _ := f.counts.Get(normalizeEmail(email))
+	return count
+}
+
+// normalizeEmail lowercases email and trims spaces, so "Bob@Example.com "
+// and "bob@example.com" count together.
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,178 @@
+// Package risk scores sign-in attempts, and decides from the score what
+// an attempt takes: nothing more, a CAPTCHA, a second factor, or nothing
+// at all (it's blocked).
+//
+// WHY A SCORE, NOT ONE RULE PER SIGNAL?
+// Each signal alone is weak evidence: people buy new phones, travel,
+// mistype passwords, and sign up with throwaway addresses for good
+// reasons. Asking for more whenever one of them fires annoys everyone;
+// ignoring them misses the attacker who trips three at once. A score
+// adds the evidence up, so friction grows with it: a new browser alone
+// passes, a new browser in another country after five wrong passwords
+// doesn't. That's what "progressive" means here.
+//
+// The Scorer that turns signals into a score is pluggable (see Weights
+// for the default), and the Policy that turns scores into actions is
+// configuration (RISK_POLICY). Every decision is passed to an audit
+// function, allowed or not, so a policy can be tuned from what it did.
+package risk
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxScore is the highest score. Scorers return 0 to MaxScore.
+const MaxScore = 100
+
+// never is the threshold of an action the policy doesn't take: no score
+// reaches it.
+const never = MaxScore + 1
+
+// Sentinel errors.
+var (
+	// ErrBlocked is returned for an attempt whose score reached the
+	// policy's block threshold.
+	ErrBlocked = errors.New("sign-in blocked as too risky")
+
+	// ErrSecondFactorRequired is returned for an attempt whose score
+	// reached the policy's 2FA threshold, on an account without 2FA:
+	// there's no second factor to ask for.
+	ErrSecondFactorRequired = errors.New("sign-in requires two-factor authentication")
+)
+
+// Action is what an attempt takes, given its score.
+type Action string
+
+// Actions, from least to most friction.
+const (
+	ActionAllow   Action = "allow"           // Nothing more
+	ActionCaptcha Action = "require_captcha" // A solved CAPTCHA
+	ActionMFA     Action = "require_mfa"     // A CAPTCHA (if the policy asks for one) and a second factor
+	ActionBlock   Action = "block"           // Refused outright
+)
+
+// Attempt is one sign-in attempt, as the client presented it. Email is
+// the login as sent, an email or a username.
+type Attempt struct {
+	Email     string
+	IPAddress string
+	UserAgent string
+	Country   string // ISO 3166 code from the Locator; empty when unknown
+}
+
+// Signals are the facts about an attempt that raise its risk.
+type Signals struct {
+	NewDevice       bool // No active session of the account's is from this user agent
+	GeoAnomaly      bool // The account never signed in from this country before
+	FailedAttempts  int  // Recent failed logins for the email (see Failures)
+	DisposableEmail bool // The email is at a throwaway mail provider
+}
+
+// Names lists the signals that fired, for audit records and logs.
+func (s Signals) Names() []string {
+	var names []string
+	if s.NewDevice {
+		names = append(names, "new_device")
+	}
+	if s.GeoAnomaly {
+		names = append(names, "geo_anomaly")
+	}
+	if s.FailedAttempts > 0 {
+		names = append(names, fmt.Sprintf("failed_attempts=%d", s.FailedAttempts))
+	}
+	if s.DisposableEmail {
+		names = append(names, "disposable_email")
+	}
+	return names
+}
+
+// Policy maps scores to actions: an attempt takes every action whose
+// threshold its score reaches. Thresholds run from 0 (every attempt) to
+// MaxScore; an action left out of the policy is never taken.
+//
+// The actions add up rather than replace each other: with captcha=30 and
+// mfa=60, an attempt scoring 70 needs both a CAPTCHA and a second factor.
+type Policy struct {
+	Captcha int
+	MFA     int
+	Block   int
+}
+
+// ParsePolicy parses "action=threshold" pairs, as in RISK_POLICY:
+// "captcha=30", "mfa=60", "block=90". Actions not listed are never taken.
+func ParsePolicy(pairs []string) (Policy, error) {
+	p := Policy{Captcha: never, MFA: never, Block: never}
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return Policy{}, fmt.Errorf("policy entry %q: must be action=threshold", pair)
+		}
+		threshold, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || threshold < 0 || threshold > MaxScore {
+			return Policy{}, fmt.Errorf("policy entry %q: the threshold must be 0 to %d", pair, MaxScore)
+		}
+		switch strings.TrimSpace(name) {
+		case "captcha":
+			p.Captcha = threshold
+		case "mfa":
+			p.MFA = threshold
+		case "block":
+			p.Block = threshold
+		default:
+			return Policy{}, fmt.Errorf("policy entry %q: the actions are captcha, mfa, and block", pair)
+		}
+	}
+	return p, nil
+}
+
+// Takes reports whether the policy takes action at all.
+func (p Policy) Takes(action Action) bool {
+	return p.threshold(action) <= MaxScore
+}
+
+// Action returns the strongest action score reaches.
+func (p Policy) Action(score int) Action {
+	for _, action := range []Action{ActionBlock, ActionMFA, ActionCaptcha} {
+		if score >= p.threshold(action) {
+			return action
+		}
+	}
+	return ActionAllow
+}
+
+// threshold returns the score action starts at.
+func (p Policy) threshold(action Action) int {
+	switch action {
+	case ActionAllow:
+		return 0
+	case ActionCaptcha:
+		return p.Captcha
+	case ActionMFA:
+		return p.MFA
+	case ActionBlock:
+		return p.Block
+	default:
+		return never
+	}
+}
+
+// Decision is an assessed attempt.
+type Decision struct {
+	Attempt Attempt
+	UserID  uint64 // The account the email belongs to; 0 when there's none
+	Signals Signals
+	Score   int
+	Action  Action // The strongest action the score reached
+
+	policy Policy
+}
+
+// Requires reports whether the attempt's score reached action's
+// threshold. Check each action, not only Action: they add up (see
+// Policy).
+func (d Decision) Requires(action Action) bool {
+	return d.Score >= d.policy.threshold(action)
+}
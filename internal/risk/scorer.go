@@ -0,0 +1,96 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Scorer turns an attempt's signals into a score from 0 to MaxScore.
+//
+// Weights is the default. Plug in another (see WithScorer) to weigh
+// signals by more than a table can: a model trained on past account
+// takeovers, or a call to a fraud detection service. Scores outside 0 to
+// MaxScore are clamped.
+type Scorer interface {
+	Score(ctx context.Context, attempt Attempt, signals Signals) int
+}
+
+// ScorerFunc adapts a function to Scorer, like http.HandlerFunc.
+type ScorerFunc func(ctx context.Context, attempt Attempt, signals Signals) int
+
+// Score implements Scorer.
+func (f ScorerFunc) Score(ctx context.Context, attempt Attempt, signals Signals) int {
+	return f(ctx, attempt, signals)
+}
+
+// Weights is a Scorer that adds up points per signal that fired.
+// FailedAttempt counts once per recent failure, up to maxCountedFailures.
+type Weights struct {
+	NewDevice       int
+	GeoAnomaly      int
+	FailedAttempt   int
+	DisposableEmail int
+}
+
+// maxCountedFailures caps the failures Weights counts, so the failures
+// alone can't outweigh everything else: past a handful, more of them say
+// little more.
+const maxCountedFailures = 5
+
+// DefaultWeights are the points per signal unless RISK_WEIGHTS says
+// otherwise. A new device or a throwaway address alone stays low; a new
+// country counts for more, being harder to explain by an ordinary day.
+var DefaultWeights = Weights{
+	NewDevice:       20,
+	GeoAnomaly:      35,
+	FailedAttempt:   10,
+	DisposableEmail: 25,
+}
+
+// ParseWeights parses "signal=points" pairs, as in RISK_WEIGHTS, over
+// DefaultWeights: "new_device=30", "geo_anomaly=40",
+// "failed_attempt=15", "disposable_email=0".
+func ParseWeights(pairs []string) (Weights, error) {
+	w := DefaultWeights
+	for _, pair := range pairs {
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return Weights{}, fmt.Errorf("weight entry %q: must be signal=points", pair)
+		}
+		points, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || points < 0 || points > MaxScore {
+			return Weights{}, fmt.Errorf("weight entry %q: points must be 0 to %d", pair, MaxScore)
+		}
+		switch strings.TrimSpace(name) {
+		case "new_device":
+			w.NewDevice = points
+		case "geo_anomaly":
+			w.GeoAnomaly = points
+		case "failed_attempt":
+			w.FailedAttempt = points
+		case "disposable_email":
+			w.DisposableEmail = points
+		default:
+			return Weights{}, fmt.Errorf("weight entry %q: the signals are new_device, geo_anomaly, failed_attempt, and disposable_email", pair)
+		}
+	}
+	return w, nil
+}
+
+// Score implements Scorer.
+func (w Weights) Score(_ context.Context, _ Attempt, signals Signals) int {
+	score := 0
+	if signals.NewDevice {
+		score += w.NewDevice
+	}
+	if signals.GeoAnomaly {
+		score += w.GeoAnomaly
+	}
+	score += w.FailedAttempt * min(signals.FailedAttempts, maxCountedFailures)
+	if signals.DisposableEmail {
+		score += w.DisposableEmail
+	}
+	return score
+}
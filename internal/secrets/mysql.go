@@ -0,0 +1,176 @@
+package secrets
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// DBCredentials is a MySQL user and password read from files
+// (DB_USER_FILE, DB_PASSWORD_FILE), for pools that keep working when
+// they're rotated.
+//
+// HOW THE POOL MOVES OVER:
+// Option makes the driver log in with the current credentials on every
+// new connection, whatever the DSN says. Connector marks each
+// connection with the credentials it logged in with; after a Reload,
+// database/sql asks older connections whether they're still valid
+// before reusing them, they say no, and the pool dials new ones. A
+// connection busy with a query finishes it first. So the old
+// credentials need to keep working for as long as one query or
+// transaction takes, which Vault's lease overlap and a Kubernetes
+// rollout of a new password both give.
+type DBCredentials struct {
+	userFile     string // "" keeps each DSN's user
+	passwordFile string
+
+	login      atomic.Pointer[dbLogin]
+	generation atomic.Uint64 // Bumped on every change; older connections are discarded
+}
+
+// dbLogin is one version of the credentials.
+type dbLogin struct {
+	user     string
+	password string
+}
+
+// NewDBCredentials reads the credentials from userFile (optional) and
+// passwordFile.
+func NewDBCredentials(userFile, passwordFile string) (*DBCredentials, error) {
+	c := &DBCredentials{userFile: userFile, passwordFile: passwordFile}
+	login, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	c.login.Store(login)
+	return c, nil
+}
+
+// Files returns the files to watch, for Watcher.Watch.
+func (c *DBCredentials) Files() []string {
+	if c.userFile == "" {
+		return []string{c.passwordFile}
+	}
+	return []string{c.userFile, c.passwordFile}
+}
+
+// Reload reads the files again. If the credentials changed, new
+// connections use them and pooled ones are replaced (see DBCredentials).
+func (c *DBCredentials) Reload(ctx context.Context) error {
+	login, err := c.read()
+	if err != nil {
+		return err
+	}
+	if *login == *c.login.Load() {
+		return nil
+	}
+	c.login.Store(login)
+	c.generation.Add(1)
+	log.Printf("secrets: database connections will be replaced to log in with the new credentials")
+	return nil
+}
+
+// read reads both files.
+func (c *DBCredentials) read() (*dbLogin, error) {
+	login := &dbLogin{}
+	var err error
+	if c.userFile != "" {
+		if login.user, err = ReadFile(c.userFile); err != nil {
+			return nil, fmt.Errorf("reading database user: %w", err)
+		}
+	}
+	if login.password, err = ReadFile(c.passwordFile); err != nil {
+		return nil, fmt.Errorf("reading database password: %w", err)
+	}
+	return login, nil
+}
+
+// Option returns the driver option that logs every new connection in
+// with the current credentials. Apply it to the mysql.Config of every
+// DSN sharing them.
+func (c *DBCredentials) Option() mysql.Option {
+	return mysql.BeforeConnect(func(ctx context.Context, cfg *mysql.Config) error {
+		login := c.login.Load()
+		if login.user != "" {
+			cfg.User = login.user
+		}
+		cfg.Passwd = login.password
+		return nil
+	})
+}
+
+// Connector wraps a connector whose connections log in through Option,
+// so a Reload replaces them: sql.OpenDB(credentials.Connector(base)).
+func (c *DBCredentials) Connector(base driver.Connector) driver.Connector {
+	return &rotatingConnector{base: base, owner: c}
+}
+
+// rotatingConnector tags connections with the credentials' generation.
+type rotatingConnector struct {
+	base  driver.Connector
+	owner *DBCredentials
+}
+
+// Connect dials a connection with the current credentials.
+func (c *rotatingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	// Read before dialing: a Reload racing with the dial makes the new
+	// connection look old, and it's replaced once more, rather than the
+	// other way around.
+	generation := c.owner.generation.Load()
+	raw, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := raw.(mysqlConn)
+	if !ok {
+		raw.Close()
+		return nil, fmt.Errorf("secrets: unexpected driver connection type %T", raw)
+	}
+	return &rotatingConn{mysqlConn: conn, owner: c.owner, generation: generation}, nil
+}
+
+// Driver returns the wrapped connector's driver.
+func (c *rotatingConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// mysqlConn is the set of driver interfaces the MySQL driver's
+// connections implement. A wrapper must implement them all, or
+// database/sql silently falls back to slower paths (see package
+// failover, which wraps connections the same way).
+type mysqlConn interface {
+	driver.Conn
+	driver.Pinger
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+	driver.SessionResetter
+	driver.Validator
+	driver.NamedValueChecker
+}
+
+// rotatingConn remembers which credentials it logged in with.
+type rotatingConn struct {
+	mysqlConn
+	owner      *DBCredentials
+	generation uint64
+}
+
+// IsValid reports false once the credentials have changed.
+func (c *rotatingConn) IsValid() bool {
+	return c.generation == c.owner.generation.Load() && c.mysqlConn.IsValid()
+}
+
+// ResetSession runs before a pooled connection is reused. Returning
+// driver.ErrBadConn for a stale connection discards it before the query.
+func (c *rotatingConn) ResetSession(ctx context.Context) error {
+	if c.generation != c.owner.generation.Load() {
+		return driver.ErrBadConn
+	}
+	return c.mysqlConn.ResetSession(ctx)
+}
@@ -0,0 +1,184 @@
+// Package secrets picks up secrets that change while the server runs:
+// files mounted by Kubernetes (a Secret volume) or written by the Vault
+// agent (a template), which their owners rotate on their own schedule.
+//
+// HOW IT PLUGS IN:
+// A Watcher polls the files of each secret registered with Watch. When
+// their contents change, it calls the secret's Reloader, which reads
+// them again and swaps the new value in: the JWT signing key, the
+// database credentials (see DBCredentials), the request signing
+// secrets. Anything else that can be replaced at runtime is one more
+// Reloader.
+//
+// WHY POLL INSTEAD OF FILE EVENTS?
+// Kubernetes updates a Secret volume by writing a new directory and
+// swapping a symlink to it ("..data"), so the file a path points to
+// changes without that file ever being written: inotify on the file
+// sees nothing. Reading a handful of small files every few seconds
+// catches every kind of update, whatever wrote it, and needs no
+// dependency.
+package secrets
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-basics/internal/metrics"
+)
+
+// ErrEmpty is returned by ReadFile for a file with nothing but
+// whitespace in it: most likely one being written, never a secret.
+var ErrEmpty = errors.New("secret file is empty")
+
+// Reloader swaps a secret in after its files changed.
+//
+// Reload must leave the old secret in place when it returns an error,
+// e.g. for a file that doesn't parse: the Watcher tries again at the
+// next check, and the server keeps working with what it had.
+type Reloader interface {
+	Reload(ctx context.Context) error
+}
+
+// ReloaderFunc adapts a function to the Reloader interface.
+type ReloaderFunc func(ctx context.Context) error
+
+// Reload calls f.
+func (f ReloaderFunc) Reload(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Watcher reloads secrets when their files change.
+type Watcher struct {
+	mu      sync.Mutex // Serializes checks and guards secrets
+	secrets []*watched
+
+	rotations    *metrics.CounterVec
+	lastRotation *metrics.GaugeVec
+}
+
+// watched is one secret registered with Watch.
+type watched struct {
+	name     string
+	files    []string
+	reloader Reloader
+	sum      [sha256.Size]byte // Of the files' contents at the last successful reload
+}
+
+// NewWatcher creates a watcher with no secrets. It registers
+// secret_rotations_total and secret_last_rotation_timestamp_seconds on
+// reg.
+func NewWatcher(reg *metrics.Registry) *Watcher {
+	return &Watcher{
+		rotations: reg.NewCounterVec("secret_rotations_total",
+			"Secret file changes picked up, by secret and result (ok, or error when the new secret was refused).", "secret", "result"),
+		lastRotation: reg.NewGaugeVec("secret_last_rotation_timestamp_seconds",
+			"When each secret was last rotated, as a Unix timestamp.", "secret"),
+	}
+}
+
+// Watch calls reloader whenever the contents of files change. name
+// labels the secret in logs and metrics, e.g. "jwt". The files must be
+// readable now: their contents are what later checks compare against.
+func (w *Watcher) Watch(name string, reloader Reloader, files ...string) error {
+	sum, err := checksum(files)
+	if err != nil {
+		return fmt.Errorf("watching %s: %w", name, err)
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.secrets = append(w.secrets, &watched{name: name, files: files, reloader: reloader, sum: sum})
+	return nil
+}
+
+// Len returns the number of secrets watched.
+func (w *Watcher) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.secrets)
+}
+
+// Run checks the files every interval until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Check(ctx)
+		}
+	}
+}
+
+// Check reloads every secret whose files changed since its last reload.
+//
+// A file that can't be read (mid-update, or briefly missing while a
+// symlink is swapped) is skipped until a later check. A secret whose
+// Reloader fails is retried at every check until it succeeds, and
+// counted each time, so a bad secret shows up as a rising error rate
+// rather than one log line.
+func (w *Watcher) Check(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, s := range w.secrets {
+		sum, err := checksum(s.files)
+		if err != nil {
+			log.Printf("secrets: checking %s: %v", s.name, err)
+			continue
+		}
+		if sum == s.sum {
+			continue
+		}
+		if err := s.reloader.Reload(ctx); err != nil {
+			w.rotations.Inc(s.name, "error")
+			log.Printf("secrets: %s changed but wasn't reloaded, keeping the old one: %v", s.name, err)
+			continue
+		}
+		s.sum = sum
+		w.rotations.Inc(s.name, "ok")
+		w.lastRotation.Set(float64(time.Now().Unix()), s.name)
+		log.Printf("secrets: rotated %s", s.name)
+	}
+}
+
+// checksum hashes the contents of files, in order.
+func checksum(files []string) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return [sha256.Size]byte{}, err
+		}
+		// Length-prefixed, so moving bytes from one file to the next
+		// changes the sum.
+		h.Write([]byte(strconv.Itoa(len(data)) + ":"))
+		h.Write(data)
+	}
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+// ReadFile reads a secret from a file, without the surrounding
+// whitespace: `echo secret > file` and Vault templates add a newline
+// that isn't part of the secret.
+func ReadFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%s: %w", path, ErrEmpty)
+	}
+	return secret, nil
+}
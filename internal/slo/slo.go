@@ -0,0 +1,69 @@
+// Package slo tracks service level objectives (SLOs) per HTTP route.
+//
+// SLO BASICS:
+// An SLO is a target for how often requests should be "good", e.g.
+// "99.9% of POST /login requests succeed within 300ms over 30 days".
+//
+//   - A request is GOOD if it didn't fail on our side (status < 500)
+//     and finished within the route's latency threshold.
+//   - The ERROR BUDGET is the share of requests allowed to be bad:
+//     100% - 99.9% = 0.1%.
+//   - The BURN RATE is how fast the budget is being spent. A burn rate of 1
+//     uses the budget up exactly at the end of the window; 10 uses it up
+//     ten times faster.
+//
+// Alerting on burn rate instead of raw error rate means a brief blip
+// doesn't page anyone, but a sustained problem does - quickly.
+package slo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Objective is the SLO for one route.
+type Objective struct {
+	// Route is the ServeMux pattern, e.g. "POST /login".
+	Route string
+
+	// Latency is the slowest a request may be and still count as good.
+	Latency time.Duration
+
+	// Availability is the target share of good requests, e.g. 0.999.
+	Availability float64
+}
+
+// errorBudget returns the share of requests allowed to be bad.
+func (o Objective) errorBudget() float64 {
+	return 1 - o.Availability
+}
+
+// ParseObjective parses a route SLO written as
+//
+//	<pattern>=<latency>/<availability %>
+//
+// for example "POST /login=300ms/99.9".
+func ParseObjective(spec string) (Objective, error) {
+	route, target, ok := strings.Cut(spec, "=")
+	if !ok {
+		return Objective{}, fmt.Errorf("SLO %q: want <pattern>=<latency>/<availability%%>", spec)
+	}
+	latency, availability, ok := strings.Cut(target, "/")
+	if !ok {
+		return Objective{}, fmt.Errorf("SLO %q: want <pattern>=<latency>/<availability%%>", spec)
+	}
+
+	o := Objective{Route: strings.TrimSpace(route)}
+	var err error
+	if o.Latency, err = time.ParseDuration(strings.TrimSpace(latency)); err != nil || o.Latency <= 0 {
+		return Objective{}, fmt.Errorf("SLO %q: invalid latency %q", spec, latency)
+	}
+	percent, err := strconv.ParseFloat(strings.TrimSpace(availability), 64)
+	if err != nil || percent <= 0 || percent >= 100 {
+		return Objective{}, fmt.Errorf("SLO %q: availability must be a percentage between 0 and 100 (exclusive)", spec)
+	}
+	o.Availability = percent / 100
+	return o, nil
+}
@@ -0,0 +1,298 @@
+package slo
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go-basics/internal/metrics"
+)
+
+// Burn-rate windows. Short windows detect problems fast; long windows
+// confirm they're real. Alerts need both to be burning (see alertPolicies).
+var burnWindows = []struct {
+	name string
+	span time.Duration
+}{
+	{"5m", 5 * time.Minute},
+	{"30m", 30 * time.Minute},
+	{"1h", time.Hour},
+	{"6h", 6 * time.Hour},
+}
+
+// alertPolicies are the multi-window burn-rate alerts from the Google SRE
+// workbook, tuned for a 30-day window:
+//
+//   - page:   2% of the monthly budget spent in 1 hour  (burn rate 14.4)
+//   - ticket: 5% of the monthly budget spent in 6 hours (burn rate 6)
+//
+// Each policy fires only when BOTH its long and short window exceed the
+// threshold. The long window avoids alerting on blips; the short window
+// makes the alert stop soon after the problem is fixed.
+var alertPolicies = []struct {
+	severity    string
+	long, short string
+	threshold   float64
+}{
+	{"page", "1h", "5m", 14.4},
+	{"ticket", "6h", "30m", 6},
+}
+
+// minAlertRequests is how many requests the long window needs before an
+// alert can fire. Without it, one failed request on an idle route would
+// mean a burn rate in the hundreds.
+const minAlertRequests = 20
+
+// Tracker classifies requests as good or bad per route and keeps the
+// counts needed for burn rates and error budgets.
+//
+// Counts live in memory, so each instance reports on its own traffic and
+// the budget resets on restart. For fleet-wide SLOs, alert on the exported
+// slo_requests_total counter in Prometheus instead.
+type Tracker struct {
+	defaults   Objective            // Used for routes without their own objective
+	objectives map[string]Objective // Keyed by route pattern
+	window     time.Duration        // The SLO period, e.g. 30 days
+
+	mu     sync.Mutex
+	routes map[string]*routeStats
+	firing map[string]string // route -> severity of the alert currently firing
+
+	requests        *metrics.CounterVec
+	burnRate        *metrics.GaugeVec
+	budgetRemaining *metrics.GaugeVec
+}
+
+// routeStats holds the sliding windows for one route.
+type routeStats struct {
+	minutes *ring // Fine-grained, for burn rates
+	hours   *ring // Coarse, for the whole SLO window
+}
+
+// NewTracker creates a tracker and registers its metrics.
+// defaults applies to every route not listed in objectives.
+func NewTracker(reg *metrics.Registry, defaults Objective, objectives []Objective, window time.Duration) *Tracker {
+	t := &Tracker{
+		defaults:   defaults,
+		objectives: make(map[string]Objective, len(objectives)),
+		window:     window,
+		routes:     make(map[string]*routeStats),
+		firing:     make(map[string]string),
+
+		requests: reg.NewCounterVec("slo_requests_total",
+			"Requests classified against their route's SLO.", "route", "result"),
+		burnRate: reg.NewGaugeVec("slo_burn_rate",
+			"Error budget burn rate per route and window (1 = on track to use exactly the budget).", "route", "window"),
+		budgetRemaining: reg.NewGaugeVec("slo_error_budget_remaining",
+			"Share of the error budget left in the SLO window (negative when overspent).", "route"),
+	}
+	for _, o := range objectives {
+		t.objectives[o.Route] = o
+	}
+	reg.OnScrape(t.updateGauges)
+	return t
+}
+
+// objective returns the SLO for a route.
+func (t *Tracker) objective(route string) Objective {
+	if o, ok := t.objectives[route]; ok {
+		return o
+	}
+	o := t.defaults
+	o.Route = route
+	return o
+}
+
+// Record classifies one finished request.
+func (t *Tracker) Record(route string, status int, duration time.Duration, at time.Time) {
+	good := status < 500 && duration <= t.objective(route).Latency
+
+	result := "good"
+	if !good {
+		result = "bad"
+	}
+	t.requests.Inc(route, result)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats, ok := t.routes[route]
+	if !ok {
+		longest := burnWindows[len(burnWindows)-1].span
+		stats = &routeStats{
+			minutes: newRing(time.Minute, longest),
+			hours:   newRing(time.Hour, t.window),
+		}
+		t.routes[route] = stats
+	}
+	stats.minutes.add(at, good)
+	stats.hours.add(at, good)
+}
+
+// Middleware records every request that matched a route.
+//
+// Wrap the whole mux with it. ServeMux sets r.Pattern while routing, so
+// the route is known once the handler returns. Unmatched requests (404s
+// for random paths) have no pattern and are ignored; counting them would
+// let scanners create unlimited metric series.
+func (t *Tracker) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rec, r)
+
+		if r.Pattern == "" {
+			return
+		}
+		t.Record(r.Pattern, rec.status, time.Since(start), time.Now())
+	})
+}
+
+// statusRecorder remembers the status code a handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status and passes it on.
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RouteSummary reports one route's SLO status.
+type RouteSummary struct {
+	Route        string  `json:"route"`
+	Latency      string  `json:"latency_objective"`
+	Availability float64 `json:"availability_objective"`
+
+	// Over the whole SLO window:
+	Good               uint64  `json:"good"`
+	Bad                uint64  `json:"bad"`
+	ActualAvailability float64 `json:"actual_availability"`
+	BudgetConsumed     float64 `json:"error_budget_consumed"` // 1 = all spent
+	BudgetRemaining    float64 `json:"error_budget_remaining"`
+
+	BurnRates map[string]float64 `json:"burn_rates"`
+	Alert     string             `json:"alert,omitempty"` // "page", "ticket", or empty
+}
+
+// Summary reports every route that has received traffic, sorted by route.
+func (t *Tracker) Summary() []RouteSummary {
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	summaries := make([]RouteSummary, 0, len(t.routes))
+	for route, stats := range t.routes {
+		summaries = append(summaries, t.summarize(route, stats, now))
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].Route < summaries[j].Route })
+	return summaries
+}
+
+// summarize computes one route's summary. t.mu must be held.
+func (t *Tracker) summarize(route string, stats *routeStats, now time.Time) RouteSummary {
+	o := t.objective(route)
+	s := RouteSummary{
+		Route:              route,
+		Latency:            o.Latency.String(),
+		Availability:       o.Availability,
+		ActualAvailability: 1,
+		BurnRates:          make(map[string]float64, len(burnWindows)),
+	}
+
+	s.Good, s.Bad = stats.hours.sum(now, t.window)
+	if total := s.Good + s.Bad; total > 0 {
+		s.ActualAvailability = float64(s.Good) / float64(total)
+		s.BudgetConsumed = (1 - s.ActualAvailability) / o.errorBudget()
+	}
+	s.BudgetRemaining = 1 - s.BudgetConsumed
+
+	requests := make(map[string]uint64, len(burnWindows))
+	for _, w := range burnWindows {
+		good, bad := stats.minutes.sum(now, w.span)
+		requests[w.name] = good + bad
+		if good+bad > 0 {
+			s.BurnRates[w.name] = float64(bad) / float64(good+bad) / o.errorBudget()
+		} else {
+			s.BurnRates[w.name] = 0
+		}
+	}
+
+	for _, p := range alertPolicies {
+		if requests[p.long] >= minAlertRequests &&
+			s.BurnRates[p.long] > p.threshold && s.BurnRates[p.short] > p.threshold {
+			s.Alert = p.severity
+			break
+		}
+	}
+	return s
+}
+
+// updateGauges refreshes the burn-rate gauges before a scrape.
+func (t *Tracker) updateGauges() {
+	for _, s := range t.Summary() {
+		for window, rate := range s.BurnRates {
+			t.burnRate.Set(rate, s.Route, window)
+		}
+		t.budgetRemaining.Set(s.BudgetRemaining, s.Route)
+	}
+}
+
+// Run checks burn rates every interval and logs when an alert starts or
+// stops firing, until ctx is cancelled.
+//
+// Logging is the alert channel here; point your log pipeline's alerting
+// at "SLO burn rate alert firing" messages, or alert on slo_burn_rate in
+// Prometheus.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			t.evaluate()
+		}
+	}
+}
+
+// evaluate logs alert state changes.
+func (t *Tracker) evaluate() {
+	for _, s := range t.Summary() {
+		t.mu.Lock()
+		previous := t.firing[s.Route]
+		if s.Alert == "" {
+			delete(t.firing, s.Route)
+		} else {
+			t.firing[s.Route] = s.Alert
+		}
+		t.mu.Unlock()
+
+		switch {
+		case s.Alert != "" && s.Alert != previous:
+			slog.Warn("SLO burn rate alert firing",
+				"route", s.Route,
+				"severity", s.Alert,
+				"burn_rate_5m", s.BurnRates["5m"],
+				"burn_rate_1h", s.BurnRates["1h"],
+				"burn_rate_6h", s.BurnRates["6h"],
+				"error_budget_remaining", s.BudgetRemaining,
+			)
+		case s.Alert == "" && previous != "":
+			slog.Info("SLO burn rate alert resolved", "route", s.Route, "severity", previous)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package slo
+
+import "time"
+
+// bucket counts requests in one time slot.
+type bucket struct {
+	slot      int64 // Which slot (time / width) the counts belong to
+	good, bad uint64
+}
+
+// ring is a fixed-size sliding window of time buckets.
+//
+// WHY A RING?
+// Memory stays constant no matter how much traffic there is: a request
+// only increments a counter in the bucket for its time slot. Old buckets
+// are reused; the stored slot number tells us whether a bucket's counts
+// are current or left over from a previous lap around the ring.
+type ring struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+// newRing creates a ring covering span, in buckets of width.
+func newRing(width, span time.Duration) *ring {
+	n := int(span / width)
+	if n < 1 {
+		n = 1
+	}
+	return &ring{width: width, buckets: make([]bucket, n)}
+}
+
+// add records one request at time t.
+func (r *ring) add(t time.Time, good bool) {
+	slot := t.UnixNano() / int64(r.width)
+	b := &r.buckets[slot%int64(len(r.buckets))]
+	if b.slot != slot {
+		*b = bucket{slot: slot}
+	}
+	if good {
+		b.good++
+	} else {
+		b.bad++
+	}
+}
+
+// sum returns the counts for the span ending at now.
+// span is rounded up to whole buckets and capped at the ring's size.
+func (r *ring) sum(now time.Time, span time.Duration) (good, bad uint64) {
+	current := now.UnixNano() / int64(r.width)
+	n := int64((span + r.width - 1) / r.width)
+	if n > int64(len(r.buckets)) {
+		n = int64(len(r.buckets))
+	}
+
+	for _, b := range r.buckets {
+		if b.slot > current-n && b.slot <= current {
+			good += b.good
+			bad += b.bad
+		}
+	}
+	return good, bad
+}
@@ -0,0 +1,185 @@
+// Package timing breaks a request's time down into spans (auth, service,
+// repo, encode) and reports them in a Server-Timing response header.
+//
+// WHY SERVER-TIMING?
+// A client team that sees a slow response can't tell from the outside
+// whether the time went on the network, the token check, the database,
+// or somewhere else. Server-Timing (a W3C standard) carries that
+// breakdown in the response itself, and browsers show it in the network
+// panel next to their own timings, so nobody needs access to our logs or
+// dashboards to see it:
+//
+//	Server-Timing: auth;dur=0.4, repo;dur=9.8;desc="3 queries", service;dur=12.3, encode;dur=0.1, total;dur=13.1
+//
+// Spans nest: service includes the repo time of the queries it ran, and
+// total includes everything up to the response status.
+//
+// WHY OPT-IN PER REQUEST?
+// Most responses are read by programs that don't care, and the
+// breakdown tells an attacker how long each step takes (e.g. whether a
+// login looked up a password hash). So it's only sent when the server
+// enables it and the request asks for it.
+package timing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Span names, as they appear in the header.
+const (
+	Auth    = "auth"    // Validating the bearer token
+	Service = "service" // The handler's call into the service layer
+	Repo    = "repo"    // Database queries, until results start coming back
+	Encode  = "encode"  // Encoding the response body
+)
+
+// RequestHeader is the header a client sends (with any value but "0")
+// to get a Server-Timing breakdown.
+const RequestHeader = "X-Debug-Timing"
+
+// contextKey is the context key for a request's Recorder.
+type contextKey struct{}
+
+// Recorder collects one request's spans. It's safe for concurrent use.
+type Recorder struct {
+	start time.Time
+
+	mu    sync.Mutex
+	spans []span // In the order they first ended
+}
+
+// span is the total time and count of one named span.
+type span struct {
+	name  string
+	dur   time.Duration
+	count int
+}
+
+// WithRecorder returns a context that collects spans into a new Recorder.
+func WithRecorder(ctx context.Context) (context.Context, *Recorder) {
+	rec := &Recorder{start: time.Now()}
+	return context.WithValue(ctx, contextKey{}, rec), rec
+}
+
+// Start begins a span named name and returns the function that ends it.
+// Spans with the same name add up. Without a Recorder in ctx (the
+// request didn't ask), it costs a context lookup and does nothing else.
+//
+// Usage:
+//
+//	defer timing.Start(ctx, timing.Repo)()
+func Start(ctx context.Context, name string) func() {
+	rec, ok := ctx.Value(contextKey{}).(*Recorder)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		rec.add(name, time.Since(start))
+	}
+}
+
+// StartWriter is Start for code that has the response writer but not the
+// request, like a JSON response helper. It finds the Recorder through
+// the writer wrappers' Unwrap methods.
+func StartWriter(w http.ResponseWriter, name string) func() {
+	for w != nil {
+		if tw, ok := w.(*timingWriter); ok {
+			start := time.Now()
+			return func() {
+				tw.rec.add(name, time.Since(start))
+			}
+		}
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+	return func() {}
+}
+
+// add records one span of d.
+func (r *Recorder) add(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.spans {
+		if r.spans[i].name == name {
+			r.spans[i].dur += d
+			r.spans[i].count++
+			return
+		}
+	}
+	r.spans = append(r.spans, span{name: name, dur: d, count: 1})
+}
+
+// Header returns the Server-Timing header value: every span, then the
+// total since the Recorder was created.
+func (r *Recorder) Header() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	metrics := make([]string, 0, len(r.spans)+1)
+	for _, s := range r.spans {
+		metric := fmt.Sprintf("%s;dur=%s", s.name, milliseconds(s.dur))
+		if s.name == Repo {
+			metric += fmt.Sprintf(`;desc="%d queries"`, s.count)
+		}
+		metrics = append(metrics, metric)
+	}
+	metrics = append(metrics, "total;dur="+milliseconds(time.Since(r.start)))
+	return strings.Join(metrics, ", ")
+}
+
+// milliseconds formats d the way Server-Timing wants durations: in
+// milliseconds, here to a microsecond.
+func milliseconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", float64(d.Microseconds())/1000)
+}
+
+// Middleware records spans for requests that send RequestHeader, and
+// adds their Server-Timing header to the response. Install it outermost,
+// so total covers the whole chain.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get(RequestHeader); v == "" || v == "0" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, rec := WithRecorder(r.Context())
+		next.ServeHTTP(&timingWriter{ResponseWriter: w, rec: rec}, r.WithContext(ctx))
+	})
+}
+
+// timingWriter adds the Server-Timing header just before the status is
+// written, when every span that can still make it into the header has
+// ended.
+type timingWriter struct {
+	http.ResponseWriter
+	rec         *Recorder
+	wroteHeader bool
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("Server-Timing", w.rec.Header())
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
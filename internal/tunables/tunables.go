@@ -0,0 +1,251 @@
+// Package tunables holds operational knobs that can be changed at runtime,
+// for a limited time, without a redeploy.
+//
+// WHY TEMPORARY?
+// During an incident an operator may need to loosen a rate limit, log
+// more slow queries, or put the service into maintenance mode - now,
+// not after a config change and a rolling restart. But a knob that is
+// turned during an incident and forgotten becomes the new, undocumented
+// configuration. So every override expires: after its TTL the knob goes
+// back to its configured default on its own, and the log says so.
+//
+// Overrides live in process memory. With several instances, each has its
+// own; apply the change to every instance (or accept that it's partial).
+package tunables
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Override lifetimes.
+const (
+	DefaultTTL = time.Hour      // When the caller doesn't say
+	MaxTTL     = 24 * time.Hour // Longer changes belong in the configuration
+)
+
+// Sentinel errors for Registry operations.
+var (
+	// ErrUnknownKnob is returned for a name that isn't registered.
+	ErrUnknownKnob = errors.New("unknown tunable")
+
+	// ErrInvalidValue is returned when a value doesn't parse for the knob.
+	ErrInvalidValue = errors.New("invalid value")
+
+	// ErrInvalidTTL is returned for a TTL that is not positive or exceeds MaxTTL.
+	ErrInvalidTTL = errors.New("invalid ttl")
+)
+
+// Knob is a named runtime value. Create one with NewInt, NewBool,
+// NewDuration, or NewRatio and register it with NewRegistry.
+type Knob interface {
+	Name() string
+	Description() string
+
+	current() string
+	defaultValue() string
+	set(raw string) error
+	reset()
+}
+
+// Value is a Knob holding a T. Get is safe to call on every request:
+// it is a single atomic load.
+type Value[T any] struct {
+	name        string
+	description string
+	def         T
+	parse       func(string) (T, error)
+	format      func(T) string
+
+	value atomic.Pointer[T]
+}
+
+// newValue creates a knob set to def.
+func newValue[T any](name, description string, def T, parse func(string) (T, error), format func(T) string) *Value[T] {
+	v := &Value[T]{name: name, description: description, def: def, parse: parse, format: format}
+	v.value.Store(&def)
+	return v
+}
+
+// Get returns the knob's current value.
+func (v *Value[T]) Get() T {
+	return *v.value.Load()
+}
+
+// Name returns the knob's name, e.g. "ratelimit.auth.per_ip".
+func (v *Value[T]) Name() string { return v.name }
+
+// Description says what the knob controls.
+func (v *Value[T]) Description() string { return v.description }
+
+func (v *Value[T]) current() string      { return v.format(v.Get()) }
+func (v *Value[T]) defaultValue() string { return v.format(v.def) }
+func (v *Value[T]) reset()               { v.value.Store(&v.def) }
+
+func (v *Value[T]) set(raw string) error {
+	parsed, err := v.parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w for %s: %v", ErrInvalidValue, v.name, err)
+	}
+	v.value.Store(&parsed)
+	return nil
+}
+
+// Status describes one knob for the admin API.
+type Status struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Value       string     `json:"value"`
+	Default     string     `json:"default"`
+	Overridden  bool       `json:"overridden"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"` // When the override reverts
+	SetBy       string     `json:"set_by,omitempty"`     // Who made the override
+}
+
+// override is an active change to a knob's default.
+type override struct {
+	expiresAt time.Time
+	setBy     string
+	timer     *time.Timer
+}
+
+// Registry is the set of knobs the admin API can change.
+type Registry struct {
+	mu        sync.Mutex
+	knobs     map[string]Knob
+	overrides map[string]*override
+	audit     AuditFunc
+}
+
+// AuditFunc records a change to a knob: who made it (actor) and what it
+// was. Expiries are made by "system".
+type AuditFunc func(actor, message string)
+
+// NewRegistry creates a registry of the given knobs.
+// Names must be unique; a duplicate is a programming error and panics.
+func NewRegistry(knobs ...Knob) *Registry {
+	r := &Registry{
+		knobs:     make(map[string]Knob, len(knobs)),
+		overrides: make(map[string]*override),
+		audit: func(actor, message string) {
+			log.Printf("tunables: %s %s", actor, message)
+		},
+	}
+	for _, k := range knobs {
+		if _, dup := r.knobs[k.Name()]; dup {
+			panic("tunables: duplicate knob " + k.Name())
+		}
+		r.knobs[k.Name()] = k
+	}
+	return r
+}
+
+// SetAudit sends the change log to fn instead of the server log.
+func (r *Registry) SetAudit(fn AuditFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.audit = fn
+}
+
+// List returns every knob, sorted by name.
+func (r *Registry) List() []Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statuses := make([]Status, 0, len(r.knobs))
+	for name := range r.knobs {
+		statuses = append(statuses, r.status(name))
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// Set overrides a knob with raw for ttl, then reverts it to its default.
+// Setting a knob that is already overridden replaces the override and
+// restarts the clock. actor names who made the change, for the audit log.
+func (r *Registry) Set(name, raw string, ttl time.Duration, actor string) (Status, error) {
+	if ttl <= 0 || ttl > MaxTTL {
+		return Status{}, fmt.Errorf("%w: must be between 0 and %v", ErrInvalidTTL, MaxTTL)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	knob, ok := r.knobs[name]
+	if !ok {
+		return Status{}, fmt.Errorf("%w: %q", ErrUnknownKnob, name)
+	}
+	previous := knob.current()
+	if err := knob.set(raw); err != nil {
+		return Status{}, err
+	}
+
+	if old := r.overrides[name]; old != nil {
+		old.timer.Stop()
+	}
+	o := &override{expiresAt: time.Now().Add(ttl), setBy: actor}
+	// The timer checks it's still the current override before reverting,
+	// in case it fired just as a newer Set or Reset replaced it.
+	o.timer = time.AfterFunc(ttl, func() { r.expire(name, o) })
+	r.overrides[name] = o
+
+	r.audit(actor, fmt.Sprintf("set %s = %s (was %s) for %v", name, knob.current(), previous, ttl))
+	return r.status(name), nil
+}
+
+// Reset reverts a knob to its default now.
+func (r *Registry) Reset(name, actor string) (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	knob, ok := r.knobs[name]
+	if !ok {
+		return Status{}, fmt.Errorf("%w: %q", ErrUnknownKnob, name)
+	}
+	if o := r.overrides[name]; o != nil {
+		o.timer.Stop()
+		delete(r.overrides, name)
+		knob.reset()
+		r.audit(actor, fmt.Sprintf("reset %s to default %s", name, knob.current()))
+	}
+	return r.status(name), nil
+}
+
+// expire reverts an override whose TTL has passed.
+func (r *Registry) expire(name string, o *override) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.overrides[name] != o {
+		return
+	}
+	delete(r.overrides, name)
+	knob := r.knobs[name]
+	knob.reset()
+	r.audit("system", fmt.Sprintf("%s override by %s expired; reverted to default %s", name, o.setBy, knob.current()))
+}
+
+// status describes one knob. The caller must hold r.mu.
+func (r *Registry) status(name string) Status {
+	knob := r.knobs[name]
+	s := Status{
+		Name:        name,
+		Description: knob.Description(),
+		Value:       knob.current(),
+		Default:     knob.defaultValue(),
+	}
+	if o := r.overrides[name]; o != nil {
+		expiresAt := o.expiresAt
+		s.Overridden = true
+		s.ExpiresAt = &expiresAt
+		s.SetBy = o.setBy
+	}
+	return s
+}
@@ -0,0 +1,53 @@
+package tunables
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"go-basics/config"
+)
+
+// Values are written the same way as in the environment (see package
+// config), so "30s", "25%", and "true" mean what they mean there.
+
+// NewInt creates a knob holding a non-negative integer.
+func NewInt(name, description string, def int) *Value[int] {
+	return newValue(name, description, def, func(s string) (int, error) {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, errors.New("must be a non-negative integer")
+		}
+		return n, nil
+	}, strconv.Itoa)
+}
+
+// NewBool creates a knob holding a boolean.
+func NewBool(name, description string, def bool) *Value[bool] {
+	return newValue(name, description, def, func(s string) (bool, error) {
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return false, errors.New("must be true or false")
+		}
+		return b, nil
+	}, strconv.FormatBool)
+}
+
+// NewDuration creates a knob holding a non-negative duration ("200ms", "1d").
+func NewDuration(name, description string, def time.Duration) *Value[time.Duration] {
+	return newValue(name, description, def, func(s string) (time.Duration, error) {
+		d, err := config.ParseDuration(s)
+		if err != nil {
+			return 0, err
+		}
+		if d < 0 {
+			return 0, errors.New("must not be negative")
+		}
+		return d, nil
+	}, time.Duration.String)
+}
+
+// NewRatio creates a knob holding a fraction between 0 and 1 ("25%", "0.25").
+func NewRatio(name, description string, def config.Ratio) *Value[config.Ratio] {
+	return newValue(name, description, def, config.ParseRatio, config.Ratio.String)
+}
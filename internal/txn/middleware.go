@@ -0,0 +1,78 @@
+package txn
+
+import (
+	"log"
+	"net/http"
+)
+
+// Middleware runs the handler's database work in one transaction per
+// database, committed when the response status is 2xx.
+//
+// WHY COMMIT BEFORE WRITING THE STATUS?
+// Once the status line is sent it can't be taken back. Committing first
+// means a failed commit still turns into a 500 instead of a "201 Created"
+// for data that was never saved.
+func Middleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, scope := WithScope(r.Context())
+		tw := &txWriter{ResponseWriter: w, scope: scope}
+
+		defer func() {
+			// Panics and handlers that never wrote anything roll back.
+			// After a commit this is a no-op.
+			if err := scope.Rollback(); err != nil {
+				log.Printf("rolling back request transaction: %v", err)
+			}
+		}()
+
+		next(tw, r.WithContext(ctx))
+	}
+}
+
+// txWriter finishes the transaction when the handler writes its status.
+type txWriter struct {
+	http.ResponseWriter
+	scope        *Scope
+	wroteHeader  bool
+	commitFailed bool
+}
+
+// WriteHeader commits (2xx) or rolls back (anything else), then sends the
+// status. A failed commit is reported as a 500 instead.
+func (w *txWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	if status >= 200 && status < 300 {
+		if err := w.scope.Commit(); err != nil {
+			log.Printf("committing request transaction: %v", err)
+			w.commitFailed = true
+			w.Header().Set("Content-Type", "application/json")
+			w.ResponseWriter.WriteHeader(http.StatusInternalServerError)
+			w.ResponseWriter.Write([]byte(`{"error":"internal server error"}` + "\n"))
+			return
+		}
+	} else if err := w.scope.Rollback(); err != nil {
+		log.Printf("rolling back request transaction: %v", err)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends an implicit 200 first, like http.ResponseWriter does.
+// After a failed commit the handler's body is dropped; the 500 stands.
+func (w *txWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.commitFailed {
+		return len(b), nil
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *txWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,139 @@
+// Package txn runs all database writes of one HTTP request in a transaction.
+//
+// THE PROBLEM:
+// Signing up writes the user row and then the role assignment. If the
+// second write fails, the first has already been committed, leaving a user
+// without a role. Repositories can't fix that on their own: each one only
+// sees its own queries.
+//
+// THE SOLUTION:
+// Middleware puts a Scope in the request context. Repositories that find a
+// Scope run their queries through its transaction instead of the pool, so
+// every write the request makes commits or rolls back together:
+//
+//	mux.HandleFunc("POST /register", txn.Middleware(h.register))
+//
+// The transaction is opened lazily on the first query, so routes that
+// return early (bad input, 401) never touch the database. It commits just
+// before the response status is sent when the status is 2xx, and rolls back
+// otherwise.
+//
+// Work outside a request, like a background job, gets the same with Run.
+//
+// Routes opt in one by one; without the middleware nothing changes.
+// Don't use it on long-running or read-only routes: a transaction holds a
+// connection (and row locks) until the response is written.
+package txn
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// scopeKey is the context key for the request's Scope.
+type scopeKey struct{}
+
+// Scope holds the transactions opened during one request, one per
+// database (sharded deployments write to several).
+type Scope struct {
+	mu   sync.Mutex
+	txs  map[*sql.DB]*sql.Tx
+	done bool
+}
+
+// WithScope returns a context carrying a new, empty Scope.
+func WithScope(ctx context.Context) (context.Context, *Scope) {
+	s := &Scope{txs: make(map[*sql.DB]*sql.Tx)}
+	return context.WithValue(ctx, scopeKey{}, s), s
+}
+
+// FromContext returns the request's Scope, or nil outside the middleware.
+func FromContext(ctx context.Context) *Scope {
+	s, _ := ctx.Value(scopeKey{}).(*Scope)
+	return s
+}
+
+// Run calls fn with a context carrying a new Scope, and commits the
+// scope's transactions if fn returns nil, or rolls them back if not.
+// It's Middleware for work that isn't an HTTP request.
+func Run(ctx context.Context, fn func(ctx context.Context) error) error {
+	ctx, scope := WithScope(ctx)
+	if err := fn(ctx); err != nil {
+		if rbErr := scope.Rollback(); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("rolling back: %w", rbErr))
+		}
+		return err
+	}
+	if err := scope.Commit(); err != nil {
+		return fmt.Errorf("committing: %w", err)
+	}
+	return nil
+}
+
+// ErrScopeDone is returned when a query runs after the scope committed or
+// rolled back, e.g. from a goroutine that outlived the request.
+var ErrScopeDone = errors.New("txn: request transaction already finished")
+
+// Tx returns the scope's transaction on db, beginning it on first use.
+func (s *Scope) Tx(ctx context.Context, db *sql.DB) (*sql.Tx, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return nil, ErrScopeDone
+	}
+	if tx, ok := s.txs[db]; ok {
+		return tx, nil
+	}
+
+	// Tie the transaction to the request: if the client disconnects and
+	// the context is cancelled, database/sql rolls it back.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("beginning request transaction: %w", err)
+	}
+	s.txs[db] = tx
+	return tx, nil
+}
+
+// Commit commits every transaction in the scope.
+//
+// CAVEAT: with several databases (sharding) this is not atomic across
+// them. If the second commit fails the first has already happened; the
+// error says so, but nothing is undone. That's the same guarantee the
+// sharded repository gives without transactions.
+func (s *Scope) Commit() error {
+	return s.finish(func(tx *sql.Tx) error { return tx.Commit() })
+}
+
+// Rollback rolls back every transaction in the scope.
+func (s *Scope) Rollback() error {
+	return s.finish(func(tx *sql.Tx) error {
+		if err := tx.Rollback(); !errors.Is(err, sql.ErrTxDone) {
+			return err
+		}
+		return nil
+	})
+}
+
+// finish ends every transaction with fn. Only the first call does anything.
+func (s *Scope) finish(fn func(*sql.Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.done {
+		return nil
+	}
+	s.done = true
+
+	var errs []error
+	for _, tx := range s.txs {
+		if err := fn(tx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
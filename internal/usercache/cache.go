@@ -0,0 +1,329 @@
+// Package usercache keeps users looked up by email in Redis, for logins
+// and token checks that would otherwise read the same row from MySQL
+// again and again.
+//
+// THE HARD PART IS FORGETTING:
+// A cached user is a copy of its password hash, its active flag, its
+// token version: a stale one lets an old password sign in, or a
+// deactivated account keep working. Expiring entries after a TTL only
+// bounds how long that lasts. So entries are dropped as soon as the
+// user is written, however it's written:
+//
+//   - Writes through this process go through Cache, which drops the
+//     user's entry right after the write. Redis is shared, so every
+//     instance sees it gone at once.
+//   - Writes from anywhere else (another service, a script, a write
+//     whose invalidation failed) show up in the change feed, the rows
+//     whose updated_at moved (see mysql.UserChangeFeed), which every
+//     instance follows (see Follow) and drops the entries of.
+//
+// The TTL stays, as a backstop for anything both miss.
+//
+// WHY TOMBSTONES INSTEAD OF DELETING?
+// A lookup that misses reads MySQL and then fills the cache. If a
+// write lands in between, the lookup fills the cache with the row as it
+// was before the write, after the write dropped the entry: stale until
+// the TTL. So a write doesn't delete the entry but replaces it with a
+// short-lived tombstone, and lookups only fill a key that's empty (SET
+// NX): the late fill finds the tombstone and gives up.
+package usercache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"go-basics/internal/domain/user"
+	"go-basics/internal/encryption"
+	"go-basics/internal/metrics"
+)
+
+// tombstone is what a dropped entry is replaced with for tombstoneTTL.
+// It's not JSON, so it can't be mistaken for a user.
+const tombstone = "-"
+
+// tombstoneTTL is how long a dropped entry can't be filled again. It
+// only has to outlast a lookup's read of MySQL, a few milliseconds
+// normally; seconds leave room for a slow query, or for a request
+// transaction (package txn) to commit the write it was dropped for.
+const tombstoneTTL = 5 * time.Second
+
+// Cache is a user.Repository that serves FindByEmail from Redis.
+// Every other lookup goes straight to the repository it wraps; every
+// write goes to it too, and then drops the user's entry.
+type Cache struct {
+	user.Repository
+
+	client  redis.UniversalClient
+	prefix  string
+	ttl     time.Duration
+	secrets *encryption.Cipher // Encrypts cached MFA secrets; nil caches no user with one
+
+	lookups       *metrics.CounterVec
+	invalidations *metrics.CounterVec
+}
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+// WithSecretCipher encrypts the MFA secrets of cached users with c, the
+// key they're encrypted with in MySQL (MFA_ENCRYPTION_KEY). Without it,
+// users with an MFA secret aren't cached: the secret would sit in Redis
+// in the clear.
+func WithSecretCipher(c *encryption.Cipher) Option {
+	return func(cache *Cache) {
+		cache.secrets = c
+	}
+}
+
+// New caches repo's FindByEmail in client, under keys starting with
+// prefix, for up to ttl. It registers user_cache_lookups_total and
+// user_cache_invalidations_total on reg.
+//
+// Entries hold password hashes: client must be a Redis only this
+// service can reach, like the one holding rate limits and nonces.
+func New(repo user.Repository, client redis.UniversalClient, prefix string, ttl time.Duration, reg *metrics.Registry, opts ...Option) *Cache {
+	c := &Cache{
+		Repository: repo,
+		client:     client,
+		prefix:     prefix,
+		ttl:        ttl,
+		lookups: reg.NewCounterVec("user_cache_lookups_total",
+			"User lookups by email, by result (hit, miss, or error when Redis failed and MySQL answered).", "result"),
+		invalidations: reg.NewCounterVec("user_cache_invalidations_total",
+			"Cached users dropped, by source (write through this process, or the change feed) and result.", "source", "result"),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// entry is a cached user. FindByEmail never returns deleted users, so
+// no entry is of one.
+type entry struct {
+	ID            uint64    `json:"id"`
+	ULID          string    `json:"ulid,omitempty"`
+	Email         string    `json:"email"`
+	Username      string    `json:"username,omitempty"`
+	PendingEmail  string    `json:"pending_email,omitempty"`
+	EmailVerified bool      `json:"email_verified"`
+	AvatarURL     string    `json:"avatar_url,omitempty"`
+	Active        bool      `json:"active"`
+	PasswordHash  string    `json:"password_hash"`
+	TokenVersion  uint64    `json:"token_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	MFASecret     []byte    `json:"mfa_secret,omitempty"` // Encrypted
+	MFAEnabled    bool      `json:"mfa_enabled"`
+}
+
+// emailKey is the key of the user with email.
+func (c *Cache) emailKey(email string) string {
+	return c.prefix + "email:" + email
+}
+
+// idKey holds the email a user is cached under, so a write that only
+// knows the ID (SetActive) or changes the email finds the entry.
+func (c *Cache) idKey(id uint64) string {
+	return c.prefix + "id:" + strconv.FormatUint(id, 10)
+}
+
+// FindByEmail returns the cached user, or reads it from the repository
+// and caches it. Whatever fields opts ask for, the cache holds them all,
+// and returns them all: one entry serves every caller.
+//
+// If Redis fails, the lookup goes to MySQL: a cache outage makes logins
+// slower, not impossible.
+func (c *Cache) FindByEmail(ctx context.Context, email string, opts ...user.FindOption) (*user.User, error) {
+	data, err := c.client.Get(ctx, c.emailKey(email)).Result()
+	switch {
+	case err == nil && data != tombstone:
+		u, err := c.decode(data)
+		if err == nil {
+			c.lookups.Inc("hit")
+			return u, nil
+		}
+		log.Printf("usercache: decoding %s: %v", c.emailKey(email), err)
+		c.lookups.Inc("error")
+	case err != nil && !errors.Is(err, redis.Nil):
+		c.lookups.Inc("error")
+		return c.Repository.FindByEmail(ctx, email, opts...)
+	default:
+		c.lookups.Inc("miss")
+	}
+
+	u, err := c.Repository.FindByEmail(ctx, email)
+	if err != nil || u == nil {
+		return u, err
+	}
+	c.fill(ctx, u)
+	return u, nil
+}
+
+// fill caches u, unless its entry was just dropped (see tombstoneTTL).
+func (c *Cache) fill(ctx context.Context, u *user.User) {
+	data, ok, err := c.encode(u)
+	if err != nil {
+		log.Printf("usercache: encoding user %d: %v", u.ID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	// The ID key first, and outliving the entry: a write finding it
+	// drops the entry about to be filled, rather than missing it.
+	pipe := c.client.Pipeline()
+	pipe.Set(ctx, c.idKey(u.ID), u.Email, c.ttl+tombstoneTTL)
+	pipe.SetNX(ctx, c.emailKey(u.Email), data, c.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("usercache: caching user %d: %v", u.ID, err)
+	}
+}
+
+// encode turns u into an entry. ok is false for a user that can't be
+// cached: one with an MFA secret and no cipher to encrypt it with.
+func (c *Cache) encode(u *user.User) (data string, ok bool, err error) {
+	e := entry{
+		ID: u.ID, ULID: u.ULID, Email: u.Email, Username: u.Username, PendingEmail: u.PendingEmail,
+		EmailVerified: u.EmailVerified, AvatarURL: u.AvatarURL, Active: u.Active,
+		PasswordHash: u.PasswordHash, TokenVersion: u.TokenVersion,
+		CreatedAt: u.CreatedAt, UpdatedAt: u.UpdatedAt, MFAEnabled: u.MFAEnabled,
+	}
+	if u.MFASecret != "" {
+		if c.secrets == nil {
+			return "", false, nil
+		}
+		if e.MFASecret, err = c.secrets.Encrypt([]byte(u.MFASecret)); err != nil {
+			return "", false, err
+		}
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return "", false, err
+	}
+	return string(b), true, nil
+}
+
+// decode turns an entry back into a user.
+func (c *Cache) decode(data string) (*user.User, error) {
+	var e entry
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return nil, err
+	}
+	u := &user.User{
+		ID: e.ID, ULID: e.ULID, Email: e.Email, Username: e.Username, PendingEmail: e.PendingEmail,
+		EmailVerified: e.EmailVerified, AvatarURL: e.AvatarURL, Active: e.Active,
+		PasswordHash: e.PasswordHash, TokenVersion: e.TokenVersion,
+		CreatedAt: e.CreatedAt, UpdatedAt: e.UpdatedAt, MFAEnabled: e.MFAEnabled,
+	}
+	if len(e.MFASecret) > 0 {
+		if c.secrets == nil {
+			return nil, errors.New("cached MFA secret but no cipher to decrypt it")
+		}
+		secret, err := c.secrets.Decrypt(e.MFASecret)
+		if err != nil {
+			return nil, fmt.Errorf("decrypting MFA secret: %w", err)
+		}
+		u.MFASecret = string(secret)
+	}
+	return u, nil
+}
+
+// Invalidate drops the cached entries of the changed users: the entry
+// under each change's email, and the one under the email the user was
+// cached with, if that's another (an email change).
+func (c *Cache) Invalidate(ctx context.Context, changes ...user.Change) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	// Two round trips for the whole batch: read the ID keys, then
+	// write every tombstone.
+	pipe := c.client.Pipeline()
+	cached := make([]*redis.StringCmd, len(changes))
+	for i, change := range changes {
+		cached[i] = pipe.Get(ctx, c.idKey(change.ID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return fmt.Errorf("reading cached emails: %w", err)
+	}
+
+	pipe = c.client.Pipeline()
+	for i, change := range changes {
+		if change.Email != "" {
+			pipe.Set(ctx, c.emailKey(change.Email), tombstone, tombstoneTTL)
+		}
+		if email, err := cached[i].Result(); err == nil && email != change.Email {
+			pipe.Set(ctx, c.emailKey(email), tombstone, tombstoneTTL)
+		}
+		pipe.Del(ctx, c.idKey(change.ID))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("dropping cached users: %w", err)
+	}
+	return nil
+}
+
+// dropped invalidates a user this process just wrote. A failure is
+// logged, not returned: the write itself succeeded, and the change feed
+// drops the entry at its next poll.
+func (c *Cache) dropped(ctx context.Context, id uint64, email string) {
+	if err := c.Invalidate(ctx, user.Change{ID: id, Email: email}); err != nil {
+		c.invalidations.Inc("write", "error")
+		log.Printf("usercache: user %d: %v (the change feed will retry)", id, err)
+		return
+	}
+	c.invalidations.Inc("write", "ok")
+}
+
+// Update writes u, then drops its entry, under its new email and its
+// old one.
+func (c *Cache) Update(ctx context.Context, u *user.User) error {
+	if err := c.Repository.Update(ctx, u); err != nil {
+		return err
+	}
+	c.dropped(ctx, u.ID, u.Email)
+	return nil
+}
+
+// Delete deletes the user, then drops its entry.
+func (c *Cache) Delete(ctx context.Context, id uint64) error {
+	if err := c.Repository.Delete(ctx, id); err != nil {
+		return err
+	}
+	c.dropped(ctx, id, "")
+	return nil
+}
+
+// SetActive deactivates or activates the user, then drops its entry.
+func (c *Cache) SetActive(ctx context.Context, id uint64, active bool) error {
+	if err := c.Repository.SetActive(ctx, id, active); err != nil {
+		return err
+	}
+	c.dropped(ctx, id, "")
+	return nil
+}
+
+// Patch writes the fields p sets, then drops the user's entry.
+func (c *Cache) Patch(ctx context.Context, id uint64, p user.Patch) error {
+	if err := c.Repository.Patch(ctx, id, p); err != nil {
+		return err
+	}
+	c.dropped(ctx, id, "")
+	return nil
+}
+
+// Anonymize scrubs the user's row, then drops its entry.
+func (c *Cache) Anonymize(ctx context.Context, id uint64, email string) error {
+	if err := c.Repository.Anonymize(ctx, id, email); err != nil {
+		return err
+	}
+	c.dropped(ctx, id, email)
+	return nil
+}
@@ -0,0 +1,84 @@
+package usercache
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go-basics/internal/domain/user"
+)
+
+// follower is the position of Follow in one change feed.
+type follower struct {
+	feed  user.ChangeFeed
+	since time.Time // Latest write handled
+}
+
+// Follow polls feeds (one per database holding users) every interval
+// until ctx is cancelled, and drops the cached entries of the users
+// written since the last poll. Run it on every instance: each poll is
+// one indexed range scan per database, and an instance following on its
+// own never waits for another to notice a write.
+//
+// Each poll reads overlap further back than the latest write it saw:
+// a row's updated_at is when it was written, not when its transaction
+// committed, so a write committed a moment late would otherwise be
+// skipped.
+//
+// WHY DROP THE OVERLAP AGAIN EVERY POLL?
+// Remembering which writes were handled would need something that tells
+// two writes apart, and updated_at can't: it has one-second precision,
+// so a user written twice in a second shows the same time both times.
+// Skipping the second as already seen would leave a cache fill made
+// between the two serving the stale row until its TTL. Dropping an entry
+// is idempotent, so every row the overlap returns is dropped again.
+//
+// When Redis fails, the poll is retried from the same point, so writes
+// made during a Redis outage are all dropped once it's back.
+func (c *Cache) Follow(ctx context.Context, interval, overlap time.Duration, feeds ...user.ChangeFeed) {
+	followers := make([]*follower, len(feeds))
+	now := time.Now()
+	for i, feed := range feeds {
+		followers[i] = &follower{feed: feed, since: now}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, f := range followers {
+				c.poll(ctx, f, overlap)
+			}
+		}
+	}
+}
+
+// poll drops the entries of the users f's feed reports written since
+// its last poll.
+func (c *Cache) poll(ctx context.Context, f *follower, overlap time.Duration) {
+	from := f.since.Add(-overlap)
+	changes, err := f.feed.ChangedSince(ctx, from)
+	if err != nil {
+		log.Printf("usercache: reading the change feed: %v", err)
+		return
+	}
+
+	latest := f.since
+	for _, change := range changes {
+		if change.UpdatedAt.After(latest) {
+			latest = change.UpdatedAt
+		}
+	}
+	if err := c.Invalidate(ctx, changes...); err != nil {
+		c.invalidations.Inc("feed", "error")
+		log.Printf("usercache: %v (retrying at the next poll)", err)
+		return
+	}
+	for range changes {
+		c.invalidations.Inc("feed", "ok")
+	}
+	f.since = latest
+}
@@ -0,0 +1,153 @@
+package usercache
+
+import (
+	"context"
+	"net"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/goleak"
+
+	"go-basics/internal/domain/user"
+	"go-basics/internal/metrics"
+)
+
+// TestMain fails the package's tests if any goroutine outlives them,
+// such as a Follow loop that missed its cancellation.
+//
+// go-redis probes an unreachable server from a goroutine of its own once
+// enough dials have failed, and only notices Close between probes, a
+// second apart. That one is the library's and ends on its own.
+func TestMain(m *testing.M) {
+	goleak.VerifyTestMain(m,
+		goleak.IgnoreAnyFunction("github.com/redis/go-redis/v9/internal/pool.(*ConnPool).tryDial"))
+}
+
+// recordingFeed reports one change on every call, and records the
+// times it was asked for changes since.
+type recordingFeed struct {
+	mu    sync.Mutex
+	since []time.Time
+}
+
+func (f *recordingFeed) ChangedSince(_ context.Context, since time.Time) ([]user.Change, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.since = append(f.since, since)
+	return []user.Change{{ID: 1, Email: "a@example.com", UpdatedAt: time.Now()}}, nil
+}
+
+func (f *recordingFeed) calls() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.since...)
+}
+
+// TestFollowRedisDown follows a feed while Redis is unreachable: every
+// poll must start from the same point, since nothing was dropped, and
+// cancelling ctx must stop Follow.
+func TestFollowRedisDown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	client := redis.NewClient(&redis.Options{Addr: addr, MaxRetries: -1, DialTimeout: time.Second})
+	defer client.Close()
+
+	cache := New(nil, client, "test:", time.Minute, metrics.NewRegistry())
+	feed := &recordingFeed{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		cache.Follow(ctx, 5*time.Millisecond, time.Second, feed)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(feed.calls()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for Follow to poll")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Follow didn't return after ctx was cancelled")
+	}
+
+	calls := feed.calls()
+	for i, since := range calls[1:] {
+		if !since.Equal(calls[0]) {
+			t.Errorf("poll %d read since %s, want %s (the failed poll's start)", i+2, since, calls[0])
+		}
+	}
+}
+
+// scriptedFeed answers each call with the next of its polls.
+type scriptedFeed struct {
+	polls [][]user.Change
+}
+
+func (f *scriptedFeed) ChangedSince(context.Context, time.Time) ([]user.Change, error) {
+	changes := f.polls[0]
+	f.polls = f.polls[1:]
+	return changes, nil
+}
+
+// deletedKeys is a Redis that answers every pipeline itself, without a
+// server: GETs find nothing, and the keys of DELs are recorded.
+type deletedKeys struct {
+	keys []string
+}
+
+func (d *deletedKeys) DialHook(next redis.DialHook) redis.DialHook { return next }
+
+func (d *deletedKeys) ProcessHook(next redis.ProcessHook) redis.ProcessHook { return next }
+
+func (d *deletedKeys) ProcessPipelineHook(redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(_ context.Context, cmds []redis.Cmder) error {
+		for _, cmd := range cmds {
+			switch cmd.Name() {
+			case "get":
+				cmd.SetErr(redis.Nil)
+			case "del":
+				d.keys = append(d.keys, cmd.Args()[1].(string))
+			}
+		}
+		return nil
+	}
+}
+
+// TestFollowSameSecondWrites follows a user written twice within one
+// second: updated_at has one-second precision, so the second poll sees
+// the same time as the first. It must drop the entry again, or a cache
+// fill made between the two writes serves the first one's row.
+func TestFollowSameSecondWrites(t *testing.T) {
+	redisHook := &deletedKeys{}
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	client.AddHook(redisHook)
+	defer client.Close()
+	cache := New(nil, client, "test:", time.Minute, metrics.NewRegistry())
+
+	written := time.Now().Truncate(time.Second)
+	change := user.Change{ID: 1, Email: "a@example.com", UpdatedAt: written}
+	f := &follower{
+		// The first write, then the row as the second write left it.
+		feed:  &scriptedFeed{polls: [][]user.Change{{change}, {change}}},
+		since: written.Add(-time.Second),
+	}
+	cache.poll(context.Background(), f, time.Second)
+	cache.poll(context.Background(), f, time.Second)
+
+	if want := []string{cache.idKey(1), cache.idKey(1)}; !slices.Equal(redisHook.keys, want) {
+		t.Errorf("deleted %q, want %q: once per poll", redisHook.keys, want)
+	}
+}
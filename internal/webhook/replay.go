@@ -0,0 +1,104 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReplayCache remembers the deliveries a Receiver has accepted.
+type ReplayCache interface {
+	// Claim records key for ttl and returns true, or returns false if
+	// key is already recorded. It must be atomic: of two concurrent
+	// Claims of the same key, only one may return true.
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+
+	// Release forgets key, after its delivery failed.
+	Release(ctx context.Context, key string) error
+}
+
+// sweepEvery is how many Claims pass between removals of expired keys.
+const sweepEvery = 1024
+
+// MemoryReplayCache keeps delivery IDs in process memory. It only sees
+// the deliveries sent to this instance; use a RedisReplayCache when
+// several instances receive webhooks.
+type MemoryReplayCache struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	calls   int
+	now     func() time.Time
+}
+
+// NewMemoryReplayCache creates an empty in-memory cache.
+func NewMemoryReplayCache() *MemoryReplayCache {
+	return &MemoryReplayCache{expires: make(map[string]time.Time), now: time.Now}
+}
+
+// Claim implements ReplayCache.
+func (c *MemoryReplayCache) Claim(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	if c.calls%sweepEvery == 0 {
+		c.sweep(now)
+	}
+	if exp, ok := c.expires[key]; ok && exp.After(now) {
+		return false, nil
+	}
+	c.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+// Release implements ReplayCache.
+func (c *MemoryReplayCache) Release(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.expires, key)
+	return nil
+}
+
+// sweep drops expired keys. The caller must hold c.mu.
+func (c *MemoryReplayCache) sweep(now time.Time) {
+	for key, exp := range c.expires {
+		if !exp.After(now) {
+			delete(c.expires, key)
+		}
+	}
+}
+
+// RedisReplayCache keeps delivery IDs in Redis, so a replay is caught
+// whichever instance it reaches.
+type RedisReplayCache struct {
+	client redis.UniversalClient
+	prefix string // Namespaces keys, e.g. "webhook:"
+}
+
+// NewRedisReplayCache creates a cache on an existing Redis client.
+func NewRedisReplayCache(client redis.UniversalClient, prefix string) *RedisReplayCache {
+	return &RedisReplayCache{client: client, prefix: prefix}
+}
+
+// Claim implements ReplayCache. SET NX is the atomic "record unless
+// present", and PX makes Redis forget the key on its own.
+func (c *RedisReplayCache) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	ok, err := c.client.SetNX(ctx, c.prefix+key, 1, ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("claiming webhook id: %w", err)
+	}
+	return ok, nil
+}
+
+// Release implements ReplayCache.
+func (c *RedisReplayCache) Release(ctx context.Context, key string) error {
+	if err := c.client.Del(ctx, c.prefix+key).Err(); err != nil {
+		return fmt.Errorf("releasing webhook id: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+// Package webhook receives webhooks from third parties (payment
+// providers, identity providers, ...): it checks each delivery's
+// signature and age, drops replays, and dispatches the event to the
+// handler registered for its type.
+//
+// Deliveries follow the Standard Webhooks spec (standardwebhooks.com),
+// which Svix, Clerk, and a growing list of providers send:
+//
+//	POST /webhooks/{receiver}
+//	webhook-id: msg_2KWPBgLlAfxdpx2AI54pPJ85f4W
+//	webhook-timestamp: 1674087231
+//	webhook-signature: v1,K5oZfzN95Z9UVu1EsfQmfVNQhnkZ2pj9o9NDN/H/pI4=
+//
+//	{"type": "invoice.paid", "timestamp": "2023-01-19T00:13:51Z", "data": {...}}
+//
+// The signature is an HMAC-SHA256, with the shared secret, of
+// "{id}.{timestamp}.{body}".
+//
+// WHY EACH CHECK?
+//   - Signature: the endpoint is public. Without it anyone could post
+//     "invoice.paid".
+//   - Timestamp: a captured delivery stays validly signed forever. Only
+//     accepting recent ones limits how long it's worth anything.
+//   - Replay cache: within that window, the same delivery could still be
+//     sent again. Remembering the IDs seen during it closes the gap, and
+//     also drops the provider's own retries of a delivery we've handled.
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults for a Receiver.
+const (
+	DefaultTolerance   = 5 * time.Minute
+	DefaultMaxBodySize = 1 << 20 // 1MB
+)
+
+// Sentinel errors, returned by Verify.
+var (
+	// ErrMissingHeaders is returned when a webhook-* header is missing.
+	ErrMissingHeaders = errors.New("missing webhook headers")
+
+	// ErrBadSignature is returned when no signature matches any secret.
+	ErrBadSignature = errors.New("webhook signature doesn't match")
+
+	// ErrStale is returned for a timestamp outside the tolerance, in
+	// either direction.
+	ErrStale = errors.New("webhook timestamp outside tolerance")
+)
+
+// Event is one verified delivery.
+type Event struct {
+	ID        string          // The webhook-id header: unique per event, the same on retries
+	Type      string          // e.g. "invoice.paid"
+	Timestamp time.Time       // When the sender signed it
+	Data      json.RawMessage // The event's "data", for the handler to decode
+	Body      []byte          // The whole body, as signed
+}
+
+// HandlerFunc handles one type of event. An error makes the delivery
+// fail with 500, so the sender retries it later.
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Receiver verifies and dispatches one sender's webhooks.
+type Receiver struct {
+	name        string
+	secrets     [][]byte
+	tolerance   time.Duration
+	maxBodySize int64
+	replays     ReplayCache
+	handlers    map[string]HandlerFunc
+	now         func() time.Time
+}
+
+// Option configures optional Receiver behavior.
+type Option func(*Receiver)
+
+// WithTolerance sets how far a delivery's timestamp may be from our
+// clock, either way. Default: DefaultTolerance.
+func WithTolerance(d time.Duration) Option {
+	return func(r *Receiver) {
+		r.tolerance = d
+	}
+}
+
+// WithReplayCache remembers delivery IDs in cache, e.g. one in Redis
+// shared by every instance. Default: a MemoryReplayCache, which only
+// catches replays to the same instance.
+func WithReplayCache(cache ReplayCache) Option {
+	return func(r *Receiver) {
+		r.replays = cache
+	}
+}
+
+// WithMaxBodySize caps the body read. Default: DefaultMaxBodySize.
+func WithMaxBodySize(n int64) Option {
+	return func(r *Receiver) {
+		r.maxBodySize = n
+	}
+}
+
+// New creates a Receiver named name (its path segment, and its replay
+// cache namespace) that accepts deliveries signed with any of secrets.
+//
+// Secrets are as the sender shows them: "whsec_" and base64, or (for
+// senders that hand out plain strings) any other string, used as is.
+// Several secrets allow rotation: add the new one, switch the sender
+// over, then remove the old one.
+func New(name string, secrets []string, opts ...Option) (*Receiver, error) {
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("webhook receiver %q needs a secret", name)
+	}
+	r := &Receiver{
+		name:        name,
+		tolerance:   DefaultTolerance,
+		maxBodySize: DefaultMaxBodySize,
+		handlers:    make(map[string]HandlerFunc),
+		now:         time.Now,
+	}
+	for _, secret := range secrets {
+		key, err := decodeSecret(secret)
+		if err != nil {
+			return nil, fmt.Errorf("webhook receiver %q: %w", name, err)
+		}
+		r.secrets = append(r.secrets, key)
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.replays == nil {
+		r.replays = NewMemoryReplayCache()
+	}
+	return r, nil
+}
+
+// decodeSecret returns the HMAC key a secret stands for.
+func decodeSecret(secret string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(secret, "whsec_")
+	if !ok {
+		return []byte(secret), nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("decoding whsec_ secret: %w", err)
+	}
+	return key, nil
+}
+
+// Name returns the receiver's name.
+func (r *Receiver) Name() string {
+	return r.name
+}
+
+// Handle registers fn for events of eventType. Register handlers at
+// startup, before the receiver serves requests.
+func (r *Receiver) Handle(eventType string, fn HandlerFunc) {
+	r.handlers[eventType] = fn
+}
+
+// Verify checks a delivery's signature and timestamp, and returns its ID
+// and timestamp. It doesn't consult the replay cache.
+func (r *Receiver) Verify(header http.Header, body []byte) (string, time.Time, error) {
+	id := header.Get("webhook-id")
+	ts := header.Get("webhook-timestamp")
+	signatures := header.Get("webhook-signature")
+	if id == "" || ts == "" || signatures == "" {
+		return "", time.Time{}, ErrMissingHeaders
+	}
+
+	seconds, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: malformed timestamp", ErrStale)
+	}
+	sent := time.Unix(seconds, 0)
+	if age := r.now().Sub(sent); age > r.tolerance || age < -r.tolerance {
+		return "", time.Time{}, fmt.Errorf("%w: signed %v ago", ErrStale, age.Round(time.Second))
+	}
+
+	// The header may carry several "v1,<base64>" signatures, separated by
+	// spaces, e.g. one per secret while the sender rotates.
+	for _, secret := range r.secrets {
+		mac := hmac.New(sha256.New, secret)
+		fmt.Fprintf(mac, "%s.%s.", id, ts)
+		mac.Write(body)
+		expected := mac.Sum(nil)
+		for _, sig := range strings.Fields(signatures) {
+			version, encoded, ok := strings.Cut(sig, ",")
+			if !ok || version != "v1" {
+				continue
+			}
+			got, err := base64.StdEncoding.DecodeString(encoded)
+			// SECURITY: constant-time, like every secret comparison.
+			if err == nil && hmac.Equal(got, expected) {
+				return id, sent, nil
+			}
+		}
+	}
+	return "", time.Time{}, ErrBadSignature
+}
+
+// ServeHTTP receives one delivery.
+//
+// The status tells the sender what to do next: 2xx means done (including
+// for a replay, or a type nobody handles), 4xx means the delivery is bad
+// and retrying it won't help, 5xx means try again later.
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, r.maxBodySize))
+	if err != nil {
+		http.Error(w, "request body too large or unreadable", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	id, sent, err := r.Verify(req.Header, body)
+	switch {
+	case errors.Is(err, ErrBadSignature):
+		log.Printf("webhook %s: rejected delivery: %v", r.name, err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	case err != nil:
+		log.Printf("webhook %s: rejected delivery: %v", r.name, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var payload struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil || payload.Type == "" {
+		http.Error(w, "body must be a JSON object with a type", http.StatusBadRequest)
+		return
+	}
+
+	// Claimed only after the signature checks out, so forged deliveries
+	// can't fill the cache or block a real ID. An entry needs to outlive
+	// the window in which the delivery would still pass the timestamp
+	// check: tolerance on either side of the time it was signed.
+	key := r.name + ":" + id
+	fresh, err := r.replays.Claim(req.Context(), key, 2*r.tolerance)
+	if err != nil {
+		// Failing open would let replays through whenever the cache is down.
+		log.Printf("webhook %s: replay cache: %v", r.name, err)
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+		return
+	}
+	if !fresh {
+		log.Printf("webhook %s: dropped replay of %s", r.name, id)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	handler, ok := r.handlers[payload.Type]
+	if !ok {
+		// Senders send every event type the endpoint is subscribed to.
+		// Refusing the ones we don't handle would only make them retry.
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	event := Event{ID: id, Type: payload.Type, Timestamp: sent, Data: payload.Data, Body: body}
+	if err := handler(req.Context(), event); err != nil {
+		log.Printf("webhook %s: handling %s (%s): %v", r.name, payload.Type, id, err)
+		// Forget the ID, or the sender's retry would be dropped as a replay.
+		if err := r.replays.Release(context.WithoutCancel(req.Context()), key); err != nil {
+			log.Printf("webhook %s: releasing %s: %v", r.name, id, err)
+		}
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Registry routes deliveries to Receivers by name.
+type Registry struct {
+	receivers map[string]*Receiver
+}
+
+// NewRegistry creates a registry of receivers.
+func NewRegistry(receivers ...*Receiver) *Registry {
+	reg := &Registry{receivers: make(map[string]*Receiver, len(receivers))}
+	for _, r := range receivers {
+		reg.receivers[r.name] = r
+	}
+	return reg
+}
+
+// Receiver returns the receiver named name, to register handlers on.
+func (reg *Registry) Receiver(name string) (*Receiver, bool) {
+	r, ok := reg.receivers[name]
+	return r, ok
+}
+
+// Len returns the number of receivers.
+func (reg *Registry) Len() int {
+	return len(reg.receivers)
+}
+
+// ServeHTTP dispatches to the receiver named by the {receiver} path
+// parameter. Unknown names are 404, like any unknown route.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r, ok := reg.receivers[req.PathValue("receiver")]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	r.ServeHTTP(w, req)
+}
@@ -0,0 +1,335 @@
+// Package webpush sends Web Push messages to browsers (RFC 8030), with
+// encrypted payloads (RFC 8291) and VAPID sender identification
+// (RFC 8292).
+//
+// HOW A PUSH REACHES A BROWSER:
+// A browser that subscribes gets an endpoint URL at its vendor's push
+// service (Google's for Chrome, Mozilla's for Firefox, ...) and two keys.
+// We POST the message to the endpoint; the push service delivers it to
+// the browser whenever it's online, even with our page closed.
+//
+// WHY ENCRYPT?
+// The push service carries the message but shouldn't read it. Each
+// subscription comes with the browser's public key (p256dh) and a shared
+// secret (auth); the payload is encrypted for them, so only that browser
+// can decrypt it.
+//
+// WHY VAPID?
+// It ties the subscription to us: the browser subscribed with our public
+// key, and every push is signed with the matching private key, so a
+// stolen endpoint URL is useless to anyone else.
+package webpush
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Encoding of the encrypted payload: one aes128gcm record.
+const (
+	recordSize = 4096 // The most push services must accept
+	saltSize   = 16
+	keySize    = 65 // Uncompressed P-256 point
+	tagSize    = 16 // AES-GCM authentication tag
+	headerSize = saltSize + 4 + 1 + keySize
+
+	// MaxPayload is the largest payload that fits in one record: the
+	// header, the tag, and the one-byte delimiter take the rest.
+	MaxPayload = recordSize - headerSize - tagSize - 1
+)
+
+// vapidTokenTTL is how long a VAPID signature is valid. RFC 8292 caps it
+// at 24 hours; a fresh one is signed for every push anyway.
+const vapidTokenTTL = 12 * time.Hour
+
+// sendTimeout bounds one request to a push service.
+const sendTimeout = 10 * time.Second
+
+// Sentinel errors.
+var (
+	// ErrGone is returned when the push service no longer knows the
+	// subscription (the user unsubscribed or the browser dropped it).
+	// Delete the subscription: it will never work again.
+	ErrGone = errors.New("push subscription expired")
+
+	// ErrPayloadTooLarge is returned for a payload over MaxPayload.
+	ErrPayloadTooLarge = errors.New("push payload too large")
+
+	// ErrInvalidKeys is returned for subscription keys that aren't a
+	// P-256 public key and a 16-byte secret.
+	ErrInvalidKeys = errors.New("invalid push subscription keys")
+)
+
+// Subscription is where and for whom to encrypt a push: the fields of a
+// browser's PushSubscription, keys in unpadded base64url as the browser
+// gives them.
+type Subscription struct {
+	Endpoint string
+	P256dh   string // The browser's public key
+	Auth     string // The shared authentication secret
+}
+
+// Urgency tells the push service how soon to wake the device.
+type Urgency string
+
+// Urgencies (RFC 8030 section 5.3). A normal push may wait for the
+// device to wake; a high one wakes it.
+const (
+	UrgencyNormal Urgency = "normal"
+	UrgencyHigh   Urgency = "high"
+)
+
+// Message is one push.
+type Message struct {
+	Payload []byte        // Encrypted before sending; at most MaxPayload bytes
+	TTL     time.Duration // How long the push service keeps it for an offline browser
+	Urgency Urgency       // Empty is normal
+	Topic   string        // Optional: a newer message with the same topic replaces an undelivered one
+}
+
+// Sender signs and sends pushes with one VAPID key pair.
+type Sender struct {
+	key       *ecdsa.PrivateKey
+	publicKey string // key's public half, encoded for browsers
+	subject   string // mailto: or https: contact for push service operators
+	client    *http.Client
+}
+
+// NewSender creates a sender from a VAPID private key, in unpadded
+// base64url as GenerateKey returns it. subject is a mailto: or https:
+// URL push services can use to reach us about our traffic.
+func NewSender(privateKey, subject string) (*Sender, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("decoding VAPID private key: %w", err)
+	}
+	key, err := ecdsa.ParseRawPrivateKey(elliptic.P256(), raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing VAPID private key: %w", err)
+	}
+	if u, err := url.Parse(subject); err != nil || (u.Scheme != "mailto" && u.Scheme != "https") {
+		return nil, fmt.Errorf("VAPID subject must be a mailto: or https: URL")
+	}
+	publicKey, err := encodePublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("encoding VAPID public key: %w", err)
+	}
+	return &Sender{
+		key:       key,
+		publicKey: publicKey,
+		subject:   subject,
+		client:    &http.Client{Timeout: sendTimeout},
+	}, nil
+}
+
+// GenerateKey returns a new VAPID key pair, in unpadded base64url.
+func GenerateKey() (privateKey, publicKey string, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	raw, err := key.Bytes()
+	if err != nil {
+		return "", "", err
+	}
+	publicKey, err = encodePublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), publicKey, nil
+}
+
+// PublicKey returns the VAPID public key in unpadded base64url: the
+// applicationServerKey browsers subscribe with.
+func (s *Sender) PublicKey() string {
+	return s.publicKey
+}
+
+// CheckSubscription reports whether the subscription's keys can be
+// encrypted for, so a bad one is refused when it's registered rather
+// than on every push.
+func CheckSubscription(sub Subscription) error {
+	_, _, err := decodeKeys(sub)
+	return err
+}
+
+// Send encrypts msg for the subscription and posts it to its push
+// service. It returns ErrGone if the subscription no longer exists; any
+// other error may be temporary.
+func (s *Sender) Send(ctx context.Context, sub Subscription, msg Message) error {
+	if len(msg.Payload) > MaxPayload {
+		return ErrPayloadTooLarge
+	}
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil || endpoint.Scheme != "https" {
+		return fmt.Errorf("push endpoint must be an https URL")
+	}
+	body, err := encrypt(sub, msg.Payload)
+	if err != nil {
+		return err
+	}
+	authorization, err := s.vapid(endpoint)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(msg.TTL/time.Second)))
+	if msg.Urgency != "" {
+		req.Header.Set("Urgency", string(msg.Urgency))
+	}
+	if msg.Topic != "" {
+		req.Header.Set("Topic", msg.Topic)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("sending push: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused.
+	detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return ErrGone
+	default:
+		return fmt.Errorf("push service returned %s: %s", resp.Status, bytes.TrimSpace(detail))
+	}
+}
+
+// vapid returns the Authorization header for a push to endpoint
+// (RFC 8292): a JWT for the push service's origin, and our public key.
+func (s *Sender) vapid(endpoint *url.URL) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(vapidTokenTTL).Unix(),
+		"sub": s.subject,
+	})
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("signing VAPID token: %w", err)
+	}
+	return "vapid t=" + signed + ", k=" + s.PublicKey(), nil
+}
+
+// encrypt encodes payload as one aes128gcm record for the subscription
+// (RFC 8291 section 3 and RFC 8188):
+//
+//	salt (16) | record size (4) | key ID length (1) | our ephemeral public key (65) | ciphertext
+//
+// A fresh key pair and salt per message mean no two pushes share a
+// content key, even with the same payload.
+func encrypt(sub Subscription, payload []byte) ([]byte, error) {
+	uaPublic, authSecret, err := decodeKeys(sub)
+	if err != nil {
+		return nil, err
+	}
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	shared, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("computing shared secret: %w", err)
+	}
+
+	// Mix the auth secret into the ECDH secret, bound to both public keys.
+	keyInfo := "WebPush: info\x00" + string(uaPublic.Bytes()) + string(asPublic)
+	ikm, err := hkdf.Key(sha256.New, shared, authSecret, keyInfo, 32)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	cek, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hkdf.Key(sha256.New, ikm, salt, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, headerSize+len(payload)+1+tagSize)
+	out = append(out, salt...)
+	out = binary.BigEndian.AppendUint32(out, recordSize)
+	out = append(out, keySize)
+	out = append(out, asPublic...)
+	// 0x02 marks the last (here, only) record; no padding follows.
+	plaintext := append(append([]byte{}, payload...), 0x02)
+	return gcm.Seal(out, nonce, plaintext, nil), nil
+}
+
+// decodeKeys decodes the subscription's public key and auth secret.
+// Browsers send unpadded base64url; padded input is accepted too.
+func decodeKeys(sub Subscription) (*ecdh.PublicKey, []byte, error) {
+	p256dh, err := decodeBase64(sub.P256dh)
+	if err != nil {
+		return nil, nil, ErrInvalidKeys
+	}
+	public, err := ecdh.P256().NewPublicKey(p256dh)
+	if err != nil {
+		return nil, nil, ErrInvalidKeys
+	}
+	auth, err := decodeBase64(sub.Auth)
+	if err != nil || len(auth) != 16 {
+		return nil, nil, ErrInvalidKeys
+	}
+	return public, auth, nil
+}
+
+// decodeBase64 decodes base64url with or without padding.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// encodePublicKey encodes a P-256 public key as an uncompressed point in
+// unpadded base64url.
+func encodePublicKey(pub *ecdsa.PublicKey) (string, error) {
+	raw, err := pub.Bytes()
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
@@ -22,15 +22,43 @@ CREATE TABLE IF NOT EXISTS users (
     -- AUTO_INCREMENT automatically generates unique IDs
     id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
 
+    -- Public ID: a ULID, assigned by the user.AssignULID hook on create
+    -- NULL = created before the column existed
+    ulid CHAR(26) NULL DEFAULT NULL,
+
     -- Email with unique constraint prevents duplicates
     -- VARCHAR(255) is the max length for indexed columns in MySQL with utf8mb4
     email VARCHAR(255) NOT NULL,
 
+    -- Optional handle to sign in with instead of the email
+    -- NULL = none. Stored normalized (lowercase); see user.NormalizeUsername
+    username VARCHAR(30) NULL DEFAULT NULL,
+
+    -- Address the user asked to change to, until they confirm it
+    -- NULL = no change pending; not unique, since it isn't theirs yet
+    pending_email VARCHAR(255) NULL DEFAULT NULL,
+
+    -- When the user proved the email is theirs (confirmed an email change,
+    -- or signed up through SSO); NULL = never. GET /users filters on it
+    email_verified_at TIMESTAMP NULL DEFAULT NULL,
+
+    -- Public URL of the profile picture, in the avatar blob store
+    -- NULL = no avatar. 2048 fits any CDN or bucket URL
+    avatar_url VARCHAR(2048) NULL DEFAULT NULL,
+
+    -- 0 = deactivated by an admin (POST /users/{id}/deactivate): the
+    -- account stays, but can't sign in or use its tokens until activated
+    is_active TINYINT(1) NOT NULL DEFAULT 1,
+
     -- Password hash storage
     -- bcrypt hashes are always 60 characters, but we use 255 for flexibility
     -- NEVER store plain-text passwords!
     password_hash VARCHAR(255) NOT NULL,
 
+    -- Copied into every access token; raised on a password change or
+    -- reset, which makes every token issued before it invalid
+    token_version INT UNSIGNED NOT NULL DEFAULT 0,
+
     -- Timestamps for auditing
     -- created_at: When the record was created
     -- updated_at: When the record was last modified
@@ -42,12 +70,29 @@ CREATE TABLE IF NOT EXISTS users (
     -- All queries must filter: WHERE deleted_at IS NULL
     deleted_at TIMESTAMP NULL DEFAULT NULL,
 
+    -- Two-factor authentication (TOTP)
+    -- mfa_secret is AES-GCM encrypted by the application (key: MFA_ENCRYPTION_KEY)
+    -- NULL = never enrolled; mfa_enabled_at NULL = enrollment not confirmed
+    mfa_secret VARBINARY(255) NULL DEFAULT NULL,
+    mfa_enabled_at TIMESTAMP NULL DEFAULT NULL,
+
     -- Primary key constraint
     PRIMARY KEY (id),
 
     -- Unique constraint on email (excluding soft-deleted users)
     -- This allows re-registration with an email after account deletion
-    UNIQUE KEY uk_users_email (email)
+    UNIQUE KEY uk_users_email (email),
+
+    -- Usernames are unique too; NULLs don't collide, so accounts
+    -- without one don't either
+    UNIQUE KEY uk_users_username (username),
+
+    -- ULIDs are unique; NULLs (older accounts) don't collide
+    UNIQUE KEY uk_users_ulid (ulid),
+
+    -- Word search over emails (GET /users/search); see searchMatch in
+    -- internal/repository/mysql/user_search.go
+    FULLTEXT KEY idx_users_email_fulltext (email)
 ) ENGINE=InnoDB                     -- InnoDB supports transactions
   DEFAULT CHARSET=utf8mb4           -- Full Unicode support
   COLLATE=utf8mb4_unicode_ci;       -- Case-insensitive comparison
@@ -60,3 +105,384 @@ CREATE INDEX idx_users_deleted_at ON users(deleted_at);
 -- The UNIQUE constraint already creates an index, but we make it explicit
 -- This index includes deleted_at for filtered lookups
 CREATE INDEX idx_users_email_active ON users(email, deleted_at);
+
+-- Index for keyset pagination
+-- List queries use WHERE (created_at, id) > (?, ?) ORDER BY created_at, id,
+-- so this index lets every page be a single index seek
+CREATE INDEX idx_users_created_at_id ON users(created_at, id);
+
+-- Index for the user cache's change feed
+-- It reads WHERE updated_at >= ? ORDER BY updated_at, id to find the
+-- users written since its last poll, by anyone
+CREATE INDEX idx_users_updated_at_id ON users(updated_at, id);
+
+-- Roles for role-based access control (RBAC)
+-- Each role is a named set of privileges; users can have several roles
+CREATE TABLE IF NOT EXISTS roles (
+    id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    name VARCHAR(50) NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_roles_name (name)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Many-to-many link between users and roles
+-- The composite primary key prevents assigning the same role twice
+-- No foreign key to users: in sharded mode users live in other databases
+CREATE TABLE IF NOT EXISTS user_roles (
+    user_id BIGINT UNSIGNED NOT NULL,
+    role_id INT UNSIGNED NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, role_id),
+    KEY idx_user_roles_role_id (role_id),
+    CONSTRAINT fk_user_roles_role FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Seed the built-in roles
+INSERT IGNORE INTO roles (name) VALUES ('user'), ('admin');
+
+-- To create the first admin, run after registering:
+-- INSERT INTO user_roles (user_id, role_id)
+-- SELECT u.id, r.id FROM users u JOIN roles r ON r.name = 'admin'
+-- WHERE u.email = 'you@example.com';
+
+-- Password reset tokens
+-- Only the SHA-256 hash of each token is stored (hex, so always 64 chars)
+-- used_at makes tokens single-use; expires_at bounds how long a link works
+-- TIMESTAMP values are written in UTC by the application
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    token_hash CHAR(64) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (token_hash),
+    KEY idx_password_reset_tokens_user_id (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Email change tokens, sent to the new address
+-- Same shape and rules as password_reset_tokens; confirming one moves
+-- users.pending_email into users.email
+CREATE TABLE IF NOT EXISTS email_change_tokens (
+    token_hash CHAR(64) NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (token_hash),
+    KEY idx_email_change_tokens_user_id (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Refresh-token sessions, one row per signed-in device
+-- Only the SHA-256 hash of the current refresh token is stored; it is
+-- replaced on every refresh. Deleting a row signs that device out.
+-- ip_address is VARCHAR(45) to fit the longest IPv6 text form
+-- dpop_jkt is the thumbprint of the DPoP key the refresh token is bound
+-- to, NULL if it isn't; ascii_bin because base64url is case-sensitive
+CREATE TABLE IF NOT EXISTS sessions (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    dpop_jkt CHAR(43) CHARACTER SET ascii COLLATE ascii_bin NULL DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_sessions_token_hash (token_hash),
+    KEY idx_sessions_user_id (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Background jobs saved at shutdown, for the next process to resume
+-- Rows only exist between a shutdown and the next start; payload is the
+-- job's JSON input (e.g. an email to send); attempts and error_trace (a
+-- JSON array) carry a failing job's retries over the restart
+CREATE TABLE IF NOT EXISTS job_spool (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    kind VARCHAR(100) NOT NULL,
+    payload MEDIUMBLOB NOT NULL,
+    attempts INT UNSIGNED NOT NULL DEFAULT 0,
+    error_trace MEDIUMTEXT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Background jobs that failed on every attempt, kept for an operator to
+-- requeue or discard (see /admin/jobs/dead-letters); error_trace is a JSON
+-- array of each attempt's error
+CREATE TABLE IF NOT EXISTS job_dead_letters (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    kind VARCHAR(100) NOT NULL,
+    payload MEDIUMBLOB NOT NULL,
+    attempts INT UNSIGNED NOT NULL,
+    error_trace MEDIUMTEXT NOT NULL,
+    failed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Jobs to queue later: once at run_at, or every every_seconds from then
+-- on (0 = once). A unique_key (e.g. "reverify-reminder:user:42") allows
+-- at most one pending schedule per key; NULL keys don't collide
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    kind VARCHAR(100) NOT NULL,
+    payload MEDIUMBLOB NOT NULL,
+    unique_key VARCHAR(191) NULL DEFAULT NULL,
+    run_at TIMESTAMP NOT NULL,
+    every_seconds INT UNSIGNED NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_scheduled_jobs_unique_key (unique_key),
+    KEY idx_scheduled_jobs_run_at (run_at)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Low-priority notifications waiting for the user's next digest email
+-- A digest takes (and deletes) all of a user's rows at once
+CREATE TABLE IF NOT EXISTS pending_notifications (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    kind VARCHAR(100) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    KEY idx_pending_notifications_user_id (user_id, id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- How often each user wants the digest (immediate, hourly, daily, weekly)
+-- No row means NOTIFY_DEFAULT_FREQUENCY
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id BIGINT UNSIGNED NOT NULL,
+    frequency VARCHAR(16) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Browsers subscribed to web push notifications
+-- One row per endpoint (unique by hash: endpoints outgrow an index);
+-- p256dh and auth are the keys each push is encrypted for
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    endpoint_hash CHAR(64) NOT NULL,
+    endpoint TEXT NOT NULL,
+    p256dh VARCHAR(128) NOT NULL,
+    auth VARCHAR(64) NOT NULL,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_push_subscriptions_endpoint_hash (endpoint_hash),
+    KEY idx_push_subscriptions_user_id (user_id, created_at)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Audit trail, when AUDIT_SINKS or AUDIT_ROUTES includes mysql
+-- Insert-only: grant the writing account INSERT and SELECT, nothing more
+-- Hash-chained: hash covers the row and prev_hash, the previous row's hash
+CREATE TABLE IF NOT EXISTS audit_events (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    occurred_at TIMESTAMP(6) NOT NULL,
+    category VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    seq BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    prev_hash CHAR(64) NOT NULL DEFAULT '',
+    hash CHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (id),
+    KEY idx_audit_events_category_occurred_at (category, occurred_at),
+    KEY idx_audit_events_seq (seq)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- The end of the audit hash chain: one row, locked by each insert so
+-- instances append one at a time (grant UPDATE on this table too)
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id TINYINT UNSIGNED NOT NULL,
+    seq BIGINT UNSIGNED NOT NULL,
+    hash CHAR(64) NOT NULL,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO audit_chain_head (id, seq, hash) VALUES (1, 0, REPEAT('0', 64));
+
+-- When and from where (NULL if unknown) each account was last signed in
+-- to (login, refresh, or registration), and how far the dormancy policy has gone with it
+-- NULL = that step hasn't happened; a login clears warned_at and
+-- delete_after, only an admin clears disabled_at
+CREATE TABLE IF NOT EXISTS account_activity (
+    user_id BIGINT UNSIGNED NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    last_login_ip VARCHAR(45) NULL DEFAULT NULL,
+    warned_at TIMESTAMP NULL DEFAULT NULL,
+    disabled_at TIMESTAMP NULL DEFAULT NULL,
+    delete_after TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (user_id),
+    KEY idx_account_activity_last_login_at (last_login_at)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Each tenant's (X-Tenant-ID's) allowlists, edited through
+-- /admin/tenants: CORS origins, OAuth redirect URIs, and webhook
+-- destinations, each a JSON array of strings
+CREATE TABLE IF NOT EXISTS tenant_policies (
+    tenant_id VARCHAR(64) NOT NULL,
+    cors_origins TEXT NOT NULL,
+    redirect_uris TEXT NOT NULL,
+    webhook_urls TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Each user's client preferences (/users/{id}/preferences): known keys
+-- and free-form extras, as one JSON document
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id BIGINT UNSIGNED NOT NULL,
+    data TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Hashes of two-factor recovery codes (POST /auth/mfa/confirm): single
+-- use, so used_at is set instead of deleting the row
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+    user_id BIGINT UNSIGNED NOT NULL,
+    code_hash CHAR(64) NOT NULL,
+    used_at TIMESTAMP NULL DEFAULT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, code_hash)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Pending right-to-erasure requests (POST /users/{id}/anonymize): the
+-- user is anonymized once anonymize_after passes, or an admin confirms
+CREATE TABLE IF NOT EXISTS anonymization_requests (
+    user_id BIGINT UNSIGNED NOT NULL,
+    requested_by BIGINT UNSIGNED NOT NULL,
+    requested_at TIMESTAMP NOT NULL,
+    anonymize_after TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id),
+    KEY idx_anonymization_requests_anonymize_after (anonymize_after)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Countries each user signed in from, for the login risk score's geo
+-- signal (RISK_COUNTRY_HEADER)
+CREATE TABLE IF NOT EXISTS login_countries (
+    user_id BIGINT UNSIGNED NOT NULL,
+    country CHAR(2) NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, country)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Each user's recent logins (GET /users/{id}/logins), the newest 50 kept
+CREATE TABLE IF NOT EXISTS login_history (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    user_agent VARCHAR(255) NOT NULL,
+    ip_address VARCHAR(45) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_login_history_user_id (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Invitations to accounts created for their invitee (POST /invitations)
+-- The account is created with the invitation, with no usable password;
+-- accepting sets one. Only the SHA-256 hash of the current token is
+-- stored; resending replaces it. Neither accepted nor revoked and past
+-- expires_at is expired
+CREATE TABLE IF NOT EXISTS invitations (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    user_id BIGINT UNSIGNED NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    invited_by BIGINT UNSIGNED NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    sent_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    accepted_at TIMESTAMP NULL DEFAULT NULL,
+    revoked_at TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_invitations_token_hash (token_hash),
+    KEY idx_invitations_user_id (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- Admin announcements sent to a segment of the users (POST
+-- /admin/campaigns). A zero segment column leaves that condition out.
+-- cursor_pos is the encoded user list cursor the next batch starts
+-- after; the counts add up the rows in campaign_deliveries
+CREATE TABLE IF NOT EXISTS campaigns (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    segment_created_from TIMESTAMP NULL DEFAULT NULL,
+    segment_created_to TIMESTAMP NULL DEFAULT NULL,
+    segment_role VARCHAR(50) NOT NULL DEFAULT '',
+    segment_active_since TIMESTAMP NULL DEFAULT NULL,
+    segment_inactive_since TIMESTAMP NULL DEFAULT NULL,
+    status VARCHAR(16) NOT NULL,
+    created_by BIGINT UNSIGNED NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP NULL DEFAULT NULL,
+    ended_at TIMESTAMP NULL DEFAULT NULL,
+    cursor_pos VARCHAR(255) NOT NULL DEFAULT '',
+    sent INT UNSIGNED NOT NULL DEFAULT 0,
+    failed INT UNSIGNED NOT NULL DEFAULT 0,
+    skipped INT UNSIGNED NOT NULL DEFAULT 0,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
+
+-- What happened to a campaign's email to each user in its segment:
+-- sent, failed, or skipped, with the reason in error
+CREATE TABLE IF NOT EXISTS campaign_deliveries (
+    campaign_id BIGINT UNSIGNED NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    delivered_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (campaign_id, user_id),
+    KEY idx_campaign_deliveries_status (campaign_id, status, user_id),
+    KEY idx_campaign_deliveries_user_id (user_id)
+) ENGINE=InnoDB
+  DEFAULT CHARSET=utf8mb4
+  COLLATE=utf8mb4_unicode_ci;
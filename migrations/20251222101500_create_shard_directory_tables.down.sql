@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS user_email_index;
+DROP TABLE IF EXISTS user_id_sequence;
@@ -0,0 +1,9 @@
+-- Only needed when DB_SHARD_DSNS is set. Apply to the directory (DB_DSN) database.
+CREATE TABLE user_id_sequence (
+    id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY
+) ENGINE=InnoDB;
+
+CREATE TABLE user_email_index (
+    email VARCHAR(255) NOT NULL PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL UNIQUE
+) ENGINE=InnoDB;
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP COLUMN mfa_enabled_at,
+    DROP COLUMN mfa_secret;
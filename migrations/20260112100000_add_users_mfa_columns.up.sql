@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD COLUMN mfa_secret VARBINARY(255) NULL DEFAULT NULL AFTER deleted_at,
+    ADD COLUMN mfa_enabled_at TIMESTAMP NULL DEFAULT NULL AFTER mfa_secret;
@@ -0,0 +1,3 @@
+ALTER TABLE job_spool
+    DROP COLUMN error_trace,
+    DROP COLUMN attempts;
@@ -0,0 +1,3 @@
+ALTER TABLE job_spool
+    ADD COLUMN attempts INT UNSIGNED NOT NULL DEFAULT 0 AFTER payload,
+    ADD COLUMN error_trace MEDIUMTEXT NULL AFTER attempts;
@@ -0,0 +1,9 @@
+CREATE TABLE job_dead_letters (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    kind VARCHAR(100) NOT NULL,
+    payload MEDIUMBLOB NOT NULL,
+    attempts INT UNSIGNED NOT NULL,
+    error_trace MEDIUMTEXT NOT NULL,
+    failed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,12 @@
+CREATE TABLE scheduled_jobs (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    kind VARCHAR(100) NOT NULL,
+    payload MEDIUMBLOB NOT NULL,
+    unique_key VARCHAR(191) NULL DEFAULT NULL,
+    run_at TIMESTAMP NOT NULL,
+    every_seconds INT UNSIGNED NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (id),
+    UNIQUE KEY uk_scheduled_jobs_unique_key (unique_key),
+    KEY idx_scheduled_jobs_run_at (run_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN token_version INT UNSIGNED NOT NULL DEFAULT 0 AFTER password_hash;
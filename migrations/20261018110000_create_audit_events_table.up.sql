@@ -0,0 +1,9 @@
+CREATE TABLE audit_events (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    occurred_at TIMESTAMP(6) NOT NULL,
+    category VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    message TEXT NOT NULL,
+    PRIMARY KEY (id),
+    KEY idx_audit_events_category_occurred_at (category, occurred_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
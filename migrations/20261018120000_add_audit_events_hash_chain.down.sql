@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS audit_chain_head;
+
+ALTER TABLE audit_events
+    DROP KEY idx_audit_events_seq,
+    DROP COLUMN hash,
+    DROP COLUMN prev_hash,
+    DROP COLUMN seq;
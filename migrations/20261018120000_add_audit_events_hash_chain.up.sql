@@ -0,0 +1,15 @@
+ALTER TABLE audit_events
+    ADD COLUMN seq BIGINT UNSIGNED NOT NULL DEFAULT 0,
+    ADD COLUMN prev_hash CHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN hash CHAR(64) NOT NULL DEFAULT '',
+    ADD KEY idx_audit_events_seq (seq),
+    ALGORITHM=INPLACE, LOCK=NONE;
+
+CREATE TABLE audit_chain_head (
+    id TINYINT UNSIGNED NOT NULL,
+    seq BIGINT UNSIGNED NOT NULL,
+    hash CHAR(64) NOT NULL,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT INTO audit_chain_head (id, seq, hash) VALUES (1, 0, REPEAT('0', 64));
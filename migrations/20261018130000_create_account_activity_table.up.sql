@@ -0,0 +1,19 @@
+CREATE TABLE account_activity (
+    user_id BIGINT UNSIGNED NOT NULL,
+    last_login_at TIMESTAMP NOT NULL,
+    warned_at TIMESTAMP NULL DEFAULT NULL,
+    disabled_at TIMESTAMP NULL DEFAULT NULL,
+    delete_after TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (user_id),
+    KEY idx_account_activity_last_login_at (last_login_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Existing accounts start from their most recent session, or failing
+-- that from when they were created. (In sharded mode the directory's
+-- users table is empty: accounts without a session start at their next
+-- login or refresh.)
+INSERT INTO account_activity (user_id, last_login_at)
+SELECT user_id, MAX(last_used_at) FROM sessions GROUP BY user_id;
+
+INSERT IGNORE INTO account_activity (user_id, last_login_at)
+SELECT id, created_at FROM users WHERE deleted_at IS NULL;
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    ADD FULLTEXT INDEX idx_users_email_fulltext (email),
+    ALGORITHM=INPLACE, LOCK=SHARED;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN avatar_url VARCHAR(2048) NULL DEFAULT NULL AFTER email_verified_at;
@@ -0,0 +1,8 @@
+CREATE TABLE tenant_policies (
+    tenant_id VARCHAR(64) NOT NULL,
+    cors_origins TEXT NOT NULL,
+    redirect_uris TEXT NOT NULL,
+    webhook_urls TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
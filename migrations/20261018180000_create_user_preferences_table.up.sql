@@ -0,0 +1,6 @@
+CREATE TABLE user_preferences (
+    user_id BIGINT UNSIGNED NOT NULL,
+    data TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
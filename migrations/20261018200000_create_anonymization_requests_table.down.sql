@@ -0,0 +1 @@
+DROP TABLE IF EXISTS anonymization_requests;
@@ -0,0 +1,8 @@
+CREATE TABLE anonymization_requests (
+    user_id BIGINT UNSIGNED NOT NULL,
+    requested_by BIGINT UNSIGNED NOT NULL,
+    requested_at TIMESTAMP NOT NULL,
+    anonymize_after TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id),
+    KEY idx_anonymization_requests_anonymize_after (anonymize_after)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
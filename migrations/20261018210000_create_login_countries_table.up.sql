@@ -0,0 +1,7 @@
+CREATE TABLE login_countries (
+    user_id BIGINT UNSIGNED NOT NULL,
+    country CHAR(2) NOT NULL,
+    first_seen_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, country)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    ADD COLUMN is_active TINYINT(1) NOT NULL DEFAULT 1 AFTER avatar_url;
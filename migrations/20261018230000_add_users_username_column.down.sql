@@ -0,0 +1,3 @@
+ALTER TABLE users
+    DROP INDEX uk_users_username,
+    DROP COLUMN username;
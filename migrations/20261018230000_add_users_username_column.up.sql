@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN username VARCHAR(30) NULL DEFAULT NULL AFTER email,
+    ADD UNIQUE KEY uk_users_username (username),
+    ALGORITHM=INPLACE, LOCK=NONE;
@@ -0,0 +1,5 @@
+-- Only needed when DB_SHARD_DSNS is set. Apply to the directory (DB_DSN) database.
+CREATE TABLE user_username_index (
+    username VARCHAR(30) NOT NULL PRIMARY KEY,
+    user_id BIGINT UNSIGNED NOT NULL UNIQUE
+) ENGINE=InnoDB;
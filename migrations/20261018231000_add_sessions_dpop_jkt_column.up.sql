@@ -0,0 +1,3 @@
+ALTER TABLE sessions
+    ADD COLUMN dpop_jkt CHAR(43) CHARACTER SET ascii COLLATE ascii_bin NULL DEFAULT NULL AFTER ip_address,
+    ALGORITHM=INPLACE, LOCK=NONE;
@@ -0,0 +1,2 @@
+ALTER TABLE account_activity
+    DROP COLUMN last_login_ip;
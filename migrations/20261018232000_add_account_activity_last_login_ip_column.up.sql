@@ -0,0 +1,3 @@
+ALTER TABLE account_activity
+    ADD COLUMN last_login_ip VARCHAR(45) NULL DEFAULT NULL AFTER last_login_at,
+    ALGORITHM=INPLACE, LOCK=NONE;
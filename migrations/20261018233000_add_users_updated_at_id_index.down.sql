@@ -0,0 +1 @@
+DROP INDEX idx_users_updated_at_id ON users;
@@ -0,0 +1,4 @@
+-- The user cache's change feed reads users by updated_at, which MySQL
+-- bumps on every write (ON UPDATE CURRENT_TIMESTAMP): WHERE updated_at
+-- >= ? ORDER BY updated_at, id, an index range scan with this index.
+CREATE INDEX idx_users_updated_at_id ON users (updated_at, id) ALGORITHM=INPLACE LOCK=NONE;
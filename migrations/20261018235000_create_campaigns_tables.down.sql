@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS campaign_deliveries;
+DROP TABLE IF EXISTS campaigns;
@@ -0,0 +1,32 @@
+CREATE TABLE campaigns (
+    id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+    subject VARCHAR(255) NOT NULL,
+    body TEXT NOT NULL,
+    segment_created_from TIMESTAMP NULL DEFAULT NULL,
+    segment_created_to TIMESTAMP NULL DEFAULT NULL,
+    segment_role VARCHAR(50) NOT NULL DEFAULT '',
+    segment_active_since TIMESTAMP NULL DEFAULT NULL,
+    segment_inactive_since TIMESTAMP NULL DEFAULT NULL,
+    status VARCHAR(16) NOT NULL,
+    created_by BIGINT UNSIGNED NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    started_at TIMESTAMP NULL DEFAULT NULL,
+    ended_at TIMESTAMP NULL DEFAULT NULL,
+    cursor_pos VARCHAR(255) NOT NULL DEFAULT '',
+    sent INT UNSIGNED NOT NULL DEFAULT 0,
+    failed INT UNSIGNED NOT NULL DEFAULT 0,
+    skipped INT UNSIGNED NOT NULL DEFAULT 0,
+    PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+CREATE TABLE campaign_deliveries (
+    campaign_id BIGINT UNSIGNED NOT NULL,
+    user_id BIGINT UNSIGNED NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    error VARCHAR(255) NOT NULL DEFAULT '',
+    delivered_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (campaign_id, user_id),
+    KEY idx_campaign_deliveries_status (campaign_id, status, user_id),
+    KEY idx_campaign_deliveries_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
@@ -0,0 +1,2 @@
+ALTER TABLE users
+    RENAME INDEX uk_users_email TO email;
@@ -0,0 +1,3 @@
+ALTER TABLE users
+    RENAME INDEX email TO uk_users_email,
+    ALGORITHM=INPLACE, LOCK=NONE;
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN ulid CHAR(26) NULL DEFAULT NULL AFTER id,
+    ADD UNIQUE KEY uk_users_ulid (ulid),
+    ALGORITHM=INPLACE, LOCK=NONE;
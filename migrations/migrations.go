@@ -0,0 +1,15 @@
+// Package migrations embeds the SQL migration files into the binary,
+// so DB_AUTO_MIGRATE works without shipping the migrations/ directory.
+//
+// Only the timestamped *.up.sql files are embedded: they're what the
+// migration runner applies, in filename order. The .down.sql files are
+// for rolling back by hand, and 001_create_users_table.sql is a snapshot
+// of the full schema for setting up a fresh database in one go.
+package migrations
+
+import "embed"
+
+// FS holds every *.up.sql migration.
+//
+//go:embed *.up.sql
+var FS embed.FS